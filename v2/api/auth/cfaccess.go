@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"crypto/rsa"
 	"encoding/base64"
 	"encoding/json"
@@ -156,6 +157,18 @@ func (v *CFAccessValidator) Validate(tokenString string) (*CFAccessClaims, error
 	return claims, nil
 }
 
+type accessEmailKey struct{}
+
+func withAccessEmail(ctx context.Context, email string) context.Context {
+	return context.WithValue(ctx, accessEmailKey{}, email)
+}
+
+// AccessEmail returns the email from a validated Cloudflare Access JWT.
+func AccessEmail(ctx context.Context) string {
+	email, _ := ctx.Value(accessEmailKey{}).(string)
+	return email
+}
+
 func (v *CFAccessValidator) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token := r.Header.Get("Cf-Access-Jwt-Assertion")
@@ -163,10 +176,11 @@ func (v *CFAccessValidator) Middleware(next http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 			return
 		}
-		if _, err := v.Validate(token); err != nil {
+		claims, err := v.Validate(token)
+		if err != nil {
 			http.Error(w, "invalid cf access token", http.StatusForbidden)
 			return
 		}
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(withAccessEmail(r.Context(), claims.Email)))
 	})
 }
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"
+	RoleDeployer Role = "deployer"
+	RoleOperator Role = "operator"
+	RoleAdmin    Role = "admin"
+)
+
+// Roles lists every role from least to most privileged.
+var Roles = []Role{RoleViewer, RoleDeployer, RoleOperator, RoleAdmin}
+
+func (r Role) rank() int {
+	for i, role := range Roles {
+		if role == r {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Allows reports whether r grants everything required grants.
+func (r Role) Allows(required Role) bool {
+	return r.rank() > 0 && r.rank() >= required.rank()
+}
+
+func (r Role) Valid() bool { return r.rank() > 0 }
+
+func ParseRole(s string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(s)))
+	if !role.Valid() {
+		return "", fmt.Errorf("unknown role %q (want viewer, deployer, operator or admin)", s)
+	}
+	return role, nil
+}
+
+// MinRole returns the less privileged of two roles.
+func MinRole(a, b Role) Role {
+	if a.rank() <= b.rank() {
+		return a
+	}
+	return b
+}
+
+// Identity is the authenticated caller of an API request.
+type Identity struct {
+	User    string   `json:"user"`
+	Role    Role     `json:"role"`
+	Method  string   `json:"method"` // api-token, token, signed-token, cf-access, loopback, grant, open
+	TokenID string   `json:"tokenId,omitempty"`
+	Apps    []string `json:"apps,omitempty"` // empty means every app
+}
+
+// CanAccessApp reports whether the identity's token is scoped to app.
+func (i *Identity) CanAccessApp(app string) bool {
+	if i == nil || len(i.Apps) == 0 {
+		return true
+	}
+	for _, a := range i.Apps {
+		if a == app {
+			return true
+		}
+	}
+	return false
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+func FromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
+
+// Actor names the caller for audit fields, or fallback when unauthenticated.
+func Actor(ctx context.Context, fallback string) string {
+	if id := FromContext(ctx); id != nil && id.User != "" {
+		return id.User
+	}
+	return fallback
+}
+
+// Require rejects requests whose identity lacks role.
+func Require(role Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !authorize(w, r, role) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireByMethod applies read to GET/HEAD requests and write to the rest.
+func RequireByMethod(read, write Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role := write
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				role = read
+			}
+			if !authorize(w, r, role) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func authorize(w http.ResponseWriter, r *http.Request, role Role) bool {
+	id := FromContext(r.Context())
+	if id == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if !id.Role.Allows(role) {
+		http.Error(w, fmt.Sprintf("forbidden: %s role required", role), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// TokenPrefix marks personal API tokens stored in Postgres.
+const TokenPrefix = "norn_pat_"
+
+// NewToken returns a fresh personal API token and its storage hash.
+func NewToken() (token, hash string, err error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = TokenPrefix + hex.EncodeToString(buf)
+	return token, HashToken(token), nil
+}
+
+// HashToken is the at-rest form of a personal API token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
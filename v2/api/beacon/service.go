@@ -103,7 +103,7 @@ func (s *Service) Emit(ctx context.Context, event model.BeaconEvent) (*model.Bea
 	}
 
 	if s.ws != nil {
-		s.ws.Broadcast(hub.Event{Type: "beacon.event", AppID: event.App, Payload: event})
+		s.ws.Broadcast(hub.BeaconEvent(event))
 	}
 
 	if s.cfg.SinkURL != "" {
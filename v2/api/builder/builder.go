@@ -0,0 +1,348 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	BackendDocker   = "docker"
+	BackendBuildKit = "buildkit"
+	BackendBuildah  = "buildah"
+)
+
+// Backends lists the build backends an app may select in build.backend.
+var Backends = []string{BackendDocker, BackendBuildKit, BackendBuildah}
+
+// Config holds the host-level defaults for the build backends.
+type Config struct {
+	DefaultBackend string
+	BuildKitAddr   string // buildctl --addr; empty uses buildctl's default
+	DockerPath     string
+	BuildctlPath   string
+	BuildahPath    string
+}
+
+// Request describes one image build.
+type Request struct {
+	ContextDir string
+	Dockerfile string // path to the Dockerfile
+	Tag        string
+	Push       bool
+	Platforms  []string
+	Args       map[string]string
+	Target     string
+	CacheFrom  []string
+	CacheTo    []string
+	Secrets    []Secret
+}
+
+// Secret is a build secret mounted with RUN --mount=type=secret,id=<ID>.
+// Src is a file on the build host.
+type Secret struct {
+	ID  string
+	Src string
+}
+
+// Builder builds a container image and pushes it when requested. Images
+// that are not pushed are loaded into the local Docker daemon, where
+// Nomad's docker driver finds them.
+type Builder interface {
+	Name() string
+	// Available reports whether the backend's tooling is usable on this host.
+	Available() error
+	Build(ctx context.Context, req Request) error
+}
+
+// New returns the builder for backend, falling back to cfg.DefaultBackend
+// and then local Docker.
+func New(backend string, cfg Config) (Builder, error) {
+	if backend == "" {
+		backend = cfg.DefaultBackend
+	}
+	switch strings.ToLower(strings.TrimSpace(backend)) {
+	case "", BackendDocker:
+		return &Docker{Path: orDefault(cfg.DockerPath, "docker")}, nil
+	case BackendBuildKit, "buildctl":
+		return &BuildKit{Path: orDefault(cfg.BuildctlPath, "buildctl"), Addr: cfg.BuildKitAddr, DockerPath: orDefault(cfg.DockerPath, "docker")}, nil
+	case BackendBuildah, "rootless":
+		return &Buildah{Path: orDefault(cfg.BuildahPath, "buildah")}, nil
+	default:
+		return nil, fmt.Errorf("unknown build backend %q (want one of %s)", backend, strings.Join(Backends, ", "))
+	}
+}
+
+// Docker builds with the local Docker daemon. Pushes and multi-platform
+// builds go through buildx; single-platform local builds use docker build.
+type Docker struct {
+	Path string
+}
+
+func (d *Docker) Name() string { return BackendDocker }
+
+func (d *Docker) Available() error { return lookPath(d.Path) }
+
+func (d *Docker) Build(ctx context.Context, req Request) error {
+	return run(ctx, d.Path, d.args(req), "DOCKER_BUILDKIT=1")
+}
+
+func (d *Docker) args(req Request) []string {
+	buildx := req.Push || len(req.Platforms) > 1
+	var args []string
+	if buildx {
+		args = append(args, "buildx")
+	}
+	args = append(args, "build")
+	if len(req.Platforms) > 0 {
+		args = append(args, "--platform", strings.Join(req.Platforms, ","))
+	}
+	args = append(args, buildArgs("--build-arg", req.Args)...)
+	if req.Target != "" {
+		args = append(args, "--target", req.Target)
+	}
+	if buildx {
+		for _, ref := range req.CacheFrom {
+			args = append(args, "--cache-from", cacheSpec(ref, ""))
+		}
+		for _, ref := range req.CacheTo {
+			args = append(args, "--cache-to", cacheSpec(ref, "mode=max"))
+		}
+	} else {
+		// The classic builder only imports inline cache from image refs.
+		for _, ref := range req.CacheFrom {
+			args = append(args, "--cache-from", ref)
+		}
+	}
+	for _, s := range req.Secrets {
+		args = append(args, "--secret", secretSpec(s))
+	}
+	args = append(args, "-f", req.Dockerfile, "-t", req.Tag)
+	if req.Push {
+		args = append(args, "--push")
+	} else if buildx {
+		args = append(args, "--load")
+	}
+	return append(args, req.ContextDir)
+}
+
+// BuildKit talks to a buildkitd directly with buildctl, so no Docker daemon
+// is needed on the build host for pushed images. Images that are not pushed
+// are exported as a Docker archive and loaded with docker load.
+type BuildKit struct {
+	Path       string
+	Addr       string
+	DockerPath string
+}
+
+func (b *BuildKit) Name() string { return BackendBuildKit }
+
+func (b *BuildKit) Available() error { return lookPath(b.Path) }
+
+func (b *BuildKit) Build(ctx context.Context, req Request) error {
+	if req.Push {
+		return run(ctx, b.Path, b.args(req, ""))
+	}
+	if len(req.Platforms) > 1 {
+		return errMultiPlatformLoad(BackendBuildKit)
+	}
+	dir, err := os.MkdirTemp("", "norn-buildkit-")
+	if err != nil {
+		return fmt.Errorf("buildkit: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	archive := filepath.Join(dir, "image.tar")
+	if err := run(ctx, b.Path, b.args(req, archive)); err != nil {
+		return err
+	}
+	return run(ctx, orDefault(b.DockerPath, "docker"), []string{"load", "-i", archive})
+}
+
+// args builds the buildctl command line. Without a push, the image is
+// written to archive as a Docker image tarball.
+func (b *BuildKit) args(req Request, archive string) []string {
+	var args []string
+	if b.Addr != "" {
+		args = append(args, "--addr", b.Addr)
+	}
+	args = append(args, "build",
+		"--frontend", "dockerfile.v0",
+		"--local", "context="+req.ContextDir,
+		"--local", "dockerfile="+filepath.Dir(req.Dockerfile),
+		"--opt", "filename="+filepath.Base(req.Dockerfile),
+	)
+	if len(req.Platforms) > 0 {
+		args = append(args, "--opt", "platform="+strings.Join(req.Platforms, ","))
+	}
+	args = append(args, buildArgs("--opt", prefixKeys("build-arg:", req.Args))...)
+	if req.Target != "" {
+		args = append(args, "--opt", "target="+req.Target)
+	}
+	for _, ref := range req.CacheFrom {
+		args = append(args, "--import-cache", cacheSpec(ref, ""))
+	}
+	for _, ref := range req.CacheTo {
+		args = append(args, "--export-cache", cacheSpec(ref, "mode=max"))
+	}
+	for _, s := range req.Secrets {
+		args = append(args, "--secret", secretSpec(s))
+	}
+	output := "type=image,name=" + req.Tag + ",push=true"
+	if !req.Push {
+		output = "type=docker,name=" + req.Tag + ",dest=" + archive
+	}
+	return append(args, "--output", output)
+}
+
+// Buildah builds rootless and daemonless. Multi-platform builds are
+// assembled into a manifest list and pushed with all its images. Images
+// that are not pushed are copied into the local Docker daemon.
+type Buildah struct {
+	Path string
+}
+
+func (b *Buildah) Name() string { return BackendBuildah }
+
+func (b *Buildah) Available() error { return lookPath(b.Path) }
+
+func (b *Buildah) Build(ctx context.Context, req Request) error {
+	if !req.Push && len(req.Platforms) > 1 {
+		return errMultiPlatformLoad(BackendBuildah)
+	}
+	for _, args := range b.commands(req) {
+		if err := run(ctx, b.Path, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Buildah) commands(req Request) [][]string {
+	manifest := len(req.Platforms) > 1
+	build := []string{"build", "--layers"}
+	if len(req.Platforms) > 0 {
+		build = append(build, "--platform", strings.Join(req.Platforms, ","))
+	}
+	build = append(build, buildArgs("--build-arg", req.Args)...)
+	if req.Target != "" {
+		build = append(build, "--target", req.Target)
+	}
+	for _, ref := range req.CacheFrom {
+		build = append(build, "--cache-from", ref)
+	}
+	for _, ref := range req.CacheTo {
+		build = append(build, "--cache-to", ref)
+	}
+	for _, s := range req.Secrets {
+		build = append(build, "--secret", secretSpec(s))
+	}
+	if manifest {
+		build = append(build, "--manifest", req.Tag)
+	} else {
+		build = append(build, "-t", req.Tag)
+	}
+	build = append(build, "-f", req.Dockerfile, req.ContextDir)
+
+	cmds := [][]string{build}
+	switch {
+	case !req.Push:
+		cmds = append(cmds, []string{"push", req.Tag, "docker-daemon:" + req.Tag})
+	case manifest:
+		cmds = append(cmds, []string{"manifest", "push", "--all", req.Tag, "docker://" + req.Tag})
+	default:
+		cmds = append(cmds, []string{"push", req.Tag, "docker://" + req.Tag})
+	}
+	return cmds
+}
+
+// errMultiPlatformLoad explains why a multi-platform image cannot be built
+// without a registry: Docker's image store holds one platform per tag.
+func errMultiPlatformLoad(backend string) error {
+	return fmt.Errorf("%s cannot load a multi-platform image into Docker; set NORN_REGISTRY_URL to push it, or build a single platform", backend)
+}
+
+func run(ctx context.Context, path string, args []string, env ...string) error {
+	cmd := exec.CommandContext(ctx, path, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return fmt.Errorf("%s %s: %s", filepath.Base(path), firstArg(args), msg)
+	}
+	return nil
+}
+
+// firstArg names the subcommand for error messages, skipping global flags.
+func firstArg(args []string) string {
+	for i := 0; i < len(args); i++ {
+		if strings.HasPrefix(args[i], "--") {
+			i++
+			continue
+		}
+		return args[i]
+	}
+	return ""
+}
+
+func lookPath(path string) error {
+	if _, err := exec.LookPath(path); err != nil {
+		return fmt.Errorf("%s not found: %w", path, err)
+	}
+	return nil
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// buildArgs renders key=value pairs behind flag in sorted key order so the
+// command line is stable between builds.
+func buildArgs(flag string, values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	args := make([]string, 0, len(keys)*2)
+	for _, k := range keys {
+		args = append(args, flag, k+"="+values[k])
+	}
+	return args
+}
+
+func prefixKeys(prefix string, values map[string]string) map[string]string {
+	out := make(map[string]string, len(values))
+	for k, v := range values {
+		out[prefix+k] = v
+	}
+	return out
+}
+
+// cacheSpec accepts either a full BuildKit cache spec ("type=local,dest=...")
+// or a bare registry reference.
+func cacheSpec(ref, extra string) string {
+	if strings.Contains(ref, "type=") {
+		return ref
+	}
+	spec := "type=registry,ref=" + ref
+	if extra != "" {
+		spec += "," + extra
+	}
+	return spec
+}
+
+func secretSpec(s Secret) string {
+	return fmt.Sprintf("id=%s,src=%s", s.ID, s.Src)
+}
@@ -0,0 +1,117 @@
+package builder
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testRequest() Request {
+	return Request{
+		ContextDir: "/src",
+		Dockerfile: "/src/deploy/Dockerfile",
+		Tag:        "ghcr.io/acme/web:abc123",
+		Push:       true,
+		Platforms:  []string{"linux/amd64"},
+		Args:       map[string]string{"VERSION": "abc123", "BUILD_NUMBER": "42"},
+		Target:     "runtime",
+		CacheFrom:  []string{"ghcr.io/acme/web:cache"},
+		CacheTo:    []string{"type=local,dest=/tmp/cache"},
+		Secrets:    []Secret{{ID: "npm", Src: "/tmp/npm"}},
+	}
+}
+
+func TestDockerArgsUseBuildxForPushes(t *testing.T) {
+	got := (&Docker{Path: "docker"}).args(testRequest())
+	want := []string{
+		"buildx", "build",
+		"--platform", "linux/amd64",
+		"--build-arg", "BUILD_NUMBER=42",
+		"--build-arg", "VERSION=abc123",
+		"--target", "runtime",
+		"--cache-from", "type=registry,ref=ghcr.io/acme/web:cache",
+		"--cache-to", "type=local,dest=/tmp/cache",
+		"--secret", "id=npm,src=/tmp/npm",
+		"-f", "/src/deploy/Dockerfile",
+		"-t", "ghcr.io/acme/web:abc123",
+		"--push",
+		"/src",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("args =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestDockerArgsLocalBuildSkipsBuildx(t *testing.T) {
+	req := Request{ContextDir: "/src", Dockerfile: "/src/Dockerfile", Tag: "web:abc"}
+	got := strings.Join((&Docker{Path: "docker"}).args(req), " ")
+	if got != "build -f /src/Dockerfile -t web:abc /src" {
+		t.Fatalf("args = %q", got)
+	}
+}
+
+func TestBuildKitArgs(t *testing.T) {
+	got := strings.Join((&BuildKit{Path: "buildctl", Addr: "tcp://buildkitd:1234"}).args(testRequest(), ""), " ")
+	for _, want := range []string{
+		"--addr tcp://buildkitd:1234 build --frontend dockerfile.v0",
+		"--local context=/src --local dockerfile=/src/deploy --opt filename=Dockerfile",
+		"--opt platform=linux/amd64",
+		"--opt build-arg:BUILD_NUMBER=42 --opt build-arg:VERSION=abc123",
+		"--opt target=runtime",
+		"--import-cache type=registry,ref=ghcr.io/acme/web:cache",
+		"--export-cache type=local,dest=/tmp/cache",
+		"--output type=image,name=ghcr.io/acme/web:abc123,push=true",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("args %q missing %q", got, want)
+		}
+	}
+}
+
+func TestLocalBuildsLoadIntoDocker(t *testing.T) {
+	req := Request{ContextDir: "/src", Dockerfile: "/src/Dockerfile", Tag: "web:abc"}
+	got := strings.Join((&BuildKit{Path: "buildctl"}).args(req, "/tmp/image.tar"), " ")
+	if !strings.HasSuffix(got, "--output type=docker,name=web:abc,dest=/tmp/image.tar") {
+		t.Fatalf("buildkit args = %q, want a docker archive", got)
+	}
+	cmds := (&Buildah{Path: "buildah"}).commands(req)
+	want := []string{"push", "web:abc", "docker-daemon:web:abc"}
+	if len(cmds) != 2 || !reflect.DeepEqual(cmds[1], want) {
+		t.Fatalf("buildah commands = %v, want a copy into docker", cmds)
+	}
+
+	req.Platforms = []string{"linux/amd64", "linux/arm64"}
+	for _, b := range []Builder{&BuildKit{Path: "buildctl"}, &Buildah{Path: "buildah"}} {
+		if err := b.Build(context.Background(), req); err == nil || !strings.Contains(err.Error(), "NORN_REGISTRY_URL") {
+			t.Fatalf("%s multi-platform local build: err = %v", b.Name(), err)
+		}
+	}
+}
+
+func TestBuildahMultiPlatformPushesManifest(t *testing.T) {
+	req := testRequest()
+	req.Platforms = []string{"linux/amd64", "linux/arm64"}
+	cmds := (&Buildah{Path: "buildah"}).commands(req)
+	if len(cmds) != 2 {
+		t.Fatalf("commands = %v, want build and manifest push", cmds)
+	}
+	build := strings.Join(cmds[0], " ")
+	if !strings.Contains(build, "--platform linux/amd64,linux/arm64") || !strings.Contains(build, "--manifest ghcr.io/acme/web:abc123") {
+		t.Fatalf("build = %q", build)
+	}
+	want := []string{"manifest", "push", "--all", "ghcr.io/acme/web:abc123", "docker://ghcr.io/acme/web:abc123"}
+	if !reflect.DeepEqual(cmds[1], want) {
+		t.Fatalf("push = %v, want %v", cmds[1], want)
+	}
+}
+
+func TestNewRejectsUnknownBackend(t *testing.T) {
+	if _, err := New("kaniko", Config{}); err == nil {
+		t.Fatal("New(kaniko) succeeded, want error")
+	}
+	b, err := New("", Config{DefaultBackend: BackendBuildKit})
+	if err != nil || b.Name() != BackendBuildKit {
+		t.Fatalf("New default = %v, %v", b, err)
+	}
+}
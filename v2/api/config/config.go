@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -14,9 +15,14 @@ type Config struct {
 	GitToken    string
 	GitSSHKey   string
 	APIToken    string
+	PublicURL   string // NORN_PUBLIC_URL: where the UI is reached, for links posted to forges
 	RegistryURL string // GHCR registry (e.g. ghcr.io/username)
 	NetworkMode string // local, tailnet, public
 
+	BuildBackend   string   // NORN_BUILD_BACKEND: docker, buildkit, buildah
+	BuildKitAddr   string   // NORN_BUILDKIT_ADDR
+	BuildPlatforms []string // NORN_BUILD_PLATFORMS
+
 	NomadAddr  string // Nomad API address
 	ConsulAddr string // Consul API address
 
@@ -33,6 +39,18 @@ type Config struct {
 
 	RedpandaBrokers []string
 	RedpandaRPKPath string
+	// Admin API hosts and SASL superuser rpk manages app users with.
+	RedpandaAdminHosts []string
+	RedpandaUser       string
+	RedpandaPassword   string
+
+	// Vault KV v2 for apps with secretsBackend vault.
+	VaultAddr      string // NORN_VAULT_ADDR, or VAULT_ADDR
+	VaultToken     string // NORN_VAULT_TOKEN, or VAULT_TOKEN
+	VaultNamespace string // NORN_VAULT_NAMESPACE, or VAULT_NAMESPACE
+
+	// Prometheus-compatible query API for windowed tuning and canary signals.
+	PrometheusURL string // NORN_PROMETHEUS_URL
 
 	BeaconEnvironment string
 	BeaconSinkURL     string
@@ -42,6 +60,14 @@ type Config struct {
 	AllowedOrigins     string
 	CFAccessTeamDomain string
 	CFAccessAUD        string
+	// CFAccessDefaultRole is the role of Cloudflare Access users with no
+	// matching entry in the users table; empty denies them. The variable
+	// defaults to viewer when unset, and set empty or to none it denies.
+	CFAccessDefaultRole string // NORN_CF_ACCESS_DEFAULT_ROLE
+	// TrustedProxies are the addresses or CIDRs of reverse proxies whose
+	// CF-Connecting-IP and X-Forwarded-For headers are believed. Loopback,
+	// where cloudflared connects from, is always trusted.
+	TrustedProxies []string // NORN_TRUSTED_PROXIES
 
 	WebhookSecret          string // NORN_WEBHOOK_SECRET
 	CloudflaredConfig      string // NORN_CLOUDFLARED_CONFIG
@@ -49,6 +75,12 @@ type Config struct {
 	CloudflareZoneID       string // NORN_CLOUDFLARE_ZONE_ID
 	CloudflareLogpushToken string // NORN_CLOUDFLARE_LOGPUSH_TOKEN
 	CloudflareAPIBaseURL   string // NORN_CLOUDFLARE_API_BASE_URL
+
+	// WakeInterstitial is the page browsers get while a sleeping service
+	// starts: empty for the built-in page, a path to an html/template file,
+	// or "off" to hold browsers like API clients.
+	WakeInterstitial string // NORN_WAKE_INTERSTITIAL
+	WakeQueueLimit   int    // NORN_WAKE_QUEUE_LIMIT: requests held per waking target
 }
 
 func Load() *Config {
@@ -61,9 +93,14 @@ func Load() *Config {
 		GitToken:    os.Getenv("NORN_GIT_TOKEN"),
 		GitSSHKey:   os.Getenv("NORN_GIT_SSH_KEY"),
 		APIToken:    os.Getenv("NORN_API_TOKEN"),
+		PublicURL:   os.Getenv("NORN_PUBLIC_URL"),
 		RegistryURL: os.Getenv("NORN_REGISTRY_URL"),
 		NetworkMode: networkMode(envOr("NORN_NETWORK_MODE", "local")),
 
+		BuildBackend:   envOr("NORN_BUILD_BACKEND", "docker"),
+		BuildKitAddr:   os.Getenv("NORN_BUILDKIT_ADDR"),
+		BuildPlatforms: splitCSV(envOr("NORN_BUILD_PLATFORMS", "linux/amd64,linux/arm64")),
+
 		NomadAddr:  envOr("NORN_NOMAD_ADDR", "http://localhost:4646"),
 		ConsulAddr: envOr("NORN_CONSUL_ADDR", "http://localhost:8500"),
 
@@ -77,17 +114,28 @@ func Load() *Config {
 		GarageAdminEndpoint: os.Getenv("NORN_GARAGE_ADMIN_ENDPOINT"),
 		GarageAdminToken:    os.Getenv("NORN_GARAGE_ADMIN_TOKEN"),
 
-		RedpandaBrokers: splitCSV(os.Getenv("NORN_REDPANDA_BROKERS")),
-		RedpandaRPKPath: envOr("NORN_RPK_PATH", "rpk"),
+		RedpandaBrokers:    splitCSV(os.Getenv("NORN_REDPANDA_BROKERS")),
+		RedpandaRPKPath:    envOr("NORN_RPK_PATH", "rpk"),
+		RedpandaAdminHosts: splitCSV(os.Getenv("NORN_REDPANDA_ADMIN_HOSTS")),
+		RedpandaUser:       os.Getenv("NORN_REDPANDA_USER"),
+		RedpandaPassword:   os.Getenv("NORN_REDPANDA_PASSWORD"),
+
+		VaultAddr:      firstEnv("NORN_VAULT_ADDR", "VAULT_ADDR"),
+		VaultToken:     firstEnv("NORN_VAULT_TOKEN", "VAULT_TOKEN"),
+		VaultNamespace: firstEnv("NORN_VAULT_NAMESPACE", "VAULT_NAMESPACE"),
+
+		PrometheusURL: strings.TrimSpace(os.Getenv("NORN_PROMETHEUS_URL")),
 
 		BeaconEnvironment: envOr("NORN_BEACON_ENVIRONMENT", "mini"),
 		BeaconSinkURL:     os.Getenv("NORN_BEACON_SINK_URL"),
 		BeaconSinkKeyID:   os.Getenv("NORN_BEACON_SINK_KEY_ID"),
 		BeaconSinkSecret:  os.Getenv("NORN_BEACON_SINK_SECRET"),
 
-		AllowedOrigins:     os.Getenv("NORN_ALLOWED_ORIGINS"),
-		CFAccessTeamDomain: os.Getenv("NORN_CF_ACCESS_TEAM_DOMAIN"),
-		CFAccessAUD:        os.Getenv("NORN_CF_ACCESS_AUD"),
+		AllowedOrigins:      os.Getenv("NORN_ALLOWED_ORIGINS"),
+		TrustedProxies:      splitCSV(os.Getenv("NORN_TRUSTED_PROXIES")),
+		CFAccessTeamDomain:  os.Getenv("NORN_CF_ACCESS_TEAM_DOMAIN"),
+		CFAccessAUD:         os.Getenv("NORN_CF_ACCESS_AUD"),
+		CFAccessDefaultRole: cfAccessDefaultRole(),
 
 		WebhookSecret:          os.Getenv("NORN_WEBHOOK_SECRET"),
 		CloudflaredConfig:      envOr("NORN_CLOUDFLARED_CONFIG", os.Getenv("HOME")+"/.cloudflared/config.yml"),
@@ -95,6 +143,9 @@ func Load() *Config {
 		CloudflareZoneID:       firstEnv("NORN_CLOUDFLARE_ZONE_ID", "CLOUDFLARE_ZONE_ID"),
 		CloudflareLogpushToken: os.Getenv("NORN_CLOUDFLARE_LOGPUSH_TOKEN"),
 		CloudflareAPIBaseURL:   envOr("NORN_CLOUDFLARE_API_BASE_URL", "https://api.cloudflare.com/client/v4"),
+
+		WakeInterstitial: strings.TrimSpace(os.Getenv("NORN_WAKE_INTERSTITIAL")),
+		WakeQueueLimit:   envInt("NORN_WAKE_QUEUE_LIMIT", 100),
 	}
 }
 
@@ -128,6 +179,20 @@ func validUIDir(dir string) bool {
 	return err == nil && !index.IsDir()
 }
 
+// cfAccessDefaultRole reads NORN_CF_ACCESS_DEFAULT_ROLE. Unlike envOr, a
+// variable that is set but empty is kept, so unknown users can be denied.
+func cfAccessDefaultRole() string {
+	v, ok := os.LookupEnv("NORN_CF_ACCESS_DEFAULT_ROLE")
+	if !ok {
+		return "viewer"
+	}
+	v = strings.TrimSpace(v)
+	if strings.EqualFold(v, "none") {
+		return ""
+	}
+	return v
+}
+
 func envOr(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -165,3 +230,10 @@ func networkMode(mode string) string {
 		return "local"
 	}
 }
+
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key))); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
@@ -138,6 +138,8 @@ func TestExplicitUIDirWithoutIndexFallsBackToCurrentReleaseUI(t *testing.T) {
 func TestRedpandaConfig(t *testing.T) {
 	t.Setenv("NORN_REDPANDA_BROKERS", "127.0.0.1:9092, redpanda.service.consul:9092")
 	t.Setenv("NORN_RPK_PATH", "/opt/redpanda/bin/rpk")
+	t.Setenv("NORN_REDPANDA_ADMIN_HOSTS", "127.0.0.1:9644")
+	t.Setenv("NORN_REDPANDA_USER", "admin")
 
 	cfg := Load()
 
@@ -147,4 +149,33 @@ func TestRedpandaConfig(t *testing.T) {
 	if cfg.RedpandaRPKPath != "/opt/redpanda/bin/rpk" {
 		t.Fatalf("RedpandaRPKPath = %q", cfg.RedpandaRPKPath)
 	}
+	if len(cfg.RedpandaAdminHosts) != 1 || cfg.RedpandaUser != "admin" {
+		t.Fatalf("admin hosts = %v, user = %q", cfg.RedpandaAdminHosts, cfg.RedpandaUser)
+	}
+}
+
+func TestPrometheusConfig(t *testing.T) {
+	t.Setenv("NORN_PROMETHEUS_URL", " http://prometheus.service.consul:9090 ")
+
+	if got := Load().PrometheusURL; got != "http://prometheus.service.consul:9090" {
+		t.Fatalf("PrometheusURL = %q", got)
+	}
+}
+
+func TestCFAccessDefaultRoleCanDeny(t *testing.T) {
+	t.Setenv("NORN_CF_ACCESS_DEFAULT_ROLE", "") // restored after the test
+	os.Unsetenv("NORN_CF_ACCESS_DEFAULT_ROLE")
+	if got := Load().CFAccessDefaultRole; got != "viewer" {
+		t.Fatalf("unset = %q, want viewer", got)
+	}
+	for _, v := range []string{"", "none"} {
+		t.Setenv("NORN_CF_ACCESS_DEFAULT_ROLE", v)
+		if got := Load().CFAccessDefaultRole; got != "" {
+			t.Fatalf("%q = %q, want unknown users denied", v, got)
+		}
+	}
+	t.Setenv("NORN_CF_ACCESS_DEFAULT_ROLE", "operator")
+	if got := Load().CFAccessDefaultRole; got != "operator" {
+		t.Fatalf("operator = %q", got)
+	}
 }
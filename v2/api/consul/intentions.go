@@ -0,0 +1,210 @@
+package consul
+
+import (
+	"fmt"
+	"sort"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+// managedIntention is the description Norn puts on the intention sources
+// it derives from declared upstreams. Sources without it belong to
+// operators and are never touched.
+const managedIntention = "managed by norn"
+
+// Intention is one source rule of a destination's service-intentions.
+type Intention struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Action      string `json:"action"` // allow, deny
+	Managed     bool   `json:"managed"`
+}
+
+// IntentionChange is an intention SyncIntentions added or removed.
+type IntentionChange struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Change      string `json:"change"` // added, removed
+}
+
+// Intentions lists every source rule of every service-intentions entry.
+func (c *Client) Intentions() ([]Intention, error) {
+	entries, err := c.intentionEntries()
+	if err != nil {
+		return nil, err
+	}
+	var out []Intention
+	for _, entry := range entries {
+		for _, src := range entry.Sources {
+			out = append(out, Intention{
+				Source:      src.Name,
+				Destination: entry.Name,
+				Action:      string(src.Action),
+				Managed:     src.Description == managedIntention,
+			})
+		}
+	}
+	return out, nil
+}
+
+// SyncIntentions makes the Norn-managed intentions from sources match
+// graph, which maps each source to the upstreams it may call. Managed
+// intentions from sources to destinations graph no longer lists are
+// removed; a source missing from graph loses all of them.
+func (c *Client) SyncIntentions(sources []string, graph map[string][]string) ([]IntentionChange, error) {
+	entries, err := c.intentionEntries()
+	if err != nil {
+		return nil, err
+	}
+	write, remove, changes := planIntentions(entries, sources, graph)
+	if err := c.applyIntentions(write, remove); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// GrantIntentions adds the Norn-managed intentions graph lists and keeps
+// every managed intention its sources already hold, so running allocations
+// keep their upstreams until SyncIntentions prunes them.
+func (c *Client) GrantIntentions(graph map[string][]string) ([]IntentionChange, error) {
+	entries, err := c.intentionEntries()
+	if err != nil {
+		return nil, err
+	}
+	write, remove, changes := planIntentions(entries, nil, withManagedIntentions(entries, graph))
+	if err := c.applyIntentions(write, remove); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (c *Client) applyIntentions(write []*consulapi.ServiceIntentionsConfigEntry, remove []string) error {
+	for _, entry := range write {
+		if _, _, err := c.api.ConfigEntries().Set(entry, nil); err != nil {
+			return fmt.Errorf("write intentions for %s: %w", entry.Name, err)
+		}
+	}
+	for _, name := range remove {
+		if _, err := c.api.ConfigEntries().Delete(consulapi.ServiceIntentions, name, nil); err != nil {
+			return fmt.Errorf("delete intentions for %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// withManagedIntentions adds to graph the destinations its sources already
+// reach through managed intentions.
+func withManagedIntentions(entries []*consulapi.ServiceIntentionsConfigEntry, graph map[string][]string) map[string][]string {
+	out := make(map[string][]string, len(graph))
+	for src, dests := range graph {
+		out[src] = append([]string(nil), dests...)
+	}
+	for _, entry := range entries {
+		for _, src := range entry.Sources {
+			if _, ok := out[src.Name]; ok && src.Description == managedIntention {
+				out[src.Name] = append(out[src.Name], entry.Name)
+			}
+		}
+	}
+	return out
+}
+
+func (c *Client) intentionEntries() ([]*consulapi.ServiceIntentionsConfigEntry, error) {
+	list, _, err := c.api.ConfigEntries().List(consulapi.ServiceIntentions, nil)
+	if err != nil {
+		return nil, fmt.Errorf("list intentions: %w", err)
+	}
+	var out []*consulapi.ServiceIntentionsConfigEntry
+	for _, entry := range list {
+		if e, ok := entry.(*consulapi.ServiceIntentionsConfigEntry); ok {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+// planIntentions works out which service-intentions entries to write and
+// which to delete. An entry left without sources is deleted.
+func planIntentions(entries []*consulapi.ServiceIntentionsConfigEntry, sources []string, graph map[string][]string) ([]*consulapi.ServiceIntentionsConfigEntry, []string, []IntentionChange) {
+	owned := map[string]bool{}
+	for _, src := range sources {
+		owned[src] = true
+	}
+	desired := map[[2]string]bool{}
+	for src, dests := range graph {
+		owned[src] = true
+		for _, dest := range dests {
+			desired[[2]string{src, dest}] = true
+		}
+	}
+
+	byName := map[string]*consulapi.ServiceIntentionsConfigEntry{}
+	present := map[[2]string]bool{}
+	changed := map[string]bool{}
+	var changes []IntentionChange
+	for _, entry := range entries {
+		kept := entry.Sources[:0:0]
+		for _, src := range entry.Sources {
+			pair := [2]string{src.Name, entry.Name}
+			if src.Description == managedIntention && owned[src.Name] && !desired[pair] {
+				changes = append(changes, IntentionChange{Source: src.Name, Destination: entry.Name, Change: "removed"})
+				changed[entry.Name] = true
+				continue
+			}
+			present[pair] = true
+			kept = append(kept, src)
+		}
+		copied := *entry
+		copied.Sources = kept
+		byName[entry.Name] = &copied
+	}
+
+	pairs := make([][2]string, 0, len(desired))
+	for pair := range desired {
+		if !present[pair] {
+			pairs = append(pairs, pair)
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i][1] != pairs[j][1] {
+			return pairs[i][1] < pairs[j][1]
+		}
+		return pairs[i][0] < pairs[j][0]
+	})
+	for _, pair := range pairs {
+		src, dest := pair[0], pair[1]
+		entry := byName[dest]
+		if entry == nil {
+			entry = &consulapi.ServiceIntentionsConfigEntry{
+				Kind: consulapi.ServiceIntentions,
+				Name: dest,
+				Meta: map[string]string{"managed-by": "norn"},
+			}
+			byName[dest] = entry
+		}
+		entry.Sources = append(entry.Sources, &consulapi.SourceIntention{
+			Name:        src,
+			Action:      consulapi.IntentionActionAllow,
+			Type:        consulapi.IntentionSourceConsul,
+			Description: managedIntention,
+		})
+		changes = append(changes, IntentionChange{Source: src, Destination: dest, Change: "added"})
+		changed[dest] = true
+	}
+
+	names := make([]string, 0, len(changed))
+	for name := range changed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var write []*consulapi.ServiceIntentionsConfigEntry
+	var remove []string
+	for _, name := range names {
+		if len(byName[name].Sources) == 0 {
+			remove = append(remove, name)
+			continue
+		}
+		write = append(write, byName[name])
+	}
+	return write, remove, changes
+}
@@ -0,0 +1,79 @@
+package consul
+
+import (
+	"testing"
+
+	consulapi "github.com/hashicorp/consul/api"
+)
+
+func TestPlanIntentionsOnlyTouchesManagedSources(t *testing.T) {
+	entries := []*consulapi.ServiceIntentionsConfigEntry{
+		{Kind: consulapi.ServiceIntentions, Name: "ledger-api", Sources: []*consulapi.SourceIntention{
+			{Name: "billing-web", Action: consulapi.IntentionActionAllow, Description: managedIntention},
+			{Name: "billing-admin", Action: consulapi.IntentionActionAllow, Description: managedIntention},
+			{Name: "reports", Action: consulapi.IntentionActionDeny},
+		}},
+		{Kind: consulapi.ServiceIntentions, Name: "search", Sources: []*consulapi.SourceIntention{
+			{Name: "billing-web", Action: consulapi.IntentionActionAllow, Description: managedIntention},
+		}},
+		{Kind: consulapi.ServiceIntentions, Name: "auth", Sources: []*consulapi.SourceIntention{
+			{Name: "billing-web", Action: consulapi.IntentionActionAllow},
+		}},
+	}
+	sources := []string{"billing-admin", "billing-web"}
+	graph := map[string][]string{"billing-web": {"ledger-api", "auth", "mailer"}}
+
+	write, remove, changes := planIntentions(entries, sources, graph)
+	if len(remove) != 1 || remove[0] != "search" {
+		t.Fatalf("remove = %v", remove)
+	}
+	if len(write) != 2 || write[0].Name != "ledger-api" || write[1].Name != "mailer" {
+		t.Fatalf("write = %+v", write)
+	}
+	ledger := write[0].Sources
+	if len(ledger) != 2 || ledger[0].Name != "billing-web" || ledger[1].Name != "reports" {
+		t.Fatalf("ledger sources = %+v", ledger)
+	}
+	if mailer := write[1]; mailer.Meta["managed-by"] != "norn" || mailer.Sources[0].Action != consulapi.IntentionActionAllow {
+		t.Fatalf("mailer = %+v", mailer)
+	}
+	want := map[IntentionChange]bool{
+		{Source: "billing-admin", Destination: "ledger-api", Change: "removed"}: true,
+		{Source: "billing-web", Destination: "search", Change: "removed"}:       true,
+		{Source: "billing-web", Destination: "mailer", Change: "added"}:         true,
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %+v", changes)
+	}
+	for _, c := range changes {
+		if !want[c] {
+			t.Fatalf("unexpected change %+v", c)
+		}
+	}
+	if len(entries[0].Sources) != 3 {
+		t.Fatal("planning must not modify the entries it was given")
+	}
+}
+
+func TestGrantKeepsManagedIntentions(t *testing.T) {
+	entries := []*consulapi.ServiceIntentionsConfigEntry{
+		{Kind: consulapi.ServiceIntentions, Name: "search", Sources: []*consulapi.SourceIntention{
+			{Name: "billing-web", Action: consulapi.IntentionActionAllow, Description: managedIntention},
+		}},
+	}
+	graph := map[string][]string{"billing-web": {"mailer"}}
+
+	write, remove, changes := planIntentions(entries, nil, withManagedIntentions(entries, graph))
+	if len(remove) != 0 {
+		t.Fatalf("remove = %v, want the dropped upstream kept until the prune", remove)
+	}
+	if len(write) != 1 || write[0].Name != "mailer" {
+		t.Fatalf("write = %+v", write)
+	}
+	if len(changes) != 1 || changes[0] != (IntentionChange{Source: "billing-web", Destination: "mailer", Change: "added"}) {
+		t.Fatalf("changes = %+v", changes)
+	}
+	if len(graph["billing-web"]) != 1 {
+		t.Fatal("granting must not modify the graph it was given")
+	}
+}
@@ -0,0 +1,111 @@
+package consul
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	consulapi "github.com/hashicorp/consul/api"
+
+	"norn/v2/api/model"
+)
+
+// SplitTraffic sends weight percent of the mesh traffic for service to its
+// canary instances and the rest to the stable ones. Splitting needs an L7
+// protocol, so a service still on tcp is switched to http.
+func (c *Client) SplitTraffic(service string, weight int) error {
+	entries := c.api.ConfigEntries()
+	existing, _, err := entries.Get(consulapi.ServiceResolver, service, nil)
+	switch {
+	case err == nil && existing.GetMeta()["managed-by"] != "norn":
+		return fmt.Errorf("service-resolver for %s is not managed by norn", service)
+	case err != nil && !notFound(err):
+		return fmt.Errorf("read service-resolver for %s: %w", service, err)
+	}
+
+	defaults, _, err := entries.Get(consulapi.ServiceDefaults, service, nil)
+	if err != nil && !notFound(err) {
+		return fmt.Errorf("read service-defaults for %s: %w", service, err)
+	}
+	if entry, ok := defaults.(*consulapi.ServiceConfigEntry); !ok || !splittableProtocol(entry.Protocol) {
+		entry := &consulapi.ServiceConfigEntry{
+			Kind:     consulapi.ServiceDefaults,
+			Name:     service,
+			Protocol: "http",
+			Meta:     map[string]string{"managed-by": "norn"},
+		}
+		if _, _, err := entries.Set(entry, nil); err != nil {
+			return fmt.Errorf("write service-defaults for %s: %w", service, err)
+		}
+	}
+
+	resolver, splitter := planSplit(service, weight)
+	if _, _, err := entries.Set(resolver, nil); err != nil {
+		return fmt.Errorf("write service-resolver for %s: %w", service, err)
+	}
+	if _, _, err := entries.Set(splitter, nil); err != nil {
+		return fmt.Errorf("write service-splitter for %s: %w", service, err)
+	}
+	return nil
+}
+
+// ClearSplit removes the splitter and resolver SplitTraffic wrote, so the
+// service's traffic is balanced over every instance again.
+func (c *Client) ClearSplit(service string) error {
+	entries := c.api.ConfigEntries()
+	for _, kind := range []string{consulapi.ServiceSplitter, consulapi.ServiceResolver} {
+		entry, _, err := entries.Get(kind, service, nil)
+		if err != nil {
+			if notFound(err) {
+				continue
+			}
+			return fmt.Errorf("read %s for %s: %w", kind, service, err)
+		}
+		if entry.GetMeta()["managed-by"] != "norn" {
+			continue
+		}
+		if _, err := entries.Delete(kind, service, nil); err != nil {
+			return fmt.Errorf("delete %s for %s: %w", kind, service, err)
+		}
+	}
+	return nil
+}
+
+// planSplit builds the resolver that subsets service into canary and stable
+// instances by model.CanaryTag, and the splitter that weights between them.
+func planSplit(service string, weight int) (*consulapi.ServiceResolverConfigEntry, *consulapi.ServiceSplitterConfigEntry) {
+	meta := map[string]string{"managed-by": "norn"}
+	resolver := &consulapi.ServiceResolverConfigEntry{
+		Kind:          consulapi.ServiceResolver,
+		Name:          service,
+		DefaultSubset: "stable",
+		Subsets: map[string]consulapi.ServiceResolverSubset{
+			"canary": {Filter: fmt.Sprintf("%q in Service.Tags", model.CanaryTag)},
+			"stable": {Filter: fmt.Sprintf("%q not in Service.Tags", model.CanaryTag)},
+		},
+		Meta: meta,
+	}
+	splitter := &consulapi.ServiceSplitterConfigEntry{
+		Kind: consulapi.ServiceSplitter,
+		Name: service,
+		Splits: []consulapi.ServiceSplit{
+			{Weight: float32(weight), ServiceSubset: "canary"},
+			{Weight: float32(100 - weight), ServiceSubset: "stable"},
+		},
+		Meta: meta,
+	}
+	return resolver, splitter
+}
+
+func notFound(err error) bool {
+	var status consulapi.StatusError
+	return errors.As(err, &status) && status.Code == http.StatusNotFound
+}
+
+func splittableProtocol(protocol string) bool {
+	switch protocol {
+	case "http", "http2", "grpc":
+		return true
+	}
+	return false
+}
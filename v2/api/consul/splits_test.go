@@ -0,0 +1,24 @@
+package consul
+
+import (
+	"testing"
+
+	"norn/v2/api/model"
+)
+
+func TestPlanSplitWeightsCanaryAgainstStable(t *testing.T) {
+	resolver, splitter := planSplit("shop-web", 10)
+	if resolver.DefaultSubset != "stable" || resolver.Meta["managed-by"] != "norn" {
+		t.Fatalf("resolver = %+v", resolver)
+	}
+	if got := resolver.Subsets["canary"].Filter; got != `"`+model.CanaryTag+`" in Service.Tags` {
+		t.Fatalf("canary filter = %q", got)
+	}
+	if got := resolver.Subsets["stable"].Filter; got != `"`+model.CanaryTag+`" not in Service.Tags` {
+		t.Fatalf("stable filter = %q", got)
+	}
+	splits := splitter.Splits
+	if len(splits) != 2 || splits[0].ServiceSubset != "canary" || splits[0].Weight != 10 || splits[1].ServiceSubset != "stable" || splits[1].Weight != 90 {
+		t.Fatalf("splits = %+v", splits)
+	}
+}
@@ -0,0 +1,200 @@
+// Package forge reports deploy results back to the git forge hosting an
+// app's repository.
+package forge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	ProviderGitHub = "github"
+	ProviderGitea  = "gitea"
+)
+
+// Providers lists the forges a Client can be built for.
+var Providers = []string{ProviderGitHub, ProviderGitea}
+
+// State is a commit status state. Both forges accept these four.
+type State string
+
+const (
+	StatePending State = "pending"
+	StateSuccess State = "success"
+	StateFailure State = "failure"
+	StateError   State = "error"
+)
+
+// Status is a commit status shown next to a commit or pull request.
+type Status struct {
+	State State
+	// Context groups updates for the same check, e.g. norn/preview.
+	Context     string
+	Description string
+	TargetURL   string
+}
+
+// Repo identifies a repository on a forge host.
+type Repo struct {
+	Scheme string
+	Host   string
+	Owner  string
+	Name   string
+}
+
+func (r Repo) String() string {
+	return r.Host + "/" + r.Owner + "/" + r.Name
+}
+
+// ParseRepo reads the host, owner and name from an https or ssh clone URL.
+func ParseRepo(raw string) (Repo, error) {
+	raw = strings.TrimSpace(raw)
+	repo := Repo{Scheme: "https"}
+	var path string
+	switch {
+	case strings.HasPrefix(raw, "git@"):
+		hostPath := strings.TrimPrefix(raw, "git@")
+		idx := strings.Index(hostPath, ":")
+		if idx == -1 {
+			return Repo{}, fmt.Errorf("invalid ssh repo url %q", raw)
+		}
+		repo.Host = hostPath[:idx]
+		path = hostPath[idx+1:]
+	default:
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return Repo{}, fmt.Errorf("invalid repo url %q", raw)
+		}
+		if u.Scheme == "http" {
+			repo.Scheme = "http"
+		}
+		repo.Host = u.Hostname()
+		if u.Port() != "" && u.Scheme != "ssh" {
+			repo.Host = u.Host
+		}
+		path = u.Path
+	}
+	parts := strings.Split(strings.Trim(strings.TrimSuffix(path, ".git"), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return Repo{}, fmt.Errorf("repo url %q is not owner/name", raw)
+	}
+	repo.Owner, repo.Name = parts[0], parts[1]
+	return repo, nil
+}
+
+// Client posts deploy results to a forge.
+type Client interface {
+	Name() string
+	// SetStatus sets a commit status on sha.
+	SetStatus(ctx context.Context, repo Repo, sha string, status Status) error
+	// Comment adds a comment to pull request number.
+	Comment(ctx context.Context, repo Repo, number int, body string) error
+}
+
+// DeploymentState is the state of a forge deployment.
+type DeploymentState string
+
+const (
+	DeploymentQueued     DeploymentState = "queued"
+	DeploymentInProgress DeploymentState = "in_progress"
+	DeploymentSuccess    DeploymentState = "success"
+	DeploymentFailure    DeploymentState = "failure"
+	DeploymentError      DeploymentState = "error"
+)
+
+// Deployment is a forge's record that a commit is being deployed to an
+// environment.
+type Deployment struct {
+	Ref         string
+	Environment string
+	Description string
+	Production  bool
+}
+
+// DeploymentStatus updates a deployment. LogURL links to the deploy's
+// progress and EnvironmentURL to the deployed app.
+type DeploymentStatus struct {
+	State          DeploymentState
+	Description    string
+	LogURL         string
+	EnvironmentURL string
+}
+
+// Deployer is implemented by forges with a deployments API. Gitea has none,
+// so callers fall back to a commit status per environment.
+type Deployer interface {
+	// CreateDeployment records a deployment of d.Ref and returns its ID.
+	CreateDeployment(ctx context.Context, repo Repo, d Deployment) (int64, error)
+	SetDeploymentStatus(ctx context.Context, repo Repo, id int64, status DeploymentStatus) error
+}
+
+// Config holds the credentials and transport shared by the forge clients.
+type Config struct {
+	Token string
+	// BaseURL overrides the API root derived from the repo host.
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// New returns the client for provider.
+func New(provider string, cfg Config) (Client, error) {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 15 * time.Second}
+	}
+	switch strings.ToLower(strings.TrimSpace(provider)) {
+	case ProviderGitHub:
+		return &GitHub{cfg: cfg}, nil
+	case ProviderGitea, "forgejo":
+		return &Gitea{cfg: cfg}, nil
+	default:
+		return nil, fmt.Errorf("unknown forge %q (want one of %s)", provider, strings.Join(Providers, ", "))
+	}
+}
+
+// postJSON sends body to url with the given Authorization header and fails
+// on any non-2xx response. A non-nil out receives the decoded response.
+func postJSON(ctx context.Context, client *http.Client, authorization, url string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("POST %s: %s: %s", url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("POST %s: decode response: %w", url, err)
+		}
+	}
+	return nil
+}
+
+// truncate keeps s within the forges' description limits.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
@@ -0,0 +1,134 @@
+package forge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseRepo(t *testing.T) {
+	cases := map[string]Repo{
+		"https://github.com/acme/shop.git":         {Scheme: "https", Host: "github.com", Owner: "acme", Name: "shop"},
+		"git@github.com:acme/shop.git":             {Scheme: "https", Host: "github.com", Owner: "acme", Name: "shop"},
+		"http://gitea.local:3000/acme/shop":        {Scheme: "http", Host: "gitea.local:3000", Owner: "acme", Name: "shop"},
+		"ssh://git@gitea.local:2222/acme/shop.git": {Scheme: "https", Host: "gitea.local", Owner: "acme", Name: "shop"},
+	}
+	for raw, want := range cases {
+		got, err := ParseRepo(raw)
+		if err != nil {
+			t.Fatalf("ParseRepo(%q): %v", raw, err)
+		}
+		if got != want {
+			t.Fatalf("ParseRepo(%q) = %+v, want %+v", raw, got, want)
+		}
+	}
+	if _, err := ParseRepo("https://github.com/acme"); err == nil {
+		t.Fatal("expected error for url without repo name")
+	}
+}
+
+func TestClientsPostStatusAndComment(t *testing.T) {
+	for _, tc := range []struct {
+		provider string
+		auth     string
+	}{
+		{ProviderGitHub, "Bearer tok"},
+		{ProviderGitea, "token tok"},
+	} {
+		var paths []string
+		var status map[string]string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if got := r.Header.Get("Authorization"); got != tc.auth {
+				t.Errorf("%s: authorization = %q, want %q", tc.provider, got, tc.auth)
+			}
+			paths = append(paths, r.URL.Path)
+			if status == nil {
+				_ = json.NewDecoder(r.Body).Decode(&status)
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+		client, err := New(tc.provider, Config{Token: "tok", BaseURL: srv.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo := Repo{Scheme: "https", Host: "example.com", Owner: "acme", Name: "shop"}
+		if err := client.SetStatus(context.Background(), repo, "abc123", Status{State: StateSuccess, Context: "norn/preview", TargetURL: "https://shop-pr-7.preview.example.com"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := client.Comment(context.Background(), repo, 7, "ready"); err != nil {
+			t.Fatal(err)
+		}
+		srv.Close()
+
+		if len(paths) != 2 || paths[0] != "/repos/acme/shop/statuses/abc123" || paths[1] != "/repos/acme/shop/issues/7/comments" {
+			t.Fatalf("%s: paths = %v", tc.provider, paths)
+		}
+		if status["state"] != "success" || status["context"] != "norn/preview" || status["target_url"] == "" {
+			t.Fatalf("%s: status body = %v", tc.provider, status)
+		}
+	}
+}
+
+func TestClientReportsErrorResponses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad credentials", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	client, _ := New(ProviderGitHub, Config{BaseURL: srv.URL})
+	if err := client.Comment(context.Background(), Repo{Owner: "acme", Name: "shop"}, 1, "x"); err == nil {
+		t.Fatal("expected error for 401 response")
+	}
+	if _, err := New("bitbucket", Config{}); err == nil {
+		t.Fatal("expected error for unknown forge")
+	}
+}
+
+func TestGitHubDeployments(t *testing.T) {
+	var bodies []map[string]interface{}
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		bodies = append(bodies, body)
+		paths = append(paths, r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+		if r.URL.Path == "/repos/acme/shop/deployments" {
+			_, _ = w.Write([]byte(`{"id": 42}`))
+		}
+	}))
+	defer srv.Close()
+
+	client, _ := New(ProviderGitHub, Config{Token: "tok", BaseURL: srv.URL})
+	deployer, ok := client.(Deployer)
+	if !ok {
+		t.Fatal("github client should implement Deployer")
+	}
+	repo := Repo{Owner: "acme", Name: "shop"}
+	id, err := deployer.CreateDeployment(context.Background(), repo, Deployment{Ref: "abc123", Environment: "staging"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 42 {
+		t.Fatalf("deployment id = %d, want 42", id)
+	}
+	if err := deployer.SetDeploymentStatus(context.Background(), repo, id, DeploymentStatus{State: DeploymentSuccess, LogURL: "https://norn.example.com/?saga=s1"}); err != nil {
+		t.Fatal(err)
+	}
+	if paths[1] != "/repos/acme/shop/deployments/42/statuses" {
+		t.Fatalf("status path = %s", paths[1])
+	}
+	if contexts, ok := bodies[0]["required_contexts"].([]interface{}); !ok || len(contexts) != 0 {
+		t.Fatalf("required_contexts = %v, want empty list", bodies[0]["required_contexts"])
+	}
+	if bodies[1]["state"] != "success" || bodies[1]["log_url"] != "https://norn.example.com/?saga=s1" {
+		t.Fatalf("status body = %v", bodies[1])
+	}
+
+	gitea, _ := New(ProviderGitea, Config{})
+	if _, ok := gitea.(Deployer); ok {
+		t.Fatal("gitea has no deployments API")
+	}
+}
@@ -0,0 +1,43 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Gitea talks to a Gitea or Forgejo host.
+type Gitea struct {
+	cfg Config
+}
+
+func (g *Gitea) Name() string { return ProviderGitea }
+
+func (g *Gitea) apiBase(repo Repo) string {
+	if g.cfg.BaseURL != "" {
+		return strings.TrimRight(g.cfg.BaseURL, "/")
+	}
+	return repo.Scheme + "://" + repo.Host + "/api/v1"
+}
+
+func (g *Gitea) authorization() string {
+	if g.cfg.Token == "" {
+		return ""
+	}
+	return "token " + g.cfg.Token
+}
+
+func (g *Gitea) SetStatus(ctx context.Context, repo Repo, sha string, status Status) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/statuses/%s", g.apiBase(repo), repo.Owner, repo.Name, sha)
+	return postJSON(ctx, g.cfg.HTTPClient, g.authorization(), url, map[string]string{
+		"state":       string(status.State),
+		"context":     status.Context,
+		"description": truncate(status.Description, 255),
+		"target_url":  status.TargetURL,
+	}, nil)
+}
+
+func (g *Gitea) Comment(ctx context.Context, repo Repo, number int, body string) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/issues/%d/comments", g.apiBase(repo), repo.Owner, repo.Name, number)
+	return postJSON(ctx, g.cfg.HTTPClient, g.authorization(), url, map[string]string{"body": body}, nil)
+}
@@ -0,0 +1,81 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// GitHub talks to github.com or a GitHub Enterprise host.
+type GitHub struct {
+	cfg Config
+}
+
+func (g *GitHub) Name() string { return ProviderGitHub }
+
+func (g *GitHub) apiBase(repo Repo) string {
+	if g.cfg.BaseURL != "" {
+		return strings.TrimRight(g.cfg.BaseURL, "/")
+	}
+	if repo.Host == "github.com" {
+		return "https://api.github.com"
+	}
+	return repo.Scheme + "://" + repo.Host + "/api/v3"
+}
+
+func (g *GitHub) authorization() string {
+	if g.cfg.Token == "" {
+		return ""
+	}
+	return "Bearer " + g.cfg.Token
+}
+
+func (g *GitHub) SetStatus(ctx context.Context, repo Repo, sha string, status Status) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/statuses/%s", g.apiBase(repo), repo.Owner, repo.Name, sha)
+	return postJSON(ctx, g.cfg.HTTPClient, g.authorization(), url, map[string]string{
+		"state":       string(status.State),
+		"context":     status.Context,
+		"description": truncate(status.Description, 140),
+		"target_url":  status.TargetURL,
+	}, nil)
+}
+
+func (g *GitHub) Comment(ctx context.Context, repo Repo, number int, body string) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/issues/%d/comments", g.apiBase(repo), repo.Owner, repo.Name, number)
+	return postJSON(ctx, g.cfg.HTTPClient, g.authorization(), url, map[string]string{"body": body}, nil)
+}
+
+func (g *GitHub) CreateDeployment(ctx context.Context, repo Repo, d Deployment) (int64, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/deployments", g.apiBase(repo), repo.Owner, repo.Name)
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	// required_contexts is empty so Norn's own pending statuses don't block
+	// the deployment it is reporting.
+	err := postJSON(ctx, g.cfg.HTTPClient, g.authorization(), url, map[string]interface{}{
+		"ref":                    d.Ref,
+		"environment":            d.Environment,
+		"description":            truncate(d.Description, 140),
+		"auto_merge":             false,
+		"required_contexts":      []string{},
+		"production_environment": d.Production,
+	}, &created)
+	if err != nil {
+		return 0, err
+	}
+	if created.ID == 0 {
+		return 0, fmt.Errorf("POST %s: response has no deployment id", url)
+	}
+	return created.ID, nil
+}
+
+func (g *GitHub) SetDeploymentStatus(ctx context.Context, repo Repo, id int64, status DeploymentStatus) error {
+	url := fmt.Sprintf("%s/repos/%s/%s/deployments/%d/statuses", g.apiBase(repo), repo.Owner, repo.Name, id)
+	return postJSON(ctx, g.cfg.HTTPClient, g.authorization(), url, map[string]interface{}{
+		"state":           string(status.State),
+		"description":     truncate(status.Description, 140),
+		"log_url":         status.LogURL,
+		"environment_url": status.EnvironmentURL,
+		"auto_inactive":   true,
+	}, nil)
+}
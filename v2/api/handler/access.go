@@ -2,6 +2,7 @@ package handler
 
 import (
 	"context"
+	"log"
 	"net"
 	"net/http"
 	"sort"
@@ -79,7 +80,7 @@ func (l *AccessLog) Recent(limit int) []AccessEvent {
 
 func (h *Handler) AccessMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/ws" || r.URL.Path == "/metrics" || r.URL.Path == "/api/metrics" || strings.HasSuffix(r.URL.Path, "/exec") {
+		if r.URL.Path == "/api/ws" || r.URL.Path == "/metrics" || r.URL.Path == "/api/metrics" || strings.HasSuffix(r.URL.Path, "/exec") {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -95,7 +96,7 @@ func (h *Handler) AccessMiddleware(next http.Handler) http.Handler {
 			Path:       r.URL.Path,
 			Status:     rw.status,
 			DurationMs: time.Since(start).Milliseconds(),
-			ClientIP:   clientIP(r),
+			ClientIP:   h.clientIP(r),
 			Forwarded:  firstForwardedFor(r.Header.Get("X-Forwarded-For")),
 			CFIP:       strings.TrimSpace(r.Header.Get("CF-Connecting-IP")),
 			CFEmail:    strings.TrimSpace(r.Header.Get("Cf-Access-Authenticated-User-Email")),
@@ -129,13 +130,40 @@ func (r *statusRecorder) WriteHeader(code int) {
 	r.ResponseWriter.WriteHeader(code)
 }
 
-func clientIP(r *http.Request) string {
+// Unwrap lets http.ResponseController reach the connection, so proxied
+// WebSocket upgrades and streamed responses work through the recorder.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// clientIP is the address of the caller. Forwarding headers are only
+// believed when the connection comes from a trusted proxy; anyone else could
+// set them to pose as another address, including 127.0.0.1.
+func (h *Handler) clientIP(r *http.Request) string {
+	peer := remoteIP(r)
+	if !h.trustedProxy(peer) {
+		return peer
+	}
 	if cfIP := strings.TrimSpace(r.Header.Get("CF-Connecting-IP")); cfIP != "" {
 		return cfIP
 	}
-	if forwarded := firstForwardedFor(r.Header.Get("X-Forwarded-For")); forwarded != "" {
-		return forwarded
+	// Proxies append the address they saw, so walk back from the right past
+	// our own proxies. Entries further left are whatever the client sent.
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if i == 0 || !h.trustedProxy(hop) {
+			return hop
+		}
 	}
+	return peer
+}
+
+// remoteIP is the address of the connection's peer.
+func remoteIP(r *http.Request) string {
 	host, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
 		return r.RemoteAddr
@@ -143,6 +171,49 @@ func clientIP(r *http.Request) string {
 	return host
 }
 
+func isLoopback(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.IsLoopback()
+}
+
+// trustedProxy reports whether ip is loopback, where cloudflared connects
+// from, or one of NORN_TRUSTED_PROXIES.
+func (h *Handler) trustedProxy(ip string) bool {
+	if isLoopback(ip) {
+		return true
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range h.proxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTrustedProxies(values []string) []*net.IPNet {
+	var out []*net.IPNet
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			log.Printf("ignoring trusted proxy %q: %v", v, err)
+			continue
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
 func (h *Handler) HasActiveGrant(ip string) bool {
 	if h.db == nil {
 		return false
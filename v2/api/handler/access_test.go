@@ -13,7 +13,7 @@ func TestAccessMiddlewareRecordsProxySafeMetadata(t *testing.T) {
 		w.WriteHeader(http.StatusAccepted)
 	})
 	req := httptest.NewRequest(http.MethodGet, "/api/health?secret=hidden", nil)
-	req.RemoteAddr = "10.0.0.2:12345"
+	req.RemoteAddr = "127.0.0.1:12345"
 	req.Header.Set("CF-Connecting-IP", "203.0.113.10")
 	req.Header.Set("Cf-Access-Authenticated-User-Email", "operator@example.test")
 	req.Header.Set("Authorization", "Bearer should-not-appear")
@@ -3,12 +3,14 @@ package handler
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	nomadapi "github.com/hashicorp/nomad/api"
 
 	"norn/v2/api/model"
 	"norn/v2/api/nomad"
+	"norn/v2/api/saga"
 )
 
 func enrichAllocations(allocs []*nomadapi.AllocationListStub, n *nomad.Client) []model.Allocation {
@@ -232,5 +234,39 @@ func (h *Handler) ScaleApp(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if h.sagaStore != nil {
+		sg := saga.New(h.sagaStore, id, "api", "scale")
+		sg.Log(r.Context(), "scale.manual", fmt.Sprintf("%s/%s scaled to %d", id, req.Group, req.Count), map[string]string{
+			"jobId": id,
+			"group": req.Group,
+			"to":    strconv.Itoa(req.Count),
+		})
+	}
 	writeJSON(w, map[string]string{"status": "scaled"})
 }
+
+// ScaleHistory lists an app's recent scale events, newest first: manual
+// scales, autoscaler decisions, and idle reaper sleeps.
+func (h *Handler) ScaleHistory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	events := []saga.Event{}
+	if h.sagaStore != nil {
+		recent, err := h.sagaStore.ListByApp(r.Context(), id, 500)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, evt := range recent {
+			if evt.Category == "scale" && len(events) < limit {
+				events = append(events, evt)
+			}
+		}
+	}
+	writeJSON(w, events)
+}
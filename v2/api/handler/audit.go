@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"norn/v2/api/auth"
+	"norn/v2/api/store"
+)
+
+// maxAuditDigestBody caps how much of an unread request body the audit
+// middleware drains into the digest.
+const maxAuditDigestBody = 1 << 20
+
+// AuditMiddleware appends every mutating /api call to the hash-chained
+// audit_log. Only a digest of the request body is kept, never the body. It
+// runs ahead of Authenticate so that calls rejected for a bad token are
+// recorded too; Authenticate reports the caller it resolves back to it.
+// Calls whose handler panics are recorded as 500s.
+func (h *Handler) AuditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auditable(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), auditCallerKey{}, &auditCaller{}))
+		serveAudited(next, w, r, h.clientIP(r), func(entry *store.AuditEntry) {
+			if h.db == nil {
+				return
+			}
+			if err := h.db.AppendAudit(context.Background(), entry); err != nil {
+				log.Printf("audit: %s %s: %v", entry.Method, entry.Path, err)
+			}
+		})
+	})
+}
+
+type auditCallerKey struct{}
+
+// auditCaller carries the identity Authenticate resolves back out to the
+// audit middleware, which only sees the request as it was before.
+type auditCaller struct {
+	id *auth.Identity
+}
+
+// noteAuditCaller records id as the caller of an audited request.
+func noteAuditCaller(ctx context.Context, id *auth.Identity) {
+	if c, ok := ctx.Value(auditCallerKey{}).(*auditCaller); ok {
+		c.id = id
+	}
+}
+
+// serveAudited runs next and passes record the call's audit entry, draining
+// whatever body the handler left unread into the digest. A handler that
+// panics is recorded with status 500, the response Recoverer further out
+// gives it, and the panic is passed on.
+func serveAudited(next http.Handler, w http.ResponseWriter, r *http.Request, sourceIP string, record func(*store.AuditEntry)) {
+	start := time.Now()
+	body := &digestReader{ReadCloser: r.Body, sum: sha256.New()}
+	r.Body = body
+	rw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	defer func() {
+		if rec := recover(); rec != nil {
+			record(auditEntryFor(r, sourceIP, http.StatusInternalServerError, body.digest(), time.Since(start)))
+			panic(rec)
+		}
+	}()
+	next.ServeHTTP(rw, r)
+	_, _ = io.Copy(io.Discard, io.LimitReader(body, maxAuditDigestBody))
+	record(auditEntryFor(r, sourceIP, rw.status, body.digest(), time.Since(start)))
+}
+
+// auditable reports whether a request mutates state. Proxied app traffic
+// through the wake gateway is not a Norn API call and is left out.
+func auditable(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		return false
+	}
+	return !strings.HasPrefix(r.URL.Path, "/api/a/") && !strings.HasPrefix(r.URL.Path, "/api/wake-gateway/")
+}
+
+func auditEntryFor(r *http.Request, sourceIP string, status int, digest string, elapsed time.Duration) *store.AuditEntry {
+	entry := &store.AuditEntry{
+		Timestamp:     time.Now(),
+		Actor:         "unauthenticated",
+		SourceIP:      sourceIP,
+		Method:        r.Method,
+		Path:          r.URL.Path,
+		RequestDigest: digest,
+		Status:        status,
+		Result:        auditResult(status),
+		DurationMs:    elapsed.Milliseconds(),
+	}
+	id := auth.FromContext(r.Context())
+	if c, ok := r.Context().Value(auditCallerKey{}).(*auditCaller); ok && c.id != nil {
+		id = c.id
+	}
+	if id != nil {
+		entry.Actor = id.User
+		entry.Role = string(id.Role)
+		entry.AuthMethod = id.Method
+	}
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		entry.Route = rctx.RoutePattern()
+		if strings.HasPrefix(entry.Route, "/api/apps/{id}") {
+			entry.App = rctx.URLParam("id")
+		}
+	}
+	return entry
+}
+
+func auditResult(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return "denied"
+	case status >= 400:
+		return "error"
+	default:
+		return "ok"
+	}
+}
+
+type digestReader struct {
+	io.ReadCloser
+	sum hash.Hash
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.ReadCloser.Read(p)
+	d.sum.Write(p[:n])
+	return n, err
+}
+
+func (d *digestReader) digest() string {
+	return "sha256:" + hex.EncodeToString(d.sum.Sum(nil))
+}
+
+func (h *Handler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := store.AuditFilter{
+		Actor:  q.Get("actor"),
+		App:    q.Get("app"),
+		Route:  q.Get("route"),
+		Method: q.Get("method"),
+		Result: q.Get("result"),
+	}
+	if raw := q.Get("since"); raw != "" {
+		since, err := auditTime(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "since must be RFC3339 or a duration like 24h or 7d")
+			return
+		}
+		filter.Since = since
+	}
+	if raw := q.Get("until"); raw != "" {
+		until, err := auditTime(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "until must be RFC3339 or a duration like 24h or 7d")
+			return
+		}
+		filter.Until = until
+	}
+	if raw := q.Get("before"); raw != "" {
+		before, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "before must be an entry id")
+			return
+		}
+		filter.BeforeID = before
+	}
+	if raw := q.Get("limit"); raw != "" {
+		if limit, err := strconv.Atoi(raw); err == nil {
+			filter.Limit = limit
+		}
+	}
+	entries, err := h.db.ListAudit(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if entries == nil {
+		entries = []store.AuditEntry{}
+	}
+	writeJSON(w, entries)
+}
+
+func (h *Handler) VerifyAudit(w http.ResponseWriter, r *http.Request) {
+	result, err := h.db.VerifyAudit(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, result)
+}
+
+// auditTime accepts an RFC3339 timestamp or a lookback such as 24h or 7d.
+func auditTime(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	d, err := parseDayDuration(raw)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(-d), nil
+}
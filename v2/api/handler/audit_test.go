@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"norn/v2/api/auth"
+	"norn/v2/api/config"
+	"norn/v2/api/store"
+)
+
+func TestAuditEntryCapturesRouteActorAndDigest(t *testing.T) {
+	body := `{"count":3}`
+	var entry *store.AuditEntry
+
+	router := chi.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serveAudited(next, w, r, (&Handler{}).clientIP(r), func(e *store.AuditEntry) { entry = e })
+		})
+	})
+	// The handler never reads the body; the digest still covers it.
+	router.Post("/api/apps/{id}/scale", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/apps/web/scale", strings.NewReader(body))
+	req.RemoteAddr = "127.0.0.1:40000" // through the tunnel
+	req.Header.Set("CF-Connecting-IP", "203.0.113.7")
+	req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{User: "bob", Role: auth.RoleDeployer, Method: "token"}))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	sum := sha256.Sum256([]byte(body))
+	if entry.RequestDigest != "sha256:"+hex.EncodeToString(sum[:]) {
+		t.Fatalf("digest = %s", entry.RequestDigest)
+	}
+	if entry.Route != "/api/apps/{id}/scale" || entry.App != "web" {
+		t.Fatalf("route = %q app = %q", entry.Route, entry.App)
+	}
+	if entry.Actor != "bob" || entry.Role != "deployer" || entry.AuthMethod != "token" {
+		t.Fatalf("actor = %q role = %q method = %q", entry.Actor, entry.Role, entry.AuthMethod)
+	}
+	if entry.SourceIP != "203.0.113.7" {
+		t.Fatalf("source ip = %q", entry.SourceIP)
+	}
+	if entry.Status != http.StatusForbidden || entry.Result != "denied" {
+		t.Fatalf("status = %d result = %q", entry.Status, entry.Result)
+	}
+}
+
+func TestAuditEntryRecordsRejectedAndAuthenticatedCallers(t *testing.T) {
+	h := &Handler{cfg: &config.Config{APIToken: "root-secret"}}
+	var entry *store.AuditEntry
+	router := chi.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(context.WithValue(r.Context(), auditCallerKey{}, &auditCaller{}))
+			serveAudited(next, w, r, h.clientIP(r), func(e *store.AuditEntry) { entry = e })
+		})
+	})
+	router.Use(h.Authenticate)
+	router.Post("/api/apps/{id}/deploy", func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/apps/web/deploy", nil)
+	req.RemoteAddr = "198.51.100.4:40000"
+	req.Header.Set("Authorization", "Bearer norn_pat_revoked")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if entry == nil || entry.Actor != "unauthenticated" || entry.Status != http.StatusUnauthorized || entry.Result != "denied" {
+		t.Fatalf("entry = %+v, want a denied call by an unauthenticated caller", entry)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/apps/web/deploy", nil)
+	req.RemoteAddr = "198.51.100.4:40000"
+	req.Header.Set("Authorization", "Bearer root-secret")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if entry.Actor != "root" || entry.AuthMethod != "api-token" || entry.Result != "ok" {
+		t.Fatalf("entry = %+v, want root through the api token", entry)
+	}
+}
+
+func TestAuditEntryRecordsPanickingHandler(t *testing.T) {
+	var entry *store.AuditEntry
+	router := chi.NewRouter()
+	router.Use(middleware.Recoverer)
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serveAudited(next, w, r, (&Handler{}).clientIP(r), func(e *store.AuditEntry) { entry = e })
+		})
+	})
+	router.Post("/api/apps/{id}/restart", func(w http.ResponseWriter, r *http.Request) {
+		panic("nomad client is nil")
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/apps/web/restart", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("response = %d, want Recoverer's 500", rec.Code)
+	}
+	if entry == nil || entry.Status != http.StatusInternalServerError || entry.Result != "error" || entry.App != "web" {
+		t.Fatalf("entry = %+v, want the panicking call recorded as a 500", entry)
+	}
+}
+
+func TestAuditableSkipsReadsAndProxiedTraffic(t *testing.T) {
+	cases := map[string]bool{
+		"GET /api/apps":                   false,
+		"POST /api/apps/web/deploy":       true,
+		"DELETE /api/access/grants/ag_1":  true,
+		"POST /api/wake-gateway/x.test/":  false,
+		"POST /api/a/web/form":            false,
+		"POST /login":                     false,
+		"OPTIONS /api/apps/web/teardown":  false,
+		"PUT /api/apps/web/cron/schedule": true,
+	}
+	for line, want := range cases {
+		parts := strings.SplitN(line, " ", 2)
+		req := httptest.NewRequest(parts[0], parts[1], nil)
+		if got := auditable(req); got != want {
+			t.Fatalf("%s: auditable = %v, want %v", line, got, want)
+		}
+	}
+}
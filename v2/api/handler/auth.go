@@ -0,0 +1,450 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"norn/v2/api/auth"
+	"norn/v2/api/saga"
+	"norn/v2/api/store"
+)
+
+// errInvalidToken rejects a request whose token does not verify, rather than
+// letting it fall through to weaker ways of identifying the caller.
+var errInvalidToken = errors.New("invalid or expired token")
+
+// Authenticate resolves the caller of every /api request into an
+// auth.Identity on the request context. It only rejects requests presenting
+// a token that does not verify; routes declare the role they need with
+// auth.Require.
+func (h *Handler) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id, err := h.identify(r)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if id == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		noteAuditCaller(r.Context(), id)
+		ctx := auth.WithIdentity(r.Context(), id)
+		ctx = saga.WithActor(ctx, id.User)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (h *Handler) identify(r *http.Request) (*auth.Identity, error) {
+	token := ""
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimSpace(header[7:])
+	} else if q := r.URL.Query().Get("token"); q != "" {
+		token = q
+	}
+	if token != "" {
+		if id := h.identifyToken(r.Context(), token); id != nil {
+			return id, nil
+		}
+		return nil, errInvalidToken
+	}
+
+	if email := auth.AccessEmail(r.Context()); email != "" {
+		if id := h.identifyAccessEmail(r.Context(), email); id != nil {
+			return id, nil
+		}
+	}
+
+	// Tunnelled requests also come from loopback, but carry the visitor's
+	// address; only a caller that is itself local is admin.
+	ip := h.clientIP(r)
+	if isLoopback(remoteIP(r)) && isLoopback(ip) {
+		return &auth.Identity{User: "local", Role: auth.RoleAdmin, Method: "loopback"}, nil
+	}
+	if h.HasActiveGrant(ip) {
+		return &auth.Identity{User: "grant:" + ip, Role: auth.RoleOperator, Method: "grant"}, nil
+	}
+	if h.cfg.APIToken == "" && h.openMode(r.Context()) {
+		// Nothing to authenticate against yet: the API is open, as before RBAC.
+		return &auth.Identity{User: "anonymous", Role: auth.RoleAdmin, Method: "open"}, nil
+	}
+	return nil, nil
+}
+
+// openMode reports whether no user or API token has been created yet. Once
+// one has, open mode is over for the life of the process.
+func (h *Handler) openMode(ctx context.Context) bool {
+	if h.closed.Load() {
+		return false
+	}
+	if h.db == nil {
+		return true
+	}
+	exists, err := h.db.HasPrincipals(ctx)
+	if err != nil {
+		log.Printf("auth: principal lookup: %v", err)
+		return false
+	}
+	if exists {
+		h.closed.Store(true)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) identifyToken(ctx context.Context, token string) *auth.Identity {
+	if h.cfg.APIToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.cfg.APIToken)) == 1 {
+		return &auth.Identity{User: "root", Role: auth.RoleAdmin, Method: "api-token"}
+	}
+	if strings.HasPrefix(token, auth.TokenPrefix) {
+		if h.db == nil {
+			return nil
+		}
+		lookup, err := h.db.LookupAPIToken(ctx, auth.HashToken(token))
+		if err != nil {
+			log.Printf("auth: token lookup: %v", err)
+			return nil
+		}
+		if lookup == nil {
+			return nil
+		}
+		tokenRole, err1 := auth.ParseRole(lookup.Token.Role)
+		userRole, err2 := auth.ParseRole(lookup.UserRole)
+		if err1 != nil || err2 != nil {
+			return nil
+		}
+		return &auth.Identity{
+			User:    lookup.Token.User,
+			Role:    auth.MinRole(tokenRole, userRole),
+			Method:  "token",
+			TokenID: lookup.Token.ID,
+			Apps:    lookup.Token.Apps,
+		}
+	}
+	if h.cfg.APIToken != "" {
+		if claims, err := verifyToken(h.cfg.APIToken, token); err == nil {
+			// Tokens minted before roles existed carry none; cap them at operator.
+			role, err := auth.ParseRole(claims.Role)
+			if err != nil {
+				role = auth.RoleOperator
+			}
+			user := claims.Usr
+			if user == "" {
+				user = "signed-token"
+			}
+			role, ok := h.signedTokenRole(ctx, claims, role)
+			if !ok {
+				return nil
+			}
+			return &auth.Identity{User: user, Role: role, Method: "signed-token", TokenID: claims.Jti}
+		}
+	}
+	return nil
+}
+
+// signedTokenRole re-checks a verified signed token against the database:
+// it must not be revoked, and a registered minting user must still be
+// enabled. The role is capped at that user's current role.
+func (h *Handler) signedTokenRole(ctx context.Context, claims *tokenClaims, role auth.Role) (auth.Role, bool) {
+	if h.db == nil {
+		return role, true
+	}
+	if claims.Jti != "" {
+		revoked, err := h.db.SignedTokenRevoked(ctx, claims.Jti)
+		if err != nil {
+			log.Printf("auth: signed token lookup: %v", err)
+			return "", false
+		}
+		if revoked {
+			return "", false
+		}
+	}
+	if claims.Usr == "" {
+		return role, true
+	}
+	u, err := h.db.GetUser(ctx, claims.Usr)
+	if err != nil {
+		log.Printf("auth: user lookup for %s: %v", claims.Usr, err)
+		return "", false
+	}
+	if u == nil {
+		return role, true
+	}
+	if u.Disabled {
+		return "", false
+	}
+	userRole, err := auth.ParseRole(u.Role)
+	if err != nil {
+		return "", false
+	}
+	return auth.MinRole(role, userRole), true
+}
+
+// identifyAccessEmail maps a Cloudflare Access email to its user, or to the
+// configured default role when the email is not registered.
+func (h *Handler) identifyAccessEmail(ctx context.Context, email string) *auth.Identity {
+	if h.db != nil {
+		u, err := h.db.UserByEmail(ctx, email)
+		if err != nil {
+			log.Printf("auth: user lookup for %s: %v", email, err)
+		}
+		if u != nil && u.Disabled {
+			return nil
+		}
+		if u != nil {
+			if role, err := auth.ParseRole(u.Role); err == nil {
+				return &auth.Identity{User: u.Name, Role: role, Method: "cf-access"}
+			}
+		}
+	}
+	role, err := auth.ParseRole(h.cfg.CFAccessDefaultRole)
+	if err != nil {
+		return nil
+	}
+	return &auth.Identity{User: email, Role: role, Method: "cf-access"}
+}
+
+func (h *Handler) WhoAmI(w http.ResponseWriter, r *http.Request) {
+	id := auth.FromContext(r.Context())
+	if id == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	writeJSON(w, id)
+}
+
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := h.db.ListUsers(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if users == nil {
+		users = []store.User{}
+	}
+	writeJSON(w, users)
+}
+
+func (h *Handler) UpsertUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Role     string `json:"role"`
+		Disabled bool   `json:"disabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	role, err := auth.ParseRole(req.Role)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	user := &store.User{
+		Name:      req.Name,
+		Email:     strings.TrimSpace(req.Email),
+		Role:      string(role),
+		Disabled:  req.Disabled,
+		CreatedBy: auth.Actor(r.Context(), ""),
+	}
+	if err := h.db.UpsertUser(r.Context(), user); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, user)
+}
+
+func (h *Handler) ListAPITokens(w http.ResponseWriter, r *http.Request) {
+	id := auth.FromContext(r.Context())
+	user := r.URL.Query().Get("user")
+	if !id.Role.Allows(auth.RoleAdmin) {
+		user = id.User
+	}
+	tokens, err := h.db.ListAPITokens(r.Context(), user, r.URL.Query().Get("all") == "true")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if tokens == nil {
+		tokens = []store.APIToken{}
+	}
+	writeJSON(w, tokens)
+}
+
+// CreateAPIToken issues a personal token. Callers mint tokens for themselves
+// at or below their own role; admins may mint for any user, creating the
+// user with the token's role if it does not exist yet.
+func (h *Handler) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		User      string   `json:"user"`
+		Name      string   `json:"name"`
+		Role      string   `json:"role"`
+		Apps      []string `json:"apps"`
+		ExpiresIn string   `json:"expiresIn"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	caller := auth.FromContext(r.Context())
+	isAdmin := caller.Role.Allows(auth.RoleAdmin)
+	if req.User == "" {
+		req.User = caller.User
+	}
+	if req.User != caller.User && !isAdmin {
+		writeError(w, http.StatusForbidden, "only admins can create tokens for other users")
+		return
+	}
+
+	role := caller.Role
+	if req.Role != "" {
+		parsed, err := auth.ParseRole(req.Role)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		role = parsed
+	}
+	if !caller.Role.Allows(role) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("cannot create a %s token with a %s role", role, caller.Role))
+		return
+	}
+
+	if len(caller.Apps) > 0 {
+		// A scoped token can only mint tokens within its own scope.
+		if len(req.Apps) == 0 {
+			req.Apps = caller.Apps
+		}
+		for _, app := range req.Apps {
+			if !caller.CanAccessApp(app) {
+				writeError(w, http.StatusForbidden, "token is not scoped to "+app)
+				return
+			}
+		}
+	}
+
+	user, err := h.db.GetUser(r.Context(), req.User)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if user == nil {
+		if !isAdmin {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("user %s does not exist; ask an admin to create it", req.User))
+			return
+		}
+		user = &store.User{Name: req.User, Role: string(role), CreatedBy: caller.User}
+		if err := h.db.UpsertUser(r.Context(), user); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresIn != "" {
+		d, err := parseDayDuration(req.ExpiresIn)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid expiresIn duration")
+			return
+		}
+		t := time.Now().Add(d)
+		expiresAt = &t
+	}
+
+	secret, hash, err := auth.NewToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	token := &store.APIToken{
+		User:      user.Name,
+		Name:      req.Name,
+		Role:      string(role),
+		Apps:      req.Apps,
+		TokenHash: hash,
+		CreatedBy: caller.User,
+		ExpiresAt: expiresAt,
+	}
+	if err := h.db.InsertAPIToken(r.Context(), token); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	writeJSON(w, map[string]interface{}{
+		"token":    secret,
+		"apiToken": token,
+	})
+}
+
+func (h *Handler) RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	token, err := h.db.GetAPIToken(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	caller := auth.FromContext(r.Context())
+	if token == nil && strings.HasPrefix(id, signedTokenPrefix) {
+		// Signed access tokens are not stored; revoking one records its jti.
+		if caller.TokenID != id && !caller.Role.Allows(auth.RoleAdmin) {
+			writeError(w, http.StatusForbidden, "only admins can revoke other signed tokens")
+			return
+		}
+		if err := h.db.RevokeSignedToken(r.Context(), id, caller.User); err != nil {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeJSON(w, map[string]string{"status": "revoked", "id": id})
+		return
+	}
+	if token == nil {
+		writeError(w, http.StatusNotFound, "token not found")
+		return
+	}
+	if token.User != caller.User && !caller.Role.Allows(auth.RoleAdmin) {
+		writeError(w, http.StatusForbidden, "only admins can revoke other users' tokens")
+		return
+	}
+	if err := h.db.RevokeAPIToken(r.Context(), id); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, map[string]string{"status": "revoked", "id": id})
+}
+
+// parseDayDuration accepts Go durations plus a day suffix ("90d").
+func parseDayDuration(raw string) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasSuffix(raw, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(raw, "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", raw)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", raw)
+	}
+	return d, nil
+}
@@ -0,0 +1,271 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"norn/v2/api/auth"
+	"norn/v2/api/config"
+	"norn/v2/api/saga"
+)
+
+func TestAuthenticateResolvesIdentities(t *testing.T) {
+	h := &Handler{cfg: &config.Config{APIToken: "root-secret", CFAccessDefaultRole: "viewer"}}
+	signed, err := signToken("root-secret", tokenClaims{Usr: "alice", Role: "deployer", Exp: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := signToken("root-secret", tokenClaims{Sub: "ci", Exp: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name       string
+		header     string
+		query      string
+		remoteAddr string
+		wantUser   string
+		wantRole   auth.Role
+	}{
+		{name: "static token", header: "Bearer root-secret", remoteAddr: "10.0.0.2:1", wantUser: "root", wantRole: auth.RoleAdmin},
+		{name: "signed token", header: "Bearer " + signed, remoteAddr: "10.0.0.2:1", wantUser: "alice", wantRole: auth.RoleDeployer},
+		{name: "legacy signed token", query: legacy, remoteAddr: "10.0.0.2:1", wantUser: "signed-token", wantRole: auth.RoleOperator},
+		{name: "loopback", remoteAddr: "127.0.0.1:1", wantUser: "local", wantRole: auth.RoleAdmin},
+		{name: "unknown", header: "Bearer nope", remoteAddr: "10.0.0.2:1"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got *auth.Identity
+			var actor string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = auth.FromContext(r.Context())
+				actor = saga.ActorFrom(r.Context())
+			})
+			target := "/api/apps"
+			if tc.query != "" {
+				target += "?token=" + tc.query
+			}
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			h.Authenticate(next).ServeHTTP(httptest.NewRecorder(), req)
+
+			if tc.wantUser == "" {
+				if got != nil {
+					t.Fatalf("identity = %+v, want none", got)
+				}
+				return
+			}
+			if got == nil || got.User != tc.wantUser || got.Role != tc.wantRole {
+				t.Fatalf("identity = %+v, want %s/%s", got, tc.wantUser, tc.wantRole)
+			}
+			if actor != tc.wantUser {
+				t.Fatalf("saga actor = %q, want %q", actor, tc.wantUser)
+			}
+		})
+	}
+}
+
+func TestAuthenticateIgnoresSpoofedForwardingHeaders(t *testing.T) {
+	h := &Handler{
+		cfg:     &config.Config{APIToken: "root-secret"},
+		proxies: parseTrustedProxies([]string{"10.0.0.9"}),
+	}
+	cases := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		wantIP     string
+		wantAdmin  bool
+	}{
+		{name: "spoofed forwarded-for", remoteAddr: "10.0.0.2:1", headers: map[string]string{"X-Forwarded-For": "127.0.0.1"}, wantIP: "10.0.0.2"},
+		{name: "spoofed cf-connecting-ip", remoteAddr: "10.0.0.2:1", headers: map[string]string{"CF-Connecting-IP": "::1"}, wantIP: "10.0.0.2"},
+		{name: "tunnelled visitor", remoteAddr: "127.0.0.1:1", headers: map[string]string{"CF-Connecting-IP": "203.0.113.5", "X-Forwarded-For": "127.0.0.1"}, wantIP: "203.0.113.5"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.9:1", headers: map[string]string{"X-Forwarded-For": "127.0.0.1, 203.0.113.5"}, wantIP: "203.0.113.5"},
+		{name: "local caller", remoteAddr: "127.0.0.1:1", wantIP: "127.0.0.1", wantAdmin: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got *auth.Identity
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = auth.FromContext(r.Context())
+			})
+			req := httptest.NewRequest(http.MethodPost, "/api/apps/web/teardown", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			if ip := h.clientIP(req); ip != tc.wantIP {
+				t.Fatalf("client ip = %q, want %q", ip, tc.wantIP)
+			}
+			h.Authenticate(next).ServeHTTP(httptest.NewRecorder(), req)
+			if tc.wantAdmin {
+				if got == nil || got.Method != "loopback" || got.Role != auth.RoleAdmin {
+					t.Fatalf("identity = %+v, want loopback admin", got)
+				}
+				return
+			}
+			if got != nil {
+				t.Fatalf("identity = %+v, want none", got)
+			}
+		})
+	}
+}
+
+func TestAuthenticateIsOpenWithoutAPIToken(t *testing.T) {
+	h := &Handler{cfg: &config.Config{}}
+	var got *auth.Identity
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = auth.FromContext(r.Context())
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/apps/web/teardown", nil)
+	req.RemoteAddr = "10.0.0.2:1"
+	h.Authenticate(next).ServeHTTP(httptest.NewRecorder(), req)
+	if got == nil || got.Method != "open" || got.Role != auth.RoleAdmin {
+		t.Fatalf("identity = %+v, want open admin", got)
+	}
+}
+
+func TestAuthenticateRejectsInvalidTokensInsteadOfFallingBack(t *testing.T) {
+	h := &Handler{cfg: &config.Config{}}
+	expired, err := signToken("", tokenClaims{Usr: "alice", Role: "viewer", Exp: time.Now().Add(-time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{"/api/apps?token=" + expired, "/api/apps"} {
+		called := false
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.RemoteAddr = "127.0.0.1:1"
+		if target == "/api/apps" {
+			req.Header.Set("Authorization", "Bearer norn_pat_mistyped")
+		}
+		rec := httptest.NewRecorder()
+		h.Authenticate(next).ServeHTTP(rec, req)
+		if called || rec.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: status = %d, called = %v; want 401 before loopback or open admin", target, rec.Code, called)
+		}
+	}
+}
+
+func TestAuthenticateOpenModeEndsOnceClosed(t *testing.T) {
+	h := &Handler{cfg: &config.Config{}}
+	h.closed.Store(true)
+	var got *auth.Identity
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = auth.FromContext(r.Context())
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/apps/web/teardown", nil)
+	req.RemoteAddr = "10.0.0.2:1"
+	h.Authenticate(next).ServeHTTP(httptest.NewRecorder(), req)
+	if got != nil {
+		t.Fatalf("identity = %+v, want none once users or tokens exist", got)
+	}
+}
+
+func TestRequireEnforcesRoleHierarchy(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	cases := []struct {
+		id   *auth.Identity
+		need auth.Role
+		want int
+	}{
+		{id: nil, need: auth.RoleViewer, want: http.StatusUnauthorized},
+		{id: &auth.Identity{User: "v", Role: auth.RoleViewer}, need: auth.RoleDeployer, want: http.StatusForbidden},
+		{id: &auth.Identity{User: "d", Role: auth.RoleDeployer}, need: auth.RoleDeployer, want: http.StatusNoContent},
+		{id: &auth.Identity{User: "o", Role: auth.RoleOperator}, need: auth.RoleAdmin, want: http.StatusForbidden},
+		{id: &auth.Identity{User: "a", Role: auth.RoleAdmin}, need: auth.RoleOperator, want: http.StatusNoContent},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/api/apps/web/teardown", nil)
+		if tc.id != nil {
+			req = req.WithContext(auth.WithIdentity(req.Context(), tc.id))
+		}
+		rec := httptest.NewRecorder()
+		auth.Require(tc.need)(ok).ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Fatalf("%+v needing %s: status = %d, want %d", tc.id, tc.need, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestScopedTokenCannotReachOtherApps(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	id := &auth.Identity{User: "ci", Role: auth.RoleDeployer, Apps: []string{"web"}}
+	for app, want := range map[string]int{"web": http.StatusNoContent, "api": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodPost, "/api/apps/"+app+"/deploy", nil)
+		req = req.WithContext(auth.WithIdentity(req.Context(), id))
+		rec := httptest.NewRecorder()
+		r := chi.NewRouter()
+		r.With(ValidateAppID).Post("/api/apps/{id}/deploy", ok)
+		r.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("%s: status = %d, want %d", app, rec.Code, want)
+		}
+	}
+}
+
+func TestScopedTokenCannotWriteOutsideItsApps(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	scoped := &auth.Identity{User: "ci", Role: auth.RoleOperator, Apps: []string{"web"}}
+	cases := []struct {
+		method string
+		path   string
+		id     *auth.Identity
+		want   int
+	}{
+		{method: http.MethodPost, path: "/api/events/reconcile", id: scoped, want: http.StatusForbidden},
+		{method: http.MethodDelete, path: "/api/notifications/channels/1", id: scoped, want: http.StatusForbidden},
+		{method: http.MethodGet, path: "/api/events", id: scoped, want: http.StatusNoContent},
+		{method: http.MethodPost, path: "/api/apps/web/deploy", id: scoped, want: http.StatusNoContent},
+		{method: http.MethodPost, path: "/api/deploy-groups/stack/deploy", id: scoped, want: http.StatusNoContent},
+		{method: http.MethodPost, path: "/api/events/reconcile", id: &auth.Identity{User: "ops", Role: auth.RoleOperator}, want: http.StatusNoContent},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req = req.WithContext(auth.WithIdentity(req.Context(), tc.id))
+		rec := httptest.NewRecorder()
+		ScopeWrites(ok).ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Fatalf("%s %s as %+v: status = %d, want %d", tc.method, tc.path, tc.id, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestDeployGroupChecksTokenScopeOfEveryMember(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "deploy-groups"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	group := "name: stack\napps:\n  - app: web\n  - app: api\n    dependsOn: [web]\n"
+	if err := os.WriteFile(filepath.Join(dir, "deploy-groups", "stack.yaml"), []byte(group), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{cfg: &config.Config{AppsDir: dir}}
+	r := chi.NewRouter()
+	r.Post("/api/deploy-groups/{name}/deploy", h.DeployGroup)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/deploy-groups/stack/deploy", strings.NewReader(`{}`))
+	req = req.WithContext(auth.WithIdentity(req.Context(), &auth.Identity{User: "ci", Role: auth.RoleDeployer, Apps: []string{"web"}}))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "api") {
+		t.Fatalf("status = %d body = %s, want 403 naming api", rec.Code, rec.Body.String())
+	}
+}
@@ -3,10 +3,14 @@ package handler
 import (
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 
 	"norn/v2/api/model"
+	"norn/v2/api/nomad"
+	"norn/v2/api/saga"
 )
 
 // CanaryStatus returns the latest Nomad deployment status for an app,
@@ -19,12 +23,63 @@ func (h *Handler) CanaryStatus(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, fmt.Sprintf("latest deployment: %v", err))
 		return
 	}
+	analysis := h.latestCanaryAnalysis(r, id)
 	if info == nil {
-		writeJSON(w, map[string]string{"status": "none"})
+		writeJSON(w, map[string]interface{}{"status": "none", "analysis": analysis})
 		return
 	}
 
-	writeJSON(w, info)
+	writeJSON(w, struct {
+		*nomad.DeploymentInfo
+		Analysis *canaryAnalysis `json:"analysis,omitempty"`
+	}{info, analysis})
+}
+
+// canaryAnalysis is the verdict trail the pipeline recorded for the most
+// recent canary rollout of an app.
+type canaryAnalysis struct {
+	SagaID  string       `json:"sagaId"`
+	Verdict string       `json:"verdict"`
+	Events  []saga.Event `json:"events"`
+}
+
+func (h *Handler) latestCanaryAnalysis(r *http.Request, app string) *canaryAnalysis {
+	if h.sagaStore == nil {
+		return nil
+	}
+	events, err := h.sagaStore.ListByApp(r.Context(), app, 500)
+	if err != nil {
+		return nil
+	}
+	// ListByApp returns newest first; the first canary event names the saga.
+	var analysis *canaryAnalysis
+	for _, evt := range events {
+		if !strings.HasPrefix(evt.Action, "canary.") {
+			continue
+		}
+		if analysis == nil {
+			analysis = &canaryAnalysis{SagaID: evt.SagaID, Verdict: "running"}
+		}
+		if evt.SagaID != analysis.SagaID {
+			continue
+		}
+		analysis.Events = append(analysis.Events, evt)
+	}
+	if analysis == nil {
+		return nil
+	}
+	sort.Slice(analysis.Events, func(i, j int) bool {
+		return analysis.Events[i].Timestamp.Before(analysis.Events[j].Timestamp)
+	})
+	for _, evt := range analysis.Events {
+		switch evt.Action {
+		case "canary.promoted":
+			analysis.Verdict = "promoted"
+		case "canary.failed":
+			analysis.Verdict = "failed"
+		}
+	}
+	return analysis
 }
 
 // PromoteCanary promotes all canary allocations in the latest deployment for an app.
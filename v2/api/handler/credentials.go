@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RotateCredentials queues a rotation of the app's provisioned Postgres,
+// Garage and Redpanda credentials (?env= selects the environment). The body
+// may list {"services": [...]} to rotate; a failed rotation is resumed
+// instead of starting a new one.
+func (h *Handler) RotateCredentials(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req struct {
+		Services []string `json:"services"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if h.db == nil || h.pipeline == nil {
+		writeError(w, http.StatusServiceUnavailable, "database not connected")
+		return
+	}
+	spec := h.appSpec(w, id, r.URL.Query().Get("env"))
+	if spec == nil {
+		return
+	}
+	op, resumed, err := h.pipeline.RotateCredentials(r.Context(), spec, req.Services, "api")
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"operationId": op.ID,
+		"sagaId":      op.SagaID,
+		"environment": spec.Environment,
+		"services":    op.Payload["services"],
+		"resumed":     resumed,
+	})
+}
+
+// ListCredentialRotations lists the app environment's rotations, newest
+// first (?env= selects the environment, ?limit= caps).
+func (h *Handler) ListCredentialRotations(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if h.db == nil || h.pipeline == nil {
+		writeError(w, http.StatusServiceUnavailable, "database not connected")
+		return
+	}
+	spec := h.appSpec(w, id, r.URL.Query().Get("env"))
+	if spec == nil {
+		return
+	}
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	ops, err := h.pipeline.ListRotations(r.Context(), spec, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, ops)
+}
@@ -3,7 +3,6 @@ package handler
 import (
 	"fmt"
 	"net/http"
-	"os"
 
 	"github.com/go-chi/chi/v5"
 
@@ -206,8 +205,8 @@ func (h *Handler) CronResume(w http.ResponseWriter, r *http.Request) {
 	// Resolve secrets
 	env := make(map[string]string)
 	if h.secrets != nil {
-		secretEnv, err := h.secrets.EnvMap(id)
-		if err != nil && !os.IsNotExist(err) {
+		secretEnv, err := h.secrets.For(spec).JobEnv(id)
+		if err != nil {
 			writeError(w, http.StatusInternalServerError, fmt.Sprintf("resolve secrets: %v", err))
 			return
 		}
@@ -286,8 +285,8 @@ func (h *Handler) CronUpdateSchedule(w http.ResponseWriter, r *http.Request) {
 	// Resolve secrets
 	env := make(map[string]string)
 	if h.secrets != nil {
-		secretEnv, err := h.secrets.EnvMap(id)
-		if err != nil && !os.IsNotExist(err) {
+		secretEnv, err := h.secrets.For(spec).JobEnv(id)
+		if err != nil {
 			writeError(w, http.StatusInternalServerError, fmt.Sprintf("resolve secrets: %v", err))
 			return
 		}
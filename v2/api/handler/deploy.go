@@ -2,7 +2,6 @@ package handler
 
 import (
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
 
@@ -16,6 +15,7 @@ func (h *Handler) Deploy(w http.ResponseWriter, r *http.Request) {
 
 	var req struct {
 		Ref string `json:"ref"`
+		Env string `json:"env"` // alias for ?env=
 	}
 	if err := decodeJSON(r, &req); err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
@@ -25,29 +25,17 @@ func (h *Handler) Deploy(w http.ResponseWriter, r *http.Request) {
 		req.Ref = "HEAD"
 	}
 
-	specs, err := model.DiscoverApps(h.cfg.AppsDir)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	var spec *model.InfraSpec
-	for _, s := range specs {
-		if s.App == id {
-			spec = s
-			break
-		}
-	}
+	spec := h.appSpec(w, id, requestEnv(r, req.Env))
 	if spec == nil {
-		writeError(w, http.StatusNotFound, fmt.Sprintf("app %s not found", id))
 		return
 	}
 
-	sagaID := h.pipeline.Run(spec, req.Ref)
+	sagaID := h.pipeline.Run(r.Context(), spec, req.Ref)
 
 	writeJSON(w, map[string]string{
-		"sagaId": sagaID,
-		"status": "queued",
+		"sagaId":      sagaID,
+		"status":      "queued",
+		"environment": spec.Environment,
 	})
 }
 
@@ -56,6 +44,7 @@ func (h *Handler) Preflight(w http.ResponseWriter, r *http.Request) {
 
 	var req struct {
 		Ref string `json:"ref"`
+		Env string `json:"env"` // alias for ?env=
 	}
 	if err := decodeJSON(r, &req); err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
@@ -65,25 +54,12 @@ func (h *Handler) Preflight(w http.ResponseWriter, r *http.Request) {
 		req.Ref = "HEAD"
 	}
 
-	specs, err := model.DiscoverApps(h.cfg.AppsDir)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	var spec *model.InfraSpec
-	for _, s := range specs {
-		if s.App == id {
-			spec = s
-			break
-		}
-	}
+	spec := h.appSpec(w, id, requestEnv(r, req.Env))
 	if spec == nil {
-		writeError(w, http.StatusNotFound, fmt.Sprintf("app %s not found", id))
 		return
 	}
 
-	sagaID := h.pipeline.Preflight(spec, req.Ref)
+	sagaID := h.pipeline.Preflight(r.Context(), spec, req.Ref)
 
 	writeJSON(w, map[string]string{
 		"sagaId": sagaID,
@@ -6,6 +6,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 
+	"norn/v2/api/auth"
 	"norn/v2/api/model"
 )
 
@@ -55,32 +56,26 @@ func (h *Handler) DeployGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	type deployResult struct {
-		App    string `json:"app"`
-		SagaID string `json:"sagaId,omitempty"`
-		Error  string `json:"error,omitempty"`
+	caller := auth.FromContext(r.Context())
+	for _, member := range group.Apps {
+		if !caller.CanAccessApp(member.App) {
+			writeError(w, http.StatusForbidden, "token is not scoped to "+member.App)
+			return
+		}
 	}
 
-	var deploys []deployResult
-	for _, app := range group.Apps {
-		spec := h.findSpec(app.App)
-		if spec == nil {
-			deploys = append(deploys, deployResult{
-				App:   app.App,
-				Error: fmt.Sprintf("app %s not found", app.App),
-			})
-			continue
-		}
-		sagaID := h.pipeline.Run(spec, req.Ref)
-		deploys = append(deploys, deployResult{
-			App:    app.App,
-			SagaID: sagaID,
-		})
+	run, err := h.pipeline.RunGroup(r.Context(), group, req.Ref)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	writeJSON(w, map[string]interface{}{
-		"group":   name,
-		"deploys": deploys,
-		"ref":     req.Ref,
+		"group":       name,
+		"ref":         req.Ref,
+		"operationId": run.OperationID,
+		"sagaId":      run.SagaID,
+		"waves":       run.Waves,
+		"status":      "queued",
 	})
 }
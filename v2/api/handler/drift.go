@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetDrift compares an app's infraspec with its running Nomad jobs. ?env=
+// selects an environment.
+func (h *Handler) GetDrift(w http.ResponseWriter, r *http.Request) {
+	spec := h.appSpec(w, chi.URLParam(r, "id"), r.URL.Query().Get("env"))
+	if spec == nil {
+		return
+	}
+	report, err := h.pipeline.Drift(r.Context(), spec)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, report)
+}
+
+// ApplyDrift resubmits an app's drifted jobs with their live image. ?env=
+// selects an environment. The report's skipped field says why nothing was
+// applied.
+func (h *Handler) ApplyDrift(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Env string `json:"env"` // alias for ?env=
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	spec := h.appSpec(w, chi.URLParam(r, "id"), requestEnv(r, req.Env))
+	if spec == nil {
+		return
+	}
+	report, err := h.pipeline.ApplyDrift(r.Context(), spec)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, report)
+}
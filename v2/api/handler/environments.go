@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+
+	"norn/v2/api/model"
+)
+
+type environmentStatus struct {
+	Name        string            `json:"name"`
+	Default     bool              `json:"default,omitempty"`
+	JobID       string            `json:"jobId"`
+	SecretsFile string            `json:"secretsFile"`
+	Current     *model.Deployment `json:"current,omitempty"`
+}
+
+// requestEnv returns the environment a request names. Every env-aware
+// endpoint takes it as ?env=; the env field of a JSON body is accepted as
+// an alias when the query leaves it out.
+func requestEnv(r *http.Request, bodyEnv string) string {
+	if env := r.URL.Query().Get("env"); env != "" {
+		return env
+	}
+	return bodyEnv
+}
+
+// appSpec finds a deployable app and applies env's overrides, writing the
+// error response itself when either lookup fails.
+func (h *Handler) appSpec(w http.ResponseWriter, id, env string) *model.InfraSpec {
+	specs, err := model.DiscoverApps(h.cfg.AppsDir)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil
+	}
+	for _, s := range specs {
+		if s.App != id {
+			continue
+		}
+		spec, err := s.ForEnvironment(env)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return nil
+		}
+		return spec
+	}
+	writeError(w, http.StatusNotFound, fmt.Sprintf("app %s not found", id))
+	return nil
+}
+
+// ListEnvironments reports each declared environment with its most recent
+// successful deployment.
+func (h *Handler) ListEnvironments(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	base := h.appSpec(w, id, "")
+	if base == nil {
+		return
+	}
+	out := []environmentStatus{}
+	for _, name := range base.EnvironmentNames() {
+		spec, err := base.ForEnvironment(name)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		status := environmentStatus{
+			Name:        name,
+			Default:     base.Environments[name].Default,
+			JobID:       spec.JobID(),
+			SecretsFile: spec.SecretsFile(),
+		}
+		current, err := h.db.LastSuccessfulDeployment(r.Context(), id, spec.HistoryEnvironments(), "")
+		if err != nil && err != pgx.ErrNoRows {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		status.Current = current
+		out = append(out, status)
+	}
+	writeJSON(w, out)
+}
+
+// PromoteEnvironment deploys the image currently running in one environment
+// to another without rebuilding it.
+func (h *Handler) PromoteEnvironment(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.From == "" || req.To == "" {
+		writeError(w, http.StatusBadRequest, "from and to environments are required")
+		return
+	}
+	from := h.appSpec(w, id, req.From)
+	if from == nil {
+		return
+	}
+	to := h.appSpec(w, id, req.To)
+	if to == nil {
+		return
+	}
+	if from.Environment == to.Environment {
+		writeError(w, http.StatusBadRequest, "from and to must be different environments")
+		return
+	}
+
+	source, err := h.db.LastSuccessfulDeployment(r.Context(), id, from.HistoryEnvironments(), "")
+	if err == pgx.ErrNoRows {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s has no successful deployment in %s", id, from.Environment))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	deploy, err := h.pipeline.Promote(r.Context(), to, source)
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, map[string]string{
+		"sagaId":             deploy.SagaID,
+		"status":             "queued",
+		"deploymentId":       deploy.ID,
+		"sourceDeploymentId": source.ID,
+		"imageTag":           deploy.ImageTag,
+		"commitSha":          deploy.CommitSHA,
+	})
+}
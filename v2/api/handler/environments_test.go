@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestEnvPrefersQueryOverBodyAlias(t *testing.T) {
+	for _, tc := range []struct {
+		target, body, want string
+	}{
+		{"/api/apps/shop/rollback?env=staging", "", "staging"},
+		{"/api/apps/shop/deploy?env=staging", "production", "staging"},
+		{"/api/apps/shop/deploy", "production", "production"},
+		{"/api/apps/shop/deploy", "", ""},
+	} {
+		r := httptest.NewRequest("POST", tc.target, nil)
+		if got := requestEnv(r, tc.body); got != tc.want {
+			t.Fatalf("requestEnv(%s, %q) = %q, want %q", tc.target, tc.body, got, tc.want)
+		}
+	}
+}
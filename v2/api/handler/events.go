@@ -9,6 +9,7 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5"
 
+	"norn/v2/api/auth"
 	"norn/v2/api/model"
 	"norn/v2/api/store"
 )
@@ -83,14 +84,11 @@ func (h *Handler) GetEvent(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) AcknowledgeEvent(w http.ResponseWriter, r *http.Request) {
 	var body struct {
-		By   string `json:"by"`
 		Note string `json:"note"`
 	}
 	_ = json.NewDecoder(r.Body).Decode(&body)
-	if body.By == "" {
-		body.By = "operator"
-	}
-	event, err := h.db.AcknowledgeBeaconEvent(r.Context(), chi.URLParam(r, "id"), body.By, body.Note)
+	by := auth.Actor(r.Context(), "operator")
+	event, err := h.db.AcknowledgeBeaconEvent(r.Context(), chi.URLParam(r, "id"), by, body.Note)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			writeError(w, http.StatusNotFound, "event not found")
@@ -104,15 +102,12 @@ func (h *Handler) AcknowledgeEvent(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) SnoozeEvent(w http.ResponseWriter, r *http.Request) {
 	var body struct {
-		By       string `json:"by"`
 		Note     string `json:"note"`
 		Until    string `json:"until"`
 		Duration string `json:"duration"`
 	}
 	_ = json.NewDecoder(r.Body).Decode(&body)
-	if body.By == "" {
-		body.By = "operator"
-	}
+	by := auth.Actor(r.Context(), "operator")
 	until := time.Time{}
 	if body.Until != "" {
 		parsed, err := time.Parse(time.RFC3339, body.Until)
@@ -132,7 +127,7 @@ func (h *Handler) SnoozeEvent(w http.ResponseWriter, r *http.Request) {
 		}
 		until = time.Now().UTC().Add(duration)
 	}
-	event, err := h.db.SnoozeBeaconEvent(r.Context(), chi.URLParam(r, "id"), body.By, body.Note, until)
+	event, err := h.db.SnoozeBeaconEvent(r.Context(), chi.URLParam(r, "id"), by, body.Note, until)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			writeError(w, http.StatusNotFound, "event not found")
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strings"
 
+	"norn/v2/api/auth"
 	"norn/v2/api/model"
 )
 
@@ -14,7 +15,6 @@ type eventReconcileRequest struct {
 	App    string `json:"app,omitempty"`
 	Limit  int    `json:"limit,omitempty"`
 	DryRun bool   `json:"dryRun,omitempty"`
-	By     string `json:"by,omitempty"`
 }
 
 type eventReconcileDecision struct {
@@ -39,9 +39,7 @@ type eventReconcileResponse struct {
 func (h *Handler) ReconcileEvents(w http.ResponseWriter, r *http.Request) {
 	var req eventReconcileRequest
 	_ = json.NewDecoder(r.Body).Decode(&req)
-	if req.By == "" {
-		req.By = "system"
-	}
+	by := auth.Actor(r.Context(), "system")
 
 	events, err := h.db.ListOpenBeaconEvents(r.Context(), req.App, req.Limit)
 	if err != nil {
@@ -63,7 +61,7 @@ func (h *Handler) ReconcileEvents(w http.ResponseWriter, r *http.Request) {
 				if len(decision.Evidence) > 0 {
 					note += ": " + strings.Join(decision.Evidence, "; ")
 				}
-				if _, err := h.db.AcknowledgeBeaconEvent(r.Context(), event.ID, req.By, note); err != nil {
+				if _, err := h.db.AcknowledgeBeaconEvent(r.Context(), event.ID, by, note); err != nil {
 					writeError(w, http.StatusInternalServerError, err.Error())
 					return
 				}
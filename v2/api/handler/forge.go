@@ -1,15 +1,19 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"sort"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 
 	"norn/v2/api/cloudflared"
 	"norn/v2/api/model"
+	"norn/v2/api/nomad"
 )
 
 func (h *Handler) Forge(w http.ResponseWriter, r *http.Request) {
@@ -74,10 +78,21 @@ func (h *Handler) Forge(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, map[string]string{"status": "forged"})
 }
 
+// Teardown removes the app's cloudflared routing. It refuses while the
+// app has managed volumes holding data, unless the request sets
+// purgeVolumes; then it stops the app's jobs and deletes the volumes too.
 func (h *Handler) Teardown(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	ctx := r.Context()
 
+	var req struct {
+		PurgeVolumes bool `json:"purgeVolumes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
 	specs, err := model.DiscoverApps(h.cfg.AppsDir)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
@@ -95,15 +110,67 @@ func (h *Handler) Teardown(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(spec.Endpoints) == 0 {
-		writeJSON(w, map[string]string{"status": "skipped", "reason": "no endpoints"})
+	var volumes []*nomad.VolumeStatus
+	if len(model.ManagedVolumes(spec)) > 0 {
+		if h.nomad == nil {
+			writeError(w, http.StatusServiceUnavailable, "nomad is not configured; cannot check the app's volumes")
+			return
+		}
+		volumes, err = h.attachedVolumes(spec)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, fmt.Sprintf("check volumes: %v", err))
+			return
+		}
+		if len(volumes) > 0 && !req.PurgeVolumes {
+			writeError(w, http.StatusConflict, fmt.Sprintf("app %s has data in volumes %s; tear down with --purge-volumes to delete them", id, strings.Join(volumeSources(volumes), ", ")))
+			return
+		}
+	}
+
+	status, err := h.removeIngress(ctx, spec)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	resp := map[string]any{"status": status}
+	if status == "skipped" {
+		resp["reason"] = "no endpoints"
+	}
+	removed, err := h.removeIntentions(spec)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("remove intentions: %v", err))
 		return
 	}
+	if len(removed) > 0 {
+		resp["intentionsRemoved"] = len(removed)
+		resp["status"] = "torn_down"
+		delete(resp, "reason")
+	}
+	if len(volumes) > 0 {
+		deleted, err := h.purgeVolumes(ctx, spec, volumes)
+		if deleted != nil {
+			resp["volumesDeleted"] = deleted
+		}
+		if err != nil {
+			writeError(w, http.StatusBadGateway, fmt.Sprintf("purge volumes (deleted %d of %d): %v", len(deleted), len(volumes), err))
+			return
+		}
+		resp["status"] = "torn_down"
+		delete(resp, "reason")
+	}
+	writeJSON(w, resp)
+}
+
+// removeIngress drops the app's endpoints from cloudflared. status is
+// skipped, unchanged or torn_down.
+func (h *Handler) removeIngress(ctx context.Context, spec *model.InfraSpec) (string, error) {
+	if len(spec.Endpoints) == 0 {
+		return "skipped", nil
+	}
 
 	cfg, err := cloudflared.ReadConfig(ctx)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, fmt.Sprintf("read config: %v", err))
-		return
+		return "", fmt.Errorf("read config: %v", err)
 	}
 
 	changed := false
@@ -114,20 +181,16 @@ func (h *Handler) Teardown(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !changed {
-		writeJSON(w, map[string]string{"status": "unchanged"})
-		return
+		return "unchanged", nil
 	}
 
 	if err := cloudflared.ApplyConfig(ctx, cfg); err != nil {
-		writeError(w, http.StatusInternalServerError, fmt.Sprintf("apply config: %v", err))
-		return
+		return "", fmt.Errorf("apply config: %v", err)
 	}
 	if err := cloudflared.Restart(ctx); err != nil {
-		writeError(w, http.StatusInternalServerError, fmt.Sprintf("restart: %v", err))
-		return
+		return "", fmt.Errorf("restart: %v", err)
 	}
-
-	writeJSON(w, map[string]string{"status": "torn_down"})
+	return "torn_down", nil
 }
 
 func (h *Handler) CloudflaredIngress(w http.ResponseWriter, r *http.Request) {
@@ -3,7 +3,6 @@ package handler
 import (
 	"fmt"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -72,8 +71,8 @@ func (h *Handler) InvokeFunction(w http.ResponseWriter, r *http.Request) {
 	// Resolve secrets + function env
 	env := make(map[string]string)
 	if h.secrets != nil {
-		secretEnv, err := h.secrets.EnvMap(id)
-		if err != nil && !os.IsNotExist(err) {
+		secretEnv, err := h.secrets.For(spec).JobEnv(id)
+		if err != nil {
 			writeError(w, http.StatusInternalServerError, fmt.Sprintf("resolve secrets: %v", err))
 			return
 		}
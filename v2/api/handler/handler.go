@@ -2,12 +2,17 @@ package handler
 
 import (
 	"encoding/json"
+	"html/template"
+	"net"
 	"net/http"
+	"os"
 	"regexp"
-	"sync"
+	"strings"
+	"sync/atomic"
 
 	"github.com/go-chi/chi/v5"
 
+	"norn/v2/api/auth"
 	"norn/v2/api/beacon"
 	"norn/v2/api/config"
 	"norn/v2/api/consul"
@@ -36,7 +41,11 @@ type Handler struct {
 	s3        *storage.Client
 	redpanda  *redpanda.Client
 	access    *AccessLog
-	wakeLocks sync.Map
+	wakes     wakeQueue
+	wakeStats wakeStats
+	wakePage  *template.Template // nil holds browsers like API clients
+	proxies   []*net.IPNet       // trusted reverse proxies besides loopback
+	closed    atomic.Bool        // open mode has ended; see openMode
 }
 
 func New(db *store.DB, n *nomad.Client, c *consul.Client, ws *hub.Hub, cfg *config.Config, p *pipeline.Pipeline, beaconSvc *beacon.Service, sec *secrets.Manager, ss saga.Store, s3 *storage.Client, rp *redpanda.Client) *Handler {
@@ -53,6 +62,9 @@ func New(db *store.DB, n *nomad.Client, c *consul.Client, ws *hub.Hub, cfg *conf
 		s3:        s3,
 		redpanda:  rp,
 		access:    NewAccessLog(defaultAccessLogLimit),
+		wakes:     wakeQueue{limit: cfg.WakeQueueLimit},
+		wakePage:  loadWakeInterstitial(cfg.WakeInterstitial, os.ReadFile),
+		proxies:   parseTrustedProxies(cfg.TrustedProxies),
 	}
 }
 
@@ -64,10 +76,39 @@ func ValidateAppID(next http.Handler) http.Handler {
 			http.Error(w, "invalid app id", http.StatusBadRequest)
 			return
 		}
+		if id != "" && !auth.FromContext(r.Context()).CanAccessApp(id) {
+			http.Error(w, "forbidden: token is not scoped to "+id, http.StatusForbidden)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// selfScopedWrites are the writes outside /api/apps/{id} whose handlers
+// check an app-scoped token against every app they touch.
+var selfScopedWrites = []string{"/api/auth/tokens", "/api/access/tokens", "/api/deploy-groups/"}
+
+// ScopeWrites is middleware that keeps app-scoped tokens to their apps.
+// ValidateAppID checks writes under /api/apps/{id}; any other write may act
+// on several apps or the platform, so it is refused unless the handler
+// checks the scope itself.
+func ScopeWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := auth.FromContext(r.Context())
+		if id == nil || len(id.Apps) == 0 || r.Method == http.MethodGet || r.Method == http.MethodHead || strings.HasPrefix(r.URL.Path, "/api/apps/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, prefix := range selfScopedWrites {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		http.Error(w, "forbidden: app-scoped tokens can only change their apps", http.StatusForbidden)
+	})
+}
+
 func writeJSON(w http.ResponseWriter, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(v)
@@ -1,11 +1,6 @@
 package handler
 
-import (
-	"net/http"
-	"os"
-	"os/exec"
-	"path/filepath"
-)
+import "net/http"
 
 func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
 	services := map[string]string{}
@@ -48,13 +43,9 @@ func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// SOPS check: binary on PATH + age key file
-	if _, err := exec.LookPath("sops"); err != nil {
-		services["sops"] = "down"
-	} else {
-		home, _ := os.UserHomeDir()
-		keyFile := filepath.Join(home, ".config", "sops", "age", "keys.txt")
-		if _, err := os.Stat(keyFile); err != nil {
+	// SOPS check: an age identity to decrypt secrets with
+	if h.secrets != nil {
+		if err := h.secrets.Healthy(); err != nil {
 			services["sops"] = "down"
 		} else {
 			services["sops"] = "up"
@@ -14,9 +14,10 @@ func (h *Handler) StreamLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	follow := r.URL.Query().Get("follow") == "true"
+	q := r.URL.Query()
+	follow := q.Get("follow") == "true"
 
-	reader, err := h.nomad.StreamLogs(id, follow)
+	reader, err := h.nomad.StreamLogs(id, q.Get("process"), q.Get("task"), follow)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"sort"
+
+	"norn/v2/api/consul"
+	"norn/v2/api/model"
+)
+
+// serviceGraph builds the declared upstream edges of the default jobs and
+// matches each against the Consul intentions.
+func (h *Handler) serviceGraph(specs []*model.InfraSpec, services []model.ServiceManifestEntry) model.ServiceGraph {
+	graph := model.ServiceGraph{Edges: []model.ServiceGraphEdge{}}
+	known := make(map[string]bool, len(services))
+	for _, svc := range services {
+		known[svc.Name] = true
+	}
+
+	var intentions []consul.Intention
+	readable := false
+	if h.consul != nil {
+		var err error
+		intentions, err = h.consul.Intentions()
+		readable = err == nil
+	}
+
+	for _, spec := range specs {
+		for procName, proc := range spec.Processes {
+			if proc.Mesh == nil {
+				continue
+			}
+			source := model.ServiceName(spec.App, procName)
+			for _, up := range proc.Mesh.Upstreams {
+				edge := model.ServiceGraphEdge{
+					Source:      source,
+					Destination: up.Service,
+					LocalPort:   up.LocalPort,
+					Known:       known[up.Service],
+					Intention:   "unknown",
+				}
+				if readable {
+					edge.Intention = "missing"
+					if match := matchIntention(intentions, source, up.Service); match != nil {
+						edge.Intention = match.Action
+						edge.Managed = match.Managed
+					}
+				}
+				graph.Edges = append(graph.Edges, edge)
+			}
+		}
+	}
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		if graph.Edges[i].Source != graph.Edges[j].Source {
+			return graph.Edges[i].Source < graph.Edges[j].Source
+		}
+		return graph.Edges[i].Destination < graph.Edges[j].Destination
+	})
+	return graph
+}
+
+// matchIntention finds the intention Consul applies from source to
+// destination: an exact one wins over wildcards.
+func matchIntention(intentions []consul.Intention, source, destination string) *consul.Intention {
+	var best *consul.Intention
+	bestScore := 0
+	for i, in := range intentions {
+		score := 0
+		switch {
+		case in.Source == source && in.Destination == destination:
+			score = 3
+		case in.Source == "*" && in.Destination == destination:
+			score = 2
+		case in.Source == source && in.Destination == "*":
+			score = 2
+		case in.Source == "*" && in.Destination == "*":
+			score = 1
+		}
+		if score > bestScore {
+			best, bestScore = &intentions[i], score
+		}
+	}
+	return best
+}
+
+// removeIntentions drops the Norn-managed intentions of the app's services
+// in every environment teardown covers, including those left behind by an
+// app that has since removed its mesh blocks.
+func (h *Handler) removeIntentions(spec *model.InfraSpec) ([]consul.IntentionChange, error) {
+	if h.consul == nil {
+		return nil, nil
+	}
+	var removed []consul.IntentionChange
+	for _, jobID := range teardownJobIDs(spec) {
+		changes, err := h.consul.SyncIntentions(model.MeshServices(jobID, spec), nil)
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, changes...)
+	}
+	return removed, nil
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"norn/v2/api/config"
+	"norn/v2/api/consul"
+)
+
+func TestServiceGraphMatchesDeclaredUpstreamsToIntentions(t *testing.T) {
+	appsDir := t.TempDir()
+	specs := map[string]string{
+		"billing": `
+name: billing
+deploy: true
+processes:
+  web:
+    port: 8080
+    mesh:
+      upstreams:
+        - service: ledger-api
+          localPort: 9001
+        - service: search
+          localPort: 9002
+        - service: geo
+          localPort: 9003
+`,
+		"ledger": `
+name: ledger
+deploy: true
+processes:
+  api:
+    port: 8080
+`,
+	}
+	for app, spec := range specs {
+		if err := os.Mkdir(filepath.Join(appsDir, app), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(appsDir, app, "infraspec.yaml"), []byte(spec), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/config/service-intentions" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[
+			{"Kind":"service-intentions","Name":"ledger-api","Sources":[{"Name":"billing-web","Action":"allow","Description":"managed by norn"}]},
+			{"Kind":"service-intentions","Name":"search","Sources":[{"Name":"*","Action":"deny"}]}
+		]`))
+	}))
+	defer srv.Close()
+	client, err := consul.NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &Handler{cfg: &config.Config{AppsDir: appsDir}, consul: client}
+	manifest, err := h.buildServiceManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	edges := manifest.Graph.Edges
+	if len(edges) != 3 {
+		t.Fatalf("edges = %+v", edges)
+	}
+	geo, ledger, search := edges[0], edges[1], edges[2]
+	if geo.Destination != "geo" || geo.Known || geo.Intention != "missing" {
+		t.Fatalf("geo edge = %+v", geo)
+	}
+	if ledger.Source != "billing-web" || !ledger.Known || ledger.Intention != "allow" || !ledger.Managed || ledger.LocalPort != 9001 {
+		t.Fatalf("ledger edge = %+v", ledger)
+	}
+	if search.Intention != "deny" || search.Managed {
+		t.Fatalf("search edge = %+v", search)
+	}
+
+	h.consul = nil
+	manifest, err = h.buildServiceManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Graph.Edges[0].Intention != "unknown" {
+		t.Fatalf("without consul = %+v", manifest.Graph.Edges[0])
+	}
+}
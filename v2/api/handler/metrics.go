@@ -134,6 +134,8 @@ func (h *Handler) Metrics(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	h.wakeStats.write(&b, h.wakes.held())
+
 	if h.access != nil {
 		writeMetricHeader(&b, "norn_access_events_recent_total", "Recent API access events retained in memory, grouped by status bucket.", "gauge")
 		byStatus := map[string]int{}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/hashicorp/cronexpr"
 
+	"norn/v2/api/auth"
 	"norn/v2/api/model"
 	"norn/v2/api/nomad"
 	"norn/v2/api/store"
@@ -28,6 +29,7 @@ type operatorInboxSummary struct {
 	CronRisks          int `json:"cronRisks"`
 	SnapshotRisks      int `json:"snapshotRisks"`
 	SecretRisks        int `json:"secretRisks"`
+	SignalRisks        int `json:"signalRisks"`
 	WakeTargets        int `json:"wakeTargets"`
 	RecommendedActions int `json:"recommendedActions"`
 }
@@ -78,21 +80,30 @@ type operatorCronEntry struct {
 	ResumeURL        string          `json:"resumeUrl"`
 }
 
+// Wake targets carry the sleep/wake history of the last week, newest first.
+const (
+	wakeHistoryWindow    = 7 * 24 * time.Hour
+	wakeHistoryPerTarget = 10
+)
+
 type operatorWakeTargets struct {
 	GeneratedAt string               `json:"generatedAt"`
 	Targets     []operatorWakeTarget `json:"targets"`
 }
 
 type operatorWakeTarget struct {
-	App       string   `json:"app"`
-	Process   string   `json:"process"`
-	Endpoint  string   `json:"endpoint"`
-	Exposure  string   `json:"exposure"`
-	Status    string   `json:"status"`
-	Instances int      `json:"instances"`
-	Ready     bool     `json:"ready"`
-	WakeURL   string   `json:"wakeUrl"`
-	Evidence  []string `json:"evidence,omitempty"`
+	App         string            `json:"app"`
+	Process     string            `json:"process"`
+	Endpoint    string            `json:"endpoint"`
+	Exposure    string            `json:"exposure"`
+	Status      string            `json:"status"`
+	Instances   int               `json:"instances"`
+	Ready       bool              `json:"ready"`
+	WakeURL     string            `json:"wakeUrl"`
+	ScaleToZero bool              `json:"scaleToZero"`
+	IdleTimeout string            `json:"idleTimeout,omitempty"`
+	History     []model.WakeEvent `json:"history,omitempty"`
+	Evidence    []string          `json:"evidence,omitempty"`
 }
 
 type operatorDeployConfidence struct {
@@ -313,7 +324,14 @@ func (h *Handler) OperatorInbox(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	wakeTargets, err := h.buildOperatorWakeTargets()
+	for _, item := range h.operatorSignalItems(r.Context()) {
+		if item.Status == "pressure" {
+			inbox.Summary.SignalRisks++
+		}
+		items = append(items, item)
+	}
+
+	wakeTargets, err := h.buildOperatorWakeTargets(r)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -341,7 +359,7 @@ func (h *Handler) OperatorCronOverview(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) OperatorWakeTargets(w http.ResponseWriter, r *http.Request) {
-	targets, err := h.buildOperatorWakeTargets()
+	targets, err := h.buildOperatorWakeTargets(r)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -407,7 +425,6 @@ func (h *Handler) IncidentAction(w http.ResponseWriter, r *http.Request) {
 		CorrelationKey string `json:"correlationKey,omitempty"`
 		DedupeKey      string `json:"dedupeKey,omitempty"`
 		App            string `json:"app,omitempty"`
-		By             string `json:"by,omitempty"`
 		Note           string `json:"note,omitempty"`
 		Duration       string `json:"duration,omitempty"`
 		Until          string `json:"until,omitempty"`
@@ -416,28 +433,26 @@ func (h *Handler) IncidentAction(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	if req.By == "" {
-		req.By = "operator"
-	}
+	by := auth.Actor(r.Context(), "operator")
 	key := store.IncidentGroupKey{CorrelationKey: req.CorrelationKey, DedupeKey: req.DedupeKey}
 	var affected int
 	var err error
 	switch req.Action {
 	case "acknowledge", "ack":
-		affected, err = h.db.AcknowledgeIncidentGroup(r.Context(), key, req.By, req.Note)
+		affected, err = h.db.AcknowledgeIncidentGroup(r.Context(), key, by, req.Note)
 	case "snooze":
 		until, parseErr := incidentSnoozeUntil(req.Duration, req.Until)
 		if parseErr != nil {
 			writeError(w, http.StatusBadRequest, parseErr.Error())
 			return
 		}
-		affected, err = h.db.SnoozeIncidentGroup(r.Context(), key, req.By, req.Note, until)
+		affected, err = h.db.SnoozeIncidentGroup(r.Context(), key, by, req.Note, until)
 	case "open":
 		affected, err = h.db.OpenIncidentGroup(r.Context(), key)
 	case "resolve":
-		affected, err = h.db.AcknowledgeIncidentGroup(r.Context(), key, req.By, req.Note)
+		affected, err = h.db.AcknowledgeIncidentGroup(r.Context(), key, by, req.Note)
 		if err == nil {
-			if _, emitErr := h.emitIncidentResolution(r, req.App, key, req.By, req.Note); emitErr != nil {
+			if _, emitErr := h.emitIncidentResolution(r, req.App, key, by, req.Note); emitErr != nil {
 				err = emitErr
 			}
 		}
@@ -564,16 +579,38 @@ func (h *Handler) buildOperatorCronOverview(r *http.Request) (operatorCronOvervi
 	return out, nil
 }
 
-func (h *Handler) buildOperatorWakeTargets() (operatorWakeTargets, error) {
+func (h *Handler) buildOperatorWakeTargets(r *http.Request) (operatorWakeTargets, error) {
 	manifest, err := h.buildServiceManifest()
 	if err != nil {
 		return operatorWakeTargets{}, err
 	}
+	scaling := map[string]*model.Scaling{}
+	if specs, err := model.DiscoverApps(h.cfg.AppsDir); err == nil {
+		for _, spec := range specs {
+			for name, proc := range spec.Processes {
+				scaling[accessPatternKey(spec.App, name)] = proc.Scaling
+			}
+		}
+	}
+	history := map[string][]model.WakeEvent{}
+	if h.db != nil {
+		events, err := h.db.ListWakeEvents(r.Context(), "", time.Now().Add(-wakeHistoryWindow), 500)
+		if err != nil {
+			return operatorWakeTargets{}, err
+		}
+		for _, e := range events {
+			key := accessPatternKey(e.App, e.Process)
+			if len(history[key]) < wakeHistoryPerTarget {
+				history[key] = append(history[key], e)
+			}
+		}
+	}
 	out := operatorWakeTargets{GeneratedAt: time.Now().UTC().Format(time.RFC3339)}
 	for _, service := range manifest.Services {
 		if len(service.Endpoints) == 0 {
 			continue
 		}
+		key := accessPatternKey(service.App, service.Process)
 		for _, endpoint := range service.Endpoints {
 			target := operatorWakeTarget{
 				App:       service.App,
@@ -591,6 +628,12 @@ func (h *Handler) buildOperatorWakeTargets() (operatorWakeTargets, error) {
 			} else {
 				target.Evidence = append(target.Evidence, "wake may scale or wait for readiness")
 			}
+			if sc := scaling[key]; sc.ScalesToZero() {
+				target.ScaleToZero = true
+				target.IdleTimeout = sc.IdleAfter().String()
+				target.Evidence = append(target.Evidence, "idle reaper scales to zero after "+target.IdleTimeout+" without requests")
+			}
+			target.History = history[key]
 			out.Targets = append(out.Targets, target)
 		}
 	}
@@ -731,8 +774,8 @@ func (h *Handler) operatorSecretStatuses() []SecretStatus {
 
 func operatorActions() []operatorActionDescriptor {
 	return []operatorActionDescriptor{
-		{ID: "incident.acknowledge", Label: "Acknowledge Incident", Method: http.MethodPost, Path: "/api/incidents/action", BodySchema: `{"action":"acknowledge","correlationKey":"...","by":"operator","note":"..."}`, Risk: "low", MobileReady: true},
-		{ID: "incident.resolve", Label: "Resolve Incident", Method: http.MethodPost, Path: "/api/incidents/action", BodySchema: `{"action":"resolve","correlationKey":"...","app":"...","by":"operator","note":"..."}`, Risk: "low", MobileReady: true},
+		{ID: "incident.acknowledge", Label: "Acknowledge Incident", Method: http.MethodPost, Path: "/api/incidents/action", BodySchema: `{"action":"acknowledge","correlationKey":"...","note":"..."}`, Risk: "low", MobileReady: true},
+		{ID: "incident.resolve", Label: "Resolve Incident", Method: http.MethodPost, Path: "/api/incidents/action", BodySchema: `{"action":"resolve","correlationKey":"...","app":"...","note":"..."}`, Risk: "low", MobileReady: true},
 		{ID: "incident.snooze", Label: "Snooze Incident", Method: http.MethodPost, Path: "/api/incidents/action", BodySchema: `{"action":"snooze","correlationKey":"...","duration":"1h"}`, Risk: "low", MobileReady: true},
 		{ID: "cron.trigger", Label: "Trigger Cron", Method: http.MethodPost, Path: "/api/apps/{id}/cron/trigger", BodySchema: `{"process":"..."}`, Risk: "medium", MobileReady: true},
 		{ID: "cron.pause", Label: "Pause Cron", Method: http.MethodPost, Path: "/api/apps/{id}/cron/pause", BodySchema: `{"process":"..."}`, Risk: "medium", MobileReady: true},
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"norn/v2/api/model"
+	"norn/v2/api/pipeline"
+)
+
+// signalPressure is the share of a declared limit at which a windowed
+// memory or CPU signal is raised in the operator inbox.
+const signalPressure = 0.90
+
+// operatorSignalItems evaluates the Prometheus tuning signals apps declare
+// and returns inbox items for processes running close to their limits over
+// the signal's window, and for signals that could not be evaluated.
+func (h *Handler) operatorSignalItems(ctx context.Context) []operatorInboxItem {
+	specs, err := model.DiscoverApps(h.cfg.AppsDir)
+	if err != nil {
+		return nil
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].App < specs[j].App })
+	q := h.prometheus()
+
+	var items, unavailable []operatorInboxItem
+	var declared []string
+	var down string
+	for _, spec := range specs {
+		names := make([]string, 0, len(spec.Processes))
+		for name := range spec.Processes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			proc := spec.Processes[name]
+			if !declaresPrometheusSignals(proc) {
+				continue
+			}
+			declared = append(declared, spec.App+"/"+name)
+			if q == nil || down != "" {
+				continue
+			}
+			usage := pipeline.EvaluateTuningSignals(ctx, q, spec.JobID(), spec.App, name, proc, pipeline.TuningUsage{})
+			var missing []string
+			for _, signal := range usage.Signals {
+				if signal.Source != "prometheus" {
+					continue
+				}
+				if !signal.Available {
+					if strings.HasPrefix(signal.Reason, "prometheus unavailable") {
+						down = signal.Reason
+						break
+					}
+					missing = append(missing, signal.Name+": "+signal.Reason)
+					continue
+				}
+				if item, ok := signalPressureItem(spec.App, name, proc, signal); ok {
+					items = append(items, item)
+				}
+			}
+			if len(missing) > 0 && down == "" {
+				unavailable = append(unavailable, operatorInboxItem{
+					ID:        "signal:" + spec.App + ":" + name + ":unavailable",
+					Kind:      "signal",
+					App:       spec.App,
+					Process:   name,
+					Severity:  "info",
+					Status:    "unavailable",
+					Title:     spec.App + " " + name + " tuning signals unavailable",
+					Action:    "inspect",
+					ActionURL: "/api/tuning/recommendations",
+					Evidence:  missing,
+				})
+			}
+		}
+	}
+
+	switch {
+	case len(declared) == 0:
+		return nil
+	case q == nil:
+		return []operatorInboxItem{{
+			ID:       "signal:prometheus:not_configured",
+			Kind:     "signal",
+			Severity: "info",
+			Status:   "not_configured",
+			Title:    "prometheus signals declared but NORN_PROMETHEUS_URL is not set",
+			Action:   "inspect",
+			Evidence: declared,
+		}}
+	case down != "":
+		// Items found before the outage still hold; the rest are unknown.
+		return append(items, operatorInboxItem{
+			ID:        "signal:prometheus:unavailable",
+			Kind:      "signal",
+			Severity:  "warning",
+			Status:    "unavailable",
+			Title:     "prometheus unavailable for tuning signals",
+			Body:      down,
+			Action:    "inspect",
+			ActionURL: "/api/tuning/recommendations",
+			Evidence:  declared,
+		})
+	}
+	return append(items, unavailable...)
+}
+
+func declaresPrometheusSignals(proc model.Process) bool {
+	if proc.Tuning == nil {
+		return false
+	}
+	for _, signal := range proc.Tuning.Signals {
+		if signal.Source == "prometheus" {
+			return true
+		}
+	}
+	return false
+}
+
+// signalPressureItem raises a memory signal at signalPressure of the
+// process's memory, or a CPU signal at that share of its allocation.
+func signalPressureItem(app, process string, proc model.Process, signal pipeline.TuningSignalResult) (operatorInboxItem, bool) {
+	var share float64
+	var limit string
+	switch {
+	case signal.Unit == "MB":
+		memory := 128
+		if proc.Resources != nil && proc.Resources.Memory > 0 {
+			memory = proc.Resources.Memory
+		}
+		share = signal.Value / float64(memory)
+		limit = fmt.Sprintf("%dMB", memory)
+	case signal.Metric == "cpu_percent":
+		share = signal.Value / 100
+		limit = "cpu allocation"
+	default:
+		return operatorInboxItem{}, false
+	}
+	if share < signalPressure {
+		return operatorInboxItem{}, false
+	}
+	aggregate := signal.Aggregate
+	if signal.Window != "" && aggregate != "" && aggregate != "current" {
+		aggregate += " over " + signal.Window
+	}
+	return operatorInboxItem{
+		ID:        "signal:" + app + ":" + process + ":" + signal.Name,
+		Kind:      "signal",
+		App:       app,
+		Process:   process,
+		Severity:  "warning",
+		Status:    "pressure",
+		Title:     fmt.Sprintf("%s %s %s at %.0f%% of %s", app, process, signal.Name, share*100, limit),
+		Action:    "inspect",
+		ActionURL: "/api/tuning/recommendations",
+		Evidence:  compactEvidence(fmt.Sprintf("%s %.2f %s", aggregate, signal.Value, signal.Unit), signal.Query),
+	}, true
+}
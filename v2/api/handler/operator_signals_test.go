@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"norn/v2/api/config"
+	"norn/v2/api/pipeline"
+	"norn/v2/api/prometheus"
+)
+
+func TestOperatorSignalItemsRaisePressureAndOutages(t *testing.T) {
+	appsDir := t.TempDir()
+	appDir := filepath.Join(appsDir, "signals-app")
+	if err := os.Mkdir(appDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	spec := []byte(`
+name: signals-app
+deploy: true
+processes:
+  web:
+    port: 8080
+    resources:
+      memory: 512
+    tuning:
+      signals:
+        - name: memory-p95
+          source: prometheus
+          metric: memory_rss
+          window: 24h
+          aggregate: p95
+        - name: backlog
+          source: prometheus
+          metric: custom
+          query: sum(queue_depth)
+  worker:
+    command: ./worker
+`)
+	if err := os.WriteFile(filepath.Join(appDir, "infraspec.yaml"), spec, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Query().Get("query"), "nomad_client_allocs_memory_rss") {
+			// 480 MiB of 512 MB.
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1760600000,"503316480"]}]}}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	defer srv.Close()
+
+	h := &Handler{
+		cfg:      &config.Config{AppsDir: appsDir},
+		pipeline: &pipeline.Pipeline{Prometheus: prometheus.New(srv.URL)},
+	}
+	items := h.operatorSignalItems(context.Background())
+	if len(items) != 2 {
+		t.Fatalf("items = %+v, want pressure and unavailable", items)
+	}
+	if items[0].Status != "pressure" || items[0].Title != "signals-app web memory-p95 at 94% of 512MB" {
+		t.Fatalf("pressure item = %+v", items[0])
+	}
+	if items[1].Status != "unavailable" || !strings.Contains(strings.Join(items[1].Evidence, ";"), "backlog: no samples matched") {
+		t.Fatalf("unavailable item = %+v", items[1])
+	}
+
+	srv.Close()
+	items = h.operatorSignalItems(context.Background())
+	if len(items) != 1 || items[0].ID != "signal:prometheus:unavailable" || !strings.HasPrefix(items[0].Body, "prometheus unavailable:") {
+		t.Fatalf("items with prometheus down = %+v", items)
+	}
+
+	h.pipeline = nil
+	items = h.operatorSignalItems(context.Background())
+	if len(items) != 1 || items[0].Status != "not_configured" || items[0].Evidence[0] != "signals-app/web" {
+		t.Fatalf("items without prometheus = %+v", items)
+	}
+}
@@ -17,6 +17,7 @@ type platformOpsSummary struct {
 	Operations    platformOperationSummary `json:"operations"`
 	Secrets       platformSecretSummary    `json:"secrets"`
 	Snapshots     []platformSnapshotStatus `json:"snapshots"`
+	Volumes       []platformVolumeStatus   `json:"volumes"`
 	Access        platformAccessSummary    `json:"access"`
 	Observability platformObserveSummary   `json:"observability"`
 	Warnings      []string                 `json:"warnings,omitempty"`
@@ -145,6 +146,12 @@ func (h *Handler) buildPlatformOps(r *http.Request) (platformOpsSummary, error)
 				out.Warnings = append(out.Warnings, "snapshot retention over limit: "+snapshotStatus.App)
 			}
 		}
+		volumes, warnings := h.summarizeVolumes(spec)
+		out.Volumes = append(out.Volumes, volumes...)
+		out.Warnings = append(out.Warnings, warnings...)
+	}
+	if out.Volumes == nil {
+		out.Volumes = []platformVolumeStatus{}
 	}
 	if out.Snapshots == nil {
 		out.Snapshots = []platformSnapshotStatus{}
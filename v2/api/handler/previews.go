@@ -0,0 +1,302 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"norn/v2/api/model"
+	"norn/v2/api/saga"
+)
+
+// pullRequestEvent is the subset of a GitHub or Gitea pull_request payload
+// previews need. Both forges use the same field names.
+type pullRequestEvent struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Title   string `json:"title"`
+		HTMLURL string `json:"html_url"`
+		Merged  bool   `json:"merged"`
+		Head    struct {
+			Ref  string `json:"ref"`
+			SHA  string `json:"sha"`
+			Repo *struct {
+				FullName string `json:"full_name"`
+			} `json:"repo"`
+		} `json:"head"`
+		Base struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+	} `json:"pull_request"`
+	Repository struct {
+		FullName string `json:"full_name"`
+		CloneURL string `json:"clone_url"`
+		SSHURL   string `json:"ssh_url"`
+	} `json:"repository"`
+}
+
+type previewResult struct {
+	App    string `json:"app"`
+	Number int    `json:"number"`
+	Action string `json:"action"`
+	SagaID string `json:"sagaId,omitempty"`
+	URL    string `json:"url,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// pullRequestWebhook deploys a preview when a pull request is opened or
+// pushed to, and tears it down when the pull request closes.
+func (h *Handler) pullRequestWebhook(w http.ResponseWriter, r *http.Request, provider string, body []byte, delivery *model.WebhookDelivery) {
+	var event pullRequestEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.Number <= 0 {
+		h.finishWebhookDelivery(r, delivery, "failed", "invalid payload")
+		writeError(w, http.StatusBadRequest, "invalid payload")
+		return
+	}
+
+	delivery.Ref = fmt.Sprintf("refs/pull/%d/head", event.Number)
+	delivery.Branch = event.PullRequest.Head.Ref
+	delivery.Repository = event.Repository.CloneURL
+	delivery.Payload = map[string]interface{}{
+		"action":     event.Action,
+		"number":     event.Number,
+		"headSha":    event.PullRequest.Head.SHA,
+		"headBranch": event.PullRequest.Head.Ref,
+		"baseBranch": event.PullRequest.Base.Ref,
+		"clone_url":  event.Repository.CloneURL,
+		"ssh_url":    event.Repository.SSHURL,
+	}
+	fork := event.fork()
+	if fork != "" {
+		delivery.Payload["headRepository"] = fork
+	}
+
+	var deploy bool
+	switch event.Action {
+	case "opened", "reopened", "synchronize", "synchronized":
+		deploy = true
+	case "closed":
+	default:
+		h.finishWebhookDelivery(r, delivery, "ignored", "unsupported pull_request action: "+event.Action)
+		writeJSON(w, map[string]bool{"ignored": true})
+		return
+	}
+
+	specs, err := model.DiscoverApps(h.cfg.AppsDir)
+	if err != nil {
+		h.finishWebhookDelivery(r, delivery, "failed", "failed to discover apps")
+		writeError(w, http.StatusInternalServerError, "failed to discover apps")
+		return
+	}
+	previewApps := matchPullRequestApps(model.FindPreviewApps, specs, &event)
+	var preflightApps []*model.InfraSpec
+	if deploy {
+		preflightApps = matchPullRequestApps(model.FindPreflightApps, specs, &event)
+	}
+	if len(previewApps) == 0 && len(preflightApps) == 0 {
+		h.finishWebhookDelivery(r, delivery, "ignored", "no app with previews or pull request preflights for this repository")
+		writeJSON(w, map[string]bool{"matched": false})
+		return
+	}
+	// A fork's head is untrusted code: building it runs its Dockerfile and
+	// migrations on the host with the app's secrets. Closing is still fine.
+	if deploy && fork != "" {
+		previewApps = trustingFork(previewApps, fork)
+		preflightApps = trustingFork(preflightApps, fork)
+		if len(previewApps) == 0 && len(preflightApps) == 0 {
+			log.Printf("webhook: ignoring pull request #%d from untrusted fork %s", event.Number, fork)
+			h.finishWebhookDelivery(r, delivery, "ignored", fmt.Sprintf("pull request from fork %s, which no app lists in repo.trustedForks", fork))
+			writeJSON(w, map[string]interface{}{"ignored": true, "fork": fork})
+			return
+		}
+	}
+
+	ctx := saga.WithActor(r.Context(), "webhook:"+provider)
+	results := make([]previewResult, 0, len(previewApps)+len(preflightApps))
+	for _, spec := range previewApps {
+		result := previewResult{App: spec.App, Number: event.Number}
+		if deploy {
+			log.Printf("webhook: deploying preview %s #%d (provider %s)", spec.App, event.Number, provider)
+			pr, err := h.pipeline.DeployPreview(ctx, spec, &model.Preview{
+				Number:     event.Number,
+				Provider:   provider,
+				Repository: spec.Repo.URL,
+				Branch:     event.PullRequest.Head.Ref,
+				HeadSHA:    event.PullRequest.Head.SHA,
+				Title:      event.PullRequest.Title,
+				PullURL:    event.PullRequest.HTMLURL,
+			})
+			result.Action = "deploy"
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.SagaID = pr.SagaID
+				result.URL = pr.URL()
+			}
+		} else {
+			result.Action = "teardown"
+			result.SagaID, result.Error = h.closePreview(ctx, spec.App, event.Number, closeReason(event.PullRequest.Merged))
+		}
+		results = append(results, result)
+	}
+	// Preflights report their result as a commit status on the head, which
+	// branch protection can require before merging.
+	for _, spec := range preflightApps {
+		log.Printf("webhook: preflighting %s #%d (provider %s)", spec.App, event.Number, provider)
+		results = append(results, previewResult{
+			App:    spec.App,
+			Number: event.Number,
+			Action: "preflight",
+			SagaID: h.pipeline.Preflight(ctx, spec, delivery.Ref),
+		})
+	}
+
+	delivery.App = results[0].App
+	delivery.SagaID = results[0].SagaID
+	status := "previewing"
+	switch {
+	case !deploy:
+		status = "closing"
+	case len(previewApps) == 0:
+		status = "preflighting"
+	}
+	h.finishWebhookDelivery(r, delivery, status, fmt.Sprintf("%s #%d for %s", resultSummary(results), event.Number, resultApps(results)))
+	writeJSON(w, map[string]interface{}{"previews": results})
+}
+
+// fork returns the head repository's full name when the pull request comes
+// from a fork, or "" when its head is in the base repository. A head
+// repository that was deleted or is not named counts as a fork.
+func (e *pullRequestEvent) fork() string {
+	head := e.PullRequest.Head.Repo
+	switch {
+	case head == nil:
+		return "(deleted fork)"
+	case head.FullName == "":
+		return "(unknown fork)"
+	case strings.EqualFold(head.FullName, e.Repository.FullName):
+		return ""
+	}
+	return head.FullName
+}
+
+// trustingFork keeps the specs that list fork in repo.trustedForks.
+func trustingFork(specs []*model.InfraSpec, fork string) []*model.InfraSpec {
+	var out []*model.InfraSpec
+	for _, spec := range specs {
+		if spec.Repo.TrustsFork(fork) {
+			out = append(out, spec)
+		}
+	}
+	return out
+}
+
+// matchPullRequestApps runs find against the pull request's clone URL, then
+// its ssh URL.
+func matchPullRequestApps(find func([]*model.InfraSpec, string, string) []*model.InfraSpec, specs []*model.InfraSpec, event *pullRequestEvent) []*model.InfraSpec {
+	matched := find(specs, event.Repository.CloneURL, event.PullRequest.Base.Ref)
+	if len(matched) == 0 && event.Repository.SSHURL != "" {
+		matched = find(specs, event.Repository.SSHURL, event.PullRequest.Base.Ref)
+	}
+	return matched
+}
+
+// closePreview queues teardown of an open preview. A missing or already
+// closed preview is not an error.
+func (h *Handler) closePreview(ctx context.Context, app string, number int, reason string) (string, string) {
+	pr, err := h.db.GetPreview(ctx, app, number)
+	if err != nil {
+		return "", err.Error()
+	}
+	if pr == nil || pr.Status == model.PreviewClosed || pr.Status == model.PreviewClosing {
+		return "", ""
+	}
+	sagaID, err := h.pipeline.ClosePreview(ctx, pr, reason)
+	if err != nil {
+		return "", err.Error()
+	}
+	return sagaID, ""
+}
+
+func closeReason(merged bool) string {
+	if merged {
+		return "merged"
+	}
+	return "closed"
+}
+
+// resultSummary lists the distinct actions taken, e.g. "deploy, preflight".
+func resultSummary(results []previewResult) string {
+	var actions []string
+	seen := map[string]bool{}
+	for _, res := range results {
+		if !seen[res.Action] {
+			seen[res.Action] = true
+			actions = append(actions, res.Action)
+		}
+	}
+	return strings.Join(actions, ", ")
+}
+
+func resultApps(results []previewResult) string {
+	var apps []string
+	seen := map[string]bool{}
+	for _, res := range results {
+		if !seen[res.App] {
+			seen[res.App] = true
+			apps = append(apps, res.App)
+		}
+	}
+	return strings.Join(apps, ", ")
+}
+
+// ListPreviews lists preview deployments, newest first. ?app= filters to
+// one app and ?all=true includes closed previews.
+func (h *Handler) ListPreviews(w http.ResponseWriter, r *http.Request) {
+	app := r.URL.Query().Get("app")
+	if id := chi.URLParam(r, "id"); id != "" {
+		app = id
+	}
+	previews, err := h.db.ListPreviews(r.Context(), app, r.URL.Query().Get("all") == "true")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, previews)
+}
+
+// ClosePreview tears a preview down before its pull request closes.
+func (h *Handler) ClosePreview(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	number, err := strconv.Atoi(chi.URLParam(r, "number"))
+	if err != nil || number <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid pull request number")
+		return
+	}
+	pr, err := h.db.GetPreview(r.Context(), id, number)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if pr == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s has no preview #%d", id, number))
+		return
+	}
+	sagaID, err := h.pipeline.ClosePreview(r.Context(), pr, "manual")
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, map[string]string{
+		"sagaId": sagaID,
+		"status": "closing",
+		"jobId":  pr.JobID,
+	})
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"norn/v2/api/config"
+	"norn/v2/api/model"
+)
+
+const forkPullRequest = `{
+  "action": "opened",
+  "number": 7,
+  "pull_request": {
+    "title": "Add a feature",
+    "head": {"ref": "feature", "sha": "abc123", "repo": {"full_name": "mallory/shop"}},
+    "base": {"ref": "main"}
+  },
+  "repository": {"full_name": "acme/shop", "clone_url": "https://github.com/acme/shop.git"}
+}`
+
+func TestPullRequestWebhookIgnoresUntrustedForks(t *testing.T) {
+	appsDir := t.TempDir()
+	appDir := filepath.Join(appsDir, "shop")
+	if err := os.Mkdir(appDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	spec := []byte(`
+name: shop
+deploy: true
+processes:
+  web:
+    port: 8080
+repo:
+  url: https://github.com/acme/shop.git
+  preflightPullRequests: true
+  trustedForks: [acme-bot/shop]
+  previews:
+    enabled: true
+    domain: preview.example.com
+`)
+	if err := os.WriteFile(filepath.Join(appDir, "infraspec.yaml"), spec, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// No pipeline: deploying a preview or preflight here would panic.
+	h := &Handler{cfg: &config.Config{AppsDir: appsDir}}
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks/github", nil)
+	rec := httptest.NewRecorder()
+	delivery := &model.WebhookDelivery{}
+	h.pullRequestWebhook(rec, req, "github", []byte(forkPullRequest), delivery)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var got struct {
+		Ignored bool   `json:"ignored"`
+		Fork    string `json:"fork"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Ignored || got.Fork != "mallory/shop" {
+		t.Fatalf("response = %+v, want the fork ignored", got)
+	}
+	if delivery.Payload["headRepository"] != "mallory/shop" {
+		t.Fatalf("delivery payload = %v", delivery.Payload)
+	}
+}
+
+func TestPullRequestEventFork(t *testing.T) {
+	cases := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{name: "same repository", payload: `{"pull_request":{"head":{"repo":{"full_name":"Acme/Shop"}}},"repository":{"full_name":"acme/shop"}}`, want: ""},
+		{name: "fork", payload: forkPullRequest, want: "mallory/shop"},
+		{name: "deleted fork", payload: `{"pull_request":{"head":{"repo":null}},"repository":{"full_name":"acme/shop"}}`, want: "(deleted fork)"},
+		{name: "unnamed head", payload: `{"pull_request":{"head":{"repo":{}}},"repository":{"full_name":"acme/shop"}}`, want: "(unknown fork)"},
+	}
+	for _, tc := range cases {
+		var event pullRequestEvent
+		if err := json.Unmarshal([]byte(tc.payload), &event); err != nil {
+			t.Fatal(err)
+		}
+		if got := event.fork(); got != tc.want {
+			t.Fatalf("%s: fork = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	trusted := &model.InfraSpec{App: "shop", Repo: &model.RepoSpec{TrustedForks: []string{"Mallory/Shop"}}}
+	other := &model.InfraSpec{App: "admin", Repo: &model.RepoSpec{}}
+	if got := trustingFork([]*model.InfraSpec{trusted, other}, "mallory/shop"); len(got) != 1 || got[0] != trusted {
+		t.Fatalf("trustingFork = %v, want only shop", got)
+	}
+}
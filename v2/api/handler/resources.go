@@ -59,7 +59,9 @@ func (h *Handler) ResourceSuggestions(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 		for i := range usage {
-			u := &usage[i]
+			// Declared resources are the process's own task; sidecars reserve their own.
+			main := usage[i].MainTask()
+			u := &main
 			if existing, ok := usageByGroup[u.TaskGroup]; ok {
 				if u.MemoryUsageBytes > existing.MemoryUsageBytes {
 					existing.MemoryUsageBytes = u.MemoryUsageBytes
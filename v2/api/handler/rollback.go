@@ -1,49 +1,40 @@
 package handler
 
 import (
-	"fmt"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
-
-	"norn/v2/api/model"
 )
 
 func (h *Handler) Rollback(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	ctx := r.Context()
 
-	specs, err := model.DiscoverApps(h.cfg.AppsDir)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, err.Error())
-		return
+	var req struct {
+		Env string `json:"env"` // alias for ?env=
 	}
-	var spec *model.InfraSpec
-	for _, s := range specs {
-		if s.App == id {
-			spec = s
-			break
-		}
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
+	spec := h.appSpec(w, id, requestEnv(r, req.Env))
 	if spec == nil {
-		writeError(w, http.StatusNotFound, fmt.Sprintf("app %s not found", id))
 		return
 	}
 
-	deployments, err := h.db.ListDeployments(ctx, id, 1)
-	if err != nil || len(deployments) == 0 {
+	current, err := h.db.LatestDeployment(ctx, id, spec.HistoryEnvironments())
+	if err != nil {
 		writeError(w, http.StatusNotFound, "no current deployment found")
 		return
 	}
-	current := deployments[0]
 
-	prev, err := h.db.LastSuccessfulDeployment(ctx, id, current.ID)
+	prev, err := h.db.LastSuccessfulDeployment(ctx, id, spec.HistoryEnvironments(), current.ID)
 	if err != nil {
 		writeError(w, http.StatusNotFound, "no previous successful deployment to roll back to")
 		return
 	}
 
-	sagaID := h.pipeline.Rollback(spec, current, prev)
+	sagaID := h.pipeline.Rollback(r.Context(), spec, *current, prev)
 	writeJSON(w, map[string]string{
 		"sagaId":   sagaID,
 		"status":   "queued",
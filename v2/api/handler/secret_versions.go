@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"norn/v2/api/auth"
+	"norn/v2/api/model"
+	"norn/v2/api/pipeline"
+	"norn/v2/api/secrets"
+)
+
+// recordSecretVersion adds a version to an app environment's secret history
+// on behalf of the request's actor.
+func (h *Handler) recordSecretVersion(ctx context.Context, app string, history []string, m *secrets.Manager, action string, before, after map[string]string, restoredFrom int) *model.SecretVersion {
+	return pipeline.RecordSecretVersion(ctx, h.db, app, history, m, action, auth.Actor(ctx, "operator"), before, after, restoredFrom)
+}
+
+// ListSecretVersions lists an app environment's secret history, newest
+// first (?env= selects the environment, ?limit= caps).
+func (h *Handler) ListSecretVersions(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if h.db == nil {
+		writeError(w, http.StatusServiceUnavailable, "database not connected")
+		return
+	}
+	m, env := h.appSecrets(w, r, id)
+	if m == nil {
+		return
+	}
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 {
+			limit = n
+		}
+	}
+	versions, err := h.db.ListSecretVersions(r.Context(), id, env, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if versions == nil {
+		versions = []model.SecretVersion{}
+	}
+	writeJSON(w, versions)
+}
+
+// DiffSecretVersions compares the key sets of two versions (?from=, ?to=),
+// or of one version and the live secrets when to is omitted.
+func (h *Handler) DiffSecretVersions(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if h.db == nil {
+		writeError(w, http.StatusServiceUnavailable, "database not connected")
+		return
+	}
+	m, env := h.appSecrets(w, r, id)
+	if m == nil {
+		return
+	}
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil || from <= 0 {
+		writeError(w, http.StatusBadRequest, "from must be a version number")
+		return
+	}
+	to := 0
+	if s := r.URL.Query().Get("to"); s != "" {
+		if to, err = strconv.Atoi(s); err != nil || to <= 0 {
+			writeError(w, http.StatusBadRequest, "to must be a version number")
+			return
+		}
+	}
+
+	base := h.secretVersion(w, r, id, env, from)
+	if base == nil {
+		return
+	}
+	diff := &model.SecretVersionDiff{App: id, Environment: env[0], From: from, To: to}
+	before, beforeErr := openSecretVersion(base)
+
+	var after map[string]string
+	var afterErr error
+	var afterKeys []string
+	if to == 0 {
+		after, afterErr = m.Snapshot(id)
+		if afterErr != nil {
+			writeError(w, http.StatusBadGateway, afterErr.Error())
+			return
+		}
+		afterKeys = secrets.SortedKeys(after)
+	} else {
+		target := h.secretVersion(w, r, id, env, to)
+		if target == nil {
+			return
+		}
+		after, afterErr = openSecretVersion(target)
+		afterKeys = target.Keys
+	}
+
+	if beforeErr == nil && afterErr == nil {
+		diff.Added, diff.Changed, diff.Removed = secrets.DiffKeys(before, after)
+		diff.ValuesCompared = true
+	} else {
+		// Without both snapshots only the key sets can be compared.
+		diff.Added, diff.Changed, diff.Removed = secrets.DiffKeys(keySet(base.Keys), keySet(afterKeys))
+	}
+	writeJSON(w, diff)
+}
+
+// RollbackSecrets restores the secrets of a prior version as a new version.
+// With {"restart": true}, jobs that carry the secrets in their env are
+// resubmitted so running allocations pick up the restored values.
+func (h *Handler) RollbackSecrets(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req struct {
+		Restart bool `json:"restart"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if h.db == nil {
+		writeError(w, http.StatusServiceUnavailable, "database not connected")
+		return
+	}
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil || version <= 0 {
+		writeError(w, http.StatusBadRequest, "version must be a positive number")
+		return
+	}
+	m, env := h.appSecrets(w, r, id)
+	if m == nil {
+		return
+	}
+	var spec *model.InfraSpec
+	if req.Restart {
+		if spec = h.appSpec(w, id, r.URL.Query().Get("env")); spec == nil {
+			return
+		}
+	}
+
+	v := h.secretVersion(w, r, id, env, version)
+	if v == nil {
+		return
+	}
+	if !v.Restorable {
+		writeError(w, http.StatusConflict, fmt.Sprintf("version %d kept only key names; the API had no age key to encrypt its values to", version))
+		return
+	}
+	data, err := openSecretVersion(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("decrypt version %d: %v", version, err))
+		return
+	}
+	before, err := m.Snapshot(id)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	if err := m.Replace(id, data); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	restored := h.recordSecretVersion(r.Context(), id, env, m, model.SecretVersionRollback, before, data, version)
+
+	added, changed, removed := secrets.DiffKeys(before, data)
+	resp := map[string]interface{}{
+		"status":       "rolled back",
+		"restoredFrom": version,
+		"added":        added,
+		"changed":      changed,
+		"removed":      removed,
+	}
+	if restored != nil {
+		resp["version"] = restored.Version
+	}
+	if req.Restart {
+		resp["restart"] = h.restartForSecrets(r.Context(), spec, m, len(added)+len(changed)+len(removed) > 0)
+	}
+	writeJSON(w, resp)
+}
+
+// restartForSecrets gets changed secrets to running allocations. Templated
+// backends restart their tasks themselves when the template re-renders; SOPS
+// secrets are baked into the job, so drifted jobs are resubmitted.
+func (h *Handler) restartForSecrets(ctx context.Context, spec *model.InfraSpec, m *secrets.Manager, changed bool) map[string]interface{} {
+	switch {
+	case !changed:
+		return map[string]interface{}{"skipped": "no secret values changed"}
+	case m.Templated():
+		return map[string]interface{}{"skipped": "tasks re-render their secrets template and restart on their own"}
+	case h.pipeline == nil:
+		return map[string]interface{}{"skipped": "pipeline not configured"}
+	}
+	report, err := h.pipeline.ApplyDrift(ctx, spec)
+	if err != nil {
+		return map[string]interface{}{"skipped": err.Error()}
+	}
+	return map[string]interface{}{
+		"jobId":   report.JobID,
+		"applied": report.Applied,
+		"skipped": report.Skipped,
+		"sagaId":  report.SagaID,
+	}
+}
+
+// secretVersion loads one version, writing a 404 when it doesn't exist.
+func (h *Handler) secretVersion(w http.ResponseWriter, r *http.Request, id string, env []string, version int) *model.SecretVersion {
+	v, err := h.db.GetSecretVersion(r.Context(), id, env, version)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil
+	}
+	if v == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("app %s has no secrets version %d", id, version))
+		return nil
+	}
+	return v
+}
+
+func openSecretVersion(v *model.SecretVersion) (map[string]string, error) {
+	if !v.Restorable {
+		return nil, fmt.Errorf("version %d has no snapshot", v.Version)
+	}
+	return secrets.Open(v.Snapshot)
+}
+
+// keySet stands in for secrets whose values are unknown: every key maps to
+// the same value, so DiffKeys reports no changes.
+func keySet(keys []string) map[string]string {
+	out := make(map[string]string, len(keys))
+	for _, k := range keys {
+		out[k] = ""
+	}
+	return out
+}
+
+func copyStrings(in map[string]string) map[string]string {
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
@@ -3,12 +3,14 @@ package handler
 import (
 	"fmt"
 	"net/http"
+	"os"
 	"sort"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
 
 	"norn/v2/api/model"
+	"norn/v2/api/secrets"
 )
 
 type SecretStatus struct {
@@ -35,11 +37,51 @@ type SecretMigrationItem struct {
 	Declared  bool   `json:"declared"`
 	Encrypted bool   `json:"encrypted"`
 	Action    string `json:"action"`
+	// Source and Target are set on secretsBackend items: keys still in the
+	// SOPS file of an app that moved to another backend.
+	Source string `json:"source,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+// SecretBackendMigration reports a copy of an app's secrets from one
+// backend to the one its infraspec declares. Values are never included.
+type SecretBackendMigration struct {
+	App    string `json:"app"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	DryRun bool   `json:"dryRun"`
+	secrets.CopyResult
+}
+
+// appSecrets returns the secrets manager for the backend and ?env=
+// environment of app id, or the default environment's when none is given,
+// and the environment's names for its version history.
+func (h *Handler) appSecrets(w http.ResponseWriter, r *http.Request, id string) (*secrets.Manager, []string) {
+	env := r.URL.Query().Get("env")
+	if env == "" {
+		specs, _ := model.DiscoverApps(h.cfg.AppsDir)
+		for _, s := range specs {
+			if s.App == id {
+				spec, _ := s.ForEnvironment("")
+				return h.secrets.For(spec), spec.HistoryEnvironments()
+			}
+		}
+		return h.secrets, []string{""}
+	}
+	spec := h.appSpec(w, id, env)
+	if spec == nil {
+		return nil, nil
+	}
+	return h.secrets.For(spec), spec.HistoryEnvironments()
 }
 
 func (h *Handler) ListSecrets(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
-	keys, err := h.secrets.List(id)
+	m, _ := h.appSecrets(w, r, id)
+	if m == nil {
+		return
+	}
+	keys, err := m.List(id)
 	if err != nil {
 		// No secrets file is OK
 		writeJSON(w, []string{})
@@ -111,7 +153,7 @@ func (h *Handler) secretStatus(spec *model.InfraSpec) SecretStatus {
 	declared := normalizeSecretKeys(spec.Secrets)
 	encrypted := []string{}
 	if h.secrets != nil {
-		if keys, err := h.secrets.List(spec.App); err == nil {
+		if keys, err := h.secrets.For(spec).List(spec.App); err == nil {
 			encrypted = keys
 		}
 	}
@@ -208,6 +250,7 @@ func (h *Handler) secretMigrationItems(spec *model.InfraSpec) []SecretMigrationI
 	for process, proc := range spec.Processes {
 		addEnvItems("processes."+process+".env", proc.Env)
 	}
+	items = append(items, h.secretBackendItems(spec, declared)...)
 	sort.Slice(items, func(i, j int) bool {
 		if items[i].App == items[j].App {
 			return items[i].Field < items[j].Field
@@ -251,19 +294,190 @@ func (h *Handler) UpdateSecrets(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	if err := h.secrets.Set(id, updates); err != nil {
+	m, env := h.appSecrets(w, r, id)
+	if m == nil {
+		return
+	}
+	before, err := m.Snapshot(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := m.Set(id, updates); err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	writeJSON(w, map[string]string{"status": "updated"})
+	after := copyStrings(before)
+	for k, v := range updates {
+		after[k] = v
+	}
+	resp := map[string]interface{}{"status": "updated"}
+	if v := h.recordSecretVersion(r.Context(), id, env, m, model.SecretVersionSet, before, after, 0); v != nil {
+		resp["version"] = v.Version
+	}
+	writeJSON(w, resp)
 }
 
 func (h *Handler) DeleteSecret(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	key := chi.URLParam(r, "key")
-	if err := h.secrets.Delete(id, key); err != nil {
+	m, env := h.appSecrets(w, r, id)
+	if m == nil {
+		return
+	}
+	before, err := m.Snapshot(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := m.Delete(id, key); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	after := copyStrings(before)
+	delete(after, key)
+	resp := map[string]interface{}{"status": "deleted"}
+	if v := h.recordSecretVersion(r.Context(), id, env, m, model.SecretVersionDelete, before, after, 0); v != nil {
+		resp["version"] = v.Version
+	}
+	writeJSON(w, resp)
+}
+
+func (h *Handler) RotateSecretKeys(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req struct {
+		Recipients []string `json:"recipients"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	m, _ := h.appSecrets(w, r, id)
+	if m == nil {
+		return
+	}
+	recipients, err := m.RotateKeys(id, req.Recipients)
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("app %s has no secrets file", id))
+			return
+		}
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	writeJSON(w, map[string]string{"status": "deleted"})
+	writeJSON(w, map[string]interface{}{"status": "rotated", "recipients": recipients})
+}
+
+// secretBackendItems lists keys left in the SOPS file of an app whose
+// infraspec moved its secrets to Nomad Variables or Vault.
+func (h *Handler) secretBackendItems(spec *model.InfraSpec, declared map[string]bool) []SecretMigrationItem {
+	if h.secrets == nil || !spec.SecretsTemplated() {
+		return nil
+	}
+	file := h.secrets.WithFile(spec.SecretsFile())
+	legacy, err := file.Get(spec.App)
+	if err != nil || len(legacy) == 0 {
+		return nil
+	}
+	backend := h.secrets.For(spec)
+	current, _ := backend.Get(spec.App)
+	source, target := file.Location(spec.App), backend.Location(spec.App)
+	items := make([]SecretMigrationItem, 0, len(legacy))
+	for key, value := range legacy {
+		existing, ok := current[key]
+		item := SecretMigrationItem{
+			App:       spec.App,
+			Field:     "secretsBackend",
+			Key:       key,
+			Declared:  declared[key],
+			Encrypted: ok,
+			Source:    source,
+			Target:    target,
+			Action:    "copy to " + target + " with norn secrets migrate --backend",
+		}
+		switch {
+		case ok && existing == value:
+			item.Action = "already in " + target + "; remove from " + spec.SecretsFile()
+		case ok:
+			item.Action = "value differs in " + target + "; copy with --overwrite or reconcile by hand"
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func (h *Handler) MigrateSecrets(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req struct {
+		From      model.SecretsBackend `json:"from"`
+		Overwrite bool                 `json:"overwrite"`
+		DryRun    bool                 `json:"dryRun"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if h.secrets == nil {
+		writeError(w, http.StatusServiceUnavailable, "secrets manager not configured")
+		return
+	}
+	spec := h.appSpec(w, id, r.URL.Query().Get("env"))
+	if spec == nil {
+		return
+	}
+
+	// The source resolves paths the way the spec would if it declared the
+	// source backend, so --from nomad finds nomad/jobs/<job> by default.
+	from := req.From
+	switch from.Type {
+	case "":
+		from.Type = model.SecretsBackendSOPS
+	case model.SecretsBackendSOPS, model.SecretsBackendNomad, model.SecretsBackendVault:
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown secrets backend %q (want sops, nomad or vault)", from.Type))
+		return
+	}
+	if strings.Contains(from.Path, "..") {
+		writeError(w, http.StatusBadRequest, "path must not contain ..")
+		return
+	}
+	source := *spec
+	source.SecretsBackend = &from
+	target := secrets.TargetFor(&source)
+	if from.Type == model.SecretsBackendSOPS && from.Path != "" {
+		if strings.ContainsAny(from.Path, `/\`) {
+			writeError(w, http.StatusBadRequest, "a sops source path names a file in the app directory")
+			return
+		}
+		target.File = from.Path
+	}
+	src := h.secrets.At(target)
+	dst := h.secrets.For(spec)
+
+	before, err := dst.Snapshot(id)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	result, err := dst.Copy(id, src, req.Overwrite, req.DryRun)
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !req.DryRun && len(result.Copied)+len(result.Overwritten) > 0 {
+		if after, err := dst.Snapshot(id); err == nil {
+			h.recordSecretVersion(r.Context(), id, spec.HistoryEnvironments(), dst, model.SecretVersionMigrate, before, after, 0)
+		}
+	}
+	writeJSON(w, SecretBackendMigration{
+		App:        id,
+		From:       src.Location(id),
+		To:         dst.Location(id),
+		DryRun:     req.DryRun,
+		CopyResult: *result,
+	})
 }
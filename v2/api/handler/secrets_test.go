@@ -9,7 +9,10 @@ import (
 	"strings"
 	"testing"
 
+	"filippo.io/age"
+
 	"norn/v2/api/config"
+	"norn/v2/api/secrets"
 )
 
 func TestSecretsMigrationPlanReportsPlainEnvKeysWithoutValues(t *testing.T) {
@@ -74,6 +77,79 @@ func TestSecretsMigrationPlanMissingAppReturns404(t *testing.T) {
 	}
 }
 
+type memoryVariables map[string]map[string]string
+
+func (m memoryVariables) ReadVariable(path string) (map[string]string, error) {
+	return m[path], nil
+}
+
+func (m memoryVariables) WriteVariable(path string, items map[string]string) error {
+	m[path] = items
+	return nil
+}
+
+func TestMigrateSecretsCopiesSOPSFileIntoNomadVariables(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOPS_AGE_KEY", id.String())
+	appsDir := t.TempDir()
+	appDir := filepath.Join(appsDir, "web")
+	if err := os.MkdirAll(appDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	spec := "name: web\ndeploy: true\nsecretsBackend:\n  type: nomad\nprocesses:\n  web:\n    port: 8080\n"
+	if err := os.WriteFile(filepath.Join(appDir, "infraspec.yaml"), []byte(spec), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(appDir, ".sops.yaml"), []byte("creation_rules:\n  - age: "+id.Recipient().String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	vars := memoryVariables{"nomad/jobs/web": {"KEEP": "mine"}}
+	sec := secrets.NewManager(appsDir)
+	sec.UseNomad(vars)
+	if err := sec.Set("web", map[string]string{"TOKEN": "hunter2", "KEEP": "theirs"}); err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{cfg: &config.Config{AppsDir: appsDir}, secrets: sec}
+
+	migrate := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/apps/web/secrets/migrate", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		h.MigrateSecrets(rec, withAppID(req, "web"))
+		return rec
+	}
+
+	rec := migrate(`{"dryRun":true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d body=%s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "hunter2") {
+		t.Fatalf("migration response leaked a secret value: %s", rec.Body.String())
+	}
+	var result SecretBackendMigration
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.To != "nomad var nomad/jobs/web" || len(result.Copied) != 1 || len(result.Conflicts) != 1 {
+		t.Fatalf("dry run = %+v", result)
+	}
+	if _, ok := vars["nomad/jobs/web"]["TOKEN"]; ok {
+		t.Fatal("dry run wrote to the variable")
+	}
+
+	if rec := migrate(`{}`); rec.Code != http.StatusOK || vars["nomad/jobs/web"]["TOKEN"] != "hunter2" || vars["nomad/jobs/web"]["KEEP"] != "mine" {
+		t.Fatalf("status = %d, variable = %v", rec.Code, vars["nomad/jobs/web"])
+	}
+	if rec := migrate(`{"from":{"type":"consul"}}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown backend: status = %d", rec.Code)
+	}
+	if rec := migrate(`{"from":{"type":"sops","path":"secrets.qa.enc.yaml"}}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("missing source: status = %d body=%s", rec.Code, rec.Body.String())
+	}
+}
+
 func containsAny(value string, needles ...string) bool {
 	for _, needle := range needles {
 		if strings.Contains(value, needle) {
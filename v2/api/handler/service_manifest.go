@@ -51,6 +51,9 @@ func (h *Handler) buildServiceManifest() (model.ServiceManifest, error) {
 				Metadata: serviceMetadata(spec.App, processName, serviceName),
 			}
 			entry.Metadata["networkMode"] = h.cfg.NetworkMode
+			if process.Mesh != nil {
+				entry.Metadata["mesh"] = "connect"
+			}
 			entry.Metadata["instanceScope"] = "none"
 			if processType == "service" {
 				entry.Endpoints = usableEndpoints(spec.Endpoints)
@@ -89,6 +92,7 @@ func (h *Handler) buildServiceManifest() (model.ServiceManifest, error) {
 			manifest.Services = append(manifest.Services, entry)
 		}
 	}
+	manifest.Graph = h.serviceGraph(specs, manifest.Services)
 
 	return manifest, nil
 }
@@ -9,13 +9,21 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"norn/v2/api/auth"
 )
 
+// signedTokenPrefix starts the jti of every signed access token.
+const signedTokenPrefix = "norn_"
+
 type tokenClaims struct {
 	Sub string `json:"sub"`
 	Exp int64  `json:"exp"`
 	Iat int64  `json:"iat"`
 	Jti string `json:"jti"`
+	// Usr and Role carry the minting identity; tokens without them predate RBAC.
+	Usr  string `json:"usr,omitempty"`
+	Role string `json:"role,omitempty"`
 }
 
 func signToken(secret string, claims tokenClaims) (string, error) {
@@ -61,6 +69,7 @@ func (h *Handler) CreateAccessToken(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		TTL  string `json:"ttl"`
 		Note string `json:"note"`
+		Role string `json:"role"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid request body")
@@ -79,12 +88,32 @@ func (h *Handler) CreateAccessToken(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "ttl must not exceed 72h")
 		return
 	}
+	caller := auth.FromContext(r.Context())
+	if len(caller.Apps) > 0 {
+		writeError(w, http.StatusForbidden, "app-scoped tokens cannot mint access tokens")
+		return
+	}
+	role := caller.Role
+	if req.Role != "" {
+		parsed, err := auth.ParseRole(req.Role)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		role = parsed
+	}
+	if !caller.Role.Allows(role) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("cannot create a %s token with a %s role", role, caller.Role))
+		return
+	}
 	now := time.Now().UTC()
 	claims := tokenClaims{
-		Sub: req.Note,
-		Iat: now.Unix(),
-		Exp: now.Add(ttl).Unix(),
-		Jti: fmt.Sprintf("norn_%d", now.UnixNano()),
+		Sub:  req.Note,
+		Iat:  now.Unix(),
+		Exp:  now.Add(ttl).Unix(),
+		Jti:  fmt.Sprintf("%s%d", signedTokenPrefix, now.UnixNano()),
+		Usr:  caller.User,
+		Role: string(role),
 	}
 	token, err := signToken(h.cfg.APIToken, claims)
 	if err != nil {
@@ -96,13 +125,7 @@ func (h *Handler) CreateAccessToken(w http.ResponseWriter, r *http.Request) {
 		"token":     token,
 		"expiresAt": now.Add(ttl).Format(time.RFC3339),
 		"note":      req.Note,
+		"role":      role,
+		"id":        claims.Jti,
 	})
 }
-
-func (h *Handler) VerifyAccessToken(token string) bool {
-	if h.cfg.APIToken == "" {
-		return false
-	}
-	_, err := verifyToken(h.cfg.APIToken, token)
-	return err == nil
-}
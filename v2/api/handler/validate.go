@@ -16,12 +16,10 @@ func (h *Handler) ValidateAll(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	opts := h.validationOptions(r, specs...)
 	var results []model.ValidationResult
 	for _, spec := range specs {
-		results = append(results, *model.ValidateSpecWithOptions(spec, model.ValidationOptions{
-			NetworkMode:   h.cfg.NetworkMode,
-			StrictSecrets: r.URL.Query().Get("strictSecrets") == "true",
-		}))
+		results = append(results, *model.ValidateSpecWithOptions(spec, opts))
 	}
 	writeJSON(w, results)
 }
@@ -37,13 +35,43 @@ func (h *Handler) ValidateApp(w http.ResponseWriter, r *http.Request) {
 
 	for _, spec := range specs {
 		if spec.App == id {
-			writeJSON(w, model.ValidateSpecWithOptions(spec, model.ValidationOptions{
-				NetworkMode:   h.cfg.NetworkMode,
-				StrictSecrets: r.URL.Query().Get("strictSecrets") == "true",
-			}))
+			writeJSON(w, model.ValidateSpecWithOptions(spec, h.validationOptions(r, spec)))
 			return
 		}
 	}
 
 	writeError(w, http.StatusNotFound, fmt.Sprintf("app %s not found", id))
 }
+
+// validationOptions checks placement against the live node inventory when
+// any of specs declares placement and Nomad is reachable; otherwise only the
+// spec itself is validated.
+func (h *Handler) validationOptions(r *http.Request, specs ...*model.InfraSpec) model.ValidationOptions {
+	opts := model.ValidationOptions{
+		NetworkMode:   h.cfg.NetworkMode,
+		StrictSecrets: r.URL.Query().Get("strictSecrets") == "true",
+	}
+	if h.nomad == nil || !declaresPlacement(specs) {
+		return opts
+	}
+	nodes, err := h.nomad.NodeInventory()
+	if err != nil {
+		return opts
+	}
+	opts.Nodes = make([]model.PlacementNode, 0, len(nodes))
+	for _, n := range nodes {
+		opts.Nodes = append(opts.Nodes, n.PlacementNode())
+	}
+	return opts
+}
+
+func declaresPlacement(specs []*model.InfraSpec) bool {
+	for _, spec := range specs {
+		for _, proc := range spec.Processes {
+			if proc.Placement != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"norn/v2/api/model"
+	"norn/v2/api/nomad"
+)
+
+// volumeReleaseTimeout bounds how long a purging teardown waits for the
+// stopped job's allocations to drop their volume claims.
+const volumeReleaseTimeout = 90 * time.Second
+
+type platformVolumeStatus struct {
+	App   string `json:"app"`
+	Mount string `json:"mount"`
+	Size  string `json:"size,omitempty"`
+	nomad.VolumeStatus
+	// UsedBytes is measured when the volume's host path is on Norn's node.
+	UsedBytes      *int64 `json:"usedBytes,omitempty"`
+	Snapshots      int    `json:"snapshots"`
+	LatestSnapshot string `json:"latestSnapshot,omitempty"`
+}
+
+// summarizeVolumes reports the managed volumes of spec's default job.
+func (h *Handler) summarizeVolumes(spec *model.InfraSpec) ([]platformVolumeStatus, []string) {
+	if h.nomad == nil {
+		return nil, nil
+	}
+	var out []platformVolumeStatus
+	var warnings []string
+	for _, vol := range model.ManagedVolumes(spec) {
+		status, err := h.nomad.LookupVolume(spec.JobID(), vol)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("volume %s/%s: %v", spec.App, vol.Name, err))
+			continue
+		}
+		entry := platformVolumeStatus{
+			App:          spec.App,
+			Mount:        vol.Mount,
+			Size:         vol.Size,
+			VolumeStatus: *status,
+		}
+		if used, ok := dirUsage(status.HostPath); ok {
+			entry.UsedBytes = &used
+			if status.CapacityBytes > 0 && used*10 > status.CapacityBytes*9 {
+				warnings = append(warnings, fmt.Sprintf("volume over 90%% full: %s/%s", spec.App, vol.Name))
+			}
+		}
+		if status.State == "unavailable" {
+			warnings = append(warnings, fmt.Sprintf("volume unavailable: %s/%s", spec.App, vol.Name))
+		}
+		archives := listVolumeSnapshots(status.Source)
+		entry.Snapshots = len(archives)
+		if len(archives) > 0 {
+			entry.LatestSnapshot = archives[0]
+		}
+		out = append(out, entry)
+	}
+	return out, warnings
+}
+
+// dirUsage sums the sizes of the regular files under dir. ok is false when
+// dir is not on this node.
+func dirUsage(dir string) (int64, bool) {
+	if dir == "" {
+		return 0, false
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return 0, false
+	}
+	var total int64
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, true
+}
+
+// listVolumeSnapshots returns the volume's archives in snapshots/, newest
+// first.
+func listVolumeSnapshots(source string) []string {
+	entries, err := os.ReadDir("snapshots")
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, source+"_") || !strings.HasSuffix(name, ".tar.gz") {
+			continue
+		}
+		// A volume named like another's prefix, e.g. app-data and app-data_x,
+		// must not match: the rest is <sha>_<timestamp>.
+		if strings.Count(strings.TrimPrefix(name, source+"_"), "_") != 1 {
+			continue
+		}
+		out = append(out, name)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return snapshotArchiveTimestamp(out[i]) > snapshotArchiveTimestamp(out[j])
+	})
+	return out
+}
+
+func snapshotArchiveTimestamp(name string) string {
+	stem := strings.TrimSuffix(name, ".tar.gz")
+	return stem[strings.LastIndex(stem, "_")+1:]
+}
+
+// teardownJobIDs are the jobs of the app's environments, whose managed
+// volumes a teardown covers. Previews are torn down on their own.
+func teardownJobIDs(spec *model.InfraSpec) []string {
+	ids := []string{spec.App}
+	seen := map[string]bool{spec.App: true}
+	for _, name := range spec.EnvironmentNames() {
+		env, err := spec.ForEnvironment(name)
+		if err != nil || seen[env.JobID()] {
+			continue
+		}
+		seen[env.JobID()] = true
+		ids = append(ids, env.JobID())
+	}
+	return ids
+}
+
+// attachedVolumes returns the app's managed volumes that Nomad has, for
+// every job teardown covers.
+func (h *Handler) attachedVolumes(spec *model.InfraSpec) ([]*nomad.VolumeStatus, error) {
+	var out []*nomad.VolumeStatus
+	for _, jobID := range teardownJobIDs(spec) {
+		volumes, err := h.nomad.AppVolumes(jobID, spec)
+		if err != nil {
+			return nil, err
+		}
+		for _, status := range volumes {
+			if status.State != nomad.VolumeMissing {
+				out = append(out, status)
+			}
+		}
+	}
+	return out, nil
+}
+
+// purgeVolumes stops the app's service and periodic jobs, waits for their
+// claims to drop and deletes the volumes.
+func (h *Handler) purgeVolumes(ctx context.Context, spec *model.InfraSpec, volumes []*nomad.VolumeStatus) ([]string, error) {
+	for _, jobID := range teardownJobIDs(spec) {
+		jobs := []string{jobID}
+		for procName, proc := range spec.Processes {
+			if proc.Schedule != "" {
+				jobs = append(jobs, jobID+"-"+procName)
+			}
+		}
+		for _, job := range jobs {
+			if err := h.nomad.StopJob(job, true); err != nil && !strings.Contains(err.Error(), "not found") {
+				return nil, fmt.Errorf("stop %s: %w", job, err)
+			}
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, volumeReleaseTimeout)
+	defer cancel()
+	var deleted []string
+	for _, status := range volumes {
+		if err := h.nomad.WaitVolumeReleased(ctx, status); err != nil {
+			return deleted, err
+		}
+		if err := h.nomad.DeleteVolume(status); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, status.Source)
+	}
+	return deleted, nil
+}
+
+func volumeSources(volumes []*nomad.VolumeStatus) []string {
+	sources := make([]string, len(volumes))
+	for i, status := range volumes {
+		sources[i] = status.Source
+	}
+	return sources
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"norn/v2/api/config"
+	"norn/v2/api/nomad"
+)
+
+func TestTeardownRefusesVolumeDataUnlessPurged(t *testing.T) {
+	appsDir := t.TempDir()
+	appDir := filepath.Join(appsDir, "wiki")
+	if err := os.Mkdir(appDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	spec := []byte(`
+name: wiki
+deploy: true
+processes:
+  web:
+    port: 8080
+  reindex:
+    command: ./reindex
+    schedule: "0 3 * * *"
+volumes:
+  - name: uploads
+    mount: /uploads
+    size: 1GiB
+  - name: config
+    mount: /etc/wiki
+`)
+	if err := os.WriteFile(filepath.Join(appDir, "infraspec.yaml"), spec, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	hostPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(hostPath, "page.md"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("X-Nomad-Index", "1")
+		w.Header().Set("X-Nomad-KnownLeader", "true")
+		w.Header().Set("X-Nomad-LastContact", "0")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/volumes":
+			w.Write([]byte(`[{"ID":"vol-1","Name":"wiki-uploads"},{"ID":"vol-2","Name":"other-uploads"}]`))
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/volume/host/vol-1":
+			json.NewEncoder(w).Encode(map[string]any{"ID": "vol-1", "Name": "wiki-uploads", "State": "ready", "HostPath": hostPath, "CapacityBytes": 1 << 30})
+		case r.Method == http.MethodDelete:
+			w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	client, err := nomad.NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{cfg: &config.Config{AppsDir: appsDir}, nomad: client}
+
+	rec := httptest.NewRecorder()
+	h.Teardown(rec, withAppID(httptest.NewRequest(http.MethodPost, "/api/apps/wiki/teardown", strings.NewReader(`{}`)), "wiki"))
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "wiki-uploads") {
+		t.Fatalf("teardown without purge = %d %s", rec.Code, rec.Body.String())
+	}
+	for _, call := range calls {
+		if strings.HasPrefix(call, http.MethodDelete) {
+			t.Fatalf("refused teardown deleted something: %v", calls)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	h.Teardown(rec, withAppID(httptest.NewRequest(http.MethodPost, "/api/apps/wiki/teardown", strings.NewReader(`{"purgeVolumes":true}`)), "wiki"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("teardown with purge = %d %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Status         string   `json:"status"`
+		VolumesDeleted []string `json:"volumesDeleted"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "torn_down" || strings.Join(resp.VolumesDeleted, ",") != "wiki-uploads" {
+		t.Fatalf("resp = %+v", resp)
+	}
+	joined := strings.Join(calls, "\n")
+	for _, want := range []string{"DELETE /v1/job/wiki", "DELETE /v1/job/wiki-reindex", "DELETE /v1/volume/host/vol-1"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("calls missing %q:\n%s", want, joined)
+		}
+	}
+
+	volumes, warnings := h.summarizeVolumes(h.findSpec("wiki"))
+	if len(warnings) != 0 || len(volumes) != 1 {
+		t.Fatalf("volumes = %+v warnings = %v", volumes, warnings)
+	}
+	if v := volumes[0]; v.Source != "wiki-uploads" || v.State != "ready" || v.UsedBytes == nil || *v.UsedBytes != 5 {
+		t.Fatalf("volume = %+v", v)
+	}
+}
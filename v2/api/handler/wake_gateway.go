@@ -3,19 +3,21 @@ package handler
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"norn/v2/api/hub"
 	"norn/v2/api/model"
 	"norn/v2/api/store"
 )
@@ -112,11 +114,25 @@ func (h *Handler) serveWakeGatewayTarget(w http.ResponseWriter, r *http.Request,
 	}()
 
 	timeout := wakeGatewayTimeout(r)
+	interstitial := h.wakePage != nil && wantsWakeInterstitial(r)
+	if interstitial && timeout > wakeInterstitialDelay {
+		timeout = wakeInterstitialDelay
+	}
 	ctx, cancel := context.WithTimeout(r.Context(), timeout)
 	defer cancel()
 
-	instance, woke, err := h.ensureWakeGatewayReady(ctx, target)
-	if err != nil {
+	instance, woke, err := h.awaitWakeGatewayTarget(ctx, target)
+	switch {
+	case errors.Is(err, errWakeQueueFull):
+		status = http.StatusServiceUnavailable
+		w.Header().Set("Retry-After", "5")
+		writeError(w, status, fmt.Sprintf("%s/%s is waking up and its request queue is full", target.App, target.Process))
+		return
+	case err != nil && interstitial && woke:
+		status = http.StatusServiceUnavailable
+		h.writeWakeInterstitial(w, r, target)
+		return
+	case err != nil:
 		status = http.StatusGatewayTimeout
 		w.Header().Set("Retry-After", "5")
 		writeError(w, status, err.Error())
@@ -143,7 +159,7 @@ func (h *Handler) serveWakeGatewayTarget(w http.ResponseWriter, r *http.Request,
 		out.URL.RawPath = ""
 		out.URL.RawQuery = query.Encode()
 		out.Host = r.Host
-		if ip := clientIP(r); ip != "" {
+		if ip := h.clientIP(r); ip != "" {
 			if prior := out.Header.Get("X-Forwarded-For"); prior != "" {
 				out.Header.Set("X-Forwarded-For", prior+", "+ip)
 			} else {
@@ -182,33 +198,32 @@ func (h *Handler) serveWakeGatewayTarget(w http.ResponseWriter, r *http.Request,
 	proxy.ServeHTTP(w, r)
 }
 
-func (h *Handler) ensureWakeGatewayReady(ctx context.Context, target wakeGatewayTarget) (model.ServiceInstance, bool, error) {
-	key := target.App + "\x00" + target.Process
-	lock := h.wakeGatewayLock(key)
-	lock.Lock()
-	defer lock.Unlock()
-
+// wakeGatewayTarget scales target up from zero and waits for a ready
+// instance. It runs once per cold start, shared by every request held for
+// it through the wake queue.
+func (h *Handler) wakeGatewayTarget(ctx context.Context, target wakeGatewayTarget) (model.ServiceInstance, error) {
 	if manifest, err := h.buildServiceManifest(); err == nil {
 		if refreshed, ok := wakeGatewayTargetForHost(manifest.Services, target.Key); ok {
 			target = refreshed
 		}
 	}
 	if instance, ok := firstReadyInstance(target.Service); ok {
-		return instance, false, nil
-	}
-	if h.nomad == nil {
-		return model.ServiceInstance{}, false, fmt.Errorf("nomad is not connected and %s/%s has no ready instance", target.App, target.Process)
+		return instance, nil
 	}
 	if err := h.nomad.ScaleJob(target.App, target.Process, 1); err != nil {
-		return model.ServiceInstance{}, false, fmt.Errorf("scale %s/%s to 1: %w", target.App, target.Process, err)
+		return model.ServiceInstance{}, fmt.Errorf("scale %s/%s to 1: %w", target.App, target.Process, err)
 	}
+	started := time.Now()
 
 	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
-			return model.ServiceInstance{}, true, fmt.Errorf("timeout waiting for %s/%s to wake", target.App, target.Process)
+			err := fmt.Errorf("timeout waiting for %s/%s to wake", target.App, target.Process)
+			h.wakeStats.coldStart(target, "timeout", time.Since(started))
+			h.recordWakeGatewayWake(target, time.Since(started), err)
+			return model.ServiceInstance{}, err
 		case <-ticker.C:
 			manifest, err := h.buildServiceManifest()
 			if err != nil {
@@ -219,15 +234,57 @@ func (h *Handler) ensureWakeGatewayReady(ctx context.Context, target wakeGateway
 				continue
 			}
 			if instance, ok := firstReadyInstance(refreshed.Service); ok {
-				return instance, true, nil
+				h.wakeStats.coldStart(target, "ready", time.Since(started))
+				h.recordWakeGatewayWake(target, time.Since(started), nil)
+				return instance, nil
 			}
 		}
 	}
 }
 
-func (h *Handler) wakeGatewayLock(key string) *sync.Mutex {
-	actual, _ := h.wakeLocks.LoadOrStore(key, &sync.Mutex{})
-	return actual.(*sync.Mutex)
+// recordWakeGatewayWake adds a wake to the process's sleep/wake history and
+// raises a beacon event for it. wakeErr is set when no instance became
+// ready in time; the process keeps starting regardless.
+func (h *Handler) recordWakeGatewayWake(target wakeGatewayTarget, coldStart time.Duration, wakeErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	coldStart = coldStart.Round(100 * time.Millisecond)
+	event := &model.WakeEvent{
+		App:        target.App,
+		Process:    target.Process,
+		Action:     model.WakeActionWake,
+		Reason:     "request for " + target.Endpoint,
+		Actor:      "wake-gateway",
+		DurationMs: coldStart.Milliseconds(),
+	}
+	severity, body := model.BeaconInfo, fmt.Sprintf("Ready after %s.", coldStart)
+	if wakeErr != nil {
+		event.Reason += "; not ready in time"
+		severity, body = model.BeaconWarning, fmt.Sprintf("Not ready after %s: %v", coldStart, wakeErr)
+	}
+	if h.db != nil {
+		if err := h.db.RecordWakeEvent(ctx, event); err != nil {
+			log.Printf("wake gateway: record wake of %s/%s: %v", target.App, target.Process, err)
+		}
+	}
+	h.emitBeacon(ctx, model.BeaconEvent{
+		App:       target.App,
+		Type:      "process.wake",
+		Severity:  severity,
+		Title:     fmt.Sprintf("%s/%s woken by a request", target.App, target.Process),
+		Body:      body,
+		DedupeKey: fmt.Sprintf("%s:%s:wake:%d", target.App, target.Process, time.Now().UnixNano()),
+		Metadata: map[string]interface{}{
+			"process":     target.Process,
+			"endpoint":    target.Endpoint,
+			"coldStartMs": event.DurationMs,
+		},
+	})
+	if h.ws != nil {
+		h.ws.Broadcast(hub.Event{Type: "process.wake", AppID: target.App, Payload: map[string]string{
+			"process": target.Process,
+		}})
+	}
 }
 
 func wakeGatewayTargetForHost(services []model.ServiceManifestEntry, hostname string) (wakeGatewayTarget, bool) {
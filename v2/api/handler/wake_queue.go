@@ -0,0 +1,360 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"norn/v2/api/model"
+)
+
+const (
+	defaultWakeQueueLimit = 100
+	// Browsers wait this long for a wake before getting the interstitial, so
+	// fast cold starts never show it.
+	wakeInterstitialDelay   = 2 * time.Second
+	wakeInterstitialRefresh = 3
+)
+
+var errWakeQueueFull = errors.New("wake queue is full")
+
+// wakeBuckets are the cold-start histogram bounds in seconds.
+var wakeBuckets = []float64{0.5, 1, 2, 5, 10, 20, 30, 60, 120}
+
+// wakeQueue lets concurrent requests for one sleeping target share a single
+// wake. The zero value is ready to use.
+type wakeQueue struct {
+	mu       sync.Mutex
+	limit    int
+	attempts map[string]*wakeAttempt
+}
+
+// wakeAttempt is one cold start. instance and err are set before done is
+// closed.
+type wakeAttempt struct {
+	done     chan struct{}
+	waiters  int
+	instance model.ServiceInstance
+	err      error
+}
+
+// join returns key's wake in progress, starting one with wake when there is
+// none. The wake runs on its own context so it outlives the request that
+// started it. Callers that get an attempt must leave it.
+func (q *wakeQueue) join(key string, wake func(context.Context) (model.ServiceInstance, error)) (*wakeAttempt, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.attempts == nil {
+		q.attempts = map[string]*wakeAttempt{}
+	}
+	limit := q.limit
+	if limit <= 0 {
+		limit = defaultWakeQueueLimit
+	}
+	a := q.attempts[key]
+	if a == nil {
+		a = &wakeAttempt{done: make(chan struct{})}
+		q.attempts[key] = a
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), maxWakeGatewayTimeout)
+			defer cancel()
+			a.instance, a.err = wake(ctx)
+			q.mu.Lock()
+			delete(q.attempts, key)
+			q.mu.Unlock()
+			close(a.done)
+		}()
+	} else if a.waiters >= limit {
+		return nil, errWakeQueueFull
+	}
+	a.waiters++
+	return a, nil
+}
+
+func (q *wakeQueue) leave(a *wakeAttempt) {
+	q.mu.Lock()
+	a.waiters--
+	q.mu.Unlock()
+}
+
+// held returns the number of requests waiting on each waking target.
+func (q *wakeQueue) held() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make(map[string]int, len(q.attempts))
+	for key, a := range q.attempts {
+		out[key] = a.waiters
+	}
+	return out
+}
+
+// wakeStats holds the gateway's in-memory cold-start metrics. The zero
+// value is ready to use.
+type wakeStats struct {
+	mu            sync.Mutex
+	coldStarts    map[string]*histogram
+	waits         map[string]*histogram
+	rejected      map[string]int
+	interstitials map[string]int
+}
+
+type histogram struct {
+	counts []int64 // per bucket in wakeBuckets, not cumulative
+	count  int64
+	sum    float64
+}
+
+func (h *histogram) observe(seconds float64) {
+	if h.counts == nil {
+		h.counts = make([]int64, len(wakeBuckets))
+	}
+	for i, le := range wakeBuckets {
+		if seconds <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// coldStart records how long a wake took; result is ready or timeout.
+func (s *wakeStats) coldStart(target wakeGatewayTarget, result string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.coldStarts == nil {
+		s.coldStarts = map[string]*histogram{}
+	}
+	observeInto(s.coldStarts, wakeStatsKey(target.App, target.Process, result), d)
+}
+
+// wait records how long a request was held for a wake.
+func (s *wakeStats) wait(target wakeGatewayTarget, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.waits == nil {
+		s.waits = map[string]*histogram{}
+	}
+	observeInto(s.waits, wakeStatsKey(target.App, target.Process, ""), d)
+}
+
+func (s *wakeStats) reject(target wakeGatewayTarget) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rejected == nil {
+		s.rejected = map[string]int{}
+	}
+	s.rejected[wakeStatsKey(target.App, target.Process, "")]++
+}
+
+func (s *wakeStats) interstitial(target wakeGatewayTarget) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.interstitials == nil {
+		s.interstitials = map[string]int{}
+	}
+	s.interstitials[wakeStatsKey(target.App, target.Process, "")]++
+}
+
+func observeInto(m map[string]*histogram, key string, d time.Duration) {
+	h := m[key]
+	if h == nil {
+		h = &histogram{}
+		m[key] = h
+	}
+	h.observe(d.Seconds())
+}
+
+func wakeStatsKey(app, process, result string) string {
+	return app + "\x00" + process + "\x00" + result
+}
+
+func splitWakeStatsKey(key string) (app, process, result string) {
+	parts := strings.SplitN(key, "\x00", 3)
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	return parts[0], parts[1], parts[2]
+}
+
+// write renders the gateway metrics in Prometheus text format.
+func (s *wakeStats) write(b *bytes.Buffer, held map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeMetricHeader(b, "norn_wake_cold_start_seconds", "Time from scaling a sleeping process up to its first ready instance, by result.", "histogram")
+	for _, key := range sortedHistogramKeys(s.coldStarts) {
+		app, process, result := splitWakeStatsKey(key)
+		writeHistogram(b, "norn_wake_cold_start_seconds", fmt.Sprintf("app=%q,process=%q,result=%q", promLabel(app), promLabel(process), promLabel(result)), s.coldStarts[key])
+	}
+	writeMetricHeader(b, "norn_wake_request_wait_seconds", "Time requests were held by the wake gateway for a cold start.", "histogram")
+	for _, key := range sortedHistogramKeys(s.waits) {
+		app, process, _ := splitWakeStatsKey(key)
+		writeHistogram(b, "norn_wake_request_wait_seconds", fmt.Sprintf("app=%q,process=%q", promLabel(app), promLabel(process)), s.waits[key])
+	}
+	writeMetricHeader(b, "norn_wake_requests_rejected_total", "Requests turned away because the target's wake queue was full.", "counter")
+	for _, key := range sortedKeys(s.rejected) {
+		app, process, _ := splitWakeStatsKey(key)
+		fmt.Fprintf(b, "norn_wake_requests_rejected_total{app=%q,process=%q} %d\n", promLabel(app), promLabel(process), s.rejected[key])
+	}
+	writeMetricHeader(b, "norn_wake_interstitials_total", "Waking-up pages served to browsers during a cold start.", "counter")
+	for _, key := range sortedKeys(s.interstitials) {
+		app, process, _ := splitWakeStatsKey(key)
+		fmt.Fprintf(b, "norn_wake_interstitials_total{app=%q,process=%q} %d\n", promLabel(app), promLabel(process), s.interstitials[key])
+	}
+	writeMetricHeader(b, "norn_wake_requests_held", "Requests currently held for a cold start.", "gauge")
+	for _, key := range sortedKeys(held) {
+		app, process, _ := splitWakeStatsKey(key)
+		fmt.Fprintf(b, "norn_wake_requests_held{app=%q,process=%q} %d\n", promLabel(app), promLabel(process), held[key])
+	}
+}
+
+func writeHistogram(b *bytes.Buffer, name, labels string, h *histogram) {
+	var cumulative int64
+	for i, le := range wakeBuckets {
+		if h.counts != nil {
+			cumulative += h.counts[i]
+		}
+		fmt.Fprintf(b, "%s_bucket{%s,le=%q} %d\n", name, labels, strconv.FormatFloat(le, 'f', -1, 64), cumulative)
+	}
+	fmt.Fprintf(b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	fmt.Fprintf(b, "%s_sum{%s} %.3f\n", name, labels, h.sum)
+	fmt.Fprintf(b, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+func sortedHistogramKeys(m map[string]*histogram) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// awaitWakeGatewayTarget returns a ready instance for target, holding the
+// request on the target's shared wake until ctx is done. woke reports that
+// the request waited for a cold start.
+func (h *Handler) awaitWakeGatewayTarget(ctx context.Context, target wakeGatewayTarget) (model.ServiceInstance, bool, error) {
+	if instance, ok := firstReadyInstance(target.Service); ok {
+		return instance, false, nil
+	}
+	if h.nomad == nil {
+		return model.ServiceInstance{}, false, fmt.Errorf("nomad is not connected and %s/%s has no ready instance", target.App, target.Process)
+	}
+	attempt, err := h.wakes.join(target.App+"\x00"+target.Process, func(ctx context.Context) (model.ServiceInstance, error) {
+		return h.wakeGatewayTarget(ctx, target)
+	})
+	if err != nil {
+		h.wakeStats.reject(target)
+		return model.ServiceInstance{}, false, err
+	}
+	defer h.wakes.leave(attempt)
+
+	started := time.Now()
+	select {
+	case <-attempt.done:
+		h.wakeStats.wait(target, time.Since(started))
+		return attempt.instance, true, attempt.err
+	case <-ctx.Done():
+		return model.ServiceInstance{}, true, fmt.Errorf("timeout waiting for %s/%s to wake", target.App, target.Process)
+	}
+}
+
+// wantsWakeInterstitial reports whether r is a browser page load that can be
+// answered with the waking-up page instead of being held.
+func wantsWakeInterstitial(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if isWebSocketUpgrade(r) || r.Header.Get("X-Requested-With") != "" {
+		return false
+	}
+	return strings.Contains(strings.ToLower(r.Header.Get("Accept")), "text/html")
+}
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(strings.TrimSpace(r.Header.Get("Upgrade")), "websocket")
+}
+
+const defaultWakeInterstitial = `<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>{{.App}} is waking up</title>
+<style>
+body { font-family: system-ui, sans-serif; display: flex; min-height: 100vh; margin: 0; align-items: center; justify-content: center; background: #111; color: #ddd; }
+main { text-align: center; }
+p { color: #888; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{.App}} is waking up</h1>
+<p>It was stopped while idle. This page reloads every {{.Refresh}} seconds until it is ready.</p>
+</main>
+</body>
+</html>
+`
+
+type wakeInterstitialData struct {
+	App      string
+	Process  string
+	Endpoint string
+	Refresh  int
+}
+
+// loadWakeInterstitial parses the configured waking-up page. It returns nil
+// when the page is turned off, and the built-in page when the configured
+// file can't be used.
+func loadWakeInterstitial(setting string, readFile func(string) ([]byte, error)) *template.Template {
+	builtin := template.Must(template.New("wake").Parse(defaultWakeInterstitial))
+	switch setting {
+	case "":
+		return builtin
+	case "off":
+		return nil
+	}
+	raw, err := readFile(setting)
+	if err == nil {
+		var page *template.Template
+		if page, err = template.New("wake").Parse(string(raw)); err == nil {
+			return page
+		}
+	}
+	log.Printf("wake gateway: interstitial %s: %v; using the built-in page", setting, err)
+	return builtin
+}
+
+func (h *Handler) writeWakeInterstitial(w http.ResponseWriter, r *http.Request, target wakeGatewayTarget) {
+	var body bytes.Buffer
+	if err := h.wakePage.Execute(&body, wakeInterstitialData{
+		App:      target.App,
+		Process:  target.Process,
+		Endpoint: target.Endpoint,
+		Refresh:  wakeInterstitialRefresh,
+	}); err != nil {
+		writeError(w, http.StatusServiceUnavailable, "service is waking up")
+		return
+	}
+	h.wakeStats.interstitial(target)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Retry-After", strconv.Itoa(wakeInterstitialRefresh))
+	w.Header().Set("X-Norn-Wake-Gateway", "true")
+	w.Header().Set("X-Norn-Wake-Action", "waking")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	if r.Method != http.MethodHead {
+		w.Write(body.Bytes())
+	}
+}
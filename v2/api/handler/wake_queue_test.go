@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"norn/v2/api/model"
+)
+
+func TestWakeQueueSharesOneWakeBetweenRequests(t *testing.T) {
+	var q wakeQueue
+	var calls int32
+	release := make(chan struct{})
+	wake := func(ctx context.Context) (model.ServiceInstance, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return model.ServiceInstance{Address: "10.0.0.5", Port: 8080, Status: "passing"}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan model.ServiceInstance, 5)
+	for i := 0; i < 5; i++ {
+		attempt, err := q.join("tools\x00web", wake)
+		if err != nil {
+			t.Fatalf("join %d: %v", i, err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer q.leave(attempt)
+			<-attempt.done
+			results <- attempt.instance
+		}()
+	}
+	if held := q.held()["tools\x00web"]; held != 5 {
+		t.Fatalf("held = %d, want 5", held)
+	}
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("wake ran %d times, want 1", n)
+	}
+	for instance := range results {
+		if instance.Port != 8080 {
+			t.Fatalf("instance = %+v", instance)
+		}
+	}
+	if len(q.held()) != 0 {
+		t.Fatalf("finished wake still queued: %v", q.held())
+	}
+}
+
+func TestWakeQueueRejectsRequestsPastLimit(t *testing.T) {
+	q := wakeQueue{limit: 2}
+	release := make(chan struct{})
+	defer close(release)
+	wake := func(ctx context.Context) (model.ServiceInstance, error) {
+		<-release
+		return model.ServiceInstance{}, nil
+	}
+
+	first, err := q.join("tools\x00web", wake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.join("tools\x00web", wake); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.join("tools\x00web", wake); !errors.Is(err, errWakeQueueFull) {
+		t.Fatalf("third join err = %v, want errWakeQueueFull", err)
+	}
+	q.leave(first)
+	if _, err := q.join("tools\x00web", wake); err != nil {
+		t.Fatalf("join after leave: %v", err)
+	}
+	if _, err := q.join("other\x00web", wake); err != nil {
+		t.Fatalf("other target should have its own queue: %v", err)
+	}
+}
+
+func TestWantsWakeInterstitial(t *testing.T) {
+	cases := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    bool
+	}{
+		{"browser page", "GET", map[string]string{"Accept": "text/html,application/xhtml+xml"}, true},
+		{"api client", "GET", map[string]string{"Accept": "application/json"}, false},
+		{"form post", "POST", map[string]string{"Accept": "text/html"}, false},
+		{"fetch", "GET", map[string]string{"Accept": "text/html", "X-Requested-With": "XMLHttpRequest"}, false},
+		{"websocket", "GET", map[string]string{"Accept": "text/html", "Connection": "Upgrade", "Upgrade": "websocket"}, false},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, "https://tools.example.com/", nil)
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+		if got := wantsWakeInterstitial(req); got != tc.want {
+			t.Fatalf("%s: wantsWakeInterstitial = %t, want %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestWakeStatsWritesColdStartHistogram(t *testing.T) {
+	var stats wakeStats
+	target := wakeGatewayTarget{App: "tools", Process: "web"}
+	stats.coldStart(target, "ready", 700*time.Millisecond)
+	stats.coldStart(target, "ready", 3*time.Second)
+	stats.reject(target)
+
+	var b bytes.Buffer
+	stats.write(&b, map[string]int{"tools\x00web": 4})
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE norn_wake_cold_start_seconds histogram",
+		`norn_wake_cold_start_seconds_bucket{app="tools",process="web",result="ready",le="0.5"} 0`,
+		`norn_wake_cold_start_seconds_bucket{app="tools",process="web",result="ready",le="1"} 1`,
+		`norn_wake_cold_start_seconds_bucket{app="tools",process="web",result="ready",le="5"} 2`,
+		`norn_wake_cold_start_seconds_bucket{app="tools",process="web",result="ready",le="+Inf"} 2`,
+		`norn_wake_cold_start_seconds_sum{app="tools",process="web",result="ready"} 3.700`,
+		`norn_wake_cold_start_seconds_count{app="tools",process="web",result="ready"} 2`,
+		`norn_wake_requests_rejected_total{app="tools",process="web"} 1`,
+		`norn_wake_requests_held{app="tools",process="web"} 4`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("metrics missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestLoadWakeInterstitial(t *testing.T) {
+	if page := loadWakeInterstitial("off", nil); page != nil {
+		t.Fatalf("off should disable the page")
+	}
+	custom := loadWakeInterstitial("/etc/norn/wake.html", func(string) ([]byte, error) {
+		return []byte(`<p>{{.App}} starting</p>`), nil
+	})
+	var b bytes.Buffer
+	if err := custom.Execute(&b, wakeInterstitialData{App: "tools"}); err != nil || b.String() != "<p>tools starting</p>" {
+		t.Fatalf("custom page = %q, %v", b.String(), err)
+	}
+	fallback := loadWakeInterstitial("/missing.html", func(string) ([]byte, error) {
+		return nil, errors.New("no such file")
+	})
+	b.Reset()
+	if err := fallback.Execute(&b, wakeInterstitialData{App: "tools", Refresh: 3}); err != nil || !strings.Contains(b.String(), "tools is waking up") {
+		t.Fatalf("fallback page = %q, %v", b.String(), err)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/google/uuid"
 
 	"norn/v2/api/model"
+	"norn/v2/api/saga"
 )
 
 func (h *Handler) Webhook(w http.ResponseWriter, r *http.Request) {
@@ -79,6 +80,10 @@ func (h *Handler) Webhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if eventHeader == "pull_request" {
+		h.pullRequestWebhook(w, r, provider, body, delivery)
+		return
+	}
 	if eventHeader != "push" {
 		h.finishWebhookDelivery(r, delivery, "ignored", "unsupported event: "+eventHeader)
 		writeJSON(w, map[string]bool{"ignored": true})
@@ -132,7 +137,8 @@ func (h *Handler) Webhook(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("webhook: auto-deploying %s (branch %s, provider %s)", spec.App, branch, provider)
 
-	sagaID := h.pipeline.Run(spec, payload.Ref)
+	ctx := saga.WithActor(r.Context(), "webhook:"+provider)
+	sagaID := h.pipeline.Run(ctx, spec, payload.Ref)
 	delivery.App = spec.App
 	delivery.SagaID = sagaID
 	h.finishWebhookDelivery(r, delivery, "deploying", "matched app "+spec.App)
@@ -170,6 +176,10 @@ func (h *Handler) ReplayWebhookDelivery(w http.ResponseWriter, r *http.Request)
 		writeError(w, http.StatusNotFound, "webhook delivery not found")
 		return
 	}
+	if delivery.Event == "pull_request" {
+		writeError(w, http.StatusBadRequest, "pull request deliveries cannot be replayed; push to the pull request to redeploy its preview")
+		return
+	}
 
 	spec, err := h.specForWebhookDelivery(delivery)
 	if err != nil {
@@ -186,9 +196,9 @@ func (h *Handler) ReplayWebhookDelivery(w http.ResponseWriter, r *http.Request)
 
 	var sagaID string
 	if req.Mode == "preflight" {
-		sagaID = h.pipeline.Preflight(spec, ref)
+		sagaID = h.pipeline.Preflight(r.Context(), spec, ref)
 	} else {
-		sagaID = h.pipeline.Run(spec, ref)
+		sagaID = h.pipeline.Run(r.Context(), spec, ref)
 	}
 
 	delivery.App = spec.App
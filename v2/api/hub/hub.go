@@ -1,33 +1,85 @@
 package hub
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
 	"net/url"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
+// Event is one message on the event stream. ID and Time identify it for
+// replay; Broadcast fills them in when the event has no persisted identity.
 type Event struct {
+	ID      string      `json:"id"`
+	Cursor  string      `json:"cursor"`
+	Time    time.Time   `json:"time"`
 	Type    string      `json:"type"`
 	AppID   string      `json:"appId"`
+	SagaID  string      `json:"sagaId,omitempty"`
 	Payload interface{} `json:"payload"`
 }
 
-type client struct {
-	conn *websocket.Conn
-	send chan []byte
+// ReadyType marks the end of a subscription's replay. Its payload is a
+// Ready; events after it are live.
+const ReadyType = "stream.ready"
+
+// Ready reports how a subscription's replay went. Complete is false when
+// events may have been missed: the replay hit its limit, a source failed,
+// or the cursor predates the events this process still holds.
+type Ready struct {
+	Cursor   string `json:"cursor,omitempty"`
+	Replayed int    `json:"replayed"`
+	Complete bool   `json:"complete"`
+}
+
+// Source replays events persisted outside the hub, such as saga and Beacon
+// events, so a subscriber can catch up across API restarts.
+type Source interface {
+	// Replay returns up to limit of the newest events after the cursor
+	// that match the filter.
+	Replay(ctx context.Context, after Cursor, f Filter, limit int) ([]Event, error)
+}
+
+const (
+	// historySize is how many recent events the hub keeps for replay,
+	// including those no Source persists.
+	historySize = 1024
+	// replayLimit caps the events sent to one subscriber on connect.
+	replayLimit = 500
+	// sendBuffer is how far a subscriber may fall behind before it is
+	// dropped and has to reconnect with its cursor.
+	sendBuffer  = 256
+	keepalive   = 25 * time.Second
+	writeWait   = 10 * time.Second
+	laggingNote = "subscriber fell behind; reconnect with since=<cursor>"
+)
+
+type message struct {
+	evt  Event
+	data []byte
+}
+
+type subscriber struct {
+	filter Filter
+	send   chan message
 }
 
 type Hub struct {
-	mu         sync.RWMutex
-	clients    map[*client]bool
-	broadcast  chan []byte
-	register   chan *client
-	unregister chan *client
-	upgrader   websocket.Upgrader
+	mu      sync.Mutex
+	subs    map[*subscriber]bool
+	history []message
+	// since is the oldest time history is complete from: the hub's start,
+	// or the newest event it has evicted.
+	since    time.Time
+	sources  []Source
+	upgrader websocket.Upgrader
 }
 
 func New(allowedOrigins []string) *Hub {
@@ -37,10 +89,8 @@ func New(allowedOrigins []string) *Hub {
 	}
 
 	return &Hub{
-		clients:    make(map[*client]bool),
-		broadcast:  make(chan []byte, 256),
-		register:   make(chan *client),
-		unregister: make(chan *client),
+		subs:  make(map[*subscriber]bool),
+		since: time.Now().Truncate(time.Microsecond),
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				origin := r.Header.Get("Origin")
@@ -61,75 +111,284 @@ func New(allowedOrigins []string) *Hub {
 	}
 }
 
-func (h *Hub) Run() {
-	for {
-		select {
-		case c := <-h.register:
-			h.mu.Lock()
-			h.clients[c] = true
-			h.mu.Unlock()
-		case c := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[c]; ok {
-				delete(h.clients, c)
-				close(c.send)
-			}
-			h.mu.Unlock()
-		case msg := <-h.broadcast:
-			h.mu.RLock()
-			for c := range h.clients {
-				select {
-				case c.send <- msg:
-				default:
-					close(c.send)
-					delete(h.clients, c)
-				}
-			}
-			h.mu.RUnlock()
-		}
-	}
+// AddSource registers a store to replay persisted events from.
+func (h *Hub) AddSource(s Source) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sources = append(h.sources, s)
 }
 
+// Broadcast sends evt to every subscriber whose filter matches it and keeps
+// it for replay. It never blocks: a subscriber whose buffer is full is
+// dropped, and catches up by reconnecting with its last cursor.
 func (h *Hub) Broadcast(evt Event) {
+	if evt.ID == "" {
+		evt.ID = uuid.New().String()
+	}
+	if evt.Time.IsZero() {
+		evt.Time = time.Now()
+	}
+	if evt.SagaID == "" {
+		// Pipeline step events carry their saga in the payload.
+		if p, ok := evt.Payload.(map[string]string); ok {
+			evt.SagaID = p["sagaId"]
+		}
+	}
+	// Postgres keeps microseconds, so live and replayed cursors agree.
+	evt.Time = evt.Time.Truncate(time.Microsecond)
+	evt.Cursor = CursorOf(evt).String()
 	data, err := json.Marshal(evt)
 	if err != nil {
 		log.Printf("hub: marshal error: %v", err)
 		return
 	}
-	h.broadcast <- data
+	msg := message{evt: evt, data: data}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.history) == historySize {
+		h.since = h.history[0].evt.Time
+		h.history = append(h.history[:0], h.history[1:]...)
+	}
+	h.history = append(h.history, msg)
+	for s := range h.subs {
+		if !s.filter.Match(evt) {
+			continue
+		}
+		select {
+		case s.send <- msg:
+		default:
+			delete(h.subs, s)
+			close(s.send)
+		}
+	}
+}
+
+func (h *Hub) subscribe(f Filter) *subscriber {
+	s := &subscriber{filter: f, send: make(chan message, sendBuffer)}
+	h.mu.Lock()
+	h.subs[s] = true
+	h.mu.Unlock()
+	return s
+}
+
+func (h *Hub) unsubscribe(s *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[s] {
+		delete(h.subs, s)
+		close(s.send)
+	}
+}
+
+// latestCursor is the cursor of the newest event, a resume point for
+// subscribers that asked for no replay.
+func (h *Hub) latestCursor() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.history) == 0 {
+		return ""
+	}
+	return h.history[len(h.history)-1].evt.Cursor
+}
+
+// replay collects the events after cursor that match f from the hub's
+// history and every source, oldest first.
+func (h *Hub) replay(ctx context.Context, f Filter, after Cursor) ([]Event, bool) {
+	h.mu.Lock()
+	complete := !after.Time.Before(h.since)
+	var events []Event
+	for _, m := range h.history {
+		if after.Less(CursorOf(m.evt)) && f.Match(m.evt) {
+			events = append(events, m.evt)
+		}
+	}
+	sources := append([]Source(nil), h.sources...)
+	h.mu.Unlock()
+
+	for _, src := range sources {
+		found, err := src.Replay(ctx, after, f, replayLimit)
+		if err != nil {
+			log.Printf("hub: replay: %v", err)
+			complete = false
+			continue
+		}
+		if len(found) >= replayLimit {
+			complete = false
+		}
+		for _, evt := range found {
+			evt.Time = evt.Time.Truncate(time.Microsecond)
+			evt.Cursor = CursorOf(evt).String()
+			if after.Less(CursorOf(evt)) && f.Match(evt) {
+				events = append(events, evt)
+			}
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return CursorOf(events[i]).Less(CursorOf(events[j]))
+	})
+	out := events[:0]
+	seen := make(map[string]bool, len(events))
+	for _, evt := range events {
+		if !seen[evt.ID] {
+			seen[evt.ID] = true
+			out = append(out, evt)
+		}
+	}
+	if len(out) > replayLimit {
+		out = out[len(out)-replayLimit:]
+		complete = false
+	}
+	return out, complete
+}
+
+// stream replays what the subscriber missed since its cursor, marks the
+// switch to live events with a ReadyType event, then forwards live events
+// until ctx ends or the subscriber is dropped. It reports whether the
+// subscriber was dropped for falling behind.
+func (h *Hub) stream(ctx context.Context, s *subscriber, since *Cursor, write func(Event, []byte) error, ping func() error) (bool, error) {
+	ready := Ready{Complete: true}
+	var seen map[string]bool
+	if since == nil {
+		ready.Cursor = h.latestCursor()
+	} else {
+		ready.Cursor = since.String()
+		events, complete := h.replay(ctx, s.filter, *since)
+		ready.Complete = complete
+		seen = make(map[string]bool, len(events))
+		for _, evt := range events {
+			data, err := json.Marshal(evt)
+			if err != nil {
+				return false, err
+			}
+			if err := write(evt, data); err != nil {
+				return false, err
+			}
+			seen[evt.ID] = true
+			ready.Cursor = evt.Cursor
+			ready.Replayed++
+		}
+	}
+	marker := Event{Type: ReadyType, Cursor: ready.Cursor, Time: time.Now(), Payload: ready}
+	data, err := json.Marshal(marker)
+	if err != nil {
+		return false, err
+	}
+	if err := write(marker, data); err != nil {
+		return false, err
+	}
+
+	ticker := time.NewTicker(keepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-ticker.C:
+			if err := ping(); err != nil {
+				return false, err
+			}
+		case msg, ok := <-s.send:
+			if !ok {
+				return true, nil
+			}
+			if seen[msg.evt.ID] || (since != nil && !since.Less(CursorOf(msg.evt))) {
+				continue
+			}
+			if err := write(msg.evt, msg.data); err != nil {
+				return false, err
+			}
+		}
+	}
 }
 
+// HandleConnect streams events over a WebSocket. The subscription comes from
+// the query string; see ParseSubscription.
 func (h *Hub) HandleConnect(w http.ResponseWriter, r *http.Request) {
+	f, since, status, err := ParseSubscription(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
 	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("ws upgrade: %v", err)
 		return
 	}
+	defer conn.Close()
 
-	c := &client{conn: conn, send: make(chan []byte, 64)}
-	h.register <- c
+	s := h.subscribe(f)
+	defer h.unsubscribe(s)
 
-	go c.writePump()
-	go c.readPump(h)
-}
-
-func (c *client) writePump() {
-	defer c.conn.Close()
-	for msg := range c.send {
-		if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
-			return
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		// Clients only send control frames; a read error means they left.
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
 		}
+	}()
+
+	lagging, err := h.stream(ctx, s, since,
+		func(_ Event, data []byte) error {
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			return conn.WriteMessage(websocket.TextMessage, data)
+		},
+		func() error {
+			return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+		})
+	if lagging {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseTryAgainLater, laggingNote),
+			time.Now().Add(writeWait))
+	} else if err != nil {
+		log.Printf("ws write: %v", err)
 	}
 }
 
-func (c *client) readPump(h *Hub) {
-	defer func() {
-		h.unregister <- c
-		c.conn.Close()
-	}()
-	for {
-		if _, _, err := c.conn.ReadMessage(); err != nil {
-			break
-		}
+// HandleStream streams events as Server-Sent Events, with the same
+// subscription and replay as HandleConnect. Each event's id is its cursor,
+// so an EventSource that reconnects resumes from Last-Event-ID.
+func (h *Hub) HandleStream(w http.ResponseWriter, r *http.Request) {
+	f, since, status, err := ParseSubscription(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	s := h.subscribe(f)
+	defer h.unsubscribe(s)
+
+	lagging, _ := h.stream(r.Context(), s, since,
+		func(evt Event, data []byte) error {
+			if evt.Cursor != "" {
+				if _, err := w.Write([]byte("id: " + evt.Cursor + "\n")); err != nil {
+					return err
+				}
+			}
+			if _, err := w.Write(append(append([]byte("data: "), data...), "\n\n"...)); err != nil {
+				return err
+			}
+			return rc.Flush()
+		},
+		func() error {
+			if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+				return err
+			}
+			return rc.Flush()
+		})
+	if lagging {
+		// Ending the response makes the EventSource reconnect and replay.
+		w.Write([]byte(": " + laggingNote + "\n\n"))
+		rc.Flush()
 	}
 }
@@ -0,0 +1,190 @@
+package hub
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"norn/v2/api/auth"
+)
+
+type fakeSource []Event
+
+func (f fakeSource) Replay(_ context.Context, after Cursor, filter Filter, limit int) ([]Event, error) {
+	var out []Event
+	for _, evt := range f {
+		if after.Less(CursorOf(evt)) && filter.Match(evt) {
+			out = append(out, evt)
+		}
+	}
+	return out, nil
+}
+
+func TestCursorAndFilter(t *testing.T) {
+	at := time.UnixMicro(1760600000123456)
+	c := Cursor{Time: at, ID: "3f2a-b1"}
+	parsed, err := ParseCursor(c.String())
+	if err != nil || !parsed.Time.Equal(at) || parsed.ID != "3f2a-b1" {
+		t.Fatalf("ParseCursor(%s) = %+v, %v", c, parsed, err)
+	}
+	if _, err := ParseCursor("yesterday"); err == nil {
+		t.Fatal("expected an invalid cursor error")
+	}
+	if !c.Less(Cursor{Time: at, ID: "4"}) || c.Less(Cursor{Time: at.Add(-time.Microsecond), ID: "z"}) {
+		t.Fatal("cursors order by time, then ID")
+	}
+
+	f := Filter{Apps: []string{"web"}, Types: []string{"deploy.*", "beacon.event"}}
+	for evt, want := range map[Event]bool{
+		{AppID: "web", Type: "deploy.step"}:    true,
+		{AppID: "web", Type: "beacon.event"}:   true,
+		{AppID: "web", Type: "deployment"}:     false,
+		{AppID: "api", Type: "deploy.step"}:    false,
+		{AppID: "", Type: "deploy-group.wave"}: false,
+	} {
+		if got := f.Match(evt); got != want {
+			t.Errorf("Match(%+v) = %v, want %v", evt, got, want)
+		}
+	}
+	if (Filter{Sagas: []string{"s1"}}).Match(Event{AppID: "web", Type: "deploy.step"}) {
+		t.Error("saga filter matched an event without a saga")
+	}
+}
+
+func TestParseSubscriptionScopesTokens(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/stream?app=web,api&type=saga.event&since=100-a", nil)
+	f, since, _, err := ParseSubscription(r)
+	if err != nil || strings.Join(f.Apps, ",") != "web,api" || since == nil || since.ID != "a" {
+		t.Fatalf("ParseSubscription = %+v, %+v, %v", f, since, err)
+	}
+
+	r.Header.Set("Last-Event-ID", "200-b")
+	if _, since, _, _ = ParseSubscription(r); since.ID != "b" {
+		t.Fatalf("Last-Event-ID should win over since: %+v", since)
+	}
+
+	scoped := auth.WithIdentity(context.Background(), &auth.Identity{User: "ci", Apps: []string{"web"}})
+	r = httptest.NewRequest(http.MethodGet, "/api/stream", nil).WithContext(scoped)
+	if f, _, _, err := ParseSubscription(r); err != nil || strings.Join(f.Apps, ",") != "web" {
+		t.Fatalf("scoped token without ?app = %+v, %v", f, err)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/api/stream?app=api", nil).WithContext(scoped)
+	if _, _, status, err := ParseSubscription(r); err == nil || status != http.StatusForbidden {
+		t.Fatalf("scoped token asking for another app: %d, %v", status, err)
+	}
+}
+
+func TestStreamReplaysThenGoesLive(t *testing.T) {
+	h := New(nil)
+	base := time.Now().Truncate(time.Microsecond)
+	persisted := Event{ID: "saga-1", Time: base.Add(time.Second), Type: SagaEventType, AppID: "web", SagaID: "s1"}
+	h.AddSource(fakeSource{persisted})
+
+	h.Broadcast(Event{Type: "deploy.step", AppID: "web", Time: base})
+	first := h.latestCursor()
+	h.Broadcast(persisted) // live copy of the persisted event
+	h.Broadcast(Event{Type: "deploy.step", AppID: "api", Time: base.Add(2 * time.Second)})
+	h.Broadcast(Event{Type: "deploy.step", AppID: "web", Time: base.Add(3 * time.Second)})
+
+	srv := httptest.NewServer(http.HandlerFunc(h.HandleStream))
+	defer srv.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?app=web&since="+first, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %s", ct)
+	}
+
+	events := make(chan Event)
+	go func() {
+		var id string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if v, ok := strings.CutPrefix(line, "id: "); ok {
+				id = v
+			}
+			if v, ok := strings.CutPrefix(line, "data: "); ok {
+				var evt Event
+				json.Unmarshal([]byte(v), &evt)
+				if evt.Cursor != id {
+					t.Errorf("id %q does not match cursor %q", id, evt.Cursor)
+				}
+				events <- evt
+			}
+		}
+		close(events)
+	}()
+	next := func() Event {
+		select {
+		case evt := <-events:
+			return evt
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an event")
+			return Event{}
+		}
+	}
+
+	if evt := next(); evt.ID != "saga-1" {
+		t.Fatalf("first replayed event = %+v", evt)
+	}
+	third := next()
+	if third.Type != "deploy.step" || !third.Time.Equal(base.Add(3*time.Second)) {
+		t.Fatalf("second replayed event = %+v", third)
+	}
+	ready := next()
+	payload, _ := ready.Payload.(map[string]interface{})
+	if ready.Type != ReadyType || ready.Cursor != third.Cursor || payload["replayed"] != float64(2) || payload["complete"] != true {
+		t.Fatalf("ready = %+v", ready)
+	}
+
+	h.Broadcast(Event{Type: "deploy.completed", AppID: "api"})
+	h.Broadcast(Event{Type: "deploy.completed", AppID: "web"})
+	if evt := next(); evt.Type != "deploy.completed" || evt.AppID != "web" {
+		t.Fatalf("live event = %+v", evt)
+	}
+}
+
+func TestBroadcastDropsLaggingSubscribers(t *testing.T) {
+	h := New(nil)
+	slow := h.subscribe(Filter{})
+	other := h.subscribe(Filter{Apps: []string{"api"}})
+	for i := 0; i < sendBuffer+1; i++ {
+		h.Broadcast(Event{Type: "deploy.step", AppID: "web"})
+	}
+	if h.subs[slow] {
+		t.Fatal("a subscriber with a full buffer should be dropped")
+	}
+	if !h.subs[other] {
+		t.Fatal("subscribers the events did not match should stay")
+	}
+	n := 0
+	for range slow.send {
+		n++
+	}
+	if n != sendBuffer {
+		t.Fatalf("drained %d buffered events, want %d", n, sendBuffer)
+	}
+	h.unsubscribe(slow) // already dropped; must not close twice
+}
+
+func TestBroadcastTakesSagaFromPayload(t *testing.T) {
+	h := New(nil)
+	s := h.subscribe(Filter{Sagas: []string{"s1"}})
+	h.Broadcast(Event{Type: "deploy.step", AppID: "web", Payload: map[string]string{"sagaId": "s2"}})
+	h.Broadcast(Event{Type: "deploy.step", AppID: "web", Payload: map[string]string{"sagaId": "s1", "step": "build"}})
+	msg := <-s.send
+	if msg.evt.SagaID != "s1" || len(s.send) != 0 {
+		t.Fatalf("saga subscriber got %+v and %d more", msg.evt, len(s.send))
+	}
+}
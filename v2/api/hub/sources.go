@@ -0,0 +1,75 @@
+package hub
+
+import (
+	"context"
+
+	"norn/v2/api/model"
+	"norn/v2/api/saga"
+	"norn/v2/api/store"
+)
+
+// Event types of the persisted events sources replay.
+const (
+	SagaEventType   = "saga.event"
+	BeaconEventType = "beacon.event"
+)
+
+// SagaEvent wraps a saga event for the stream under its own ID and time, so
+// the live event and its replay share a cursor.
+func SagaEvent(evt saga.Event) Event {
+	return Event{ID: evt.ID, Time: evt.Timestamp, Type: SagaEventType, AppID: evt.App, SagaID: evt.SagaID, Payload: evt}
+}
+
+// BeaconEvent wraps a Beacon event for the stream under its own ID and time.
+func BeaconEvent(evt model.BeaconEvent) Event {
+	return Event{ID: evt.ID, Time: evt.OccurredAt, Type: BeaconEventType, AppID: evt.App, Payload: evt}
+}
+
+// SagaSource replays saga events from the saga log.
+func SagaSource(s *saga.PostgresStore) Source {
+	return sagaSource{store: s}
+}
+
+type sagaSource struct {
+	store *saga.PostgresStore
+}
+
+func (s sagaSource) Replay(ctx context.Context, after Cursor, f Filter, limit int) ([]Event, error) {
+	if !f.MatchType(SagaEventType) {
+		return nil, nil
+	}
+	found, err := s.store.ListAfter(ctx, after.Time, after.ID, f.Apps, f.Sagas, limit)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(found))
+	for _, evt := range found {
+		events = append(events, SagaEvent(evt))
+	}
+	return events, nil
+}
+
+// BeaconSource replays Beacon events from the events table.
+func BeaconSource(db *store.DB) Source {
+	return beaconSource{db: db}
+}
+
+type beaconSource struct {
+	db *store.DB
+}
+
+func (s beaconSource) Replay(ctx context.Context, after Cursor, f Filter, limit int) ([]Event, error) {
+	// Beacon events belong to no saga.
+	if !f.MatchType(BeaconEventType) || len(f.Sagas) > 0 {
+		return nil, nil
+	}
+	found, err := s.db.ListBeaconEventsAfter(ctx, after.Time, after.ID, f.Apps, limit)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, 0, len(found))
+	for _, evt := range found {
+		events = append(events, BeaconEvent(evt))
+	}
+	return events, nil
+}
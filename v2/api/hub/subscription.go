@@ -0,0 +1,133 @@
+package hub
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"norn/v2/api/auth"
+)
+
+// Cursor is a position in the event stream: events are ordered by time,
+// then ID. Its string form is <unix microseconds>-<event id>.
+type Cursor struct {
+	Time time.Time
+	ID   string
+}
+
+func CursorOf(evt Event) Cursor {
+	return Cursor{Time: evt.Time, ID: evt.ID}
+}
+
+func (c Cursor) String() string {
+	return strconv.FormatInt(c.Time.UnixMicro(), 10) + "-" + c.ID
+}
+
+// Less reports whether c comes before o.
+func (c Cursor) Less(o Cursor) bool {
+	if !c.Time.Equal(o.Time) {
+		return c.Time.Before(o.Time)
+	}
+	return c.ID < o.ID
+}
+
+func ParseCursor(s string) (Cursor, error) {
+	micros, id, _ := strings.Cut(s, "-")
+	n, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil || n < 0 {
+		return Cursor{}, fmt.Errorf("invalid cursor %q", s)
+	}
+	return Cursor{Time: time.UnixMicro(n), ID: id}, nil
+}
+
+// Filter selects events by app, saga and type. Each non-empty list must
+// contain a match; a type ending in ".*" matches by prefix.
+type Filter struct {
+	Apps  []string
+	Sagas []string
+	Types []string
+}
+
+func (f Filter) Match(evt Event) bool {
+	if len(f.Apps) > 0 && !contains(f.Apps, evt.AppID) {
+		return false
+	}
+	if len(f.Sagas) > 0 && !contains(f.Sagas, evt.SagaID) {
+		return false
+	}
+	return f.MatchType(evt.Type)
+}
+
+// MatchType reports whether events of type t can pass the filter, so
+// sources can skip stores that hold none.
+func (f Filter) MatchType(t string) bool {
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, want := range f.Types {
+		if want == t || (strings.HasSuffix(want, ".*") && strings.HasPrefix(t, strings.TrimSuffix(want, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseSubscription reads a subscription from a stream request: ?app=,
+// ?saga= and ?type= (repeated or comma-separated) filter events, and
+// ?since= or a Last-Event-ID header is the cursor to replay after. Tokens
+// scoped to apps only see those apps' events. On error it returns the HTTP
+// status to answer with.
+func ParseSubscription(r *http.Request) (Filter, *Cursor, int, error) {
+	q := r.URL.Query()
+	f := Filter{
+		Apps:  queryList(q["app"]),
+		Sagas: queryList(q["saga"]),
+		Types: queryList(q["type"]),
+	}
+	if id := auth.FromContext(r.Context()); id != nil && len(id.Apps) > 0 {
+		if len(f.Apps) == 0 {
+			f.Apps = id.Apps
+		}
+		for _, app := range f.Apps {
+			if !id.CanAccessApp(app) {
+				return f, nil, http.StatusForbidden, fmt.Errorf("token is not scoped to app %s", app)
+			}
+		}
+	}
+
+	since := r.Header.Get("Last-Event-ID")
+	if since == "" {
+		since = q.Get("since")
+	}
+	if since == "" {
+		return f, nil, http.StatusOK, nil
+	}
+	c, err := ParseCursor(since)
+	if err != nil {
+		return f, nil, http.StatusBadRequest, err
+	}
+	return f, &c, http.StatusOK, nil
+}
+
+func queryList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
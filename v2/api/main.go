@@ -2,10 +2,8 @@ package main
 
 import (
 	"context"
-	"crypto/subtle"
 	"encoding/json"
 	"log"
-	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -20,6 +18,7 @@ import (
 
 	"norn/v2/api/auth"
 	"norn/v2/api/beacon"
+	"norn/v2/api/builder"
 	"norn/v2/api/cloudflared"
 	"norn/v2/api/config"
 	"norn/v2/api/consul"
@@ -28,6 +27,7 @@ import (
 	"norn/v2/api/nomad"
 	"norn/v2/api/observe"
 	"norn/v2/api/pipeline"
+	"norn/v2/api/prometheus"
 	"norn/v2/api/redpanda"
 	"norn/v2/api/saga"
 	"norn/v2/api/secrets"
@@ -127,8 +127,11 @@ func main() {
 	var redpandaClient *redpanda.Client
 	if len(cfg.RedpandaBrokers) > 0 {
 		redpandaClient, err = redpanda.NewClient(redpanda.Config{
-			Brokers: cfg.RedpandaBrokers,
-			RPKPath: cfg.RedpandaRPKPath,
+			Brokers:    cfg.RedpandaBrokers,
+			RPKPath:    cfg.RedpandaRPKPath,
+			AdminHosts: cfg.RedpandaAdminHosts,
+			User:       cfg.RedpandaUser,
+			Password:   cfg.RedpandaPassword,
 		})
 		if err != nil {
 			log.Printf("WARNING: redpanda unavailable (%v)", err)
@@ -139,6 +142,13 @@ func main() {
 		}
 	}
 
+	// Prometheus, for windowed tuning and canary signals
+	var promClient *prometheus.Client
+	if cfg.PrometheusURL != "" {
+		promClient = prometheus.New(cfg.PrometheusURL)
+		log.Println("prometheus queries at " + cfg.PrometheusURL)
+	}
+
 	// WebSocket hub
 	allowedOrigins := []string{"http://localhost:5173", "http://localhost:3000"}
 	if cfg.AllowedOrigins != "" {
@@ -150,7 +160,7 @@ func main() {
 		}
 	}
 	ws := hub.New(allowedOrigins)
-	go ws.Run()
+	ws.AddSource(hub.BeaconSource(db))
 
 	beaconSvc := beacon.New(db, ws, beacon.Config{
 		Environment: cfg.BeaconEnvironment,
@@ -165,11 +175,22 @@ func main() {
 	notifier := beacon.NewNotifier(db)
 	beaconSvc.SetNotifier(notifier)
 
-	// Saga store
-	sagaStore := saga.NewPostgresStore(db.Pool)
+	// Saga store: events are also streamed live and replayed to subscribers
+	sagaLog := saga.NewPostgresStore(db.Pool)
+	ws.AddSource(hub.SagaSource(sagaLog))
+	sagaStore := saga.Publishing(sagaLog, func(evt saga.Event) {
+		ws.Broadcast(hub.SagaEvent(evt))
+	})
 
 	// Secrets manager
 	sec := secrets.NewManager(cfg.AppsDir)
+	if nomadClient != nil {
+		sec.UseNomad(nomadClient)
+	}
+	if cfg.VaultAddr != "" {
+		sec.UseVault(secrets.NewVault(cfg.VaultAddr, cfg.VaultToken, cfg.VaultNamespace))
+		log.Println("vault secrets backend at " + cfg.VaultAddr)
+	}
 
 	// Deploy pipeline
 	pipe := &pipeline.Pipeline{
@@ -181,12 +202,19 @@ func main() {
 		Secrets:     sec,
 		AppsDir:     cfg.AppsDir,
 		GitToken:    cfg.GitToken,
+		PublicURL:   cfg.PublicURL,
 		GitSSHKey:   cfg.GitSSHKey,
 		RegistryURL: cfg.RegistryURL,
 		NetworkMode: cfg.NetworkMode,
 		Beacon:      beaconSvc,
 		Storage:     s3Client,
 		Redpanda:    redpandaClient,
+		Prometheus:  promClient,
+		Builder: builder.Config{
+			DefaultBackend: cfg.BuildBackend,
+			BuildKitAddr:   cfg.BuildKitAddr,
+		},
+		BuildPlatforms: cfg.BuildPlatforms,
 	}
 
 	workerCtx, workerCancel := context.WithCancel(context.Background())
@@ -197,6 +225,37 @@ func main() {
 		opWorker := worker.NewOperationWorker(db, pipe)
 		go opWorker.Run(workerCtx)
 	}
+	if os.Getenv("NORN_SKIP_PREVIEW_REAPER") == "true" {
+		log.Println("preview reaper skipped")
+	} else {
+		go worker.NewPreviewReaper(db, pipe).Run(workerCtx)
+	}
+	if os.Getenv("NORN_SKIP_DRIFT_RECONCILER") == "true" {
+		log.Println("drift reconciler skipped")
+	} else {
+		driftInterval, _ := time.ParseDuration(os.Getenv("NORN_DRIFT_INTERVAL"))
+		go worker.NewDriftReconciler(pipe, driftInterval).Run(workerCtx)
+	}
+	if os.Getenv("NORN_SKIP_IDLE_REAPER") == "true" {
+		log.Println("idle reaper skipped")
+	} else {
+		go worker.NewIdleReaper(pipe).Run(workerCtx)
+	}
+	if os.Getenv("NORN_SKIP_AUTOSCALER") == "true" {
+		log.Println("autoscaler skipped")
+	} else {
+		go worker.NewAutoscaler(pipe).Run(workerCtx)
+	}
+	if os.Getenv("NORN_SKIP_TUNER") == "true" {
+		log.Println("tuner skipped")
+	} else {
+		go worker.NewTuner(pipe).Run(workerCtx)
+	}
+	if os.Getenv("NORN_SKIP_CREDENTIAL_ROTATOR") == "true" {
+		log.Println("credential rotator skipped")
+	} else {
+		go worker.NewCredentialRotator(pipe).Run(workerCtx)
+	}
 	if os.Getenv("NORN_SKIP_NOMAD_WATCHER") == "true" {
 		log.Println("nomad allocation watcher skipped")
 	} else {
@@ -226,134 +285,174 @@ func main() {
 	}
 	r.Use(h.WakeGatewayHostMiddleware)
 
-	// Bearer token auth
+	// Audited ahead of authentication, so rejected tokens are recorded too.
+	r.Use(h.AuditMiddleware)
+	// Identity: API tokens, CF Access users, loopback and IP grants
+	r.Use(h.Authenticate)
 	if cfg.APIToken != "" {
-		r.Use(bearerAuth(cfg.APIToken, h))
 		log.Println("API token auth enabled")
 	}
 	r.Use(h.AccessMiddleware)
 	r.Get("/metrics", h.Metrics)
 
 	r.Route("/api", func(r chi.Router) {
+		// Public: these authenticate themselves or expose nothing sensitive.
 		r.Get("/health", h.Health)
 		r.Get("/metrics", h.Metrics)
 		r.Get("/version", func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(map[string]string{"version": Version})
 		})
-
 		r.Post("/webhooks/{provider}", h.Webhook)
-		r.Get("/webhooks/deliveries", h.ListWebhookDeliveries)
-		r.Post("/webhooks/deliveries/{id}/replay", h.ReplayWebhookDelivery)
-
-		r.Get("/stats", h.Stats)
-		r.Get("/observability/bundle", h.ObservabilityBundle)
-		r.Get("/observability/alerts.yml", h.PrometheusAlerts)
-		r.Get("/observability/prometheus.yml", h.PrometheusConfig)
-		r.Post("/observability/services/install", h.ObservabilityServicesInstall)
-		r.Get("/services/manifest", h.ServiceManifest)
-		r.Get("/ops/platform", h.PlatformOps)
-		r.Get("/operator/inbox", h.OperatorInbox)
-		r.Get("/operator/cron", h.OperatorCronOverview)
-		r.Get("/operator/wake-targets", h.OperatorWakeTargets)
-		r.Get("/operator/deploy-confidence", h.OperatorDeployConfidence)
-		r.Get("/operator/snapshot-readiness", h.OperatorSnapshotReadiness)
-		r.Get("/operator/auth-hints", h.OperatorAuthHints)
-		r.Get("/operator/actions", h.OperatorActions)
-		r.Get("/platform/releases", h.PlatformReleases)
-		r.Post("/platform/releases/{sha}/rollback", h.PlatformRollbackRelease)
-		r.Get("/ops/contextdb", h.ContextDBOps)
-		r.Post("/ops/contextdb/feedback/{eventID}/rollback", h.ContextDBRollbackFeedback)
-		r.Get("/apps", h.ListApps)
-		r.Get("/deployments", h.ListDeployments)
-		r.Get("/deployments/{id}/steps", h.ListDeploymentSteps)
-		r.Get("/operations", h.ListOperations)
-		r.Get("/operations/active", h.ActiveOperations)
-		r.Get("/alerts/rules", h.AlertRules)
-		r.Get("/resources/suggestions", h.ResourceSuggestions)
-		r.Get("/tuning/recommendations", h.TuningRecommendations)
-		r.Get("/events", h.ListEvents)
-		r.Post("/events", h.CreateEvent)
-		r.Get("/events/active", h.ActiveIncidents)
-		r.Get("/events/correlated", h.CorrelatedEvents)
-		r.Post("/events/reconcile", h.ReconcileEvents)
-		r.Get("/events/{id}", h.GetEvent)
-		r.Post("/events/{id}/ack", h.AcknowledgeEvent)
-		r.Post("/events/{id}/snooze", h.SnoozeEvent)
-		r.Post("/events/{id}/open", h.OpenEvent)
-		r.Get("/events/sinks", h.EventSinks)
-		r.Post("/events/test", h.TestEvent)
-		r.Post("/incidents/action", h.IncidentAction)
-		r.Get("/validate", h.ValidateAll)
-		r.Get("/validate/{id}", h.ValidateApp)
-		r.Get("/secrets/status", h.SecretsStatusAll)
-		r.Get("/secrets/migration-plan", h.SecretsMigrationPlan)
-		r.Get("/saga", h.ListRecentSaga)
-		r.Get("/saga/{sagaId}", h.GetSagaEvents)
-		r.Get("/cloudflared/ingress", h.CloudflaredIngress)
-		r.Get("/access/events", h.AccessEvents)
-		r.Get("/access/patterns", h.AccessPatterns)
-		r.Post("/access/observations", h.RecordAccessObservations)
-		r.Get("/access/cloudflare/status", h.CloudflareAccessStatus)
-		r.Post("/access/cloudflare/sync", h.CloudflareAccessSync)
 		r.Post("/access/cloudflare/logpush", h.CloudflareLogpush)
 		r.HandleFunc("/a/{app}", h.WakeGatewayAppAlias)
 		r.HandleFunc("/a/{app}/*", h.WakeGatewayAppAlias)
 		r.HandleFunc("/wake-gateway/{host}", h.WakeGateway)
 		r.HandleFunc("/wake-gateway/{host}/*", h.WakeGateway)
 
-		r.Get("/notifications/channels", h.ListNotificationChannels)
-		r.Post("/notifications/channels", h.CreateNotificationChannel)
-		r.Post("/notifications/channels/bootstrap", h.BootstrapNotificationChannels)
-		r.Post("/notifications/channels/{id}/test", h.TestNotificationChannel)
-		r.Delete("/notifications/channels/{id}", h.DeleteNotificationChannel)
-		r.Get("/deploy-groups", h.ListDeployGroups)
-		r.Post("/deploy-groups/{name}/deploy", h.DeployGroup)
-
-		r.Get("/access/grants", h.ListAccessGrants)
-		r.Post("/access/grants", h.CreateAccessGrant)
-		r.Delete("/access/grants/{id}", h.DeleteAccessGrant)
-		r.Post("/access/tokens", h.CreateAccessToken)
-
-		r.Get("/ops/contextdb/evaluator-readiness", h.EvaluatorReadiness)
-
-		r.Route("/apps/{id}", func(r chi.Router) {
-			r.Use(handler.ValidateAppID)
-			r.Get("/", h.GetApp)
-			r.Post("/preflight", h.Preflight)
-			r.Post("/deploy", h.Deploy)
-			r.Get("/logs", h.StreamLogs)
-			r.Post("/restart", h.RestartApp)
-			r.Post("/scale", h.ScaleApp)
-			r.Post("/rollback", h.Rollback)
-			r.Get("/secrets", h.ListSecrets)
-			r.Get("/secrets/status", h.SecretsStatusApp)
-			r.Put("/secrets", h.UpdateSecrets)
-			r.Delete("/secrets/{key}", h.DeleteSecret)
-			r.Get("/snapshots", h.ListSnapshots)
-			r.Post("/snapshots/retention", h.ApplySnapshotRetention)
-			r.Post("/snapshots/{ts}/restore", h.RestoreSnapshot)
-			r.Get("/cron/history", h.CronHistory)
-			r.Post("/cron/trigger", h.CronTrigger)
-			r.Post("/cron/pause", h.CronPause)
-			r.Post("/cron/resume", h.CronResume)
-			r.Put("/cron/schedule", h.CronUpdateSchedule)
-			r.Post("/invoke", h.InvokeFunction)
-			r.Get("/function/history", h.FunctionHistory)
-			r.Get("/canary", h.CanaryStatus)
-			r.Post("/promote", h.PromoteCanary)
-			r.Post("/snapshots/export", h.ExportSnapshot)
-			r.Get("/snapshots/remote", h.ListRemoteSnapshots)
-			r.Post("/snapshots/import", h.ImportSnapshot)
-			r.Post("/forge", h.Forge)
-			r.Post("/teardown", h.Teardown)
-			r.Post("/endpoints/toggle", h.ToggleEndpoint)
-			r.Get("/exec", h.ExecAlloc)
+		// Everything else: viewers read, deployers write, and the routes
+		// below raise the bar to operator or admin where it matters.
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequireByMethod(auth.RoleViewer, auth.RoleDeployer))
+			r.Use(handler.ScopeWrites)
+			operator := r.With(auth.Require(auth.RoleOperator))
+			admin := r.With(auth.Require(auth.RoleAdmin))
+
+			r.Get("/auth/whoami", h.WhoAmI)
+			r.Get("/auth/tokens", h.ListAPITokens)
+			r.Post("/auth/tokens", h.CreateAPIToken)
+			r.Delete("/auth/tokens/{id}", h.RevokeAPIToken)
+			admin.Get("/auth/users", h.ListUsers)
+			admin.Post("/auth/users", h.UpsertUser)
+			operator.Get("/audit", h.ListAudit)
+			operator.Get("/audit/verify", h.VerifyAudit)
+
+			r.Get("/webhooks/deliveries", h.ListWebhookDeliveries)
+			operator.Post("/webhooks/deliveries/{id}/replay", h.ReplayWebhookDelivery)
+
+			r.Get("/stats", h.Stats)
+			r.Get("/stream", ws.HandleStream)
+			r.Get("/ws", ws.HandleConnect)
+			r.Get("/observability/bundle", h.ObservabilityBundle)
+			r.Get("/observability/alerts.yml", h.PrometheusAlerts)
+			r.Get("/observability/prometheus.yml", h.PrometheusConfig)
+			operator.Post("/observability/services/install", h.ObservabilityServicesInstall)
+			r.Get("/services/manifest", h.ServiceManifest)
+			r.Get("/ops/platform", h.PlatformOps)
+			r.Get("/operator/inbox", h.OperatorInbox)
+			r.Get("/operator/cron", h.OperatorCronOverview)
+			r.Get("/operator/wake-targets", h.OperatorWakeTargets)
+			r.Get("/operator/deploy-confidence", h.OperatorDeployConfidence)
+			r.Get("/operator/snapshot-readiness", h.OperatorSnapshotReadiness)
+			r.Get("/operator/auth-hints", h.OperatorAuthHints)
+			r.Get("/operator/actions", h.OperatorActions)
+			r.Get("/platform/releases", h.PlatformReleases)
+			admin.Post("/platform/releases/{sha}/rollback", h.PlatformRollbackRelease)
+			r.Get("/ops/contextdb", h.ContextDBOps)
+			operator.Post("/ops/contextdb/feedback/{eventID}/rollback", h.ContextDBRollbackFeedback)
+			r.Get("/apps", h.ListApps)
+			r.Get("/deployments", h.ListDeployments)
+			r.Get("/deployments/{id}/steps", h.ListDeploymentSteps)
+			r.Get("/operations", h.ListOperations)
+			r.Get("/operations/active", h.ActiveOperations)
+			r.Get("/alerts/rules", h.AlertRules)
+			r.Get("/resources/suggestions", h.ResourceSuggestions)
+			r.Get("/tuning/recommendations", h.TuningRecommendations)
+			r.Get("/tuning/changes", h.TuningChanges)
+			r.Get("/events", h.ListEvents)
+			r.Post("/events", h.CreateEvent)
+			r.Get("/events/active", h.ActiveIncidents)
+			r.Get("/events/correlated", h.CorrelatedEvents)
+			operator.Post("/events/reconcile", h.ReconcileEvents)
+			r.Get("/events/{id}", h.GetEvent)
+			r.Post("/events/{id}/ack", h.AcknowledgeEvent)
+			r.Post("/events/{id}/snooze", h.SnoozeEvent)
+			r.Post("/events/{id}/open", h.OpenEvent)
+			r.Get("/events/sinks", h.EventSinks)
+			r.Post("/events/test", h.TestEvent)
+			operator.Post("/incidents/action", h.IncidentAction)
+			r.Get("/validate", h.ValidateAll)
+			r.Get("/validate/{id}", h.ValidateApp)
+			r.Get("/secrets/status", h.SecretsStatusAll)
+			r.Get("/secrets/migration-plan", h.SecretsMigrationPlan)
+			r.Get("/saga", h.ListRecentSaga)
+			r.Get("/saga/{sagaId}", h.GetSagaEvents)
+			r.Get("/cloudflared/ingress", h.CloudflaredIngress)
+			r.Get("/access/events", h.AccessEvents)
+			r.Get("/access/patterns", h.AccessPatterns)
+			r.Post("/access/observations", h.RecordAccessObservations)
+			r.Get("/access/cloudflare/status", h.CloudflareAccessStatus)
+			operator.Post("/access/cloudflare/sync", h.CloudflareAccessSync)
+
+			r.Get("/notifications/channels", h.ListNotificationChannels)
+			operator.Post("/notifications/channels", h.CreateNotificationChannel)
+			operator.Post("/notifications/channels/bootstrap", h.BootstrapNotificationChannels)
+			r.Post("/notifications/channels/{id}/test", h.TestNotificationChannel)
+			operator.Delete("/notifications/channels/{id}", h.DeleteNotificationChannel)
+			r.Get("/deploy-groups", h.ListDeployGroups)
+			r.Post("/deploy-groups/{name}/deploy", h.DeployGroup)
+			r.Get("/previews", h.ListPreviews)
+
+			r.Get("/access/grants", h.ListAccessGrants)
+			admin.Post("/access/grants", h.CreateAccessGrant)
+			admin.Delete("/access/grants/{id}", h.DeleteAccessGrant)
+			r.Post("/access/tokens", h.CreateAccessToken)
+
+			r.Get("/ops/contextdb/evaluator-readiness", h.EvaluatorReadiness)
+
+			r.Route("/apps/{id}", func(r chi.Router) {
+				r.Use(handler.ValidateAppID)
+				operator := r.With(auth.Require(auth.RoleOperator))
+				admin := r.With(auth.Require(auth.RoleAdmin))
+
+				r.Get("/", h.GetApp)
+				r.Post("/preflight", h.Preflight)
+				r.Post("/deploy", h.Deploy)
+				r.Get("/logs", h.StreamLogs)
+				operator.Post("/restart", h.RestartApp)
+				operator.Post("/scale", h.ScaleApp)
+				r.Get("/scale/history", h.ScaleHistory)
+				r.Post("/rollback", h.Rollback)
+				r.Get("/environments", h.ListEnvironments)
+				r.Post("/environments/promote", h.PromoteEnvironment)
+				r.Get("/previews", h.ListPreviews)
+				operator.Delete("/previews/{number}", h.ClosePreview)
+				r.Get("/drift", h.GetDrift)
+				operator.Post("/drift/apply", h.ApplyDrift)
+				r.Get("/secrets", h.ListSecrets)
+				r.Get("/secrets/status", h.SecretsStatusApp)
+				r.Get("/secrets/versions", h.ListSecretVersions)
+				r.Get("/secrets/versions/diff", h.DiffSecretVersions)
+				operator.Put("/secrets", h.UpdateSecrets)
+				operator.Delete("/secrets/{key}", h.DeleteSecret)
+				operator.Post("/secrets/rotate-keys", h.RotateSecretKeys)
+				operator.Post("/secrets/migrate", h.MigrateSecrets)
+				operator.Post("/secrets/versions/{version}/rollback", h.RollbackSecrets)
+				r.Get("/credentials/rotations", h.ListCredentialRotations)
+				operator.Post("/credentials/rotate", h.RotateCredentials)
+				r.Get("/snapshots", h.ListSnapshots)
+				operator.Post("/snapshots/retention", h.ApplySnapshotRetention)
+				admin.Post("/snapshots/{ts}/restore", h.RestoreSnapshot)
+				r.Get("/cron/history", h.CronHistory)
+				r.Post("/cron/trigger", h.CronTrigger)
+				operator.Post("/cron/pause", h.CronPause)
+				operator.Post("/cron/resume", h.CronResume)
+				operator.Put("/cron/schedule", h.CronUpdateSchedule)
+				r.Post("/invoke", h.InvokeFunction)
+				r.Get("/function/history", h.FunctionHistory)
+				r.Get("/canary", h.CanaryStatus)
+				r.Post("/promote", h.PromoteCanary)
+				operator.Post("/snapshots/export", h.ExportSnapshot)
+				r.Get("/snapshots/remote", h.ListRemoteSnapshots)
+				admin.Post("/snapshots/import", h.ImportSnapshot)
+				operator.Post("/forge", h.Forge)
+				admin.Post("/teardown", h.Teardown)
+				operator.Post("/endpoints/toggle", h.ToggleEndpoint)
+				operator.Get("/exec", h.ExecAlloc)
+			})
 		})
 	})
 
-	r.Get("/ws", ws.HandleConnect)
-
 	// Serve UI static files
 	if cfg.UIDir != "" {
 		fileServer(r, cfg.UIDir)
@@ -382,55 +481,6 @@ func main() {
 	srv.Shutdown(shutdownCtx)
 }
 
-func bearerAuth(token string, h *handler.Handler) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api/metrics" || r.URL.Path == "/api/health" || r.URL.Path == "/api/version" || r.URL.Path == "/api/webhooks/github" || r.URL.Path == "/api/webhooks/gitea" || strings.HasPrefix(r.URL.Path, "/api/a/") || strings.HasPrefix(r.URL.Path, "/api/wake-gateway/") || r.URL.Path == "/api/access/cloudflare/logpush" || strings.HasSuffix(r.URL.Path, "/exec") {
-				next.ServeHTTP(w, r)
-				return
-			}
-			auth := r.Header.Get("Authorization")
-			if strings.HasPrefix(auth, "Bearer ") && subtle.ConstantTimeCompare([]byte(auth[7:]), []byte(token)) == 1 {
-				next.ServeHTTP(w, r)
-				return
-			}
-			if strings.HasPrefix(auth, "Bearer ") && h != nil && h.VerifyAccessToken(auth[7:]) {
-				next.ServeHTTP(w, r)
-				return
-			}
-			if qToken := r.URL.Query().Get("token"); qToken != "" && h != nil && h.VerifyAccessToken(qToken) {
-				next.ServeHTTP(w, r)
-				return
-			}
-			ip := clientIPFromRequest(r)
-			if loopback := net.ParseIP(ip); loopback != nil && loopback.IsLoopback() {
-				next.ServeHTTP(w, r)
-				return
-			}
-			if h != nil && h.HasActiveGrant(ip) {
-				next.ServeHTTP(w, r)
-				return
-			}
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-		})
-	}
-}
-
-func clientIPFromRequest(r *http.Request) string {
-	if cfIP := strings.TrimSpace(r.Header.Get("CF-Connecting-IP")); cfIP != "" {
-		return cfIP
-	}
-	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
-		parts := strings.Split(forwarded, ",")
-		return strings.TrimSpace(parts[0])
-	}
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
-	}
-	return host
-}
-
 func fileServer(r chi.Router, dir string) {
 	fs := http.FileServer(http.Dir(dir))
 	r.Get("/*", func(w http.ResponseWriter, r *http.Request) {
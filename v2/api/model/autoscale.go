@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+// Autoscaler metrics.
+const (
+	AutoScaleCPU      = "cpu"
+	AutoScaleMemory   = "memory"
+	AutoScaleKafkaLag = "kafka_lag"
+	AutoScaleCustom   = "custom"
+)
+
+// Autoscaler timing defaults, used when the matching AutoScale field is
+// unset. Scaling up reacts at once; scaling down waits for the load to stay
+// low for five minutes.
+const (
+	DefaultScaleUpWindow   = 0
+	DefaultScaleDownWindow = 5 * time.Minute
+	DefaultScaleCooldown   = time.Minute
+)
+
+// Autoscales reports whether the autoscaler sizes the process.
+func (s *Scaling) Autoscales() bool {
+	return s != nil && s.Auto != nil && s.Auto.Metric != "" && s.Auto.Target > 0 && s.Max > 0
+}
+
+// UpWindow returns the scale-up stabilisation window.
+func (a *AutoScale) UpWindow() time.Duration {
+	return autoScaleDuration(a.ScaleUpWindow, DefaultScaleUpWindow)
+}
+
+// DownWindow returns the scale-down stabilisation window.
+func (a *AutoScale) DownWindow() time.Duration {
+	return autoScaleDuration(a.ScaleDownWindow, DefaultScaleDownWindow)
+}
+
+// CooldownPeriod returns the least time between two changes of the count.
+func (a *AutoScale) CooldownPeriod() time.Duration {
+	return autoScaleDuration(a.Cooldown, DefaultScaleCooldown)
+}
+
+func autoScaleDuration(value string, fallback time.Duration) time.Duration {
+	if value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return fallback
+}
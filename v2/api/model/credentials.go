@@ -0,0 +1,75 @@
+package model
+
+import "time"
+
+// Credential services Norn can rotate.
+const (
+	CredentialPostgres      = "postgres"
+	CredentialObjectStorage = "objectStorage"
+	CredentialKafka         = "kafka"
+)
+
+// CredentialServices lists the rotatable services in rotation order.
+var CredentialServices = []string{CredentialPostgres, CredentialObjectStorage, CredentialKafka}
+
+// MinRotationInterval is the shortest schedule credentialRotation.every
+// accepts.
+const MinRotationInterval = time.Hour
+
+// CredentialRotation schedules rotation of the credentials Norn provisions
+// for an app's backing services. Rotation can always be run on demand.
+type CredentialRotation struct {
+	// Every is how often to rotate, e.g. 720h. Empty rotates only on demand.
+	Every string `yaml:"every,omitempty" json:"every,omitempty"`
+	// Services limits rotation to some of postgres, objectStorage and kafka.
+	// Empty rotates every one the app declares.
+	Services []string `yaml:"services,omitempty" json:"services,omitempty"`
+}
+
+// RotationInterval returns the credential rotation schedule, or 0 when
+// rotation is on demand only.
+func (s *InfraSpec) RotationInterval() time.Duration {
+	if s.CredentialRotation == nil || s.CredentialRotation.Every == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(s.CredentialRotation.Every)
+	if err != nil || d < MinRotationInterval {
+		return 0
+	}
+	return d
+}
+
+// RotatableCredentials returns the declared backing services whose
+// credentials rotation covers, in rotation order.
+func (s *InfraSpec) RotatableCredentials() []string {
+	var selected map[string]bool
+	if s.CredentialRotation != nil && len(s.CredentialRotation.Services) > 0 {
+		selected = map[string]bool{}
+		for _, name := range s.CredentialRotation.Services {
+			selected[name] = true
+		}
+	}
+	var out []string
+	for _, name := range CredentialServices {
+		if s.declaresCredential(name) && (selected == nil || selected[name]) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func (s *InfraSpec) declaresCredential(name string) bool {
+	infra := s.Infrastructure
+	if infra == nil {
+		return false
+	}
+	switch name {
+	case CredentialPostgres:
+		return infra.Postgres != nil
+	case CredentialObjectStorage:
+		return infra.ObjectStorage != nil
+	case CredentialKafka:
+		return infra.Kafka != nil
+	}
+	return false
+}
@@ -4,18 +4,94 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"gopkg.in/yaml.v3"
 )
 
 type DeployGroup struct {
-	Name string           `yaml:"name" json:"name"`
-	Apps []DeployGroupApp `yaml:"apps" json:"apps"`
+	Name              string           `yaml:"name" json:"name"`
+	Apps              []DeployGroupApp `yaml:"apps" json:"apps"`
+	RollbackOnFailure bool             `yaml:"rollbackOnFailure,omitempty" json:"rollbackOnFailure,omitempty"`
 }
 
 type DeployGroupApp struct {
-	App       string `yaml:"app" json:"app"`
-	WaitReady bool   `yaml:"waitReady,omitempty" json:"waitReady,omitempty"`
+	App       string   `yaml:"app" json:"app"`
+	DependsOn []string `yaml:"dependsOn,omitempty" json:"dependsOn,omitempty"`
+}
+
+// Waves orders the group's apps into dependency waves. Every app in a wave
+// depends only on apps in earlier waves; apps within a wave keep the order
+// they were declared in. Unknown dependencies, duplicates and cycles are errors.
+func (g *DeployGroup) Waves() ([][]DeployGroupApp, error) {
+	index := make(map[string]int, len(g.Apps))
+	for i, app := range g.Apps {
+		if app.App == "" {
+			return nil, fmt.Errorf("deploy group %s: app %d has no name", g.Name, i)
+		}
+		if _, ok := index[app.App]; ok {
+			return nil, fmt.Errorf("deploy group %s: app %s listed more than once", g.Name, app.App)
+		}
+		index[app.App] = i
+	}
+
+	pending := make(map[string]int, len(g.Apps))
+	dependents := make(map[string][]string, len(g.Apps))
+	for _, app := range g.Apps {
+		seen := make(map[string]bool, len(app.DependsOn))
+		for _, dep := range app.DependsOn {
+			if _, ok := index[dep]; !ok {
+				return nil, fmt.Errorf("deploy group %s: %s depends on %s, which is not in the group", g.Name, app.App, dep)
+			}
+			if dep == app.App {
+				return nil, fmt.Errorf("deploy group %s: %s depends on itself", g.Name, app.App)
+			}
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+			pending[app.App]++
+			dependents[dep] = append(dependents[dep], app.App)
+		}
+	}
+
+	var ready []string
+	for _, app := range g.Apps {
+		if pending[app.App] == 0 {
+			ready = append(ready, app.App)
+		}
+	}
+
+	var waves [][]DeployGroupApp
+	placed := 0
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return index[ready[i]] < index[ready[j]] })
+		wave := make([]DeployGroupApp, 0, len(ready))
+		var next []string
+		for _, name := range ready {
+			wave = append(wave, g.Apps[index[name]])
+			for _, dependent := range dependents[name] {
+				pending[dependent]--
+				if pending[dependent] == 0 {
+					next = append(next, dependent)
+				}
+			}
+		}
+		placed += len(wave)
+		waves = append(waves, wave)
+		ready = next
+	}
+
+	if placed != len(g.Apps) {
+		var stuck []string
+		for _, app := range g.Apps {
+			if pending[app.App] > 0 {
+				stuck = append(stuck, app.App)
+			}
+		}
+		return nil, fmt.Errorf("deploy group %s: dependency cycle between %v", g.Name, stuck)
+	}
+	return waves, nil
 }
 
 func LoadDeployGroup(path string) (*DeployGroup, error) {
@@ -30,6 +106,20 @@ func LoadDeployGroup(path string) (*DeployGroup, error) {
 	return &g, nil
 }
 
+// FindDeployGroup returns the named deploy group from appsDir.
+func FindDeployGroup(appsDir, name string) (*DeployGroup, error) {
+	groups, err := DiscoverDeployGroups(appsDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if g.Name == name {
+			return g, nil
+		}
+	}
+	return nil, fmt.Errorf("deploy group %s not found", name)
+}
+
 func DiscoverDeployGroups(appsDir string) ([]*DeployGroup, error) {
 	groupsDir := filepath.Join(appsDir, "deploy-groups")
 	entries, err := os.ReadDir(groupsDir)
@@ -0,0 +1,82 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDeployGroupWavesOrdersByDependencies(t *testing.T) {
+	group := &DeployGroup{
+		Name: "platform",
+		Apps: []DeployGroupApp{
+			{App: "web", DependsOn: []string{"api"}},
+			{App: "api", DependsOn: []string{"db-migrator", "auth"}},
+			{App: "auth"},
+			{App: "db-migrator"},
+			{App: "docs"},
+		},
+	}
+
+	waves, err := group.Waves()
+	if err != nil {
+		t.Fatalf("Waves() error = %v", err)
+	}
+	var got [][]string
+	for _, wave := range waves {
+		var names []string
+		for _, app := range wave {
+			names = append(names, app.App)
+		}
+		got = append(got, names)
+	}
+	want := [][]string{{"auth", "db-migrator", "docs"}, {"api"}, {"web"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("waves = %v, want %v", got, want)
+	}
+}
+
+func TestDeployGroupWavesRejectsCycles(t *testing.T) {
+	group := &DeployGroup{
+		Name: "loop",
+		Apps: []DeployGroupApp{
+			{App: "a", DependsOn: []string{"b"}},
+			{App: "b", DependsOn: []string{"a"}},
+			{App: "c"},
+		},
+	}
+
+	_, err := group.Waves()
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("Waves() error = %v, want cycle error", err)
+	}
+}
+
+func TestDeployGroupWavesRejectsUnknownDependency(t *testing.T) {
+	group := &DeployGroup{
+		Name: "broken",
+		Apps: []DeployGroupApp{{App: "web", DependsOn: []string{"api"}}},
+	}
+
+	_, err := group.Waves()
+	if err == nil || !strings.Contains(err.Error(), "not in the group") {
+		t.Fatalf("Waves() error = %v, want unknown dependency error", err)
+	}
+}
+
+func TestLoadDeployGroupIgnoresWaitReady(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "platform.yaml")
+	data := "name: platform\napps:\n  - app: api\n    waitReady: true\n  - app: web\n    dependsOn: [api]\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	group, err := LoadDeployGroup(path)
+	if err != nil {
+		t.Fatalf("a group written before waitReady was dropped should still load: %v", err)
+	}
+	if len(group.Apps) != 2 || group.Apps[1].DependsOn[0] != "api" {
+		t.Fatalf("apps = %+v", group.Apps)
+	}
+}
@@ -18,6 +18,7 @@ const (
 type Deployment struct {
 	ID            string       `json:"id"`
 	App           string       `json:"app"`
+	Environment   string       `json:"environment,omitempty"`
 	CommitSHA     string       `json:"commitSha"`
 	ImageTag      string       `json:"imageTag"`
 	SagaID        string       `json:"sagaId"`
@@ -26,6 +27,7 @@ type Deployment struct {
 	SourceRef     string       `json:"sourceRef,omitempty"`
 	SourceDirty   bool         `json:"sourceDirty,omitempty"`
 	SourceChanges []string     `json:"sourceChanges,omitempty"`
+	PromotedFrom  string       `json:"promotedFrom,omitempty"` // deployment whose image this one promoted
 	StartedAt     time.Time    `json:"startedAt"`
 	FinishedAt    *time.Time   `json:"finishedAt,omitempty"`
 }
@@ -55,6 +55,66 @@ func FindByRepoURL(specs []*InfraSpec, repoURL, branch string) *InfraSpec {
 	return nil
 }
 
+// FindPreviewApps returns the app specs with previews enabled whose repo
+// and branch match a pull request's repository and base branch.
+func FindPreviewApps(specs []*InfraSpec, repoURL, baseBranch string) []*InfraSpec {
+	return findPullRequestApps(specs, repoURL, baseBranch, (*InfraSpec).PreviewsEnabled)
+}
+
+// FindPreflightApps returns the app specs that preflight pull requests
+// against baseBranch of repoURL.
+func FindPreflightApps(specs []*InfraSpec, repoURL, baseBranch string) []*InfraSpec {
+	return findPullRequestApps(specs, repoURL, baseBranch, func(s *InfraSpec) bool {
+		return s.Repo != nil && s.Repo.PreflightPullRequests
+	})
+}
+
+func findPullRequestApps(specs []*InfraSpec, repoURL, baseBranch string, want func(*InfraSpec) bool) []*InfraSpec {
+	incoming := normalizeRepoPath(repoURL)
+	var out []*InfraSpec
+	for _, s := range specs {
+		if !want(s) {
+			continue
+		}
+		branch := s.Repo.Branch
+		if branch == "" {
+			branch = "main"
+		}
+		if branch != baseBranch {
+			continue
+		}
+		if normalizeRepoPath(s.Repo.URL) == incoming {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// ForgeProvider returns the forge hosting the repo.
+func (r *RepoSpec) ForgeProvider() string {
+	if r.Forge != "" {
+		return strings.ToLower(r.Forge)
+	}
+	if normalizeRepoHost(r.URL) == "github.com" {
+		return "github"
+	}
+	return "gitea"
+}
+
+// TrustsFork reports whether pull requests from the fork fullName
+// (owner/name) may be previewed and preflighted.
+func (r *RepoSpec) TrustsFork(fullName string) bool {
+	if fullName == "" {
+		return false
+	}
+	for _, fork := range r.TrustedForks {
+		if strings.EqualFold(fork, fullName) {
+			return true
+		}
+	}
+	return false
+}
+
 // normalizeRepoPath extracts the owner/repo path from a git URL,
 // stripping .git suffix, for comparison.
 func normalizeRepoPath(rawURL string) string {
@@ -79,3 +139,20 @@ func normalizeRepoPath(rawURL string) string {
 	path = strings.TrimSuffix(path, ".git")
 	return strings.ToLower(path)
 }
+
+// normalizeRepoHost returns the lowercased host of a git URL, without port.
+func normalizeRepoHost(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	if strings.HasPrefix(rawURL, "git@") {
+		host := strings.TrimPrefix(rawURL, "git@")
+		if idx := strings.Index(host, ":"); idx != -1 {
+			return strings.ToLower(host[:idx])
+		}
+		return ""
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
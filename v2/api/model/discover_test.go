@@ -0,0 +1,39 @@
+package model
+
+import "testing"
+
+func TestForgeProvider(t *testing.T) {
+	cases := map[string]RepoSpec{
+		"github":  {URL: "git@github.com:acme/shop.git"},
+		"gitea":   {URL: "https://git.example.com/acme/shop.git"},
+		"forgejo": {URL: "https://github.com/acme/shop.git", Forge: "Forgejo"},
+	}
+	for want, repo := range cases {
+		if got := repo.ForgeProvider(); got != want {
+			t.Fatalf("ForgeProvider(%s) = %s, want %s", repo.URL, got, want)
+		}
+	}
+}
+
+func TestFindPreflightApps(t *testing.T) {
+	shop := &InfraSpec{App: "shop", Repo: &RepoSpec{URL: "https://github.com/acme/shop.git", Branch: "main", PreflightPullRequests: true}}
+	worker := &InfraSpec{App: "shop-worker", Repo: &RepoSpec{URL: "https://github.com/acme/shop.git", PreflightPullRequests: true}}
+	blog := &InfraSpec{App: "blog", Repo: &RepoSpec{URL: "https://github.com/acme/shop.git", Branch: "main"}}
+	specs := []*InfraSpec{shop, worker, blog}
+
+	got := FindPreflightApps(specs, "git@github.com:acme/shop.git", "main")
+	if len(got) != 2 || got[0].App != "shop" || got[1].App != "shop-worker" {
+		t.Fatalf("matched %v", appNames(got))
+	}
+	if got := FindPreflightApps(specs, "https://github.com/acme/shop", "develop"); len(got) != 0 {
+		t.Fatalf("pull requests against other branches matched %v", appNames(got))
+	}
+}
+
+func appNames(specs []*InfraSpec) []string {
+	names := make([]string, len(specs))
+	for i, s := range specs {
+		names[i] = s.App
+	}
+	return names
+}
@@ -0,0 +1,70 @@
+package model
+
+import "time"
+
+// Drift statuses.
+const (
+	DriftInSync      = "in_sync"
+	DriftDrifted     = "drifted"
+	DriftNotDeployed = "not_deployed"
+)
+
+// Reconcile policies for DeployPolicy.Reconcile.
+const (
+	ReconcileReport = "report"
+	ReconcileApply  = "apply"
+)
+
+// DriftChange is one difference between the Nomad job an infraspec
+// translates to and the job Nomad is running. Env values are never
+// included, only the variable name, since most of them are secrets.
+type DriftChange struct {
+	Job   string `json:"job"`
+	Group string `json:"group,omitempty"`
+	Field string `json:"field"`
+	// Change is added, removed or changed, from the live job's point of
+	// view: added means the spec has something the live job lacks.
+	Change  string `json:"change"`
+	Desired string `json:"desired,omitempty"`
+	Live    string `json:"live,omitempty"`
+	// Image marks changes that need a new image and so a full deploy.
+	Image bool `json:"image,omitempty"`
+	// Endpoint changes are cloudflared routes, which the reconciler only
+	// reports: a route missing on purpose looks the same as drift.
+	Endpoint bool `json:"endpoint,omitempty"`
+}
+
+// DriftReport compares one app environment's infraspec with what runs.
+type DriftReport struct {
+	App         string        `json:"app"`
+	Environment string        `json:"environment,omitempty"`
+	JobID       string        `json:"jobId"`
+	Status      string        `json:"status"`
+	Image       string        `json:"image,omitempty"`
+	Changes     []DriftChange `json:"changes"`
+	CheckedAt   time.Time     `json:"checkedAt"`
+	// Applied is set when the reconciler resubmitted the job.
+	Applied bool   `json:"applied,omitempty"`
+	SagaID  string `json:"sagaId,omitempty"`
+	// Skipped says why drift was not applied.
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// JobChanges returns the changes a job resubmit would fix.
+func (r *DriftReport) JobChanges() []DriftChange {
+	var out []DriftChange
+	for _, c := range r.Changes {
+		if !c.Endpoint {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// ReconcilePolicy returns report or apply.
+func (s *InfraSpec) ReconcilePolicy() string {
+	if s.DeployPolicy != nil && s.DeployPolicy.Reconcile != "" {
+		return s.DeployPolicy.Reconcile
+	}
+	return ReconcileReport
+}
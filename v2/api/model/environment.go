@@ -0,0 +1,209 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// EnvironmentSpec overrides parts of an infraspec for one environment, such
+// as staging or production. Anything left unset is inherited from the base
+// spec.
+type EnvironmentSpec struct {
+	// Default marks the environment that deploys without --env target. Its
+	// Nomad job keeps the bare app name.
+	Default     bool                       `yaml:"default,omitempty" json:"default,omitempty"`
+	Env         map[string]string          `yaml:"env,omitempty" json:"-"`
+	SecretsFile string                     `yaml:"secretsFile,omitempty" json:"secretsFile,omitempty"`
+	SecretsPath string                     `yaml:"secretsPath,omitempty" json:"secretsPath,omitempty"`
+	Processes   map[string]ProcessOverride `yaml:"processes,omitempty" json:"processes,omitempty"`
+	Endpoints   []Endpoint                 `yaml:"endpoints,omitempty" json:"endpoints,omitempty"`
+	Postgres    *PostgresInfra             `yaml:"postgres,omitempty" json:"postgres,omitempty"`
+}
+
+// ProcessOverride replaces a process's scaling and resources and adds to its
+// env within one environment.
+type ProcessOverride struct {
+	Scaling   *Scaling          `yaml:"scaling,omitempty" json:"scaling,omitempty"`
+	Resources *Resources        `yaml:"resources,omitempty" json:"resources,omitempty"`
+	Env       map[string]string `yaml:"env,omitempty" json:"-"`
+}
+
+// EnvironmentNames returns the declared environments in sorted order.
+func (s *InfraSpec) EnvironmentNames() []string {
+	names := make([]string, 0, len(s.Environments))
+	for name := range s.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultEnvironment returns the environment marked default, or "".
+func (s *InfraSpec) DefaultEnvironment() string {
+	for _, name := range s.EnvironmentNames() {
+		if s.Environments[name].Default {
+			return name
+		}
+	}
+	return ""
+}
+
+// ForEnvironment returns a copy of the spec with the named environment's
+// overrides applied. An empty name selects the default environment, or the
+// base spec when none is marked default.
+func (s *InfraSpec) ForEnvironment(name string) (*InfraSpec, error) {
+	if name == "" {
+		name = s.DefaultEnvironment()
+		if name == "" {
+			return s, nil
+		}
+	}
+	env, ok := s.Environments[name]
+	if !ok {
+		if len(s.Environments) == 0 {
+			return nil, fmt.Errorf("app %s declares no environments", s.App)
+		}
+		return nil, fmt.Errorf("app %s has no environment %q (have: %s)", s.App, name, strings.Join(s.EnvironmentNames(), ", "))
+	}
+
+	out := *s
+	out.Environment = name
+	out.Env = mergeEnv(s.Env, env.Env)
+	out.Env["NORN_ENVIRONMENT"] = name
+
+	out.Processes = make(map[string]Process, len(s.Processes))
+	for procName, proc := range s.Processes {
+		if o, ok := env.Processes[procName]; ok {
+			if o.Scaling != nil {
+				scaling := *o.Scaling
+				if scaling.Min == 0 {
+					scaling.Min = 1
+				}
+				proc.Scaling = &scaling
+			}
+			if o.Resources != nil {
+				resources := *o.Resources
+				proc.Resources = &resources
+			}
+			if len(o.Env) > 0 {
+				proc.Env = mergeEnv(proc.Env, o.Env)
+			}
+		}
+		out.Processes[procName] = proc
+	}
+
+	// The top-level endpoints are the default environment's hostnames;
+	// routing them to another environment would take them over.
+	switch {
+	case len(env.Endpoints) > 0:
+		out.Endpoints = append([]Endpoint(nil), env.Endpoints...)
+	case !env.Default:
+		out.Endpoints = nil
+	}
+
+	if env.Postgres != nil && s.Infrastructure != nil && s.Infrastructure.Postgres != nil {
+		base := s.Infrastructure.Postgres.Database
+		infra := *s.Infrastructure
+		pg := *env.Postgres
+		infra.Postgres = &pg
+		out.Infrastructure = &infra
+		// Migrations that target the app database follow it. Any other
+		// database would be migrated by every environment's deploys.
+		if s.Migrations != nil && s.Migrations.Database != "" {
+			if s.Migrations.Database != base {
+				return nil, fmt.Errorf("environment %s overrides postgres, but migrations.database %s is shared by every environment", name, s.Migrations.Database)
+			}
+			m := *s.Migrations
+			m.Database = pg.Database
+			out.Migrations = &m
+		}
+	}
+	return &out, nil
+}
+
+// InheritsDatabase reports whether the spec is a non-default environment
+// that kept the base spec's postgres or migrations instead of overriding
+// postgres. That database belongs to the default environment, so the
+// environment's deploys must not snapshot, migrate or restore it.
+func (s *InfraSpec) InheritsDatabase() bool {
+	if s.Preview != nil || s.Environment == "" {
+		return false
+	}
+	env, ok := s.Environments[s.Environment]
+	if !ok || env.Default {
+		return false
+	}
+	basePostgres := s.Infrastructure != nil && s.Infrastructure.Postgres != nil
+	if env.Postgres != nil && basePostgres {
+		return false
+	}
+	return basePostgres || s.Migrations != nil
+}
+
+// JobID returns the Nomad job ID for the spec's environment. The default
+// environment keeps the bare app name; others are suffixed with their name.
+func (s *InfraSpec) JobID() string {
+	if s.Preview != nil {
+		return s.App + "-" + s.Environment
+	}
+	if s.Environment == "" || s.Environments[s.Environment].Default {
+		return s.App
+	}
+	return s.App + "-" + s.Environment
+}
+
+// HistoryEnvironments returns the environment values the spec's deployments
+// and secret versions are recorded under, its own first. The default
+// environment also owns the rows recorded as "" before the app declared
+// environments, so its rollbacks and secret history reach back across that
+// change.
+func (s *InfraSpec) HistoryEnvironments() []string {
+	if s.Preview == nil && s.Environment != "" && s.Environments[s.Environment].Default {
+		return []string{s.Environment, ""}
+	}
+	return []string{s.Environment}
+}
+
+// ReservesPorts reports whether the spec's processes bind their declared
+// ports on the host. Only the default environment does; other environments
+// and previews run beside it on dynamic ports.
+func (s *InfraSpec) ReservesPorts() bool {
+	if s.Preview != nil {
+		return false
+	}
+	return s.Environment == "" || s.Environments[s.Environment].Default
+}
+
+// SecretsFile returns the name of the SOPS file, relative to the app
+// directory, that holds the environment's secrets. Previews share their
+// parent environment's file.
+func (s *InfraSpec) SecretsFile() string {
+	if s.Preview != nil {
+		parent := *s
+		parent.Environment = s.Preview.Parent
+		parent.Preview = nil
+		return parent.SecretsFile()
+	}
+	if s.Environment != "" {
+		env := s.Environments[s.Environment]
+		if env.SecretsFile != "" {
+			return env.SecretsFile
+		}
+		if !env.Default {
+			return "secrets." + s.Environment + ".enc.yaml"
+		}
+	}
+	return "secrets.enc.yaml"
+}
+
+func mergeEnv(base, overrides map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(overrides)+1)
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
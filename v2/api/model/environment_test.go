@@ -0,0 +1,242 @@
+package model
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const environmentsSpec = `
+name: shop
+processes:
+  web:
+    port: 8080
+    scaling:
+      min: 3
+    env:
+      LOG_LEVEL: info
+migrations:
+  up: ./migrate up
+  database: shop
+infrastructure:
+  postgres:
+    database: shop
+endpoints:
+  - url: https://shop.example.com
+env:
+  FEATURE_X: "off"
+environments:
+  production:
+    default: true
+  staging:
+    env:
+      FEATURE_X: "on"
+    processes:
+      web:
+        scaling:
+          max: 2
+        resources:
+          memory: 256
+        env:
+          LOG_LEVEL: debug
+    endpoints:
+      - url: https://staging.shop.example.com
+    postgres:
+      database: shop_staging
+`
+
+func loadEnvironmentsSpec(t *testing.T) *InfraSpec {
+	t.Helper()
+	var spec InfraSpec
+	if err := yaml.Unmarshal([]byte(environmentsSpec), &spec); err != nil {
+		t.Fatal(err)
+	}
+	applyDefaults(&spec)
+	return &spec
+}
+
+func TestForEnvironmentAppliesOverrides(t *testing.T) {
+	base := loadEnvironmentsSpec(t)
+	staging, err := base.ForEnvironment("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if staging.JobID() != "shop-staging" {
+		t.Fatalf("job id = %q, want shop-staging", staging.JobID())
+	}
+	if staging.SecretsFile() != "secrets.staging.enc.yaml" {
+		t.Fatalf("secrets file = %q", staging.SecretsFile())
+	}
+	if staging.Env["FEATURE_X"] != "on" || staging.Env["NORN_ENVIRONMENT"] != "staging" {
+		t.Fatalf("env = %v", staging.Env)
+	}
+	web := staging.Processes["web"]
+	if web.Scaling.Min != 1 || web.Scaling.Max != 2 {
+		t.Fatalf("scaling = %+v, want min 1 max 2", web.Scaling)
+	}
+	if web.Resources.Memory != 256 || web.Env["LOG_LEVEL"] != "debug" {
+		t.Fatalf("process = %+v", web)
+	}
+	if staging.Endpoints[0].URL != "https://staging.shop.example.com" {
+		t.Fatalf("endpoints = %+v", staging.Endpoints)
+	}
+	if staging.Infrastructure.Postgres.Database != "shop_staging" || staging.MigrationDatabase() != "shop_staging" {
+		t.Fatalf("database = %s, migrations = %s", staging.Infrastructure.Postgres.Database, staging.MigrationDatabase())
+	}
+
+	// The base spec is untouched.
+	if base.Processes["web"].Scaling.Min != 3 || base.Env["FEATURE_X"] != "off" || base.Infrastructure.Postgres.Database != "shop" {
+		t.Fatalf("base spec was modified: %+v", base)
+	}
+}
+
+func TestForEnvironmentDefaultKeepsBareJobID(t *testing.T) {
+	base := loadEnvironmentsSpec(t)
+	prod, err := base.ForEnvironment("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prod.Environment != "production" || prod.JobID() != "shop" || prod.SecretsFile() != "secrets.enc.yaml" {
+		t.Fatalf("default environment = %q job %q secrets %q", prod.Environment, prod.JobID(), prod.SecretsFile())
+	}
+
+	if _, err := base.ForEnvironment("qa"); err == nil || !strings.Contains(err.Error(), "production, staging") {
+		t.Fatalf("unknown environment error = %v", err)
+	}
+}
+
+func TestDefaultEnvironmentHistoryReachesBeforeEnvironments(t *testing.T) {
+	base := loadEnvironmentsSpec(t)
+
+	// Deployments made before the app declared environments were recorded
+	// under the base spec's environment.
+	before := *base
+	before.Environments = nil
+	old, err := before.ForEnvironment("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldDeploy := Deployment{App: "shop", Environment: old.Environment}
+
+	prod, err := base.ForEnvironment("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := prod.HistoryEnvironments()
+	if history[0] != "production" {
+		t.Fatalf("production records under %q", history[0])
+	}
+	if !slices.Contains(history, oldDeploy.Environment) {
+		t.Fatalf("production history %q cannot roll back to a deployment from before environments", history)
+	}
+
+	staging, err := base.ForEnvironment("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(staging.HistoryEnvironments(), oldDeploy.Environment) {
+		t.Fatalf("staging history %q would roll back to production's deployments", staging.HistoryEnvironments())
+	}
+}
+
+func TestForEnvironmentRefusesSharedMigrationDatabase(t *testing.T) {
+	base := loadEnvironmentsSpec(t)
+	base.Migrations.Database = "shop_shared"
+	if _, err := base.ForEnvironment("staging"); err == nil || !strings.Contains(err.Error(), "shop_shared") {
+		t.Fatalf("err = %v, want a refusal to share shop_shared", err)
+	}
+	assertErrorFinding(t, ValidateSpec(base), "environments.staging.postgres")
+}
+
+func TestForEnvironmentKeepsTopLevelEndpointsForTheDefault(t *testing.T) {
+	base := loadEnvironmentsSpec(t)
+	base.Environments["qa"] = EnvironmentSpec{}
+
+	prod, _ := base.ForEnvironment("production")
+	if len(prod.Endpoints) != 1 || prod.Endpoints[0].URL != "https://shop.example.com" || !prod.ReservesPorts() {
+		t.Fatalf("production endpoints = %+v reserves ports = %v", prod.Endpoints, prod.ReservesPorts())
+	}
+	qa, err := base.ForEnvironment("qa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(qa.Endpoints) != 0 || qa.ReservesPorts() {
+		t.Fatalf("qa endpoints = %+v reserves ports = %v, want neither", qa.Endpoints, qa.ReservesPorts())
+	}
+}
+
+func TestValidateRejectsHostnamesSharedByEnvironments(t *testing.T) {
+	spec := loadEnvironmentsSpec(t)
+	spec.Environments["qa"] = EnvironmentSpec{Endpoints: []Endpoint{{URL: "https://SHOP.example.com/"}}}
+	spec.Environments["demo"] = EnvironmentSpec{Endpoints: []Endpoint{{URL: "https://staging.shop.example.com"}}}
+
+	result := ValidateSpec(spec)
+	assertErrorFinding(t, result, "environments.qa.endpoints[0].url")
+	assertErrorFinding(t, result, "environments.staging.endpoints[0].url")
+	for _, f := range result.Findings {
+		if f.Field == "endpoints[0].url" && f.Severity == "error" {
+			t.Fatalf("unexpected finding %+v", f)
+		}
+	}
+}
+
+func TestValidateEnvironments(t *testing.T) {
+	spec := loadEnvironmentsSpec(t)
+	spec.Environments["Bad_Name"] = EnvironmentSpec{Default: true}
+	spec.Environments["qa"] = EnvironmentSpec{
+		SecretsFile: "../secrets.yaml",
+		Processes:   map[string]ProcessOverride{"worker": {}},
+	}
+
+	result := ValidateSpec(spec)
+	for _, field := range []string{"environments.Bad_Name", "environments.qa.secretsFile", "environments.qa.processes.worker", "environments"} {
+		assertErrorFinding(t, result, field)
+	}
+}
+
+func TestSecretsPathFollowsEnvironment(t *testing.T) {
+	base := loadEnvironmentsSpec(t)
+	base.SecretsBackend = &SecretsBackend{Type: SecretsBackendNomad}
+	prod, _ := base.ForEnvironment("")
+	staging, _ := base.ForEnvironment("staging")
+	if prod.SecretsPath() != "nomad/jobs/shop" || staging.SecretsPath() != "nomad/jobs/shop-staging" {
+		t.Fatalf("nomad paths = %q, %q", prod.SecretsPath(), staging.SecretsPath())
+	}
+
+	base.SecretsBackend = &SecretsBackend{Type: SecretsBackendVault, Path: "/teams/shop/"}
+	staging, _ = base.ForEnvironment("staging")
+	if staging.SecretsPath() != "teams/shop/staging" || staging.VaultMount() != DefaultVaultMount {
+		t.Fatalf("vault path = %q mount %q", staging.SecretsPath(), staging.VaultMount())
+	}
+	base.Environments["staging"] = EnvironmentSpec{SecretsPath: "shared/staging"}
+	staging, _ = base.ForEnvironment("staging")
+	if staging.SecretsPath() != "shared/staging" {
+		t.Fatalf("secretsPath override = %q", staging.SecretsPath())
+	}
+
+	base.SecretsBackend = &SecretsBackend{Type: "consul", Mount: "kv/v2"}
+	assertErrorFinding(t, ValidateSpec(base), "secretsBackend.type")
+}
+
+func TestEnvironmentWithoutPostgresInheritsDatabase(t *testing.T) {
+	base := loadEnvironmentsSpec(t)
+	base.Environments["qa"] = EnvironmentSpec{}
+
+	qa, err := base.ForEnvironment("qa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !qa.InheritsDatabase() {
+		t.Fatal("qa kept production's postgres and must not migrate it")
+	}
+	for _, name := range []string{"production", "staging"} {
+		env, _ := base.ForEnvironment(name)
+		if env.InheritsDatabase() {
+			t.Fatalf("%s owns its database", name)
+		}
+	}
+	assertErrorFinding(t, ValidateSpec(base), "environments.qa.postgres")
+}
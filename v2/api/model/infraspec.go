@@ -2,16 +2,11 @@ package model
 
 import (
 	"os"
+	"sort"
 
 	"gopkg.in/yaml.v3"
 )
 
-type VolumeSpec struct {
-	Name     string `yaml:"name" json:"name"`
-	Mount    string `yaml:"mount" json:"mount"`
-	ReadOnly bool   `yaml:"readOnly,omitempty" json:"readOnly,omitempty"`
-}
-
 type FunctionSpec struct {
 	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
 	Memory  int    `yaml:"memory,omitempty" json:"memory,omitempty"`
@@ -24,7 +19,8 @@ type InfraSpec struct {
 	Processes      map[string]Process `yaml:"processes" json:"processes"`
 	Services       []string           `yaml:"services,omitempty" json:"services,omitempty"`
 	Secrets        []string           `yaml:"secrets,omitempty" json:"secrets,omitempty"`
-	Migrations     string             `yaml:"migrations,omitempty" json:"migrations,omitempty"`
+	SecretsBackend *SecretsBackend    `yaml:"secretsBackend,omitempty" json:"secretsBackend,omitempty"`
+	Migrations     *MigrationSpec     `yaml:"migrations,omitempty" json:"migrations,omitempty"`
 	Env            map[string]string  `yaml:"env,omitempty" json:"-"`
 	Infrastructure *Infrastructure    `yaml:"infrastructure,omitempty" json:"infrastructure,omitempty"`
 	Endpoints      []Endpoint         `yaml:"endpoints,omitempty" json:"endpoints,omitempty"`
@@ -32,6 +28,14 @@ type InfraSpec struct {
 	Snapshots      *SnapshotPolicy    `yaml:"snapshots,omitempty" json:"snapshots,omitempty"`
 	Deploy         bool               `yaml:"deploy,omitempty" json:"deploy,omitempty"`
 	DeployPolicy   *DeployPolicy      `yaml:"deployPolicy,omitempty" json:"deployPolicy,omitempty"`
+
+	CredentialRotation *CredentialRotation `yaml:"credentialRotation,omitempty" json:"credentialRotation,omitempty"`
+
+	Environments map[string]EnvironmentSpec `yaml:"environments,omitempty" json:"environments,omitempty"`
+	// Environment is the environment ForEnvironment resolved, if any.
+	Environment string `yaml:"-" json:"environment,omitempty"`
+	// Preview is set on specs resolved by ForPreview.
+	Preview *PreviewTarget `yaml:"-" json:"preview,omitempty"`
 }
 
 type Endpoint struct {
@@ -52,6 +56,11 @@ type Process struct {
 	Resources *Resources        `yaml:"resources,omitempty" json:"resources,omitempty"`
 	Tuning    *TuningPolicy     `yaml:"tuning,omitempty" json:"tuning,omitempty"`
 	Canary    *CanaryConfig     `yaml:"canary,omitempty" json:"canary,omitempty"`
+	Placement *Placement        `yaml:"placement,omitempty" json:"placement,omitempty"`
+	Tasks     []ProcessTask     `yaml:"tasks,omitempty" json:"tasks,omitempty"`
+	Mesh      *MeshSpec         `yaml:"mesh,omitempty" json:"mesh,omitempty"`
+	Restart   *RestartSpec      `yaml:"restart,omitempty" json:"restart,omitempty"`
+	Update    *UpdateSpec       `yaml:"update,omitempty" json:"update,omitempty"`
 	Env       map[string]string `yaml:"env,omitempty" json:"-"`
 }
 
@@ -85,12 +94,31 @@ type Scaling struct {
 	Max       int        `yaml:"max,omitempty" json:"max,omitempty"`
 	PerRegion int        `yaml:"per_region,omitempty" json:"perRegion,omitempty"`
 	Auto      *AutoScale `yaml:"auto,omitempty" json:"auto,omitempty"`
+	// ScaleToZero lets the idle reaper stop the process once no request has
+	// reached it for IdleTimeout; the wake gateway starts it again.
+	ScaleToZero bool   `yaml:"scaleToZero,omitempty" json:"scaleToZero,omitempty"`
+	IdleTimeout string `yaml:"idleTimeout,omitempty" json:"idleTimeout,omitempty"`
 }
 
+// AutoScale lets the autoscaler size a process between Scaling.Min and
+// Scaling.Max so each instance carries about Target of Metric: percent of
+// its CPU or memory reservation, messages of consumer lag, or units of an
+// app-exported metric.
 type AutoScale struct {
 	Metric string `yaml:"metric" json:"metric"` // cpu, memory, kafka_lag, custom
 	Target int    `yaml:"target" json:"target"`
 	Topic  string `yaml:"topic,omitempty" json:"topic,omitempty"`
+	Group  string `yaml:"group,omitempty" json:"group,omitempty"` // kafka_lag consumer group
+	// Query names the series custom reads from each instance's metrics
+	// endpoint, optionally with labels: queue_depth{queue="mail"}. Target
+	// is its value per instance.
+	Query string `yaml:"query,omitempty" json:"query,omitempty"`
+	// ScaleUpWindow and ScaleDownWindow hold a change back until every
+	// recommendation over the window agrees with it.
+	ScaleUpWindow   string `yaml:"scaleUpWindow,omitempty" json:"scaleUpWindow,omitempty"`
+	ScaleDownWindow string `yaml:"scaleDownWindow,omitempty" json:"scaleDownWindow,omitempty"`
+	// Cooldown is the least time between two changes of the count.
+	Cooldown string `yaml:"cooldown,omitempty" json:"cooldown,omitempty"`
 }
 
 type Drain struct {
@@ -109,6 +137,9 @@ type TuningPolicy struct {
 	Profiles map[string]TuningProfile `yaml:"profiles,omitempty" json:"profiles,omitempty"`
 	Limits   *TuningLimits            `yaml:"limits,omitempty" json:"limits,omitempty"`
 	Signals  []TuningSignal           `yaml:"signals,omitempty" json:"signals,omitempty"`
+	// RevertWindow is how long the tuner watches an applied change for OOM
+	// kills and failed health before keeping it.
+	RevertWindow string `yaml:"revertWindow,omitempty" json:"revertWindow,omitempty"`
 }
 
 type TuningProfile struct {
@@ -127,7 +158,9 @@ type TuningSignal struct {
 	Source    string `yaml:"source,omitempty" json:"source,omitempty"`       // nomad, prometheus, app
 	Metric    string `yaml:"metric,omitempty" json:"metric,omitempty"`       // memory_rss, memory_max, cpu_percent, custom
 	Window    string `yaml:"window,omitempty" json:"window,omitempty"`       // e.g. 30m, 24h
-	Aggregate string `yaml:"aggregate,omitempty" json:"aggregate,omitempty"` // current, max, p95
+	Aggregate string `yaml:"aggregate,omitempty" json:"aggregate,omitempty"` // current, max, avg, p95
+	// Query is the PromQL expression of a prometheus signal with metric custom.
+	Query string `yaml:"query,omitempty" json:"query,omitempty"`
 }
 
 type RepoSpec struct {
@@ -135,11 +168,45 @@ type RepoSpec struct {
 	Branch     string `yaml:"branch,omitempty" json:"branch,omitempty"`
 	AutoDeploy bool   `yaml:"autoDeploy,omitempty" json:"autoDeploy,omitempty"`
 	RepoWeb    string `yaml:"repoWeb,omitempty" json:"repoWeb,omitempty"`
+	// Forge is the API deploy results are reported to: github or gitea.
+	// Empty infers github for github.com and gitea for any other host.
+	Forge string `yaml:"forge,omitempty" json:"forge,omitempty"`
+	// PreflightPullRequests preflights the head of every pull request
+	// against Branch so merges can be gated on its commit status.
+	PreflightPullRequests bool `yaml:"preflightPullRequests,omitempty" json:"preflightPullRequests,omitempty"`
+	// TrustedForks are the forks (owner/name) whose pull requests are
+	// previewed and preflighted. Pull requests from other forks are not:
+	// their head would be built and run with the app's secrets.
+	TrustedForks []string `yaml:"trustedForks,omitempty" json:"trustedForks,omitempty"`
+
+	Previews *PreviewPolicy `yaml:"previews,omitempty" json:"previews,omitempty"`
 }
 
 type BuildSpec struct {
-	Dockerfile string `yaml:"dockerfile,omitempty" json:"dockerfile,omitempty"`
-	Test       string `yaml:"test,omitempty" json:"test,omitempty"`
+	Dockerfile string            `yaml:"dockerfile,omitempty" json:"dockerfile,omitempty"`
+	Test       string            `yaml:"test,omitempty" json:"test,omitempty"`
+	Backend    string            `yaml:"backend,omitempty" json:"backend,omitempty"`     // docker, buildkit, buildah
+	Platforms  []string          `yaml:"platforms,omitempty" json:"platforms,omitempty"` // e.g. linux/amd64
+	Args       map[string]string `yaml:"args,omitempty" json:"args,omitempty"`
+	Target     string            `yaml:"target,omitempty" json:"target,omitempty"`
+	CacheFrom  []string          `yaml:"cacheFrom,omitempty" json:"cacheFrom,omitempty"`
+	CacheTo    []string          `yaml:"cacheTo,omitempty" json:"cacheTo,omitempty"`
+	Secrets    []BuildSecret     `yaml:"secrets,omitempty" json:"secrets,omitempty"`
+}
+
+// BuildSecret mounts a secret into the build (RUN --mount=type=secret,id=...)
+// without baking it into a layer. The value comes from either a declared app
+// secret (Key) or a file in the source tree (Src).
+type BuildSecret struct {
+	ID  string `yaml:"id" json:"id"`
+	Key string `yaml:"key,omitempty" json:"key,omitempty"`
+	Src string `yaml:"src,omitempty" json:"src,omitempty"`
+}
+
+// ValidID reports whether the secret's ID is safe to use as a file name:
+// letters, digits, dots, dashes and underscores, and not . or ..
+func (s BuildSecret) ValidID() bool {
+	return buildSecretIDRe.MatchString(s.ID) && s.ID != "." && s.ID != ".."
 }
 
 type SnapshotPolicy struct {
@@ -151,11 +218,34 @@ type SnapshotPolicy struct {
 
 type DeployPolicy struct {
 	AutoRollback bool `yaml:"autoRollback,omitempty" json:"autoRollback,omitempty"`
+	// Reconcile is what the drift reconciler does when the running job no
+	// longer matches the spec: report (default) or apply.
+	Reconcile string `yaml:"reconcile,omitempty" json:"reconcile,omitempty"`
 }
 
 type CanaryConfig struct {
 	Count         int    `yaml:"count,omitempty" json:"count,omitempty"`
 	EvaluateAfter string `yaml:"evaluateAfter,omitempty" json:"evaluateAfter,omitempty"`
+
+	// Analysis thresholds. Error rates are ratios (0.05 = 5%) of 5xx responses.
+	MaxErrorRate         float64 `yaml:"maxErrorRate,omitempty" json:"maxErrorRate,omitempty"`
+	MaxErrorRateIncrease float64 `yaml:"maxErrorRateIncrease,omitempty" json:"maxErrorRateIncrease,omitempty"`
+	MaxLatencyRatio      float64 `yaml:"maxLatencyRatio,omitempty" json:"maxLatencyRatio,omitempty"`
+	MaxRestarts          int     `yaml:"maxRestarts,omitempty" json:"maxRestarts,omitempty"`
+	MinRequests          int64   `yaml:"minRequests,omitempty" json:"minRequests,omitempty"`
+	FailOnInconclusive   bool    `yaml:"failOnInconclusive,omitempty" json:"failOnInconclusive,omitempty"`
+	RequestMetric        string  `yaml:"requestMetric,omitempty" json:"requestMetric,omitempty"` // counter, default http_requests_total
+	LatencyMetric        string  `yaml:"latencyMetric,omitempty" json:"latencyMetric,omitempty"` // histogram, default http_request_duration_seconds
+
+	Steps []CanaryStep `yaml:"steps,omitempty" json:"steps,omitempty"`
+}
+
+// CanaryStep is one stage of a canary rollout: the share of the process's
+// mesh traffic routed to the canary and how long to analyse it before the
+// next step.
+type CanaryStep struct {
+	Weight int    `yaml:"weight" json:"weight"` // percent, 1-100
+	Pause  string `yaml:"pause,omitempty" json:"pause,omitempty"`
 }
 
 type Infrastructure struct {
@@ -241,10 +331,37 @@ func applyDefaults(spec *InfraSpec) {
 		if p.Resources == nil {
 			p.Resources = &Resources{CPU: 100, Memory: 128}
 		}
+		if p.Canary != nil {
+			applyCanaryDefaults(p.Canary)
+		}
 		spec.Processes[name] = p
 	}
 }
 
+func applyCanaryDefaults(c *CanaryConfig) {
+	if c.EvaluateAfter == "" {
+		c.EvaluateAfter = "2m"
+	}
+	if c.MaxErrorRate == 0 {
+		c.MaxErrorRate = 0.05
+	}
+	if c.MaxErrorRateIncrease == 0 {
+		c.MaxErrorRateIncrease = 0.02
+	}
+	if c.MaxLatencyRatio == 0 {
+		c.MaxLatencyRatio = 1.5
+	}
+	if c.MinRequests == 0 {
+		c.MinRequests = 20
+	}
+	if c.RequestMetric == "" {
+		c.RequestMetric = "http_requests_total"
+	}
+	if c.LatencyMetric == "" {
+		c.LatencyMetric = "http_request_duration_seconds"
+	}
+}
+
 // HasScheduledProcess returns true if any process has a cron schedule.
 func (s *InfraSpec) HasScheduledProcess() bool {
 	for _, p := range s.Processes {
@@ -275,3 +392,20 @@ func (s *InfraSpec) ProcessCount() int {
 	}
 	return count
 }
+
+// CanaryStepsProcess returns the first canary process, by name, that
+// declares steps, or "" when none does. A deploy walks every canary through
+// that process's steps.
+func (s *InfraSpec) CanaryStepsProcess() string {
+	var names []string
+	for name, p := range s.Processes {
+		if p.Canary != nil && p.Canary.Count > 0 && len(p.Canary.Steps) > 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
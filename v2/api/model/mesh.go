@@ -0,0 +1,113 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MeshSpec opts a process into the Consul Connect service mesh. The
+// process gets an Envoy sidecar, and each upstream is bound on a local
+// port that tunnels to the named service over mTLS.
+type MeshSpec struct {
+	Upstreams []MeshUpstream `yaml:"upstreams,omitempty" json:"upstreams,omitempty"`
+}
+
+// MeshUpstream is a Consul service the process calls, reachable at
+// 127.0.0.1:LocalPort inside its allocation.
+type MeshUpstream struct {
+	Service   string `yaml:"service" json:"service"`
+	LocalPort int    `yaml:"localPort" json:"localPort"`
+}
+
+// CanaryTag is the Consul tag canary instances of a meshed service register
+// with while a deployment is unpromoted. Canary steps split the service's
+// mesh traffic by it.
+const CanaryTag = "canary"
+
+// ServiceName is the Consul service a long-running process registers as
+// in the job jobID.
+func ServiceName(jobID, procName string) string {
+	return jobID + "-" + procName
+}
+
+// MeshServices returns the Consul services of spec's processes that can
+// join the mesh in jobID, sorted. Their Norn-managed intentions are the
+// ones a deploy of jobID reconciles.
+func MeshServices(jobID string, spec *InfraSpec) []string {
+	var out []string
+	for name, proc := range spec.Processes {
+		if proc.Schedule == "" && proc.Function == nil && proc.Port > 0 {
+			out = append(out, ServiceName(jobID, name))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// MeshGraph maps each meshed service of spec in jobID to the upstream
+// services it declares.
+func MeshGraph(jobID string, spec *InfraSpec) map[string][]string {
+	graph := map[string][]string{}
+	for name, proc := range spec.Processes {
+		if proc.Mesh == nil || proc.Schedule != "" || proc.Function != nil || proc.Port == 0 {
+			continue
+		}
+		source := ServiceName(jobID, name)
+		graph[source] = []string{}
+		for _, up := range proc.Mesh.Upstreams {
+			graph[source] = append(graph[source], up.Service)
+		}
+	}
+	return graph
+}
+
+// HasMesh reports whether any process of spec joins the mesh.
+func HasMesh(spec *InfraSpec) bool {
+	for _, proc := range spec.Processes {
+		if proc.Mesh != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func validateMesh(r *ValidationResult, field string, spec *InfraSpec, procName string, proc Process) {
+	if proc.Mesh == nil {
+		return
+	}
+	switch {
+	case proc.Schedule != "" || proc.Function != nil:
+		r.add("error", field, "mesh is only supported on long-running processes")
+		return
+	case proc.Port == 0:
+		r.add("error", field, "mesh requires a process port for the sidecar to front")
+	}
+
+	self := ServiceName(spec.App, procName)
+	services := map[string]bool{}
+	ports := map[int]bool{}
+	for i, up := range proc.Mesh.Upstreams {
+		f := fmt.Sprintf("%s.upstreams[%d]", field, i)
+		switch {
+		case up.Service == "":
+			r.add("error", f+".service", "upstream service is required")
+		case up.Service == self:
+			r.add("error", f+".service", fmt.Sprintf("%s cannot be its own upstream", self))
+		case services[up.Service]:
+			r.add("error", f+".service", fmt.Sprintf("duplicate upstream %s", up.Service))
+		}
+		services[up.Service] = true
+
+		switch {
+		case up.LocalPort < 1 || up.LocalPort > 65535:
+			r.add("error", f+".localPort", "localPort must be between 1 and 65535")
+		case up.LocalPort == proc.Port:
+			r.add("error", f+".localPort", fmt.Sprintf("localPort %d is the process's own port", up.LocalPort))
+		case proc.Metrics != nil && up.LocalPort == proc.Metrics.Port:
+			r.add("error", f+".localPort", fmt.Sprintf("localPort %d is the process's metrics port", up.LocalPort))
+		case ports[up.LocalPort]:
+			r.add("error", f+".localPort", fmt.Sprintf("localPort %d is bound by another upstream", up.LocalPort))
+		}
+		ports[up.LocalPort] = true
+	}
+}
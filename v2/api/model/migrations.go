@@ -0,0 +1,65 @@
+package model
+
+import (
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	MigrationRevertDown    = "down"
+	MigrationRevertRestore = "restore"
+	MigrationRevertNone    = "none"
+)
+
+// MigrationSpec describes how the pipeline applies and reverts schema
+// migrations. A plain string is accepted as shorthand for the up command.
+type MigrationSpec struct {
+	Up       string `yaml:"up" json:"up"`
+	Down     string `yaml:"down,omitempty" json:"down,omitempty"`
+	Plan     string `yaml:"plan,omitempty" json:"plan,omitempty"`
+	Version  string `yaml:"version,omitempty" json:"version,omitempty"` // prints the current schema version
+	Timeout  string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Database string `yaml:"database,omitempty" json:"database,omitempty"`
+	// OnFailure is how a deploy that fails after migrating reverts the
+	// schema: down, restore (the pre-deploy snapshot) or none. Defaults to
+	// none, since a restore discards every write made since the snapshot.
+	OnFailure string `yaml:"onFailure,omitempty" json:"onFailure,omitempty"`
+}
+
+func (m *MigrationSpec) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*m = MigrationSpec{Up: value.Value}
+		return nil
+	}
+	type plain MigrationSpec
+	return value.Decode((*plain)(m))
+}
+
+// TimeoutDuration returns the per-command timeout, 10 minutes by default.
+func (m *MigrationSpec) TimeoutDuration() time.Duration {
+	if d, err := time.ParseDuration(m.Timeout); err == nil && d > 0 {
+		return d
+	}
+	return 10 * time.Minute
+}
+
+// RevertPolicy returns OnFailure, or none when it is not set.
+func (m *MigrationSpec) RevertPolicy() string {
+	if m.OnFailure != "" {
+		return m.OnFailure
+	}
+	return MigrationRevertNone
+}
+
+// MigrationDatabase returns the database migrations target: migrations.database,
+// falling back to infrastructure.postgres.database.
+func (s *InfraSpec) MigrationDatabase() string {
+	if s.Migrations != nil && s.Migrations.Database != "" {
+		return s.Migrations.Database
+	}
+	if s.Infrastructure != nil && s.Infrastructure.Postgres != nil {
+		return s.Infrastructure.Postgres.Database
+	}
+	return ""
+}
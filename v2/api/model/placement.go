@@ -0,0 +1,411 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultDatacenter is where jobs run when no process lists datacenters.
+const DefaultDatacenter = "dc1"
+
+// Placement decides which Nomad client nodes a process may run on and how
+// its allocations spread across them.
+type Placement struct {
+	Datacenters []string              `yaml:"datacenters,omitempty" json:"datacenters,omitempty"`
+	Constraints []PlacementConstraint `yaml:"constraints,omitempty" json:"constraints,omitempty"`
+	Affinities  []PlacementAffinity   `yaml:"affinities,omitempty" json:"affinities,omitempty"`
+	Spread      []PlacementSpread     `yaml:"spread,omitempty" json:"spread,omitempty"`
+}
+
+// PlacementConstraint is a hard filter on nodes. Attribute is a node
+// attribute, meta key or node field, e.g. attr.cpu.arch, meta.gpu or
+// node.class; the ${...} interpolation form is accepted too.
+type PlacementConstraint struct {
+	Attribute string `yaml:"attribute,omitempty" json:"attribute,omitempty"`
+	Operator  string `yaml:"operator,omitempty" json:"operator,omitempty"` // default =
+	Value     string `yaml:"value,omitempty" json:"value,omitempty"`
+}
+
+// PlacementAffinity prefers (positive weight) or avoids (negative weight)
+// matching nodes without excluding the others.
+type PlacementAffinity struct {
+	Attribute string `yaml:"attribute" json:"attribute"`
+	Operator  string `yaml:"operator,omitempty" json:"operator,omitempty"`
+	Value     string `yaml:"value,omitempty" json:"value,omitempty"`
+	Weight    int    `yaml:"weight,omitempty" json:"weight,omitempty"` // -100..100, default 50
+}
+
+// PlacementSpread spreads allocations across the values of an attribute,
+// evenly or by target percentages.
+type PlacementSpread struct {
+	Attribute string         `yaml:"attribute" json:"attribute"`
+	Weight    int            `yaml:"weight,omitempty" json:"weight,omitempty"` // 1..100, default 50
+	Targets   []SpreadTarget `yaml:"targets,omitempty" json:"targets,omitempty"`
+}
+
+type SpreadTarget struct {
+	Value   string `yaml:"value" json:"value"`
+	Percent int    `yaml:"percent" json:"percent"`
+}
+
+// PlacementNode is a client node as placement sees it.
+type PlacementNode struct {
+	Name       string
+	Datacenter string
+	Class      string
+	Pool       string
+	Eligible   bool
+	Attributes map[string]string
+	Meta       map[string]string
+}
+
+// Constraint and affinity operators Nomad accepts.
+const (
+	OpDistinctHosts    = "distinct_hosts"
+	OpDistinctProperty = "distinct_property"
+	OpIsSet            = "is_set"
+	OpIsNotSet         = "is_not_set"
+)
+
+var placementOperators = map[string]bool{
+	"=": true, "==": true, "is": true, "!=": true, "not": true,
+	">": true, ">=": true, "<": true, "<=": true,
+	"regexp": true, "set_contains": true, "set_contains_all": true, "set_contains_any": true,
+	"version": true, "semver": true,
+	OpIsSet: true, OpIsNotSet: true, OpDistinctHosts: true, OpDistinctProperty: true,
+}
+
+var placementTargetRe = regexp.MustCompile(`^(attr|meta)\.[A-Za-z0-9_.\-]+$|^node\.(class|datacenter|pool|region|unique\.name|unique\.id)$`)
+
+// PlacementTarget returns attribute in Nomad's ${...} interpolation form.
+func PlacementTarget(attribute string) string {
+	attribute = strings.TrimSpace(attribute)
+	if attribute == "" || strings.HasPrefix(attribute, "${") {
+		return attribute
+	}
+	return "${" + attribute + "}"
+}
+
+// PlacementOperator returns op, or = when it is unset.
+func PlacementOperator(op string) string {
+	if op == "" {
+		return "="
+	}
+	return op
+}
+
+// ProcessDatacenters returns the datacenters a process may run in.
+func ProcessDatacenters(proc Process) []string {
+	if proc.Placement == nil || len(proc.Placement.Datacenters) == 0 {
+		return []string{DefaultDatacenter}
+	}
+	return proc.Placement.Datacenters
+}
+
+func validatePlacement(r *ValidationResult, field string, placement *Placement) {
+	if placement == nil {
+		return
+	}
+	for i, dc := range placement.Datacenters {
+		if strings.TrimSpace(dc) == "" {
+			r.add("error", fmt.Sprintf("%s.datacenters[%d]", field, i), "datacenter must not be empty")
+		}
+	}
+	for i, c := range placement.Constraints {
+		f := fmt.Sprintf("%s.constraints[%d]", field, i)
+		op := PlacementOperator(c.Operator)
+		if !placementOperators[op] {
+			r.add("error", f+".operator", fmt.Sprintf("unknown operator %q", c.Operator))
+			continue
+		}
+		if op != OpDistinctHosts {
+			validatePlacementAttribute(r, f+".attribute", c.Attribute)
+		}
+		if c.Value == "" && needsValue(op) {
+			r.add("error", f+".value", fmt.Sprintf("operator %s needs a value", op))
+		}
+		validatePlacementValue(r, f+".value", op, c.Value)
+	}
+	for i, a := range placement.Affinities {
+		f := fmt.Sprintf("%s.affinities[%d]", field, i)
+		op := PlacementOperator(a.Operator)
+		switch {
+		case !placementOperators[op]:
+			r.add("error", f+".operator", fmt.Sprintf("unknown operator %q", a.Operator))
+		case op == OpDistinctHosts || op == OpDistinctProperty || op == OpIsSet || op == OpIsNotSet:
+			r.add("error", f+".operator", fmt.Sprintf("operator %s is only valid in constraints", op))
+		case a.Value == "":
+			r.add("error", f+".value", "affinity value is required")
+		}
+		validatePlacementAttribute(r, f+".attribute", a.Attribute)
+		validatePlacementValue(r, f+".value", op, a.Value)
+		if a.Weight < -100 || a.Weight > 100 {
+			r.add("error", f+".weight", "affinity weight must be between -100 and 100")
+		}
+	}
+	for i, s := range placement.Spread {
+		f := fmt.Sprintf("%s.spread[%d]", field, i)
+		validatePlacementAttribute(r, f+".attribute", s.Attribute)
+		if s.Weight < 0 || s.Weight > 100 {
+			r.add("error", f+".weight", "spread weight must be between 1 and 100")
+		}
+		total := 0
+		for j, t := range s.Targets {
+			if t.Value == "" {
+				r.add("error", fmt.Sprintf("%s.targets[%d].value", f, j), "spread target value is required")
+			}
+			if t.Percent < 0 || t.Percent > 100 {
+				r.add("error", fmt.Sprintf("%s.targets[%d].percent", f, j), "spread target percent must be between 0 and 100")
+			}
+			total += t.Percent
+		}
+		if total > 100 {
+			r.add("error", f+".targets", fmt.Sprintf("spread target percents add up to %d, more than 100", total))
+		}
+	}
+}
+
+func validatePlacementAttribute(r *ValidationResult, field, attribute string) {
+	if attribute == "" {
+		r.add("error", field, "attribute is required")
+		return
+	}
+	inner := strings.TrimSuffix(strings.TrimPrefix(attribute, "${"), "}")
+	if !placementTargetRe.MatchString(inner) {
+		r.add("error", field, fmt.Sprintf("attribute %q must be attr.<name>, meta.<key> or node.class, node.datacenter, node.pool, node.region, node.unique.name or node.unique.id", attribute))
+	}
+}
+
+func validatePlacementValue(r *ValidationResult, field, op, value string) {
+	if op == "regexp" && value != "" {
+		if _, err := regexp.Compile(value); err != nil {
+			r.add("error", field, fmt.Sprintf("invalid regexp: %v", err))
+		}
+	}
+	if op == OpDistinctProperty && value != "" {
+		if n, err := strconv.Atoi(value); err != nil || n < 1 {
+			r.add("error", field, "distinct_property value is the allocations allowed per value, a positive integer")
+		}
+	}
+}
+
+func needsValue(op string) bool {
+	switch op {
+	case OpIsSet, OpIsNotSet, OpDistinctHosts, OpDistinctProperty:
+		return false
+	}
+	return true
+}
+
+// checkPlacement reports where a process's placement cannot be met by the
+// live node inventory: no eligible node satisfies its datacenters and
+// constraints, distinct_hosts needs more nodes than match, or an affinity
+// or spread attribute matches none of the candidate nodes. Operators it
+// cannot evaluate locally (version, semver) are assumed to match.
+func checkPlacement(r *ValidationResult, field string, proc Process, nodes []PlacementNode) {
+	p := proc.Placement
+	if p == nil {
+		return
+	}
+
+	datacenters := ProcessDatacenters(proc)
+	var candidates []PlacementNode
+	eligible := 0
+	for _, n := range nodes {
+		if !n.Eligible {
+			continue
+		}
+		eligible++
+		if contains(datacenters, n.Datacenter) && matchesConstraints(p.Constraints, n) {
+			candidates = append(candidates, n)
+		}
+	}
+	if len(candidates) == 0 {
+		r.add("error", field, fmt.Sprintf("no eligible node satisfies the placement (%d eligible node(s) checked; %s)", eligible, describeUnmet(p, datacenters, nodes)))
+		return
+	}
+
+	count := 1
+	if proc.Scaling != nil && proc.Scaling.Min > count {
+		count = proc.Scaling.Min
+	}
+	for i, c := range p.Constraints {
+		if c.Operator == OpDistinctHosts && c.Value != "false" && count > len(candidates) {
+			r.add("warning", fmt.Sprintf("%s.constraints[%d]", field, i), fmt.Sprintf("distinct_hosts needs %d node(s) but only %d match", count, len(candidates)))
+		}
+	}
+	for i, a := range p.Affinities {
+		matched := 0
+		for _, n := range candidates {
+			if matchesPlacement(a.Attribute, PlacementOperator(a.Operator), a.Value, n) {
+				matched++
+			}
+		}
+		if matched == 0 {
+			r.add("warning", fmt.Sprintf("%s.affinities[%d]", field, i), fmt.Sprintf("%s matches none of the %d candidate node(s)", describeRule(a.Attribute, a.Operator, a.Value), len(candidates)))
+		}
+	}
+	for i, s := range p.Spread {
+		values := map[string]bool{}
+		for _, n := range candidates {
+			if v, ok := nodeValue(s.Attribute, n); ok {
+				values[v] = true
+			}
+		}
+		switch {
+		case len(values) == 0:
+			r.add("warning", fmt.Sprintf("%s.spread[%d]", field, i), fmt.Sprintf("%s is not set on any candidate node", s.Attribute))
+		case len(values) == 1 && len(s.Targets) == 0:
+			r.add("info", fmt.Sprintf("%s.spread[%d]", field, i), fmt.Sprintf("every candidate node has the same %s, so allocations cannot spread", s.Attribute))
+		}
+	}
+}
+
+func matchesConstraints(constraints []PlacementConstraint, n PlacementNode) bool {
+	for _, c := range constraints {
+		if !matchesPlacement(c.Attribute, PlacementOperator(c.Operator), c.Value, n) {
+			return false
+		}
+	}
+	return true
+}
+
+// describeUnmet names the datacenter list or the first constraint that
+// filters out every node.
+func describeUnmet(p *Placement, datacenters []string, nodes []PlacementNode) string {
+	inDC := 0
+	for _, n := range nodes {
+		if n.Eligible && contains(datacenters, n.Datacenter) {
+			inDC++
+		}
+	}
+	if inDC == 0 {
+		return "none in datacenters " + strings.Join(datacenters, ", ")
+	}
+	for _, c := range p.Constraints {
+		matched := false
+		for _, n := range nodes {
+			if n.Eligible && contains(datacenters, n.Datacenter) && matchesPlacement(c.Attribute, PlacementOperator(c.Operator), c.Value, n) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return describeRule(c.Attribute, c.Operator, c.Value) + " matches none"
+		}
+	}
+	return "no node meets every constraint"
+}
+
+func describeRule(attribute, op, value string) string {
+	return strings.TrimSpace(PlacementTarget(attribute) + " " + PlacementOperator(op) + " " + value)
+}
+
+// nodeValue resolves an attribute against a node. ok is false when the
+// node does not set it.
+func nodeValue(attribute string, n PlacementNode) (string, bool) {
+	inner := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(attribute), "${"), "}")
+	switch {
+	case strings.HasPrefix(inner, "attr."):
+		v, ok := n.Attributes[strings.TrimPrefix(inner, "attr.")]
+		return v, ok
+	case strings.HasPrefix(inner, "meta."):
+		v, ok := n.Meta[strings.TrimPrefix(inner, "meta.")]
+		return v, ok
+	case inner == "node.class":
+		return n.Class, n.Class != ""
+	case inner == "node.datacenter":
+		return n.Datacenter, n.Datacenter != ""
+	case inner == "node.pool":
+		return n.Pool, n.Pool != ""
+	case inner == "node.unique.name":
+		return n.Name, n.Name != ""
+	}
+	return "", false
+}
+
+func matchesPlacement(attribute, op, value string, n PlacementNode) bool {
+	switch op {
+	case OpDistinctHosts, OpDistinctProperty, "version", "semver":
+		return true
+	}
+	if inner := strings.TrimSuffix(strings.TrimPrefix(attribute, "${"), "}"); inner == "node.region" || inner == "node.unique.id" {
+		// Not part of the inventory; leave it to the scheduler.
+		return true
+	}
+	actual, ok := nodeValue(attribute, n)
+	switch op {
+	case OpIsSet:
+		return ok
+	case OpIsNotSet:
+		return !ok
+	}
+	if !ok {
+		return op == "!=" || op == "not"
+	}
+	switch op {
+	case "=", "==", "is":
+		return actual == value
+	case "!=", "not":
+		return actual != value
+	case "regexp":
+		re, err := regexp.Compile(value)
+		return err == nil && re.MatchString(actual)
+	case "set_contains", "set_contains_all", "set_contains_any":
+		have := map[string]bool{}
+		for _, v := range strings.Split(actual, ",") {
+			have[strings.TrimSpace(v)] = true
+		}
+		for _, v := range strings.Split(value, ",") {
+			found := have[strings.TrimSpace(v)]
+			if op == "set_contains_any" && found {
+				return true
+			}
+			if op != "set_contains_any" && !found {
+				return false
+			}
+		}
+		return op != "set_contains_any"
+	case "<", "<=", ">", ">=":
+		return compareOrdered(actual, value, op)
+	}
+	return true
+}
+
+// compareOrdered compares numerically when both sides are numbers and
+// lexically otherwise, as Nomad does.
+func compareOrdered(actual, value, op string) bool {
+	cmp := strings.Compare(actual, value)
+	a, errA := strconv.ParseFloat(actual, 64)
+	b, errB := strconv.ParseFloat(value, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		default:
+			cmp = 0
+		}
+	}
+	switch op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
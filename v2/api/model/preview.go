@@ -0,0 +1,179 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultPreviewTTL is how long a preview lives after its last push when
+// repo.previews.ttl is unset.
+const DefaultPreviewTTL = 72 * time.Hour
+
+// PreviewPolicy turns pull requests against repo.branch into ephemeral
+// preview deployments.
+type PreviewPolicy struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Domain is the zone preview hostnames are generated under, e.g.
+	// preview.example.com serves PR 12 of shop at shop-pr-12.preview.example.com.
+	Domain string `yaml:"domain" json:"domain"`
+	// TTL tears a preview down this long after its last push, even when the
+	// pull request stays open.
+	TTL string `yaml:"ttl,omitempty" json:"ttl,omitempty"`
+	// Environment is the environment previews inherit overrides and secrets
+	// from; empty uses the default environment.
+	Environment string `yaml:"environment,omitempty" json:"environment,omitempty"`
+}
+
+// PreviewTarget identifies the pull request a preview spec was resolved for.
+type PreviewTarget struct {
+	Number int `json:"number"`
+	// Parent is the environment the preview inherits from.
+	Parent string `json:"parent,omitempty"`
+	// SourceDatabase is the database whose latest snapshot seeds the
+	// preview's throwaway copy.
+	SourceDatabase string `json:"sourceDatabase,omitempty"`
+	Hostname       string `json:"hostname,omitempty"`
+}
+
+type PreviewStatus string
+
+const (
+	PreviewDeploying PreviewStatus = "deploying"
+	PreviewReady     PreviewStatus = "ready"
+	PreviewFailed    PreviewStatus = "failed"
+	PreviewClosing   PreviewStatus = "closing"
+	PreviewClosed    PreviewStatus = "closed"
+)
+
+// Preview records one pull request's preview deployment.
+type Preview struct {
+	App          string        `json:"app"`
+	Number       int           `json:"number"`
+	Provider     string        `json:"provider"`
+	Repository   string        `json:"repository,omitempty"`
+	Branch       string        `json:"branch,omitempty"`
+	HeadSHA      string        `json:"headSha,omitempty"`
+	Title        string        `json:"title,omitempty"`
+	PullURL      string        `json:"pullUrl,omitempty"`
+	JobID        string        `json:"jobId"`
+	Hostname     string        `json:"hostname,omitempty"`
+	Database     string        `json:"database,omitempty"`
+	Status       PreviewStatus `json:"status"`
+	Reason       string        `json:"reason,omitempty"`
+	DeploymentID string        `json:"deploymentId,omitempty"`
+	SagaID       string        `json:"sagaId,omitempty"`
+	ExpiresAt    time.Time     `json:"expiresAt"`
+	ReadyAt      *time.Time    `json:"readyAt,omitempty"`
+	ClosedAt     *time.Time    `json:"closedAt,omitempty"`
+	CreatedAt    time.Time     `json:"createdAt"`
+	UpdatedAt    time.Time     `json:"updatedAt"`
+}
+
+// URL returns the preview's public address, or "" without a hostname.
+func (p *Preview) URL() string {
+	if p.Hostname == "" {
+		return ""
+	}
+	return "https://" + p.Hostname
+}
+
+// PreviewsEnabled reports whether pull requests get preview deployments.
+func (s *InfraSpec) PreviewsEnabled() bool {
+	return s.Repo != nil && s.Repo.Previews != nil && s.Repo.Previews.Enabled
+}
+
+// PreviewTTL returns repo.previews.ttl, or DefaultPreviewTTL when it is unset
+// or invalid.
+func (s *InfraSpec) PreviewTTL() time.Duration {
+	if s.Repo == nil || s.Repo.Previews == nil || s.Repo.Previews.TTL == "" {
+		return DefaultPreviewTTL
+	}
+	ttl, err := time.ParseDuration(s.Repo.Previews.TTL)
+	if err != nil || ttl <= 0 {
+		return DefaultPreviewTTL
+	}
+	return ttl
+}
+
+// ForPreview returns a copy of the spec for pull request number. It starts
+// from the environment previews inherit and then:
+//   - names the environment and Nomad job after the pull request,
+//   - runs one instance of each long-running process and no cron jobs or canaries,
+//   - swaps the endpoints for a single generated hostname,
+//   - drops host volumes configured on the client, which hold production
+//     data, and keeps managed ones, which get their own per-preview volume,
+//   - points postgres and migrations at a per-preview database.
+func (s *InfraSpec) ForPreview(number int) (*InfraSpec, error) {
+	if !s.PreviewsEnabled() {
+		return nil, fmt.Errorf("app %s does not enable repo.previews", s.App)
+	}
+	if number <= 0 {
+		return nil, fmt.Errorf("invalid pull request number %d", number)
+	}
+	policy := s.Repo.Previews
+	base, err := s.ForEnvironment(policy.Environment)
+	if err != nil {
+		return nil, err
+	}
+
+	out := *base
+	name := fmt.Sprintf("pr-%d", number)
+	hostname := fmt.Sprintf("%s-%s.%s", s.App, name, strings.Trim(policy.Domain, "."))
+	out.Environment = name
+	out.Preview = &PreviewTarget{
+		Number:   number,
+		Parent:   base.Environment,
+		Hostname: hostname,
+	}
+	out.Env = mergeEnv(base.Env, map[string]string{
+		"NORN_ENVIRONMENT": name,
+		"NORN_PREVIEW_URL": "https://" + hostname,
+	})
+
+	out.Processes = make(map[string]Process, len(base.Processes))
+	for procName, proc := range base.Processes {
+		if proc.Schedule != "" {
+			continue
+		}
+		if proc.Scaling != nil {
+			proc.Scaling = &Scaling{Min: 1, Max: 1}
+		}
+		proc.Canary = nil
+		out.Processes[procName] = proc
+	}
+
+	out.Endpoints = []Endpoint{{URL: "https://" + hostname}}
+
+	out.Volumes = nil
+	for _, vol := range base.Volumes {
+		if vol.Managed() {
+			out.Volumes = append(out.Volumes, vol)
+		}
+	}
+
+	if base.Infrastructure != nil && base.Infrastructure.Postgres != nil {
+		source := base.Infrastructure.Postgres.Database
+		infra := *base.Infrastructure
+		infra.Postgres = &PostgresInfra{Database: PreviewDatabase(source, number)}
+		out.Infrastructure = &infra
+		out.Preview.SourceDatabase = source
+		if base.Migrations != nil && base.Migrations.Database == source {
+			m := *base.Migrations
+			m.Database = infra.Postgres.Database
+			out.Migrations = &m
+		}
+	}
+	// A preview runs an unmerged branch's migrations; they may only touch
+	// its own database copy.
+	if db := out.MigrationDatabase(); out.Migrations != nil && db != "" && (out.Infrastructure == nil || out.Infrastructure.Postgres == nil || db != out.Infrastructure.Postgres.Database) {
+		return nil, fmt.Errorf("previews of %s cannot run migrations against %s, which is not the preview's database copy", s.App, db)
+	}
+	return &out, nil
+}
+
+// PreviewDatabase names the throwaway copy of database for pull request
+// number.
+func PreviewDatabase(database string, number int) string {
+	return fmt.Sprintf("%s_pr_%d", database, number)
+}
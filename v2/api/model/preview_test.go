@@ -0,0 +1,164 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const previewSpec = `
+name: shop
+repo:
+  url: https://github.com/acme/shop.git
+  previews:
+    enabled: true
+    domain: preview.example.com
+    ttl: 24h
+processes:
+  web:
+    port: 8080
+    scaling:
+      min: 3
+      max: 6
+    canary:
+      count: 1
+  nightly:
+    schedule: "0 3 * * *"
+migrations:
+  up: ./migrate up
+  database: shop
+infrastructure:
+  postgres:
+    database: shop
+endpoints:
+  - url: https://shop.example.com
+environments:
+  production:
+    default: true
+    secretsFile: secrets.prod.enc.yaml
+`
+
+func loadPreviewSpec(t *testing.T) *InfraSpec {
+	t.Helper()
+	var spec InfraSpec
+	if err := yaml.Unmarshal([]byte(previewSpec), &spec); err != nil {
+		t.Fatal(err)
+	}
+	applyDefaults(&spec)
+	return &spec
+}
+
+func TestForPreviewIsolatesThePullRequest(t *testing.T) {
+	base := loadPreviewSpec(t)
+	spec, err := base.ForPreview(12)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if spec.JobID() != "shop-pr-12" || spec.Environment != "pr-12" {
+		t.Fatalf("job id = %q environment = %q", spec.JobID(), spec.Environment)
+	}
+	if spec.SecretsFile() != "secrets.prod.enc.yaml" {
+		t.Fatalf("secrets file = %q, want the parent environment's", spec.SecretsFile())
+	}
+	if len(spec.Endpoints) != 1 || spec.Endpoints[0].URL != "https://shop-pr-12.preview.example.com" {
+		t.Fatalf("endpoints = %+v", spec.Endpoints)
+	}
+	if spec.Env["NORN_PREVIEW_URL"] != "https://shop-pr-12.preview.example.com" {
+		t.Fatalf("env = %v", spec.Env)
+	}
+	if _, ok := spec.Processes["nightly"]; ok {
+		t.Fatal("previews should not run scheduled processes")
+	}
+	web := spec.Processes["web"]
+	if web.Scaling.Min != 1 || web.Scaling.Max != 1 || web.Canary != nil {
+		t.Fatalf("web = %+v", web)
+	}
+	if spec.Infrastructure.Postgres.Database != "shop_pr_12" || spec.MigrationDatabase() != "shop_pr_12" || spec.Preview.SourceDatabase != "shop" {
+		t.Fatalf("database = %s migrations = %s source = %s", spec.Infrastructure.Postgres.Database, spec.MigrationDatabase(), spec.Preview.SourceDatabase)
+	}
+	if spec.PreviewTTL().Hours() != 24 {
+		t.Fatalf("ttl = %s", spec.PreviewTTL())
+	}
+
+	if base.Processes["web"].Scaling.Min != 3 || base.Infrastructure.Postgres.Database != "shop" || len(base.Processes) != 2 {
+		t.Fatalf("base spec was modified: %+v", base)
+	}
+}
+
+func TestForPreviewMountsNoProductionVolumes(t *testing.T) {
+	base := loadPreviewSpec(t)
+	base.Volumes = []VolumeSpec{
+		{Name: "uploads", Mount: "/srv/uploads"},
+		{Name: "cache", Mount: "/var/cache/shop", Size: "1GiB"},
+		{Name: "media", Mount: "/srv/media", Type: VolumeCSI, Plugin: "ceph"},
+	}
+	spec, err := base.ForPreview(12)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	production := map[string]bool{}
+	for _, vol := range base.Volumes {
+		production[vol.Source(base.JobID())] = true
+	}
+	var names []string
+	for _, vol := range spec.Volumes {
+		if production[vol.Source(spec.JobID())] {
+			t.Fatalf("preview mounts production volume %s", vol.Source(spec.JobID()))
+		}
+		names = append(names, vol.Name)
+	}
+	if strings.Join(names, ",") != "cache,media" {
+		t.Fatalf("preview volumes = %v, want the managed cache and media", names)
+	}
+}
+
+func TestForPreviewRefusesMigrationsOutsideItsCopy(t *testing.T) {
+	spec := loadPreviewSpec(t)
+	spec.Migrations.Database = "analytics"
+	if _, err := spec.ForPreview(12); err == nil || !strings.Contains(err.Error(), "analytics") {
+		t.Fatalf("err = %v, want a refusal to migrate analytics", err)
+	}
+	assertErrorFinding(t, ValidateSpec(spec), "repo.previews")
+
+	spec.Infrastructure = nil
+	spec.Migrations.Database = "shop"
+	if _, err := spec.ForPreview(12); err == nil {
+		t.Fatal("expected an error migrating a database previews do not copy")
+	}
+}
+
+func TestForPreviewRequiresOptIn(t *testing.T) {
+	spec := loadPreviewSpec(t)
+	spec.Repo.Previews.Enabled = false
+	if _, err := spec.ForPreview(1); err == nil {
+		t.Fatal("expected error when previews are disabled")
+	}
+}
+
+func TestFindPreviewApps(t *testing.T) {
+	spec := loadPreviewSpec(t)
+	other := &InfraSpec{App: "blog", Repo: &RepoSpec{URL: "https://github.com/acme/shop.git", Branch: "main"}}
+	specs := []*InfraSpec{spec, other}
+
+	if got := FindPreviewApps(specs, "git@github.com:acme/shop.git", "main"); len(got) != 1 || got[0].App != "shop" {
+		t.Fatalf("matched %v", got)
+	}
+	if got := FindPreviewApps(specs, "https://github.com/acme/shop", "develop"); len(got) != 0 {
+		t.Fatalf("pull requests against other branches matched %v", got)
+	}
+}
+
+func TestValidatePreviews(t *testing.T) {
+	spec := loadPreviewSpec(t)
+	spec.Repo.Previews.Domain = "https://preview"
+	spec.Repo.Previews.TTL = "forever"
+	spec.Repo.Previews.Environment = "qa"
+
+	result := ValidateSpec(spec)
+	for _, field := range []string{"repo.previews.domain", "repo.previews.ttl", "repo.previews.environment"} {
+		assertErrorFinding(t, result, field)
+	}
+}
@@ -0,0 +1,60 @@
+package model
+
+import "time"
+
+// Secret version actions.
+const (
+	// SecretVersionBaseline records the secrets an app already had when its
+	// history started, so the first change can be rolled back.
+	SecretVersionBaseline = "baseline"
+	SecretVersionSet      = "set"
+	SecretVersionDelete   = "delete"
+	SecretVersionMigrate  = "migrate"
+	SecretVersionRollback = "rollback"
+	// SecretVersionRotate records credentials issued by credential rotation.
+	SecretVersionRotate = "rotate"
+	// SecretVersionProvision records credentials generated while provisioning
+	// infrastructure such as object storage.
+	SecretVersionProvision = "provision"
+)
+
+// SecretVersion records one change to an app environment's secrets. Only key
+// names are exposed; the values are kept as an age-encrypted snapshot.
+type SecretVersion struct {
+	ID          int64  `json:"id"`
+	App         string `json:"app"`
+	Environment string `json:"environment,omitempty"`
+	// Version counts up from 1 per app environment.
+	Version int    `json:"version"`
+	Backend string `json:"backend"`
+	Action  string `json:"action"`
+	Actor   string `json:"actor"`
+	// Keys are the keys the secrets held after the change.
+	Keys    []string `json:"keys"`
+	Added   []string `json:"added"`
+	Changed []string `json:"changed"`
+	Removed []string `json:"removed"`
+	// RestoredFrom is the version a rollback restored.
+	RestoredFrom int `json:"restoredFrom,omitempty"`
+	// Restorable is false when the API had no age identity to encrypt the
+	// snapshot to, so only key names were kept.
+	Restorable bool      `json:"restorable"`
+	Snapshot   []byte    `json:"-"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// SecretVersionDiff compares the key sets of two secret versions. Keys whose
+// values differ are listed as changed; values are never included.
+type SecretVersionDiff struct {
+	App         string `json:"app"`
+	Environment string `json:"environment,omitempty"`
+	From        int    `json:"from"`
+	// To is 0 when comparing against the live secrets.
+	To      int      `json:"to"`
+	Added   []string `json:"added"`
+	Changed []string `json:"changed"`
+	Removed []string `json:"removed"`
+	// ValuesCompared is false when a snapshot could not be decrypted, so
+	// changed only reflects what the versions recorded.
+	ValuesCompared bool `json:"valuesCompared"`
+}
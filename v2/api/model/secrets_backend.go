@@ -0,0 +1,84 @@
+package model
+
+import "strings"
+
+// Secret backends.
+const (
+	SecretsBackendSOPS  = "sops"
+	SecretsBackendNomad = "nomad"
+	SecretsBackendVault = "vault"
+)
+
+// DefaultVaultMount is the KV v2 mount used when a vault backend sets none.
+const DefaultVaultMount = "secret"
+
+// SecretsBackend selects where an app's secrets live. SOPS files in the app
+// directory are the default; Nomad Variables and Vault KV v2 keep them out
+// of the repo and out of the job spec.
+type SecretsBackend struct {
+	Type string `yaml:"type" json:"type"`
+	// Path is the Nomad variable path or Vault KV path. Non-default
+	// environments append /<env> unless they set secretsPath.
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+	// Mount is the Vault KV v2 mount.
+	Mount string `yaml:"mount,omitempty" json:"mount,omitempty"`
+	// Role is the Vault role tasks use to read their secrets.
+	Role string `yaml:"role,omitempty" json:"role,omitempty"`
+}
+
+// SecretsBackendType returns the spec's secret backend, sops when unset.
+func (s *InfraSpec) SecretsBackendType() string {
+	if s.SecretsBackend == nil || s.SecretsBackend.Type == "" {
+		return SecretsBackendSOPS
+	}
+	return s.SecretsBackend.Type
+}
+
+// SecretsTemplated reports whether the spec's secrets reach tasks through
+// Nomad templates rather than the job's env.
+func (s *InfraSpec) SecretsTemplated() bool {
+	switch s.SecretsBackendType() {
+	case SecretsBackendNomad, SecretsBackendVault:
+		return true
+	}
+	return false
+}
+
+// SecretsPath returns the Nomad variable or Vault KV path that holds the
+// environment's secrets. Nomad defaults to nomad/jobs/<job>, which the job's
+// tasks can read without an ACL policy; Vault defaults to the app name.
+// Previews share their parent environment's path.
+func (s *InfraSpec) SecretsPath() string {
+	if s.Preview != nil {
+		parent := *s
+		parent.Environment = s.Preview.Parent
+		parent.Preview = nil
+		return parent.SecretsPath()
+	}
+	env, hasEnv := s.Environments[s.Environment]
+	if s.Environment != "" && hasEnv && env.SecretsPath != "" {
+		return strings.Trim(env.SecretsPath, "/")
+	}
+	base := ""
+	if s.SecretsBackend != nil {
+		base = strings.Trim(s.SecretsBackend.Path, "/")
+	}
+	if base == "" {
+		if s.SecretsBackendType() == SecretsBackendNomad {
+			return "nomad/jobs/" + s.JobID()
+		}
+		base = s.App
+	}
+	if s.Environment != "" && !env.Default {
+		return base + "/" + s.Environment
+	}
+	return base
+}
+
+// VaultMount returns the Vault KV v2 mount of the spec's secrets.
+func (s *InfraSpec) VaultMount() string {
+	if s.SecretsBackend != nil && s.SecretsBackend.Mount != "" {
+		return strings.Trim(s.SecretsBackend.Mount, "/")
+	}
+	return DefaultVaultMount
+}
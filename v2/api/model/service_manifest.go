@@ -8,6 +8,7 @@ type ServiceManifest struct {
 	NetworkMode string                  `json:"networkMode,omitempty"`
 	Contract    ServiceManifestContract `json:"contract"`
 	Services    []ServiceManifestEntry  `json:"services"`
+	Graph       ServiceGraph            `json:"graph"`
 }
 
 type ServiceManifestEntry struct {
@@ -52,3 +53,21 @@ type ServiceInstance struct {
 	Port    int    `json:"port,omitempty"`
 	Status  string `json:"status,omitempty"`
 }
+
+// ServiceGraph is the mesh's declared call graph: one edge per upstream a
+// process declares.
+type ServiceGraph struct {
+	Edges []ServiceGraphEdge `json:"edges"`
+}
+
+type ServiceGraphEdge struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	LocalPort   int    `json:"localPort"`
+	// Known is false when no deployed app registers the destination.
+	Known bool `json:"known"`
+	// Intention is allow or deny from the matching Consul intention,
+	// missing when none matches, or unknown when Consul can't be read.
+	Intention string `json:"intention"`
+	Managed   bool   `json:"managed,omitempty"`
+}
@@ -0,0 +1,225 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// RestartSpec overrides how Nomad restarts a process's failed tasks on the
+// same node. Unset fields keep the defaults for the process's kind.
+type RestartSpec struct {
+	Attempts *int   `yaml:"attempts,omitempty" json:"attempts,omitempty"`
+	Interval string `yaml:"interval,omitempty" json:"interval,omitempty"`
+	Delay    string `yaml:"delay,omitempty" json:"delay,omitempty"`
+	Mode     string `yaml:"mode,omitempty" json:"mode,omitempty"` // delay, fail
+}
+
+// UpdateSpec overrides how Nomad rolls a new version of a long-running
+// process out. Unset fields keep DefaultUpdate.
+type UpdateSpec struct {
+	MaxParallel      int    `yaml:"maxParallel,omitempty" json:"maxParallel,omitempty"`
+	MinHealthyTime   string `yaml:"minHealthyTime,omitempty" json:"minHealthyTime,omitempty"`
+	HealthyDeadline  string `yaml:"healthyDeadline,omitempty" json:"healthyDeadline,omitempty"`
+	ProgressDeadline string `yaml:"progressDeadline,omitempty" json:"progressDeadline,omitempty"`
+	Stagger          string `yaml:"stagger,omitempty" json:"stagger,omitempty"`
+	HealthCheck      string `yaml:"healthCheck,omitempty" json:"healthCheck,omitempty"` // checks, task_states
+}
+
+// Restart modes.
+const (
+	RestartDelay = "delay"
+	RestartFail  = "fail"
+)
+
+// Update health check modes.
+const (
+	HealthCheckChecks     = "checks"
+	HealthCheckTaskStates = "task_states"
+)
+
+// RestartPolicy is a restart policy with every field resolved.
+type RestartPolicy struct {
+	Attempts int
+	Interval time.Duration
+	Delay    time.Duration
+	Mode     string
+}
+
+// UpdatePolicy is an update strategy with every field resolved.
+type UpdatePolicy struct {
+	MaxParallel      int
+	MinHealthyTime   time.Duration
+	HealthyDeadline  time.Duration
+	ProgressDeadline time.Duration
+	Stagger          time.Duration
+	HealthCheck      string
+}
+
+var (
+	// DefaultServiceRestart retries a crashing service three times in five
+	// minutes, then keeps retrying after the interval.
+	DefaultServiceRestart = RestartPolicy{Attempts: 3, Interval: 5 * time.Minute, Delay: 15 * time.Second, Mode: RestartDelay}
+	// DefaultPeriodicRestart matches Nomad's batch default.
+	DefaultPeriodicRestart = RestartPolicy{Attempts: 3, Interval: 24 * time.Hour, Delay: 15 * time.Second, Mode: RestartFail}
+	// DefaultFunctionRestart never retries an invocation.
+	DefaultFunctionRestart = RestartPolicy{Attempts: 0, Interval: time.Minute, Delay: 5 * time.Second, Mode: RestartFail}
+
+	// DefaultUpdate rolls one allocation at a time. The deadlines are
+	// Nomad's own defaults.
+	DefaultUpdate = UpdatePolicy{
+		MaxParallel:      1,
+		MinHealthyTime:   30 * time.Second,
+		HealthyDeadline:  5 * time.Minute,
+		ProgressDeadline: 10 * time.Minute,
+		Stagger:          30 * time.Second,
+		HealthCheck:      HealthCheckChecks,
+	}
+)
+
+// ProcessRestart resolves proc's restart policy over the defaults for its
+// kind.
+func ProcessRestart(proc Process) RestartPolicy {
+	policy := DefaultServiceRestart
+	switch {
+	case proc.Function != nil:
+		policy = DefaultFunctionRestart
+	case proc.Schedule != "":
+		policy = DefaultPeriodicRestart
+	}
+	return ResolveRestart(proc.Restart, policy)
+}
+
+// ResolveRestart applies the fields r sets over policy.
+func ResolveRestart(r *RestartSpec, policy RestartPolicy) RestartPolicy {
+	if r == nil {
+		return policy
+	}
+	if r.Attempts != nil {
+		policy.Attempts = *r.Attempts
+	}
+	if d, err := time.ParseDuration(r.Interval); err == nil && d > 0 {
+		policy.Interval = d
+	}
+	if d, err := time.ParseDuration(r.Delay); err == nil && d > 0 {
+		policy.Delay = d
+	}
+	if r.Mode != "" {
+		policy.Mode = r.Mode
+	}
+	return policy
+}
+
+// ProcessUpdate resolves proc's update strategy over DefaultUpdate.
+func ProcessUpdate(proc Process) UpdatePolicy {
+	policy := DefaultUpdate
+	u := proc.Update
+	if u == nil {
+		return policy
+	}
+	if u.MaxParallel > 0 {
+		policy.MaxParallel = u.MaxParallel
+	}
+	for _, f := range []struct {
+		raw string
+		dst *time.Duration
+	}{
+		{u.MinHealthyTime, &policy.MinHealthyTime},
+		{u.HealthyDeadline, &policy.HealthyDeadline},
+		{u.ProgressDeadline, &policy.ProgressDeadline},
+		{u.Stagger, &policy.Stagger},
+	} {
+		if d, err := time.ParseDuration(f.raw); err == nil && d > 0 {
+			*f.dst = d
+		}
+	}
+	if u.HealthCheck != "" {
+		policy.HealthCheck = u.HealthCheck
+	}
+	return policy
+}
+
+// HealthyTimeout bounds how long a deploy waits for spec's service
+// allocations to become healthy: the slowest group's rollout, where each
+// wave of maxParallel allocations may take up to its healthy deadline and
+// waves are staggered.
+func HealthyTimeout(spec *InfraSpec) time.Duration {
+	timeout := DefaultUpdate.HealthyDeadline
+	for _, proc := range spec.Processes {
+		if proc.Schedule != "" || proc.Function != nil {
+			continue
+		}
+		policy := ProcessUpdate(proc)
+		count := 1
+		if proc.Scaling != nil && proc.Scaling.Min > 0 {
+			count = proc.Scaling.Min
+		}
+		waves := (count + policy.MaxParallel - 1) / policy.MaxParallel
+		rollout := time.Duration(waves)*policy.HealthyDeadline + time.Duration(waves-1)*policy.Stagger
+		if rollout > timeout {
+			timeout = rollout
+		}
+	}
+	return timeout
+}
+
+func validateRestart(r *ValidationResult, field string, proc Process) {
+	if proc.Restart == nil {
+		return
+	}
+	spec := proc.Restart
+	if spec.Attempts != nil && *spec.Attempts < 0 {
+		r.add("error", field+".attempts", "attempts must not be negative")
+	}
+	validatePositiveDuration(r, field+".interval", spec.Interval)
+	validatePositiveDuration(r, field+".delay", spec.Delay)
+	switch spec.Mode {
+	case "", RestartDelay, RestartFail:
+	default:
+		r.add("error", field+".mode", fmt.Sprintf("unknown restart mode %q (want delay or fail)", spec.Mode))
+	}
+
+	policy := ProcessRestart(proc)
+	if policy.Attempts > 0 && time.Duration(policy.Attempts)*policy.Delay > policy.Interval {
+		r.add("error", field, fmt.Sprintf("%d attempts %s apart do not fit in the %s interval", policy.Attempts, policy.Delay, policy.Interval))
+	}
+}
+
+func validateUpdate(r *ValidationResult, field string, proc Process) {
+	if proc.Update == nil {
+		return
+	}
+	if proc.Schedule != "" || proc.Function != nil {
+		r.add("error", field, "update only applies to long-running processes")
+		return
+	}
+	spec := proc.Update
+	if spec.MaxParallel < 0 {
+		r.add("error", field+".maxParallel", "maxParallel must not be negative")
+	}
+	validatePositiveDuration(r, field+".minHealthyTime", spec.MinHealthyTime)
+	validatePositiveDuration(r, field+".healthyDeadline", spec.HealthyDeadline)
+	validatePositiveDuration(r, field+".progressDeadline", spec.ProgressDeadline)
+	validatePositiveDuration(r, field+".stagger", spec.Stagger)
+	switch spec.HealthCheck {
+	case "", HealthCheckChecks, HealthCheckTaskStates:
+	default:
+		r.add("error", field+".healthCheck", fmt.Sprintf("unknown health check mode %q (want checks or task_states)", spec.HealthCheck))
+	}
+
+	policy := ProcessUpdate(proc)
+	if policy.MinHealthyTime >= policy.HealthyDeadline {
+		r.add("error", field+".minHealthyTime", fmt.Sprintf("minHealthyTime %s must be shorter than healthyDeadline %s", policy.MinHealthyTime, policy.HealthyDeadline))
+	}
+	if policy.HealthyDeadline >= policy.ProgressDeadline {
+		r.add("error", field+".healthyDeadline", fmt.Sprintf("healthyDeadline %s must be shorter than progressDeadline %s", policy.HealthyDeadline, policy.ProgressDeadline))
+	}
+}
+
+func validatePositiveDuration(r *ValidationResult, field, raw string) {
+	if raw == "" {
+		return
+	}
+	if d, err := time.ParseDuration(raw); err != nil || d <= 0 {
+		r.add("error", field, fmt.Sprintf("invalid duration %q", raw))
+	}
+}
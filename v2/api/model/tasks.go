@@ -0,0 +1,78 @@
+package model
+
+import "fmt"
+
+// Lifecycle hooks for a process's extra tasks.
+const (
+	// TaskInit runs to completion before the process starts, e.g. waiting
+	// for Postgres or downloading assets.
+	TaskInit = "init"
+	// TaskSidecar runs alongside the process for its whole life, e.g. a log
+	// shipper or proxy.
+	TaskSidecar = "sidecar"
+	// TaskPoststart runs once after the process has started.
+	TaskPoststart = "poststart"
+	// TaskPoststop runs once after the process has stopped.
+	TaskPoststop = "poststop"
+)
+
+// ProcessTask is an extra task in a process's task group. It shares the
+// group's network, volumes and /alloc directory with the process.
+type ProcessTask struct {
+	Name      string `yaml:"name" json:"name"`
+	Lifecycle string `yaml:"lifecycle" json:"lifecycle"`
+	// Image defaults to the app's image. Tasks on the app's image get the
+	// process env and secrets; tasks on their own image get only Env.
+	Image     string            `yaml:"image,omitempty" json:"image,omitempty"`
+	Command   string            `yaml:"command,omitempty" json:"command,omitempty"`
+	Resources *Resources        `yaml:"resources,omitempty" json:"resources,omitempty"`
+	Env       map[string]string `yaml:"env,omitempty" json:"-"`
+}
+
+// UsesAppImage reports whether the task runs the app's own image.
+func (t ProcessTask) UsesAppImage() bool {
+	return t.Image == ""
+}
+
+// TaskResources returns the CPU (MHz) and memory (MB) a task reserves.
+func TaskResources(res *Resources) (int, int) {
+	cpu, memory := 100, 128
+	if res != nil {
+		if res.CPU > 0 {
+			cpu = res.CPU
+		}
+		if res.Memory > 0 {
+			memory = res.Memory
+		}
+	}
+	return cpu, memory
+}
+
+func validateProcessTasks(r *ValidationResult, field, procName string, proc Process, declaredSecrets map[string]bool, strictSecrets bool) {
+	seen := map[string]bool{}
+	for i, task := range proc.Tasks {
+		f := fmt.Sprintf("%s.tasks[%d]", field, i)
+		switch {
+		case !appNameRe.MatchString(task.Name):
+			r.add("error", f+".name", "task name must match ^[a-z0-9][a-z0-9-]*$")
+		case task.Name == procName:
+			r.add("error", f+".name", fmt.Sprintf("task name %s is taken by the process's own task", task.Name))
+		case seen[task.Name]:
+			r.add("error", f+".name", fmt.Sprintf("duplicate task name %s", task.Name))
+		}
+		seen[task.Name] = true
+
+		switch task.Lifecycle {
+		case TaskInit, TaskSidecar, TaskPoststart, TaskPoststop:
+		default:
+			r.add("error", f+".lifecycle", "lifecycle must be init, sidecar, poststart or poststop")
+		}
+		if task.UsesAppImage() && task.Command == "" {
+			r.add("error", f, "task on the app image needs a command, or set image")
+		}
+		if task.Resources != nil && (task.Resources.CPU < 0 || task.Resources.Memory < 0) {
+			r.add("error", f+".resources", "task resources must not be negative")
+		}
+		validateEnvSecrets(r, f+".env", task.Env, declaredSecrets, strictSecrets)
+	}
+}
@@ -0,0 +1,66 @@
+package model
+
+import "time"
+
+// Tuner timing defaults, used when the matching TuningPolicy field is unset.
+const (
+	DefaultTuningCooldown     = time.Hour
+	DefaultTuningRevertWindow = 10 * time.Minute
+)
+
+// Tuning change statuses. An applied change is watched for the revert
+// window, then kept or reverted; a deploy that replaces the tuned job first
+// supersedes it.
+const (
+	TuningChangeApplied    = "applied"
+	TuningChangeKept       = "kept"
+	TuningChangeReverted   = "reverted"
+	TuningChangeSuperseded = "superseded"
+)
+
+// TuningChange records the tuner resubmitting a process with new CPU and
+// memory, and what became of it.
+type TuningChange struct {
+	ID         int64  `json:"id"`
+	App        string `json:"app"`
+	Process    string `json:"process"`
+	FromCPU    int    `json:"fromCpuMHz"`
+	FromMemory int    `json:"fromMemoryMB"`
+	ToCPU      int    `json:"toCpuMHz"`
+	ToMemory   int    `json:"toMemoryMB"`
+	Reason     string `json:"reason"`
+	// Patch is the infraspec change that makes the tuned values stick
+	// across deploys.
+	Patch        string     `json:"patch"`
+	Status       string     `json:"status"`
+	StatusReason string     `json:"statusReason,omitempty"`
+	SagaID       string     `json:"sagaId,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	SettledAt    *time.Time `json:"settledAt,omitempty"`
+}
+
+// AutoApplies reports whether the tuner applies recommendations itself.
+func (t *TuningPolicy) AutoApplies() bool {
+	return t != nil && t.Mode == "auto"
+}
+
+// CooldownPeriod returns the least time between two tuning changes.
+func (t *TuningPolicy) CooldownPeriod() time.Duration {
+	if t != nil && t.Cooldown != "" {
+		if d, err := time.ParseDuration(t.Cooldown); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return DefaultTuningCooldown
+}
+
+// RevertAfter returns how long an applied change is watched before it is
+// kept.
+func (t *TuningPolicy) RevertAfter() time.Duration {
+	if t != nil && t.RevertWindow != "" {
+		if d, err := time.ParseDuration(t.RevertWindow); err == nil && d > 0 {
+			return d
+		}
+	}
+	return DefaultTuningRevertWindow
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 )
@@ -25,10 +27,14 @@ var appNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
 var bucketNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
 var envNameRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
 var kafkaTopicNameRe = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+var tuningAggregateRe = regexp.MustCompile(`^(current|max|avg|p([1-9][0-9]?|0[1-9]))?$`)
 
 type ValidationOptions struct {
 	NetworkMode   string
 	StrictSecrets bool
+	// Nodes is the live Nomad node inventory. When set, process placement
+	// is checked against it.
+	Nodes []PlacementNode
 }
 
 func ValidateSpec(spec *InfraSpec) *ValidationResult {
@@ -98,21 +104,58 @@ func ValidateSpecWithOptions(spec *InfraSpec, opts ValidationOptions) *Validatio
 			}
 		}
 
+		validateScaleToZero(r, field+".scaling", spec, proc)
+		validateAutoScale(r, field+".scaling", proc)
+		validateCanary(r, field+".canary", proc)
 		validateTuningPolicy(r, field+".tuning", proc.Tuning)
+		validatePlacement(r, field+".placement", proc.Placement)
+		if opts.Nodes != nil {
+			checkPlacement(r, field+".placement", proc, opts.Nodes)
+		}
+		validateProcessTasks(r, field, name, proc, declaredSecrets, opts.StrictSecrets)
+		validateMesh(r, field+".mesh", spec, name, proc)
+		validateRestart(r, field+".restart", proc)
+		validateUpdate(r, field+".update", proc)
 		validateEnvSecrets(r, field+".env", proc.Env, declaredSecrets, opts.StrictSecrets)
 	}
 
+	validateCanarySteps(r, spec)
 	validateEnvSecrets(r, "env", spec.Env, declaredSecrets, opts.StrictSecrets)
 
 	// Build requires dockerfile
 	if spec.Build != nil && spec.Build.Dockerfile == "" {
 		r.add("warning", "build.dockerfile", "build block present without dockerfile")
 	}
+	validateBuild(r, spec.Build, spec.Secrets)
+	validateMigrations(r, spec)
+	validateEnvironments(r, spec, declaredSecrets, opts.StrictSecrets)
+	validatePreviews(r, spec)
+	validateSecretsBackend(r, spec)
+	validateCredentialRotation(r, spec)
 
 	// Repo requires URL
 	if spec.Repo != nil && spec.Repo.URL == "" {
 		r.add("error", "repo.url", "repo block present without URL")
 	}
+	if spec.DeployPolicy != nil {
+		switch spec.DeployPolicy.Reconcile {
+		case "", ReconcileReport, ReconcileApply:
+		default:
+			r.add("error", "deployPolicy.reconcile", fmt.Sprintf("unknown reconcile policy %q (want report or apply)", spec.DeployPolicy.Reconcile))
+		}
+	}
+	if spec.Repo != nil {
+		switch spec.Repo.ForgeProvider() {
+		case "github", "gitea", "forgejo":
+		default:
+			r.add("error", "repo.forge", fmt.Sprintf("unknown forge %q (want github or gitea)", spec.Repo.Forge))
+		}
+		for i, fork := range spec.Repo.TrustedForks {
+			if !trustedForkRe.MatchString(fork) {
+				r.add("error", fmt.Sprintf("repo.trustedForks[%d]", i), fmt.Sprintf("fork %q must be owner/name", fork))
+			}
+		}
+	}
 
 	// Endpoint URLs valid
 	for i, ep := range spec.Endpoints {
@@ -127,18 +170,7 @@ func ValidateSpecWithOptions(spec *InfraSpec, opts ValidationOptions) *Validatio
 		validateEndpointReachability(r, fmt.Sprintf("endpoints[%d].url", i), ep.URL, networkMode)
 	}
 
-	// Volumes
-	for i, vol := range spec.Volumes {
-		field := fmt.Sprintf("volumes[%d]", i)
-		if vol.Name == "" {
-			r.add("error", field+".name", "volume name is required")
-		}
-		if vol.Mount == "" {
-			r.add("error", field+".mount", "volume mount path is required")
-		} else if !strings.HasPrefix(vol.Mount, "/") {
-			r.add("error", field+".mount", "volume mount path must be absolute")
-		}
-	}
+	validateVolumes(r, spec)
 
 	// Postgres infra requires database name
 	if spec.Infrastructure != nil && spec.Infrastructure.Postgres != nil {
@@ -278,6 +310,430 @@ func isTailnetIP(ip net.IP) bool {
 	return ip4 != nil && ip4[0] == 100 && ip4[1]&0xc0 == 64
 }
 
+func validateScaleToZero(r *ValidationResult, field string, spec *InfraSpec, proc Process) {
+	scaling := proc.Scaling
+	if scaling == nil {
+		return
+	}
+	if scaling.IdleTimeout != "" {
+		if d, err := time.ParseDuration(scaling.IdleTimeout); err != nil || d < time.Minute {
+			r.add("error", field+".idleTimeout", fmt.Sprintf("invalid idleTimeout %q (want a duration of at least 1m)", scaling.IdleTimeout))
+		}
+		if !scaling.ScaleToZero {
+			r.add("warning", field+".idleTimeout", "idleTimeout has no effect without scaleToZero")
+		}
+	}
+	if !scaling.ScaleToZero {
+		return
+	}
+	switch {
+	case proc.Schedule != "" || proc.Function != nil:
+		r.add("error", field+".scaleToZero", "scaleToZero only applies to long-running processes")
+	case proc.Port == 0 || len(spec.Endpoints) == 0:
+		r.add("error", field+".scaleToZero", "scaleToZero needs a port and an endpoint for the wake gateway to route to")
+	}
+	if proc.Canary != nil && proc.Canary.Count > 0 {
+		r.add("error", field+".scaleToZero", "scaleToZero cannot be combined with canary deploys")
+	}
+}
+
+func validateAutoScale(r *ValidationResult, field string, proc Process) {
+	if proc.Scaling == nil || proc.Scaling.Auto == nil {
+		return
+	}
+	scaling, auto := proc.Scaling, proc.Scaling.Auto
+	field += ".auto"
+	switch auto.Metric {
+	case AutoScaleCPU, AutoScaleMemory:
+	case AutoScaleKafkaLag:
+		if auto.Topic == "" || auto.Group == "" {
+			r.add("error", field, "kafka_lag needs a topic and a consumer group")
+		}
+	case AutoScaleCustom:
+		if auto.Query == "" {
+			r.add("error", field+".query", "custom needs a query naming the series to scale on")
+		}
+		if proc.Metrics == nil || !proc.Metrics.Enabled {
+			r.add("error", field+".query", "custom needs metrics.enabled to scrape the process")
+		}
+	default:
+		r.add("error", field+".metric", fmt.Sprintf("invalid metric %q (want cpu, memory, kafka_lag or custom)", auto.Metric))
+	}
+	if auto.Target <= 0 {
+		r.add("error", field+".target", "target must be positive")
+	}
+	if scaling.Max <= 0 {
+		r.add("error", field, "autoscaling needs scaling.max")
+	}
+	if proc.Schedule != "" || proc.Function != nil {
+		r.add("error", field, "autoscaling only applies to long-running processes")
+	}
+	for _, d := range []struct{ name, value string }{
+		{"scaleUpWindow", auto.ScaleUpWindow},
+		{"scaleDownWindow", auto.ScaleDownWindow},
+		{"cooldown", auto.Cooldown},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if parsed, err := time.ParseDuration(d.value); err != nil || parsed < 0 {
+			r.add("error", field+"."+d.name, fmt.Sprintf("invalid %s duration %q", d.name, d.value))
+		}
+	}
+}
+
+// validateCanarySteps requires every canary process that declares steps to
+// declare the same ones: a deploy walks all of its canaries through one
+// sequence of steps.
+func validateCanarySteps(r *ValidationResult, spec *InfraSpec) {
+	first := spec.CanaryStepsProcess()
+	if first == "" {
+		return
+	}
+	want := spec.Processes[first].Canary.Steps
+	for name, proc := range spec.Processes {
+		if proc.Canary == nil || proc.Canary.Count <= 0 || len(proc.Canary.Steps) == 0 || name == first {
+			continue
+		}
+		if !slices.Equal(proc.Canary.Steps, want) {
+			r.add("error", fmt.Sprintf("processes.%s.canary.steps", name), fmt.Sprintf("canary steps must match processes.%s.canary.steps; a deploy steps every canary together", first))
+		}
+	}
+}
+
+func validateCanary(r *ValidationResult, field string, proc Process) {
+	canary := proc.Canary
+	if canary == nil {
+		return
+	}
+	if canary.Count < 0 {
+		r.add("error", field+".count", "canary count must be non-negative")
+	}
+	if canary.EvaluateAfter != "" {
+		if _, err := time.ParseDuration(canary.EvaluateAfter); err != nil {
+			r.add("error", field+".evaluateAfter", fmt.Sprintf("invalid evaluateAfter duration %q", canary.EvaluateAfter))
+		}
+	}
+	if canary.MaxErrorRate < 0 || canary.MaxErrorRate > 1 {
+		r.add("error", field+".maxErrorRate", "maxErrorRate must be between 0 and 1")
+	}
+	if canary.MaxErrorRateIncrease < 0 || canary.MaxErrorRateIncrease > 1 {
+		r.add("error", field+".maxErrorRateIncrease", "maxErrorRateIncrease must be between 0 and 1")
+	}
+	if canary.MaxLatencyRatio < 0 || (canary.MaxLatencyRatio > 0 && canary.MaxLatencyRatio < 1) {
+		r.add("error", field+".maxLatencyRatio", "maxLatencyRatio must be at least 1")
+	}
+	if canary.MaxRestarts < 0 {
+		r.add("error", field+".maxRestarts", "maxRestarts must be non-negative")
+	}
+	if canary.MinRequests < 0 {
+		r.add("error", field+".minRequests", "minRequests must be non-negative")
+	}
+	lastWeight := 0
+	for i, step := range canary.Steps {
+		stepField := fmt.Sprintf("%s.steps[%d]", field, i)
+		if step.Weight < 1 || step.Weight > 100 {
+			r.add("error", stepField+".weight", "step weight must be between 1 and 100")
+		} else if step.Weight < lastWeight {
+			r.add("warning", stepField+".weight", "step weights should not decrease")
+		}
+		lastWeight = step.Weight
+		if step.Pause != "" {
+			if _, err := time.ParseDuration(step.Pause); err != nil {
+				r.add("error", stepField+".pause", fmt.Sprintf("invalid pause duration %q", step.Pause))
+			}
+		}
+	}
+	if len(canary.Steps) > 0 && proc.Mesh == nil {
+		r.add("error", field+".steps", "canary steps split the process's mesh traffic; the process must set mesh")
+	}
+	if canary.Count > 0 && (proc.Metrics == nil || !proc.Metrics.Enabled) {
+		r.add("info", field, "canary analysis without metrics.enabled falls back to health, restarts and access-pattern error rates")
+	}
+}
+
+func validateMigrations(r *ValidationResult, spec *InfraSpec) {
+	m := spec.Migrations
+	if m == nil {
+		return
+	}
+	if strings.TrimSpace(m.Up) == "" {
+		r.add("error", "migrations.up", "migrations block requires an up command")
+	}
+	if m.Timeout != "" {
+		if d, err := time.ParseDuration(m.Timeout); err != nil || d <= 0 {
+			r.add("error", "migrations.timeout", fmt.Sprintf("invalid timeout duration %q", m.Timeout))
+		}
+	}
+	hasPostgres := spec.Infrastructure != nil && spec.Infrastructure.Postgres != nil
+	switch m.OnFailure {
+	case "", MigrationRevertNone:
+	case MigrationRevertDown:
+		if m.Down == "" {
+			r.add("error", "migrations.onFailure", "onFailure down requires migrations.down")
+		}
+	case MigrationRevertRestore:
+		if !hasPostgres {
+			r.add("error", "migrations.onFailure", "onFailure restore requires infrastructure.postgres for the pre-deploy snapshot")
+		}
+	default:
+		r.add("error", "migrations.onFailure", fmt.Sprintf("unknown onFailure %q (want down, restore or none)", m.OnFailure))
+	}
+	if spec.MigrationDatabase() == "" {
+		r.add("warning", "migrations.database", "no target database; set migrations.database or infrastructure.postgres")
+	}
+	if m.Down != "" && m.Version == "" {
+		r.add("info", "migrations.version", "without a version command, rollbacks cannot target the previous deploy's schema version")
+	}
+	if m.OnFailure == "" {
+		r.add("info", "migrations.onFailure", "failed deploys leave migrations applied; set onFailure to down or restore to revert them")
+	}
+}
+
+func validateEnvironments(r *ValidationResult, spec *InfraSpec, declaredSecrets map[string]bool, strictSecrets bool) {
+	defaults := 0
+	for _, name := range spec.EnvironmentNames() {
+		env := spec.Environments[name]
+		field := "environments." + name
+		if !appNameRe.MatchString(name) {
+			r.add("error", field, "environment name must match ^[a-z0-9][a-z0-9-]*$")
+		}
+		if env.Default {
+			defaults++
+		}
+		if env.SecretsFile != "" && (filepath.Base(env.SecretsFile) != env.SecretsFile || !strings.HasSuffix(env.SecretsFile, ".yaml")) {
+			r.add("error", field+".secretsFile", "secretsFile must be a .yaml file name in the app directory")
+		}
+		for procName, o := range env.Processes {
+			procField := field + ".processes." + procName
+			if _, ok := spec.Processes[procName]; !ok {
+				r.add("error", procField, fmt.Sprintf("process %s is not declared", procName))
+				continue
+			}
+			if o.Scaling != nil && o.Scaling.Max > 0 && o.Scaling.Min > o.Scaling.Max {
+				r.add("error", procField+".scaling", "scaling min must not exceed max")
+			}
+			validateEnvSecrets(r, procField+".env", o.Env, declaredSecrets, strictSecrets)
+		}
+		for i, ep := range env.Endpoints {
+			if ep.URL == "" {
+				r.add("error", fmt.Sprintf("%s.endpoints[%d].url", field, i), "endpoint URL is required")
+			}
+		}
+		if env.Postgres == nil && !env.Default && (spec.Infrastructure != nil && spec.Infrastructure.Postgres != nil || spec.Migrations != nil) {
+			r.add("error", field+".postgres", "environment would snapshot and migrate the default environment's database; declare its own postgres database")
+		}
+		if env.Postgres != nil {
+			switch {
+			case spec.Infrastructure == nil || spec.Infrastructure.Postgres == nil:
+				r.add("error", field+".postgres", "postgres override requires infrastructure.postgres")
+			case env.Postgres.Database == "":
+				r.add("error", field+".postgres.database", "postgres database name is required")
+			case spec.Migrations != nil && spec.Migrations.Database != "" && spec.Migrations.Database != spec.Infrastructure.Postgres.Database:
+				r.add("error", field+".postgres", fmt.Sprintf("migrations.database %s is shared by every environment", spec.Migrations.Database))
+			}
+		}
+		validateEnvSecrets(r, field+".env", env.Env, declaredSecrets, strictSecrets)
+	}
+	if defaults > 1 {
+		r.add("error", "environments", "only one environment may be marked default")
+	}
+	validateEnvironmentHostnames(r, spec)
+}
+
+// validateEnvironmentHostnames rejects a hostname routed to more than one
+// environment: each deploy would point it at its own job.
+func validateEnvironmentHostnames(r *ValidationResult, spec *InfraSpec) {
+	owners := map[string]string{}
+	claim := func(field, owner, raw string) {
+		parsed, _ := url.Parse(raw)
+		host := strings.ToLower(endpointHost(raw, parsed))
+		if host == "" {
+			return
+		}
+		if prev, ok := owners[host]; ok && prev != owner {
+			r.add("error", field, fmt.Sprintf("hostname %s is already routed to %s", host, prev))
+			return
+		}
+		owners[host] = owner
+	}
+	// The top-level endpoints belong to the default environment unless it
+	// declares its own.
+	def := spec.DefaultEnvironment()
+	if def == "" || len(spec.Environments[def].Endpoints) == 0 {
+		owner := "the default environment"
+		if def != "" {
+			owner = "environment " + def
+		}
+		for i, ep := range spec.Endpoints {
+			claim(fmt.Sprintf("endpoints[%d].url", i), owner, ep.URL)
+		}
+	}
+	for _, name := range spec.EnvironmentNames() {
+		for i, ep := range spec.Environments[name].Endpoints {
+			claim(fmt.Sprintf("environments.%s.endpoints[%d].url", name, i), "environment "+name, ep.URL)
+		}
+	}
+}
+
+func validateSecretsBackend(r *ValidationResult, spec *InfraSpec) {
+	for _, name := range spec.EnvironmentNames() {
+		env := spec.Environments[name]
+		if env.SecretsPath != "" && !spec.SecretsTemplated() {
+			r.add("warning", "environments."+name+".secretsPath", "secretsPath only applies to the nomad and vault backends")
+		}
+	}
+	b := spec.SecretsBackend
+	if b == nil {
+		return
+	}
+	switch b.Type {
+	case "", SecretsBackendSOPS:
+		if b.Path != "" || b.Mount != "" || b.Role != "" {
+			r.add("warning", "secretsBackend", "path, mount and role are ignored by the sops backend")
+		}
+	case SecretsBackendNomad:
+		if b.Mount != "" || b.Role != "" {
+			r.add("warning", "secretsBackend", "mount and role only apply to the vault backend")
+		}
+	case SecretsBackendVault:
+		if strings.Contains(b.Mount, "/") {
+			r.add("error", "secretsBackend.mount", "mount must be a single path segment such as secret")
+		}
+	default:
+		r.add("error", "secretsBackend.type", fmt.Sprintf("unknown secrets backend %q (want sops, nomad or vault)", b.Type))
+	}
+	if strings.Contains(b.Path, "..") {
+		r.add("error", "secretsBackend.path", "path must not contain ..")
+	}
+}
+
+func validateCredentialRotation(r *ValidationResult, spec *InfraSpec) {
+	c := spec.CredentialRotation
+	if c == nil {
+		return
+	}
+	if c.Every != "" {
+		if d, err := time.ParseDuration(c.Every); err != nil {
+			r.add("error", "credentialRotation.every", fmt.Sprintf("invalid duration %q", c.Every))
+		} else if d < MinRotationInterval {
+			r.add("error", "credentialRotation.every", fmt.Sprintf("rotating more often than every %s is not supported", MinRotationInterval))
+		}
+	}
+	for i, name := range c.Services {
+		field := fmt.Sprintf("credentialRotation.services[%d]", i)
+		switch name {
+		case CredentialPostgres, CredentialObjectStorage, CredentialKafka:
+			if !spec.declaresCredential(name) {
+				r.add("warning", field, fmt.Sprintf("%s is not declared under infrastructure", name))
+			}
+		default:
+			r.add("error", field, fmt.Sprintf("unknown service %q (want postgres, objectStorage or kafka)", name))
+		}
+	}
+	for _, name := range spec.RotatableCredentials() {
+		if provider := spec.Infrastructure.ObjectStorage.Provider; name == CredentialObjectStorage && provider != "" && !strings.EqualFold(provider, "garage") {
+			r.add("warning", "credentialRotation", "object storage keys can only be rotated with the garage provider")
+		}
+	}
+}
+
+var previewDomainRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)+$`)
+
+func validatePreviews(r *ValidationResult, spec *InfraSpec) {
+	if spec.Repo == nil || spec.Repo.Previews == nil || !spec.Repo.Previews.Enabled {
+		return
+	}
+	p := spec.Repo.Previews
+	if !previewDomainRe.MatchString(p.Domain) {
+		r.add("error", "repo.previews.domain", "previews require a domain such as preview.example.com")
+	}
+	if p.TTL != "" {
+		if d, err := time.ParseDuration(p.TTL); err != nil || d <= 0 {
+			r.add("error", "repo.previews.ttl", fmt.Sprintf("invalid ttl duration %q", p.TTL))
+		}
+	}
+	if p.Environment != "" {
+		if _, ok := spec.Environments[p.Environment]; !ok {
+			r.add("error", "repo.previews.environment", fmt.Sprintf("environment %s is not declared", p.Environment))
+		}
+	}
+	if m := spec.Migrations; m != nil && m.Database != "" && (spec.Infrastructure == nil || spec.Infrastructure.Postgres == nil || m.Database != spec.Infrastructure.Postgres.Database) {
+		r.add("error", "repo.previews", fmt.Sprintf("previews cannot run migrations against migrations.database %s; only infrastructure.postgres is copied per preview", m.Database))
+	}
+	web := false
+	for _, proc := range spec.Processes {
+		if proc.Port > 0 && proc.Schedule == "" {
+			web = true
+		}
+	}
+	if !web {
+		r.add("warning", "repo.previews", "no process has a port, so previews get no URL")
+	}
+}
+
+var buildPlatformRe = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`)
+var buildSecretIDRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+var trustedForkRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+
+// validateBuild checks build options. Build secret keys must match a
+// secrets entry exactly, as the build looks them up by exact name.
+func validateBuild(r *ValidationResult, build *BuildSpec, secrets []string) {
+	if build == nil {
+		return
+	}
+	switch build.Backend {
+	case "", "docker", "buildkit", "buildah":
+	default:
+		r.add("error", "build.backend", fmt.Sprintf("unknown build backend %q (want docker, buildkit or buildah)", build.Backend))
+	}
+	for i, platform := range build.Platforms {
+		if !buildPlatformRe.MatchString(platform) {
+			r.add("error", fmt.Sprintf("build.platforms[%d]", i), fmt.Sprintf("invalid platform %q (want os/arch, e.g. linux/amd64)", platform))
+		}
+	}
+	for key := range build.Args {
+		if !envNameRe.MatchString(key) {
+			r.add("error", "build.args."+key, "build arg names must be valid identifiers")
+		}
+		if key == "VERSION" || key == "BUILD_NUMBER" {
+			r.add("warning", "build.args."+key, "VERSION and BUILD_NUMBER are set by norn and override this value")
+		}
+	}
+	for i, ref := range build.CacheFrom {
+		if strings.TrimSpace(ref) == "" {
+			r.add("error", fmt.Sprintf("build.cacheFrom[%d]", i), "cache reference must not be empty")
+		}
+	}
+	for i, ref := range build.CacheTo {
+		if strings.TrimSpace(ref) == "" {
+			r.add("error", fmt.Sprintf("build.cacheTo[%d]", i), "cache reference must not be empty")
+		}
+	}
+	ids := map[string]bool{}
+	for i, secret := range build.Secrets {
+		field := fmt.Sprintf("build.secrets[%d]", i)
+		if secret.ID == "" {
+			r.add("error", field+".id", "build secret id is required")
+		} else if !secret.ValidID() {
+			r.add("error", field+".id", fmt.Sprintf("build secret id %q may only contain letters, digits, dots, dashes and underscores", secret.ID))
+		} else if ids[secret.ID] {
+			r.add("error", field+".id", fmt.Sprintf("duplicate build secret id %q", secret.ID))
+		}
+		ids[secret.ID] = true
+		switch {
+		case secret.Key == "" && secret.Src == "":
+			r.add("error", field, "build secret needs key or src")
+		case secret.Key != "" && secret.Src != "":
+			r.add("error", field, "build secret takes key or src, not both")
+		case secret.Key != "" && !slices.Contains(secrets, secret.Key):
+			r.add("error", field+".key", fmt.Sprintf("build secret key %q is not listed in secrets", secret.Key))
+		case secret.Src != "" && (filepath.IsAbs(secret.Src) || strings.HasPrefix(filepath.Clean(secret.Src), "..")):
+			r.add("error", field+".src", "build secret src must be a path inside the source tree")
+		}
+	}
+}
+
 func validateTuningPolicy(r *ValidationResult, field string, tuning *TuningPolicy) {
 	if tuning == nil {
 		return
@@ -292,6 +748,11 @@ func validateTuningPolicy(r *ValidationResult, field string, tuning *TuningPolic
 			r.add("error", field+".cooldown", fmt.Sprintf("invalid cooldown duration %q", tuning.Cooldown))
 		}
 	}
+	if tuning.RevertWindow != "" {
+		if d, err := time.ParseDuration(tuning.RevertWindow); err != nil || d < time.Minute {
+			r.add("error", field+".revertWindow", fmt.Sprintf("invalid revertWindow %q (want a duration of at least 1m)", tuning.RevertWindow))
+		}
+	}
 	for name, profile := range tuning.Profiles {
 		validateTuningProfile(r, field+".profiles."+name, profile)
 	}
@@ -323,6 +784,15 @@ func validateTuningPolicy(r *ValidationResult, field string, tuning *TuningPolic
 				r.add("error", signalField+".window", fmt.Sprintf("invalid window duration %q", signal.Window))
 			}
 		}
+		if !tuningAggregateRe.MatchString(signal.Aggregate) {
+			r.add("error", signalField+".aggregate", "signal aggregate must be current, max, avg, or a percentile such as p95")
+		}
+		if signal.Source == "prometheus" && signal.Metric == "custom" && strings.TrimSpace(signal.Query) == "" {
+			r.add("error", signalField+".query", "custom prometheus signals need a query")
+		}
+		if signal.Query != "" && signal.Source != "prometheus" {
+			r.add("warning", signalField+".query", "query is only used by prometheus signals")
+		}
 	}
 }
 
@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"strings"
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestValidateSpecWarnsForPlainSecretLikeEnv(t *testing.T) {
@@ -233,6 +236,7 @@ func TestValidateSpecAcceptsTuningPolicy(t *testing.T) {
 					Signals: []TuningSignal{
 						{Source: "nomad", Metric: "memory_rss", Aggregate: "current"},
 						{Source: "prometheus", Metric: "container_memory_working_set_bytes", Window: "24h", Aggregate: "p95"},
+						{Source: "prometheus", Metric: "custom", Query: `sum(rate(jobs_failed_total{app="tuned-app"}[5m]))`, Window: "1h", Aggregate: "avg"},
 					},
 				},
 			},
@@ -259,6 +263,8 @@ func TestValidateSpecRejectsInvalidTuningPolicy(t *testing.T) {
 					},
 					Signals: []TuningSignal{
 						{Source: "mystery"},
+						{Source: "prometheus", Metric: "cpu_percent", Aggregate: "p100"},
+						{Source: "prometheus", Metric: "custom"},
 					},
 				},
 			},
@@ -276,6 +282,8 @@ func TestValidateSpecRejectsInvalidTuningPolicy(t *testing.T) {
 	assertErrorFinding(t, result, "processes.web.tuning.limits.scale")
 	assertErrorFinding(t, result, "processes.web.tuning.signals[0].source")
 	assertErrorFinding(t, result, "processes.web.tuning.signals[0].metric")
+	assertErrorFinding(t, result, "processes.web.tuning.signals[1].aggregate")
+	assertErrorFinding(t, result, "processes.web.tuning.signals[2].query")
 }
 
 func TestValidateSpecAcceptsObjectStorageBuckets(t *testing.T) {
@@ -372,3 +380,461 @@ func assertErrorFinding(t *testing.T, result *ValidationResult, field string) {
 	}
 	t.Fatalf("missing error for %s in %+v", field, result.Findings)
 }
+
+func TestValidateSpecChecksBuildOptions(t *testing.T) {
+	spec := &InfraSpec{
+		App:       "built",
+		Processes: map[string]Process{"web": {}},
+		Secrets:   []string{"NPM_TOKEN"},
+		Build: &BuildSpec{
+			Dockerfile: "Dockerfile",
+			Backend:    "kaniko",
+			Platforms:  []string{"linux/amd64", "amd64"},
+			Secrets: []BuildSecret{
+				{ID: "npm", Key: "NPM_TOKEN"},
+				{ID: "pip", Key: "PIP_TOKEN"},
+				{ID: "ssh", Src: "../id_rsa"},
+				{ID: "../../x", Key: "NPM_TOKEN"},
+				{ID: "..", Key: "NPM_TOKEN"},
+				{ID: "npm-lower", Key: "npm_token"},
+			},
+		},
+	}
+
+	result := ValidateSpec(spec)
+	assertErrorFinding(t, result, "build.backend")
+	assertErrorFinding(t, result, "build.platforms[1]")
+	assertErrorFinding(t, result, "build.secrets[1].key")
+	assertErrorFinding(t, result, "build.secrets[2].src")
+	assertErrorFinding(t, result, "build.secrets[3].id")
+	assertErrorFinding(t, result, "build.secrets[4].id")
+	assertErrorFinding(t, result, "build.secrets[5].key")
+	for _, f := range result.Findings {
+		if f.Field == "build.platforms[0]" || strings.HasPrefix(f.Field, "build.secrets[0]") {
+			t.Fatalf("unexpected finding %+v", f)
+		}
+	}
+}
+
+func TestMigrationsAcceptStringShorthand(t *testing.T) {
+	var spec InfraSpec
+	if err := yaml.Unmarshal([]byte("name: orders\nmigrations: make migrate\n"), &spec); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if spec.Migrations == nil || spec.Migrations.Up != "make migrate" || spec.Migrations.RevertPolicy() != MigrationRevertNone {
+		t.Fatalf("migrations = %+v", spec.Migrations)
+	}
+
+	doc := "name: orders\nmigrations:\n  up: migrate up\n  down: migrate goto $MIGRATION_TARGET_VERSION\n  timeout: 2m\n  database: orders_main\n"
+	if err := yaml.Unmarshal([]byte(doc), &spec); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if spec.Migrations.Down == "" || spec.Migrations.TimeoutDuration().String() != "2m0s" || spec.MigrationDatabase() != "orders_main" {
+		t.Fatalf("migrations = %+v", spec.Migrations)
+	}
+	if spec.Migrations.RevertPolicy() != MigrationRevertNone {
+		t.Fatalf("policy = %s, want none without onFailure", spec.Migrations.RevertPolicy())
+	}
+}
+
+func TestValidateSpecChecksMigrations(t *testing.T) {
+	spec := &InfraSpec{
+		App:        "orders",
+		Processes:  map[string]Process{"web": {}},
+		Migrations: &MigrationSpec{Timeout: "soon", OnFailure: "down"},
+	}
+
+	result := ValidateSpec(spec)
+	assertErrorFinding(t, result, "migrations.up")
+	assertErrorFinding(t, result, "migrations.timeout")
+	assertErrorFinding(t, result, "migrations.onFailure")
+}
+
+func TestValidateRejectsUnknownForge(t *testing.T) {
+	spec := &InfraSpec{
+		App:       "shop",
+		Repo:      &RepoSpec{URL: "https://github.com/acme/shop.git", Forge: "bitbucket"},
+		Processes: map[string]Process{"web": {Port: 8080}},
+	}
+	assertErrorFinding(t, ValidateSpec(spec), "repo.forge")
+}
+
+func TestValidateRejectsMalformedTrustedForks(t *testing.T) {
+	spec := &InfraSpec{
+		App:       "shop",
+		Repo:      &RepoSpec{URL: "https://github.com/acme/shop.git", TrustedForks: []string{"acme-bot/shop", "https://github.com/mallory/shop"}},
+		Processes: map[string]Process{"web": {Port: 8080}},
+	}
+	result := ValidateSpec(spec)
+	assertErrorFinding(t, result, "repo.trustedForks[1]")
+	for _, f := range result.Findings {
+		if f.Field == "repo.trustedForks[0]" {
+			t.Fatalf("unexpected finding %+v", f)
+		}
+	}
+}
+
+func TestValidateScaleToZero(t *testing.T) {
+	spec := &InfraSpec{
+		App:       "tools",
+		Endpoints: []Endpoint{{URL: "https://tools.example.com"}},
+		Processes: map[string]Process{
+			"web":    {Port: 8080, Scaling: &Scaling{ScaleToZero: true, IdleTimeout: "15m"}},
+			"worker": {Command: "./worker", Scaling: &Scaling{ScaleToZero: true}},
+			"api":    {Port: 9090, Scaling: &Scaling{ScaleToZero: true, IdleTimeout: "30s"}},
+		},
+	}
+	result := ValidateSpec(spec)
+	assertErrorFinding(t, result, "processes.worker.scaling.scaleToZero")
+	assertErrorFinding(t, result, "processes.api.scaling.idleTimeout")
+	for _, f := range result.Findings {
+		if f.Severity == "error" && strings.HasPrefix(f.Field, "processes.web.") {
+			t.Fatalf("unexpected finding for web: %+v", f)
+		}
+	}
+}
+
+func TestValidateAutoScale(t *testing.T) {
+	spec := &InfraSpec{
+		App: "mail",
+		Processes: map[string]Process{
+			"web":      {Port: 8080, Scaling: &Scaling{Min: 1, Max: 4, Auto: &AutoScale{Metric: "cpu", Target: 70, ScaleDownWindow: "10m"}}},
+			"consumer": {Command: "./consume", Scaling: &Scaling{Max: 8, Auto: &AutoScale{Metric: "kafka_lag", Target: 1000, Topic: "mail.events"}}},
+			"queue":    {Port: 9090, Scaling: &Scaling{Max: 3, Auto: &AutoScale{Metric: "custom", Target: 50, Query: "queue_depth"}}},
+			"sweeper":  {Command: "./sweep", Scaling: &Scaling{Auto: &AutoScale{Metric: "rps", Target: 0, Cooldown: "soon"}}},
+		},
+	}
+	result := ValidateSpec(spec)
+	assertErrorFinding(t, result, "processes.consumer.scaling.auto")
+	assertErrorFinding(t, result, "processes.queue.scaling.auto.query")
+	assertErrorFinding(t, result, "processes.sweeper.scaling.auto.metric")
+	assertErrorFinding(t, result, "processes.sweeper.scaling.auto.target")
+	assertErrorFinding(t, result, "processes.sweeper.scaling.auto")
+	assertErrorFinding(t, result, "processes.sweeper.scaling.auto.cooldown")
+	for _, f := range result.Findings {
+		if f.Severity == "error" && strings.HasPrefix(f.Field, "processes.web.") {
+			t.Fatalf("unexpected finding for web: %+v", f)
+		}
+	}
+}
+
+func TestValidateCredentialRotation(t *testing.T) {
+	spec := &InfraSpec{
+		App:       "mail",
+		Processes: map[string]Process{"web": {Port: 8080}},
+		Infrastructure: &Infrastructure{
+			Postgres:      &PostgresInfra{Database: "mail"},
+			ObjectStorage: &ObjectStorageInfra{Provider: "s3", Buckets: []ObjectStorageBucket{{Name: "mail"}}},
+		},
+		CredentialRotation: &CredentialRotation{Every: "10m", Services: []string{"postgres", "objectStorage", "kafka", "redis"}},
+	}
+	result := ValidateSpec(spec)
+	assertErrorFinding(t, result, "credentialRotation.every")
+	assertFinding(t, result, "credentialRotation.services[2]")
+	assertErrorFinding(t, result, "credentialRotation.services[3]")
+	assertFinding(t, result, "credentialRotation")
+
+	if got := strings.Join(spec.RotatableCredentials(), ","); got != "postgres,objectStorage" {
+		t.Fatalf("RotatableCredentials = %s", got)
+	}
+	if spec.RotationInterval() != 0 {
+		t.Fatal("an interval under the minimum should not schedule rotation")
+	}
+	spec.CredentialRotation = &CredentialRotation{Every: "720h"}
+	if spec.RotationInterval() != 720*time.Hour {
+		t.Fatalf("RotationInterval = %s", spec.RotationInterval())
+	}
+	if got := strings.Join(spec.RotatableCredentials(), ","); got != "postgres,objectStorage" {
+		t.Fatalf("RotatableCredentials without a filter = %s", got)
+	}
+}
+
+func TestValidatePlacement(t *testing.T) {
+	spec := &InfraSpec{
+		App: "mail",
+		Processes: map[string]Process{
+			"web": {Port: 8080, Placement: &Placement{
+				Constraints: []PlacementConstraint{{Attribute: "meta.tier", Value: "edge"}, {Operator: "distinct_hosts"}},
+				Affinities:  []PlacementAffinity{{Attribute: "node.class", Value: "fast", Weight: 25}},
+				Spread:      []PlacementSpread{{Attribute: "node.datacenter", Targets: []SpreadTarget{{Value: "dc1", Percent: 70}, {Value: "dc2", Percent: 30}}}},
+			}},
+			"worker": {Command: "./work", Placement: &Placement{
+				Datacenters: []string{""},
+				Constraints: []PlacementConstraint{{Attribute: "cpu.arch", Value: "amd64"}, {Attribute: "attr.kernel.name", Operator: "like", Value: "linux"}, {Attribute: "meta.zone", Operator: "regexp", Value: "("}},
+				Affinities:  []PlacementAffinity{{Attribute: "meta.gpu", Operator: "is_set", Weight: 150}},
+				Spread:      []PlacementSpread{{Attribute: "node.unique.name", Targets: []SpreadTarget{{Value: "a", Percent: 80}, {Value: "b", Percent: 40}}}},
+			}},
+		},
+	}
+	result := ValidateSpec(spec)
+	assertErrorFinding(t, result, "processes.worker.placement.datacenters[0]")
+	assertErrorFinding(t, result, "processes.worker.placement.constraints[0].attribute")
+	assertErrorFinding(t, result, "processes.worker.placement.constraints[1].operator")
+	assertErrorFinding(t, result, "processes.worker.placement.constraints[2].value")
+	assertErrorFinding(t, result, "processes.worker.placement.affinities[0].operator")
+	assertErrorFinding(t, result, "processes.worker.placement.affinities[0].weight")
+	assertErrorFinding(t, result, "processes.worker.placement.spread[0].targets")
+	for _, f := range result.Findings {
+		if f.Severity == "error" && strings.HasPrefix(f.Field, "processes.web.") {
+			t.Fatalf("unexpected finding for web: %+v", f)
+		}
+	}
+}
+
+func TestValidatePlacementAgainstNodes(t *testing.T) {
+	nodes := []PlacementNode{
+		{Name: "big", Datacenter: "dc1", Class: "compute", Eligible: true, Attributes: map[string]string{"cpu.arch": "amd64", "memory.totalbytes": "34359738368"}, Meta: map[string]string{"gpu": "true"}},
+		{Name: "small", Datacenter: "dc1", Class: "edge", Eligible: true, Attributes: map[string]string{"cpu.arch": "arm64", "memory.totalbytes": "2147483648"}},
+		{Name: "drained", Datacenter: "dc1", Class: "compute", Attributes: map[string]string{"cpu.arch": "amd64"}},
+	}
+	spec := &InfraSpec{
+		App: "mail",
+		Processes: map[string]Process{
+			"batch": {Command: "./batch", Placement: &Placement{
+				Constraints: []PlacementConstraint{{Attribute: "meta.gpu", Operator: "is_not_set"}, {Attribute: "attr.memory.totalbytes", Operator: ">=", Value: "1073741824"}},
+			}},
+			"web": {Port: 8080, Scaling: &Scaling{Min: 3}, Placement: &Placement{
+				Constraints: []PlacementConstraint{{Operator: "distinct_hosts"}},
+				Affinities:  []PlacementAffinity{{Attribute: "node.class", Value: "gpu"}},
+				Spread:      []PlacementSpread{{Attribute: "meta.rack"}},
+			}},
+			"trainer": {Command: "./train", Placement: &Placement{
+				Constraints: []PlacementConstraint{{Attribute: "attr.cpu.arch", Value: "amd64"}, {Attribute: "node.class", Value: "edge"}},
+			}},
+			"remote": {Command: "./remote", Placement: &Placement{Datacenters: []string{"fsn1"}}},
+		},
+	}
+	result := ValidateSpecWithOptions(spec, ValidationOptions{Nodes: nodes})
+	assertFinding(t, result, "processes.web.placement.constraints[0]")
+	assertFinding(t, result, "processes.web.placement.affinities[0]")
+	assertFinding(t, result, "processes.web.placement.spread[0]")
+	assertErrorFinding(t, result, "processes.trainer.placement")
+	assertErrorFinding(t, result, "processes.remote.placement")
+	for _, f := range result.Findings {
+		if strings.HasPrefix(f.Field, "processes.batch.") {
+			t.Fatalf("unexpected finding for batch: %+v", f)
+		}
+		if f.Field == "processes.trainer.placement" && !strings.Contains(f.Message, "no node meets every constraint") {
+			t.Fatalf("trainer finding = %s", f.Message)
+		}
+		if f.Field == "processes.remote.placement" && !strings.Contains(f.Message, "none in datacenters fsn1") {
+			t.Fatalf("remote finding = %s", f.Message)
+		}
+	}
+
+	if ValidateSpec(spec).Valid != true {
+		t.Fatal("without nodes placement should not be checked against the inventory")
+	}
+}
+
+func TestValidateProcessTasks(t *testing.T) {
+	spec := &InfraSpec{
+		App: "mail",
+		Processes: map[string]Process{
+			"web": {Port: 8080, Health: &HealthSpec{Path: "/health"}, Tasks: []ProcessTask{
+				{Name: "wait-for-db", Lifecycle: TaskInit, Image: "busybox:1.36", Command: "until nc -z db 5432; do sleep 1; done"},
+				{Name: "shipper", Lifecycle: TaskSidecar, Image: "vector:0.40", Resources: &Resources{Memory: 64}},
+				{Name: "warm", Lifecycle: TaskPoststart, Command: "./warm-cache"},
+			}},
+			"worker": {Command: "./work", Tasks: []ProcessTask{
+				{Name: "worker", Lifecycle: TaskInit, Image: "busybox"},
+				{Name: "Bad_Name", Lifecycle: TaskSidecar, Image: "busybox"},
+				{Name: "dup", Lifecycle: "prestart", Image: "busybox"},
+				{Name: "dup", Lifecycle: TaskPoststop},
+				{Name: "heavy", Lifecycle: TaskSidecar, Image: "busybox", Resources: &Resources{CPU: -1}},
+			}},
+		},
+	}
+	result := ValidateSpec(spec)
+	assertErrorFinding(t, result, "processes.worker.tasks[0].name")
+	assertErrorFinding(t, result, "processes.worker.tasks[1].name")
+	assertErrorFinding(t, result, "processes.worker.tasks[2].lifecycle")
+	assertErrorFinding(t, result, "processes.worker.tasks[3].name")
+	assertErrorFinding(t, result, "processes.worker.tasks[3]")
+	assertErrorFinding(t, result, "processes.worker.tasks[4].resources")
+	for _, f := range result.Findings {
+		if f.Severity == "error" && strings.HasPrefix(f.Field, "processes.web.") {
+			t.Fatalf("unexpected finding for web: %+v", f)
+		}
+	}
+}
+
+func TestValidateVolumes(t *testing.T) {
+	off := false
+	spec := &InfraSpec{
+		App: "wiki",
+		Processes: map[string]Process{
+			"web": {Port: 8080, Health: &HealthSpec{Path: "/health"}, Scaling: &Scaling{Min: 2}},
+		},
+		Volumes: []VolumeSpec{
+			{Name: "uploads", Mount: "/uploads", Size: "10GiB"},
+			{Name: "cache", Mount: "/cache", Type: VolumeCSI, Plugin: "nfs", AccessMode: "multi-node-multi-writer"},
+			{Name: "config", Mount: "/etc/wiki", ReadOnly: true},
+			{Name: "uploads", Mount: "/uploads"},
+			{Name: "bad", Mount: "/bad", Type: "nfs"},
+			{Name: "block", Mount: "/block", Type: VolumeCSI, Size: "ten gigs"},
+			{Name: "modes", Mount: "/modes", Size: "1GB", AccessMode: "multi-node-multi-writer"},
+			{Name: "static", Mount: "/static", AccessMode: "single-node-writer"},
+			{Name: "lock", Mount: "/lock", Size: "100MiB", AccessMode: "single-node-single-writer", Snapshot: &off},
+		},
+	}
+	result := ValidateSpec(spec)
+	assertErrorFinding(t, result, "volumes[3].name")
+	assertErrorFinding(t, result, "volumes[3].mount")
+	assertErrorFinding(t, result, "volumes[4].type")
+	assertErrorFinding(t, result, "volumes[5].plugin")
+	assertErrorFinding(t, result, "volumes[5].size")
+	assertErrorFinding(t, result, "volumes[6].accessMode")
+	assertFinding(t, result, "volumes[7]")
+	assertFinding(t, result, "volumes[8].accessMode")
+	for _, f := range result.Findings {
+		if strings.HasPrefix(f.Field, "volumes[0]") || strings.HasPrefix(f.Field, "volumes[1]") || strings.HasPrefix(f.Field, "volumes[2]") {
+			t.Fatalf("unexpected finding: %+v", f)
+		}
+	}
+
+	for size, want := range map[string]int64{"10GiB": 10 << 30, "500MB": 500e6, "4096": 4096} {
+		if got, err := ParseVolumeSize(size); err != nil || got != want {
+			t.Fatalf("ParseVolumeSize(%q) = %d, %v; want %d", size, got, err, want)
+		}
+	}
+	if spec.Volumes[0].Source("wiki-staging") != "wiki-staging-uploads" || spec.Volumes[2].Source("wiki-staging") != "config" {
+		t.Fatal("managed volumes should be prefixed with the job ID and host volumes keep their name")
+	}
+	if !spec.Volumes[0].Snapshotted() || spec.Volumes[1].Snapshotted() || spec.Volumes[8].Snapshotted() {
+		t.Fatal("only writable managed host volumes that do not opt out are snapshotted")
+	}
+}
+
+func TestValidateMesh(t *testing.T) {
+	spec := &InfraSpec{
+		App: "billing",
+		Processes: map[string]Process{
+			"web": {Port: 8080, Health: &HealthSpec{Path: "/health"}, Mesh: &MeshSpec{Upstreams: []MeshUpstream{
+				{Service: "ledger-api", LocalPort: 9001},
+				{Service: "billing-worker", LocalPort: 9002},
+			}}},
+			"api": {Port: 8081, Health: &HealthSpec{Path: "/health"}, Metrics: &MetricsSpec{Enabled: true, Port: 9100}, Mesh: &MeshSpec{Upstreams: []MeshUpstream{
+				{Service: "", LocalPort: 9001},
+				{Service: "billing-api", LocalPort: 9002},
+				{Service: "ledger-api", LocalPort: 8081},
+				{Service: "ledger-api", LocalPort: 9100},
+				{Service: "auth", LocalPort: 9002},
+				{Service: "search", LocalPort: 70000},
+			}}},
+			"worker":  {Command: "./worker", Mesh: &MeshSpec{}},
+			"nightly": {Command: "./report", Schedule: "0 3 * * *", Mesh: &MeshSpec{}},
+		},
+	}
+	result := ValidateSpec(spec)
+	assertErrorFinding(t, result, "processes.api.mesh.upstreams[0].service")
+	assertErrorFinding(t, result, "processes.api.mesh.upstreams[1].service")
+	assertErrorFinding(t, result, "processes.api.mesh.upstreams[2].localPort")
+	assertErrorFinding(t, result, "processes.api.mesh.upstreams[3].service")
+	assertErrorFinding(t, result, "processes.api.mesh.upstreams[3].localPort")
+	assertErrorFinding(t, result, "processes.api.mesh.upstreams[4].localPort")
+	assertErrorFinding(t, result, "processes.api.mesh.upstreams[5].localPort")
+	assertErrorFinding(t, result, "processes.worker.mesh")
+	assertErrorFinding(t, result, "processes.nightly.mesh")
+	for _, f := range result.Findings {
+		if strings.HasPrefix(f.Field, "processes.web.mesh") {
+			t.Fatalf("unexpected finding: %+v", f)
+		}
+	}
+
+	graph := MeshGraph("billing-staging", spec)
+	if len(graph) != 2 || strings.Join(graph["billing-staging-web"], ",") != "ledger-api,billing-worker" {
+		t.Fatalf("graph = %v", graph)
+	}
+	if got := strings.Join(MeshServices("billing", spec), ","); got != "billing-api,billing-web" {
+		t.Fatalf("mesh services = %s", got)
+	}
+}
+
+func TestValidateRestartAndUpdate(t *testing.T) {
+	zero, negative := 0, -1
+	spec := &InfraSpec{
+		App: "ledger",
+		Processes: map[string]Process{
+			"jvm": {Port: 8080, Health: &HealthSpec{Path: "/health"}, Scaling: &Scaling{Min: 4},
+				Restart: &RestartSpec{Attempts: &zero, Mode: RestartFail},
+				Update:  &UpdateSpec{MaxParallel: 2, MinHealthyTime: "1m", HealthyDeadline: "15m", ProgressDeadline: "20m", Stagger: "1m", HealthCheck: HealthCheckTaskStates}},
+			"api": {Port: 8081, Health: &HealthSpec{Path: "/health"},
+				Restart: &RestartSpec{Attempts: &negative, Interval: "soon", Mode: "always"},
+				Update:  &UpdateSpec{MaxParallel: -1, MinHealthyTime: "6m", HealthCheck: "manual"}},
+			"tight":   {Port: 8082, Health: &HealthSpec{Path: "/health"}, Restart: &RestartSpec{Interval: "30s"}, Update: &UpdateSpec{HealthyDeadline: "10m"}},
+			"nightly": {Command: "./report", Schedule: "0 3 * * *", Restart: &RestartSpec{Attempts: &zero}, Update: &UpdateSpec{MaxParallel: 2}},
+		},
+	}
+	result := ValidateSpec(spec)
+	assertErrorFinding(t, result, "processes.api.restart.attempts")
+	assertErrorFinding(t, result, "processes.api.restart.interval")
+	assertErrorFinding(t, result, "processes.api.restart.mode")
+	assertErrorFinding(t, result, "processes.api.update.maxParallel")
+	assertErrorFinding(t, result, "processes.api.update.minHealthyTime")
+	assertErrorFinding(t, result, "processes.api.update.healthCheck")
+	assertErrorFinding(t, result, "processes.tight.restart")
+	assertErrorFinding(t, result, "processes.tight.update.healthyDeadline")
+	assertErrorFinding(t, result, "processes.nightly.update")
+	for _, f := range result.Findings {
+		if strings.HasPrefix(f.Field, "processes.jvm.") || strings.HasPrefix(f.Field, "processes.nightly.restart") {
+			t.Fatalf("unexpected finding: %+v", f)
+		}
+	}
+
+	if got := ProcessRestart(spec.Processes["jvm"]); got.Attempts != 0 || got.Mode != RestartFail || got.Interval != 5*time.Minute {
+		t.Fatalf("jvm restart = %+v", got)
+	}
+	if got := ProcessRestart(spec.Processes["nightly"]); got.Interval != 24*time.Hour || got.Mode != RestartFail {
+		t.Fatalf("nightly restart = %+v", got)
+	}
+
+	// Four allocations two at a time: two waves of 15m with a 1m stagger.
+	delete(spec.Processes, "api")
+	delete(spec.Processes, "tight")
+	if got := HealthyTimeout(spec); got != 31*time.Minute {
+		t.Fatalf("healthy timeout = %s", got)
+	}
+	if got := HealthyTimeout(&InfraSpec{Processes: map[string]Process{"web": {Port: 8080}}}); got != 5*time.Minute {
+		t.Fatalf("default healthy timeout = %s", got)
+	}
+}
+
+func TestValidateCanaryStepsRequireMesh(t *testing.T) {
+	steps := []CanaryStep{{Weight: 10, Pause: "2m"}, {Weight: 50}}
+	spec := &InfraSpec{
+		App: "shop",
+		Processes: map[string]Process{
+			"web": {Port: 8080, Canary: &CanaryConfig{Count: 1, Steps: steps}, Mesh: &MeshSpec{}},
+			"api": {Port: 8081, Canary: &CanaryConfig{Count: 1, Steps: steps}},
+		},
+	}
+	result := ValidateSpec(spec)
+	assertErrorFinding(t, result, "processes.api.canary.steps")
+	for _, f := range result.Findings {
+		if f.Severity == "error" && strings.HasPrefix(f.Field, "processes.web.canary") {
+			t.Fatalf("unexpected finding for the meshed process: %+v", f)
+		}
+	}
+}
+
+func TestValidateCanaryStepsMustMatchAcrossProcesses(t *testing.T) {
+	spec := &InfraSpec{
+		App: "shop",
+		Processes: map[string]Process{
+			"web":    {Port: 8080, Canary: &CanaryConfig{Count: 1, Steps: []CanaryStep{{Weight: 10}, {Weight: 50}}}, Mesh: &MeshSpec{}},
+			"api":    {Port: 8081, Canary: &CanaryConfig{Count: 1, Steps: []CanaryStep{{Weight: 10}, {Weight: 50}}}, Mesh: &MeshSpec{}},
+			"worker": {Port: 8082, Canary: &CanaryConfig{Count: 1, Steps: []CanaryStep{{Weight: 25}}}, Mesh: &MeshSpec{}},
+		},
+	}
+	if got := spec.CanaryStepsProcess(); got != "api" {
+		t.Fatalf("steps process = %q, want api", got)
+	}
+	result := ValidateSpec(spec)
+	assertErrorFinding(t, result, "processes.worker.canary.steps")
+	for _, f := range result.Findings {
+		if f.Severity == "error" && f.Field == "processes.web.canary.steps" {
+			t.Fatalf("web declares the same steps as api: %+v", f)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Volume backings.
+const (
+	VolumeHost = "host"
+	VolumeCSI  = "csi"
+)
+
+// DefaultVolumeAccessMode is how a volume is claimed when the spec does not
+// say: one node mounts it read-write.
+const DefaultVolumeAccessMode = "single-node-writer"
+
+// DefaultHostVolumePlugin creates a directory on the client node.
+const DefaultHostVolumePlugin = "mkdir"
+
+// VolumeSpec is a volume mounted into every task group of the app. A host
+// volume without a size must already be configured on the Nomad client;
+// sized host volumes and CSI volumes are created by Norn on first deploy.
+type VolumeSpec struct {
+	Name     string `yaml:"name" json:"name"`
+	Mount    string `yaml:"mount" json:"mount"`
+	ReadOnly bool   `yaml:"readOnly,omitempty" json:"readOnly,omitempty"`
+	// Type is host (default) or csi.
+	Type string `yaml:"type,omitempty" json:"type,omitempty"`
+	// Size is the capacity to request, e.g. 10GiB or 500MB.
+	Size string `yaml:"size,omitempty" json:"size,omitempty"`
+	// AccessMode defaults to single-node-writer.
+	AccessMode string `yaml:"accessMode,omitempty" json:"accessMode,omitempty"`
+	// Plugin is the host volume plugin (default mkdir) or the CSI plugin ID.
+	Plugin string `yaml:"plugin,omitempty" json:"plugin,omitempty"`
+	// Snapshot set to false leaves a host volume out of deploy snapshots.
+	Snapshot *bool `yaml:"snapshot,omitempty" json:"snapshot,omitempty"`
+}
+
+// VolumeType returns the volume's backing, host when unset.
+func (v VolumeSpec) VolumeType() string {
+	if v.Type == "" {
+		return VolumeHost
+	}
+	return v.Type
+}
+
+// Managed reports whether Norn creates and owns the volume rather than
+// mounting a host volume configured on the client.
+func (v VolumeSpec) Managed() bool {
+	return v.Size != "" || v.VolumeType() == VolumeCSI
+}
+
+// Source is the volume's name in Nomad for the job. Managed volumes are
+// prefixed with the job ID so apps, environments and previews declaring
+// "data" each get their own volume.
+func (v VolumeSpec) Source(jobID string) string {
+	if v.Managed() {
+		return jobID + "-" + v.Name
+	}
+	return v.Name
+}
+
+// Access returns the volume's access mode, single-node-writer when unset.
+func (v VolumeSpec) Access() string {
+	if v.AccessMode == "" {
+		return DefaultVolumeAccessMode
+	}
+	return v.AccessMode
+}
+
+// PluginID returns the plugin that creates the volume.
+func (v VolumeSpec) PluginID() string {
+	if v.Plugin == "" && v.VolumeType() == VolumeHost {
+		return DefaultHostVolumePlugin
+	}
+	return v.Plugin
+}
+
+// Snapshotted reports whether deploys archive the volume's files. Only
+// writable managed host volumes have files Norn can reach.
+func (v VolumeSpec) Snapshotted() bool {
+	if !v.Managed() || v.VolumeType() != VolumeHost || v.ReadOnly {
+		return false
+	}
+	return v.Snapshot == nil || *v.Snapshot
+}
+
+// ManagedVolumes returns the volumes Norn creates for spec.
+func ManagedVolumes(spec *InfraSpec) []VolumeSpec {
+	var out []VolumeSpec
+	for _, vol := range spec.Volumes {
+		if vol.Managed() {
+			out = append(out, vol)
+		}
+	}
+	return out
+}
+
+var volumeSizeRe = regexp.MustCompile(`^(\d+)\s*([KMGT]i?B|B)?$`)
+
+var volumeSizeUnits = map[string]int64{
+	"": 1, "B": 1,
+	"KB": 1e3, "MB": 1e6, "GB": 1e9, "TB": 1e12,
+	"KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30, "TiB": 1 << 40,
+}
+
+// ParseVolumeSize parses a size such as 10GiB or 500MB into bytes.
+func ParseVolumeSize(size string) (int64, error) {
+	m := volumeSizeRe.FindStringSubmatch(strings.TrimSpace(size))
+	if m == nil {
+		return 0, fmt.Errorf("size %q must be a whole number with an optional B, KB, MB, GB, TB, KiB, MiB, GiB or TiB unit", size)
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("size %q: %w", size, err)
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("size %q must be greater than zero", size)
+	}
+	return n * volumeSizeUnits[m[2]], nil
+}
+
+var volumeAccessModes = map[string][]string{
+	VolumeHost: {"single-node-reader-only", "single-node-writer", "single-node-single-writer", "single-node-multi-writer"},
+	VolumeCSI:  {"single-node-reader-only", "single-node-writer", "multi-node-reader-only", "multi-node-single-writer", "multi-node-multi-writer"},
+}
+
+func validateVolumes(r *ValidationResult, spec *InfraSpec) {
+	names := map[string]bool{}
+	mounts := map[string]bool{}
+	for i, vol := range spec.Volumes {
+		field := fmt.Sprintf("volumes[%d]", i)
+		switch {
+		case vol.Name == "":
+			r.add("error", field+".name", "volume name is required")
+		case names[vol.Name]:
+			r.add("error", field+".name", fmt.Sprintf("duplicate volume name %s", vol.Name))
+		}
+		names[vol.Name] = true
+		switch {
+		case vol.Mount == "":
+			r.add("error", field+".mount", "volume mount path is required")
+		case !strings.HasPrefix(vol.Mount, "/"):
+			r.add("error", field+".mount", "volume mount path must be absolute")
+		case mounts[vol.Mount]:
+			r.add("error", field+".mount", fmt.Sprintf("%s is already mounted by another volume", vol.Mount))
+		}
+		mounts[vol.Mount] = true
+
+		modes, ok := volumeAccessModes[vol.VolumeType()]
+		if !ok {
+			r.add("error", field+".type", "volume type must be host or csi")
+			continue
+		}
+		if vol.VolumeType() == VolumeCSI && vol.Plugin == "" {
+			r.add("error", field+".plugin", "csi volumes need the CSI plugin ID")
+		}
+		if vol.Size != "" {
+			if _, err := ParseVolumeSize(vol.Size); err != nil {
+				r.add("error", field+".size", err.Error())
+			}
+		}
+		if vol.AccessMode != "" && !contains(modes, vol.AccessMode) {
+			r.add("error", field+".accessMode", fmt.Sprintf("%s volumes support %s", vol.VolumeType(), strings.Join(modes, ", ")))
+		}
+		if !vol.Managed() {
+			if vol.AccessMode != "" || vol.Plugin != "" {
+				r.add("warning", field, "accessMode and plugin only apply to volumes Norn creates; set size to have Norn create this volume")
+			}
+			continue
+		}
+		if vol.Snapshot != nil && *vol.Snapshot && !vol.Snapshotted() {
+			r.add("warning", field+".snapshot", "only writable host volumes are snapshotted")
+		}
+		if vol.Access() == "single-node-single-writer" && volumeClaims(spec) > 1 {
+			r.add("warning", field+".accessMode", fmt.Sprintf("single-node-single-writer lets one allocation mount the volume but the app runs %d", volumeClaims(spec)))
+		}
+	}
+}
+
+// volumeClaims is how many allocations mount the app's volumes at once.
+func volumeClaims(spec *InfraSpec) int {
+	claims := 0
+	for _, proc := range spec.Processes {
+		if proc.Schedule != "" {
+			continue
+		}
+		if proc.Scaling != nil && proc.Scaling.Min > 1 {
+			claims += proc.Scaling.Min
+		} else {
+			claims++
+		}
+	}
+	return claims
+}
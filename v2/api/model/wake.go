@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// DefaultIdleTimeout is how long a scale-to-zero process may go without a
+// request before the idle reaper stops it, when scaling.idleTimeout is unset.
+const DefaultIdleTimeout = 30 * time.Minute
+
+// Wake actions.
+const (
+	WakeActionSleep = "sleep"
+	WakeActionWake  = "wake"
+)
+
+// WakeEvent records the idle reaper scaling a process to zero, or the wake
+// gateway scaling it back up for a request.
+type WakeEvent struct {
+	ID      int64  `json:"id"`
+	App     string `json:"app"`
+	Process string `json:"process"`
+	Action  string `json:"action"`
+	Reason  string `json:"reason,omitempty"`
+	Actor   string `json:"actor,omitempty"`
+	// DurationMs is how long the process had been idle for a sleep, and how
+	// long the cold start took for a wake.
+	DurationMs int64     `json:"durationMs,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// ScalesToZero reports whether the idle reaper may stop the process.
+func (s *Scaling) ScalesToZero() bool {
+	return s != nil && s.ScaleToZero
+}
+
+// IdleAfter returns the process's idle timeout, or DefaultIdleTimeout.
+func (s *Scaling) IdleAfter() time.Duration {
+	if s != nil && s.IdleTimeout != "" {
+		if d, err := time.ParseDuration(s.IdleTimeout); err == nil && d > 0 {
+			return d
+		}
+	}
+	return DefaultIdleTimeout
+}
@@ -0,0 +1,293 @@
+package nomad
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+
+	"norn/v2/api/model"
+)
+
+// DiffJobs lists what would change if desired replaced live. Only fields
+// Translate sets are compared, so defaults Nomad fills in on registration
+// don't show up as drift. Env values are left out of the changes.
+func DiffJobs(desired, live *nomadapi.Job) []model.DriftChange {
+	jobID := derefString(desired.ID)
+	d := &jobDiff{job: jobID}
+
+	for _, key := range unionKeys(desired.Meta, live.Meta) {
+		if key == "deploy_ts" {
+			continue
+		}
+		d.compare("", "meta."+key, desired.Meta[key], live.Meta[key])
+	}
+
+	liveGroups := map[string]*nomadapi.TaskGroup{}
+	for _, tg := range live.TaskGroups {
+		liveGroups[derefString(tg.Name)] = tg
+	}
+	seen := map[string]bool{}
+	for _, want := range desired.TaskGroups {
+		name := derefString(want.Name)
+		seen[name] = true
+		have, ok := liveGroups[name]
+		if !ok {
+			d.add(model.DriftChange{Group: name, Field: "group", Change: "added"})
+			continue
+		}
+		d.group(name, want, have)
+	}
+	for _, tg := range live.TaskGroups {
+		if name := derefString(tg.Name); !seen[name] {
+			d.add(model.DriftChange{Group: name, Field: "group", Change: "removed"})
+		}
+	}
+	return d.changes
+}
+
+type jobDiff struct {
+	job     string
+	changes []model.DriftChange
+}
+
+func (d *jobDiff) add(c model.DriftChange) {
+	c.Job = d.job
+	d.changes = append(d.changes, c)
+}
+
+func (d *jobDiff) compare(group, field, desired, live string) {
+	if desired == live {
+		return
+	}
+	change := "changed"
+	switch {
+	case live == "":
+		change = "added"
+	case desired == "":
+		change = "removed"
+	}
+	d.add(model.DriftChange{Group: group, Field: field, Change: change, Desired: desired, Live: live})
+}
+
+func (d *jobDiff) group(name string, want, have *nomadapi.TaskGroup) {
+	d.compare(name, "count", intString(want.Count), intString(have.Count))
+	if want.Update != nil {
+		u := have.Update
+		if u == nil {
+			u = &nomadapi.UpdateStrategy{}
+		}
+		d.compare(name, "update.maxParallel", intString(want.Update.MaxParallel), intString(u.MaxParallel))
+		d.compare(name, "update.minHealthyTime", durationString(want.Update.MinHealthyTime), durationString(u.MinHealthyTime))
+		d.compare(name, "update.healthyDeadline", durationString(want.Update.HealthyDeadline), durationString(u.HealthyDeadline))
+		d.compare(name, "update.progressDeadline", durationString(want.Update.ProgressDeadline), durationString(u.ProgressDeadline))
+		d.compare(name, "update.stagger", durationString(want.Update.Stagger), durationString(u.Stagger))
+		d.compare(name, "update.healthCheck", derefString(want.Update.HealthCheck), derefString(u.HealthCheck))
+		d.compare(name, "update.autoRevert", boolString(want.Update.AutoRevert), boolString(u.AutoRevert))
+		d.compare(name, "update.canary", intString(want.Update.Canary), intString(u.Canary))
+	}
+	if want.RestartPolicy != nil {
+		rp := have.RestartPolicy
+		if rp == nil {
+			rp = &nomadapi.RestartPolicy{}
+		}
+		d.compare(name, "restart.attempts", intString(want.RestartPolicy.Attempts), intString(rp.Attempts))
+		d.compare(name, "restart.interval", durationString(want.RestartPolicy.Interval), durationString(rp.Interval))
+		d.compare(name, "restart.delay", durationString(want.RestartPolicy.Delay), durationString(rp.Delay))
+		d.compare(name, "restart.mode", derefString(want.RestartPolicy.Mode), derefString(rp.Mode))
+	}
+	d.compare(name, "ports", portsString(want.Networks), portsString(have.Networks))
+	d.compare(name, "services", servicesString(want.Services), servicesString(have.Services))
+	d.compare(name, "volumes", volumesString(want.Volumes), volumesString(have.Volumes))
+
+	liveTasks := map[string]*nomadapi.Task{}
+	for _, t := range have.Tasks {
+		liveTasks[t.Name] = t
+	}
+	appImage := ""
+	for _, t := range want.Tasks {
+		if t.Name == name {
+			appImage = configString(t.Config, "image")
+		}
+	}
+	for _, task := range want.Tasks {
+		current, ok := liveTasks[task.Name]
+		if !ok {
+			d.add(model.DriftChange{Group: name, Field: "task." + task.Name, Change: "added"})
+			continue
+		}
+		delete(liveTasks, task.Name)
+		d.task(name, task, current, appImage)
+	}
+	for _, task := range have.Tasks {
+		// Nomad injects the Connect sidecar proxy of meshed services.
+		if strings.HasPrefix(task.Kind, "connect-proxy:") {
+			continue
+		}
+		if _, ok := liveTasks[task.Name]; ok {
+			d.add(model.DriftChange{Group: name, Field: "task." + task.Name, Change: "removed"})
+		}
+	}
+}
+
+// task compares one task. Fields of a process's extra tasks are prefixed
+// task.<name>. so they do not collide with the process's own task; only
+// tasks on the app image report an app image change.
+func (d *jobDiff) task(group string, want, have *nomadapi.Task, appImage string) {
+	prefix := ""
+	if want.Name != group {
+		prefix = "task." + want.Name + "."
+	}
+	desiredImage, liveImage := configString(want.Config, "image"), configString(have.Config, "image")
+	if desiredImage != liveImage {
+		d.add(model.DriftChange{Group: group, Field: prefix + "image", Change: "changed", Desired: desiredImage, Live: liveImage, Image: desiredImage == appImage})
+	}
+	d.compare(group, prefix+"command", configString(want.Config, "args"), configString(have.Config, "args"))
+	if want.Resources != nil {
+		r := have.Resources
+		if r == nil {
+			r = &nomadapi.Resources{}
+		}
+		d.compare(group, prefix+"resources.cpu", intString(want.Resources.CPU), intString(r.CPU))
+		d.compare(group, prefix+"resources.memory", intString(want.Resources.MemoryMB), intString(r.MemoryMB))
+	}
+	d.compare(group, prefix+"killSignal", want.KillSignal, have.KillSignal)
+	if want.KillTimeout != nil {
+		d.compare(group, prefix+"killTimeout", durationString(want.KillTimeout), durationString(have.KillTimeout))
+	}
+	for _, key := range unionKeys(want.Env, have.Env) {
+		desired, inSpec := want.Env[key]
+		live, running := have.Env[key]
+		switch {
+		case !running:
+			d.add(model.DriftChange{Group: group, Field: prefix + "env." + key, Change: "added"})
+		case !inSpec:
+			d.add(model.DriftChange{Group: group, Field: prefix + "env." + key, Change: "removed"})
+		case desired != live:
+			d.add(model.DriftChange{Group: group, Field: prefix + "env." + key, Change: "changed"})
+		}
+	}
+}
+
+func unionKeys(a, b map[string]string) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range []map[string]string{a, b} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func intString(n *int) string {
+	if n == nil {
+		return "0"
+	}
+	return fmt.Sprintf("%d", *n)
+}
+
+func boolString(b *bool) string {
+	return fmt.Sprintf("%t", b != nil && *b)
+}
+
+func durationString(d *time.Duration) string {
+	if d == nil {
+		return "0s"
+	}
+	return d.String()
+}
+
+// configString renders a task config value; args lists are joined so the
+// command reads the way it was written in the infraspec.
+func configString(config map[string]interface{}, key string) string {
+	switch v := config[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, " ")
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, p := range v {
+			parts[i] = fmt.Sprint(p)
+		}
+		return strings.Join(parts, " ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func portsString(networks []*nomadapi.NetworkResource) string {
+	var ports []string
+	for _, n := range networks {
+		if n.Mode != "" && n.Mode != "host" {
+			ports = append(ports, "mode="+n.Mode)
+		}
+		for _, p := range n.ReservedPorts {
+			ports = append(ports, fmt.Sprintf("%s=%d", p.Label, p.Value))
+		}
+		for _, p := range n.DynamicPorts {
+			if strings.HasPrefix(p.Label, "connect-proxy-") {
+				continue
+			}
+			ports = append(ports, fmt.Sprintf("%s->%d", p.Label, p.To))
+		}
+	}
+	sort.Strings(ports)
+	return strings.Join(ports, ", ")
+}
+
+func servicesString(services []*nomadapi.Service) string {
+	var out []string
+	for _, s := range services {
+		desc := s.Name + ":" + s.PortLabel
+		for _, c := range s.Checks {
+			desc += fmt.Sprintf(" %s %s every %s", c.Type, c.Path, c.Interval)
+		}
+		if len(s.Tags) > 0 {
+			desc += " [" + strings.Join(s.Tags, ",") + "]"
+		}
+		if s.Connect != nil && s.Connect.SidecarService != nil {
+			desc += " mesh"
+			if proxy := s.Connect.SidecarService.Proxy; proxy != nil {
+				for _, up := range proxy.Upstreams {
+					desc += fmt.Sprintf(" %s@%d", up.DestinationName, up.LocalBindPort)
+				}
+			}
+		}
+		out = append(out, desc)
+	}
+	sort.Strings(out)
+	return strings.Join(out, "; ")
+}
+
+func volumesString(volumes map[string]*nomadapi.VolumeRequest) string {
+	var out []string
+	for name, v := range volumes {
+		desc := name + ":" + v.Type + ":" + v.Source
+		if v.AccessMode != "" {
+			desc += ":" + v.AccessMode
+		}
+		if v.ReadOnly {
+			desc += ":ro"
+		}
+		out = append(out, desc)
+	}
+	sort.Strings(out)
+	return strings.Join(out, ", ")
+}
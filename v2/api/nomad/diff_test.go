@@ -0,0 +1,107 @@
+package nomad
+
+import (
+	"testing"
+
+	"norn/v2/api/model"
+)
+
+func driftSpec() *model.InfraSpec {
+	return &model.InfraSpec{
+		App: "shop",
+		Env: map[string]string{"LOG_LEVEL": "info"},
+		Processes: map[string]model.Process{
+			"web": {
+				Port:      8080,
+				Health:    &model.HealthSpec{Path: "/health"},
+				Resources: &model.Resources{CPU: 200, Memory: 256},
+			},
+		},
+	}
+}
+
+func TestDiffJobsIgnoresRedeployOfSameSpec(t *testing.T) {
+	live := Translate(driftSpec(), "shop:abc", map[string]string{"DATABASE_URL": "postgres://x"})
+	desired := Translate(driftSpec(), "shop:abc", map[string]string{"DATABASE_URL": "postgres://x"})
+	if changes := DiffJobs(desired, live); len(changes) != 0 {
+		t.Fatalf("unexpected drift: %+v", changes)
+	}
+}
+
+func TestDiffJobsReportsDrift(t *testing.T) {
+	live := Translate(driftSpec(), "shop:abc", map[string]string{"DATABASE_URL": "postgres://old"})
+
+	spec := driftSpec()
+	web := spec.Processes["web"]
+	web.Resources = &model.Resources{CPU: 500, Memory: 256}
+	web.Scaling = &model.Scaling{Min: 2}
+	spec.Processes["web"] = web
+	spec.Processes["worker"] = model.Process{Command: "./worker"}
+	spec.Env["FEATURE_X"] = "on"
+	desired := Translate(spec, "shop:def", map[string]string{"DATABASE_URL": "postgres://new"})
+
+	got := map[string]model.DriftChange{}
+	for _, c := range DiffJobs(desired, live) {
+		got[c.Group+"/"+c.Field] = c
+	}
+	if c := got["web/resources.cpu"]; c.Desired != "500" || c.Live != "200" || c.Change != "changed" {
+		t.Fatalf("cpu change = %+v", c)
+	}
+	if c := got["web/count"]; c.Desired != "2" || c.Live != "1" {
+		t.Fatalf("count change = %+v", c)
+	}
+	if c := got["web/image"]; !c.Image {
+		t.Fatalf("image change = %+v", c)
+	}
+	if c := got["worker/group"]; c.Change != "added" {
+		t.Fatalf("worker group = %+v", c)
+	}
+	if c := got["web/env.FEATURE_X"]; c.Change != "added" {
+		t.Fatalf("env added = %+v", c)
+	}
+	if c := got["web/env.DATABASE_URL"]; c.Change != "changed" || c.Desired != "" || c.Live != "" {
+		t.Fatalf("env values must not be reported: %+v", c)
+	}
+	if len(got) != 6 {
+		t.Fatalf("changes = %+v", got)
+	}
+}
+
+func TestDiffJobsPrefixesProcessTasks(t *testing.T) {
+	spec := driftSpec()
+	web := spec.Processes["web"]
+	web.Tasks = []model.ProcessTask{
+		{Name: "shipper", Lifecycle: model.TaskSidecar, Image: "vector:0.39"},
+		{Name: "migrate", Lifecycle: model.TaskInit, Command: "./migrate"},
+		{Name: "old", Lifecycle: model.TaskPoststop, Image: "busybox"},
+	}
+	spec.Processes["web"] = web
+	live := Translate(spec, "shop:abc", nil)
+
+	web.Tasks = []model.ProcessTask{
+		{Name: "shipper", Lifecycle: model.TaskSidecar, Image: "vector:0.40", Resources: &model.Resources{Memory: 64}},
+		{Name: "migrate", Lifecycle: model.TaskInit, Command: "./migrate"},
+	}
+	spec.Processes["web"] = web
+	desired := Translate(spec, "shop:def", nil)
+
+	got := map[string]model.DriftChange{}
+	for _, c := range DiffJobs(desired, live) {
+		got[c.Group+"/"+c.Field] = c
+	}
+	if c := got["web/task.shipper.image"]; c.Image || c.Desired != "vector:0.40" {
+		t.Fatalf("sidecar image change = %+v", c)
+	}
+	if c := got["web/task.shipper.resources.memory"]; c.Desired != "64" || c.Live != "128" {
+		t.Fatalf("sidecar memory change = %+v", c)
+	}
+	if c := got["web/task.migrate.image"]; !c.Image {
+		t.Fatalf("app-image task should follow the app image: %+v", c)
+	}
+	if c := got["web/task.old"]; c.Change != "removed" {
+		t.Fatalf("removed task = %+v", c)
+	}
+	if len(got) != 5 {
+		t.Fatalf("changes = %+v", got)
+	}
+}
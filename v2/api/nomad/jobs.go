@@ -3,9 +3,13 @@ package nomad
 import (
 	"context"
 	"fmt"
+	"net"
+	"strconv"
 	"time"
 
 	nomadapi "github.com/hashicorp/nomad/api"
+
+	"norn/v2/api/model"
 )
 
 // SubmitJob registers a job with Nomad.
@@ -145,10 +149,31 @@ func short(s string, n int) string {
 
 // NodeInfo describes where a Nomad node is running.
 type NodeInfo struct {
-	Name     string `json:"name"`
-	Address  string `json:"address"`
-	Provider string `json:"provider"` // local, do, hz, remote
-	Region   string `json:"region"`   // sfo3, fsn1, etc.
+	Name       string `json:"name"`
+	Address    string `json:"address"`
+	Provider   string `json:"provider"` // local, do, hz, remote
+	Region     string `json:"region"`   // sfo3, fsn1, etc.
+	Datacenter string `json:"datacenter,omitempty"`
+	NodeClass  string `json:"nodeClass,omitempty"`
+	NodePool   string `json:"nodePool,omitempty"`
+	Eligible   bool   `json:"eligible"`
+
+	// Attributes and Meta feed placement checks.
+	Attributes map[string]string `json:"-"`
+	Meta       map[string]string `json:"-"`
+}
+
+// PlacementNode returns the node as placement validation sees it.
+func (n *NodeInfo) PlacementNode() model.PlacementNode {
+	return model.PlacementNode{
+		Name:       n.Name,
+		Datacenter: n.Datacenter,
+		Class:      n.NodeClass,
+		Pool:       n.NodePool,
+		Eligible:   n.Eligible,
+		Attributes: n.Attributes,
+		Meta:       n.Meta,
+	}
 }
 
 // NodeInfo returns location information for a Nomad node.
@@ -164,8 +189,14 @@ func (c *Client) NodeInfo(nodeID string) (*NodeInfo, error) {
 	}
 
 	info := &NodeInfo{
-		Name:    node.Name,
-		Address: addr,
+		Name:       node.Name,
+		Address:    addr,
+		Datacenter: node.Datacenter,
+		NodeClass:  node.NodeClass,
+		NodePool:   node.NodePool,
+		Eligible:   node.Status == "ready" && node.SchedulingEligibility == "eligible" && !node.Drain,
+		Attributes: node.Attributes,
+		Meta:       node.Meta,
 	}
 
 	// Detect provider from node attributes
@@ -184,6 +215,24 @@ func (c *Client) NodeInfo(nodeID string) (*NodeInfo, error) {
 	return info, nil
 }
 
+// NodeInventory returns every client node with the attributes and meta
+// placement constraints are evaluated against.
+func (c *Client) NodeInventory() ([]*NodeInfo, error) {
+	stubs, _, err := c.api.Nodes().List(nil)
+	if err != nil {
+		return nil, fmt.Errorf("list nodes: %w", err)
+	}
+	nodes := make([]*NodeInfo, 0, len(stubs))
+	for _, stub := range stubs {
+		info, err := c.NodeInfo(stub.ID)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", stub.Name, err)
+		}
+		nodes = append(nodes, info)
+	}
+	return nodes, nil
+}
+
 // ScaleJob updates the count for a specific task group.
 func (c *Client) ScaleJob(jobID, group string, count int) error {
 	_, _, err := c.api.Jobs().Scale(jobID, group, &count, "scaled via norn", false, nil, nil)
@@ -554,6 +603,39 @@ type ResourceUsage struct {
 	MemoryUsageBytes uint64  `json:"memoryUsageBytes"`
 	MemoryMaxBytes   uint64  `json:"memoryMaxBytes"`
 	CPUPercent       float64 `json:"cpuPercent"`
+	// Tasks breaks the allocation totals down by task.
+	Tasks map[string]TaskUsage `json:"tasks,omitempty"`
+}
+
+// TaskUsage is the live resource consumption of one task.
+type TaskUsage struct {
+	MemoryUsageBytes uint64  `json:"memoryUsageBytes"`
+	MemoryMaxBytes   uint64  `json:"memoryMaxBytes"`
+	CPUPercent       float64 `json:"cpuPercent"`
+}
+
+// MainTask returns u narrowed to the process's own task, which is named
+// after its task group, so sidecars do not count against the process.
+// Without a per-task breakdown u is returned as is.
+func (u ResourceUsage) MainTask() ResourceUsage {
+	t, ok := u.Tasks[u.TaskGroup]
+	if !ok {
+		return u
+	}
+	u.MemoryUsageBytes, u.MemoryMaxBytes, u.CPUPercent = t.MemoryUsageBytes, t.MemoryMaxBytes, t.CPUPercent
+	return u
+}
+
+func taskUsage(ru *nomadapi.ResourceUsage) TaskUsage {
+	var t TaskUsage
+	if ru != nil && ru.MemoryStats != nil {
+		t.MemoryUsageBytes = ru.MemoryStats.RSS
+		t.MemoryMaxBytes = ru.MemoryStats.MaxUsage
+	}
+	if ru != nil && ru.CpuStats != nil {
+		t.CPUPercent = ru.CpuStats.Percent
+	}
+	return t
 }
 
 // AllocResourceUsage returns live resource stats for a specific allocation.
@@ -568,16 +650,22 @@ func (c *Client) AllocResourceUsage(allocID string) (*ResourceUsage, error) {
 		return nil, fmt.Errorf("alloc stats: %w", err)
 	}
 
+	total := taskUsage(stats.ResourceUsage)
 	usage := &ResourceUsage{
-		AllocID:   short(allocID, 8),
-		TaskGroup: alloc.TaskGroup,
-	}
-	if stats.ResourceUsage != nil && stats.ResourceUsage.MemoryStats != nil {
-		usage.MemoryUsageBytes = stats.ResourceUsage.MemoryStats.RSS
-		usage.MemoryMaxBytes = stats.ResourceUsage.MemoryStats.MaxUsage
-	}
-	if stats.ResourceUsage != nil && stats.ResourceUsage.CpuStats != nil {
-		usage.CPUPercent = stats.ResourceUsage.CpuStats.Percent
+		AllocID:          short(allocID, 8),
+		TaskGroup:        alloc.TaskGroup,
+		MemoryUsageBytes: total.MemoryUsageBytes,
+		MemoryMaxBytes:   total.MemoryMaxBytes,
+		CPUPercent:       total.CPUPercent,
+	}
+	for name, t := range stats.Tasks {
+		if t == nil {
+			continue
+		}
+		if usage.Tasks == nil {
+			usage.Tasks = map[string]TaskUsage{}
+		}
+		usage.Tasks[name] = taskUsage(t.ResourceUsage)
 	}
 	return usage, nil
 }
@@ -603,6 +691,52 @@ func (c *Client) JobResourceUsage(jobID string) ([]ResourceUsage, error) {
 	return out, nil
 }
 
+// DeploymentAllocation is a running allocation tagged as canary or stable,
+// with its task restart count and host port mappings.
+type DeploymentAllocation struct {
+	ID        string            `json:"id"` // first 8 chars
+	TaskGroup string            `json:"taskGroup"`
+	Canary    bool              `json:"canary"`
+	Healthy   *bool             `json:"healthy"`
+	Restarts  uint64            `json:"restarts"`
+	Ports     map[string]string `json:"ports,omitempty"` // label → host:port
+}
+
+// DeploymentAllocations returns the running allocations of a job split by
+// canary status, for comparing canary and stable cohorts during a rollout.
+func (c *Client) DeploymentAllocations(jobID string) ([]DeploymentAllocation, error) {
+	allocs, err := c.JobAllocations(jobID)
+	if err != nil {
+		return nil, err
+	}
+	var out []DeploymentAllocation
+	for _, a := range allocs {
+		if a.ClientStatus != "running" {
+			continue
+		}
+		da := DeploymentAllocation{
+			ID:        short(a.ID, 8),
+			TaskGroup: a.TaskGroup,
+		}
+		if a.DeploymentStatus != nil {
+			da.Canary = a.DeploymentStatus.Canary
+			da.Healthy = a.DeploymentStatus.Healthy
+		}
+		for _, ts := range a.TaskStates {
+			da.Restarts += ts.Restarts
+		}
+		full, _, err := c.api.Allocations().Info(a.ID, nil)
+		if err == nil && full.AllocatedResources != nil {
+			da.Ports = make(map[string]string, len(full.AllocatedResources.Shared.Ports))
+			for _, pm := range full.AllocatedResources.Shared.Ports {
+				da.Ports[pm.Label] = net.JoinHostPort(pm.HostIP, strconv.Itoa(pm.Value))
+			}
+		}
+		out = append(out, da)
+	}
+	return out, nil
+}
+
 // DeploymentInfo describes a Nomad deployment's state.
 type DeploymentInfo struct {
 	ID         string `json:"id"`
@@ -3,46 +3,70 @@ package nomad
 import (
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 
 	nomadapi "github.com/hashicorp/nomad/api"
 )
 
 // StreamLogs streams stdout and stderr from the latest allocation of a job.
-func (c *Client) StreamLogs(jobID string, follow bool) (io.ReadCloser, error) {
+// process limits it to one task group; task picks a task other than the
+// process's own, such as a sidecar.
+func (c *Client) StreamLogs(jobID, process, task string, follow bool) (io.ReadCloser, error) {
 	allocs, err := c.JobAllocations(jobID)
 	if err != nil {
 		return nil, err
 	}
-	if len(allocs) == 0 {
-		return nil, fmt.Errorf("no allocations for job %s", jobID)
-	}
-
-	// Find the most recent running allocation
-	var target *nomadapi.AllocationListStub
+	var candidates []*nomadapi.AllocationListStub
 	for _, a := range allocs {
-		if a.ClientStatus == "running" {
-			target = a
-			break
+		if process == "" || a.TaskGroup == process {
+			candidates = append(candidates, a)
 		}
 	}
-	if target == nil {
-		target = allocs[0]
+	if len(candidates) == 0 {
+		if process != "" {
+			return nil, fmt.Errorf("no allocations for job %s process %s", jobID, process)
+		}
+		return nil, fmt.Errorf("no allocations for job %s", jobID)
 	}
 
-	alloc, _, err := c.api.Allocations().Info(target.ID, nil)
-	if err != nil {
-		return nil, fmt.Errorf("get allocation: %w", err)
-	}
+	// Prefer running allocations
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].ClientStatus == "running" && candidates[j].ClientStatus != "running"
+	})
 
+	var alloc *nomadapi.Allocation
 	var taskName string
-	for _, tg := range alloc.Job.TaskGroups {
-		if len(tg.Tasks) > 0 {
-			taskName = tg.Tasks[0].Name
+	var seen []string
+	for _, stub := range candidates {
+		full, _, err := c.api.Allocations().Info(stub.ID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("get allocation: %w", err)
+		}
+		tasks := allocTasks(full)
+		if len(tasks) == 0 {
+			continue
+		}
+		if task == "" {
+			alloc, taskName = full, tasks[0]
+			break
+		}
+		for _, name := range tasks {
+			if name == task {
+				alloc, taskName = full, name
+				break
+			}
+		}
+		if alloc != nil {
 			break
 		}
+		seen = appendUnique(seen, tasks...)
 	}
-	if taskName == "" {
-		return nil, fmt.Errorf("no tasks found in allocation %s", target.ID)
+	if alloc == nil {
+		if task != "" {
+			return nil, fmt.Errorf("task %s not found in job %s; tasks: %s", task, jobID, strings.Join(seen, ", "))
+		}
+		return nil, fmt.Errorf("no tasks found in allocations of job %s", jobID)
 	}
 
 	cancel := make(chan struct{})
@@ -91,3 +115,37 @@ func (c *Client) StreamLogs(jobID string, follow bool) (io.ReadCloser, error) {
 
 	return r, nil
 }
+
+// allocTasks returns the task names of an allocation's task group, the
+// process's own task first.
+func allocTasks(alloc *nomadapi.Allocation) []string {
+	if alloc.Job == nil {
+		return nil
+	}
+	var names []string
+	for _, tg := range alloc.Job.TaskGroups {
+		if tg == nil || tg.Name == nil || *tg.Name != alloc.TaskGroup {
+			continue
+		}
+		for _, t := range tg.Tasks {
+			names = append(names, t.Name)
+		}
+	}
+	return names
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, have := range list {
+			if have == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,38 @@
+package nomad
+
+import (
+	nomadapi "github.com/hashicorp/nomad/api"
+
+	"norn/v2/api/model"
+)
+
+// configureMesh puts the process's group in a bridge network and gives its
+// service a Consul Connect sidecar with the declared upstreams. Nomad binds
+// each upstream on 127.0.0.1:<localPort> and exports its address to the
+// tasks as NOMAD_UPSTREAM_ADDR_<service>.
+func configureMesh(proc model.Process, net *nomadapi.NetworkResource, svc *nomadapi.Service) {
+	net.Mode = "bridge"
+	// A bridge network maps host ports to To; reserved ports keep the
+	// process's port on both sides.
+	for i := range net.ReservedPorts {
+		if net.ReservedPorts[i].To == 0 {
+			net.ReservedPorts[i].To = net.ReservedPorts[i].Value
+		}
+	}
+
+	proxy := &nomadapi.ConsulProxy{}
+	for _, up := range proc.Mesh.Upstreams {
+		proxy.Upstreams = append(proxy.Upstreams, &nomadapi.ConsulUpstream{
+			DestinationName: up.Service,
+			LocalBindPort:   up.LocalPort,
+		})
+	}
+	svc.Connect = &nomadapi.ConsulConnect{
+		SidecarService: &nomadapi.ConsulSidecarService{Proxy: proxy},
+	}
+	// Canary steps route a share of the mesh traffic to the instances
+	// carrying this tag.
+	if proc.Canary != nil && proc.Canary.Count > 0 {
+		svc.CanaryTags = []string{model.CanaryTag}
+	}
+}
@@ -0,0 +1,97 @@
+package nomad
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+
+	"norn/v2/api/model"
+)
+
+// jobDatacenters is every datacenter a service process of spec may run in.
+// Processes limited to fewer datacenters get a node.datacenter constraint
+// from configurePlacement.
+func jobDatacenters(spec *model.InfraSpec) []string {
+	seen := map[string]bool{}
+	for _, proc := range spec.Processes {
+		if proc.Schedule != "" {
+			continue
+		}
+		for _, dc := range model.ProcessDatacenters(proc) {
+			seen[dc] = true
+		}
+	}
+	if len(seen) == 0 {
+		return []string{model.DefaultDatacenter}
+	}
+	datacenters := make([]string, 0, len(seen))
+	for dc := range seen {
+		datacenters = append(datacenters, dc)
+	}
+	sort.Strings(datacenters)
+	return datacenters
+}
+
+// configurePlacement adds the process's constraints, affinities and spread
+// to its task group. jobDCs are the job's datacenters.
+func configurePlacement(tg *nomadapi.TaskGroup, proc model.Process, jobDCs []string) {
+	if dcs := model.ProcessDatacenters(proc); !sameSet(dcs, jobDCs) {
+		quoted := make([]string, len(dcs))
+		for i, dc := range dcs {
+			quoted[i] = regexp.QuoteMeta(dc)
+		}
+		tg.Constrain(nomadapi.NewConstraint("${node.datacenter}", "regexp", "^("+strings.Join(quoted, "|")+")$"))
+	}
+	p := proc.Placement
+	if p == nil {
+		return
+	}
+	for _, c := range p.Constraints {
+		op := model.PlacementOperator(c.Operator)
+		if op == model.OpDistinctHosts {
+			value := c.Value
+			if value == "" {
+				value = "true"
+			}
+			tg.Constrain(nomadapi.NewConstraint("", op, value))
+			continue
+		}
+		tg.Constrain(nomadapi.NewConstraint(model.PlacementTarget(c.Attribute), op, c.Value))
+	}
+	for _, a := range p.Affinities {
+		weight := a.Weight
+		if weight == 0 {
+			weight = 50
+		}
+		tg.AddAffinity(nomadapi.NewAffinity(model.PlacementTarget(a.Attribute), model.PlacementOperator(a.Operator), a.Value, int8(weight)))
+	}
+	for _, s := range p.Spread {
+		weight := s.Weight
+		if weight == 0 {
+			weight = 50
+		}
+		var targets []*nomadapi.SpreadTarget
+		for _, t := range s.Targets {
+			targets = append(targets, nomadapi.NewSpreadTarget(t.Value, uint8(t.Percent)))
+		}
+		tg.AddSpread(nomadapi.NewSpread(model.PlacementTarget(s.Attribute), int8(weight), targets))
+	}
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := map[string]bool{}
+	for _, v := range a {
+		set[v] = true
+	}
+	for _, v := range b {
+		if !set[v] {
+			return false
+		}
+	}
+	return true
+}
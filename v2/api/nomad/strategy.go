@@ -0,0 +1,32 @@
+package nomad
+
+import (
+	nomadapi "github.com/hashicorp/nomad/api"
+
+	"norn/v2/api/model"
+)
+
+// configureRestart sets tg's restart policy.
+func configureRestart(tg *nomadapi.TaskGroup, policy model.RestartPolicy) {
+	tg.RestartPolicy = &nomadapi.RestartPolicy{
+		Attempts: &policy.Attempts,
+		Interval: &policy.Interval,
+		Delay:    &policy.Delay,
+		Mode:     &policy.Mode,
+	}
+}
+
+// configureUpdate sets tg's update strategy from the process's update
+// block. Nomad reverts failed rollouts itself unless Norn runs a canary.
+func configureUpdate(tg *nomadapi.TaskGroup, proc model.Process) {
+	policy := model.ProcessUpdate(proc)
+	tg.Update = &nomadapi.UpdateStrategy{
+		MaxParallel:      &policy.MaxParallel,
+		MinHealthyTime:   &policy.MinHealthyTime,
+		HealthyDeadline:  &policy.HealthyDeadline,
+		ProgressDeadline: &policy.ProgressDeadline,
+		Stagger:          &policy.Stagger,
+		HealthCheck:      &policy.HealthCheck,
+		AutoRevert:       boolPtr(true),
+	}
+}
@@ -0,0 +1,63 @@
+package nomad
+
+import (
+	nomadapi "github.com/hashicorp/nomad/api"
+
+	"norn/v2/api/model"
+)
+
+// taskLifecycles maps a process task's lifecycle onto Nomad's hook and
+// sidecar flag. Sidecars start before the process and stop after it.
+var taskLifecycles = map[string]nomadapi.TaskLifecycle{
+	model.TaskInit:      {Hook: nomadapi.TaskLifecycleHookPrestart},
+	model.TaskSidecar:   {Hook: nomadapi.TaskLifecycleHookPrestart, Sidecar: true},
+	model.TaskPoststart: {Hook: nomadapi.TaskLifecycleHookPoststart},
+	model.TaskPoststop:  {Hook: nomadapi.TaskLifecycleHookPoststop},
+}
+
+// processTasks builds the process's extra tasks to run next to main in its
+// task group. They mount main's volumes and see the group's ports through
+// NOMAD_ADDR_* like main does. Tasks on the app image inherit main's env
+// and secrets template; tasks on their own image get only their own env.
+func processTasks(spec *model.InfraSpec, proc model.Process, imageTag string, main *nomadapi.Task) []*nomadapi.Task {
+	var tasks []*nomadapi.Task
+	for _, t := range proc.Tasks {
+		task := nomadapi.NewTask(t.Name, "docker")
+		task.Config = map[string]interface{}{
+			"image": imageTag,
+		}
+		if !t.UsesAppImage() {
+			task.Config["image"] = t.Image
+		}
+		if t.Command != "" {
+			task.Config["command"] = "/bin/sh"
+			task.Config["args"] = []string{"-c", t.Command}
+		}
+		if lifecycle, ok := taskLifecycles[t.Lifecycle]; ok {
+			task.Lifecycle = &lifecycle
+		}
+
+		task.Env = map[string]string{}
+		if t.UsesAppImage() {
+			for k, v := range main.Env {
+				task.Env[k] = v
+			}
+			configureSecrets(spec, task)
+		}
+		for k, v := range t.Env {
+			task.Env[k] = v
+		}
+
+		cpu, mem := model.TaskResources(t.Resources)
+		task.Resources = &nomadapi.Resources{
+			CPU:      &cpu,
+			MemoryMB: &mem,
+		}
+		for _, m := range main.VolumeMounts {
+			mount := *m
+			task.VolumeMounts = append(task.VolumeMounts, &mount)
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
@@ -13,14 +13,20 @@ import (
 // Each process in the infraspec becomes a TaskGroup within the job.
 // Scheduled processes (cron) are translated into separate periodic batch jobs.
 func Translate(spec *model.InfraSpec, imageTag string, env map[string]string) *nomadapi.Job {
-	jobID := spec.App
+	jobID := spec.JobID()
 	jobType := "service"
 
 	job := nomadapi.NewServiceJob(jobID, jobID, "global", 50)
-	job.Datacenters = []string{"dc1"}
+	job.Datacenters = jobDatacenters(spec)
 	job.Meta = map[string]string{
 		"deploy_ts": fmt.Sprintf("%d", time.Now().UnixMilli()),
 	}
+	if spec.Environment != "" {
+		job.Meta["norn_environment"] = spec.Environment
+	}
+	if spec.Preview != nil {
+		job.Meta["norn_preview"] = fmt.Sprintf("%d", spec.Preview.Number)
+	}
 
 	// Merge spec.Env with provided env (secrets, etc.)
 	mergedEnv := make(map[string]string)
@@ -38,6 +44,7 @@ func Translate(spec *model.InfraSpec, imageTag string, env map[string]string) *n
 		}
 
 		tg := nomadapi.NewTaskGroup(procName, 1)
+		configurePlacement(tg, proc, job.Datacenters)
 
 		// Scaling
 		if proc.Scaling != nil && proc.Scaling.Min > 0 {
@@ -45,34 +52,14 @@ func Translate(spec *model.InfraSpec, imageTag string, env map[string]string) *n
 			tg.Count = &count
 		}
 
-		// Restart policy
-		attempts := 3
-		interval := 5 * time.Minute
-		delay := 15 * time.Second
-		mode := "delay"
-		tg.RestartPolicy = &nomadapi.RestartPolicy{
-			Attempts: &attempts,
-			Interval: &interval,
-			Delay:    &delay,
-			Mode:     &mode,
-		}
-
-		// Update strategy
-		maxParallel := 1
-		healthy := 30 * time.Second
-		autoRevert := true
-		tg.Update = &nomadapi.UpdateStrategy{
-			MaxParallel:    &maxParallel,
-			MinHealthyTime: &healthy,
-			AutoRevert:     &autoRevert,
-		}
+		configureRestart(tg, model.ProcessRestart(proc))
+		configureUpdate(tg, proc)
 
 		// Canary deployment: Norn manages promotion/failure instead of Nomad auto-revert
 		if proc.Canary != nil && proc.Canary.Count > 0 {
 			canaryCount := proc.Canary.Count
 			tg.Update.Canary = &canaryCount
-			autoRevert = false
-			tg.Update.AutoRevert = &autoRevert
+			tg.Update.AutoRevert = boolPtr(false)
 		}
 
 		// Task
@@ -89,6 +76,7 @@ func Translate(spec *model.InfraSpec, imageTag string, env map[string]string) *n
 
 		// Environment
 		task.Env = mergedEnv
+		configureSecrets(spec, task)
 
 		// Resources
 		cpu := 100
@@ -119,24 +107,9 @@ func Translate(spec *model.InfraSpec, imageTag string, env map[string]string) *n
 			}
 		}
 
-		// Volume mounts
-		for _, vol := range spec.Volumes {
-			tg.Volumes = map[string]*nomadapi.VolumeRequest{
-				vol.Name: {
-					Name:     vol.Name,
-					Type:     "host",
-					Source:   vol.Name,
-					ReadOnly: vol.ReadOnly,
-				},
-			}
-			task.VolumeMounts = append(task.VolumeMounts, &nomadapi.VolumeMount{
-				Volume:      &vol.Name,
-				Destination: &vol.Mount,
-				ReadOnly:    &vol.ReadOnly,
-			})
-		}
+		configureVolumes(spec, tg, task)
 
-		tg.Tasks = []*nomadapi.Task{task}
+		tg.Tasks = append([]*nomadapi.Task{task}, processTasks(spec, proc, imageTag, task)...)
 		job.TaskGroups = append(job.TaskGroups, tg)
 	}
 
@@ -156,13 +129,15 @@ func configureProcessNetworking(spec *model.InfraSpec, procName string, proc mod
 	if proc.Port > 0 {
 		portLabel := fmt.Sprintf("%s-http", procName)
 		ports = append(ports, portLabel)
-		if len(spec.Endpoints) > 0 {
+		// Other environments and previews share hosts with the app, so only
+		// its default environment reserves the static port.
+		if len(spec.Endpoints) > 0 && spec.ReservesPorts() {
 			net.ReservedPorts = append(net.ReservedPorts, nomadapi.Port{Label: portLabel, Value: proc.Port})
 		} else {
 			net.DynamicPorts = append(net.DynamicPorts, nomadapi.Port{Label: portLabel, To: proc.Port})
 		}
 		svc := &nomadapi.Service{
-			Name:      fmt.Sprintf("%s-%s", spec.App, procName),
+			Name:      fmt.Sprintf("%s-%s", spec.JobID(), procName),
 			PortLabel: portLabel,
 			Provider:  "consul",
 		}
@@ -184,6 +159,9 @@ func configureProcessNetworking(spec *model.InfraSpec, procName string, proc mod
 				},
 			}
 		}
+		if proc.Mesh != nil {
+			configureMesh(proc, net, svc)
+		}
 		services = append(services, svc)
 	}
 
@@ -196,16 +174,14 @@ func configureProcessNetworking(spec *model.InfraSpec, procName string, proc mod
 		if metricsPath == "" {
 			metricsPath = "/metrics"
 		}
-		metricsLabel := fmt.Sprintf("%s-metrics", procName)
+		metricsLabel := MetricsPortLabel(procName, proc)
 		if metricsPort > 0 && metricsPort != proc.Port {
 			ports = append(ports, metricsLabel)
 			net.DynamicPorts = append(net.DynamicPorts, nomadapi.Port{Label: metricsLabel, To: metricsPort})
-		} else if proc.Port > 0 {
-			metricsLabel = fmt.Sprintf("%s-http", procName)
 		}
 		if metricsPort > 0 {
 			services = append(services, &nomadapi.Service{
-				Name:      fmt.Sprintf("%s-%s-metrics", spec.App, procName),
+				Name:      fmt.Sprintf("%s-%s-metrics", spec.JobID(), procName),
 				PortLabel: metricsLabel,
 				Provider:  "consul",
 				Tags:      []string{"metrics", "prometheus"},
@@ -222,7 +198,11 @@ func configureProcessNetworking(spec *model.InfraSpec, procName string, proc mod
 	}
 
 	if len(ports) > 0 {
-		task.Config["ports"] = ports
+		// In bridge mode the group's network namespace maps the ports, and
+		// the docker driver must not map them again.
+		if net.Mode != "bridge" {
+			task.Config["ports"] = ports
+		}
 		tg.Networks = []*nomadapi.NetworkResource{net}
 	}
 	if len(services) > 0 {
@@ -230,11 +210,21 @@ func configureProcessNetworking(spec *model.InfraSpec, procName string, proc mod
 	}
 }
 
+// MetricsPortLabel returns the network port label a process exposes its
+// metrics endpoint on: a dedicated port when metrics.port differs from the
+// process port, otherwise the process's HTTP port.
+func MetricsPortLabel(procName string, proc model.Process) string {
+	if proc.Metrics != nil && proc.Metrics.Port > 0 && proc.Metrics.Port != proc.Port {
+		return fmt.Sprintf("%s-metrics", procName)
+	}
+	return fmt.Sprintf("%s-http", procName)
+}
+
 // TranslatePeriodic creates a separate Nomad periodic batch job for a scheduled process.
 func TranslatePeriodic(spec *model.InfraSpec, procName string, proc model.Process, imageTag string, env map[string]string) *nomadapi.Job {
-	jobID := fmt.Sprintf("%s-%s", spec.App, procName)
+	jobID := fmt.Sprintf("%s-%s", spec.JobID(), procName)
 	job := nomadapi.NewBatchJob(jobID, jobID, "global", 50)
-	job.Datacenters = []string{"dc1"}
+	job.Datacenters = model.ProcessDatacenters(proc)
 	job.Periodic = &nomadapi.PeriodicConfig{
 		Enabled:  boolPtr(true),
 		SpecType: strPtr("cron"),
@@ -253,6 +243,8 @@ func TranslatePeriodic(spec *model.InfraSpec, procName string, proc model.Proces
 	}
 
 	tg := nomadapi.NewTaskGroup(procName, 1)
+	configurePlacement(tg, proc, job.Datacenters)
+	configureRestart(tg, model.ProcessRestart(proc))
 	task := nomadapi.NewTask(procName, "docker")
 	task.Config = map[string]interface{}{
 		"image": imageTag,
@@ -262,6 +254,7 @@ func TranslatePeriodic(spec *model.InfraSpec, procName string, proc model.Proces
 		task.Config["args"] = []string{"-c", proc.Command}
 	}
 	task.Env = mergedEnv
+	configureSecrets(spec, task)
 
 	cpu := 100
 	mem := 128
@@ -278,24 +271,9 @@ func TranslatePeriodic(spec *model.InfraSpec, procName string, proc model.Proces
 		MemoryMB: &mem,
 	}
 
-	// Volume mounts for periodic jobs
-	for _, vol := range spec.Volumes {
-		tg.Volumes = map[string]*nomadapi.VolumeRequest{
-			vol.Name: {
-				Name:     vol.Name,
-				Type:     "host",
-				Source:   vol.Name,
-				ReadOnly: vol.ReadOnly,
-			},
-		}
-		task.VolumeMounts = append(task.VolumeMounts, &nomadapi.VolumeMount{
-			Volume:      &vol.Name,
-			Destination: &vol.Mount,
-			ReadOnly:    &vol.ReadOnly,
-		})
-	}
+	configureVolumes(spec, tg, task)
 
-	tg.Tasks = []*nomadapi.Task{task}
+	tg.Tasks = append([]*nomadapi.Task{task}, processTasks(spec, proc, imageTag, task)...)
 	job.TaskGroups = []*nomadapi.TaskGroup{tg}
 
 	return job
@@ -304,7 +282,7 @@ func TranslatePeriodic(spec *model.InfraSpec, procName string, proc model.Proces
 // TranslateBatch creates a one-shot Nomad batch job for a function invocation.
 func TranslateBatch(spec *model.InfraSpec, procName string, proc model.Process, imageTag string, env map[string]string, jobID string) *nomadapi.Job {
 	job := nomadapi.NewBatchJob(jobID, jobID, "global", 50)
-	job.Datacenters = []string{"dc1"}
+	job.Datacenters = model.ProcessDatacenters(proc)
 
 	mergedEnv := make(map[string]string)
 	for k, v := range spec.Env {
@@ -315,18 +293,10 @@ func TranslateBatch(spec *model.InfraSpec, procName string, proc model.Process,
 	}
 
 	tg := nomadapi.NewTaskGroup(procName, 1)
+	configurePlacement(tg, proc, job.Datacenters)
 
-	// No retries for batch jobs
-	attempts := 0
-	interval := 1 * time.Minute
-	delay := 5 * time.Second
-	mode := "fail"
-	tg.RestartPolicy = &nomadapi.RestartPolicy{
-		Attempts: &attempts,
-		Interval: &interval,
-		Delay:    &delay,
-		Mode:     &mode,
-	}
+	// Invocations are not retried unless the process asks for it
+	configureRestart(tg, model.ResolveRestart(proc.Restart, model.DefaultFunctionRestart))
 
 	task := nomadapi.NewTask(procName, "docker")
 	task.Config = map[string]interface{}{
@@ -337,6 +307,7 @@ func TranslateBatch(spec *model.InfraSpec, procName string, proc model.Process,
 		task.Config["args"] = []string{"-c", proc.Command}
 	}
 	task.Env = mergedEnv
+	configureSecrets(spec, task)
 
 	cpu := 100
 	mem := 128
@@ -356,28 +327,41 @@ func TranslateBatch(spec *model.InfraSpec, procName string, proc model.Process,
 		MemoryMB: &mem,
 	}
 
-	// Volume mounts for batch jobs
-	for _, vol := range spec.Volumes {
-		tg.Volumes = map[string]*nomadapi.VolumeRequest{
-			vol.Name: {
-				Name:     vol.Name,
-				Type:     "host",
-				Source:   vol.Name,
-				ReadOnly: vol.ReadOnly,
-			},
-		}
-		task.VolumeMounts = append(task.VolumeMounts, &nomadapi.VolumeMount{
-			Volume:      &vol.Name,
-			Destination: &vol.Mount,
-			ReadOnly:    &vol.ReadOnly,
-		})
-	}
+	configureVolumes(spec, tg, task)
 
-	tg.Tasks = []*nomadapi.Task{task}
+	tg.Tasks = append([]*nomadapi.Task{task}, processTasks(spec, proc, imageTag, task)...)
 	job.TaskGroups = []*nomadapi.TaskGroup{tg}
 
 	return job
 }
 
+// secretsEnvFile is where a task's secrets template renders; Nomad loads
+// it into the task's env.
+const secretsEnvFile = "secrets/norn.env"
+
+// configureSecrets adds a template that reads the spec's secrets from Nomad
+// Variables or Vault KV v2 into the task's env when the task starts, so
+// their values never appear in the job spec. SOPS secrets arrive through
+// env instead.
+func configureSecrets(spec *model.InfraSpec, task *nomadapi.Task) {
+	var tmpl string
+	switch spec.SecretsBackendType() {
+	case model.SecretsBackendNomad:
+		tmpl = fmt.Sprintf("{{ range $k, $v := nomadVar %q }}{{ $k }}={{ printf \"%%q\" (print $v) }}\n{{ end }}", spec.SecretsPath())
+	case model.SecretsBackendVault:
+		path := spec.VaultMount() + "/data/" + spec.SecretsPath()
+		tmpl = fmt.Sprintf("{{ with secret %q }}{{ range $k, $v := .Data.data }}{{ $k }}={{ printf \"%%q\" (print $v) }}\n{{ end }}{{ end }}", path)
+		task.Vault = &nomadapi.Vault{Role: spec.SecretsBackend.Role}
+	default:
+		return
+	}
+	task.Templates = append(task.Templates, &nomadapi.Template{
+		EmbeddedTmpl: &tmpl,
+		DestPath:     strPtr(secretsEnvFile),
+		Envvars:      boolPtr(true),
+		ChangeMode:   strPtr("restart"),
+	})
+}
+
 func boolPtr(b bool) *bool    { return &b }
 func strPtr(s string) *string { return &s }
@@ -1,7 +1,13 @@
 package nomad
 
 import (
+	"bytes"
+	"strings"
 	"testing"
+	"text/template"
+	"time"
+
+	nomadapi "github.com/hashicorp/nomad/api"
 
 	"norn/v2/api/model"
 )
@@ -44,3 +50,365 @@ func TestTranslatePeriodicProcessTimezoneOverridesAppTimezone(t *testing.T) {
 		t.Fatalf("timezone = %q, want UTC", got)
 	}
 }
+
+func TestTranslateNamespacesJobsByEnvironment(t *testing.T) {
+	base := &model.InfraSpec{
+		App: "shop",
+		Processes: map[string]model.Process{
+			"web":     {Port: 8080},
+			"nightly": {Schedule: "0 3 * * *"},
+		},
+		Environments: map[string]model.EnvironmentSpec{"staging": {}},
+	}
+	spec, err := base.ForEnvironment("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := Translate(spec, "shop:abc", nil)
+	if *job.ID != "shop-staging" || job.Meta["norn_environment"] != "staging" {
+		t.Fatalf("job id = %s meta = %v", *job.ID, job.Meta)
+	}
+	if got := job.TaskGroups[0].Services[0].Name; got != "shop-staging-web" {
+		t.Fatalf("service name = %s, want shop-staging-web", got)
+	}
+	periodic := TranslatePeriodic(spec, "nightly", spec.Processes["nightly"], "shop:abc", nil)
+	if *periodic.ID != "shop-staging-nightly" {
+		t.Fatalf("periodic job id = %s, want shop-staging-nightly", *periodic.ID)
+	}
+}
+
+func TestTranslatePreviewUsesDynamicPorts(t *testing.T) {
+	base := &model.InfraSpec{
+		App:       "shop",
+		Repo:      &model.RepoSpec{URL: "https://github.com/acme/shop", Previews: &model.PreviewPolicy{Enabled: true, Domain: "preview.example.com"}},
+		Processes: map[string]model.Process{"web": {Port: 8080}},
+		Endpoints: []model.Endpoint{{URL: "https://shop.example.com"}},
+	}
+	spec, err := base.ForPreview(12)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := Translate(spec, "shop:abc", nil)
+	if *job.ID != "shop-pr-12" || job.Meta["norn_preview"] != "12" {
+		t.Fatalf("job id = %s meta = %v", *job.ID, job.Meta)
+	}
+	net := job.TaskGroups[0].Networks[0]
+	if len(net.ReservedPorts) != 0 || len(net.DynamicPorts) != 1 || net.DynamicPorts[0].To != 8080 {
+		t.Fatalf("preview networks = %+v, want one dynamic port mapped to 8080", net)
+	}
+}
+
+func TestTranslateEnvironmentUsesDynamicPorts(t *testing.T) {
+	base := &model.InfraSpec{
+		App:       "shop",
+		Processes: map[string]model.Process{"web": {Port: 8080}},
+		Endpoints: []model.Endpoint{{URL: "https://shop.example.com"}},
+		Environments: map[string]model.EnvironmentSpec{
+			"production": {Default: true},
+			"staging":    {Endpoints: []model.Endpoint{{URL: "https://staging.shop.example.com"}}},
+		},
+	}
+	for env, reserved := range map[string]bool{"production": true, "staging": false} {
+		spec, err := base.ForEnvironment(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		net := Translate(spec, "shop:abc", nil).TaskGroups[0].Networks[0]
+		if reserved && (len(net.ReservedPorts) != 1 || net.ReservedPorts[0].Value != 8080) {
+			t.Fatalf("%s networks = %+v, want port 8080 reserved", env, net)
+		}
+		if !reserved && (len(net.ReservedPorts) != 0 || len(net.DynamicPorts) != 1 || net.DynamicPorts[0].To != 8080) {
+			t.Fatalf("%s networks = %+v, want one dynamic port mapped to 8080", env, net)
+		}
+	}
+}
+
+func TestTranslateTemplatesSecretsFromBackend(t *testing.T) {
+	base := &model.InfraSpec{
+		App:            "shop",
+		Processes:      map[string]model.Process{"web": {Port: 8080}},
+		SecretsBackend: &model.SecretsBackend{Type: model.SecretsBackendNomad},
+		Environments:   map[string]model.EnvironmentSpec{"staging": {}},
+	}
+	spec, err := base.ForEnvironment("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := Translate(spec, "shop:test", map[string]string{"PLAIN": "1"})
+	task := job.TaskGroups[0].Tasks[0]
+	if len(task.Templates) != 1 || task.Templates[0].Envvars == nil || !*task.Templates[0].Envvars {
+		t.Fatalf("templates = %+v", task.Templates)
+	}
+	tmpl := *task.Templates[0].EmbeddedTmpl
+	if !strings.Contains(tmpl, `nomadVar "nomad/jobs/shop-staging"`) {
+		t.Fatalf("template = %s", tmpl)
+	}
+	out := renderSecretsTemplate(t, tmpl, template.FuncMap{
+		"nomadVar": func(string) map[string]string { return map[string]string{"TOKEN": `a"b`, "URL": "x"} },
+	})
+	if out != "TOKEN=\"a\\\"b\"\nURL=\"x\"\n" {
+		t.Fatalf("rendered = %q", out)
+	}
+
+	base.SecretsBackend = &model.SecretsBackend{Type: model.SecretsBackendVault, Path: "apps/shop", Role: "shop"}
+	job = TranslatePeriodic(base, "nightly", model.Process{Schedule: "0 3 * * *"}, "shop:test", nil)
+	task = job.TaskGroups[0].Tasks[0]
+	if task.Vault == nil || task.Vault.Role != "shop" || len(task.Templates) != 1 {
+		t.Fatalf("vault = %+v templates = %+v", task.Vault, task.Templates)
+	}
+	out = renderSecretsTemplate(t, *task.Templates[0].EmbeddedTmpl, template.FuncMap{
+		"secret": func(path string) map[string]any {
+			if path != "secret/data/apps/shop" {
+				t.Fatalf("vault path = %s", path)
+			}
+			return map[string]any{"Data": map[string]any{"data": map[string]any{"KEY": "v"}}}
+		},
+	})
+	if out != "KEY=\"v\"\n" {
+		t.Fatalf("rendered = %q", out)
+	}
+
+	base.SecretsBackend = nil
+	job = Translate(base, "shop:test", nil)
+	if task := job.TaskGroups[0].Tasks[0]; len(task.Templates) != 0 || task.Vault != nil {
+		t.Fatal("sops secrets should not add a template")
+	}
+}
+
+func renderSecretsTemplate(t *testing.T, text string, funcs template.FuncMap) string {
+	t.Helper()
+	tmpl, err := template.New("secrets").Funcs(funcs).Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestTranslatePlacement(t *testing.T) {
+	spec := &model.InfraSpec{
+		App: "shop",
+		Processes: map[string]model.Process{
+			"web": {Port: 8080, Placement: &model.Placement{
+				Datacenters: []string{"dc1", "dc2"},
+				Constraints: []model.PlacementConstraint{{Operator: "distinct_hosts"}},
+				Spread:      []model.PlacementSpread{{Attribute: "node.datacenter", Weight: 80, Targets: []model.SpreadTarget{{Value: "dc1", Percent: 60}}}},
+			}},
+			"worker": {Command: "./work", Placement: &model.Placement{
+				Constraints: []model.PlacementConstraint{{Attribute: "meta.gpu", Operator: "is_not_set"}},
+				Affinities:  []model.PlacementAffinity{{Attribute: "${node.class}", Value: "compute", Weight: -30}},
+			}},
+		},
+	}
+	job := Translate(spec, "shop:test", nil)
+	if strings.Join(job.Datacenters, ",") != "dc1,dc2" {
+		t.Fatalf("datacenters = %v", job.Datacenters)
+	}
+	groups := map[string]*nomadapi.TaskGroup{}
+	for _, tg := range job.TaskGroups {
+		groups[*tg.Name] = tg
+	}
+	web := groups["web"]
+	if len(web.Constraints) != 1 || web.Constraints[0].Operand != "distinct_hosts" || web.Constraints[0].RTarget != "true" {
+		t.Fatalf("web constraints = %+v", web.Constraints)
+	}
+	if len(web.Spreads) != 1 || web.Spreads[0].Attribute != "${node.datacenter}" || *web.Spreads[0].Weight != 80 || web.Spreads[0].SpreadTarget[0].Percent != 60 {
+		t.Fatalf("web spreads = %+v", web.Spreads)
+	}
+	worker := groups["worker"]
+	if len(worker.Constraints) != 2 || worker.Constraints[0].LTarget != "${node.datacenter}" || worker.Constraints[0].RTarget != "^(dc1)$" {
+		t.Fatalf("worker should be pinned to its datacenter: %+v", worker.Constraints)
+	}
+	if c := worker.Constraints[1]; c.LTarget != "${meta.gpu}" || c.Operand != "is_not_set" {
+		t.Fatalf("worker constraint = %+v", c)
+	}
+	if len(worker.Affinities) != 1 || worker.Affinities[0].LTarget != "${node.class}" || *worker.Affinities[0].Weight != -30 {
+		t.Fatalf("worker affinities = %+v", worker.Affinities)
+	}
+
+	proc := model.Process{Schedule: "0 3 * * *", Placement: &model.Placement{Datacenters: []string{"fsn1"}, Constraints: []model.PlacementConstraint{{Attribute: "attr.cpu.arch", Value: "amd64"}}}}
+	job = TranslatePeriodic(spec, "nightly", proc, "shop:test", nil)
+	if strings.Join(job.Datacenters, ",") != "fsn1" || len(job.TaskGroups[0].Constraints) != 1 || job.TaskGroups[0].Constraints[0].Operand != "=" {
+		t.Fatalf("periodic datacenters = %v constraints = %+v", job.Datacenters, job.TaskGroups[0].Constraints)
+	}
+	job = TranslateBatch(spec, "nightly", proc, "shop:test", nil, "shop-nightly-1")
+	if strings.Join(job.Datacenters, ",") != "fsn1" || len(job.TaskGroups[0].Constraints) != 1 {
+		t.Fatalf("batch datacenters = %v constraints = %+v", job.Datacenters, job.TaskGroups[0].Constraints)
+	}
+	job = TranslateBatch(spec, "once", model.Process{Command: "./once"}, "shop:test", nil, "shop-once-1")
+	if strings.Join(job.Datacenters, ",") != "dc1" || len(job.TaskGroups[0].Constraints) != 0 {
+		t.Fatal("processes without placement should keep the default datacenter")
+	}
+}
+
+func TestTranslateProcessTasks(t *testing.T) {
+	spec := &model.InfraSpec{
+		App:            "shop",
+		Volumes:        []model.VolumeSpec{{Name: "shop-data", Mount: "/data"}},
+		SecretsBackend: &model.SecretsBackend{Type: model.SecretsBackendNomad},
+		Processes: map[string]model.Process{
+			"web": {Port: 8080, Tasks: []model.ProcessTask{
+				{Name: "assets", Lifecycle: model.TaskInit, Command: "./fetch-assets"},
+				{Name: "shipper", Lifecycle: model.TaskSidecar, Image: "vector:0.40", Env: map[string]string{"VECTOR_LOG": "warn"}, Resources: &model.Resources{CPU: 50, Memory: 64}},
+				{Name: "flush", Lifecycle: model.TaskPoststop, Image: "busybox", Command: "sync"},
+			}},
+		},
+	}
+	job := Translate(spec, "shop:abc", map[string]string{"DATABASE_URL": "postgres://x"})
+	tasks := job.TaskGroups[0].Tasks
+	if len(tasks) != 4 || tasks[0].Name != "web" || tasks[0].Lifecycle != nil {
+		t.Fatalf("tasks = %+v", tasks)
+	}
+	assets, shipper, flush := tasks[1], tasks[2], tasks[3]
+	if assets.Lifecycle.Hook != "prestart" || assets.Lifecycle.Sidecar || assets.Config["image"] != "shop:abc" {
+		t.Fatalf("init task = %+v", assets)
+	}
+	if assets.Env["DATABASE_URL"] != "postgres://x" || len(assets.Templates) != 1 {
+		t.Fatalf("app-image tasks should get the process env and secrets: %+v", assets.Env)
+	}
+	if shipper.Lifecycle.Hook != "prestart" || !shipper.Lifecycle.Sidecar || shipper.Config["image"] != "vector:0.40" {
+		t.Fatalf("sidecar = %+v", shipper)
+	}
+	if len(shipper.Env) != 1 || shipper.Env["VECTOR_LOG"] != "warn" || len(shipper.Templates) != 0 {
+		t.Fatalf("own-image tasks should get only their env: %+v", shipper.Env)
+	}
+	if *shipper.Resources.CPU != 50 || *shipper.Resources.MemoryMB != 64 || *flush.Resources.MemoryMB != 128 {
+		t.Fatal("task resources should default like a process's")
+	}
+	if flush.Lifecycle.Hook != "poststop" || len(flush.VolumeMounts) != 1 || *flush.VolumeMounts[0].Destination != "/data" {
+		t.Fatalf("poststop task = %+v", flush)
+	}
+
+	job = TranslatePeriodic(spec, "nightly", model.Process{Schedule: "0 3 * * *", Tasks: spec.Processes["web"].Tasks[:1]}, "shop:abc", nil)
+	if len(job.TaskGroups[0].Tasks) != 2 {
+		t.Fatalf("periodic tasks = %+v", job.TaskGroups[0].Tasks)
+	}
+}
+
+func TestTranslateRegistersEveryVolume(t *testing.T) {
+	spec := &model.InfraSpec{
+		App:         "wiki",
+		Environment: "staging",
+		Environments: map[string]model.EnvironmentSpec{
+			"staging": {},
+		},
+		Volumes: []model.VolumeSpec{
+			{Name: "config", Mount: "/etc/wiki", ReadOnly: true},
+			{Name: "uploads", Mount: "/uploads", Size: "10GiB"},
+			{Name: "cache", Mount: "/cache", Type: model.VolumeCSI, Plugin: "nfs", AccessMode: "multi-node-multi-writer"},
+		},
+		Processes: map[string]model.Process{
+			"web":     {Port: 8080},
+			"nightly": {Command: "./reindex", Schedule: "0 3 * * *"},
+		},
+	}
+	jobs := []*nomadapi.Job{
+		Translate(spec, "wiki:test", nil),
+		TranslatePeriodic(spec, "nightly", spec.Processes["nightly"], "wiki:test", nil),
+		TranslateBatch(spec, "web", spec.Processes["web"], "wiki:test", nil, "wiki-web-1"),
+	}
+	for _, job := range jobs {
+		tg := job.TaskGroups[0]
+		if len(tg.Volumes) != 3 || len(tg.Tasks[0].VolumeMounts) != 3 {
+			t.Fatalf("%s volumes = %+v mounts = %d", *job.ID, tg.Volumes, len(tg.Tasks[0].VolumeMounts))
+		}
+		config, uploads, cache := tg.Volumes["config"], tg.Volumes["uploads"], tg.Volumes["cache"]
+		if config.Type != "host" || config.Source != "config" || !config.ReadOnly || config.AccessMode != "" {
+			t.Fatalf("config = %+v", config)
+		}
+		if uploads.Type != "host" || uploads.Source != "wiki-staging-uploads" || uploads.AccessMode != "single-node-writer" || uploads.AttachmentMode != "file-system" {
+			t.Fatalf("uploads = %+v", uploads)
+		}
+		if cache.Type != "csi" || cache.Source != "wiki-staging-cache" || cache.AccessMode != "multi-node-multi-writer" {
+			t.Fatalf("cache = %+v", cache)
+		}
+	}
+}
+
+func TestTranslateMeshAddsConnectSidecar(t *testing.T) {
+	spec := &model.InfraSpec{
+		App: "billing",
+		Processes: map[string]model.Process{
+			"web": {Port: 8080, Canary: &model.CanaryConfig{Count: 1}, Mesh: &model.MeshSpec{Upstreams: []model.MeshUpstream{
+				{Service: "ledger-api", LocalPort: 9001},
+			}}},
+			"admin": {Port: 8081},
+		},
+		Endpoints: []model.Endpoint{{URL: "https://billing.example.com"}},
+	}
+	job := Translate(spec, "billing:abc", nil)
+	groups := map[string]*nomadapi.TaskGroup{}
+	for _, tg := range job.TaskGroups {
+		groups[*tg.Name] = tg
+	}
+
+	web := groups["web"]
+	net := web.Networks[0]
+	if net.Mode != "bridge" || len(net.ReservedPorts) != 1 || net.ReservedPorts[0].Value != 8080 || net.ReservedPorts[0].To != 8080 {
+		t.Fatalf("web network = %+v, want bridge with 8080 mapped to itself", net)
+	}
+	if _, ok := web.Tasks[0].Config["ports"]; ok {
+		t.Fatal("bridge-mode task should not map ports in the docker driver")
+	}
+	connect := web.Services[0].Connect
+	if connect == nil || connect.SidecarService == nil || len(connect.SidecarService.Proxy.Upstreams) != 1 {
+		t.Fatalf("web connect = %+v", connect)
+	}
+	if up := connect.SidecarService.Proxy.Upstreams[0]; up.DestinationName != "ledger-api" || up.LocalBindPort != 9001 {
+		t.Fatalf("upstream = %+v", up)
+	}
+	if tags := web.Services[0].CanaryTags; len(tags) != 1 || tags[0] != model.CanaryTag {
+		t.Fatalf("web canary tags = %v, want [%s]", tags, model.CanaryTag)
+	}
+
+	admin := groups["admin"]
+	if admin.Networks[0].Mode != "" || admin.Services[0].Connect != nil || admin.Tasks[0].Config["ports"] == nil {
+		t.Fatalf("admin should stay on host networking: %+v", admin.Networks[0])
+	}
+}
+
+func TestTranslateRestartAndUpdateStrategies(t *testing.T) {
+	three := 3
+	spec := &model.InfraSpec{
+		App: "ledger",
+		Processes: map[string]model.Process{
+			"jvm": {Port: 8080,
+				Restart: &model.RestartSpec{Attempts: &three, Interval: "30m", Delay: "1m", Mode: model.RestartFail},
+				Update:  &model.UpdateSpec{MaxParallel: 2, MinHealthyTime: "2m", HealthyDeadline: "15m", ProgressDeadline: "20m", HealthCheck: model.HealthCheckTaskStates}},
+			"api": {Port: 8081, Canary: &model.CanaryConfig{Count: 1}},
+			"fn":  {Command: "./fn", Function: &model.FunctionSpec{}, Restart: &model.RestartSpec{Delay: "10s"}},
+		},
+	}
+	job := Translate(spec, "ledger:abc", nil)
+	groups := map[string]*nomadapi.TaskGroup{}
+	for _, tg := range job.TaskGroups {
+		groups[*tg.Name] = tg
+	}
+
+	jvm := groups["jvm"]
+	if rp := jvm.RestartPolicy; *rp.Attempts != 3 || *rp.Interval != 30*time.Minute || *rp.Delay != time.Minute || *rp.Mode != "fail" {
+		t.Fatalf("jvm restart = %d %s %s %s", *rp.Attempts, *rp.Interval, *rp.Delay, *rp.Mode)
+	}
+	u := jvm.Update
+	if *u.MaxParallel != 2 || *u.MinHealthyTime != 2*time.Minute || *u.HealthyDeadline != 15*time.Minute || *u.ProgressDeadline != 20*time.Minute || *u.Stagger != 30*time.Second || *u.HealthCheck != "task_states" || !*u.AutoRevert {
+		t.Fatalf("jvm update = %+v", u)
+	}
+
+	api := groups["api"]
+	if *api.RestartPolicy.Attempts != 3 || *api.RestartPolicy.Mode != "delay" || *api.Update.MaxParallel != 1 || *api.Update.MinHealthyTime != 30*time.Second {
+		t.Fatalf("api should keep the defaults: %+v %+v", api.RestartPolicy, api.Update)
+	}
+	if *api.Update.Canary != 1 || *api.Update.AutoRevert {
+		t.Fatal("canary processes should leave reverting to norn")
+	}
+
+	batch := TranslateBatch(spec, "fn", spec.Processes["fn"], "ledger:abc", nil, "ledger-fn-1")
+	if rp := batch.TaskGroups[0].RestartPolicy; *rp.Attempts != 0 || *rp.Delay != 10*time.Second || *rp.Mode != "fail" {
+		t.Fatalf("function restart = %d %s %s", *rp.Attempts, *rp.Delay, *rp.Mode)
+	}
+}
@@ -0,0 +1,36 @@
+package nomad
+
+import (
+	nomadapi "github.com/hashicorp/nomad/api"
+)
+
+// ReadVariable returns the items of the Nomad variable at path, or nil when
+// it does not exist.
+func (c *Client) ReadVariable(path string) (map[string]string, error) {
+	v, _, err := c.api.Variables().Peek(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, nil
+	}
+	items := make(map[string]string, len(v.Items))
+	for k, val := range v.Items {
+		items[k] = val
+	}
+	return items, nil
+}
+
+// WriteVariable replaces the items of the Nomad variable at path. Nomad
+// rejects empty variables, so writing no items deletes it.
+func (c *Client) WriteVariable(path string, items map[string]string) error {
+	if len(items) == 0 {
+		_, err := c.api.Variables().Delete(path, nil)
+		return err
+	}
+	_, _, err := c.api.Variables().Update(&nomadapi.Variable{
+		Path:  path,
+		Items: nomadapi.VariableItems(items),
+	}, nil)
+	return err
+}
@@ -0,0 +1,236 @@
+package nomad
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+
+	"norn/v2/api/model"
+)
+
+// VolumeMissing is the state of a managed volume Nomad does not know yet.
+const VolumeMissing = "missing"
+
+// VolumeStatus is a volume as Nomad reports it.
+type VolumeStatus struct {
+	Name          string `json:"name"`
+	Source        string `json:"source"`
+	Type          string `json:"type"`
+	ID            string `json:"id,omitempty"`
+	Plugin        string `json:"plugin,omitempty"`
+	State         string `json:"state"`
+	NodeID        string `json:"nodeId,omitempty"`
+	HostPath      string `json:"hostPath,omitempty"`
+	CapacityBytes int64  `json:"capacityBytes,omitempty"`
+	Claims        int    `json:"claims"`
+}
+
+// configureVolumes registers the spec's volumes with tg and mounts them
+// into task. Managed volumes are claimed with their access mode; host
+// volumes configured on the client are mounted by name.
+func configureVolumes(spec *model.InfraSpec, tg *nomadapi.TaskGroup, task *nomadapi.Task) {
+	if len(spec.Volumes) == 0 {
+		return
+	}
+	tg.Volumes = make(map[string]*nomadapi.VolumeRequest, len(spec.Volumes))
+	for _, vol := range spec.Volumes {
+		req := &nomadapi.VolumeRequest{
+			Name:     vol.Name,
+			Type:     vol.VolumeType(),
+			Source:   vol.Source(spec.JobID()),
+			ReadOnly: vol.ReadOnly,
+		}
+		if vol.Managed() {
+			req.AccessMode = vol.Access()
+			req.AttachmentMode = string(nomadapi.CSIVolumeAttachmentModeFilesystem)
+		}
+		tg.Volumes[vol.Name] = req
+
+		name, mount, readOnly := vol.Name, vol.Mount, vol.ReadOnly
+		task.VolumeMounts = append(task.VolumeMounts, &nomadapi.VolumeMount{
+			Volume:      &name,
+			Destination: &mount,
+			ReadOnly:    &readOnly,
+		})
+	}
+}
+
+// LookupVolume looks up the managed volume vol of jobID. State is
+// VolumeMissing when Nomad has no such volume.
+func (c *Client) LookupVolume(jobID string, vol model.VolumeSpec) (*VolumeStatus, error) {
+	status := &VolumeStatus{
+		Name:   vol.Name,
+		Source: vol.Source(jobID),
+		Type:   vol.VolumeType(),
+		Plugin: vol.PluginID(),
+	}
+	if err := c.refreshVolume(status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// refreshVolume fills status from the volume Nomad has under its Source.
+func (c *Client) refreshVolume(status *VolumeStatus) error {
+	status.State = VolumeMissing
+	if status.Type == model.VolumeCSI {
+		v, _, err := c.api.CSIVolumes().Info(status.Source, nil)
+		if err != nil {
+			if isNotFound(err) {
+				return nil
+			}
+			return fmt.Errorf("csi volume %s: %w", status.Source, err)
+		}
+		status.ID = v.ID
+		status.CapacityBytes = v.Capacity
+		status.Claims = len(v.ReadAllocs) + len(v.WriteAllocs)
+		status.State = "unavailable"
+		if v.Schedulable {
+			status.State = "ready"
+		}
+		return nil
+	}
+
+	stubs, _, err := c.api.HostVolumes().List(nil, nil)
+	if err != nil {
+		return fmt.Errorf("list host volumes: %w", err)
+	}
+	for _, stub := range stubs {
+		if stub.Name != status.Source {
+			continue
+		}
+		v, _, err := c.api.HostVolumes().Get(stub.ID, nil)
+		if err != nil {
+			return fmt.Errorf("host volume %s: %w", status.Source, err)
+		}
+		status.ID = v.ID
+		status.Plugin = v.PluginID
+		status.NodeID = v.NodeID
+		status.HostPath = v.HostPath
+		status.CapacityBytes = v.CapacityBytes
+		status.Claims = len(v.Allocations)
+		status.State = string(v.State)
+		return nil
+	}
+	return nil
+}
+
+// EnsureVolume creates the managed volume vol of jobID unless Nomad already
+// has it. created reports whether this call created it.
+func (c *Client) EnsureVolume(jobID string, vol model.VolumeSpec) (status *VolumeStatus, created bool, err error) {
+	status, err = c.LookupVolume(jobID, vol)
+	if err != nil || status.State != VolumeMissing {
+		return status, false, err
+	}
+
+	var size int64
+	if vol.Size != "" {
+		if size, err = model.ParseVolumeSize(vol.Size); err != nil {
+			return nil, false, err
+		}
+	}
+	if vol.VolumeType() == model.VolumeCSI {
+		vols, _, err := c.api.CSIVolumes().Create(&nomadapi.CSIVolume{
+			ID:                   status.Source,
+			Name:                 status.Source,
+			PluginID:             vol.PluginID(),
+			RequestedCapacityMin: size,
+			RequestedCapabilities: []*nomadapi.CSIVolumeCapability{{
+				AccessMode:     nomadapi.CSIVolumeAccessMode(vol.Access()),
+				AttachmentMode: nomadapi.CSIVolumeAttachmentModeFilesystem,
+			}},
+		}, nil)
+		if err != nil {
+			return nil, false, fmt.Errorf("create csi volume %s: %w", status.Source, err)
+		}
+		if len(vols) > 0 {
+			status.ID = vols[0].ID
+			status.CapacityBytes = vols[0].Capacity
+		}
+		status.State = "ready"
+		return status, true, nil
+	}
+
+	resp, _, err := c.api.HostVolumes().Create(&nomadapi.HostVolumeCreateRequest{
+		Volume: &nomadapi.HostVolume{
+			Name:                      status.Source,
+			PluginID:                  vol.PluginID(),
+			RequestedCapacityMinBytes: size,
+			RequestedCapacityMaxBytes: size,
+			RequestedCapabilities: []*nomadapi.HostVolumeCapability{{
+				AccessMode:     nomadapi.HostVolumeAccessMode(vol.Access()),
+				AttachmentMode: nomadapi.HostVolumeAttachmentModeFilesystem,
+			}},
+		},
+	}, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("create host volume %s: %w", status.Source, err)
+	}
+	if resp != nil && resp.Volume != nil {
+		status.ID = resp.Volume.ID
+		status.NodeID = resp.Volume.NodeID
+		status.HostPath = resp.Volume.HostPath
+		status.CapacityBytes = resp.Volume.CapacityBytes
+		status.State = string(resp.Volume.State)
+	}
+	return status, true, nil
+}
+
+// DeleteVolume deletes a managed volume and its data. Nomad refuses while
+// an allocation still claims it.
+func (c *Client) DeleteVolume(status *VolumeStatus) error {
+	if status.State == VolumeMissing {
+		return nil
+	}
+	if status.Type == model.VolumeCSI {
+		if err := c.api.CSIVolumes().DeleteOpts(&nomadapi.CSIVolumeDeleteRequest{ExternalVolumeID: status.ID}, nil); err != nil {
+			return fmt.Errorf("delete csi volume %s: %w", status.Source, err)
+		}
+		return nil
+	}
+	if _, _, err := c.api.HostVolumes().Delete(&nomadapi.HostVolumeDeleteRequest{ID: status.ID}, nil); err != nil {
+		return fmt.Errorf("delete host volume %s: %w", status.Source, err)
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "404") || strings.Contains(strings.ToLower(msg), "not found")
+}
+
+// AppVolumes looks up the managed volumes spec declares for jobID,
+// including ones Nomad does not have yet.
+func (c *Client) AppVolumes(jobID string, spec *model.InfraSpec) ([]*VolumeStatus, error) {
+	var out []*VolumeStatus
+	for _, vol := range model.ManagedVolumes(spec) {
+		status, err := c.LookupVolume(jobID, vol)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, status)
+	}
+	return out, nil
+}
+
+// WaitVolumeReleased polls until no allocation claims the volume or ctx is
+// done.
+func (c *Client) WaitVolumeReleased(ctx context.Context, status *VolumeStatus) error {
+	current := *status
+	for {
+		if err := c.refreshVolume(&current); err != nil {
+			return err
+		}
+		if current.Claims == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("volume %s still claimed by %d allocation(s): %w", status.Source, current.Claims, ctx.Err())
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,449 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+
+	"norn/v2/api/hub"
+	"norn/v2/api/model"
+	"norn/v2/api/nomad"
+	"norn/v2/api/saga"
+	"norn/v2/api/store"
+)
+
+var autoscaleScrapeClient = &http.Client{Timeout: 5 * time.Second}
+
+// autoscaleTolerance is how far the load may stray from the target before
+// the autoscaler recommends a different count.
+const autoscaleTolerance = 0.1
+
+// AutoscaleHistory remembers each process's recent recommendations for the
+// stabilisation windows and when its count last changed for the cooldown.
+// The zero value is ready to use.
+type AutoscaleHistory struct {
+	mu      sync.Mutex
+	recs    map[string][]autoscaleRec
+	changed map[string]time.Time
+}
+
+type autoscaleRec struct {
+	at    time.Time
+	count int
+}
+
+// AutoscaleDecision is a count change the autoscaler made.
+type AutoscaleDecision struct {
+	Process  string
+	Metric   string
+	Observed float64 // per instance
+	Target   int
+	From     int
+	To       int
+	SagaID   string
+}
+
+// Autoscale sizes each of spec's autoscaled processes so its instances carry
+// about the configured target, and returns the changes it made. Apps with an
+// operation in progress, and processes that are stopped or asleep, are left
+// alone.
+func (p *Pipeline) Autoscale(ctx context.Context, spec *model.InfraSpec, history *AutoscaleHistory, now time.Time) ([]AutoscaleDecision, error) {
+	var procs []string
+	for name, proc := range spec.Processes {
+		if proc.Scaling.Autoscales() {
+			procs = append(procs, name)
+		}
+	}
+	if len(procs) == 0 {
+		return nil, nil
+	}
+	sort.Strings(procs)
+
+	jobID := spec.JobID()
+	job, err := p.Nomad.JobInfo(jobID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read job %s: %w", jobID, err)
+	}
+	if p.DB != nil {
+		active, err := p.DB.ListOperations(ctx, store.OperationFilter{App: spec.App, Active: true, Limit: 1})
+		if err != nil {
+			return nil, fmt.Errorf("check operations: %w", err)
+		}
+		if len(active) > 0 {
+			return nil, nil
+		}
+	}
+
+	counts := groupCounts(job)
+	obs := &autoscaleObserver{p: p, ctx: ctx, jobID: jobID}
+	var decisions []AutoscaleDecision
+	var firstErr error
+	for _, name := range procs {
+		proc := spec.Processes[name]
+		current, ok := counts[name]
+		if !ok || current == 0 {
+			continue
+		}
+		auto := proc.Scaling.Auto
+		observed, err := obs.perInstance(name, proc, current)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s/%s %s: %w", jobID, name, auto.Metric, err)
+			}
+			continue
+		}
+		if math.IsNaN(observed) {
+			continue
+		}
+
+		key := jobID + "/" + name
+		rec := recommendCount(current, observed, float64(auto.Target), proc.Scaling.Min, proc.Scaling.Max)
+		desired := history.stabilise(key, now, current, rec, auto.UpWindow(), auto.DownWindow())
+		if desired == current {
+			continue
+		}
+		if last := history.lastChange(key, job); now.Sub(last) < auto.CooldownPeriod() {
+			continue
+		}
+
+		decision := AutoscaleDecision{
+			Process:  name,
+			Metric:   auto.Metric,
+			Observed: observed,
+			Target:   auto.Target,
+			From:     current,
+			To:       desired,
+		}
+		if err := p.applyAutoscale(ctx, spec, &decision); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		history.markChanged(key, now)
+		decisions = append(decisions, decision)
+	}
+	return decisions, firstErr
+}
+
+func (p *Pipeline) applyAutoscale(ctx context.Context, spec *model.InfraSpec, d *AutoscaleDecision) error {
+	jobID := spec.JobID()
+	reason := autoscaleReason(d)
+	sg := saga.New(p.SagaStore, spec.App, "autoscaler", "scale")
+	d.SagaID = sg.ID
+	meta := map[string]string{
+		"jobId":    jobID,
+		"group":    d.Process,
+		"from":     strconv.Itoa(d.From),
+		"to":       strconv.Itoa(d.To),
+		"metric":   d.Metric,
+		"observed": formatFloat(d.Observed, 2),
+		"target":   strconv.Itoa(d.Target),
+	}
+	if err := p.Nomad.ScaleJob(jobID, d.Process, d.To); err != nil {
+		sg.Log(ctx, "scale.auto_failed", fmt.Sprintf("scale %s/%s %d → %d: %v", jobID, d.Process, d.From, d.To, err), meta)
+		return fmt.Errorf("scale %s/%s to %d: %w", jobID, d.Process, d.To, err)
+	}
+	sg.Log(ctx, "scale.auto", fmt.Sprintf("%s/%s scaled %d → %d: %s", jobID, d.Process, d.From, d.To, reason), meta)
+	p.WS.Broadcast(hub.Event{Type: "process.scaled", AppID: spec.App, Payload: map[string]string{
+		"process": d.Process,
+		"count":   strconv.Itoa(d.To),
+		"sagaId":  sg.ID,
+	}})
+	return nil
+}
+
+func autoscaleReason(d *AutoscaleDecision) string {
+	switch d.Metric {
+	case model.AutoScaleCPU, model.AutoScaleMemory:
+		return fmt.Sprintf("%s at %s%% per instance, target %d%%", d.Metric, formatFloat(d.Observed, 1), d.Target)
+	case model.AutoScaleKafkaLag:
+		return fmt.Sprintf("consumer lag of %s per instance, target %d", formatFloat(d.Observed, 0), d.Target)
+	default:
+		return fmt.Sprintf("%s per instance, target %d", formatFloat(d.Observed, 2), d.Target)
+	}
+}
+
+// recommendCount sizes a process so each instance carries about target, the
+// way a horizontal autoscaler does, within min (at least 1) and max. Loads
+// within autoscaleTolerance of the target keep the current count.
+func recommendCount(current int, perInstance, target float64, min, max int) int {
+	if min < 1 {
+		min = 1
+	}
+	desired := current
+	ratio := perInstance / target
+	if math.Abs(ratio-1) > autoscaleTolerance {
+		desired = int(math.Ceil(float64(current) * ratio))
+	}
+	if desired < min {
+		desired = min
+	}
+	if max > 0 && desired > max {
+		desired = max
+	}
+	return desired
+}
+
+// stabilise records rec and returns the count to move to: up only as far as
+// every recommendation in the scale-up window agrees, down only as far as
+// every recommendation in the scale-down window agrees.
+func (h *AutoscaleHistory) stabilise(key string, now time.Time, current, rec int, up, down time.Duration) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.recs == nil {
+		h.recs = map[string][]autoscaleRec{}
+	}
+	keep := up
+	if down > keep {
+		keep = down
+	}
+	recs := append(h.recs[key], autoscaleRec{at: now, count: rec})
+	for len(recs) > 0 && now.Sub(recs[0].at) > keep {
+		recs = recs[1:]
+	}
+	h.recs[key] = recs
+
+	upTo, downTo := rec, rec
+	for _, r := range recs {
+		age := now.Sub(r.at)
+		if age <= up && r.count < upTo {
+			upTo = r.count
+		}
+		if age <= down && r.count > downTo {
+			downTo = r.count
+		}
+	}
+	switch {
+	case upTo > current:
+		return upTo
+	case downTo < current:
+		return downTo
+	default:
+		return current
+	}
+}
+
+// lastChange is when the process's count last changed: the autoscaler's own
+// last change or the job's last submission, whichever is later, so a deploy
+// or manual scale also starts a cooldown.
+func (h *AutoscaleHistory) lastChange(key string, job *nomadapi.Job) time.Time {
+	h.mu.Lock()
+	last := h.changed[key]
+	h.mu.Unlock()
+	if job.SubmitTime != nil {
+		if submitted := time.Unix(0, *job.SubmitTime); submitted.After(last) {
+			last = submitted
+		}
+	}
+	return last
+}
+
+func (h *AutoscaleHistory) markChanged(key string, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.changed == nil {
+		h.changed = map[string]time.Time{}
+	}
+	h.changed[key] = now
+}
+
+func groupCounts(job *nomadapi.Job) map[string]int {
+	counts := map[string]int{}
+	for _, tg := range job.TaskGroups {
+		if tg.Name != nil && tg.Count != nil {
+			counts[*tg.Name] = *tg.Count
+		}
+	}
+	return counts
+}
+
+// autoscaleObserver reads the load of one job's processes, fetching the
+// job's allocation stats at most once per pass.
+type autoscaleObserver struct {
+	p     *Pipeline
+	ctx   context.Context
+	jobID string
+
+	usage      []nomad.ResourceUsage
+	usageErr   error
+	usageRead  bool
+	allocs     []nomad.DeploymentAllocation
+	allocsErr  error
+	allocsRead bool
+}
+
+// perInstance returns the process's load per running instance in the units
+// of its target, or NaN when there is nothing to measure yet.
+func (o *autoscaleObserver) perInstance(name string, proc model.Process, current int) (float64, error) {
+	auto := proc.Scaling.Auto
+	switch auto.Metric {
+	case model.AutoScaleCPU, model.AutoScaleMemory:
+		usage, err := o.resourceUsage()
+		if err != nil {
+			return 0, err
+		}
+		return averageUtilisation(usage, name, auto.Metric, processMemoryMB(proc)), nil
+	case model.AutoScaleKafkaLag:
+		if o.p.Redpanda == nil {
+			return 0, fmt.Errorf("redpanda is not configured")
+		}
+		lag, err := o.p.Redpanda.ConsumerLag(o.ctx, auto.Group, auto.Topic)
+		if err != nil {
+			return 0, err
+		}
+		return float64(lag) / float64(current), nil
+	case model.AutoScaleCustom:
+		allocs, err := o.deploymentAllocations()
+		if err != nil {
+			return 0, err
+		}
+		return scrapeAverage(allocs, name, proc), nil
+	}
+	return 0, fmt.Errorf("unknown metric %q", auto.Metric)
+}
+
+func (o *autoscaleObserver) resourceUsage() ([]nomad.ResourceUsage, error) {
+	if !o.usageRead {
+		o.usage, o.usageErr = o.p.Nomad.JobResourceUsage(o.jobID)
+		o.usageRead = true
+	}
+	return o.usage, o.usageErr
+}
+
+func (o *autoscaleObserver) deploymentAllocations() ([]nomad.DeploymentAllocation, error) {
+	if !o.allocsRead {
+		o.allocs, o.allocsErr = o.p.Nomad.DeploymentAllocations(o.jobID)
+		o.allocsRead = true
+	}
+	return o.allocs, o.allocsErr
+}
+
+// averageUtilisation is the mean CPU percent, or RSS as a percent of the
+// memory reservation, of the process's own task over the group's
+// allocations; NaN without samples.
+func averageUtilisation(usage []nomad.ResourceUsage, group, metric string, memoryMB int) float64 {
+	var sum float64
+	var n int
+	for _, u := range usage {
+		if u.TaskGroup != group {
+			continue
+		}
+		u = u.MainTask()
+		if metric == model.AutoScaleMemory {
+			sum += float64(u.MemoryUsageBytes) / float64(memoryMB<<20) * 100
+		} else {
+			sum += u.CPUPercent
+		}
+		n++
+	}
+	if n == 0 {
+		return math.NaN()
+	}
+	return sum / float64(n)
+}
+
+// processMemoryMB is the memory reservation Translate gives the process.
+func processMemoryMB(proc model.Process) int {
+	if proc.Resources != nil && proc.Resources.Memory > 0 {
+		return proc.Resources.Memory
+	}
+	return 128
+}
+
+// scrapeAverage scrapes the query's series from each of the group's
+// allocations and averages the per-allocation sums; NaN if none answered.
+func scrapeAverage(allocs []nomad.DeploymentAllocation, group string, proc model.Process) float64 {
+	name, want := parseSeriesQuery(proc.Scaling.Auto.Query)
+	var sum float64
+	var n int
+	for _, alloc := range allocs {
+		if alloc.TaskGroup != group {
+			continue
+		}
+		addr := alloc.Ports[nomad.MetricsPortLabel(group, proc)]
+		if addr == "" {
+			continue
+		}
+		value, err := scrapeSeries("http://"+addr+proc.Metrics.Path, name, want)
+		if err != nil {
+			continue
+		}
+		sum += value
+		n++
+	}
+	if n == 0 {
+		return math.NaN()
+	}
+	return sum / float64(n)
+}
+
+func scrapeSeries(url, name string, want map[string]string) (float64, error) {
+	resp, err := autoscaleScrapeClient.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("scrape %s: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return 0, err
+	}
+	return sumSeries(string(body), name, want), nil
+}
+
+// parseSeriesQuery splits `name{label="value",...}` into the series name and
+// the labels a sample must carry.
+func parseSeriesQuery(query string) (string, map[string]string) {
+	query = strings.TrimSpace(query)
+	open := strings.IndexByte(query, '{')
+	if open < 0 {
+		return query, nil
+	}
+	end := strings.LastIndexByte(query, '}')
+	if end < open {
+		end = len(query)
+	}
+	return strings.TrimSpace(query[:open]), parsePromLabels(query[open+1 : end])
+}
+
+// sumSeries adds up the samples of name in Prometheus text exposition that
+// carry every wanted label.
+func sumSeries(body, name string, want map[string]string) float64 {
+	var total float64
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		series, labels, value, ok := parsePromLine(line)
+		if !ok || series != name {
+			continue
+		}
+		match := true
+		for k, v := range want {
+			if labels[k] != v {
+				match = false
+				break
+			}
+		}
+		if match {
+			total += value
+		}
+	}
+	return total
+}
@@ -0,0 +1,111 @@
+package pipeline
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"norn/v2/api/model"
+	"norn/v2/api/nomad"
+)
+
+func TestRecommendCount(t *testing.T) {
+	tests := []struct {
+		name        string
+		current     int
+		perInstance float64
+		target      float64
+		min, max    int
+		want        int
+	}{
+		{"within tolerance", 3, 74, 70, 1, 10, 3},
+		{"scale up", 2, 140, 70, 1, 10, 4},
+		{"scale down", 4, 20, 70, 1, 10, 2},
+		{"clamped to max", 2, 700, 70, 1, 5, 5},
+		{"never below one", 3, 0, 70, 0, 5, 1},
+		{"held at min", 4, 5, 70, 2, 5, 2},
+		{"lag from idle consumers", 2, 2500, 1000, 1, 8, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := recommendCount(tt.current, tt.perInstance, tt.target, tt.min, tt.max); got != tt.want {
+				t.Fatalf("recommendCount = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStabiliseHoldsScaleDownForWindow(t *testing.T) {
+	var h AutoscaleHistory
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	const key = "mail/web"
+
+	if got := h.stabilise(key, base, 4, 6, 0, 5*time.Minute); got != 6 {
+		t.Fatalf("scale up should apply at once, got %d", got)
+	}
+	// Load drops, but a recommendation of 6 is still inside the window.
+	if got := h.stabilise(key, base.Add(2*time.Minute), 6, 2, 0, 5*time.Minute); got != 6 {
+		t.Fatalf("scale down inside the window should hold, got %d", got)
+	}
+	if got := h.stabilise(key, base.Add(4*time.Minute), 6, 3, 0, 5*time.Minute); got != 6 {
+		t.Fatalf("scale down inside the window should hold, got %d", got)
+	}
+	// Once the 6 ages out, go down to the highest recent recommendation.
+	if got := h.stabilise(key, base.Add(6*time.Minute), 6, 2, 0, 5*time.Minute); got != 3 {
+		t.Fatalf("scale down after the window = %d, want 3", got)
+	}
+}
+
+func TestStabiliseScaleUpWindowTakesLowestRecommendation(t *testing.T) {
+	var h AutoscaleHistory
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	const key = "mail/consumer"
+
+	if got := h.stabilise(key, base, 2, 2, time.Minute, 5*time.Minute); got != 2 {
+		t.Fatalf("steady load should keep 2, got %d", got)
+	}
+	if got := h.stabilise(key, base.Add(30*time.Second), 2, 8, time.Minute, 5*time.Minute); got != 2 {
+		t.Fatalf("a spike inside the up window should not scale, got %d", got)
+	}
+	if got := h.stabilise(key, base.Add(90*time.Second), 2, 6, time.Minute, 5*time.Minute); got != 6 {
+		t.Fatalf("sustained load should scale to the lowest recent recommendation, got %d", got)
+	}
+}
+
+func TestAverageUtilisation(t *testing.T) {
+	usage := []nomad.ResourceUsage{
+		{TaskGroup: "web", CPUPercent: 80, MemoryUsageBytes: 64 << 20},
+		{TaskGroup: "web", CPUPercent: 40, MemoryUsageBytes: 128 << 20},
+		{TaskGroup: "worker", CPUPercent: 5},
+	}
+	if got := averageUtilisation(usage, "web", model.AutoScaleCPU, 256); got != 60 {
+		t.Fatalf("cpu = %v, want 60", got)
+	}
+	if got := averageUtilisation(usage, "web", model.AutoScaleMemory, 256); got != 37.5 {
+		t.Fatalf("memory = %v, want 37.5", got)
+	}
+	if got := averageUtilisation(usage, "api", model.AutoScaleCPU, 256); !math.IsNaN(got) {
+		t.Fatalf("no samples should be NaN, got %v", got)
+	}
+}
+
+func TestSumSeriesMatchesQueryLabels(t *testing.T) {
+	body := `# TYPE queue_depth gauge
+queue_depth{queue="mail",shard="0"} 12
+queue_depth{queue="mail",shard="1"} 8
+queue_depth{queue="audit"} 40
+queue_depth_total 99
+`
+	name, labels := parseSeriesQuery(`queue_depth{queue="mail"}`)
+	if name != "queue_depth" || !reflect.DeepEqual(labels, map[string]string{"queue": "mail"}) {
+		t.Fatalf("parseSeriesQuery = %q %v", name, labels)
+	}
+	if got := sumSeries(body, name, labels); got != 20 {
+		t.Fatalf("mail depth = %v, want 20", got)
+	}
+	name, labels = parseSeriesQuery("queue_depth")
+	if got := sumSeries(body, name, labels); got != 60 {
+		t.Fatalf("all depth = %v, want 60", got)
+	}
+}
@@ -3,10 +3,13 @@ package pipeline
 import (
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 
+	"norn/v2/api/builder"
+	"norn/v2/api/model"
 	"norn/v2/api/saga"
 )
 
@@ -15,6 +18,12 @@ func (p *Pipeline) build(ctx context.Context, st *state, sg *saga.Saga) error {
 		st.imageTag = fmt.Sprintf("%s:latest", st.spec.App)
 		return nil
 	}
+	spec := st.spec.Build
+
+	b, err := builder.New(spec.Backend, p.Builder)
+	if err != nil {
+		return err
+	}
 
 	sha := st.commitSHA
 	if len(sha) > 12 {
@@ -25,10 +34,9 @@ func (p *Pipeline) build(ctx context.Context, st *state, sg *saga.Saga) error {
 	}
 	localTag := fmt.Sprintf("%s:%s", st.spec.App, sha)
 	dockerfile := "Dockerfile"
-	if st.spec.Build.Dockerfile != "" {
-		dockerfile = st.spec.Build.Dockerfile
+	if spec.Dockerfile != "" {
+		dockerfile = spec.Dockerfile
 	}
-	dockerfilePath := filepath.Join(st.workDir, dockerfile)
 
 	// Build number from git commit count
 	buildNumber := "0"
@@ -39,34 +47,139 @@ func (p *Pipeline) build(ctx context.Context, st *state, sg *saga.Saga) error {
 		}
 	}
 
+	args := make(map[string]string, len(spec.Args)+2)
+	for k, v := range spec.Args {
+		args[k] = v
+	}
+	args["VERSION"] = st.commitSHA
+	args["BUILD_NUMBER"] = buildNumber
+
+	req := builder.Request{
+		ContextDir: st.workDir,
+		Dockerfile: filepath.Join(st.workDir, dockerfile),
+		Tag:        localTag,
+		Platforms:  spec.Platforms,
+		Args:       args,
+		Target:     spec.Target,
+		CacheFrom:  spec.CacheFrom,
+		CacheTo:    spec.CacheTo,
+	}
 	if p.RegistryURL != "" && !st.preflight {
-		registryTag := fmt.Sprintf("%s/%s", p.RegistryURL, localTag)
-		// Use buildx to build multi-arch and push in one step
-		cmd := exec.CommandContext(ctx, "docker", "buildx", "build",
-			"--platform", "linux/amd64,linux/arm64",
-			"--build-arg", fmt.Sprintf("VERSION=%s", st.commitSHA),
-			"--build-arg", fmt.Sprintf("BUILD_NUMBER=%s", buildNumber),
-			"-f", dockerfilePath,
-			"-t", registryTag,
-			"--push",
-			st.workDir)
-		out, err := cmd.CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("docker build: %s", string(out))
-		}
-		st.imageTag = registryTag
-	} else {
-		cmd := exec.CommandContext(ctx, "docker", "build",
-			"--build-arg", fmt.Sprintf("VERSION=%s", st.commitSHA),
-			"--build-arg", fmt.Sprintf("BUILD_NUMBER=%s", buildNumber),
-			"-f", dockerfilePath,
-			"-t", localTag, st.workDir)
-		out, err := cmd.CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("docker build: %s", string(out))
+		req.Tag = fmt.Sprintf("%s/%s", p.RegistryURL, localTag)
+		req.Push = true
+		if len(req.Platforms) == 0 {
+			req.Platforms = p.BuildPlatforms
 		}
-		st.imageTag = localTag
 	}
 
+	secretDir, secrets, err := p.buildSecrets(st)
+	if err != nil {
+		return err
+	}
+	if secretDir != "" {
+		defer os.RemoveAll(secretDir)
+	}
+	req.Secrets = secrets
+
+	sg.Log(ctx, "build.backend", fmt.Sprintf("building %s with %s", req.Tag, b.Name()), map[string]string{
+		"backend":   b.Name(),
+		"platforms": strings.Join(req.Platforms, ","),
+		"target":    req.Target,
+		"push":      fmt.Sprintf("%t", req.Push),
+	})
+	if err := b.Build(ctx, req); err != nil {
+		return fmt.Errorf("%s build: %w", b.Name(), err)
+	}
+	st.imageTag = req.Tag
 	return nil
 }
+
+// buildSecrets resolves build.secrets to files the builder can mount. Values
+// from the app's encrypted secrets are written to a private temp dir that the
+// caller removes once the build finishes.
+func (p *Pipeline) buildSecrets(st *state) (string, []builder.Secret, error) {
+	if len(st.spec.Build.Secrets) == 0 {
+		return "", nil, nil
+	}
+	var values map[string]string
+	var dir string
+	out := make([]builder.Secret, 0, len(st.spec.Build.Secrets))
+	for _, s := range st.spec.Build.Secrets {
+		if !s.ValidID() {
+			removeDir(dir)
+			return "", nil, fmt.Errorf("build secret id %q is not a valid file name", s.ID)
+		}
+		if s.Src != "" {
+			src, err := sourceTreeFile(st.workDir, s.Src)
+			if err != nil {
+				removeDir(dir)
+				return "", nil, fmt.Errorf("build secret %s: %w", s.ID, err)
+			}
+			out = append(out, builder.Secret{ID: s.ID, Src: src})
+			continue
+		}
+		if values == nil {
+			var err error
+			values, err = p.buildSecretValues(st.spec)
+			if err != nil {
+				removeDir(dir)
+				return "", nil, err
+			}
+		}
+		value, ok := values[s.Key]
+		if !ok {
+			removeDir(dir)
+			return "", nil, fmt.Errorf("build secret %s: key %q not found in secrets", s.ID, s.Key)
+		}
+		if dir == "" {
+			var err error
+			if dir, err = os.MkdirTemp("", "norn-build-secrets-"); err != nil {
+				return "", nil, fmt.Errorf("build secrets: %w", err)
+			}
+		}
+		path := filepath.Join(dir, s.ID)
+		if err := os.WriteFile(path, []byte(value), 0o600); err != nil {
+			removeDir(dir)
+			return "", nil, fmt.Errorf("build secret %s: %w", s.ID, err)
+		}
+		out = append(out, builder.Secret{ID: s.ID, Src: path})
+	}
+	return dir, out, nil
+}
+
+// sourceTreeFile resolves src inside the checkout at workDir, following
+// symlinks, and refuses a path that ends up outside it: the source tree is
+// the branch's to control, and a link to a host file would otherwise be
+// handed to the build.
+func sourceTreeFile(workDir, src string) (string, error) {
+	root, err := filepath.EvalSymlinks(workDir)
+	if err != nil {
+		return "", err
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(root, src))
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s resolves outside the source tree", src)
+	}
+	return path, nil
+}
+
+func (p *Pipeline) buildSecretValues(spec *model.InfraSpec) (map[string]string, error) {
+	if p.Secrets == nil {
+		return nil, fmt.Errorf("build secrets declared but no secrets manager is configured")
+	}
+	values, err := p.secretsFor(spec).EnvMap(spec.App)
+	if err != nil {
+		return nil, fmt.Errorf("build secrets: %w", err)
+	}
+	return values, nil
+}
+
+func removeDir(dir string) {
+	if dir != "" {
+		_ = os.RemoveAll(dir)
+	}
+}
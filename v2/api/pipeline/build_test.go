@@ -0,0 +1,42 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"norn/v2/api/model"
+)
+
+func TestBuildSecretsRefusesSourceFilesOutsideTheTree(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "id_rsa")
+	if err := os.WriteFile(outside, []byte("host key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".npmrc"), []byte("registry"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "deploy_key")); err != nil {
+		t.Fatal(err)
+	}
+	st := &state{
+		spec:    &model.InfraSpec{App: "web", Build: &model.BuildSpec{}},
+		workDir: dir,
+	}
+
+	st.spec.Build.Secrets = []model.BuildSecret{{ID: "npm", Src: ".npmrc"}}
+	_, secrets, err := (&Pipeline{}).buildSecrets(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != 1 || filepath.Base(secrets[0].Src) != ".npmrc" {
+		t.Fatalf("secrets = %+v", secrets)
+	}
+
+	st.spec.Build.Secrets = []model.BuildSecret{{ID: "ssh", Src: "deploy_key"}}
+	if _, _, err := (&Pipeline{}).buildSecrets(st); err == nil || !strings.Contains(err.Error(), "outside the source tree") {
+		t.Fatalf("err = %v, want a symlink out of the tree refused", err)
+	}
+}
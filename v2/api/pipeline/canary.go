@@ -3,59 +3,340 @@ package pipeline
 import (
 	"context"
 	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"norn/v2/api/hub"
+	"norn/v2/api/model"
+	"norn/v2/api/nomad"
+	"norn/v2/api/prometheus"
 	"norn/v2/api/saga"
 )
 
-// canary evaluates canary allocations after the healthy step passes.
-// It waits for the configured evaluation period, then checks allocation health
-// and either promotes or fails the Nomad deployment.
+var canaryScrapeClient = &http.Client{Timeout: 5 * time.Second}
+
+// canary analyses canary allocations after the healthy step passes. Each
+// configured step waits its pause, then compares the canary cohort's error
+// rate, latency and restarts against the stable cohort over that window.
+// Processes that declare steps have that step's weight of their mesh
+// traffic routed to the canary while it is analysed; the rest split
+// traffic by instance count, and their verdicts carry no weight. Every
+// verdict is written to the saga; a failing step fails the Nomad
+// deployment, and passing all steps promotes it.
 func (p *Pipeline) canary(ctx context.Context, st *state, sg *saga.Saga) error {
 	spec := st.spec
-
-	// Find the evaluate-after duration from the first process with canary config
-	evaluateAfter := 2 * time.Minute
-	for _, proc := range spec.Processes {
-		if proc.Canary != nil && proc.Canary.Count > 0 && proc.Canary.EvaluateAfter != "" {
-			d, err := time.ParseDuration(proc.Canary.EvaluateAfter)
-			if err == nil {
-				evaluateAfter = d
-			}
-			break
-		}
+	procs := canaryProcesses(spec)
+	if len(procs) == 0 {
+		return nil
+	}
+	// Steps come from the first canary process that declares them, which
+	// validation keeps equal to any others; thresholds stay per process.
+	stepsFrom := spec.CanaryStepsProcess()
+	if stepsFrom == "" {
+		stepsFrom = procs[0]
 	}
+	steps := canarySteps(spec.Processes[stepsFrom].Canary)
 
-	sg.Log(ctx, "canary.evaluating", fmt.Sprintf("evaluating canary for %s (waiting %s)", spec.App, evaluateAfter), map[string]string{
-		"evaluateAfter": evaluateAfter.String(),
+	sg.Log(ctx, "canary.evaluating", fmt.Sprintf("evaluating canary for %s over %d step(s)", spec.App, len(steps)), map[string]string{
+		"processes": strings.Join(procs, ","),
+		"steps":     formatCanarySteps(steps),
 	})
 
-	// Wait for the evaluation period or context cancellation
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-time.After(evaluateAfter):
+	split := canarySplitServices(spec, procs)
+	if len(split) > 0 && p.Consul == nil {
+		_ = p.Nomad.FailDeployment(spec.JobID())
+		return fmt.Errorf("consul is not configured; canary steps need it to split traffic")
 	}
+	defer p.clearCanarySplit(ctx, sg, split)
 
-	// Check allocation health after the evaluation period
-	allocs, err := p.Nomad.PollAllocations(spec.App)
+	prev, err := p.sampleCanary(spec, procs)
 	if err != nil {
-		_ = p.Nomad.FailDeployment(spec.App)
+		_ = p.Nomad.FailDeployment(spec.JobID())
 		return fmt.Errorf("canary poll allocations: %w", err)
 	}
 
-	for _, alloc := range allocs {
-		if alloc.Healthy == nil || !*alloc.Healthy {
-			_ = p.Nomad.FailDeployment(spec.App)
-			return fmt.Errorf("canary allocation %s unhealthy (status: %s)", alloc.ID, alloc.ClientStatus)
+	var verdicts []canaryVerdict
+	for i, step := range steps {
+		pause, _ := time.ParseDuration(step.Pause)
+		stepNo := strconv.Itoa(i + 1)
+		for _, service := range split {
+			if err := p.Consul.SplitTraffic(service, step.Weight); err != nil {
+				_ = p.Nomad.FailDeployment(spec.JobID())
+				return fmt.Errorf("canary traffic split: %w", err)
+			}
+		}
+		msg := fmt.Sprintf("canary step %s/%d: analysing for %s", stepNo, len(steps), pause)
+		if len(split) > 0 {
+			msg = fmt.Sprintf("canary step %s/%d: %d%% of mesh traffic to %s, analysing for %s", stepNo, len(steps), step.Weight, strings.Join(split, ","), pause)
+		}
+		meta := map[string]string{"step": stepNo, "pause": pause.String()}
+		payload := map[string]string{"step": stepNo, "total": strconv.Itoa(len(steps))}
+		if len(split) > 0 {
+			meta["weight"] = strconv.Itoa(step.Weight)
+			meta["services"] = strings.Join(split, ",")
+			payload["weight"] = meta["weight"]
+		}
+		sg.Log(ctx, "canary.step", msg, meta)
+		p.WS.Broadcast(hub.Event{Type: "canary.step", AppID: spec.App, Payload: payload})
+
+		windowStart := time.Now()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pause):
 		}
+
+		cur, err := p.sampleCanary(spec, procs)
+		if err != nil {
+			_ = p.Nomad.FailDeployment(spec.JobID())
+			return fmt.Errorf("canary poll allocations: %w", err)
+		}
+		access := p.canaryAccessEvidence(ctx, spec.App, windowStart)
+
+		verdicts = verdicts[:0]
+		var failed []canaryVerdict
+		for _, name := range procs {
+			cfg := spec.Processes[name].Canary
+			canaryStats, stableStats := canaryWindow(prev[name], cur[name])
+			prom := canaryPrometheusEvidence(ctx, p.Prometheus, spec.App, name, cfg, windowStart)
+			v := analyzeCanary(cfg, canaryStats, stableStats, prom, access)
+			v.Process = name
+			v.Step = i + 1
+			if splitsTraffic(spec.Processes[name]) {
+				v.Weight = step.Weight
+			}
+			sg.Log(ctx, "canary.analysis", v.Summary(), v.Metadata())
+			verdicts = append(verdicts, v)
+			if v.Verdict == canaryFail || (v.Verdict == canaryInconclusive && cfg.FailOnInconclusive) {
+				failed = append(failed, v)
+			}
+		}
+
+		if len(failed) > 0 {
+			_ = p.Nomad.FailDeployment(spec.JobID())
+			reasons := make([]string, 0, len(failed))
+			for _, v := range failed {
+				reasons = append(reasons, fmt.Sprintf("%s: %s", v.Process, strings.Join(v.Reasons, "; ")))
+			}
+			meta := failed[0].Metadata()
+			meta["verdict"] = canaryFail
+			sg.Log(ctx, "canary.failed", fmt.Sprintf("canary failed for %s at step %d: %s", spec.App, i+1, strings.Join(reasons, " | ")), meta)
+			return fmt.Errorf("canary analysis failed at step %d: %s", i+1, strings.Join(reasons, " | "))
+		}
+		prev = cur
 	}
 
-	// All canary allocations healthy — promote
-	if err := p.Nomad.PromoteDeployment(spec.App); err != nil {
+	if err := p.Nomad.PromoteDeployment(spec.JobID()); err != nil {
 		return fmt.Errorf("canary promote: %w", err)
 	}
 
-	sg.Log(ctx, "canary.promoted", fmt.Sprintf("canary promoted for %s", spec.App), nil)
+	meta := map[string]string{"verdict": canaryPass}
+	if len(verdicts) > 0 {
+		meta = verdicts[0].Metadata()
+	}
+	sg.Log(ctx, "canary.promoted", fmt.Sprintf("canary promoted for %s after %d step(s)", spec.App, len(steps)), meta)
 	return nil
 }
+
+// canaryProcesses returns the names of processes with canaries, sorted.
+func canaryProcesses(spec *model.InfraSpec) []string {
+	var names []string
+	for name, proc := range spec.Processes {
+		if proc.Canary != nil && proc.Canary.Count > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// canarySplitServices returns the Consul services of the canary processes
+// that declare steps, whose mesh traffic each step splits.
+func canarySplitServices(spec *model.InfraSpec, procs []string) []string {
+	var out []string
+	for _, name := range procs {
+		if splitsTraffic(spec.Processes[name]) {
+			out = append(out, model.ServiceName(spec.JobID(), name))
+		}
+	}
+	return out
+}
+
+// splitsTraffic reports whether the canary steps weight proc's traffic.
+// Without mesh there is no splitter, and traffic follows instance counts.
+func splitsTraffic(proc model.Process) bool {
+	return proc.Canary != nil && len(proc.Canary.Steps) > 0 && proc.Mesh != nil
+}
+
+// clearCanarySplit hands the split services' traffic back to Consul's
+// normal balancing once the canary is promoted or failed.
+func (p *Pipeline) clearCanarySplit(ctx context.Context, sg *saga.Saga, services []string) {
+	for _, service := range services {
+		if err := p.Consul.ClearSplit(service); err != nil {
+			sg.Log(ctx, "canary.split_failed", fmt.Sprintf("clearing the traffic split for %s failed: %v", service, err), map[string]string{"service": service})
+		}
+	}
+}
+
+// canarySteps returns the configured steps with pauses resolved, or a single
+// full-window step without a weight when none are declared.
+func canarySteps(cfg *model.CanaryConfig) []model.CanaryStep {
+	window := 2 * time.Minute
+	if d, err := time.ParseDuration(cfg.EvaluateAfter); err == nil && d > 0 {
+		window = d
+	}
+	if len(cfg.Steps) == 0 {
+		return []model.CanaryStep{{Pause: window.String()}}
+	}
+	steps := make([]model.CanaryStep, 0, len(cfg.Steps))
+	for _, step := range cfg.Steps {
+		if d, err := time.ParseDuration(step.Pause); err != nil || d <= 0 {
+			step.Pause = window.String()
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+func formatCanarySteps(steps []model.CanaryStep) string {
+	parts := make([]string, 0, len(steps))
+	for _, step := range steps {
+		if step.Weight == 0 {
+			parts = append(parts, step.Pause)
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%d%%/%s", step.Weight, step.Pause))
+	}
+	return strings.Join(parts, ",")
+}
+
+// sampleCanary snapshots every running allocation of the canary processes:
+// health, restarts and, when metrics are enabled, the scraped request totals.
+func (p *Pipeline) sampleCanary(spec *model.InfraSpec, procs []string) (map[string]*canarySample, error) {
+	allocs, err := p.Nomad.DeploymentAllocations(spec.JobID())
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]*canarySample, len(procs))
+	for _, name := range procs {
+		out[name] = &canarySample{allocs: map[string]allocSample{}}
+	}
+	for _, alloc := range allocs {
+		sample, ok := out[alloc.TaskGroup]
+		if !ok {
+			continue
+		}
+		proc := spec.Processes[alloc.TaskGroup]
+		as := allocSample{
+			canary:   alloc.Canary,
+			healthy:  alloc.Healthy != nil && *alloc.Healthy,
+			restarts: alloc.Restarts,
+		}
+		if proc.Metrics != nil && proc.Metrics.Enabled {
+			if addr := alloc.Ports[nomad.MetricsPortLabel(alloc.TaskGroup, proc)]; addr != "" {
+				totals, err := scrapeCanaryMetrics("http://"+addr+proc.Metrics.Path, proc.Canary)
+				if err == nil {
+					as.metrics = &totals
+				}
+			}
+		}
+		sample.allocs[alloc.ID] = as
+	}
+	return out, nil
+}
+
+func scrapeCanaryMetrics(url string, cfg *model.CanaryConfig) (metricTotals, error) {
+	resp, err := canaryScrapeClient.Get(url)
+	if err != nil {
+		return metricTotals{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return metricTotals{}, fmt.Errorf("scrape %s: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return metricTotals{}, err
+	}
+	return parseMetricTotals(string(body), cfg.RequestMetric, cfg.LatencyMetric), nil
+}
+
+// canaryAccessEvidence compares the app-wide 5xx rate since the window
+// started with the preceding 24h from the access-pattern buckets. Traffic is
+// not split by allocation, so it backs up the scraped metrics rather than
+// replacing them.
+func (p *Pipeline) canaryAccessEvidence(ctx context.Context, app string, since time.Time) accessEvidence {
+	if p.DB == nil {
+		return accessEvidence{}
+	}
+	now := time.Now()
+	requests, errors, err := p.DB.AccessStatusTotals(ctx, app, since, now)
+	if err != nil {
+		return accessEvidence{}
+	}
+	baseRequests, baseErrors, err := p.DB.AccessStatusTotals(ctx, app, since.Add(-24*time.Hour), since.Truncate(time.Hour))
+	if err != nil {
+		return accessEvidence{}
+	}
+	return accessEvidence{
+		Available:        true,
+		Requests:         requests,
+		ServerErrors:     errors,
+		BaselineRequests: baseRequests,
+		BaselineErrors:   baseErrors,
+	}
+}
+
+// canaryPrometheusEvidence reads the process's request counter and latency
+// histogram from Prometheus, as scraped with app and process labels, for
+// the window since start and for the 24h before it.
+func canaryPrometheusEvidence(ctx context.Context, q *prometheus.Client, app, process string, cfg *model.CanaryConfig, start time.Time) prometheusEvidence {
+	if q == nil {
+		return prometheusEvidence{Reason: "prometheus is not configured"}
+	}
+	window := prometheus.Duration(max(time.Since(start).Round(time.Second), time.Minute))
+	labels := map[string]string{"app": app, "process": process}
+	requestSeries := prometheus.Selector(cfg.RequestMetric, labels)
+	// 5xx responses, by whichever status label the app uses.
+	var errorSeries []string
+	for _, label := range []string{"code", "status", "status_code"} {
+		errorSeries = append(errorSeries, strings.TrimSuffix(requestSeries, "}")+","+label+`=~"5.."}`)
+	}
+	buckets := prometheus.Selector(cfg.LatencyMetric+"_bucket", labels)
+	latencyUnit := 1000.0
+	if strings.HasSuffix(cfg.LatencyMetric, "_milliseconds") || strings.HasSuffix(cfg.LatencyMetric, "_ms") {
+		latencyUnit = 1
+	}
+
+	var ev prometheusEvidence
+	value := func(expr string) float64 {
+		if ev.Reason != "" {
+			return 0
+		}
+		v, _, err := q.Value(ctx, expr)
+		if err != nil {
+			ev.Reason = err.Error()
+		}
+		return v
+	}
+	measure := func(rng string) (requests, errorRate, p95Ms float64) {
+		requests = value("sum(increase(" + requestSeries + rng + "))")
+		parts := make([]string, len(errorSeries))
+		for i, series := range errorSeries {
+			parts[i] = "increase(" + series + rng + ")"
+		}
+		if errors := value("sum(" + strings.Join(parts, " or ") + ")"); requests > 0 {
+			errorRate = errors / requests
+		}
+		p95Ms = value("histogram_quantile(0.95, sum by (le) (rate("+buckets+rng+")))") * latencyUnit
+		return
+	}
+	ev.Requests, ev.ErrorRate, ev.P95Ms = measure("[" + window + "]")
+	_, ev.BaselineErrorRate, ev.BaselineP95Ms = measure("[24h] offset " + window)
+	ev.Available = ev.Reason == ""
+	return ev
+}
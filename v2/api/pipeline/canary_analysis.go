@@ -0,0 +1,370 @@
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"norn/v2/api/model"
+)
+
+const (
+	canaryPass         = "pass"
+	canaryFail         = "fail"
+	canaryInconclusive = "inconclusive"
+)
+
+// metricTotals are the cumulative request counters scraped from one allocation.
+type metricTotals struct {
+	Requests     float64
+	Errors       float64
+	LatencySum   float64
+	LatencyCount float64
+	LatencyUnit  float64 // multiplier converting LatencySum to milliseconds
+}
+
+type allocSample struct {
+	canary   bool
+	healthy  bool
+	restarts uint64
+	metrics  *metricTotals
+}
+
+type canarySample struct {
+	allocs map[string]allocSample
+}
+
+// cohortStats aggregates one cohort (canary or stable) over an analysis window.
+type cohortStats struct {
+	Allocs       int
+	Unhealthy    int
+	Restarts     uint64
+	Scraped      int
+	Requests     float64
+	Errors       float64
+	LatencySumMs float64
+	LatencyCount float64
+}
+
+func (c cohortStats) errorRate() float64 {
+	if c.Requests <= 0 {
+		return 0
+	}
+	return c.Errors / c.Requests
+}
+
+func (c cohortStats) meanLatencyMs() float64 {
+	if c.LatencyCount <= 0 {
+		return 0
+	}
+	return c.LatencySumMs / c.LatencyCount
+}
+
+type accessEvidence struct {
+	Available        bool
+	Requests         int64
+	ServerErrors     int64
+	BaselineRequests int64
+	BaselineErrors   int64
+}
+
+func (a accessEvidence) errorRate() float64 {
+	if a.Requests <= 0 {
+		return 0
+	}
+	return float64(a.ServerErrors) / float64(a.Requests)
+}
+
+func (a accessEvidence) baselineErrorRate() float64 {
+	if a.BaselineRequests <= 0 {
+		return 0
+	}
+	return float64(a.BaselineErrors) / float64(a.BaselineRequests)
+}
+
+// prometheusEvidence is the process's request series in Prometheus over the
+// window and the 24h before it. Canary and stable allocations share the
+// series, so like access patterns it compares the process with its past.
+type prometheusEvidence struct {
+	Available         bool
+	Reason            string
+	Requests          float64
+	ErrorRate         float64
+	BaselineErrorRate float64
+	P95Ms             float64
+	BaselineP95Ms     float64
+}
+
+// canaryVerdict is the outcome of analysing one process for one step.
+type canaryVerdict struct {
+	Process    string
+	Step       int
+	Weight     int
+	Verdict    string
+	Reasons    []string
+	Canary     cohortStats
+	Stable     cohortStats
+	Prometheus prometheusEvidence
+	Access     accessEvidence
+}
+
+func (v canaryVerdict) Summary() string {
+	msg := fmt.Sprintf("canary %s step %d: %s (canary %d req, %.2f%% errors, %.0fms; stable %d req, %.2f%% errors, %.0fms)",
+		v.Process, v.Step, v.Verdict,
+		int64(v.Canary.Requests), v.Canary.errorRate()*100, v.Canary.meanLatencyMs(),
+		int64(v.Stable.Requests), v.Stable.errorRate()*100, v.Stable.meanLatencyMs())
+	if len(v.Reasons) > 0 {
+		msg += ": " + strings.Join(v.Reasons, "; ")
+	}
+	return msg
+}
+
+// Metadata flattens the verdict and its evidence for the saga.
+func (v canaryVerdict) Metadata() map[string]string {
+	meta := map[string]string{
+		"process":                 v.Process,
+		"step":                    strconv.Itoa(v.Step),
+		"verdict":                 v.Verdict,
+		"canaryAllocs":            strconv.Itoa(v.Canary.Allocs),
+		"canaryRequests":          formatFloat(v.Canary.Requests, 0),
+		"canaryErrorRate":         formatFloat(v.Canary.errorRate(), 4),
+		"canaryLatencyMs":         formatFloat(v.Canary.meanLatencyMs(), 1),
+		"canaryRestarts":          strconv.FormatUint(v.Canary.Restarts, 10),
+		"stableAllocs":            strconv.Itoa(v.Stable.Allocs),
+		"stableRequests":          formatFloat(v.Stable.Requests, 0),
+		"stableErrorRate":         formatFloat(v.Stable.errorRate(), 4),
+		"stableLatencyMs":         formatFloat(v.Stable.meanLatencyMs(), 1),
+		"stableRestarts":          strconv.FormatUint(v.Stable.Restarts, 10),
+		"metricsScraped":          fmt.Sprintf("%d/%d", v.Canary.Scraped+v.Stable.Scraped, v.Canary.Allocs+v.Stable.Allocs),
+		"prometheusAvailable":     strconv.FormatBool(v.Prometheus.Available),
+		"prometheusRequests":      formatFloat(v.Prometheus.Requests, 0),
+		"prometheusErrorRate":     formatFloat(v.Prometheus.ErrorRate, 4),
+		"prometheusBaseline":      formatFloat(v.Prometheus.BaselineErrorRate, 4),
+		"prometheusP95Ms":         formatFloat(v.Prometheus.P95Ms, 1),
+		"prometheusBaselineP95Ms": formatFloat(v.Prometheus.BaselineP95Ms, 1),
+		"accessAvailable":         strconv.FormatBool(v.Access.Available),
+		"accessRequests":          strconv.FormatInt(v.Access.Requests, 10),
+		"accessErrorRate":         formatFloat(v.Access.errorRate(), 4),
+		"accessBaseline":          formatFloat(v.Access.baselineErrorRate(), 4),
+		"reasons":                 strings.Join(v.Reasons, "; "),
+	}
+	if v.Weight > 0 {
+		meta["weight"] = strconv.Itoa(v.Weight)
+	}
+	if v.Prometheus.Reason != "" {
+		meta["prometheusReason"] = v.Prometheus.Reason
+	}
+	return meta
+}
+
+func formatFloat(f float64, prec int) string {
+	return strconv.FormatFloat(f, 'f', prec, 64)
+}
+
+// canaryWindow splits the allocations into canary and stable cohorts and
+// computes counter deltas between two samples. Allocations without a
+// previous scrape contribute health and restarts but no traffic.
+func canaryWindow(prev, cur *canarySample) (canary, stable cohortStats) {
+	if cur == nil {
+		return
+	}
+	for id, a := range cur.allocs {
+		target := &stable
+		if a.canary {
+			target = &canary
+		}
+		target.Allocs++
+		if !a.healthy {
+			target.Unhealthy++
+		}
+		var before *allocSample
+		if prev != nil {
+			if p, ok := prev.allocs[id]; ok {
+				before = &p
+			}
+		}
+		if before != nil && a.restarts >= before.restarts {
+			target.Restarts += a.restarts - before.restarts
+		} else {
+			target.Restarts += a.restarts
+		}
+		if a.metrics == nil || before == nil || before.metrics == nil {
+			continue
+		}
+		target.Scraped++
+		target.Requests += counterDelta(before.metrics.Requests, a.metrics.Requests)
+		target.Errors += counterDelta(before.metrics.Errors, a.metrics.Errors)
+		target.LatencySumMs += counterDelta(before.metrics.LatencySum, a.metrics.LatencySum) * a.metrics.LatencyUnit
+		target.LatencyCount += counterDelta(before.metrics.LatencyCount, a.metrics.LatencyCount)
+	}
+	return
+}
+
+// counterDelta handles counter resets (e.g. a task restart) by treating the
+// current value as the whole increase.
+func counterDelta(before, after float64) float64 {
+	if after < before {
+		return after
+	}
+	return after - before
+}
+
+// analyzeCanary judges one cohort pair against the process's thresholds.
+func analyzeCanary(cfg *model.CanaryConfig, canary, stable cohortStats, prom prometheusEvidence, access accessEvidence) canaryVerdict {
+	v := canaryVerdict{Verdict: canaryPass, Canary: canary, Stable: stable, Prometheus: prom, Access: access}
+	fail := func(format string, args ...interface{}) {
+		v.Verdict = canaryFail
+		v.Reasons = append(v.Reasons, fmt.Sprintf(format, args...))
+	}
+
+	if canary.Allocs == 0 {
+		fail("no canary allocations running")
+		return v
+	}
+	if canary.Unhealthy > 0 {
+		fail("%d canary allocation(s) unhealthy", canary.Unhealthy)
+	}
+	if int(canary.Restarts) > cfg.MaxRestarts {
+		fail("canary restarted %d time(s), max %d", canary.Restarts, cfg.MaxRestarts)
+	}
+
+	if canary.Scraped > 0 && int64(canary.Requests) >= cfg.MinRequests {
+		if rate := canary.errorRate(); rate > cfg.MaxErrorRate {
+			fail("canary error rate %.2f%% above %.2f%%", rate*100, cfg.MaxErrorRate*100)
+		}
+		if int64(stable.Requests) >= cfg.MinRequests {
+			if delta := canary.errorRate() - stable.errorRate(); delta > cfg.MaxErrorRateIncrease {
+				fail("canary error rate %.2f%% exceeds stable %.2f%% by more than %.2f%%", canary.errorRate()*100, stable.errorRate()*100, cfg.MaxErrorRateIncrease*100)
+			}
+			if canaryMs, stableMs := canary.meanLatencyMs(), stable.meanLatencyMs(); canaryMs > 0 && stableMs > 0 && canaryMs/stableMs > cfg.MaxLatencyRatio {
+				fail("canary latency %.0fms is %.1fx stable %.0fms (max %.1fx)", canaryMs, canaryMs/stableMs, stableMs, cfg.MaxLatencyRatio)
+			}
+		}
+		return v
+	}
+
+	// Without enough scraped canary traffic, fall back to the process's
+	// series in Prometheus, then to the app-wide access-pattern buckets.
+	// Both include canary requests, so they are judged against their past.
+	if prom.Available && int64(prom.Requests) >= cfg.MinRequests {
+		if delta := prom.ErrorRate - prom.BaselineErrorRate; delta > cfg.MaxErrorRateIncrease {
+			fail("process 5xx rate %.2f%% exceeds 24h baseline %.2f%% by more than %.2f%%", prom.ErrorRate*100, prom.BaselineErrorRate*100, cfg.MaxErrorRateIncrease*100)
+		}
+		if prom.P95Ms > 0 && prom.BaselineP95Ms > 0 && prom.P95Ms/prom.BaselineP95Ms > cfg.MaxLatencyRatio {
+			fail("process p95 latency %.0fms is %.1fx 24h baseline %.0fms (max %.1fx)", prom.P95Ms, prom.P95Ms/prom.BaselineP95Ms, prom.BaselineP95Ms, cfg.MaxLatencyRatio)
+		}
+		return v
+	}
+	if access.Available && access.Requests >= cfg.MinRequests {
+		if delta := access.errorRate() - access.baselineErrorRate(); delta > cfg.MaxErrorRateIncrease {
+			fail("app 5xx rate %.2f%% exceeds 24h baseline %.2f%% by more than %.2f%%", access.errorRate()*100, access.baselineErrorRate()*100, cfg.MaxErrorRateIncrease*100)
+		}
+		return v
+	}
+
+	if v.Verdict == canaryPass {
+		v.Verdict = canaryInconclusive
+		v.Reasons = append(v.Reasons, fmt.Sprintf("fewer than %d requests observed; judged on health and restarts only", cfg.MinRequests))
+	}
+	return v
+}
+
+// parseMetricTotals reads Prometheus text exposition and sums the request
+// counter (5xx by code/status label) and the latency histogram sum/count.
+func parseMetricTotals(body, requestMetric, latencyMetric string) metricTotals {
+	totals := metricTotals{LatencyUnit: 1000}
+	if strings.HasSuffix(latencyMetric, "_milliseconds") || strings.HasSuffix(latencyMetric, "_ms") {
+		totals.LatencyUnit = 1
+	}
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, labels, value, ok := parsePromLine(line)
+		if !ok {
+			continue
+		}
+		switch name {
+		case requestMetric:
+			totals.Requests += value
+			if isServerErrorLabel(labels) {
+				totals.Errors += value
+			}
+		case latencyMetric + "_sum":
+			totals.LatencySum += value
+		case latencyMetric + "_count":
+			totals.LatencyCount += value
+		}
+	}
+	return totals
+}
+
+func parsePromLine(line string) (string, map[string]string, float64, bool) {
+	var name, rest string
+	labels := map[string]string{}
+	if open := strings.IndexByte(line, '{'); open >= 0 {
+		closeIdx := strings.LastIndexByte(line, '}')
+		if closeIdx < open {
+			return "", nil, 0, false
+		}
+		name = line[:open]
+		labels = parsePromLabels(line[open+1 : closeIdx])
+		rest = line[closeIdx+1:]
+	} else {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return "", nil, 0, false
+		}
+		name = fields[0]
+		rest = strings.Join(fields[1:], " ")
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return "", nil, 0, false
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return "", nil, 0, false
+	}
+	return strings.TrimSpace(name), labels, value, true
+}
+
+func parsePromLabels(raw string) map[string]string {
+	labels := map[string]string{}
+	for len(raw) > 0 {
+		eq := strings.IndexByte(raw, '=')
+		if eq < 0 || eq+1 >= len(raw) || raw[eq+1] != '"' {
+			break
+		}
+		key := strings.TrimSpace(strings.TrimLeft(raw[:eq], ", "))
+		var b strings.Builder
+		i := eq + 2
+		for ; i < len(raw); i++ {
+			if raw[i] == '\\' && i+1 < len(raw) {
+				i++
+				b.WriteByte(raw[i])
+				continue
+			}
+			if raw[i] == '"' {
+				break
+			}
+			b.WriteByte(raw[i])
+		}
+		labels[key] = b.String()
+		if i+1 >= len(raw) {
+			break
+		}
+		raw = raw[i+1:]
+	}
+	return labels
+}
+
+func isServerErrorLabel(labels map[string]string) bool {
+	for _, key := range []string{"code", "status", "status_code"} {
+		if v := labels[key]; strings.HasPrefix(v, "5") {
+			return true
+		}
+	}
+	return false
+}
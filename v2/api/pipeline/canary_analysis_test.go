@@ -0,0 +1,172 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"norn/v2/api/model"
+	"norn/v2/api/prometheus"
+)
+
+func testCanaryConfig() *model.CanaryConfig {
+	return &model.CanaryConfig{
+		Count:                1,
+		MaxErrorRate:         0.05,
+		MaxErrorRateIncrease: 0.02,
+		MaxLatencyRatio:      1.5,
+		MinRequests:          20,
+		RequestMetric:        "http_requests_total",
+		LatencyMetric:        "http_request_duration_seconds",
+	}
+}
+
+func TestParseMetricTotalsCountsServerErrorsAndLatency(t *testing.T) {
+	body := `# HELP http_requests_total Requests.
+# TYPE http_requests_total counter
+http_requests_total{code="200",path="/"} 90
+http_requests_total{code="503",path="/"} 6
+http_requests_total{status="500"} 4
+http_request_duration_seconds_bucket{le="0.1"} 80
+http_request_duration_seconds_sum 5
+http_request_duration_seconds_count 100
+`
+	totals := parseMetricTotals(body, "http_requests_total", "http_request_duration_seconds")
+	if totals.Requests != 100 || totals.Errors != 10 {
+		t.Fatalf("requests/errors = %v/%v, want 100/10", totals.Requests, totals.Errors)
+	}
+	if totals.LatencySum != 5 || totals.LatencyCount != 100 || totals.LatencyUnit != 1000 {
+		t.Fatalf("latency = %+v", totals)
+	}
+}
+
+func TestCanaryWindowUsesCounterDeltas(t *testing.T) {
+	prev := &canarySample{allocs: map[string]allocSample{
+		"canary01": {canary: true, healthy: true, metrics: &metricTotals{Requests: 100, Errors: 1, LatencySum: 1, LatencyCount: 100, LatencyUnit: 1000}},
+		"stable01": {healthy: true, restarts: 2, metrics: &metricTotals{Requests: 1000, LatencySum: 10, LatencyCount: 1000, LatencyUnit: 1000}},
+	}}
+	cur := &canarySample{allocs: map[string]allocSample{
+		"canary01": {canary: true, healthy: true, restarts: 1, metrics: &metricTotals{Requests: 150, Errors: 11, LatencySum: 2, LatencyCount: 150, LatencyUnit: 1000}},
+		"stable01": {healthy: true, restarts: 2, metrics: &metricTotals{Requests: 1100, LatencySum: 11, LatencyCount: 1100, LatencyUnit: 1000}},
+	}}
+
+	canary, stable := canaryWindow(prev, cur)
+	if canary.Requests != 50 || canary.Errors != 10 || canary.Restarts != 1 {
+		t.Fatalf("canary = %+v", canary)
+	}
+	if canary.meanLatencyMs() != 20 {
+		t.Fatalf("canary latency = %v, want 20ms", canary.meanLatencyMs())
+	}
+	if stable.Requests != 100 || stable.Restarts != 0 || stable.meanLatencyMs() != 10 {
+		t.Fatalf("stable = %+v", stable)
+	}
+}
+
+func TestAnalyzeCanaryFailsOnErrorRateAndLatency(t *testing.T) {
+	canary := cohortStats{Allocs: 1, Scraped: 1, Requests: 100, Errors: 10, LatencySumMs: 4000, LatencyCount: 100}
+	stable := cohortStats{Allocs: 2, Scraped: 2, Requests: 400, Errors: 4, LatencySumMs: 8000, LatencyCount: 400}
+
+	v := analyzeCanary(testCanaryConfig(), canary, stable, prometheusEvidence{}, accessEvidence{})
+	if v.Verdict != canaryFail {
+		t.Fatalf("verdict = %s, want fail", v.Verdict)
+	}
+	reasons := strings.Join(v.Reasons, "; ")
+	for _, want := range []string{"above 5.00%", "exceeds stable", "latency 40ms is 2.0x"} {
+		if !strings.Contains(reasons, want) {
+			t.Fatalf("reasons %q missing %q", reasons, want)
+		}
+	}
+	if v.Metadata()["canaryErrorRate"] != "0.1000" {
+		t.Fatalf("metadata = %#v", v.Metadata())
+	}
+}
+
+func TestAnalyzeCanaryPassesHealthyCanary(t *testing.T) {
+	canary := cohortStats{Allocs: 1, Scraped: 1, Requests: 100, Errors: 1, LatencySumMs: 2100, LatencyCount: 100}
+	stable := cohortStats{Allocs: 2, Scraped: 2, Requests: 400, Errors: 4, LatencySumMs: 8000, LatencyCount: 400}
+
+	v := analyzeCanary(testCanaryConfig(), canary, stable, prometheusEvidence{}, accessEvidence{})
+	if v.Verdict != canaryPass {
+		t.Fatalf("verdict = %s (%v), want pass", v.Verdict, v.Reasons)
+	}
+}
+
+func TestAnalyzeCanaryFallsBackToAccessPatterns(t *testing.T) {
+	canary := cohortStats{Allocs: 1}
+	access := accessEvidence{Available: true, Requests: 200, ServerErrors: 20, BaselineRequests: 10000, BaselineErrors: 100}
+
+	v := analyzeCanary(testCanaryConfig(), canary, cohortStats{}, prometheusEvidence{}, access)
+	if v.Verdict != canaryFail || !strings.Contains(v.Reasons[0], "24h baseline") {
+		t.Fatalf("verdict = %s %v, want access-pattern failure", v.Verdict, v.Reasons)
+	}
+
+	v = analyzeCanary(testCanaryConfig(), canary, cohortStats{}, prometheusEvidence{}, accessEvidence{})
+	if v.Verdict != canaryInconclusive {
+		t.Fatalf("verdict = %s, want inconclusive without traffic", v.Verdict)
+	}
+}
+
+func TestAnalyzeCanaryUsesPrometheusBeforeAccessPatterns(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("query")
+		value := "0"
+		baseline := strings.Contains(q, "offset")
+		switch {
+		case strings.HasPrefix(q, "histogram_quantile") && baseline:
+			value = "0.1"
+		case strings.HasPrefix(q, "histogram_quantile"):
+			value = "0.25"
+		case strings.Contains(q, `=~"5.."`) && baseline:
+			value = "10"
+		case strings.Contains(q, `=~"5.."`):
+			value = "2"
+		case strings.HasPrefix(q, `sum(increase(http_requests_total{app="web",process="api"}`) && baseline:
+			value = "10000"
+		case strings.HasPrefix(q, `sum(increase(http_requests_total{app="web",process="api"}`):
+			value = "200"
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1760600000,%q]}]}}`, value)
+	}))
+	defer srv.Close()
+	cfg := testCanaryConfig()
+	cfg.RequestMetric, cfg.LatencyMetric = "http_requests_total", "http_request_duration_seconds"
+
+	prom := canaryPrometheusEvidence(context.Background(), prometheus.New(srv.URL), "web", "api", cfg, time.Now().Add(-2*time.Minute))
+	if !prom.Available || prom.Requests != 200 || prom.ErrorRate != 0.01 || prom.BaselineErrorRate != 0.001 || prom.P95Ms != 250 || prom.BaselineP95Ms != 100 {
+		t.Fatalf("evidence = %+v", prom)
+	}
+	access := accessEvidence{Available: true, Requests: 200, BaselineRequests: 10000}
+	v := analyzeCanary(cfg, cohortStats{Allocs: 1}, cohortStats{}, prom, access)
+	if v.Verdict != canaryFail || len(v.Reasons) != 1 || !strings.Contains(v.Reasons[0], "p95 latency 250ms is 2.5x") {
+		t.Fatalf("verdict = %s %v, want a prometheus latency failure", v.Verdict, v.Reasons)
+	}
+	if meta := v.Metadata(); meta["prometheusAvailable"] != "true" || meta["prometheusP95Ms"] != "250.0" {
+		t.Fatalf("metadata = %v", meta)
+	}
+
+	srv.Close()
+	prom = canaryPrometheusEvidence(context.Background(), prometheus.New(srv.URL), "web", "api", cfg, time.Now())
+	if prom.Available || !strings.HasPrefix(prom.Reason, "prometheus unavailable:") {
+		t.Fatalf("evidence with prometheus down = %+v", prom)
+	}
+	v = analyzeCanary(cfg, cohortStats{Allocs: 1}, cohortStats{}, prom, access)
+	if v.Verdict != canaryPass || v.Metadata()["prometheusReason"] == "" {
+		t.Fatalf("verdict = %s %v, want access patterns to pass it", v.Verdict, v.Reasons)
+	}
+}
+
+func TestAnalyzeCanaryFailsOnRestartsAndMissingCanary(t *testing.T) {
+	v := analyzeCanary(testCanaryConfig(), cohortStats{Allocs: 1, Restarts: 2}, cohortStats{}, prometheusEvidence{}, accessEvidence{})
+	if v.Verdict != canaryFail || !strings.Contains(v.Reasons[0], "restarted 2") {
+		t.Fatalf("verdict = %s %v", v.Verdict, v.Reasons)
+	}
+
+	v = analyzeCanary(testCanaryConfig(), cohortStats{}, cohortStats{Allocs: 2}, prometheusEvidence{}, accessEvidence{})
+	if v.Verdict != canaryFail {
+		t.Fatalf("verdict = %s, want fail without canary allocations", v.Verdict)
+	}
+}
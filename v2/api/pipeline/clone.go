@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"norn/v2/api/model"
 	"norn/v2/api/saga"
 )
 
@@ -96,6 +97,51 @@ func (p *Pipeline) checkoutRequestedRef(ctx context.Context, workDir, ref, repoU
 	return nil
 }
 
+// checkoutCommit puts the source of sha in a new temp dir and returns it;
+// the caller removes it. Apps without a repo are copied from AppsDir, but
+// only while that tree is still at sha.
+func (p *Pipeline) checkoutCommit(ctx context.Context, spec *model.InfraSpec, sha string) (string, error) {
+	if sha == "" {
+		return "", fmt.Errorf("no commit recorded")
+	}
+	workDir, err := os.MkdirTemp("", "norn-checkout-*")
+	if err != nil {
+		return "", fmt.Errorf("create temp dir: %w", err)
+	}
+
+	if spec.Repo != nil {
+		cmd := exec.CommandContext(ctx, "git", "clone", "--depth", "1", "--branch", spec.Repo.Branch, spec.Repo.URL, workDir)
+		gitEnv, cleanup := p.gitEnv(spec.Repo.URL)
+		if cleanup != nil {
+			defer cleanup()
+		}
+		cmd.Env = append(os.Environ(), gitEnv...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			os.RemoveAll(workDir)
+			return "", fmt.Errorf("git clone: %s", string(out))
+		}
+		if err := p.checkoutRequestedRef(ctx, workDir, sha, spec.Repo.URL); err != nil {
+			os.RemoveAll(workDir)
+			return "", err
+		}
+		return workDir, nil
+	}
+
+	srcDir := filepath.Join(p.AppsDir, spec.App)
+	if !strings.HasPrefix(sha, "local-") {
+		head, err := exec.CommandContext(ctx, "git", "-C", srcDir, "rev-parse", "HEAD").Output()
+		if err != nil || strings.TrimSpace(string(head)) != sha {
+			os.RemoveAll(workDir)
+			return "", fmt.Errorf("%s is no longer at %s", srcDir, sha)
+		}
+	}
+	if out, err := exec.CommandContext(ctx, "cp", "-a", srcDir+"/.", workDir).CombinedOutput(); err != nil {
+		os.RemoveAll(workDir)
+		return "", fmt.Errorf("copy source: %s", string(out))
+	}
+	return workDir, nil
+}
+
 func (p *Pipeline) resolveLocalSHA(ctx context.Context, srcDir string, st *state) {
 	revCmd := exec.CommandContext(ctx, "git", "-C", srcDir, "rev-parse", "HEAD")
 	if shaOut, err := revCmd.Output(); err == nil {
@@ -0,0 +1,260 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	"norn/v2/api/model"
+	"norn/v2/api/redpanda"
+	"norn/v2/api/storage"
+)
+
+// credentialRotator issues and revokes one backing service's credentials
+// for an app. issue is called again with the same stamp when a rotation
+// resumes, so it must return the same credential with a usable secret.
+type credentialRotator interface {
+	// current returns the ID of the credential the app's secrets hold, or "".
+	current(values map[string]string) string
+	// issue creates the credential for stamp and returns its ID and the
+	// secrets that point the app at it.
+	issue(ctx context.Context, spec *model.InfraSpec, old, stamp string, values map[string]string) (string, map[string]string, error)
+	// revoke deletes the credential with id when a rotation of this app
+	// environment issued it. It reports false when the credential was left
+	// in place because Norn does not own it.
+	revoke(ctx context.Context, spec *model.InfraSpec, id string) (bool, error)
+}
+
+func (p *Pipeline) credentialRotator(service string) (credentialRotator, error) {
+	switch service {
+	case model.CredentialPostgres:
+		return postgresRotator{}, nil
+	case model.CredentialObjectStorage:
+		if !p.Storage.ManagesKeys() {
+			return nil, fmt.Errorf("object storage keys can only be rotated with NORN_GARAGE_ADMIN_ENDPOINT and NORN_GARAGE_ADMIN_TOKEN set")
+		}
+		return garageRotator{storage: p.Storage}, nil
+	case model.CredentialKafka:
+		if p.Redpanda == nil {
+			return nil, fmt.Errorf("kafka credentials need NORN_REDPANDA_BROKERS")
+		}
+		return redpandaRotator{redpanda: p.Redpanda}, nil
+	}
+	return nil, fmt.Errorf("unknown credential service %q", service)
+}
+
+// credentialName names a rotated credential after base and the rotation
+// stamp, e.g. web_r20261016093000.
+func credentialName(base, sep, stamp string) string {
+	return base + sep + "r" + stamp
+}
+
+var rotatedSuffixRe = regexp.MustCompile(`[_-]r[0-9]{14}$`)
+
+// issuedByRotation reports whether name is a credential a rotation issued
+// under base. Anything else was provisioned by hand or is shared, and is
+// not rotation's to revoke.
+func issuedByRotation(base, name string) bool {
+	return rotatedSuffixRe.MatchString(name) && rotatedSuffixRe.ReplaceAllString(name, "") == base
+}
+
+// credentialBase names an app environment's rotated credentials.
+func credentialBase(base string, spec *model.InfraSpec) string {
+	if spec.Environment != "" {
+		base += "-" + spec.Environment
+	}
+	return base
+}
+
+func generatePassword() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// postgresRotator logs in as a new role per rotation. Each role is a member
+// of the app's original role and assumes it on login, so objects stay owned
+// by one role whichever credential created them. Like the other database
+// steps it runs psql against the host's libpq environment.
+type postgresRotator struct{}
+
+func (postgresRotator) current(values map[string]string) string {
+	u, err := url.Parse(values["DATABASE_URL"])
+	if err != nil || u.User == nil {
+		return ""
+	}
+	return u.User.Username()
+}
+
+func (r postgresRotator) issue(ctx context.Context, spec *model.InfraSpec, old, stamp string, values map[string]string) (string, map[string]string, error) {
+	raw := values["DATABASE_URL"]
+	u, err := url.Parse(raw)
+	if raw == "" || err != nil || u.User == nil {
+		return "", nil, fmt.Errorf("DATABASE_URL secret with a user is required to rotate postgres credentials")
+	}
+	group := rotatedSuffixRe.ReplaceAllString(old, "")
+	role := credentialName(group, "_", stamp)
+	password, err := generatePassword()
+	if err != nil {
+		return "", nil, err
+	}
+	script := `SELECT format('CREATE ROLE %I LOGIN IN ROLE %I', :'role', :'group') WHERE NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = :'role') \gexec
+SELECT format('ALTER ROLE %I WITH LOGIN PASSWORD %L', :'role', :'password') \gexec
+SELECT format('ALTER ROLE %I SET role %I', :'role', :'group') \gexec
+`
+	if err := runPsql(ctx, spec, script, map[string]string{"role": role, "group": group, "password": password}); err != nil {
+		return "", nil, fmt.Errorf("create role %s: %w", role, err)
+	}
+
+	u.User = url.UserPassword(role, password)
+	updates := map[string]string{"DATABASE_URL": u.String()}
+	if _, ok := values["PGUSER"]; ok {
+		updates["PGUSER"] = role
+	}
+	if _, ok := values["PGPASSWORD"]; ok {
+		updates["PGPASSWORD"] = password
+	}
+	return role, updates, nil
+}
+
+// revoke drops a role that rotation issued after handing anything it owns
+// to the original role. The original role was not created by Norn and may
+// be shared with other apps or Norn itself, so it is left as it is.
+func (postgresRotator) revoke(ctx context.Context, spec *model.InfraSpec, id string) (bool, error) {
+	if !rotatedSuffixRe.MatchString(id) {
+		return false, nil
+	}
+	group := rotatedSuffixRe.ReplaceAllString(id, "")
+	script := `SELECT format('REASSIGN OWNED BY %I TO %I', :'role', :'group') FROM pg_roles WHERE rolname = :'role' \gexec
+SELECT format('DROP OWNED BY %I', :'role') FROM pg_roles WHERE rolname = :'role' \gexec
+SELECT format('DROP ROLE %I', :'role') FROM pg_roles WHERE rolname = :'role' \gexec
+`
+	if err := runPsql(ctx, spec, script, map[string]string{"role": id, "group": group}); err != nil {
+		return false, fmt.Errorf("revoke role %s: %w", id, err)
+	}
+	return true, nil
+}
+
+// runPsql feeds script to psql on stdin so values are bound as psql
+// variables rather than spliced into SQL. The variables are set by \set
+// lines ahead of the script, which keeps passwords off the command line
+// where other users of the host could read them.
+func runPsql(ctx context.Context, spec *model.InfraSpec, script string, vars map[string]string) error {
+	args := []string{"-X", "-q", "-v", "ON_ERROR_STOP=1"}
+	if spec.Infrastructure != nil && spec.Infrastructure.Postgres != nil && spec.Infrastructure.Postgres.Database != "" {
+		args = append(args, "-d", spec.Infrastructure.Postgres.Database)
+	}
+	names := make([]string, 0, len(vars))
+	for k := range vars {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var stdin strings.Builder
+	for _, k := range names {
+		fmt.Fprintf(&stdin, "\\set %s %s\n", k, psqlQuote(vars[k]))
+	}
+	stdin.WriteString(script)
+	cmd := exec.CommandContext(ctx, "psql", args...)
+	cmd.Stdin = strings.NewReader(stdin.String())
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("psql: %s", truncateOutput(string(out), 1024))
+	}
+	return nil
+}
+
+// psqlQuote quotes v as a single-quoted psql meta-command argument, in which
+// psql expands backslash escapes and ends the command at a newline.
+func psqlQuote(v string) string {
+	return "'" + psqlEscaper.Replace(v) + "'"
+}
+
+var psqlEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`)
+
+// garageRotator issues a Garage key per rotation with the app's bucket
+// permissions.
+type garageRotator struct {
+	storage *storage.Client
+}
+
+func (garageRotator) current(values map[string]string) string {
+	return values["AWS_ACCESS_KEY_ID"]
+}
+
+func (r garageRotator) issue(ctx context.Context, spec *model.InfraSpec, _, stamp string, _ map[string]string) (string, map[string]string, error) {
+	base := credentialBase(storage.AppKeyName(spec.App), spec)
+	key, err := r.storage.IssueAppKey(ctx, credentialName(base, "-", stamp), spec.Infrastructure.ObjectStorage)
+	if err != nil {
+		return "", nil, err
+	}
+	return key.AccessKeyID, map[string]string{
+		"AWS_ACCESS_KEY_ID":     key.AccessKeyID,
+		"AWS_SECRET_ACCESS_KEY": key.SecretAccessKey,
+	}, nil
+}
+
+// revoke deletes a key a rotation of this app environment issued. The
+// norn-<app> key provisioning creates is shared by every environment of
+// the app, and Norn's own key by every app, so neither is deleted.
+func (r garageRotator) revoke(ctx context.Context, spec *model.InfraSpec, id string) (bool, error) {
+	if id == r.storage.AccessKey() {
+		return false, nil
+	}
+	name, err := r.storage.AppKeyNameByID(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	if name == "" {
+		return true, nil // already gone
+	}
+	if !issuedByRotation(credentialBase(storage.AppKeyName(spec.App), spec), name) {
+		return false, nil
+	}
+	return true, r.storage.RevokeAppKey(ctx, id)
+}
+
+// redpandaRotator issues a SASL/SCRAM user per rotation with access to the
+// app's topics and consumer groups.
+type redpandaRotator struct {
+	redpanda *redpanda.Client
+}
+
+func (redpandaRotator) current(values map[string]string) string {
+	return values["KAFKA_SASL_USERNAME"]
+}
+
+func (r redpandaRotator) issue(ctx context.Context, spec *model.InfraSpec, _, stamp string, _ map[string]string) (string, map[string]string, error) {
+	user := credentialName(credentialBase(spec.App, spec), "-", stamp)
+	password, err := generatePassword()
+	if err != nil {
+		return "", nil, err
+	}
+	if err := r.redpanda.UpsertUser(ctx, user, password); err != nil {
+		return "", nil, err
+	}
+	if err := r.redpanda.GrantApp(ctx, user, spec.App, spec.Infrastructure.Kafka.Topics); err != nil {
+		return "", nil, err
+	}
+	return user, map[string]string{
+		"KAFKA_SASL_USERNAME":  user,
+		"KAFKA_SASL_PASSWORD":  password,
+		"KAFKA_SASL_MECHANISM": redpanda.SASLMechanism,
+	}, nil
+}
+
+// revoke deletes a user a rotation of this app environment issued. Norn
+// never provisions the first Kafka user, so it may be shared and is left.
+func (r redpandaRotator) revoke(ctx context.Context, spec *model.InfraSpec, id string) (bool, error) {
+	if !issuedByRotation(credentialBase(spec.App, spec), id) {
+		return false, nil
+	}
+	return true, r.redpanda.DeleteUser(ctx, id)
+}
@@ -0,0 +1,438 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	nomadapi "github.com/hashicorp/nomad/api"
+
+	"norn/v2/api/hub"
+	"norn/v2/api/model"
+	"norn/v2/api/nomad"
+	"norn/v2/api/saga"
+	"norn/v2/api/store"
+)
+
+// CredentialRotationKind is the operation kind that rotates an app's
+// backing service credentials.
+const CredentialRotationKind = "credentials.rotate"
+
+// Rotation stages, in order. Each is recorded in the operation's metadata
+// once done, so a retried or resumed rotation picks up after the last one.
+const (
+	rotationPlanned   = "planned"
+	rotationIssued    = "issued"
+	rotationStored    = "stored"
+	rotationRestarted = "restarted"
+	rotationVerified  = "verified"
+	rotationRevoked   = "revoked"
+)
+
+var rotationStages = []string{rotationPlanned, rotationIssued, rotationStored, rotationRestarted, rotationVerified, rotationRevoked}
+
+// rotationHealthyTimeout bounds the wait for the restarted job's deployment,
+// unless the processes' update strategies need longer.
+const rotationHealthyTimeout = 10 * time.Minute
+
+// RotateCredentials queues a credential rotation for spec's environment.
+// services defaults to every rotatable service the app declares. When the
+// environment's last rotation failed it is resumed instead, so credentials
+// it already issued are stored and revoked rather than orphaned.
+func (p *Pipeline) RotateCredentials(ctx context.Context, spec *model.InfraSpec, services []string, source string) (*model.Operation, bool, error) {
+	if p.DB == nil {
+		return nil, false, fmt.Errorf("database not connected")
+	}
+	last, err := p.LatestRotation(ctx, spec)
+	if err != nil {
+		return nil, false, err
+	}
+	if last != nil && last.Active() {
+		return nil, false, fmt.Errorf("rotation %s is already %s", last.ID, last.Status)
+	}
+	if last != nil && last.Status == model.OperationFailed && stringFromMap(last.Metadata, "stage") != "" {
+		if err := p.DB.RequeueOperation(ctx, last.ID, "resuming credential rotation"); err != nil {
+			return nil, false, fmt.Errorf("resume rotation %s: %w", last.ID, err)
+		}
+		sg := saga.NewWithID(p.SagaStore, last.SagaID, spec.App, "pipeline", "credentials")
+		sg.Log(ctx, "credentials.resume", fmt.Sprintf("resuming rotation after %s", stringFromMap(last.Metadata, "stage")), map[string]string{
+			"operationId": last.ID,
+		})
+		last.Status = model.OperationQueued
+		return last, true, nil
+	}
+
+	rotatable := spec.RotatableCredentials()
+	if len(services) == 0 {
+		services = rotatable
+	}
+	for _, service := range services {
+		if !containsString(rotatable, service) {
+			return nil, false, fmt.Errorf("%s has no %s credentials to rotate (rotatable: %s)", spec.App, service, strings.Join(rotatable, ", "))
+		}
+		if _, err := p.credentialRotator(service); err != nil {
+			return nil, false, err
+		}
+	}
+	if len(services) == 0 {
+		return nil, false, fmt.Errorf("%s declares no postgres, objectStorage or kafka credentials to rotate", spec.App)
+	}
+
+	sg := saga.New(p.SagaStore, spec.App, "pipeline", "credentials")
+	payload := map[string]interface{}{
+		"app":      spec.App,
+		"services": strings.Join(services, ","),
+	}
+	if spec.Environment != "" {
+		payload["environment"] = spec.Environment
+	}
+	if actor := saga.ActorFrom(ctx); actor != "" {
+		payload["actor"] = actor
+	}
+	op := &model.Operation{
+		ID:          uuid.New().String(),
+		Kind:        CredentialRotationKind,
+		App:         spec.App,
+		SagaID:      sg.ID,
+		Status:      model.OperationQueued,
+		Risk:        "credential rotation",
+		Source:      source,
+		Message:     fmt.Sprintf("queued rotation of %s credentials", strings.Join(services, ", ")),
+		MaxAttempts: 3,
+		Payload:     payload,
+	}
+	if err := p.DB.InsertOperation(ctx, op); err != nil {
+		return nil, false, fmt.Errorf("insert rotation operation: %w", err)
+	}
+	sg.Log(ctx, "credentials.queued", op.Message, map[string]string{
+		"operationId": op.ID,
+		"environment": spec.Environment,
+		"services":    strings.Join(services, ","),
+	})
+	return op, false, nil
+}
+
+// LatestRotation returns the newest rotation of spec's environment, or nil.
+func (p *Pipeline) LatestRotation(ctx context.Context, spec *model.InfraSpec) (*model.Operation, error) {
+	ops, err := p.ListRotations(ctx, spec, 1)
+	if err != nil || len(ops) == 0 {
+		return nil, err
+	}
+	return &ops[0], nil
+}
+
+// ListRotations returns spec's environment's rotations, newest first.
+func (p *Pipeline) ListRotations(ctx context.Context, spec *model.InfraSpec, limit int) ([]model.Operation, error) {
+	ops, err := p.DB.ListOperations(ctx, store.OperationFilter{App: spec.App, Kind: CredentialRotationKind, Limit: 200})
+	if err != nil {
+		return nil, fmt.Errorf("list rotations: %w", err)
+	}
+	out := []model.Operation{}
+	for _, op := range ops {
+		if stringFromMap(op.Payload, "environment") == spec.Environment {
+			out = append(out, op)
+			if len(out) == limit {
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// RotationDue reports whether spec's environment is due a scheduled
+// rotation: its schedule has elapsed since the last rotation started, and
+// none is in progress.
+func RotationDue(spec *model.InfraSpec, last *model.Operation, now time.Time) bool {
+	every := spec.RotationInterval()
+	if every == 0 || len(spec.RotatableCredentials()) == 0 {
+		return false
+	}
+	if last == nil {
+		return true
+	}
+	return !last.Active() && now.Sub(last.StartedAt) >= every
+}
+
+// runCredentialRotation issues new credentials, stores them in the app's
+// secrets, restarts the job onto them, waits for it to become healthy and
+// then revokes the old credentials. Old credentials stay valid until the
+// restarted job is healthy, so a failed rotation leaves the app running.
+func (p *Pipeline) runCredentialRotation(ctx context.Context, spec *model.InfraSpec, sg *saga.Saga, op *model.Operation) error {
+	services := strings.Split(stringFromMap(op.Payload, "services"), ",")
+	meta := op.Metadata
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	stage := stringFromMap(meta, "stage")
+	done := func(s string) bool { return stageIndex(stage) >= stageIndex(s) }
+	advance := func(s string, extra map[string]interface{}) error {
+		stage = s
+		update := map[string]interface{}{"stage": s}
+		for k, v := range extra {
+			update[k] = v
+			meta[k] = v
+		}
+		meta["stage"] = s
+		if err := p.DB.UpdateOperationMetadata(ctx, op.ID, update); err != nil {
+			return fmt.Errorf("record stage %s: %w", s, err)
+		}
+		return nil
+	}
+
+	rotators := make(map[string]credentialRotator, len(services))
+	for _, service := range services {
+		r, err := p.credentialRotator(service)
+		if err != nil {
+			return err
+		}
+		rotators[service] = r
+	}
+	m := p.secretsFor(spec)
+	sg.Log(ctx, "credentials.start", fmt.Sprintf("rotating %s credentials of %s", strings.Join(services, ", "), spec.JobID()), map[string]string{
+		"operationId": op.ID,
+		"attempt":     strconv.Itoa(op.Attempts),
+		"stage":       stage,
+	})
+
+	if !done(rotationPlanned) {
+		values, err := m.Snapshot(spec.App)
+		if err != nil {
+			return fmt.Errorf("read secrets: %w", err)
+		}
+		plan := map[string]interface{}{"stamp": time.Now().UTC().Format("20060102150405")}
+		for _, service := range services {
+			plan["old."+service] = rotators[service].current(values)
+		}
+		if err := advance(rotationPlanned, plan); err != nil {
+			return err
+		}
+	}
+	stamp := stringFromMap(meta, "stamp")
+
+	if !done(rotationStored) {
+		before, err := m.Snapshot(spec.App)
+		if err != nil {
+			return fmt.Errorf("read secrets: %w", err)
+		}
+		updates := map[string]string{}
+		issued := map[string]interface{}{}
+		for _, service := range services {
+			id, values, err := rotators[service].issue(ctx, spec, stringFromMap(meta, "old."+service), stamp, before)
+			if err != nil {
+				sg.Log(ctx, "credentials.issue_failed", fmt.Sprintf("issue %s credentials: %v", service, err), map[string]string{"service": service})
+				return fmt.Errorf("issue %s credentials: %w", service, err)
+			}
+			issued["new."+service] = id
+			for k, v := range values {
+				updates[k] = v
+			}
+			sg.Log(ctx, "credentials.issued", fmt.Sprintf("issued %s credential %s", service, id), map[string]string{"service": service, "credential": id})
+		}
+		if err := advance(rotationIssued, issued); err != nil {
+			return err
+		}
+
+		if err := m.Set(spec.App, updates); err != nil {
+			return fmt.Errorf("store credentials in %s: %w", m.Location(spec.App), err)
+		}
+		after := copyStringMap(before)
+		for k, v := range updates {
+			after[k] = v
+		}
+		keys := make([]string, 0, len(updates))
+		for k := range updates {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		stored := map[string]interface{}{"keys": strings.Join(keys, ",")}
+		if v := RecordSecretVersion(ctx, p.DB, spec.App, spec.HistoryEnvironments(), m, model.SecretVersionRotate, saga.ActorFrom(ctx), before, after, 0); v != nil {
+			stored["secretVersion"] = v.Version
+		}
+		sg.Log(ctx, "credentials.stored", fmt.Sprintf("stored %s in %s", strings.Join(keys, ", "), m.Location(spec.App)), nil)
+		if err := advance(rotationStored, stored); err != nil {
+			return err
+		}
+	}
+
+	if !done(rotationRestarted) {
+		deployment, err := p.restartForCredentials(ctx, spec, sg, strings.Split(stringFromMap(meta, "keys"), ","))
+		if err != nil {
+			return err
+		}
+		if err := advance(rotationRestarted, map[string]interface{}{"previousDeployment": deployment}); err != nil {
+			return err
+		}
+	}
+
+	if !done(rotationVerified) {
+		if err := p.waitCredentialsHealthy(ctx, spec, sg, stringFromMap(meta, "previousDeployment")); err != nil {
+			// The old credentials are still valid; restart again on retry.
+			_ = advance(rotationStored, nil)
+			sg.Log(ctx, "credentials.unhealthy", fmt.Sprintf("%s did not become healthy on the new credentials: %v; old credentials were kept", spec.JobID(), err), nil)
+			return err
+		}
+		if err := advance(rotationVerified, nil); err != nil {
+			return err
+		}
+	}
+
+	if !done(rotationRevoked) {
+		for _, service := range services {
+			old, next := stringFromMap(meta, "old."+service), stringFromMap(meta, "new."+service)
+			if old == "" || old == next {
+				continue
+			}
+			revoked, err := rotators[service].revoke(ctx, spec, old)
+			if err != nil {
+				sg.Log(ctx, "credentials.revoke_failed", fmt.Sprintf("revoke %s credential %s: %v", service, old, err), map[string]string{"service": service})
+				return fmt.Errorf("revoke %s credential %s: %w", service, old, err)
+			}
+			if !revoked {
+				sg.Log(ctx, "credentials.kept", fmt.Sprintf("%s credential %s was not issued by a rotation and may be shared; it was left in place, retire it by hand once nothing uses it", service, old), map[string]string{"service": service, "credential": old})
+				continue
+			}
+			sg.Log(ctx, "credentials.revoked", fmt.Sprintf("revoked %s credential %s", service, old), map[string]string{"service": service, "credential": old})
+		}
+		if err := advance(rotationRevoked, nil); err != nil {
+			return err
+		}
+	}
+
+	message := fmt.Sprintf("rotated %s credentials", strings.Join(services, ", "))
+	_ = p.DB.FinishOperation(ctx, op.ID, model.OperationSucceeded, message, map[string]interface{}{"stage": rotationRevoked})
+	sg.Log(ctx, "credentials.rotated", message, nil)
+	p.WS.Broadcast(hub.Event{Type: "credentials.rotated", AppID: spec.App, Payload: map[string]string{
+		"environment": spec.Environment,
+		"services":    strings.Join(services, ","),
+		"sagaId":      sg.ID,
+	}})
+	return nil
+}
+
+// restartForCredentials resubmits the app's jobs with the live image and the
+// rotated secrets, forcing a rolling update. It returns the job's latest
+// deployment ID from before the restart, or "" when there was none.
+func (p *Pipeline) restartForCredentials(ctx context.Context, spec *model.InfraSpec, sg *saga.Saga, keys []string) (string, error) {
+	live, err := p.Nomad.JobInfo(spec.JobID())
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			sg.Log(ctx, "credentials.restart_skipped", fmt.Sprintf("%s is not deployed; the next deploy picks up the new credentials", spec.JobID()), nil)
+			return "", nil
+		}
+		return "", fmt.Errorf("read job %s: %w", spec.JobID(), err)
+	}
+	image := liveImage(live)
+	if image == "" {
+		return "", fmt.Errorf("live job %s has no image", spec.JobID())
+	}
+	env, err := p.secretEnv(spec)
+	if err != nil {
+		return "", err
+	}
+	values, err := p.secretsFor(spec).Snapshot(spec.App)
+	if err != nil {
+		return "", fmt.Errorf("read secrets: %w", err)
+	}
+	previous := ""
+	if d, err := p.Nomad.LatestDeployment(spec.JobID()); err == nil && d != nil {
+		previous = d.ID
+	}
+
+	job := nomad.Translate(spec, image, env)
+	reconcileLiveState(spec, job, live)
+	// Provisioned credentials copied from the live job would shadow the
+	// rotated ones, for templated backends too.
+	for _, tg := range job.TaskGroups {
+		for _, task := range tg.Tasks {
+			for _, k := range keys {
+				if _, ok := task.Env[k]; ok {
+					task.Env[k] = values[k]
+				}
+			}
+		}
+	}
+	job.Meta["deploy_ts"] = fmt.Sprintf("%d", time.Now().UnixMilli())
+	jobs := []*nomadapi.Job{job}
+	for procName, proc := range spec.Processes {
+		if proc.Schedule != "" {
+			jobs = append(jobs, nomad.TranslatePeriodic(spec, procName, proc, image, env))
+		}
+	}
+	for _, j := range jobs {
+		evalID, err := p.Nomad.SubmitJob(j)
+		if err != nil {
+			return "", fmt.Errorf("submit %s: %w", *j.ID, err)
+		}
+		sg.Log(ctx, "nomad.submitted", fmt.Sprintf("%s resubmitted with rotated credentials (eval: %s)", *j.ID, evalID), map[string]string{"evalId": evalID})
+	}
+	return previous, nil
+}
+
+// waitCredentialsHealthy waits for the deployment the restart started to
+// succeed, promoting canaries once they are healthy.
+func (p *Pipeline) waitCredentialsHealthy(ctx context.Context, spec *model.InfraSpec, sg *saga.Saga, previous string) error {
+	if _, err := p.Nomad.JobInfo(spec.JobID()); err != nil && strings.Contains(err.Error(), "not found") {
+		return nil
+	}
+	deadline := time.After(max(rotationHealthyTimeout, model.HealthyTimeout(spec)))
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	promoted := false
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline:
+			return fmt.Errorf("timeout waiting for %s to become healthy", spec.JobID())
+		case <-ticker.C:
+			d, err := p.Nomad.LatestDeployment(spec.JobID())
+			if err != nil || d == nil || d.ID == previous {
+				continue
+			}
+			switch d.Status {
+			case "successful":
+				sg.Log(ctx, "credentials.healthy", fmt.Sprintf("%s is healthy on the new credentials", spec.JobID()), map[string]string{"deploymentId": d.ID})
+				return nil
+			case "failed", "cancelled":
+				return fmt.Errorf("deployment %s %s: %s", d.ID, d.Status, d.StatusDesc)
+			}
+			if d.IsCanary && !promoted && strings.Contains(d.StatusDesc, "promotion") {
+				if err := p.Nomad.PromoteDeployment(spec.JobID()); err != nil {
+					return err
+				}
+				promoted = true
+				sg.Log(ctx, "credentials.promoted", fmt.Sprintf("promoted canaries of %s", spec.JobID()), map[string]string{"deploymentId": d.ID})
+			}
+		}
+	}
+}
+
+func stageIndex(stage string) int {
+	for i, s := range rotationStages {
+		if s == stage {
+			return i
+		}
+	}
+	return -1
+}
+
+func containsString(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+func copyStringMap(in map[string]string) map[string]string {
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,198 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"norn/v2/api/model"
+	"norn/v2/api/redpanda"
+	"norn/v2/api/storage"
+)
+
+func TestRotationDue(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	spec := &model.InfraSpec{
+		App:                "web",
+		Infrastructure:     &model.Infrastructure{Postgres: &model.PostgresInfra{Database: "web"}},
+		CredentialRotation: &model.CredentialRotation{Every: "24h"},
+	}
+	if !RotationDue(spec, nil, now) {
+		t.Fatal("a scheduled app that never rotated is due")
+	}
+	recent := &model.Operation{Status: model.OperationSucceeded, StartedAt: now.Add(-2 * time.Hour)}
+	if RotationDue(spec, recent, now) {
+		t.Fatal("rotated two hours ago on a daily schedule")
+	}
+	old := &model.Operation{Status: model.OperationFailed, StartedAt: now.Add(-25 * time.Hour)}
+	if !RotationDue(spec, old, now) {
+		t.Fatal("last rotation started over a day ago")
+	}
+	running := &model.Operation{Status: model.OperationRunning, StartedAt: now.Add(-25 * time.Hour)}
+	if RotationDue(spec, running, now) {
+		t.Fatal("a rotation in progress is never due")
+	}
+	spec.CredentialRotation.Every = ""
+	if RotationDue(spec, nil, now) {
+		t.Fatal("on-demand rotation is never due")
+	}
+}
+
+func TestPostgresRotatorIssuesRoleInOriginalRole(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "psql.log")
+	script := "#!/bin/sh\necho \"args: $*\" >> '" + logPath + "'\ncat >> '" + logPath + "'\n"
+	if err := os.WriteFile(filepath.Join(dir, "psql"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	spec := &model.InfraSpec{App: "web", Infrastructure: &model.Infrastructure{Postgres: &model.PostgresInfra{Database: "web"}}}
+	values := map[string]string{
+		"DATABASE_URL": "postgres://web_r20260101000000:old@db:5432/web?sslmode=disable",
+		"PGUSER":       "web_r20260101000000",
+	}
+	r := postgresRotator{}
+	old := r.current(values)
+	if old != "web_r20260101000000" {
+		t.Fatalf("current = %s", old)
+	}
+	id, updates, err := r.issue(context.Background(), spec, old, "20261016120000", values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "web_r20261016120000" || updates["PGUSER"] != id {
+		t.Fatalf("issued %s with %v", id, updates)
+	}
+	if _, ok := updates["PGPASSWORD"]; ok {
+		t.Fatal("PGPASSWORD was not a secret and should not be added")
+	}
+	if !strings.HasPrefix(updates["DATABASE_URL"], "postgres://web_r20261016120000:") || !strings.HasSuffix(updates["DATABASE_URL"], "@db:5432/web?sslmode=disable") {
+		t.Fatalf("DATABASE_URL = %s", updates["DATABASE_URL"])
+	}
+
+	if revoked, err := r.revoke(context.Background(), spec, old); err != nil || !revoked {
+		t.Fatalf("revoke = %v, %v", revoked, err)
+	}
+	raw, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := string(raw)
+	for _, want := range []string{"-d web", `\set role 'web_r20261016120000'`, `\set group 'web'`, "CREATE ROLE %I LOGIN IN ROLE %I", `\set role 'web_r20260101000000'`, "DROP ROLE %I"} {
+		if !strings.Contains(log, want) {
+			t.Fatalf("psql calls missing %q:\n%s", want, log)
+		}
+	}
+	if strings.Contains(log, "CREATE ROLE web") {
+		t.Fatalf("names must be bound as variables, not spliced into SQL:\n%s", log)
+	}
+	for _, line := range strings.Split(log, "\n") {
+		if strings.HasPrefix(line, "args: ") && strings.Contains(line, "password") {
+			t.Fatalf("password passed on the psql command line: %s", line)
+		}
+	}
+}
+
+func TestPostgresRotatorKeepsOriginalRole(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "psql.log")
+	script := "#!/bin/sh\necho \"args: $*\" >> '" + logPath + "'\n"
+	if err := os.WriteFile(filepath.Join(dir, "psql"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	spec := &model.InfraSpec{App: "web", Infrastructure: &model.Infrastructure{Postgres: &model.PostgresInfra{Database: "web"}}}
+	for _, role := range []string{"web", "postgres", "norn"} {
+		if revoked, err := (postgresRotator{}).revoke(context.Background(), spec, role); err != nil || revoked {
+			t.Fatalf("revoke %s = %v, %v", role, revoked, err)
+		}
+	}
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Fatal("revoking a role rotation did not issue must not run psql")
+	}
+}
+
+func TestPsqlQuote(t *testing.T) {
+	if got := psqlQuote("it's\\a\nb"); got != `'it\'s\\a\nb'` {
+		t.Fatalf("psqlQuote = %s", got)
+	}
+}
+
+func TestGarageRotatorKeepsKeySharedWithOtherEnvironments(t *testing.T) {
+	keys := map[string]string{"GKshared": "norn-web", "GKprod": "norn-web-r20260101000000", "GKstaging": "norn-web-staging-r20260101000000"}
+	var deleted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+		switch r.URL.Path {
+		case "/v2/GetKeyInfo":
+			if name, ok := keys[id]; ok {
+				json.NewEncoder(w).Encode(storage.GarageKey{AccessKeyID: id, Name: name})
+				return
+			}
+			http.Error(w, "key not found", http.StatusNotFound)
+		case "/v2/DeleteKey":
+			deleted = append(deleted, id)
+			delete(keys, id)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	client, err := storage.NewClient(storage.Config{Endpoint: "127.0.0.1:3900", AccessKey: "norn", SecretKey: "x", Provider: "garage", GarageAdminEndpoint: srv.URL, GarageAdminToken: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := garageRotator{storage: client}
+	staging := &model.InfraSpec{App: "web", Environment: "staging"}
+
+	for _, id := range []string{"GKshared", "GKprod", "norn"} {
+		if revoked, err := r.revoke(context.Background(), staging, id); err != nil || revoked {
+			t.Fatalf("staging revoked %s = %v, %v", id, revoked, err)
+		}
+	}
+	if len(deleted) != 0 {
+		t.Fatalf("deleted %v; staging must not revoke keys other environments use", deleted)
+	}
+	if revoked, err := r.revoke(context.Background(), staging, "GKstaging"); err != nil || !revoked || len(deleted) != 1 {
+		t.Fatalf("revoke staging's rotated key = %v, %v, deleted %v", revoked, err, deleted)
+	}
+}
+
+func TestRedpandaRotatorKeepsHandMadeUser(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "rpk.log")
+	rpkPath := filepath.Join(dir, "rpk")
+	if err := os.WriteFile(rpkPath, []byte("#!/bin/sh\necho \"$*\" >> '"+logPath+"'\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	client, err := redpanda.NewClient(redpanda.Config{Brokers: []string{"127.0.0.1:9092"}, RPKPath: rpkPath, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := redpandaRotator{redpanda: client}
+	spec := &model.InfraSpec{App: "web"}
+
+	for _, user := range []string{"orders-consumer", "web", "web-staging-r20260101000000"} {
+		if revoked, err := r.revoke(context.Background(), spec, user); err != nil || revoked {
+			t.Fatalf("revoked %s = %v, %v", user, revoked, err)
+		}
+	}
+	if _, err := os.Stat(logPath); !os.IsNotExist(err) {
+		t.Fatal("revoking a user rotation did not issue must not run rpk")
+	}
+	if revoked, err := r.revoke(context.Background(), spec, "web-r20260101000000"); err != nil || !revoked {
+		t.Fatalf("revoke rotated user = %v, %v", revoked, err)
+	}
+	raw, _ := os.ReadFile(logPath)
+	if !strings.Contains(string(raw), "security user delete web-r20260101000000") {
+		t.Fatalf("rpk calls:\n%s", raw)
+	}
+}
@@ -1,47 +1,498 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
+
+	"norn/v2/api/hub"
 	"norn/v2/api/model"
+	"norn/v2/api/saga"
+)
+
+// Group member states recorded in the group operation metadata.
+const (
+	GroupMemberRunning    = "running"
+	GroupMemberDeployed   = "deployed"
+	GroupMemberFailed     = "failed"
+	GroupMemberSkipped    = "skipped"
+	GroupMemberRolledBack = "rolled_back"
 )
 
-// GroupDeployResult records the outcome of queuing a deploy for one app in a group.
-type GroupDeployResult struct {
-	App    string `json:"app"`
-	SagaID string `json:"sagaId,omitempty"`
-	Error  string `json:"error,omitempty"`
+const (
+	// groupMemberLease is the lease a group holds on its own and its
+	// members' operations, renewed while they run; it matches the operation
+	// worker's lease.
+	groupMemberLease = 45 * time.Minute
+	// groupMemberPoll is how often a member deployed by another worker is
+	// checked on.
+	groupMemberPoll = 5 * time.Second
+)
+
+// GroupRun identifies a queued deploy group rollout.
+type GroupRun struct {
+	Group       string     `json:"group"`
+	Ref         string     `json:"ref"`
+	OperationID string     `json:"operationId"`
+	SagaID      string     `json:"sagaId"`
+	Waves       [][]string `json:"waves"`
+}
+
+// GroupMemberResult records the outcome of one app in a group rollout.
+type GroupMemberResult struct {
+	App            string `json:"app"`
+	Wave           int    `json:"wave"`
+	Status         string `json:"status"`
+	SagaID         string `json:"sagaId,omitempty"`
+	DeploymentID   string `json:"deploymentId,omitempty"`
+	RollbackSagaID string `json:"rollbackSagaId,omitempty"`
+	Error          string `json:"error,omitempty"`
 }
 
-// RunGroup queues a deploy for each app in the deploy group and returns the results.
-// If an app spec is not found, the error is recorded but processing continues.
-func (p *Pipeline) RunGroup(group *model.DeployGroup, ref string, appsDir string) ([]GroupDeployResult, error) {
-	specs, err := model.DiscoverApps(appsDir)
+// RunGroup validates the group's dependency graph and queues a single
+// group.deploy operation that rolls the members out wave by wave.
+func (p *Pipeline) RunGroup(ctx context.Context, group *model.DeployGroup, ref string) (*GroupRun, error) {
+	waves, err := group.Waves()
+	if err != nil {
+		return nil, err
+	}
+	specs, err := model.DiscoverApps(p.AppsDir)
 	if err != nil {
 		return nil, fmt.Errorf("discover apps: %w", err)
 	}
+	known := make(map[string]bool, len(specs))
+	for _, s := range specs {
+		known[s.App] = true
+	}
+	for _, app := range group.Apps {
+		if !known[app.App] {
+			return nil, fmt.Errorf("app %s not found", app.App)
+		}
+	}
+
+	sg := saga.New(p.SagaStore, group.Name, "pipeline", "deploy-group")
+	names := waveNames(waves)
+	operationID := uuid.New().String()
+	payload := map[string]interface{}{
+		"group": group.Name,
+		"ref":   ref,
+		"waves": names,
+	}
+	if actor := saga.ActorFrom(ctx); actor != "" {
+		payload["actor"] = actor
+	}
+	if err := p.DB.InsertOperation(ctx, &model.Operation{
+		ID:          operationID,
+		Kind:        "group.deploy",
+		SagaID:      sg.ID,
+		Ref:         ref,
+		Status:      model.OperationQueued,
+		Risk:        "multi-app rolling update",
+		Source:      "pipeline",
+		Message:     fmt.Sprintf("queued deploy group %s", group.Name),
+		MaxAttempts: 1,
+		Payload:     payload,
+		Metadata:    payload,
+	}); err != nil {
+		return nil, fmt.Errorf("insert group operation: %w", err)
+	}
+
+	sg.Log(ctx, "group.queued", fmt.Sprintf("queued deploy group %s (ref: %s) in %d waves", group.Name, ref, len(waves)), map[string]string{
+		"operationId": operationID,
+		"waves":       formatWaves(names),
+	})
+	return &GroupRun{
+		Group:       group.Name,
+		Ref:         ref,
+		OperationID: operationID,
+		SagaID:      sg.ID,
+		Waves:       names,
+	}, nil
+}
 
+// groupMember tracks one in-flight member deploy. done is closed once the
+// member's pipeline has finished and result is safe to read.
+type groupMember struct {
+	spec   *model.InfraSpec
+	deploy *model.Deployment
+	result *GroupMemberResult
+	done   chan struct{}
+}
+
+func (p *Pipeline) runGroup(ctx context.Context, op *model.Operation) error {
+	name := stringFromMap(op.Payload, "group")
+	if name == "" {
+		return fmt.Errorf("operation %s missing group name", op.ID)
+	}
+	group, err := model.FindDeployGroup(p.AppsDir, name)
+	if err != nil {
+		return err
+	}
+	waves, err := group.Waves()
+	if err != nil {
+		return err
+	}
+	specs, err := model.DiscoverApps(p.AppsDir)
+	if err != nil {
+		return fmt.Errorf("discover apps: %w", err)
+	}
 	specMap := make(map[string]*model.InfraSpec, len(specs))
 	for _, s := range specs {
+		// Groups roll out each member's default environment.
+		if s, err = s.ForEnvironment(""); err != nil {
+			return err
+		}
 		specMap[s.App] = s
 	}
-
-	var results []GroupDeployResult
 	for _, app := range group.Apps {
-		spec, ok := specMap[app.App]
-		if !ok {
-			results = append(results, GroupDeployResult{
-				App:   app.App,
-				Error: fmt.Sprintf("app %s not found", app.App),
+		if specMap[app.App] == nil {
+			return fmt.Errorf("app %s not found", app.App)
+		}
+	}
+
+	// A group outlives the lease it was claimed with while its members
+	// await health, so it keeps renewing it.
+	release := p.holdLease(ctx, op.ID, op.LockedBy, groupMemberLease)
+	defer release()
+
+	names := waveNames(waves)
+	sg := saga.NewWithID(p.SagaStore, op.SagaID, group.Name, "pipeline", "deploy-group")
+	sg.Log(ctx, "group.start", fmt.Sprintf("deploying group %s (ref: %s)", group.Name, op.Ref), map[string]string{
+		"operationId": op.ID,
+		"waves":       formatWaves(names),
+		"attempt":     strconv.Itoa(op.Attempts),
+	})
+
+	results := make([]*GroupMemberResult, 0, len(group.Apps))
+	members := make([]*groupMember, 0, len(group.Apps))
+	var halted *GroupMemberResult
+
+	for wi, wave := range waves {
+		// A wave starts only once every member of the earlier waves is done.
+		for _, m := range members {
+			<-m.done
+		}
+		if halted = firstFailed(members); halted != nil {
+			for si := wi; si < len(waves); si++ {
+				for _, app := range waves[si] {
+					results = append(results, &GroupMemberResult{App: app.App, Wave: si + 1, Status: GroupMemberSkipped})
+				}
+			}
+			break
+		}
+
+		waveNo := strconv.Itoa(wi + 1)
+		sg.Log(ctx, "group.wave.start", fmt.Sprintf("wave %s: %s", waveNo, strings.Join(names[wi], ", ")), map[string]string{
+			"wave": waveNo,
+		})
+		p.WS.Broadcast(hub.Event{Type: "deploy-group.wave", AppID: group.Name, Payload: map[string]string{
+			"sagaId": sg.ID,
+			"wave":   waveNo,
+			"total":  strconv.Itoa(len(waves)),
+		}})
+
+		for _, app := range wave {
+			m := p.startGroupMember(ctx, op, sg, specMap[app.App], wi+1)
+			members = append(members, m)
+			results = append(results, m.result)
+		}
+	}
+
+	for _, m := range members {
+		<-m.done
+	}
+	if halted == nil {
+		halted = firstFailed(members)
+	}
+
+	if halted == nil {
+		summary := memberSummary(results)
+		_ = p.DB.FinishOperation(ctx, op.ID, model.OperationSucceeded, fmt.Sprintf("deploy group %s complete", group.Name), map[string]interface{}{
+			"members": summary,
+		})
+		sg.Log(ctx, "group.complete", fmt.Sprintf("deploy group %s complete: %d apps healthy", group.Name, len(members)), nil)
+		p.WS.Broadcast(hub.Event{Type: "deploy-group.completed", AppID: group.Name, Payload: map[string]string{
+			"sagaId": sg.ID,
+		}})
+		p.emitBeacon(ctx, model.BeaconEvent{
+			App:       group.Name,
+			Type:      "deploy_group.succeeded",
+			Severity:  model.BeaconInfo,
+			Title:     fmt.Sprintf("deploy group %s succeeded", group.Name),
+			Body:      fmt.Sprintf("All %d apps in %s deployed and healthy.", len(members), group.Name),
+			DedupeKey: fmt.Sprintf("group:%s:deploy", group.Name),
+			Metadata: map[string]interface{}{
+				"operationId": op.ID,
+				"sagaId":      sg.ID,
+			},
+		})
+		return nil
+	}
+
+	sg.Log(ctx, "group.halted", fmt.Sprintf("deploy group %s halted: %s failed", group.Name, halted.App), map[string]string{
+		"app":    halted.App,
+		"sagaId": halted.SagaID,
+		"error":  halted.Error,
+	})
+	if group.RollbackOnFailure {
+		p.rollbackGroupMembers(ctx, sg, members)
+	}
+
+	summary := memberSummary(results)
+	message := fmt.Sprintf("deploy group %s failed at %s: %s", group.Name, halted.App, halted.Error)
+	_ = p.DB.FinishOperation(ctx, op.ID, model.OperationFailed, message, map[string]interface{}{
+		"members":   summary,
+		"failedApp": halted.App,
+	})
+	sg.Log(ctx, "group.failed", message, nil)
+	p.WS.Broadcast(hub.Event{Type: "deploy-group.failed", AppID: group.Name, Payload: map[string]string{
+		"sagaId": sg.ID,
+		"app":    halted.App,
+		"error":  halted.Error,
+	}})
+	p.emitBeacon(ctx, model.BeaconEvent{
+		App:       group.Name,
+		Type:      "deploy_group.failed",
+		Severity:  model.BeaconCritical,
+		Title:     fmt.Sprintf("deploy group %s failed", group.Name),
+		Body:      message,
+		DedupeKey: fmt.Sprintf("group:%s:deploy", group.Name),
+		Metadata: map[string]interface{}{
+			"operationId": op.ID,
+			"sagaId":      sg.ID,
+			"failedApp":   halted.App,
+		},
+	})
+	return nil
+}
+
+// startGroupMember runs one member's deploy pipeline in the background. The
+// member's app.deploy operation is queued and then claimed by the group's
+// worker with a lease that is renewed until the deploy finishes, so a
+// restart recovers it like any other claimed operation. When another
+// worker claims it first, the member waits for that worker's deploy
+// instead.
+func (p *Pipeline) startGroupMember(ctx context.Context, op *model.Operation, groupSaga *saga.Saga, spec *model.InfraSpec, wave int) *groupMember {
+	deploy, operationID, sg := p.enqueueDeploy(ctx, spec, op.Ref, model.OperationQueued, "deploy-group", map[string]interface{}{
+		"groupOperationId": op.ID,
+		"groupSagaId":      groupSaga.ID,
+	})
+	claimed, claimErr := p.DB.ClaimOperation(ctx, operationID, op.LockedBy, groupMemberLease)
+	m := &groupMember{
+		spec:   spec,
+		deploy: deploy,
+		result: &GroupMemberResult{
+			App:          spec.App,
+			Wave:         wave,
+			Status:       GroupMemberRunning,
+			SagaID:       sg.ID,
+			DeploymentID: deploy.ID,
+		},
+		done: make(chan struct{}),
+	}
+	groupSaga.Log(ctx, "group.member.start", fmt.Sprintf("deploying %s", spec.App), map[string]string{
+		"app":          spec.App,
+		"sagaId":       sg.ID,
+		"deploymentId": deploy.ID,
+		"wave":         strconv.Itoa(wave),
+	})
+
+	go func() {
+		defer close(m.done)
+		switch {
+		case claimErr != nil:
+			m.result.Error = fmt.Sprintf("claim deploy operation: %v", claimErr)
+			deploy.Status = model.StatusFailed
+			_ = p.DB.UpdateDeployment(ctx, deploy.ID, model.StatusFailed)
+			_ = p.DB.FinishOperation(ctx, operationID, model.OperationFailed, m.result.Error, nil)
+		case claimed == nil:
+			p.awaitDeployment(ctx, deploy)
+		default:
+			sg.Log(ctx, "deploy.start", fmt.Sprintf("deploying %s (ref: %s) as part of group", spec.App, op.Ref), map[string]string{
+				"operationId":      operationID,
+				"deploymentId":     deploy.ID,
+				"groupOperationId": op.ID,
+			})
+			release := p.holdLease(ctx, operationID, op.LockedBy, groupMemberLease)
+			p.run(ctx, spec, deploy, sg, operationID, claimed.Attempts)
+			release()
+		}
+
+		if deploy.Status != model.StatusDeployed {
+			m.result.Status = GroupMemberFailed
+			if m.result.Error == "" {
+				m.result.Error = lastStepFailure(ctx, p.SagaStore, sg.ID)
+			}
+			groupSaga.Log(ctx, "group.member.failed", fmt.Sprintf("%s failed: %s", spec.App, m.result.Error), map[string]string{
+				"app":    spec.App,
+				"sagaId": sg.ID,
+			})
+			return
+		}
+		m.result.Status = GroupMemberDeployed
+		groupSaga.Log(ctx, "group.member.healthy", fmt.Sprintf("%s deployed and healthy", spec.App), map[string]string{
+			"app":      spec.App,
+			"sagaId":   sg.ID,
+			"imageTag": deploy.ImageTag,
+		})
+	}()
+	return m
+}
+
+// awaitDeployment polls deploy until whoever runs it marks it deployed or
+// failed, and copies the final status and image tag into deploy.
+func (p *Pipeline) awaitDeployment(ctx context.Context, deploy *model.Deployment) {
+	ticker := time.NewTicker(groupMemberPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			deploy.Status = model.StatusFailed
+			return
+		case <-ticker.C:
+		}
+		current, err := p.DB.GetDeployment(ctx, deploy.ID)
+		if err != nil {
+			continue
+		}
+		if current.Status == model.StatusDeployed || current.Status == model.StatusFailed {
+			deploy.Status = current.Status
+			deploy.ImageTag = current.ImageTag
+			return
+		}
+	}
+}
+
+// rollbackGroupMembers queues a rollback for every member this run deployed
+// successfully. Members without an earlier successful deployment are left as-is.
+func (p *Pipeline) rollbackGroupMembers(ctx context.Context, sg *saga.Saga, members []*groupMember) {
+	for _, m := range members {
+		if m.result.Status != GroupMemberDeployed {
+			continue
+		}
+		prev, err := p.DB.LastSuccessfulDeployment(ctx, m.spec.App, m.spec.HistoryEnvironments(), m.deploy.ID)
+		if err != nil || prev == nil {
+			sg.Log(ctx, "group.rollback.skipped", fmt.Sprintf("no previous deployment of %s to roll back to", m.spec.App), map[string]string{
+				"app": m.spec.App,
 			})
 			continue
 		}
-		sagaID := p.Run(spec, ref)
-		results = append(results, GroupDeployResult{
-			App:    app.App,
-			SagaID: sagaID,
+		rollbackSagaID := p.Rollback(ctx, m.spec, *m.deploy, prev)
+		m.result.Status = GroupMemberRolledBack
+		m.result.RollbackSagaID = rollbackSagaID
+		sg.Log(ctx, "group.rollback", fmt.Sprintf("rolling back %s to %s", m.spec.App, prev.ImageTag), map[string]string{
+			"app":            m.spec.App,
+			"imageTag":       prev.ImageTag,
+			"rollbackSagaId": rollbackSagaID,
 		})
 	}
+}
+
+func firstFailed(members []*groupMember) *GroupMemberResult {
+	for _, m := range members {
+		select {
+		case <-m.done:
+			if m.result.Status == GroupMemberFailed {
+				return m.result
+			}
+		default:
+		}
+	}
+	return nil
+}
+
+func lastStepFailure(ctx context.Context, store saga.Store, sagaID string) string {
+	events, err := store.ListBySaga(ctx, sagaID)
+	if err != nil {
+		return "deploy failed"
+	}
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Action == "deploy.failed" {
+			return events[i].Message
+		}
+	}
+	return "deploy failed"
+}
+
+func memberSummary(results []*GroupMemberResult) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(results))
+	for _, r := range results {
+		entry := map[string]interface{}{
+			"app":    r.App,
+			"wave":   r.Wave,
+			"status": r.Status,
+		}
+		if r.SagaID != "" {
+			entry["sagaId"] = r.SagaID
+		}
+		if r.DeploymentID != "" {
+			entry["deploymentId"] = r.DeploymentID
+		}
+		if r.RollbackSagaID != "" {
+			entry["rollbackSagaId"] = r.RollbackSagaID
+		}
+		if r.Error != "" {
+			entry["error"] = r.Error
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+func waveNames(waves [][]model.DeployGroupApp) [][]string {
+	out := make([][]string, 0, len(waves))
+	for _, wave := range waves {
+		names := make([]string, 0, len(wave))
+		for _, app := range wave {
+			names = append(names, app.App)
+		}
+		out = append(out, names)
+	}
+	return out
+}
 
-	return results, nil
+func formatWaves(waves [][]string) string {
+	parts := make([]string, 0, len(waves))
+	for _, wave := range waves {
+		parts = append(parts, strings.Join(wave, ","))
+	}
+	return strings.Join(parts, " -> ")
+}
+
+// holdLease renews workerID's lease on operation id every third of lease
+// until the returned release func is called.
+func (p *Pipeline) holdLease(ctx context.Context, id, workerID string, lease time.Duration) func() {
+	if p.DB == nil {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				held, err := p.DB.RenewOperationLease(ctx, id, workerID, lease)
+				switch {
+				case err != nil && ctx.Err() == nil:
+					log.Printf("renew lease on operation %s: %v", id, err)
+				case err == nil && !held:
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
 }
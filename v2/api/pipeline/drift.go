@@ -0,0 +1,333 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+
+	"norn/v2/api/cloudflared"
+	"norn/v2/api/hub"
+	"norn/v2/api/model"
+	"norn/v2/api/nomad"
+	"norn/v2/api/saga"
+	"norn/v2/api/store"
+)
+
+// driftPlan is a drift report with the jobs that would fix it.
+type driftPlan struct {
+	report *model.DriftReport
+	jobs   []*nomadapi.Job
+}
+
+// Drift compares the Nomad jobs spec translates to with the running ones.
+// The live image is kept, so only changes to the infraspec itself, its env
+// and its secrets show up.
+func (p *Pipeline) Drift(ctx context.Context, spec *model.InfraSpec) (*model.DriftReport, error) {
+	plan, err := p.planDrift(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	return plan.report, nil
+}
+
+func (p *Pipeline) planDrift(ctx context.Context, spec *model.InfraSpec) (*driftPlan, error) {
+	report := &model.DriftReport{
+		App:         spec.App,
+		Environment: spec.Environment,
+		JobID:       spec.JobID(),
+		Status:      model.DriftInSync,
+		Changes:     []model.DriftChange{},
+		CheckedAt:   time.Now().UTC(),
+	}
+	plan := &driftPlan{report: report}
+
+	live, err := p.Nomad.JobInfo(spec.JobID())
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			report.Status = model.DriftNotDeployed
+			return plan, nil
+		}
+		return nil, fmt.Errorf("read job %s: %w", spec.JobID(), err)
+	}
+	report.Image = liveImage(live)
+
+	env, err := p.secretEnv(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	desired := nomad.Translate(spec, report.Image, env)
+	reconcileLiveState(spec, desired, live)
+	if changes := nomad.DiffJobs(desired, live); len(changes) > 0 {
+		report.Changes = append(report.Changes, changes...)
+		plan.jobs = append(plan.jobs, desired)
+	}
+
+	for procName, proc := range spec.Processes {
+		if proc.Schedule == "" {
+			continue
+		}
+		periodic := nomad.TranslatePeriodic(spec, procName, proc, report.Image, env)
+		current, err := p.Nomad.JobInfo(*periodic.ID)
+		if err != nil {
+			report.Changes = append(report.Changes, model.DriftChange{Job: *periodic.ID, Field: "job", Change: "added"})
+			plan.jobs = append(plan.jobs, periodic)
+			continue
+		}
+		reconcileLiveState(spec, periodic, current)
+		if changes := nomad.DiffJobs(periodic, current); len(changes) > 0 {
+			report.Changes = append(report.Changes, changes...)
+			plan.jobs = append(plan.jobs, periodic)
+		}
+	}
+
+	report.Changes = append(report.Changes, p.endpointDrift(ctx, spec)...)
+	if len(report.Changes) > 0 {
+		report.Status = model.DriftDrifted
+	}
+	return plan, nil
+}
+
+// secretEnv resolves spec's secrets into the env a submitted job carries.
+// Secrets in Nomad Variables or Vault stay out of it; the translator adds a
+// template that reads them instead.
+func (p *Pipeline) secretEnv(spec *model.InfraSpec) (map[string]string, error) {
+	env := map[string]string{}
+	if p.Secrets == nil {
+		return env, nil
+	}
+	secretEnv, err := p.secretsFor(spec).JobEnv(spec.App)
+	if err != nil {
+		return nil, fmt.Errorf("resolve secrets: %w", err)
+	}
+	for k, v := range secretEnv {
+		env[k] = v
+	}
+	return env, nil
+}
+
+// reconcileLiveState carries over what the spec doesn't own: env injected
+// at deploy time by object storage and Kafka provisioning, counts a scale
+// or autoscaler set within the process's scaling range, zero counts of
+// scale-to-zero processes the idle reaper stopped, and CPU and memory the
+// tuner set on auto-tuned processes.
+func reconcileLiveState(spec *model.InfraSpec, desired, live *nomadapi.Job) {
+	liveGroups := map[string]*nomadapi.TaskGroup{}
+	for _, tg := range live.TaskGroups {
+		if tg.Name != nil {
+			liveGroups[*tg.Name] = tg
+		}
+	}
+	for _, tg := range desired.TaskGroups {
+		current, ok := liveGroups[*tg.Name]
+		if !ok {
+			continue
+		}
+		if proc, ok := spec.Processes[*tg.Name]; ok && current.Count != nil && tg.Count != nil {
+			scaling := proc.Scaling
+			asleep := scaling.ScalesToZero() && *current.Count == 0
+			if asleep || (scaling != nil && scaling.Max > 0 && *current.Count >= *tg.Count && *current.Count <= scaling.Max) {
+				count := *current.Count
+				tg.Count = &count
+			}
+		}
+		liveTasks := map[string]*nomadapi.Task{}
+		for _, t := range current.Tasks {
+			liveTasks[t.Name] = t
+		}
+		tuned := spec.Processes[*tg.Name].Tuning.AutoApplies()
+		for _, task := range tg.Tasks {
+			have, ok := liveTasks[task.Name]
+			if !ok {
+				continue
+			}
+			if tuned && have.Resources != nil && task.Resources != nil {
+				task.Resources.CPU = have.Resources.CPU
+				task.Resources.MemoryMB = have.Resources.MemoryMB
+			}
+			env := make(map[string]string, len(task.Env))
+			for k, v := range have.Env {
+				if provisionedEnv(k) {
+					env[k] = v
+				}
+			}
+			for k, v := range task.Env {
+				env[k] = v
+			}
+			task.Env = env
+		}
+	}
+	if desired.Meta != nil && live.Meta != nil {
+		desired.Meta["deploy_ts"] = live.Meta["deploy_ts"]
+	}
+}
+
+// provisionedEnv reports whether a variable is injected by the submit step's
+// object storage or Kafka provisioning rather than declared in the spec.
+func provisionedEnv(key string) bool {
+	for _, prefix := range []string{"S3_", "AWS_", "KAFKA_", "REDPANDA_"} {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func liveImage(job *nomadapi.Job) string {
+	for _, tg := range job.TaskGroups {
+		for _, task := range tg.Tasks {
+			if image, ok := task.Config["image"].(string); ok && image != "" {
+				return image
+			}
+		}
+	}
+	return ""
+}
+
+// endpointDrift reports endpoints with no cloudflared route, or a route to
+// a different service. Unreadable cloudflared config is not drift.
+func (p *Pipeline) endpointDrift(ctx context.Context, spec *model.InfraSpec) []model.DriftChange {
+	if len(spec.Endpoints) == 0 {
+		return nil
+	}
+	cfg, err := cloudflared.ReadConfig(ctx)
+	if err != nil {
+		return nil
+	}
+	routes := map[string]string{}
+	for _, rule := range cfg.Ingress {
+		if rule.Hostname != "" {
+			routes[rule.Hostname] = rule.Service
+		}
+	}
+	service, _ := p.cloudflaredService(spec)
+	var out []model.DriftChange
+	for _, ep := range spec.Endpoints {
+		host := cloudflared.NormalizeHostname(ep.URL)
+		current, ok := routes[host]
+		switch {
+		case !ok:
+			out = append(out, model.DriftChange{Job: spec.JobID(), Field: "endpoint." + host, Change: "added", Desired: service, Endpoint: true})
+		case service != "" && current != service:
+			out = append(out, model.DriftChange{Job: spec.JobID(), Field: "endpoint." + host, Change: "changed", Desired: service, Live: current, Endpoint: true})
+		}
+	}
+	return out
+}
+
+// Reconcile checks spec for drift, raises a beacon event when it finds
+// some, and resubmits the drifted jobs when the app's reconcile policy is
+// apply.
+func (p *Pipeline) Reconcile(ctx context.Context, spec *model.InfraSpec) (*model.DriftReport, error) {
+	plan, err := p.planDrift(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	report := plan.report
+	if report.Status != model.DriftDrifted {
+		return report, nil
+	}
+	p.emitBeacon(ctx, model.BeaconEvent{
+		App:       spec.App,
+		Type:      "drift.detected",
+		Severity:  model.BeaconWarning,
+		Title:     fmt.Sprintf("%s has drifted from its infraspec", report.JobID),
+		Body:      driftSummary(report.Changes),
+		DedupeKey: fmt.Sprintf("%s:drift", report.JobID),
+		Metadata: map[string]interface{}{
+			"environment": spec.Environment,
+			"jobId":       report.JobID,
+			"changes":     len(report.Changes),
+		},
+	})
+	if spec.ReconcilePolicy() == model.ReconcileApply {
+		p.applyDrift(ctx, spec, plan)
+	}
+	return report, nil
+}
+
+// ApplyDrift resubmits spec's drifted jobs with the live image, whatever the
+// app's reconcile policy.
+func (p *Pipeline) ApplyDrift(ctx context.Context, spec *model.InfraSpec) (*model.DriftReport, error) {
+	plan, err := p.planDrift(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	if plan.report.Status == model.DriftDrifted {
+		p.applyDrift(ctx, spec, plan)
+	}
+	return plan.report, nil
+}
+
+func (p *Pipeline) applyDrift(ctx context.Context, spec *model.InfraSpec, plan *driftPlan) {
+	report := plan.report
+	if report.Skipped = p.driftApplyBlocker(ctx, spec, report); report.Skipped != "" {
+		return
+	}
+	sg := saga.New(p.SagaStore, spec.App, "reconciler", "drift")
+	report.SagaID = sg.ID
+	sg.Log(ctx, "drift.apply", fmt.Sprintf("resubmitting %s to fix %d drifted fields", report.JobID, len(report.JobChanges())), map[string]string{
+		"jobId":   report.JobID,
+		"image":   report.Image,
+		"changes": driftSummary(report.JobChanges()),
+	})
+	for _, job := range plan.jobs {
+		evalID, err := p.Nomad.SubmitJob(job)
+		if err != nil {
+			sg.Log(ctx, "drift.apply_failed", fmt.Sprintf("submit %s: %v", *job.ID, err), nil)
+			report.Skipped = fmt.Sprintf("submit %s: %v", *job.ID, err)
+			return
+		}
+		sg.Log(ctx, "nomad.submitted", fmt.Sprintf("%s resubmitted (eval: %s)", *job.ID, evalID), map[string]string{"evalId": evalID})
+	}
+	report.Applied = true
+	p.WS.Broadcast(hub.Event{Type: "drift.applied", AppID: spec.App, Payload: map[string]string{
+		"jobId":  report.JobID,
+		"sagaId": sg.ID,
+	}})
+}
+
+// driftApplyBlocker says why drift can't be fixed by resubmitting the job,
+// or returns "".
+func (p *Pipeline) driftApplyBlocker(ctx context.Context, spec *model.InfraSpec, report *model.DriftReport) string {
+	jobChanges := report.JobChanges()
+	if len(jobChanges) == 0 {
+		return "only endpoint routes differ; deploy to restore them"
+	}
+	for _, c := range jobChanges {
+		if c.Image {
+			return "the image differs; deploy to change it"
+		}
+	}
+	if report.Image == "" {
+		return "the live job has no image"
+	}
+	if hasCanaryConfig(spec) {
+		return "canary processes need a deploy to promote"
+	}
+	if p.DB != nil {
+		active, err := p.DB.ListOperations(ctx, store.OperationFilter{App: spec.App, Active: true, Limit: 1})
+		if err != nil {
+			return fmt.Sprintf("check operations: %v", err)
+		}
+		if len(active) > 0 {
+			return fmt.Sprintf("%s operation %s is in progress", active[0].Kind, active[0].ID)
+		}
+	}
+	return ""
+}
+
+func driftSummary(changes []model.DriftChange) string {
+	parts := make([]string, 0, len(changes))
+	for _, c := range changes {
+		field := c.Field
+		if c.Group != "" {
+			field = c.Group + "." + field
+		}
+		parts = append(parts, field+" "+c.Change)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"context"
+	"testing"
+
+	"norn/v2/api/model"
+	"norn/v2/api/nomad"
+)
+
+func TestReconcileLiveStateKeepsProvisionedEnvAndScaledCounts(t *testing.T) {
+	spec := &model.InfraSpec{
+		App: "shop",
+		Processes: map[string]model.Process{
+			"web": {Port: 8080, Scaling: &model.Scaling{Min: 1, Max: 4}},
+		},
+	}
+	live := nomad.Translate(spec, "shop:abc", map[string]string{"S3_BUCKET": "uploads", "OLD_FLAG": "1"})
+	three := 3
+	live.TaskGroups[0].Count = &three
+
+	desired := nomad.Translate(spec, "shop:abc", nil)
+	reconcileLiveState(spec, desired, live)
+
+	if got := *desired.TaskGroups[0].Count; got != 3 {
+		t.Fatalf("count = %d, want the live count within scaling range", got)
+	}
+	changes := nomad.DiffJobs(desired, live)
+	if len(changes) != 1 || changes[0].Field != "env.OLD_FLAG" || changes[0].Change != "removed" {
+		t.Fatalf("changes = %+v", changes)
+	}
+}
+
+func TestDriftApplyBlocker(t *testing.T) {
+	p := &Pipeline{}
+	spec := &model.InfraSpec{App: "shop", Processes: map[string]model.Process{"web": {Port: 8080}}}
+	cases := []struct {
+		report *model.DriftReport
+		want   bool
+	}{
+		{&model.DriftReport{Image: "shop:abc", Changes: []model.DriftChange{{Field: "resources.cpu"}}}, false},
+		{&model.DriftReport{Image: "shop:abc", Changes: []model.DriftChange{{Field: "image", Image: true}}}, true},
+		{&model.DriftReport{Image: "shop:abc", Changes: []model.DriftChange{{Field: "endpoint.shop.example.com", Endpoint: true}}}, true},
+		{&model.DriftReport{Changes: []model.DriftChange{{Field: "count"}}}, true},
+	}
+	for i, tc := range cases {
+		if got := p.driftApplyBlocker(context.Background(), spec, tc.report); (got != "") != tc.want {
+			t.Fatalf("case %d: blocker = %q", i, got)
+		}
+	}
+}
@@ -64,7 +64,7 @@ func (p *Pipeline) cloudflaredService(spec *model.InfraSpec) (string, error) {
 		return "", fmt.Errorf("no port found in spec for cloudflared routing")
 	}
 
-	serviceName := fmt.Sprintf("%s-%s", spec.App, processName)
+	serviceName := fmt.Sprintf("%s-%s", spec.JobID(), processName)
 	if p.Consul != nil {
 		instances, err := p.Consul.ServiceHealthChecks(serviceName)
 		if err == nil {
@@ -81,13 +81,16 @@ func (p *Pipeline) cloudflaredService(spec *model.InfraSpec) (string, error) {
 		}
 	}
 
-	allocs, err := p.Nomad.PollAllocations(spec.App)
+	allocs, err := p.Nomad.PollAllocations(spec.JobID())
 	if err != nil {
 		return "", fmt.Errorf("poll allocations: %w", err)
 	}
 	if len(allocs) == 0 {
 		return "", fmt.Errorf("no running allocations for %s", spec.App)
 	}
+	if !spec.ReservesPorts() {
+		return "", fmt.Errorf("%s has no registered address in consul yet", serviceName)
+	}
 	nodeInfo, err := p.Nomad.NodeInfo(allocs[0].NodeID)
 	if err != nil {
 		return "", fmt.Errorf("node info: %w", err)
@@ -6,11 +6,14 @@ import (
 	"time"
 
 	"norn/v2/api/hub"
+	"norn/v2/api/model"
 	"norn/v2/api/saga"
 )
 
 func (p *Pipeline) healthy(ctx context.Context, st *state, sg *saga.Saga) error {
-	deadline := time.After(5 * time.Minute)
+	// Give the slowest process's rollout its full healthy deadlines.
+	timeout := model.HealthyTimeout(st.spec)
+	deadline := time.After(timeout)
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
 
@@ -21,9 +24,9 @@ func (p *Pipeline) healthy(ctx context.Context, st *state, sg *saga.Saga) error
 		case <-ctx.Done():
 			return ctx.Err()
 		case <-deadline:
-			return fmt.Errorf("timeout waiting for %s to become healthy", st.spec.App)
+			return fmt.Errorf("timeout waiting %s for %s to become healthy", timeout, st.spec.App)
 		case <-ticker.C:
-			allocs, err := p.Nomad.PollAllocations(st.spec.App)
+			allocs, err := p.Nomad.PollAllocations(st.spec.JobID())
 			if err != nil {
 				continue
 			}
@@ -0,0 +1,138 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+
+	"norn/v2/api/hub"
+	"norn/v2/api/model"
+	"norn/v2/api/saga"
+	"norn/v2/api/store"
+)
+
+// SleepIdle scales each of spec's scale-to-zero processes to zero once no
+// request has been observed for its idle timeout, and returns the sleeps it
+// recorded. Apps with an operation in progress are left alone.
+func (p *Pipeline) SleepIdle(ctx context.Context, spec *model.InfraSpec, now time.Time) ([]model.WakeEvent, error) {
+	if p.DB == nil {
+		return nil, nil
+	}
+	job, err := p.Nomad.JobInfo(spec.JobID())
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read job %s: %w", spec.JobID(), err)
+	}
+	candidates := sleepCandidates(spec, job)
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	active, err := p.DB.ListOperations(ctx, store.OperationFilter{App: spec.App, Active: true, Limit: 1})
+	if err != nil {
+		return nil, fmt.Errorf("check operations: %w", err)
+	}
+	if len(active) > 0 {
+		return nil, nil
+	}
+
+	var slept []model.WakeEvent
+	for _, name := range candidates {
+		lastAccess, err := p.DB.LastAccess(ctx, spec.App, name)
+		if err != nil {
+			return slept, fmt.Errorf("last access for %s/%s: %w", spec.App, name, err)
+		}
+		latest, err := p.DB.LatestWakeEvent(ctx, spec.App, name)
+		if err != nil {
+			return slept, fmt.Errorf("wake history for %s/%s: %w", spec.App, name, err)
+		}
+		idleFor := now.Sub(lastActivity(lastAccess, latest, job))
+		if idleFor < spec.Processes[name].Scaling.IdleAfter() {
+			continue
+		}
+		event, err := p.sleepProcess(ctx, spec, name, idleFor)
+		if err != nil {
+			return slept, err
+		}
+		slept = append(slept, *event)
+	}
+	return slept, nil
+}
+
+func (p *Pipeline) sleepProcess(ctx context.Context, spec *model.InfraSpec, process string, idleFor time.Duration) (*model.WakeEvent, error) {
+	jobID := spec.JobID()
+	idleFor = idleFor.Round(time.Minute)
+	if err := p.Nomad.ScaleJob(jobID, process, 0); err != nil {
+		return nil, fmt.Errorf("scale %s/%s to 0: %w", jobID, process, err)
+	}
+	event := &model.WakeEvent{
+		App:        spec.App,
+		Process:    process,
+		Action:     model.WakeActionSleep,
+		Reason:     fmt.Sprintf("no requests for %s", idleFor),
+		Actor:      saga.ActorFrom(ctx),
+		DurationMs: idleFor.Milliseconds(),
+	}
+	if err := p.DB.RecordWakeEvent(ctx, event); err != nil {
+		return nil, fmt.Errorf("record sleep of %s/%s: %w", jobID, process, err)
+	}
+
+	sg := saga.New(p.SagaStore, spec.App, "reaper", "scale")
+	sg.Log(ctx, "scale.sleep", fmt.Sprintf("%s/%s scaled to 0 after %s without requests", jobID, process, idleFor), map[string]string{
+		"jobId":   jobID,
+		"group":   process,
+		"idleFor": idleFor.String(),
+	})
+	p.emitBeacon(ctx, model.BeaconEvent{
+		App:       spec.App,
+		Type:      "process.sleep",
+		Severity:  model.BeaconInfo,
+		Title:     fmt.Sprintf("%s/%s scaled to zero", jobID, process),
+		Body:      fmt.Sprintf("No requests for %s. The wake gateway starts it again on the next request.", idleFor),
+		DedupeKey: fmt.Sprintf("%s:%s:sleep:%d", jobID, process, event.ID),
+		Metadata: map[string]interface{}{
+			"process": process,
+			"idleFor": idleFor.String(),
+			"sagaId":  sg.ID,
+		},
+	})
+	p.WS.Broadcast(hub.Event{Type: "process.sleep", AppID: spec.App, Payload: map[string]string{
+		"process": process,
+		"sagaId":  sg.ID,
+	}})
+	return event, nil
+}
+
+// sleepCandidates lists spec's scale-to-zero processes that are running.
+func sleepCandidates(spec *model.InfraSpec, job *nomadapi.Job) []string {
+	counts := groupCounts(job)
+	var out []string
+	for name, proc := range spec.Processes {
+		if proc.Scaling.ScalesToZero() && counts[name] > 0 {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// lastActivity is the latest of the last observed request, the last sleep
+// or wake, and the job's last submission, so a fresh deploy or wake gets a
+// full idle timeout before it is stopped again.
+func lastActivity(lastAccess time.Time, latest *model.WakeEvent, job *nomadapi.Job) time.Time {
+	last := lastAccess
+	if latest != nil && latest.CreatedAt.After(last) {
+		last = latest.CreatedAt
+	}
+	if job.SubmitTime != nil {
+		if submitted := time.Unix(0, *job.SubmitTime); submitted.After(last) {
+			last = submitted
+		}
+	}
+	return last
+}
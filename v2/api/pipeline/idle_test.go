@@ -0,0 +1,66 @@
+package pipeline
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+
+	"norn/v2/api/model"
+	"norn/v2/api/nomad"
+)
+
+func TestSleepCandidatesSkipsStoppedAndOptedOutProcesses(t *testing.T) {
+	spec := &model.InfraSpec{
+		App: "tools",
+		Processes: map[string]model.Process{
+			"web":    {Port: 8080, Scaling: &model.Scaling{Min: 1, ScaleToZero: true}},
+			"admin":  {Port: 8081, Scaling: &model.Scaling{Min: 1, ScaleToZero: true}},
+			"worker": {Command: "./worker", Scaling: &model.Scaling{Min: 1}},
+		},
+	}
+	group := func(name string, count int) *nomadapi.TaskGroup {
+		return &nomadapi.TaskGroup{Name: &name, Count: &count}
+	}
+	job := &nomadapi.Job{TaskGroups: []*nomadapi.TaskGroup{group("web", 1), group("admin", 0), group("worker", 1)}}
+	if got := sleepCandidates(spec, job); !reflect.DeepEqual(got, []string{"web"}) {
+		t.Fatalf("candidates = %v, want [web]", got)
+	}
+}
+
+func TestLastActivityTakesLatestSignal(t *testing.T) {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	submitted := base.Add(-2 * time.Hour).UnixNano()
+	job := &nomadapi.Job{SubmitTime: &submitted}
+
+	if got := lastActivity(base.Add(-time.Hour), nil, job); !got.Equal(base.Add(-time.Hour)) {
+		t.Fatalf("last access should win, got %s", got)
+	}
+	wake := &model.WakeEvent{Action: model.WakeActionWake, CreatedAt: base.Add(-10 * time.Minute)}
+	if got := lastActivity(base.Add(-time.Hour), wake, job); !got.Equal(wake.CreatedAt) {
+		t.Fatalf("recent wake should win, got %s", got)
+	}
+	if got := lastActivity(time.Time{}, nil, job); !got.Equal(time.Unix(0, submitted)) {
+		t.Fatalf("submit time should be the fallback, got %s", got)
+	}
+}
+
+func TestReconcileLiveStateKeepsSleepingProcessAtZero(t *testing.T) {
+	spec := &model.InfraSpec{
+		App:       "tools",
+		Endpoints: []model.Endpoint{{URL: "https://tools.example.com"}},
+		Processes: map[string]model.Process{
+			"web": {Port: 8080, Scaling: &model.Scaling{Min: 1, ScaleToZero: true}},
+		},
+	}
+	live := nomad.Translate(spec, "tools:abc", nil)
+	zero := 0
+	live.TaskGroups[0].Count = &zero
+
+	desired := nomad.Translate(spec, "tools:abc", nil)
+	reconcileLiveState(spec, desired, live)
+	if changes := nomad.DiffJobs(desired, live); len(changes) != 0 {
+		t.Fatalf("sleeping process reported as drift: %+v", changes)
+	}
+}
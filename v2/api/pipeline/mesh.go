@@ -0,0 +1,95 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	"norn/v2/api/consul"
+	"norn/v2/api/model"
+	"norn/v2/api/saga"
+)
+
+// meshSteps grants the processes' upstreams before submit and prunes the
+// intentions they no longer declare once the new version is healthy and
+// promoted. With Consul configured the prune also runs for apps without a
+// mesh block, so an app that leaves the mesh loses its managed intentions.
+func (p *Pipeline) meshSteps(spec *model.InfraSpec, steps []step) []step {
+	if !model.HasMesh(spec) && p.Consul == nil {
+		return steps
+	}
+	out := make([]step, 0, len(steps)+2)
+	for _, s := range steps {
+		switch s.name {
+		case "submit":
+			out = append(out, step{name: "mesh", fn: p.mesh})
+		case "forge":
+			out = append(out, step{name: "mesh-prune", fn: p.meshPrune})
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// mesh adds the Consul intentions derived from the processes' declared
+// upstreams, so the new sidecars may reach them as soon as they start.
+// Upstreams the spec dropped keep their intentions for the running
+// allocations until meshPrune.
+func (p *Pipeline) mesh(ctx context.Context, st *state, sg *saga.Saga) error {
+	if !model.HasMesh(st.spec) {
+		return nil
+	}
+	if p.Consul == nil {
+		return fmt.Errorf("consul is not configured; the service mesh needs it")
+	}
+	jobID := st.spec.JobID()
+	changes, err := p.Consul.GrantIntentions(model.MeshGraph(jobID, st.spec))
+	if err != nil {
+		return err
+	}
+	logIntentionChanges(ctx, sg, changes)
+	return nil
+}
+
+// meshPrune removes the managed intentions of the job's services that the
+// deployed spec no longer declares.
+func (p *Pipeline) meshPrune(ctx context.Context, st *state, sg *saga.Saga) error {
+	if p.Consul == nil {
+		return nil
+	}
+	jobID := st.spec.JobID()
+	changes, err := p.Consul.SyncIntentions(model.MeshServices(jobID, st.spec), model.MeshGraph(jobID, st.spec))
+	if err != nil {
+		return err
+	}
+	logIntentionChanges(ctx, sg, changes)
+	return nil
+}
+
+func logIntentionChanges(ctx context.Context, sg *saga.Saga, changes []consul.IntentionChange) {
+	for _, c := range changes {
+		_ = sg.Log(ctx, "mesh.intention_"+c.Change, fmt.Sprintf("intention %s -> %s %s", c.Source, c.Destination, c.Change), map[string]string{
+			"source":      c.Source,
+			"destination": c.Destination,
+		})
+	}
+}
+
+// removePreviewIntentions drops the intentions the preview's services were
+// granted, whether or not the app still declares a mesh.
+func (p *Pipeline) removePreviewIntentions(ctx context.Context, sg *saga.Saga, pr *model.Preview) error {
+	if p.Consul == nil {
+		return nil
+	}
+	spec, err := p.appSpec(pr.App)
+	if err != nil || spec == nil {
+		return err
+	}
+	changes, err := p.Consul.SyncIntentions(model.MeshServices(pr.JobID, spec), nil)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		sg.Log(ctx, "preview.intention_removed", fmt.Sprintf("removed intention %s -> %s", c.Source, c.Destination), nil)
+	}
+	return nil
+}
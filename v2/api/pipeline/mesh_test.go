@@ -0,0 +1,38 @@
+package pipeline
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"norn/v2/api/model"
+)
+
+func TestMeshStepGrantsBeforeSubmitAndPrunesAfterHealthy(t *testing.T) {
+	p := &Pipeline{}
+	steps := []step{{name: "migrate"}, {name: "submit"}, {name: "healthy"}, {name: "forge"}}
+	spec := &model.InfraSpec{
+		App: "billing",
+		Processes: map[string]model.Process{
+			"web": {Port: 8080, Mesh: &model.MeshSpec{Upstreams: []model.MeshUpstream{{Service: "ledger-api", LocalPort: 9001}}}},
+		},
+		Volumes: []model.VolumeSpec{{Name: "data", Mount: "/data", Size: "1GiB"}},
+	}
+	var names []string
+	for _, s := range p.meshSteps(spec, p.volumeSteps(spec, steps)) {
+		names = append(names, s.name)
+	}
+	if got := strings.Join(names, ","); got != "migrate,volumes,mesh,submit,healthy,mesh-prune,forge" {
+		t.Fatalf("steps = %s", got)
+	}
+	if got := len(p.meshSteps(&model.InfraSpec{Processes: map[string]model.Process{"web": {Port: 8080}}}, steps)); got != len(steps) {
+		t.Fatalf("spec without mesh got %d steps", got)
+	}
+
+	if err := p.mesh(context.Background(), &state{spec: spec}, nil); err == nil || !strings.Contains(err.Error(), "consul") {
+		t.Fatalf("mesh without consul = %v", err)
+	}
+	if err := p.meshPrune(context.Background(), &state{spec: spec}, nil); err != nil {
+		t.Fatalf("prune without consul = %v", err)
+	}
+}
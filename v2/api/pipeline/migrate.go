@@ -3,22 +3,293 @@ package pipeline
 import (
 	"context"
 	"fmt"
+	"os"
 	"os/exec"
+	"strconv"
+	"strings"
 
+	"norn/v2/api/model"
 	"norn/v2/api/saga"
 )
 
+// migrationRecord is what the migrate step applied, kept so a later failure
+// can revert it.
+type migrationRecord struct {
+	Database    string
+	FromVersion string
+	ToVersion   string
+}
+
 func (p *Pipeline) migrate(ctx context.Context, st *state, sg *saga.Saga) error {
-	if st.spec.Migrations == "" {
+	m := st.spec.Migrations
+	if m == nil || m.Up == "" {
 		return nil // skip
 	}
-	cmd := exec.CommandContext(ctx, "sh", "-c", st.spec.Migrations)
-	if st.workDir != "" {
-		cmd.Dir = st.workDir
+	if st.spec.InheritsDatabase() {
+		_ = sg.Log(ctx, "migration.skipped", fmt.Sprintf("environment %s shares the default environment's database; not migrating it", st.spec.Environment), nil)
+		return nil
 	}
-	out, err := cmd.CombinedOutput()
+	db := st.spec.MigrationDatabase()
+	rec := &migrationRecord{Database: db}
+
+	if m.Version != "" {
+		from, err := runMigrationCommand(ctx, st.workDir, m, m.Version, db, nil)
+		if err != nil {
+			return fmt.Errorf("migration version: %s", from)
+		}
+		rec.FromVersion = lastLine(from)
+	}
+
+	if m.Plan != "" {
+		out, err := runMigrationCommand(ctx, st.workDir, m, m.Plan, db, nil)
+		if err != nil {
+			return fmt.Errorf("migration plan failed: %s", out)
+		}
+		_ = sg.Log(ctx, "migration.plan", fmt.Sprintf("migration plan for %s", db), map[string]string{
+			"database":    db,
+			"fromVersion": rec.FromVersion,
+			"plan":        truncateOutput(out, 4096),
+		})
+	}
+
+	out, err := runMigrationCommand(ctx, st.workDir, m, m.Up, db, nil)
 	if err != nil {
-		return fmt.Errorf("migration failed: %s", string(out))
+		return fmt.Errorf("migration failed: %s", out)
+	}
+	st.migration = rec
+
+	if m.Version != "" {
+		to, err := runMigrationCommand(ctx, st.workDir, m, m.Version, db, nil)
+		if err == nil {
+			rec.ToVersion = lastLine(to)
+		}
 	}
+	_ = sg.Log(ctx, "migration.applied", migrationAppliedMessage(rec), map[string]string{
+		"database":    db,
+		"fromVersion": rec.FromVersion,
+		"toVersion":   rec.ToVersion,
+		"commitSha":   st.commitSHA,
+	})
 	return nil
 }
+
+func migrationAppliedMessage(rec *migrationRecord) string {
+	switch {
+	case rec.FromVersion != "" && rec.ToVersion != "" && rec.FromVersion != rec.ToVersion:
+		return fmt.Sprintf("migrated %s from %s to %s", rec.Database, rec.FromVersion, rec.ToVersion)
+	case rec.ToVersion != "":
+		return fmt.Sprintf("migrations applied to %s (version %s)", rec.Database, rec.ToVersion)
+	default:
+		return fmt.Sprintf("migrations applied to %s", rec.Database)
+	}
+}
+
+// revertMigration undoes the migrate step after a later step fails, using
+// the app's onFailure policy. A failed down-migration is logged and left
+// for an operator; only the restore policy replaces the database with the
+// pre-deploy snapshot, since that discards every write made since.
+func (p *Pipeline) revertMigration(ctx context.Context, st *state, sg *saga.Saga, failedStep string) {
+	m := st.spec.Migrations
+	rec := st.migration
+	if m == nil || rec == nil {
+		return
+	}
+	meta := map[string]string{
+		"database":      rec.Database,
+		"fromVersion":   rec.FromVersion,
+		"toVersion":     rec.ToVersion,
+		"failedStep":    failedStep,
+		"targetVersion": rec.FromVersion,
+	}
+
+	policy := m.RevertPolicy()
+	if policy == model.MigrationRevertNone {
+		_ = sg.Log(ctx, "migration.revert_skipped", fmt.Sprintf("deploy failed at %s; migrations left applied (onFailure: none)", failedStep), meta)
+		return
+	}
+	if rec.FromVersion != "" && rec.FromVersion == rec.ToVersion {
+		_ = sg.Log(ctx, "migration.revert_skipped", fmt.Sprintf("deploy failed at %s; %s stayed at version %s, nothing to revert", failedStep, rec.Database, rec.ToVersion), meta)
+		return
+	}
+
+	if policy == model.MigrationRevertDown {
+		meta["method"] = "down"
+		if m.Down == "" {
+			_ = sg.Log(ctx, "migration.revert_failed", fmt.Sprintf("onFailure down but no down command; %s left at version %s", rec.Database, rec.ToVersion), meta)
+			return
+		}
+		out, err := runMigrationCommand(ctx, st.workDir, m, m.Down, rec.Database, migrationTargetEnv(rec.FromVersion))
+		if err != nil {
+			meta["downError"] = truncateOutput(out, 1024)
+			_ = sg.Log(ctx, "migration.revert_failed", fmt.Sprintf("down-migration on %s failed; schema left as is: %s", rec.Database, truncateOutput(out, 512)), meta)
+			return
+		}
+		_ = sg.Log(ctx, "migration.reverted", fmt.Sprintf("ran down-migration on %s after %s failed", rec.Database, failedStep), meta)
+		return
+	}
+
+	if st.snapshotFile == "" {
+		_ = sg.Log(ctx, "migration.revert_failed", fmt.Sprintf("no pre-deploy snapshot of %s to restore", rec.Database), meta)
+		return
+	}
+	meta["snapshot"] = st.snapshotFile
+	if st.snapshotDB != rec.Database {
+		// The snapshot holds a different database; restoring it over the
+		// migrated one would replace that database's data wholesale.
+		meta["snapshotDatabase"] = st.snapshotDB
+		_ = sg.Log(ctx, "migration.revert_failed", fmt.Sprintf("pre-deploy snapshot %s is of %s, not %s; restore %s by hand", st.snapshotFile, st.snapshotDB, rec.Database, rec.Database), meta)
+		return
+	}
+	meta["method"] = "restore"
+	if out, err := restoreSnapshot(ctx, rec.Database, st.snapshotFile); err != nil {
+		meta["restoreError"] = truncateOutput(out, 1024)
+		_ = sg.Log(ctx, "migration.revert_failed", fmt.Sprintf("restoring %s from %s failed: %v", rec.Database, st.snapshotFile, err), meta)
+		return
+	}
+	_ = sg.Log(ctx, "migration.restored", fmt.Sprintf("restored %s from pre-deploy snapshot %s after %s failed", rec.Database, st.snapshotFile, failedStep), meta)
+}
+
+// rollbackMigration runs the down-migration to the schema version recorded
+// for the deployment being rolled back to. The commands run in a checkout
+// of the currently deployed commit, whose migrations are the ones being
+// undone.
+func (p *Pipeline) rollbackMigration(ctx context.Context, spec *model.InfraSpec, deploy *model.Deployment, currentID string, sg *saga.Saga) error {
+	m := spec.Migrations
+	if spec.InheritsDatabase() {
+		_ = sg.Log(ctx, "migration.rollback_skipped", fmt.Sprintf("environment %s shares the default environment's database; schema left as is", spec.Environment), nil)
+		return nil
+	}
+	target, ok := p.appliedMigrationVersion(ctx, deploy.SourceRef)
+	if !ok {
+		_ = sg.Log(ctx, "migration.rollback_skipped", "no recorded migration version for the target deployment; schema left as is", map[string]string{
+			"sourceDeploymentId": deploy.SourceRef,
+		})
+		return nil
+	}
+	if currentID == "" {
+		return fmt.Errorf("rollback does not name the current deployment to run its down-migration from")
+	}
+	current, err := p.DB.GetDeployment(ctx, currentID)
+	if err != nil {
+		return fmt.Errorf("load current deployment %s: %w", currentID, err)
+	}
+	dir, err := p.checkoutCommit(ctx, spec, current.CommitSHA)
+	if err != nil {
+		return fmt.Errorf("check out %s for down-migration: %w", current.CommitSHA, err)
+	}
+	defer os.RemoveAll(dir)
+
+	db := spec.MigrationDatabase()
+	if m.Version != "" {
+		out, err := runMigrationCommand(ctx, dir, m, m.Version, db, nil)
+		if err == nil && lastLine(out) == target {
+			_ = sg.Log(ctx, "migration.rollback_skipped", fmt.Sprintf("%s already at version %s", db, target), map[string]string{
+				"database":      db,
+				"targetVersion": target,
+			})
+			return nil
+		}
+	}
+	out, err := runMigrationCommand(ctx, dir, m, m.Down, db, migrationTargetEnv(target))
+	if err != nil {
+		return fmt.Errorf("down-migration to %s failed: %s", target, out)
+	}
+	_ = sg.Log(ctx, "migration.reverted", fmt.Sprintf("migrated %s down to version %s", db, target), map[string]string{
+		"database":            db,
+		"targetVersion":       target,
+		"method":              "down",
+		"sourceDeploymentId":  deploy.SourceRef,
+		"currentDeploymentId": currentID,
+		"commitSha":           current.CommitSHA,
+	})
+	return nil
+}
+
+// appliedMigrationVersion returns the schema version a deployment left
+// behind, from the last migration.applied event in its saga.
+func (p *Pipeline) appliedMigrationVersion(ctx context.Context, deploymentID string) (string, bool) {
+	if deploymentID == "" || p.SagaStore == nil {
+		return "", false
+	}
+	prev, err := p.DB.GetDeployment(ctx, deploymentID)
+	if err != nil || prev.SagaID == "" {
+		return "", false
+	}
+	events, err := p.SagaStore.ListBySaga(ctx, prev.SagaID)
+	if err != nil {
+		return "", false
+	}
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Action == "migration.applied" && events[i].Metadata["toVersion"] != "" {
+			return events[i].Metadata["toVersion"], true
+		}
+	}
+	return "", false
+}
+
+// runMigrationCommand runs one migration command from the source tree with
+// the target database exported as PGDATABASE and NORN_MIGRATION_DATABASE.
+func runMigrationCommand(ctx context.Context, dir string, m *model.MigrationSpec, command, db string, env []string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.TimeoutDuration())
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	if dir != "" {
+		cmd.Dir = dir
+	}
+	cmd.Env = os.Environ()
+	if db != "" {
+		cmd.Env = append(cmd.Env, "PGDATABASE="+db, "NORN_MIGRATION_DATABASE="+db)
+	}
+	cmd.Env = append(cmd.Env, env...)
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Sprintf("timed out after %s", m.TimeoutDuration()), ctx.Err()
+	}
+	return string(out), err
+}
+
+func migrationTargetEnv(version string) []string {
+	if version == "" {
+		return nil
+	}
+	return []string{"MIGRATION_TARGET_VERSION=" + version}
+}
+
+func restoreSnapshot(ctx context.Context, db, file string) (string, error) {
+	cmd := exec.CommandContext(ctx, "pg_restore", "--clean", "--if-exists", "-d", db, file)
+	out, err := cmd.CombinedOutput()
+	// pg_restore exits 1 whenever it carried on past an error, and those
+	// errors can be rows or objects it failed to restore, so only a clean
+	// exit counts as restored.
+	if err != nil {
+		if n := ignoredRestoreErrors(string(out)); n > 0 {
+			return string(out), fmt.Errorf("pg_restore ignored %d errors: %w", n, err)
+		}
+	}
+	return string(out), err
+}
+
+// ignoredRestoreErrors reads the "errors ignored on restore: N" summary
+// pg_restore prints when it finishes despite errors.
+func ignoredRestoreErrors(out string) int {
+	const marker = "errors ignored on restore: "
+	i := strings.LastIndex(out, marker)
+	if i < 0 {
+		return 0
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(strings.SplitN(out[i+len(marker):], "\n", 2)[0]))
+	return n
+}
+
+func lastLine(out string) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+func truncateOutput(out string, max int) string {
+	out = strings.TrimSpace(out)
+	if len(out) <= max {
+		return out
+	}
+	return out[:max] + "…"
+}
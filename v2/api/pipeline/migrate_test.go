@@ -0,0 +1,268 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"norn/v2/api/model"
+	"norn/v2/api/saga"
+)
+
+type memorySagaStore struct {
+	events []saga.Event
+}
+
+func (m *memorySagaStore) Append(_ context.Context, evt *saga.Event) error {
+	m.events = append(m.events, *evt)
+	return nil
+}
+
+func (m *memorySagaStore) ListBySaga(_ context.Context, id string) ([]saga.Event, error) {
+	var out []saga.Event
+	for _, evt := range m.events {
+		if evt.SagaID == id {
+			out = append(out, evt)
+		}
+	}
+	return out, nil
+}
+
+func (m *memorySagaStore) ListByApp(context.Context, string, int) ([]saga.Event, error) {
+	return m.events, nil
+}
+
+func (m *memorySagaStore) ListRecent(context.Context, int) ([]saga.Event, error) {
+	return m.events, nil
+}
+
+func (m *memorySagaStore) find(action string) *saga.Event {
+	for i := range m.events {
+		if m.events[i].Action == action {
+			return &m.events[i]
+		}
+	}
+	return nil
+}
+
+// migrationFixture fakes a migration tool that keeps its version in a file.
+func migrationFixture(t *testing.T) (string, *model.MigrationSpec) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "version"), []byte("3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir, &model.MigrationSpec{
+		Up:        "echo 5 > version",
+		Down:      `echo "${MIGRATION_TARGET_VERSION:-0} $PGDATABASE" > down.log && echo "${MIGRATION_TARGET_VERSION:-0}" > version`,
+		Plan:      "echo 'apply 004, 005'",
+		Version:   "cat version",
+		OnFailure: model.MigrationRevertDown,
+	}
+}
+
+func TestMigrateRecordsAppliedVersions(t *testing.T) {
+	dir, m := migrationFixture(t)
+	store := &memorySagaStore{}
+	sg := saga.New(store, "orders", "pipeline", "deploy")
+	st := &state{
+		spec:      &model.InfraSpec{App: "orders", Migrations: m, Infrastructure: &model.Infrastructure{Postgres: &model.PostgresInfra{Database: "orders"}}},
+		workDir:   dir,
+		commitSHA: "abc123",
+	}
+
+	if err := (&Pipeline{}).migrate(context.Background(), st, sg); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if st.migration == nil || st.migration.FromVersion != "3" || st.migration.ToVersion != "5" {
+		t.Fatalf("migration = %+v, want 3 -> 5", st.migration)
+	}
+	applied := store.find("migration.applied")
+	if applied == nil || applied.Metadata["fromVersion"] != "3" || applied.Metadata["toVersion"] != "5" || applied.Metadata["database"] != "orders" {
+		t.Fatalf("migration.applied = %+v", applied)
+	}
+	if plan := store.find("migration.plan"); plan == nil || !strings.Contains(plan.Metadata["plan"], "apply 004") {
+		t.Fatalf("migration.plan = %+v", plan)
+	}
+}
+
+func TestRevertMigrationRunsDownToPreviousVersion(t *testing.T) {
+	dir, m := migrationFixture(t)
+	store := &memorySagaStore{}
+	sg := saga.New(store, "orders", "pipeline", "deploy")
+	st := &state{
+		spec:      &model.InfraSpec{App: "orders", Migrations: m, Infrastructure: &model.Infrastructure{Postgres: &model.PostgresInfra{Database: "orders"}}},
+		workDir:   dir,
+		migration: &migrationRecord{Database: "orders", FromVersion: "3", ToVersion: "5"},
+	}
+
+	(&Pipeline{}).revertMigration(context.Background(), st, sg, "healthy")
+
+	got, err := os.ReadFile(filepath.Join(dir, "down.log"))
+	if err != nil {
+		t.Fatalf("down-migration did not run: %v", err)
+	}
+	if strings.TrimSpace(string(got)) != "3 orders" {
+		t.Fatalf("down.log = %q, want target 3 on orders", got)
+	}
+	if evt := store.find("migration.reverted"); evt == nil || evt.Metadata["method"] != "down" {
+		t.Fatalf("migration.reverted = %+v", evt)
+	}
+}
+
+func TestRevertMigrationHonoursNonePolicy(t *testing.T) {
+	dir, m := migrationFixture(t)
+	m.OnFailure = model.MigrationRevertNone
+	store := &memorySagaStore{}
+	st := &state{
+		spec:      &model.InfraSpec{App: "orders", Migrations: m},
+		workDir:   dir,
+		migration: &migrationRecord{Database: "orders", FromVersion: "3", ToVersion: "5"},
+	}
+
+	(&Pipeline{}).revertMigration(context.Background(), st, saga.New(store, "orders", "pipeline", "deploy"), "submit")
+
+	if _, err := os.Stat(filepath.Join(dir, "down.log")); err == nil {
+		t.Fatal("down-migration ran with onFailure none")
+	}
+	if store.find("migration.revert_skipped") == nil {
+		t.Fatalf("events = %+v, want migration.revert_skipped", store.events)
+	}
+}
+
+func TestRevertMigrationSkipsUnchangedVersion(t *testing.T) {
+	dir, m := migrationFixture(t)
+	m.OnFailure = model.MigrationRevertRestore
+	store := &memorySagaStore{}
+	st := &state{
+		spec:         &model.InfraSpec{App: "orders", Migrations: m},
+		workDir:      dir,
+		snapshotFile: "snapshots/orders_abc123.dump",
+		snapshotDB:   "orders",
+		migration:    &migrationRecord{Database: "orders", FromVersion: "5", ToVersion: "5"},
+	}
+
+	(&Pipeline{}).revertMigration(context.Background(), st, saga.New(store, "orders", "pipeline", "deploy"), "healthy")
+
+	if store.find("migration.restored") != nil || store.find("migration.revert_failed") != nil {
+		t.Fatalf("events = %+v, want no restore when no migration was applied", store.events)
+	}
+	if store.find("migration.revert_skipped") == nil {
+		t.Fatalf("events = %+v, want migration.revert_skipped", store.events)
+	}
+}
+
+func TestRevertMigrationStopsWhenDownFails(t *testing.T) {
+	dir, m := migrationFixture(t)
+	m.Down = "exit 1"
+	store := &memorySagaStore{}
+	st := &state{
+		spec:         &model.InfraSpec{App: "orders", Migrations: m},
+		workDir:      dir,
+		snapshotFile: "snapshots/orders_abc123.dump",
+		snapshotDB:   "orders",
+		migration:    &migrationRecord{Database: "orders", FromVersion: "3", ToVersion: "5"},
+	}
+
+	(&Pipeline{}).revertMigration(context.Background(), st, saga.New(store, "orders", "pipeline", "deploy"), "healthy")
+
+	if len(store.events) != 1 {
+		t.Fatalf("events = %+v, want a single migration.revert_failed", store.events)
+	}
+	if evt := store.events[0]; evt.Action != "migration.revert_failed" || evt.Metadata["method"] != "down" || evt.Metadata["snapshot"] != "" {
+		t.Fatalf("event = %+v, want the failed down-migration without a restore", evt)
+	}
+}
+
+func TestRevertMigrationRefusesSnapshotOfAnotherDatabase(t *testing.T) {
+	dir, m := migrationFixture(t)
+	m.OnFailure = model.MigrationRevertRestore
+	store := &memorySagaStore{}
+	st := &state{
+		spec:         &model.InfraSpec{App: "orders", Migrations: m},
+		workDir:      dir,
+		snapshotFile: "snapshots/orders_abc123.dump",
+		snapshotDB:   "orders",
+		migration:    &migrationRecord{Database: "orders_events", FromVersion: "3", ToVersion: "5"},
+	}
+
+	(&Pipeline{}).revertMigration(context.Background(), st, saga.New(store, "orders", "pipeline", "deploy"), "healthy")
+
+	if store.find("migration.restored") != nil {
+		t.Fatal("restored a snapshot of orders into orders_events")
+	}
+	var refused bool
+	for _, evt := range store.events {
+		if evt.Action == "migration.revert_failed" && evt.Metadata["snapshotDatabase"] == "orders" {
+			refused = true
+		}
+	}
+	if !refused {
+		t.Fatalf("events = %+v, want migration.revert_failed naming the snapshot's database", store.events)
+	}
+}
+
+func TestRestoreSnapshotFailsWhenErrorsWereIgnored(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho 'pg_restore: error: could not execute query: ERROR:  relation \"refunds\" does not exist' >&2\necho 'pg_restore: warning: errors ignored on restore: 2' >&2\nexit 1\n"
+	if err := os.WriteFile(filepath.Join(dir, "pg_restore"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	_, err := restoreSnapshot(context.Background(), "orders", "snapshots/orders_abc123.dump")
+	if err == nil || !strings.Contains(err.Error(), "ignored 2 errors") {
+		t.Fatalf("err = %v, want the ignored errors reported", err)
+	}
+}
+
+func TestCheckoutCommitRefusesMovedLocalSource(t *testing.T) {
+	appsDir := t.TempDir()
+	src := filepath.Join(appsDir, "orders")
+	if err := os.MkdirAll(filepath.Join(src, "migrations"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "migrations", "005.down.sql"), []byte("drop table refunds;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := &Pipeline{AppsDir: appsDir}
+	spec := &model.InfraSpec{App: "orders"}
+
+	dir, err := p.checkoutCommit(context.Background(), spec, "local-20260101120000")
+	if err != nil {
+		t.Fatalf("checkoutCommit: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := os.Stat(filepath.Join(dir, "migrations", "005.down.sql")); err != nil {
+		t.Fatalf("checkout is missing the source: %v", err)
+	}
+
+	if dir, err := p.checkoutCommit(context.Background(), spec, "abc123"); err == nil {
+		os.RemoveAll(dir)
+		t.Fatal("checked out abc123 from a tree that is not a git checkout of it")
+	}
+}
+
+func TestMigrateSkipsEnvironmentSharingTheDefaultDatabase(t *testing.T) {
+	dir, m := migrationFixture(t)
+	store := &memorySagaStore{}
+	st := &state{
+		spec: &model.InfraSpec{
+			App:            "orders",
+			Environment:    "staging",
+			Environments:   map[string]model.EnvironmentSpec{"production": {Default: true}, "staging": {}},
+			Migrations:     m,
+			Infrastructure: &model.Infrastructure{Postgres: &model.PostgresInfra{Database: "orders"}},
+		},
+		workDir: dir,
+	}
+
+	if err := (&Pipeline{}).migrate(context.Background(), st, saga.New(store, "orders", "pipeline", "deploy")); err != nil {
+		t.Fatal(err)
+	}
+	if st.migration != nil || store.find("migration.skipped") == nil {
+		t.Fatalf("migration = %+v, events = %+v; staging must not migrate production's database", st.migration, store.events)
+	}
+}
@@ -10,10 +10,13 @@ import (
 	"github.com/google/uuid"
 
 	"norn/v2/api/beacon"
+	"norn/v2/api/builder"
 	"norn/v2/api/consul"
+	"norn/v2/api/forge"
 	"norn/v2/api/hub"
 	"norn/v2/api/model"
 	"norn/v2/api/nomad"
+	"norn/v2/api/prometheus"
 	"norn/v2/api/redpanda"
 	"norn/v2/api/saga"
 	"norn/v2/api/secrets"
@@ -30,12 +33,22 @@ type Pipeline struct {
 	Secrets     *secrets.Manager
 	AppsDir     string
 	GitToken    string
+	PublicURL   string // Norn UI address used in links posted to forges
 	GitSSHKey   string
 	RegistryURL string
 	NetworkMode string
 	Beacon      *beacon.Service
 	Storage     *storage.Client
 	Redpanda    *redpanda.Client
+	// Prometheus answers windowed tuning signals and canary queries; nil
+	// when NORN_PROMETHEUS_URL is unset.
+	Prometheus *prometheus.Client
+
+	Builder        builder.Config
+	BuildPlatforms []string // pushed-image platforms when build.platforms is unset
+
+	// Forge overrides the forge API clients built from GitToken.
+	Forge func(provider string) (forge.Client, error)
 }
 
 type state struct {
@@ -49,6 +62,9 @@ type state struct {
 	sourceChanges []string
 	sourceRef     string
 	preflight     bool
+	snapshotFile  string
+	snapshotDB    string // database snapshotFile holds
+	migration     *migrationRecord
 }
 
 type step struct {
@@ -58,22 +74,61 @@ type step struct {
 
 // Run executes the full deploy pipeline for an app.
 // Returns the saga ID for event tracking.
-func (p *Pipeline) Run(spec *model.InfraSpec, ref string) string {
-	sg := saga.New(p.SagaStore, spec.App, "pipeline", "deploy")
-	ctx := context.Background()
+func (p *Pipeline) Run(ctx context.Context, spec *model.InfraSpec, ref string) string {
+	_, _, sg := p.enqueueDeploy(ctx, spec, ref, model.OperationQueued, "pipeline", nil)
+	sg.Log(ctx, "deploy.queued", fmt.Sprintf("queued deploy for %s (ref: %s)", spec.App, ref), nil)
+	return sg.ID
+}
 
+// enqueueDeploy records a deployment and its app.deploy operation. Operations
+// inserted as running are owned by the caller and never claimed by the worker.
+func (p *Pipeline) enqueueDeploy(ctx context.Context, spec *model.InfraSpec, ref string, status model.OperationStatus, source string, extra map[string]interface{}) (*model.Deployment, string, *saga.Saga) {
+	// Specs found by name or repo deploy their default environment.
+	if spec.Environment == "" {
+		spec, _ = spec.ForEnvironment("")
+	}
+	sg := saga.New(p.SagaStore, spec.App, "pipeline", "deploy")
 	deploy := &model.Deployment{
-		ID:        uuid.New().String(),
-		App:       spec.App,
-		CommitSHA: ref,
-		SagaID:    sg.ID,
-		Status:    model.StatusQueued,
-		SourceRef: ref,
-		StartedAt: time.Now(),
+		ID:          uuid.New().String(),
+		App:         spec.App,
+		Environment: spec.Environment,
+		CommitSHA:   ref,
+		SagaID:      sg.ID,
+		Status:      model.StatusQueued,
+		SourceRef:   ref,
+		StartedAt:   time.Now(),
 	}
+	operationID := p.queueDeployment(ctx, spec, deploy, sg, ref, status, source, extra)
+	return deploy, operationID, sg
+}
+
+// queueDeployment inserts deploy and the app.deploy operation that runs it.
+func (p *Pipeline) queueDeployment(ctx context.Context, spec *model.InfraSpec, deploy *model.Deployment, sg *saga.Saga, ref string, status model.OperationStatus, source string, extra map[string]interface{}) string {
 	if err := p.DB.InsertDeployment(ctx, deploy); err != nil {
 		log.Printf("pipeline: insert deployment: %v", err)
 	}
+	payload := map[string]interface{}{
+		"deploymentId": deploy.ID,
+		"app":          spec.App,
+		"ref":          ref,
+	}
+	if spec.Environment != "" {
+		payload["environment"] = spec.Environment
+	}
+	if actor := saga.ActorFrom(ctx); actor != "" {
+		payload["actor"] = actor
+	}
+	metadata := map[string]interface{}{
+		"deploymentId": deploy.ID,
+	}
+	for k, v := range extra {
+		payload[k] = v
+		metadata[k] = v
+	}
+	attempts := 0
+	if status == model.OperationRunning {
+		attempts = 1
+	}
 	operationID := uuid.New().String()
 	if err := p.DB.InsertOperation(ctx, &model.Operation{
 		ID:          operationID,
@@ -81,29 +136,31 @@ func (p *Pipeline) Run(spec *model.InfraSpec, ref string) string {
 		App:         spec.App,
 		SagaID:      sg.ID,
 		Ref:         ref,
-		Status:      model.OperationQueued,
+		Status:      status,
 		Risk:        "app rolling update",
-		Source:      "pipeline",
+		Source:      source,
 		Message:     fmt.Sprintf("queued deploy for %s", spec.App),
 		StartedAt:   deploy.StartedAt,
+		Attempts:    attempts,
 		MaxAttempts: 2,
-		Payload: map[string]interface{}{
-			"deploymentId": deploy.ID,
-			"app":          spec.App,
-			"ref":          ref,
-		},
-		Metadata: map[string]interface{}{
-			"deploymentId": deploy.ID,
-		},
+		Payload:     payload,
+		Metadata:    metadata,
 	}); err != nil {
 		log.Printf("pipeline: insert operation: %v", err)
 	}
-
-	sg.Log(ctx, "deploy.queued", fmt.Sprintf("queued deploy for %s (ref: %s)", spec.App, ref), nil)
-	return sg.ID
+	return operationID
 }
 
 func (p *Pipeline) ExecuteOperation(ctx context.Context, op *model.Operation) error {
+	// Saga events carry whoever queued the operation.
+	ctx = saga.WithActor(ctx, stringFromMap(op.Payload, "actor"))
+	switch op.Kind {
+	case "group.deploy":
+		return p.runGroup(ctx, op)
+	case "preview.teardown":
+		return p.runPreviewTeardown(ctx, op)
+	}
+
 	specs, err := model.DiscoverApps(p.AppsDir)
 	if err != nil {
 		return fmt.Errorf("discover apps: %w", err)
@@ -118,10 +175,21 @@ func (p *Pipeline) ExecuteOperation(ctx context.Context, op *model.Operation) er
 	if spec == nil {
 		return fmt.Errorf("app %s not found", op.App)
 	}
+	if number, _ := strconv.Atoi(stringFromMap(op.Payload, "preview")); number > 0 {
+		spec, err = spec.ForPreview(number)
+	} else {
+		spec, err = spec.ForEnvironment(stringFromMap(op.Payload, "environment"))
+	}
+	if err != nil {
+		return err
+	}
 
 	category := "deploy"
-	if op.Kind == "app.preflight" {
+	switch op.Kind {
+	case "app.preflight":
 		category = "preflight"
+	case CredentialRotationKind:
+		category = "credentials"
 	}
 	sg := saga.NewWithID(p.SagaStore, op.SagaID, spec.App, "pipeline", category)
 
@@ -169,7 +237,7 @@ func (p *Pipeline) ExecuteOperation(ctx context.Context, op *model.Operation) er
 			"deploymentId": deploymentID,
 			"attempt":      strconv.Itoa(op.Attempts),
 		})
-		p.runRollback(ctx, spec, deploy, sg, imageTag, op.ID, op.Attempts)
+		p.runRollback(ctx, spec, deploy, sg, imageTag, stringFromMap(op.Payload, "currentDeploymentId"), op.ID, op.Attempts)
 		return nil
 	case "app.preflight":
 		sg.Log(ctx, "preflight.start", fmt.Sprintf("preflighting %s (ref: %s)", spec.App, op.Ref), map[string]string{
@@ -178,6 +246,8 @@ func (p *Pipeline) ExecuteOperation(ctx context.Context, op *model.Operation) er
 		})
 		p.runPreflight(ctx, spec, op.Ref, sg, op.ID)
 		return nil
+	case CredentialRotationKind:
+		return p.runCredentialRotation(ctx, spec, sg, op)
 	default:
 		return fmt.Errorf("unsupported operation kind %s", op.Kind)
 	}
@@ -220,6 +290,19 @@ func (p *Pipeline) run(ctx context.Context, spec *model.InfraSpec, deploy *model
 		{name: "cleanup", fn: p.cleanup},
 	}
 
+	// A promotion ships an image another environment already built and tested.
+	if deploy.PromotedFrom != "" {
+		st.imageTag = deploy.ImageTag
+		steps = promotionSteps(spec, steps)
+	}
+	if spec.Preview != nil {
+		steps = p.previewSteps(steps)
+		p.previewStarted(ctx, spec, deploy, sg)
+	}
+
+	steps = p.volumeSteps(spec, steps)
+	steps = p.meshSteps(spec, steps)
+
 	// Insert canary step between healthy and forge when any process has canary config
 	if hasCanaryConfig(spec) {
 		var withCanary []step
@@ -232,6 +315,7 @@ func (p *Pipeline) run(ctx context.Context, spec *model.InfraSpec, deploy *model
 		steps = withCanary
 	}
 
+	report := p.newCommitReporter(spec, sg, "deploy", steps)
 	total := fmt.Sprintf("%d", len(steps))
 	for i, s := range steps {
 		idx := fmt.Sprintf("%d", i+1)
@@ -262,6 +346,7 @@ func (p *Pipeline) run(ctx context.Context, spec *model.InfraSpec, deploy *model
 				"total":      total,
 				"durationMs": fmt.Sprintf("%d", elapsed),
 			}})
+			report.stepFinished(ctx, st, s.name, err)
 			deploy.Status = model.StatusFailed
 			p.DB.UpdateDeployment(ctx, deploy.ID, deploy.Status)
 			if operationID != "" {
@@ -292,15 +377,24 @@ func (p *Pipeline) run(ctx context.Context, spec *model.InfraSpec, deploy *model
 				},
 			})
 
+			// Revert the schema when the new code never became healthy.
+			switch s.name {
+			case "submit", "healthy", "canary":
+				p.revertMigration(ctx, st, sg, s.name)
+			}
+
+			p.previewFinished(ctx, spec, deploy, sg, fmt.Errorf("%s: %w", s.name, err))
+			report.finished(ctx, s.name, err)
+
 			// Auto-rollback: only when the healthy step fails and policy allows
-			if s.name == "healthy" && spec.AutoRollbackEnabled() {
-				prev, prevErr := p.DB.LastSuccessfulDeployment(ctx, deploy.App, deploy.ID)
+			if s.name == "healthy" && spec.AutoRollbackEnabled() && spec.Preview == nil {
+				prev, prevErr := p.DB.LastSuccessfulDeployment(ctx, deploy.App, spec.HistoryEnvironments(), deploy.ID)
 				if prevErr == nil && prev != nil {
 					sg.Log(ctx, "deploy.auto_rollback.start", fmt.Sprintf("auto-rollback %s to %s", spec.App, prev.ImageTag), map[string]string{
 						"previousDeploymentId": prev.ID,
 						"imageTag":             prev.ImageTag,
 					})
-					p.Rollback(spec, *deploy, prev)
+					p.Rollback(ctx, spec, *deploy, prev)
 					p.emitBeacon(ctx, model.BeaconEvent{
 						App:       spec.App,
 						Type:      "deploy.auto_rollback",
@@ -325,6 +419,7 @@ func (p *Pipeline) run(ctx context.Context, spec *model.InfraSpec, deploy *model
 		p.recordDeploymentStepFinish(ctx, deploy.ID, s.name, model.DeploymentStepComplete, elapsed, "", map[string]interface{}{
 			"operationId": operationID,
 		})
+		report.stepFinished(ctx, st, s.name, nil)
 		p.WS.Broadcast(hub.Event{Type: "deploy.step", AppID: spec.App, Payload: map[string]string{
 			"step":       s.name,
 			"sagaId":     sg.ID,
@@ -335,31 +430,36 @@ func (p *Pipeline) run(ctx context.Context, spec *model.InfraSpec, deploy *model
 		}})
 	}
 
-	deploy.CommitSHA = st.commitSHA
-	deploy.ImageTag = st.imageTag
-	deploy.SourceKind = st.sourceKind
-	deploy.SourceRef = st.sourceRef
-	deploy.SourceDirty = st.sourceDirty
-	deploy.SourceChanges = st.sourceChanges
+	// Promotions keep the provenance recorded when the image was built.
+	if deploy.PromotedFrom == "" {
+		deploy.CommitSHA = st.commitSHA
+		deploy.ImageTag = st.imageTag
+		deploy.SourceKind = st.sourceKind
+		deploy.SourceRef = st.sourceRef
+		deploy.SourceDirty = st.sourceDirty
+		deploy.SourceChanges = st.sourceChanges
+	}
 	deploy.Status = model.StatusDeployed
 	p.DB.UpdateDeploymentResult(ctx, deploy)
 	if operationID != "" {
 		_ = p.DB.FinishOperation(ctx, operationID, model.OperationSucceeded, fmt.Sprintf("deploy complete: %s", spec.App), map[string]interface{}{
 			"deploymentId": deploy.ID,
-			"commitSha":    st.commitSHA,
-			"imageTag":     st.imageTag,
+			"commitSha":    deploy.CommitSHA,
+			"imageTag":     deploy.ImageTag,
 		})
 	}
-	sg.Log(ctx, "deploy.complete", fmt.Sprintf("deploy complete: %s → %s", spec.App, st.imageTag), map[string]string{
-		"commitSha":  st.commitSHA,
-		"imageTag":   st.imageTag,
-		"sourceKind": st.sourceKind,
-		"sourceRef":  st.sourceRef,
+	sg.Log(ctx, "deploy.complete", fmt.Sprintf("deploy complete: %s → %s", spec.App, deploy.ImageTag), map[string]string{
+		"commitSha":  deploy.CommitSHA,
+		"imageTag":   deploy.ImageTag,
+		"sourceKind": deploy.SourceKind,
+		"sourceRef":  deploy.SourceRef,
 	})
 	p.WS.Broadcast(hub.Event{Type: "deploy.completed", AppID: spec.App, Payload: map[string]string{
 		"sagaId":   sg.ID,
-		"imageTag": st.imageTag,
+		"imageTag": deploy.ImageTag,
 	}})
+	p.previewFinished(ctx, spec, deploy, sg, nil)
+	report.finished(ctx, "", nil)
 	p.emitBeacon(ctx, model.BeaconEvent{
 		App:       spec.App,
 		Type:      "deploy.succeeded",
@@ -370,10 +470,10 @@ func (p *Pipeline) run(ctx context.Context, spec *model.InfraSpec, deploy *model
 		Metadata: map[string]interface{}{
 			"deploymentId":   deploy.ID,
 			"sagaId":         sg.ID,
-			"commitSha":      st.commitSHA,
-			"imageTag":       st.imageTag,
-			"sourceKind":     st.sourceKind,
-			"sourceRef":      st.sourceRef,
+			"commitSha":      deploy.CommitSHA,
+			"imageTag":       deploy.ImageTag,
+			"sourceKind":     deploy.SourceKind,
+			"sourceRef":      deploy.SourceRef,
 			"correlationKey": fmt.Sprintf("%s:deploy", spec.App),
 		},
 	})
@@ -423,3 +523,9 @@ func hasCanaryConfig(spec *model.InfraSpec) bool {
 	}
 	return false
 }
+
+// secretsFor returns the secrets manager for the spec's backend and
+// environment.
+func (p *Pipeline) secretsFor(spec *model.InfraSpec) *secrets.Manager {
+	return p.Secrets.For(spec)
+}
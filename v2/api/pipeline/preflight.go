@@ -12,6 +12,7 @@ import (
 
 	"github.com/google/uuid"
 
+	"norn/v2/api/builder"
 	"norn/v2/api/hub"
 	"norn/v2/api/model"
 	"norn/v2/api/saga"
@@ -21,10 +22,19 @@ import (
 // It validates the spec, prepares the same source tree deploy would use, builds
 // the image locally, and runs build.test without snapshot, migration, submit, or
 // forge side effects.
-func (p *Pipeline) Preflight(spec *model.InfraSpec, ref string) string {
+func (p *Pipeline) Preflight(ctx context.Context, spec *model.InfraSpec, ref string) string {
 	sg := saga.New(p.SagaStore, spec.App, "pipeline", "preflight")
-	ctx := context.Background()
 	operationID := uuid.New().String()
+	payload := map[string]interface{}{
+		"app": spec.App,
+		"ref": ref,
+	}
+	if spec.Environment != "" {
+		payload["environment"] = spec.Environment
+	}
+	if actor := saga.ActorFrom(ctx); actor != "" {
+		payload["actor"] = actor
+	}
 	if err := p.DB.InsertOperation(ctx, &model.Operation{
 		ID:          operationID,
 		Kind:        "app.preflight",
@@ -37,10 +47,7 @@ func (p *Pipeline) Preflight(spec *model.InfraSpec, ref string) string {
 		Message:     fmt.Sprintf("queued preflight for %s", spec.App),
 		StartedAt:   time.Now(),
 		MaxAttempts: 3,
-		Payload: map[string]interface{}{
-			"app": spec.App,
-			"ref": ref,
-		},
+		Payload:     payload,
 	}); err != nil {
 		log.Printf("preflight: insert operation: %v", err)
 		operationID = ""
@@ -80,6 +87,7 @@ func (p *Pipeline) runPreflight(ctx context.Context, spec *model.InfraSpec, ref
 		{name: "test", fn: p.test},
 	}
 
+	report := p.newCommitReporter(spec, sg, "preflight", steps)
 	total := fmt.Sprintf("%d", len(steps))
 	for i, s := range steps {
 		idx := fmt.Sprintf("%d", i+1)
@@ -100,11 +108,14 @@ func (p *Pipeline) runPreflight(ctx context.Context, spec *model.InfraSpec, ref
 				})
 			}
 			p.broadcastPreflightDone("preflight.failed", spec.App, sg.ID, map[string]string{"error": err.Error()})
+			report.stepFinished(ctx, st, s.name, err)
+			report.finished(ctx, s.name, err)
 			return
 		}
 
 		sg.StepComplete(ctx, s.name, elapsed)
 		p.broadcastPreflightStep(spec.App, sg.ID, s.name, "complete", idx, total, elapsed)
+		report.stepFinished(ctx, st, s.name, nil)
 	}
 
 	sg.Log(ctx, "preflight.complete", fmt.Sprintf("preflight complete: %s -> %s", spec.App, st.imageTag), map[string]string{
@@ -123,6 +134,7 @@ func (p *Pipeline) runPreflight(ctx context.Context, spec *model.InfraSpec, ref
 		"imageTag":  st.imageTag,
 		"commitSha": st.commitSHA,
 	})
+	report.finished(ctx, "", nil)
 }
 
 func (p *Pipeline) preflightValidate(ctx context.Context, st *state, sg *saga.Saga) error {
@@ -169,6 +181,21 @@ func (p *Pipeline) preflightInspect(ctx context.Context, st *state, sg *saga.Sag
 		if _, err := os.Stat(filepath.Join(st.workDir, dockerfile)); err != nil {
 			return fmt.Errorf("dockerfile %q missing from prepared source: %w", dockerfile, err)
 		}
+		b, err := builder.New(st.spec.Build.Backend, p.Builder)
+		if err != nil {
+			return err
+		}
+		if err := b.Available(); err != nil {
+			return fmt.Errorf("build backend %s unavailable: %w", b.Name(), err)
+		}
+		for _, secret := range st.spec.Build.Secrets {
+			if secret.Src == "" {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(st.workDir, secret.Src)); err != nil {
+				return fmt.Errorf("build secret %s source %q missing from prepared source: %w", secret.ID, secret.Src, err)
+			}
+		}
 	}
 
 	if err := p.checkDeclaredSecrets(st.spec); err != nil {
@@ -201,7 +228,7 @@ func (p *Pipeline) checkDeclaredSecrets(spec *model.InfraSpec) error {
 	if p.Secrets == nil {
 		return fmt.Errorf("secrets declared but no secrets manager is configured")
 	}
-	keys, err := p.Secrets.List(spec.App)
+	keys, err := p.secretsFor(spec).List(spec.App)
 	if err != nil {
 		return fmt.Errorf("declared secrets are not readable for %s: %w", spec.App, err)
 	}
@@ -0,0 +1,419 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"norn/v2/api/cloudflared"
+	"norn/v2/api/forge"
+	"norn/v2/api/hub"
+	"norn/v2/api/model"
+	"norn/v2/api/saga"
+)
+
+// previewStatusContext is the commit status context previews report under.
+const previewStatusContext = "norn/preview"
+
+// DeployPreview queues a deploy of a pull request's head into its preview.
+// pr carries the pull request details from the webhook; the job, hostname,
+// database and expiry are filled in from the spec.
+func (p *Pipeline) DeployPreview(ctx context.Context, spec *model.InfraSpec, pr *model.Preview) (*model.Preview, error) {
+	preview, err := spec.ForPreview(pr.Number)
+	if err != nil {
+		return nil, err
+	}
+	pr.App = spec.App
+	pr.JobID = preview.JobID()
+	pr.Hostname = preview.Preview.Hostname
+	pr.Database = ""
+	if preview.Infrastructure != nil && preview.Infrastructure.Postgres != nil {
+		pr.Database = preview.Infrastructure.Postgres.Database
+	}
+	pr.Status = model.PreviewDeploying
+	pr.Reason = ""
+	pr.ExpiresAt = time.Now().Add(spec.PreviewTTL())
+
+	ref := fmt.Sprintf("refs/pull/%d/head", pr.Number)
+	deploy, _, sg := p.enqueueDeploy(ctx, preview, ref, model.OperationQueued, "preview", map[string]interface{}{
+		"preview": pr.Number,
+		"headSha": pr.HeadSHA,
+	})
+	pr.DeploymentID = deploy.ID
+	pr.SagaID = sg.ID
+	if err := p.DB.UpsertPreview(ctx, pr); err != nil {
+		return nil, fmt.Errorf("record preview: %w", err)
+	}
+	sg.Log(ctx, "preview.queued", fmt.Sprintf("queued preview of #%d for %s at %s", pr.Number, spec.App, pr.URL()), map[string]string{
+		"number":   strconv.Itoa(pr.Number),
+		"headSha":  pr.HeadSHA,
+		"jobId":    pr.JobID,
+		"hostname": pr.Hostname,
+		"database": pr.Database,
+	})
+	return pr, nil
+}
+
+// ClosePreview queues a preview.teardown operation. reason is recorded on
+// the preview, e.g. closed, merged or expired.
+func (p *Pipeline) ClosePreview(ctx context.Context, pr *model.Preview, reason string) (string, error) {
+	if pr.Status == model.PreviewClosed {
+		return "", fmt.Errorf("preview #%d of %s is already closed", pr.Number, pr.App)
+	}
+	sg := saga.New(p.SagaStore, pr.App, "pipeline", "preview")
+	payload := map[string]interface{}{
+		"app":     pr.App,
+		"preview": pr.Number,
+		"reason":  reason,
+	}
+	if actor := saga.ActorFrom(ctx); actor != "" {
+		payload["actor"] = actor
+	}
+	if err := p.DB.InsertOperation(ctx, &model.Operation{
+		ID:          uuid.New().String(),
+		Kind:        "preview.teardown",
+		App:         pr.App,
+		SagaID:      sg.ID,
+		Status:      model.OperationQueued,
+		Risk:        "preview teardown",
+		Source:      "preview",
+		Message:     fmt.Sprintf("queued teardown of %s", pr.JobID),
+		MaxAttempts: 3,
+		Payload:     payload,
+		Metadata:    payload,
+	}); err != nil {
+		return "", fmt.Errorf("insert teardown operation: %w", err)
+	}
+	if err := p.DB.SetPreviewStatus(ctx, pr.App, pr.Number, model.PreviewClosing, reason); err != nil {
+		return "", fmt.Errorf("update preview: %w", err)
+	}
+	sg.Log(ctx, "preview.closing", fmt.Sprintf("queued teardown of preview #%d (%s)", pr.Number, reason), map[string]string{
+		"number": strconv.Itoa(pr.Number),
+		"jobId":  pr.JobID,
+	})
+	return sg.ID, nil
+}
+
+// runPreviewTeardown stops the preview's Nomad job, removes its hostname
+// from cloudflared and drops its database. It works from the stored preview
+// so previews can be torn down after the app stops enabling them. A preview
+// still not torn down after the last attempt is marked failed, with what
+// remains in its reason.
+func (p *Pipeline) runPreviewTeardown(ctx context.Context, op *model.Operation) error {
+	number, _ := strconv.Atoi(stringFromMap(op.Payload, "preview"))
+	pr, err := p.DB.GetPreview(ctx, op.App, number)
+	if err != nil {
+		return fmt.Errorf("load preview: %w", err)
+	}
+	if pr == nil {
+		return fmt.Errorf("app %s has no preview #%d", op.App, number)
+	}
+	reason := stringFromMap(op.Payload, "reason")
+	sg := saga.NewWithID(p.SagaStore, op.SagaID, pr.App, "pipeline", "preview")
+	sg.Log(ctx, "preview.teardown.start", fmt.Sprintf("tearing down preview #%d (%s)", pr.Number, reason), map[string]string{
+		"operationId": op.ID,
+		"attempt":     strconv.Itoa(op.Attempts),
+	})
+
+	// Finished sub-steps are recorded on the operation so a retry only
+	// repeats the ones that failed.
+	finished := map[string]bool{}
+	var done []string
+	if raw := stringFromMap(op.Metadata, "finished"); raw != "" {
+		done = strings.Split(raw, ",")
+		for _, name := range done {
+			finished[name] = true
+		}
+	}
+	var failures []string
+	teardown := func(name string, fn func() error) {
+		if finished[name] {
+			return
+		}
+		if err := fn(); err != nil {
+			failures = append(failures, err.Error())
+			return
+		}
+		finished[name] = true
+		done = append(done, name)
+		_ = p.DB.UpdateOperationMetadata(ctx, op.ID, map[string]interface{}{"finished": strings.Join(done, ",")})
+	}
+
+	if p.Nomad != nil {
+		teardown("job", func() error {
+			if err := p.Nomad.StopJob(pr.JobID, true); err != nil && !strings.Contains(err.Error(), "not found") {
+				return fmt.Errorf("stop %s: %v", pr.JobID, err)
+			}
+			sg.Log(ctx, "preview.job_stopped", fmt.Sprintf("stopped and purged %s", pr.JobID), nil)
+			return nil
+		})
+		teardown("volumes", func() error { return p.deletePreviewVolumes(ctx, sg, pr) })
+	}
+	teardown("intentions", func() error { return p.removePreviewIntentions(ctx, sg, pr) })
+	if pr.Hostname != "" {
+		teardown("route", func() error {
+			if err := removePreviewIngress(ctx, pr.Hostname); err != nil {
+				return err
+			}
+			sg.Log(ctx, "preview.route_removed", fmt.Sprintf("removed route for %s", pr.Hostname), nil)
+			return nil
+		})
+	}
+	if pr.Database != "" {
+		teardown("database", func() error {
+			if err := dropPreviewDatabase(ctx, pr.Database, pr.Number); err != nil {
+				return err
+			}
+			sg.Log(ctx, "preview.database_dropped", fmt.Sprintf("dropped database %s", pr.Database), nil)
+			return nil
+		})
+	}
+	if len(failures) > 0 {
+		message := strings.Join(failures, "; ")
+		sg.Log(ctx, "preview.teardown.failed", message, map[string]string{
+			"attempt":  strconv.Itoa(op.Attempts),
+			"finished": strings.Join(done, ","),
+		})
+		if op.Attempts >= op.MaxAttempts {
+			// No retry is left; leave the preview where an operator sees
+			// what still has to be cleaned up.
+			_ = p.DB.SetPreviewStatus(ctx, pr.App, pr.Number, model.PreviewFailed, "teardown failed: "+message)
+		}
+		return fmt.Errorf("teardown preview #%d: %s", pr.Number, message)
+	}
+
+	if err := p.DB.SetPreviewStatus(ctx, pr.App, pr.Number, model.PreviewClosed, reason); err != nil {
+		return fmt.Errorf("update preview: %w", err)
+	}
+	_ = p.DB.FinishOperation(ctx, op.ID, model.OperationSucceeded, fmt.Sprintf("preview #%d torn down", pr.Number), map[string]interface{}{
+		"jobId": pr.JobID,
+	})
+	sg.Log(ctx, "preview.closed", fmt.Sprintf("preview #%d torn down", pr.Number), nil)
+	p.WS.Broadcast(hub.Event{Type: "preview.closed", AppID: pr.App, Payload: map[string]string{
+		"number": strconv.Itoa(pr.Number),
+		"reason": reason,
+	}})
+	if reason == "expired" {
+		p.reportPreview(ctx, sg, pr, "", "", fmt.Sprintf("Preview `%s` expired and was torn down. Push a new commit to recreate it.", pr.JobID))
+	}
+	return nil
+}
+
+// previewSteps seeds the preview's own database instead of snapshotting
+// the app's.
+func (p *Pipeline) previewSteps(steps []step) []step {
+	out := make([]step, 0, len(steps))
+	for _, s := range steps {
+		if s.name == "snapshot" {
+			s = step{name: "database", fn: p.previewDatabase}
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// previewDatabase creates the preview's database on its first deploy and
+// restores the source database's latest snapshot into it. Later pushes to
+// the pull request keep the data. A database whose restore failed is
+// dropped, so the next push seeds it again instead of reusing it.
+func (p *Pipeline) previewDatabase(ctx context.Context, st *state, sg *saga.Saga) error {
+	if st.spec.Infrastructure == nil || st.spec.Infrastructure.Postgres == nil || st.spec.Preview == nil {
+		return nil
+	}
+	db := st.spec.Infrastructure.Postgres.Database
+	out, err := exec.CommandContext(ctx, "createdb", db).CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(out), "already exists") {
+			sg.Log(ctx, "preview.database", fmt.Sprintf("reusing preview database %s", db), map[string]string{"database": db})
+			return nil
+		}
+		return fmt.Errorf("createdb %s: %s", db, strings.TrimSpace(string(out)))
+	}
+
+	source := st.spec.Preview.SourceDatabase
+	snapshot := latestSnapshot("snapshots", source)
+	if snapshot == "" {
+		sg.Log(ctx, "preview.database", fmt.Sprintf("created empty database %s; %s has no snapshots", db, source), map[string]string{
+			"database": db,
+			"source":   source,
+		})
+		return nil
+	}
+	if out, err := restoreSnapshot(ctx, db, snapshot); err != nil {
+		// A later push would reuse the half-seeded database as if it were
+		// complete, so drop it and let the retry create it again.
+		if dropErr := dropPreviewDatabase(ctx, db, st.spec.Preview.Number); dropErr != nil {
+			return fmt.Errorf("seed %s from %s: %s (%v; drop it by hand before the next push)", db, snapshot, truncateOutput(out, 1024), dropErr)
+		}
+		return fmt.Errorf("seed %s from %s, dropped it: %s", db, snapshot, truncateOutput(out, 1024))
+	}
+	st.snapshotFile = snapshot
+	st.snapshotDB = db
+	sg.Log(ctx, "preview.database", fmt.Sprintf("created %s from snapshot %s", db, filepath.Base(snapshot)), map[string]string{
+		"database": db,
+		"source":   source,
+		"snapshot": snapshot,
+	})
+	return nil
+}
+
+// latestSnapshot returns the newest <database>_<sha>_<timestamp>.dump in
+// dir, or "". Snapshots of databases that merely share the prefix, such as
+// other previews, are skipped.
+func latestSnapshot(dir, database string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	type candidate struct{ name, ts string }
+	var found []candidate
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, database+"_") || !strings.HasSuffix(name, ".dump") {
+			continue
+		}
+		rest := strings.TrimSuffix(strings.TrimPrefix(name, database+"_"), ".dump")
+		parts := strings.Split(rest, "_")
+		if len(parts) != 2 {
+			continue
+		}
+		found = append(found, candidate{name: name, ts: parts[1]})
+	}
+	if len(found) == 0 {
+		return ""
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].ts > found[j].ts })
+	return filepath.Join(dir, found[0].name)
+}
+
+// previewDatabaseEnv points DATABASE_URL and PGDATABASE at the preview's
+// database so the preview never writes to the database it was cloned from.
+func previewDatabaseEnv(spec *model.InfraSpec, env map[string]string) {
+	if spec.Preview == nil || spec.Infrastructure == nil || spec.Infrastructure.Postgres == nil {
+		return
+	}
+	db := spec.Infrastructure.Postgres.Database
+	env["PGDATABASE"] = db
+	if raw := env["DATABASE_URL"]; raw != "" {
+		if u, err := url.Parse(raw); err == nil && u.Host != "" {
+			u.Path = "/" + db
+			env["DATABASE_URL"] = u.String()
+		}
+	}
+}
+
+// previewStarted reports the pending preview on the pull request's head.
+func (p *Pipeline) previewStarted(ctx context.Context, spec *model.InfraSpec, deploy *model.Deployment, sg *saga.Saga) {
+	pr := p.currentPreview(ctx, spec, deploy)
+	if pr == nil {
+		return
+	}
+	p.reportPreview(ctx, sg, pr, forge.StatePending, "Deploying preview", "")
+}
+
+// previewFinished records the preview's outcome and reports it on the pull
+// request. The URL is commented the first time the preview becomes ready.
+func (p *Pipeline) previewFinished(ctx context.Context, spec *model.InfraSpec, deploy *model.Deployment, sg *saga.Saga, stepErr error) {
+	pr := p.currentPreview(ctx, spec, deploy)
+	if pr == nil || pr.Status == model.PreviewClosing || pr.Status == model.PreviewClosed {
+		return
+	}
+	if stepErr != nil {
+		_ = p.DB.SetPreviewStatus(ctx, pr.App, pr.Number, model.PreviewFailed, stepErr.Error())
+		p.reportPreview(ctx, sg, pr, forge.StateFailure, "Preview deploy failed: "+stepErr.Error(), "")
+		return
+	}
+	_ = p.DB.SetPreviewStatus(ctx, pr.App, pr.Number, model.PreviewReady, "")
+	comment := ""
+	if pr.ReadyAt == nil {
+		comment = fmt.Sprintf("Preview deployed to %s\n\nIt is torn down when this pull request closes or after %s without a push.", pr.URL(), spec.PreviewTTL())
+	}
+	p.reportPreview(ctx, sg, pr, forge.StateSuccess, "Preview ready at "+pr.Hostname, comment)
+	p.WS.Broadcast(hub.Event{Type: "preview.ready", AppID: pr.App, Payload: map[string]string{
+		"number": strconv.Itoa(pr.Number),
+		"url":    pr.URL(),
+		"sagaId": sg.ID,
+	}})
+}
+
+// currentPreview loads the preview deploy belongs to, or nil when a newer
+// push has superseded it.
+func (p *Pipeline) currentPreview(ctx context.Context, spec *model.InfraSpec, deploy *model.Deployment) *model.Preview {
+	if spec.Preview == nil || p.DB == nil {
+		return nil
+	}
+	pr, err := p.DB.GetPreview(ctx, spec.App, spec.Preview.Number)
+	if err != nil || pr == nil || pr.DeploymentID != deploy.ID {
+		return nil
+	}
+	return pr
+}
+
+// reportPreview sets a commit status on the preview's head and, when
+// comment is set, comments on the pull request. An empty state skips the
+// status. Forge errors are logged to the saga and never fail the deploy.
+func (p *Pipeline) reportPreview(ctx context.Context, sg *saga.Saga, pr *model.Preview, state forge.State, description, comment string) {
+	repo, err := forge.ParseRepo(pr.Repository)
+	if err == nil {
+		var client forge.Client
+		client, err = p.forgeClient(pr.Provider)
+		if err == nil && state != "" && pr.HeadSHA != "" {
+			status := forge.Status{State: state, Context: previewStatusContext, Description: description, TargetURL: p.sagaURL(sg.ID)}
+			if state == forge.StateSuccess {
+				status.TargetURL = pr.URL()
+			}
+			err = client.SetStatus(ctx, repo, pr.HeadSHA, status)
+		}
+		if err == nil && comment != "" {
+			err = client.Comment(ctx, repo, pr.Number, comment)
+		}
+	}
+	if err != nil {
+		sg.Log(ctx, "preview.report_failed", fmt.Sprintf("could not report preview to %s: %v", pr.Provider, err), map[string]string{
+			"number": strconv.Itoa(pr.Number),
+		})
+	}
+}
+
+// forgeClient returns the API client for a webhook provider.
+func (p *Pipeline) forgeClient(provider string) (forge.Client, error) {
+	if p.Forge != nil {
+		return p.Forge(provider)
+	}
+	return forge.New(provider, forge.Config{Token: p.GitToken})
+}
+
+func removePreviewIngress(ctx context.Context, hostname string) error {
+	cfg, err := cloudflared.ReadConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if !cloudflared.RemoveIngress(cfg, hostname) {
+		return nil
+	}
+	if err := cloudflared.ApplyConfig(ctx, cfg); err != nil {
+		return err
+	}
+	return cloudflared.Restart(ctx)
+}
+
+// dropPreviewDatabase refuses any database that is not a preview copy.
+func dropPreviewDatabase(ctx context.Context, db string, number int) error {
+	if !strings.HasSuffix(db, fmt.Sprintf("_pr_%d", number)) {
+		return fmt.Errorf("refusing to drop %s: not a preview database", db)
+	}
+	out, err := exec.CommandContext(ctx, "dropdb", "--if-exists", "--force", db).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("dropdb %s: %s", db, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
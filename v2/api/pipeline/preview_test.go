@@ -0,0 +1,129 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"norn/v2/api/forge"
+	"norn/v2/api/model"
+	"norn/v2/api/saga"
+)
+
+func TestLatestSnapshotSkipsOtherDatabases(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"shop_abc123_20260101T000000.dump",
+		"shop_def456_20260301T000000.dump",
+		"shop_pr_7_abc123_20260401T000000.dump",
+		"shop_staging_abc123_20260501T000000.dump",
+		"shopfront_abc123_20260601T000000.dump",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := latestSnapshot(dir, "shop"); got != filepath.Join(dir, "shop_def456_20260301T000000.dump") {
+		t.Fatalf("latest snapshot = %s", got)
+	}
+	if got := latestSnapshot(dir, "orders"); got != "" {
+		t.Fatalf("latest snapshot for unknown database = %s", got)
+	}
+}
+
+func TestPreviewDatabaseEnvRewritesDatabaseURL(t *testing.T) {
+	spec := &model.InfraSpec{
+		Preview:        &model.PreviewTarget{Number: 7},
+		Infrastructure: &model.Infrastructure{Postgres: &model.PostgresInfra{Database: "shop_pr_7"}},
+	}
+	env := map[string]string{"DATABASE_URL": "postgres://shop:pw@db.internal:5432/shop?sslmode=disable"}
+	previewDatabaseEnv(spec, env)
+	if env["DATABASE_URL"] != "postgres://shop:pw@db.internal:5432/shop_pr_7?sslmode=disable" || env["PGDATABASE"] != "shop_pr_7" {
+		t.Fatalf("env = %v", env)
+	}
+}
+
+type fakeForge struct {
+	statuses []forge.Status
+	comments []string
+}
+
+func (f *fakeForge) Name() string { return "fake" }
+
+func (f *fakeForge) SetStatus(_ context.Context, _ forge.Repo, _ string, status forge.Status) error {
+	f.statuses = append(f.statuses, status)
+	return nil
+}
+
+func (f *fakeForge) Comment(_ context.Context, _ forge.Repo, _ int, body string) error {
+	f.comments = append(f.comments, body)
+	return nil
+}
+
+func TestReportPreviewPostsStatusAndComment(t *testing.T) {
+	fake := &fakeForge{}
+	store := &memorySagaStore{}
+	p := &Pipeline{Forge: func(string) (forge.Client, error) { return fake, nil }}
+	sg := saga.New(store, "shop", "pipeline", "deploy")
+	pr := &model.Preview{App: "shop", Number: 7, Provider: "github", Repository: "https://github.com/acme/shop", HeadSHA: "abc123", Hostname: "shop-pr-7.preview.example.com"}
+
+	p.reportPreview(context.Background(), sg, pr, forge.StateSuccess, "Preview ready", "deployed")
+	if len(fake.statuses) != 1 || fake.statuses[0].TargetURL != "https://shop-pr-7.preview.example.com" || fake.statuses[0].Context != previewStatusContext {
+		t.Fatalf("statuses = %+v", fake.statuses)
+	}
+	if len(fake.comments) != 1 {
+		t.Fatalf("comments = %v", fake.comments)
+	}
+
+	// Forge failures are logged, not returned.
+	p.Forge = func(string) (forge.Client, error) { return nil, errors.New("no token") }
+	p.reportPreview(context.Background(), sg, pr, forge.StateFailure, "failed", "")
+	if store.find("preview.report_failed") == nil {
+		t.Fatal("expected preview.report_failed saga event")
+	}
+}
+
+func TestPreviewDatabaseDropsFailedSeed(t *testing.T) {
+	bin := t.TempDir()
+	for name, script := range map[string]string{
+		"createdb":   "#!/bin/sh\nexit 0\n",
+		"pg_restore": "#!/bin/sh\necho 'pg_restore: warning: errors ignored on restore: 1' >&2\nexit 1\n",
+		"dropdb":     "#!/bin/sh\necho \"$@\" > \"$(dirname \"$0\")/dropdb.log\"\n",
+	} {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	work := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(work, "snapshots"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(work, "snapshots", "shop_abc123_20260101T000000.dump"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(work)
+
+	st := &state{spec: &model.InfraSpec{
+		App:            "shop",
+		Infrastructure: &model.Infrastructure{Postgres: &model.PostgresInfra{Database: "shop_pr_7"}},
+		Preview:        &model.PreviewTarget{Number: 7, SourceDatabase: "shop"},
+	}}
+	err := (&Pipeline{}).previewDatabase(context.Background(), st, saga.New(&memorySagaStore{}, "shop", "pipeline", "preview"))
+	if err == nil || !strings.Contains(err.Error(), "dropped it") {
+		t.Fatalf("err = %v, want the failed seed reported as dropped", err)
+	}
+	got, err := os.ReadFile(filepath.Join(bin, "dropdb.log"))
+	if err != nil || !strings.Contains(string(got), "shop_pr_7") {
+		t.Fatalf("dropdb ran with %q (%v), want shop_pr_7 dropped", got, err)
+	}
+}
+
+func TestDropPreviewDatabaseRefusesAppDatabases(t *testing.T) {
+	if err := dropPreviewDatabase(context.Background(), "shop", 7); err == nil {
+		t.Fatal("expected refusal to drop a non-preview database")
+	}
+}
@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"norn/v2/api/model"
+	"norn/v2/api/saga"
+)
+
+// Promote queues a deploy of source's exact image into spec's environment.
+// The build and test steps are skipped and the new deployment reuses the
+// commit and source provenance recorded when source was built.
+func (p *Pipeline) Promote(ctx context.Context, spec *model.InfraSpec, source *model.Deployment) (*model.Deployment, error) {
+	if source.Status != model.StatusDeployed {
+		return nil, fmt.Errorf("deployment %s is %s, not deployed", source.ID, source.Status)
+	}
+	if source.ImageTag == "" {
+		return nil, fmt.Errorf("deployment %s has no image to promote", source.ID)
+	}
+	if source.Environment == spec.Environment {
+		return nil, fmt.Errorf("deployment %s is already in %s", source.ID, environmentLabel(spec.Environment))
+	}
+
+	sg := saga.New(p.SagaStore, spec.App, "pipeline", "deploy")
+	deploy := &model.Deployment{
+		ID:            uuid.New().String(),
+		App:           spec.App,
+		Environment:   spec.Environment,
+		CommitSHA:     source.CommitSHA,
+		ImageTag:      source.ImageTag,
+		SagaID:        sg.ID,
+		Status:        model.StatusQueued,
+		SourceKind:    source.SourceKind,
+		SourceRef:     source.SourceRef,
+		SourceDirty:   source.SourceDirty,
+		SourceChanges: source.SourceChanges,
+		PromotedFrom:  source.ID,
+		StartedAt:     time.Now(),
+	}
+	p.queueDeployment(ctx, spec, deploy, sg, source.CommitSHA, model.OperationQueued, "promotion", map[string]interface{}{
+		"promotedFrom":    source.ID,
+		"fromEnvironment": source.Environment,
+		"imageTag":        source.ImageTag,
+	})
+	sg.Log(ctx, "deploy.promotion", fmt.Sprintf("queued promotion of %s from %s to %s", source.ImageTag, environmentLabel(source.Environment), environmentLabel(spec.Environment)), map[string]string{
+		"deploymentId":       deploy.ID,
+		"sourceDeploymentId": source.ID,
+		"fromEnvironment":    source.Environment,
+		"toEnvironment":      spec.Environment,
+		"commitSha":          source.CommitSHA,
+		"imageTag":           source.ImageTag,
+		"sourceKind":         source.SourceKind,
+		"sourceRef":          source.SourceRef,
+	})
+	return deploy, nil
+}
+
+// promotionSteps drops the build and test steps from a deploy. The source
+// is still checked out when migrations need to run against the target
+// environment's database.
+func promotionSteps(spec *model.InfraSpec, steps []step) []step {
+	out := make([]step, 0, len(steps))
+	for _, s := range steps {
+		switch s.name {
+		case "build", "test":
+			continue
+		case "clone":
+			if spec.Migrations == nil || spec.Migrations.Up == "" {
+				continue
+			}
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func environmentLabel(env string) string {
+	if env == "" {
+		return "the default environment"
+	}
+	return env
+}
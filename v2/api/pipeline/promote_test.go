@@ -0,0 +1,28 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"norn/v2/api/model"
+)
+
+func TestPromotionStepsSkipBuild(t *testing.T) {
+	steps := []step{{name: "clone"}, {name: "build"}, {name: "test"}, {name: "snapshot"}, {name: "migrate"}, {name: "submit"}, {name: "healthy"}}
+	names := func(steps []step) string {
+		out := make([]string, len(steps))
+		for i, s := range steps {
+			out[i] = s.name
+		}
+		return strings.Join(out, ",")
+	}
+
+	if got := names(promotionSteps(&model.InfraSpec{}, steps)); got != "snapshot,migrate,submit,healthy" {
+		t.Fatalf("steps = %s", got)
+	}
+	// Migrations still need the source tree checked out.
+	withMigrations := &model.InfraSpec{Migrations: &model.MigrationSpec{Up: "./migrate up"}}
+	if got := names(promotionSteps(withMigrations, steps)); got != "clone,snapshot,migrate,submit,healthy" {
+		t.Fatalf("steps with migrations = %s", got)
+	}
+}
@@ -0,0 +1,251 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"norn/v2/api/forge"
+	"norn/v2/api/model"
+	"norn/v2/api/saga"
+)
+
+var commitSHARe = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// commitReporter publishes a deploy or preflight to the forge hosting the
+// app's repo: a commit status for the run and one per step, plus a
+// deployment for deploys. Nothing is reported until the clone step resolves
+// the commit, and the first forge error stops reporting for the run so a
+// bad token costs one timeout rather than one per step.
+//
+// A nil reporter is valid and reports nothing.
+type commitReporter struct {
+	p        *Pipeline
+	sg       *saga.Saga
+	spec     *model.InfraSpec
+	client   forge.Client
+	repo     forge.Repo
+	category string
+	context  string
+	steps    []string
+	done     map[string]error
+	sha      string
+
+	deploymentID int64
+}
+
+// newCommitReporter returns nil when the app has no repo, no forge token is
+// configured, or the run is a preview, which reports under norn/preview.
+func (p *Pipeline) newCommitReporter(spec *model.InfraSpec, sg *saga.Saga, category string, steps []step) *commitReporter {
+	if spec.Repo == nil || spec.Repo.URL == "" || spec.Preview != nil {
+		return nil
+	}
+	if p.GitToken == "" && p.Forge == nil {
+		return nil
+	}
+	repo, err := forge.ParseRepo(spec.Repo.URL)
+	if err != nil {
+		return nil
+	}
+	client, err := p.forgeClient(spec.Repo.ForgeProvider())
+	if err != nil {
+		return nil
+	}
+	names := make([]string, len(steps))
+	for i, s := range steps {
+		names[i] = s.name
+	}
+	return &commitReporter{
+		p:        p,
+		sg:       sg,
+		spec:     spec,
+		client:   client,
+		repo:     repo,
+		category: category,
+		context:  statusContext(spec, category),
+		steps:    names,
+		done:     map[string]error{},
+	}
+}
+
+// statusContext names the commit status for an app's deploys or preflights,
+// e.g. norn/shop/deploy, or norn/shop@staging/deploy in an environment.
+// Contexts include the app so apps sharing a repo don't overwrite each
+// other.
+func statusContext(spec *model.InfraSpec, category string) string {
+	name := spec.App
+	if spec.Environment != "" {
+		name += "@" + spec.Environment
+	}
+	return "norn/" + name + "/" + category
+}
+
+// stepFinished reports a step's outcome once the commit is known. The first
+// report marks the run and its remaining steps pending and catches up on
+// the steps that finished before the commit was resolved.
+func (r *commitReporter) stepFinished(ctx context.Context, st *state, name string, stepErr error) {
+	if r == nil {
+		return
+	}
+	r.done[name] = stepErr
+	if r.sha == "" {
+		if st.sourceKind != "git_clone" || !commitSHARe.MatchString(st.commitSHA) {
+			return
+		}
+		r.sha = st.commitSHA
+		r.started(ctx)
+		for _, step := range r.steps {
+			if err, ok := r.done[step]; ok {
+				r.stepStatus(ctx, step, err)
+			}
+		}
+		return
+	}
+	r.stepStatus(ctx, name, stepErr)
+}
+
+func (r *commitReporter) stepStatus(ctx context.Context, name string, stepErr error) {
+	status := forge.Status{State: forge.StateSuccess, Context: r.context + "/" + name, Description: name + " passed", TargetURL: r.p.sagaURL(r.sg.ID)}
+	if stepErr != nil {
+		status.State = forge.StateFailure
+		status.Description = name + " failed: " + stepErr.Error()
+	}
+	r.setStatus(ctx, status)
+}
+
+func (r *commitReporter) started(ctx context.Context) {
+	link := r.p.sagaURL(r.sg.ID)
+	r.setStatus(ctx, forge.Status{State: forge.StatePending, Context: r.context, Description: r.category + " running", TargetURL: link})
+	for _, name := range r.steps {
+		if _, ok := r.done[name]; ok {
+			continue
+		}
+		r.setStatus(ctx, forge.Status{State: forge.StatePending, Context: r.context + "/" + name, Description: "waiting", TargetURL: link})
+	}
+	if r.category != "deploy" {
+		return
+	}
+	deployer, ok := r.client.(forge.Deployer)
+	if !ok {
+		return
+	}
+	environment := r.deploymentEnvironment()
+	id, err := deployer.CreateDeployment(ctx, r.repo, forge.Deployment{
+		Ref:         r.sha,
+		Environment: environment,
+		Description: fmt.Sprintf("Norn deploy of %s", r.spec.App),
+		Production:  environment == "production",
+	})
+	if err != nil {
+		r.failed(ctx, err)
+		return
+	}
+	r.deploymentID = id
+	r.setDeploymentStatus(ctx, forge.DeploymentInProgress, "deploying")
+}
+
+// finished reports the run's outcome. Steps that never ran are marked as
+// errors so they don't sit pending on the commit.
+func (r *commitReporter) finished(ctx context.Context, failedStep string, runErr error) {
+	if r == nil || r.client == nil || r.sha == "" {
+		return
+	}
+	link := r.p.sagaURL(r.sg.ID)
+	if runErr != nil {
+		for _, name := range r.steps {
+			if _, ok := r.done[name]; !ok {
+				r.setStatus(ctx, forge.Status{State: forge.StateError, Context: r.context + "/" + name, Description: "not run: " + failedStep + " failed", TargetURL: link})
+			}
+		}
+		description := fmt.Sprintf("%s failed at %s: %v", r.category, failedStep, runErr)
+		r.setStatus(ctx, forge.Status{State: forge.StateFailure, Context: r.context, Description: description, TargetURL: link})
+		r.reportEnvironment(ctx, forge.DeploymentFailure, description)
+		return
+	}
+	description := r.category + " succeeded"
+	r.setStatus(ctx, forge.Status{State: forge.StateSuccess, Context: r.context, Description: description, TargetURL: link})
+	r.reportEnvironment(ctx, forge.DeploymentSuccess, description)
+}
+
+// reportEnvironment finishes the forge deployment. Forges without a
+// deployments API get a commit status per environment instead, linking to
+// the app.
+func (r *commitReporter) reportEnvironment(ctx context.Context, state forge.DeploymentState, description string) {
+	if r.category != "deploy" || r.client == nil {
+		return
+	}
+	if r.deploymentID != 0 {
+		r.setDeploymentStatus(ctx, state, description)
+		return
+	}
+	if _, ok := r.client.(forge.Deployer); ok {
+		return
+	}
+	status := forge.Status{State: forge.StateSuccess, Context: "norn/" + r.spec.App + "/environment/" + r.deploymentEnvironment(), Description: "deployed", TargetURL: r.environmentURL()}
+	if state != forge.DeploymentSuccess {
+		status.State = forge.StateFailure
+		status.Description = description
+		status.TargetURL = r.p.sagaURL(r.sg.ID)
+	}
+	r.setStatus(ctx, status)
+}
+
+func (r *commitReporter) deploymentEnvironment() string {
+	if r.spec.Environment != "" {
+		return r.spec.Environment
+	}
+	return "production"
+}
+
+func (r *commitReporter) environmentURL() string {
+	if len(r.spec.Endpoints) == 0 {
+		return ""
+	}
+	u := r.spec.Endpoints[0].URL
+	if !strings.Contains(u, "://") {
+		u = "https://" + u
+	}
+	return u
+}
+
+func (r *commitReporter) setStatus(ctx context.Context, status forge.Status) {
+	if r.client == nil {
+		return
+	}
+	if err := r.client.SetStatus(ctx, r.repo, r.sha, status); err != nil {
+		r.failed(ctx, err)
+	}
+}
+
+func (r *commitReporter) setDeploymentStatus(ctx context.Context, state forge.DeploymentState, description string) {
+	deployer, ok := r.client.(forge.Deployer)
+	if !ok || r.deploymentID == 0 {
+		return
+	}
+	err := deployer.SetDeploymentStatus(ctx, r.repo, r.deploymentID, forge.DeploymentStatus{
+		State:          state,
+		Description:    description,
+		LogURL:         r.p.sagaURL(r.sg.ID),
+		EnvironmentURL: r.environmentURL(),
+	})
+	if err != nil {
+		r.failed(ctx, err)
+	}
+}
+
+func (r *commitReporter) failed(ctx context.Context, err error) {
+	r.sg.Log(ctx, "forge.report_failed", fmt.Sprintf("could not report %s to %s, giving up for this run: %v", r.category, r.client.Name(), err), map[string]string{
+		"commitSha": r.sha,
+		"context":   r.context,
+	})
+	r.client = nil
+}
+
+// sagaURL links to a saga in the Norn UI, or "" without a public URL.
+func (p *Pipeline) sagaURL(sagaID string) string {
+	if p.PublicURL == "" {
+		return ""
+	}
+	return strings.TrimRight(p.PublicURL, "/") + "/?saga=" + sagaID
+}
@@ -0,0 +1,150 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"norn/v2/api/forge"
+	"norn/v2/api/model"
+	"norn/v2/api/saga"
+)
+
+type fakeDeployer struct {
+	fakeForge
+	deployments []forge.Deployment
+	updates     []forge.DeploymentStatus
+}
+
+func (f *fakeDeployer) CreateDeployment(_ context.Context, _ forge.Repo, d forge.Deployment) (int64, error) {
+	f.deployments = append(f.deployments, d)
+	return 42, nil
+}
+
+func (f *fakeDeployer) SetDeploymentStatus(_ context.Context, _ forge.Repo, id int64, status forge.DeploymentStatus) error {
+	f.updates = append(f.updates, status)
+	return nil
+}
+
+const testSHA = "0123456789abcdef0123456789abcdef01234567"
+
+func reporterFor(t *testing.T, client forge.Client, category string, names ...string) (*commitReporter, *state) {
+	t.Helper()
+	p := &Pipeline{PublicURL: "https://norn.example.com/", Forge: func(string) (forge.Client, error) { return client, nil }}
+	spec := &model.InfraSpec{
+		App:       "shop",
+		Repo:      &model.RepoSpec{URL: "https://github.com/acme/shop.git"},
+		Endpoints: []model.Endpoint{{URL: "shop.example.com"}},
+	}
+	steps := make([]step, len(names))
+	for i, name := range names {
+		steps[i] = step{name: name}
+	}
+	sg := saga.New(&memorySagaStore{}, "shop", "pipeline", category)
+	r := p.newCommitReporter(spec, sg, category, steps)
+	if r == nil {
+		t.Fatal("expected a reporter")
+	}
+	return r, &state{spec: spec, commitSHA: "HEAD"}
+}
+
+func contexts(statuses []forge.Status) []string {
+	out := make([]string, len(statuses))
+	for i, s := range statuses {
+		out[i] = s.Context + "=" + string(s.State)
+	}
+	return out
+}
+
+func TestCommitReporterWaitsForResolvedCommit(t *testing.T) {
+	fake := &fakeForge{}
+	r, st := reporterFor(t, fake, "preflight", "validate", "clone", "build")
+	ctx := context.Background()
+
+	r.stepFinished(ctx, st, "validate", nil)
+	if len(fake.statuses) != 0 {
+		t.Fatalf("reported before the commit was known: %v", contexts(fake.statuses))
+	}
+	st.sourceKind, st.commitSHA = "git_clone", testSHA
+	r.stepFinished(ctx, st, "clone", nil)
+	r.stepFinished(ctx, st, "build", errors.New("exit 1"))
+	r.finished(ctx, "build", errors.New("exit 1"))
+
+	want := []string{
+		"norn/shop/preflight=pending",
+		"norn/shop/preflight/build=pending",
+		"norn/shop/preflight/validate=success",
+		"norn/shop/preflight/clone=success",
+		"norn/shop/preflight/build=failure",
+		"norn/shop/preflight=failure",
+	}
+	if got := contexts(fake.statuses); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("statuses = %v\nwant %v", got, want)
+	}
+	if link := fake.statuses[0].TargetURL; link != "https://norn.example.com/?saga="+r.sg.ID {
+		t.Fatalf("target url = %s", link)
+	}
+}
+
+func TestCommitReporterSkipsLocalSources(t *testing.T) {
+	fake := &fakeForge{}
+	r, st := reporterFor(t, fake, "deploy", "clone")
+	st.sourceKind, st.commitSHA = "local_copy", testSHA
+	r.stepFinished(context.Background(), st, "clone", nil)
+	r.finished(context.Background(), "", nil)
+	if len(fake.statuses) != 0 {
+		t.Fatalf("local sources should not be reported: %v", contexts(fake.statuses))
+	}
+}
+
+func TestCommitReporterDeployments(t *testing.T) {
+	ctx := context.Background()
+
+	deployer := &fakeDeployer{}
+	r, st := reporterFor(t, deployer, "deploy", "clone", "submit")
+	st.sourceKind, st.commitSHA = "git_clone", testSHA
+	r.stepFinished(ctx, st, "clone", nil)
+	r.stepFinished(ctx, st, "submit", errors.New("nomad unavailable"))
+	r.finished(ctx, "submit", errors.New("nomad unavailable"))
+	if len(deployer.deployments) != 1 || deployer.deployments[0].Environment != "production" || deployer.deployments[0].Ref != testSHA {
+		t.Fatalf("deployments = %+v", deployer.deployments)
+	}
+	if len(deployer.updates) != 2 || deployer.updates[0].State != forge.DeploymentInProgress || deployer.updates[1].State != forge.DeploymentFailure {
+		t.Fatalf("deployment statuses = %+v", deployer.updates)
+	}
+
+	// Forges without deployments get a status per environment.
+	fake := &fakeForge{}
+	r, st = reporterFor(t, fake, "deploy", "clone")
+	st.sourceKind, st.commitSHA = "git_clone", testSHA
+	r.stepFinished(ctx, st, "clone", nil)
+	r.finished(ctx, "", nil)
+	last := fake.statuses[len(fake.statuses)-1]
+	if last.Context != "norn/shop/environment/production" || last.State != forge.StateSuccess || last.TargetURL != "https://shop.example.com" {
+		t.Fatalf("environment status = %+v", last)
+	}
+}
+
+type failingForge struct{ calls int }
+
+func (f *failingForge) Name() string { return "failing" }
+
+func (f *failingForge) SetStatus(context.Context, forge.Repo, string, forge.Status) error {
+	f.calls++
+	return errors.New("401 bad credentials")
+}
+
+func (f *failingForge) Comment(context.Context, forge.Repo, int, string) error { return nil }
+
+func TestCommitReporterStopsAfterFirstError(t *testing.T) {
+	failing := &failingForge{}
+	r, st := reporterFor(t, failing, "deploy", "clone", "build", "submit")
+	st.sourceKind, st.commitSHA = "git_clone", testSHA
+	r.stepFinished(context.Background(), st, "clone", nil)
+	r.stepFinished(context.Background(), st, "build", nil)
+	r.finished(context.Background(), "", nil)
+	if failing.calls != 1 {
+		t.Fatalf("forge called %d times after failing", failing.calls)
+	}
+}
@@ -3,7 +3,6 @@ package pipeline
 import (
 	"context"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,13 +13,13 @@ import (
 	"norn/v2/api/saga"
 )
 
-func (p *Pipeline) Rollback(spec *model.InfraSpec, current model.Deployment, prev *model.Deployment) string {
-	ctx := context.Background()
+func (p *Pipeline) Rollback(ctx context.Context, spec *model.InfraSpec, current model.Deployment, prev *model.Deployment) string {
 	sg := saga.New(p.SagaStore, spec.App, "pipeline", "rollback")
 	started := time.Now()
 	deploy := &model.Deployment{
 		ID:            uuid.New().String(),
 		App:           spec.App,
+		Environment:   spec.Environment,
 		CommitSHA:     prev.CommitSHA,
 		ImageTag:      prev.ImageTag,
 		SagaID:        sg.ID,
@@ -43,6 +42,12 @@ func (p *Pipeline) Rollback(spec *model.InfraSpec, current model.Deployment, pre
 		"sourceDeploymentId":  prev.ID,
 		"currentDeploymentId": current.ID,
 	}
+	if spec.Environment != "" {
+		payload["environment"] = spec.Environment
+	}
+	if actor := saga.ActorFrom(ctx); actor != "" {
+		payload["actor"] = actor
+	}
 	if err := p.DB.InsertOperation(ctx, &model.Operation{
 		ID:          operationID,
 		Kind:        "app.rollback",
@@ -69,7 +74,7 @@ func (p *Pipeline) Rollback(spec *model.InfraSpec, current model.Deployment, pre
 	return sg.ID
 }
 
-func (p *Pipeline) runRollback(ctx context.Context, spec *model.InfraSpec, deploy *model.Deployment, sg *saga.Saga, imageTag string, operationID string, attempt int) {
+func (p *Pipeline) runRollback(ctx context.Context, spec *model.InfraSpec, deploy *model.Deployment, sg *saga.Saga, imageTag, currentID string, operationID string, attempt int) {
 	if p.Nomad == nil {
 		err := fmt.Errorf("nomad not connected")
 		_ = p.DB.UpdateDeployment(ctx, deploy.ID, model.StatusFailed)
@@ -97,25 +102,25 @@ func (p *Pipeline) runRollback(ctx context.Context, spec *model.InfraSpec, deplo
 
 	steps := []step{
 		{name: "resolve-secrets", fn: func(ctx context.Context, st *state, sg *saga.Saga) error {
-			env := make(map[string]string)
-			if p.Secrets != nil {
-				secretEnv, err := p.Secrets.EnvMap(spec.App)
-				if err != nil && !os.IsNotExist(err) {
-					return fmt.Errorf("resolve secrets: %w", err)
-				}
-				for k, v := range secretEnv {
-					env[k] = v
-				}
+			env, err := p.secretEnv(spec)
+			if err != nil {
+				return err
 			}
 			job := nomad.Translate(spec, imageTag, env)
-			_, err := p.Nomad.SubmitJob(job)
+			_, err = p.Nomad.SubmitJob(job)
 			return err
 		}},
 		{name: "healthy", fn: func(ctx context.Context, st *state, sg *saga.Saga) error {
-			return p.Nomad.WaitHealthy(ctx, spec.App, 5*time.Minute)
+			return p.Nomad.WaitHealthy(ctx, spec.JobID(), model.HealthyTimeout(spec))
 		}},
 	}
 
+	if spec.Migrations != nil && spec.Migrations.Down != "" {
+		steps = append([]step{{name: "migrate-down", fn: func(ctx context.Context, st *state, sg *saga.Saga) error {
+			return p.rollbackMigration(ctx, spec, deploy, currentID, sg)
+		}}}, steps...)
+	}
+
 	st := &state{spec: spec, imageTag: imageTag, sourceKind: "rollback", sourceRef: deploy.SourceRef}
 	total := fmt.Sprintf("%d", len(steps))
 	for i, s := range steps {
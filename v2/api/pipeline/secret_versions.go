@@ -0,0 +1,70 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"norn/v2/api/model"
+	"norn/v2/api/secrets"
+	"norn/v2/api/store"
+)
+
+// RecordSecretVersion adds a version to an app environment's secret history
+// for a change from before to after. The first change also records before as
+// a baseline so it can be rolled back. history holds the environment's names
+// from InfraSpec.HistoryEnvironments; the version is recorded under the
+// first. The change has already been made, so failures are logged rather
+// than returned.
+func RecordSecretVersion(ctx context.Context, db *store.DB, app string, history []string, m *secrets.Manager, action, actor string, before, after map[string]string, restoredFrom int) *model.SecretVersion {
+	if db == nil {
+		return nil
+	}
+	added, changed, removed := secrets.DiffKeys(before, after)
+	if len(added)+len(changed)+len(removed) == 0 && action != model.SecretVersionRollback {
+		return nil
+	}
+	started, err := db.HasSecretVersions(ctx, app, history)
+	if err != nil {
+		log.Printf("secrets: history for %s: %v", app, err)
+		return nil
+	}
+	env := history[0]
+	if !started && len(before) > 0 {
+		baseline := newSecretVersion(app, env, m, model.SecretVersionBaseline, "system", before)
+		baseline.Added = secrets.SortedKeys(before)
+		if err := db.RecordSecretVersion(ctx, baseline, history); err != nil {
+			log.Printf("secrets: record baseline for %s: %v", app, err)
+			return nil
+		}
+	}
+
+	v := newSecretVersion(app, env, m, action, actor, after)
+	v.Added, v.Changed, v.Removed = added, changed, removed
+	v.RestoredFrom = restoredFrom
+	if err := db.RecordSecretVersion(ctx, v, history); err != nil {
+		log.Printf("secrets: record version for %s: %v", app, err)
+		return nil
+	}
+	return v
+}
+
+func newSecretVersion(app, env string, m *secrets.Manager, action, actor string, data map[string]string) *model.SecretVersion {
+	v := &model.SecretVersion{
+		App:         app,
+		Environment: env,
+		Backend:     m.Location(app),
+		Action:      action,
+		Actor:       actor,
+		Keys:        secrets.SortedKeys(data),
+	}
+	snapshot, err := secrets.Seal(data)
+	switch {
+	case err == nil:
+		v.Snapshot = snapshot
+		v.Restorable = true
+	case !errors.Is(err, secrets.ErrNoSealKey):
+		log.Printf("secrets: seal %s snapshot: %v", app, err)
+	}
+	return v
+}
@@ -12,10 +12,17 @@ import (
 )
 
 func (p *Pipeline) snapshot(ctx context.Context, st *state, sg *saga.Saga) error {
-	if st.spec.Infrastructure == nil || st.spec.Infrastructure.Postgres == nil {
-		return nil // skip
+	if st.spec.InheritsDatabase() {
+		_ = sg.Log(ctx, "snapshot.skipped", fmt.Sprintf("environment %s shares the default environment's database; not snapshotting it", st.spec.Environment), nil)
+	} else if st.spec.Infrastructure != nil && st.spec.Infrastructure.Postgres != nil {
+		if err := p.snapshotDatabase(ctx, st, sg); err != nil {
+			return err
+		}
 	}
+	return p.snapshotVolumes(ctx, st, sg)
+}
 
+func (p *Pipeline) snapshotDatabase(ctx context.Context, st *state, sg *saga.Saga) error {
 	db := st.spec.Infrastructure.Postgres.Database
 	sha := st.commitSHA
 	if len(sha) > 12 {
@@ -30,13 +37,21 @@ func (p *Pipeline) snapshot(ctx context.Context, st *state, sg *saga.Saga) error
 	if err != nil {
 		return fmt.Errorf("pg_dump: %s", string(out))
 	}
+	st.snapshotFile = filename
+	st.snapshotDB = db
 	_ = sg.Log(ctx, "snapshot.created", fmt.Sprintf("snapshot created: %s", filename), map[string]string{
 		"database":  db,
 		"snapshot":  filename,
 		"commitSha": st.commitSHA,
 	})
 
-	// Auto-export to S3 if configured
+	p.exportSnapshot(ctx, st, sg, filename)
+	return nil
+}
+
+// exportSnapshot copies a snapshot file to the spec's export bucket, if one
+// is configured. Failures are logged, not returned.
+func (p *Pipeline) exportSnapshot(ctx context.Context, st *state, sg *saga.Saga, filename string) {
 	if st.spec.Snapshots != nil && st.spec.Snapshots.ExportBucket != "" && p.Storage != nil {
 		exportBucket := st.spec.Snapshots.ExportBucket
 		key := "snapshots/" + st.spec.App + "/" + filepath.Base(filename)
@@ -52,6 +67,4 @@ func (p *Pipeline) snapshot(ctx context.Context, st *state, sg *saga.Saga) error
 			})
 		}
 	}
-
-	return nil
 }
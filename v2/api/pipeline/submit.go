@@ -3,23 +3,17 @@ package pipeline
 import (
 	"context"
 	"fmt"
-	"os"
 
+	"norn/v2/api/model"
 	"norn/v2/api/nomad"
 	"norn/v2/api/saga"
 )
 
 func (p *Pipeline) submit(ctx context.Context, st *state, sg *saga.Saga) error {
 	// Resolve secrets for env injection
-	env := make(map[string]string)
-	if p.Secrets != nil {
-		secretEnv, err := p.Secrets.EnvMap(st.spec.App)
-		if err != nil && !os.IsNotExist(err) {
-			return fmt.Errorf("resolve secrets: %w", err)
-		}
-		for k, v := range secretEnv {
-			env[k] = v
-		}
+	env, err := p.secretEnv(st.spec)
+	if err != nil {
+		return err
 	}
 
 	if st.spec.Infrastructure != nil && st.spec.Infrastructure.ObjectStorage != nil {
@@ -31,10 +25,18 @@ func (p *Pipeline) submit(ctx context.Context, st *state, sg *saga.Saga) error {
 			return fmt.Errorf("provision object storage: %w", err)
 		}
 		if len(storageEnv.Secrets) > 0 && p.Secrets != nil {
-			if err := p.Secrets.Set(st.spec.App, storageEnv.Secrets); err != nil {
+			m := p.secretsFor(st.spec)
+			before, snapErr := m.Snapshot(st.spec.App)
+			if err := m.Set(st.spec.App, storageEnv.Secrets); err != nil {
 				_ = sg.Log(ctx, "object_storage.secrets", fmt.Sprintf("object storage secrets were generated but not persisted: %v", err), map[string]string{
 					"step": "submit",
 				})
+			} else if snapErr == nil {
+				after := copyStringMap(before)
+				for k, v := range storageEnv.Secrets {
+					after[k] = v
+				}
+				RecordSecretVersion(ctx, p.DB, st.spec.App, st.spec.HistoryEnvironments(), m, model.SecretVersionProvision, saga.ActorFrom(ctx), before, after, 0)
 			}
 		}
 		for k, v := range storageEnv.Env {
@@ -72,10 +74,10 @@ func (p *Pipeline) submit(ctx context.Context, st *state, sg *saga.Saga) error {
 
 	// Check for port conflicts before submitting
 	for _, proc := range st.spec.Processes {
-		if proc.Port > 0 && len(st.spec.Endpoints) > 0 {
+		if proc.Port > 0 && len(st.spec.Endpoints) > 0 && st.spec.ReservesPorts() {
 			if used, err := p.Nomad.UsedPorts(); err == nil {
 				for _, pa := range used {
-					if pa.Port == proc.Port && pa.JobID != st.spec.App {
+					if pa.Port == proc.Port && pa.JobID != st.spec.JobID() {
 						suggested, _ := p.Nomad.SuggestPort(proc.Port)
 						sg.Log(ctx, "port.conflict",
 							fmt.Sprintf("port %d is used by %s — suggest %d", proc.Port, pa.JobID, suggested),
@@ -87,6 +89,8 @@ func (p *Pipeline) submit(ctx context.Context, st *state, sg *saga.Saga) error {
 		}
 	}
 
+	previewDatabaseEnv(st.spec, env)
+
 	// Translate infraspec → Nomad job
 	job := nomad.Translate(st.spec, st.imageTag, env)
 
@@ -0,0 +1,417 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"norn/v2/api/model"
+	"norn/v2/api/nomad"
+)
+
+// TuningRecommendation is the CPU, memory and scale the tuner suggests for
+// one process from its live usage.
+type TuningRecommendation struct {
+	App         string               `json:"app"`
+	Process     string               `json:"process"`
+	Mode        string               `json:"mode"`
+	Confidence  string               `json:"confidence"`
+	Current     TuningResourceState  `json:"current"`
+	Recommended TuningResourceState  `json:"recommended"`
+	Observed    TuningObserved       `json:"observed"`
+	Signals     []TuningSignalResult `json:"signals"`
+	Tasks       []TuningTaskState    `json:"tasks,omitempty"`
+	Actions     []string             `json:"actions"`
+	Reasons     []string             `json:"reasons"`
+}
+
+// TuningTaskState is the reservation and live usage of one of the process's
+// extra tasks. Recommendations cover the process's own task; extra tasks
+// are reported so their share of the group is visible.
+type TuningTaskState struct {
+	Name         string  `json:"name"`
+	Lifecycle    string  `json:"lifecycle"`
+	CPU          int     `json:"cpuMHz"`
+	Memory       int     `json:"memoryMB"`
+	UsedMemoryMB int     `json:"usedMemoryMB"`
+	PeakMemoryMB int     `json:"peakMemoryMB"`
+	CPUPercent   float64 `json:"cpuPercent"`
+}
+
+type TuningResourceState struct {
+	CPU    int `json:"cpuMHz"`
+	Memory int `json:"memoryMB"`
+	Scale  int `json:"scale"`
+}
+
+type TuningObserved struct {
+	UsedMemoryMB      int        `json:"usedMemoryMB"`
+	PeakMemoryMB      int        `json:"peakMemoryMB"`
+	MemoryUtilization float64    `json:"memoryUtilization"`
+	CPUPercent        float64    `json:"cpuPercent"`
+	AllocationCount   int        `json:"allocationCount"`
+	Source            string     `json:"source"`
+	AccessRequests    int64      `json:"accessRequests,omitempty"`
+	LastAccessAt      *time.Time `json:"lastAccessAt,omitempty"`
+	QuietForHours     *float64   `json:"quietForHours,omitempty"`
+	IdleCandidate     bool       `json:"idleCandidate,omitempty"`
+}
+
+type TuningSignalResult struct {
+	Name      string  `json:"name"`
+	Source    string  `json:"source"`
+	Metric    string  `json:"metric"`
+	Window    string  `json:"window,omitempty"`
+	Aggregate string  `json:"aggregate,omitempty"`
+	Value     float64 `json:"value,omitempty"`
+	Unit      string  `json:"unit,omitempty"`
+	Available bool    `json:"available"`
+	Reason    string  `json:"reason,omitempty"`
+	Query     string  `json:"query,omitempty"`
+}
+
+// TuningUsage is a process's peak live usage across its allocations, and
+// its declared signals once EvaluateTuningSignals has resolved them.
+type TuningUsage struct {
+	UsedMemoryMB int
+	PeakMemoryMB int
+	CPUPercent   float64
+	Allocations  int
+	Signals      []TuningSignalResult
+	// Tasks holds the peaks of the process's extra tasks by name.
+	Tasks map[string]TuningTaskUsage
+}
+
+type TuningTaskUsage struct {
+	UsedMemoryMB int
+	PeakMemoryMB int
+	CPUPercent   float64
+}
+
+// AggregateTuningUsage folds allocation stats into per-group peaks of the
+// process's own task, with extra tasks kept apart.
+func AggregateTuningUsage(usage []nomad.ResourceUsage) map[string]TuningUsage {
+	usageByGroup := map[string]TuningUsage{}
+	for _, u := range usage {
+		current := usageByGroup[u.TaskGroup]
+		main := u.MainTask()
+		usedMB := int(main.MemoryUsageBytes / (1024 * 1024))
+		peakMB := int(main.MemoryMaxBytes / (1024 * 1024))
+		if usedMB > current.UsedMemoryMB {
+			current.UsedMemoryMB = usedMB
+		}
+		if peakMB > current.PeakMemoryMB {
+			current.PeakMemoryMB = peakMB
+		}
+		if main.CPUPercent > current.CPUPercent {
+			current.CPUPercent = main.CPUPercent
+		}
+		for name, t := range u.Tasks {
+			if name == u.TaskGroup {
+				continue
+			}
+			if current.Tasks == nil {
+				current.Tasks = map[string]TuningTaskUsage{}
+			}
+			peaks := current.Tasks[name]
+			peaks.UsedMemoryMB = max(peaks.UsedMemoryMB, int(t.MemoryUsageBytes/(1024*1024)))
+			peaks.PeakMemoryMB = max(peaks.PeakMemoryMB, int(t.MemoryMaxBytes/(1024*1024)))
+			peaks.CPUPercent = math.Max(peaks.CPUPercent, t.CPUPercent)
+			current.Tasks[name] = peaks
+		}
+		current.Allocations++
+		usageByGroup[u.TaskGroup] = current
+	}
+	return usageByGroup
+}
+
+// BuildTuningRecommendation suggests resources for a process from its usage,
+// clamped to the process's tuning limits.
+func BuildTuningRecommendation(app, process string, proc model.Process, usage TuningUsage) TuningRecommendation {
+	current := TuningResourceState{CPU: 100, Memory: 128, Scale: 1}
+	if proc.Resources != nil {
+		if proc.Resources.CPU > 0 {
+			current.CPU = proc.Resources.CPU
+		}
+		if proc.Resources.Memory > 0 {
+			current.Memory = proc.Resources.Memory
+		}
+	}
+	if usage.Allocations > 0 {
+		current.Scale = usage.Allocations
+	} else if proc.Scaling != nil && proc.Scaling.Min > 0 {
+		current.Scale = proc.Scaling.Min
+	}
+
+	mode := "advisory"
+	if proc.Tuning != nil && proc.Tuning.Mode != "" {
+		mode = proc.Tuning.Mode
+	}
+
+	highMem := usage.PeakMemoryMB
+	if highMem == 0 {
+		highMem = usage.UsedMemoryMB
+	}
+	cpuPercent := usage.CPUPercent
+	windowed := windowedSignals(usage.Signals)
+	if windowed.memorySignal != "" {
+		highMem = windowed.memoryMB
+	}
+	if windowed.cpuSignal != "" {
+		cpuPercent = windowed.cpuPercent
+	}
+	memUtil := 0.0
+	if current.Memory > 0 && highMem > 0 {
+		memUtil = float64(highMem) / float64(current.Memory)
+	}
+
+	rec := TuningRecommendation{
+		App:        app,
+		Process:    process,
+		Mode:       mode,
+		Confidence: "medium",
+		Current:    current,
+		Recommended: TuningResourceState{
+			CPU:    current.CPU,
+			Memory: current.Memory,
+			Scale:  current.Scale,
+		},
+		Observed: TuningObserved{
+			UsedMemoryMB:      usage.UsedMemoryMB,
+			PeakMemoryMB:      usage.PeakMemoryMB,
+			MemoryUtilization: memUtil,
+			CPUPercent:        cpuPercent,
+			AllocationCount:   usage.Allocations,
+			Source:            "nomad.live",
+		},
+	}
+
+	switch {
+	case windowed.memorySignal != "":
+		rec.Confidence = "high"
+		rec.Reasons = append(rec.Reasons, "memory from prometheus signal "+windowed.memorySignal)
+	case usage.PeakMemoryMB == 0:
+		rec.Confidence = "low"
+		rec.Reasons = append(rec.Reasons, "only live memory usage is available; no peak signal reported")
+	}
+	if windowed.cpuSignal != "" {
+		rec.Reasons = append(rec.Reasons, "cpu from prometheus signal "+windowed.cpuSignal)
+	}
+	if windowed.memorySignal != "" || windowed.cpuSignal != "" {
+		rec.Observed.Source = "prometheus"
+	}
+	switch {
+	case usage.Signals != nil:
+		rec.Signals = usage.Signals
+	case proc.Tuning != nil && len(proc.Tuning.Signals) > 0:
+		rec.Signals = tuningSignalsFromPolicy(proc.Tuning.Signals, usage)
+	default:
+		rec.Signals = defaultTuningSignals(usage)
+	}
+
+	recommendMemory(&rec, proc.Tuning, highMem, memUtil)
+	recommendCPU(&rec, proc.Tuning, cpuPercent)
+	recommendScale(&rec, proc, cpuPercent, memUtil)
+	reportTasks(&rec, proc, usage)
+	if len(rec.Actions) == 0 {
+		rec.Actions = append(rec.Actions, "keep")
+		rec.Reasons = append(rec.Reasons, "observed usage is inside advisory thresholds")
+	}
+	return rec
+}
+
+func recommendMemory(rec *TuningRecommendation, tuning *model.TuningPolicy, highMem int, memUtil float64) {
+	if rec.Current.Memory == 0 || highMem == 0 {
+		return
+	}
+	target := rec.Current.Memory
+	switch {
+	case memUtil > 0.80:
+		target = roundUpMB(max(int(math.Ceil(float64(highMem)*1.5)), int(math.Ceil(float64(rec.Current.Memory)*1.5))))
+		target = clampMemory(tuning, target)
+		if target > rec.Current.Memory {
+			rec.Recommended.Memory = target
+			rec.Actions = append(rec.Actions, "increase_memory")
+			rec.Reasons = append(rec.Reasons, "memory signal exceeds 80% of declared limit")
+		}
+	case memUtil < 0.30:
+		target = max(rec.Current.Memory/2, highMem*2)
+		target = roundUpMB(target)
+		target = clampMemory(tuning, target)
+		if target > 0 && target < rec.Current.Memory {
+			rec.Recommended.Memory = target
+			rec.Actions = append(rec.Actions, "decrease_memory")
+			rec.Reasons = append(rec.Reasons, "memory signal is below 30% of declared limit")
+		}
+	}
+}
+
+func recommendCPU(rec *TuningRecommendation, tuning *model.TuningPolicy, cpuPercent float64) {
+	if rec.Current.CPU == 0 {
+		return
+	}
+	target := rec.Current.CPU
+	switch {
+	case cpuPercent > 80:
+		target = roundUpCPU(max(int(math.Ceil(float64(rec.Current.CPU)*1.5)), rec.Current.CPU+25))
+		target = clampCPU(tuning, target)
+		if target > rec.Current.CPU {
+			rec.Recommended.CPU = target
+			rec.Actions = append(rec.Actions, "increase_cpu")
+			rec.Reasons = append(rec.Reasons, "cpu signal exceeds 80%")
+		}
+	case cpuPercent < 10 && rec.Current.CPU > 25:
+		target = roundUpCPU(max(rec.Current.CPU/2, 25))
+		target = clampCPU(tuning, target)
+		if target > 0 && target < rec.Current.CPU {
+			rec.Recommended.CPU = target
+			rec.Actions = append(rec.Actions, "decrease_cpu")
+			rec.Reasons = append(rec.Reasons, "cpu signal is below 10%")
+		}
+	}
+}
+
+// reportTasks lists the process's extra tasks with their reservations and
+// usage, and flags long-running ones close to their memory.
+func reportTasks(rec *TuningRecommendation, proc model.Process, usage TuningUsage) {
+	for _, t := range proc.Tasks {
+		cpu, memory := model.TaskResources(t.Resources)
+		observed := usage.Tasks[t.Name]
+		rec.Tasks = append(rec.Tasks, TuningTaskState{
+			Name:         t.Name,
+			Lifecycle:    t.Lifecycle,
+			CPU:          cpu,
+			Memory:       memory,
+			UsedMemoryMB: observed.UsedMemoryMB,
+			PeakMemoryMB: observed.PeakMemoryMB,
+			CPUPercent:   observed.CPUPercent,
+		})
+		high := max(observed.PeakMemoryMB, observed.UsedMemoryMB)
+		if t.Lifecycle == model.TaskSidecar && float64(high) > float64(memory)*0.80 {
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("task %s memory exceeds 80%% of its %dMB; raise its resources.memory", t.Name, memory))
+		}
+	}
+}
+
+func recommendScale(rec *TuningRecommendation, proc model.Process, cpuPercent, memUtil float64) {
+	if proc.Scaling == nil || rec.Current.Scale == 0 {
+		return
+	}
+	minScale := proc.Scaling.Min
+	if minScale == 0 {
+		minScale = 1
+	}
+	maxScale := proc.Scaling.Max
+	switch {
+	case (cpuPercent > 70 || memUtil > 0.80) && maxScale > 0 && rec.Current.Scale < maxScale:
+		rec.Recommended.Scale = rec.Current.Scale + 1
+		rec.Actions = append(rec.Actions, "increase_scale")
+		rec.Reasons = append(rec.Reasons, "load signal is above scale-up threshold")
+	case cpuPercent < 10 && memUtil < 0.30 && rec.Current.Scale > minScale:
+		rec.Recommended.Scale = rec.Current.Scale - 1
+		rec.Actions = append(rec.Actions, "decrease_scale")
+		rec.Reasons = append(rec.Reasons, "load signal is below scale-down threshold")
+	}
+}
+
+func defaultTuningSignals(usage TuningUsage) []TuningSignalResult {
+	return []TuningSignalResult{
+		{Name: "memory_rss", Source: "nomad", Metric: "memory_rss", Aggregate: "current", Value: float64(usage.UsedMemoryMB), Unit: "MB", Available: usage.UsedMemoryMB > 0},
+		{Name: "memory_max", Source: "nomad", Metric: "memory_max", Aggregate: "max", Value: float64(usage.PeakMemoryMB), Unit: "MB", Available: usage.PeakMemoryMB > 0, Reason: unavailableReason(usage.PeakMemoryMB > 0, "nomad did not report a peak memory value")},
+		{Name: "cpu_percent", Source: "nomad", Metric: "cpu_percent", Aggregate: "current", Value: usage.CPUPercent, Unit: "percent", Available: true},
+	}
+}
+
+func tuningSignalsFromPolicy(signals []model.TuningSignal, usage TuningUsage) []TuningSignalResult {
+	out := make([]TuningSignalResult, 0, len(signals))
+	for _, signal := range signals {
+		result := TuningSignalResult{
+			Name:      firstNonEmptyString(signal.Name, signal.Metric),
+			Source:    firstNonEmptyString(signal.Source, "nomad"),
+			Metric:    signal.Metric,
+			Window:    signal.Window,
+			Aggregate: signal.Aggregate,
+		}
+		switch result.Source + ":" + result.Metric {
+		case "nomad:memory_rss":
+			result.Value = float64(usage.UsedMemoryMB)
+			result.Unit = "MB"
+			result.Available = usage.UsedMemoryMB > 0
+			result.Reason = unavailableReason(result.Available, "nomad did not report live memory")
+		case "nomad:memory_max":
+			result.Value = float64(usage.PeakMemoryMB)
+			result.Unit = "MB"
+			result.Available = usage.PeakMemoryMB > 0
+			result.Reason = unavailableReason(result.Available, "nomad did not report a peak memory value")
+		case "nomad:cpu_percent":
+			result.Value = usage.CPUPercent
+			result.Unit = "percent"
+			result.Available = true
+		default:
+			result.Available = false
+			result.Reason = "signal source is declared but not connected to the advisory tuner yet"
+			if result.Source == "prometheus" {
+				result.Reason = "prometheus signal was not evaluated"
+			}
+		}
+		out = append(out, result)
+	}
+	return out
+}
+
+func clampMemory(tuning *model.TuningPolicy, value int) int {
+	if tuning == nil || tuning.Limits == nil {
+		return max(value, 128)
+	}
+	if tuning.Limits.Min.Memory > 0 && value < tuning.Limits.Min.Memory {
+		value = tuning.Limits.Min.Memory
+	}
+	if tuning.Limits.Max.Memory > 0 && value > tuning.Limits.Max.Memory {
+		value = tuning.Limits.Max.Memory
+	}
+	return value
+}
+
+func clampCPU(tuning *model.TuningPolicy, value int) int {
+	if tuning == nil || tuning.Limits == nil {
+		return max(value, 25)
+	}
+	if tuning.Limits.Min.CPU > 0 && value < tuning.Limits.Min.CPU {
+		value = tuning.Limits.Min.CPU
+	}
+	if tuning.Limits.Max.CPU > 0 && value > tuning.Limits.Max.CPU {
+		value = tuning.Limits.Max.CPU
+	}
+	return value
+}
+
+func roundUpMB(value int) int {
+	return roundUp(value, 64)
+}
+
+func roundUpCPU(value int) int {
+	return roundUp(value, 25)
+}
+
+func roundUp(value, step int) int {
+	if value <= 0 || step <= 0 {
+		return value
+	}
+	return ((value + step - 1) / step) * step
+}
+
+func firstNonEmptyString(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func unavailableReason(available bool, reason string) string {
+	if available {
+		return ""
+	}
+	return reason
+}
@@ -0,0 +1,357 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	nomadapi "github.com/hashicorp/nomad/api"
+
+	"norn/v2/api/hub"
+	"norn/v2/api/model"
+	"norn/v2/api/nomad"
+	"norn/v2/api/saga"
+	"norn/v2/api/store"
+)
+
+// Tune settles the tuning changes it applied earlier to spec's auto-tuned
+// processes, keeping them once they outlive the revert window or reverting
+// them if the process is OOM killed or fails health first, and then applies
+// the recommendation for one process whose cooldown has passed. It returns
+// the changes it applied or settled.
+func (p *Pipeline) Tune(ctx context.Context, spec *model.InfraSpec, now time.Time) ([]model.TuningChange, error) {
+	if p.DB == nil {
+		return nil, nil
+	}
+	var procs []string
+	for name, proc := range spec.Processes {
+		if proc.Tuning.AutoApplies() && proc.Schedule == "" && proc.Function == nil {
+			procs = append(procs, name)
+		}
+	}
+	if len(procs) == 0 {
+		return nil, nil
+	}
+	sort.Strings(procs)
+
+	jobID := spec.JobID()
+	live, err := p.Nomad.JobInfo(jobID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read job %s: %w", jobID, err)
+	}
+
+	var out []model.TuningChange
+	var ready []string
+	latestChanges := map[string]*model.TuningChange{}
+	for _, name := range procs {
+		latest, err := p.DB.LatestTuningChange(ctx, spec.App, name)
+		if err != nil {
+			return out, fmt.Errorf("tuning history for %s/%s: %w", spec.App, name, err)
+		}
+		latestChanges[name] = latest
+		if latest != nil && latest.Status == model.TuningChangeApplied {
+			settled, err := p.settleTuningChange(ctx, spec, live, latest, now)
+			if err != nil {
+				return out, err
+			}
+			if settled != nil {
+				out = append(out, *settled)
+			}
+			continue
+		}
+		if latest != nil && now.Sub(latest.CreatedAt) < spec.Processes[name].Tuning.CooldownPeriod() {
+			continue
+		}
+		ready = append(ready, name)
+	}
+	if len(ready) == 0 || len(out) > 0 || hasCanaryConfig(spec) {
+		return out, nil
+	}
+	active, err := p.DB.ListOperations(ctx, store.OperationFilter{App: spec.App, Active: true, Limit: 1})
+	if err != nil {
+		return out, fmt.Errorf("check operations: %w", err)
+	}
+	if len(active) > 0 {
+		return out, nil
+	}
+
+	usage, err := p.Nomad.JobResourceUsage(jobID)
+	if err != nil {
+		return out, fmt.Errorf("resource usage for %s: %w", jobID, err)
+	}
+	usageByGroup := AggregateTuningUsage(usage)
+	// One process per pass, so each change gets a rollout of its own.
+	for _, name := range ready {
+		u, ok := usageByGroup[name]
+		if !ok {
+			continue
+		}
+		cpu, memory, ok := liveResources(live, name)
+		if !ok {
+			continue
+		}
+		proc := spec.Processes[name]
+		proc.Resources = &model.Resources{CPU: cpu, Memory: memory}
+		u = EvaluateTuningSignals(ctx, p.Prometheus, jobID, spec.App, name, proc, u)
+		rec := BuildTuningRecommendation(spec.App, name, proc, u)
+		toCPU, toMemory, ok := tunedResources(rec)
+		if !ok || retriesReverted(latestChanges[name], toCPU, toMemory) {
+			continue
+		}
+		change := &model.TuningChange{
+			App:        spec.App,
+			Process:    name,
+			FromCPU:    cpu,
+			FromMemory: memory,
+			ToCPU:      toCPU,
+			ToMemory:   toMemory,
+			Reason:     strings.Join(rec.Reasons, "; "),
+			Patch:      tuningPatch(name, cpu, memory, toCPU, toMemory),
+			Status:     model.TuningChangeApplied,
+		}
+		if err := p.applyTuning(ctx, spec, live, change); err != nil {
+			return out, err
+		}
+		return append(out, *change), nil
+	}
+	return out, nil
+}
+
+func (p *Pipeline) applyTuning(ctx context.Context, spec *model.InfraSpec, live *nomadapi.Job, change *model.TuningChange) error {
+	jobID := spec.JobID()
+	sg := saga.New(p.SagaStore, spec.App, "tuner", "tuning")
+	change.SagaID = sg.ID
+	meta := tuningMetadata(jobID, change)
+
+	job, err := p.tunedJob(spec, live, change.Process, change.ToCPU, change.ToMemory)
+	if err == nil {
+		var evalID string
+		if evalID, err = p.Nomad.SubmitJob(job); err == nil {
+			meta["evalId"] = evalID
+		}
+	}
+	if err != nil {
+		sg.Log(ctx, "tuning.apply_failed", fmt.Sprintf("resubmit %s/%s with tuned resources: %v", jobID, change.Process, err), meta)
+		return fmt.Errorf("tune %s/%s: %w", jobID, change.Process, err)
+	}
+	if err := p.DB.RecordTuningChange(ctx, change); err != nil {
+		return fmt.Errorf("record tuning of %s/%s: %w", jobID, change.Process, err)
+	}
+	meta["changeId"] = strconv.FormatInt(change.ID, 10)
+	sg.Log(ctx, "tuning.apply", fmt.Sprintf("%s/%s resubmitted with %s: %s", jobID, change.Process, tuningSummary(change), change.Reason), meta)
+	p.emitBeacon(ctx, model.BeaconEvent{
+		App:       spec.App,
+		Type:      "tuning.applied",
+		Severity:  model.BeaconInfo,
+		Title:     fmt.Sprintf("%s/%s tuned: %s", jobID, change.Process, tuningSummary(change)),
+		Body:      fmt.Sprintf("%s\n\nKeep it across deploys with this infraspec change:\n\n%s", change.Reason, change.Patch),
+		DedupeKey: fmt.Sprintf("%s:%s:tuning:%d", jobID, change.Process, change.ID),
+		Metadata: map[string]interface{}{
+			"process":  change.Process,
+			"changeId": change.ID,
+			"patch":    change.Patch,
+			"sagaId":   sg.ID,
+		},
+	})
+	p.WS.Broadcast(hub.Event{Type: "tuning.applied", AppID: spec.App, Payload: map[string]string{
+		"process": change.Process,
+		"sagaId":  sg.ID,
+	}})
+	return nil
+}
+
+// settleTuningChange keeps or reverts an applied change, or returns nil
+// while it is still inside its revert window.
+func (p *Pipeline) settleTuningChange(ctx context.Context, spec *model.InfraSpec, live *nomadapi.Job, change *model.TuningChange, now time.Time) (*model.TuningChange, error) {
+	jobID := spec.JobID()
+	sg := saga.NewWithID(p.SagaStore, change.SagaID, spec.App, "tuner", "tuning")
+	meta := tuningMetadata(jobID, change)
+
+	cpu, memory, ok := liveResources(live, change.Process)
+	if !ok || cpu != change.ToCPU || memory != change.ToMemory {
+		// A deploy, or Nomad's own auto-revert, replaced the tuned job.
+		return p.finishTuningChange(ctx, sg, change, model.TuningChangeSuperseded, "the running job no longer has the tuned resources", meta)
+	}
+
+	restarts, err := p.Nomad.TaskRestartSummary(jobID)
+	if err != nil {
+		return nil, fmt.Errorf("restarts for %s: %w", jobID, err)
+	}
+	allocs, err := p.Nomad.DeploymentAllocations(jobID)
+	if err != nil {
+		return nil, fmt.Errorf("allocations for %s: %w", jobID, err)
+	}
+	if reason := tuningFailure(change, restarts, allocs); reason != "" {
+		job, err := p.tunedJob(spec, live, change.Process, change.FromCPU, change.FromMemory)
+		if err == nil {
+			_, err = p.Nomad.SubmitJob(job)
+		}
+		if err != nil {
+			sg.Log(ctx, "tuning.revert_failed", fmt.Sprintf("restore %s/%s to cpu %d MHz, memory %d MB: %v", jobID, change.Process, change.FromCPU, change.FromMemory, err), meta)
+			return nil, fmt.Errorf("revert tuning of %s/%s: %w", jobID, change.Process, err)
+		}
+		settled, err := p.finishTuningChange(ctx, sg, change, model.TuningChangeReverted, reason, meta)
+		if err != nil {
+			return nil, err
+		}
+		p.emitBeacon(ctx, model.BeaconEvent{
+			App:       spec.App,
+			Type:      "tuning.reverted",
+			Severity:  model.BeaconWarning,
+			Title:     fmt.Sprintf("%s/%s tuning reverted", jobID, change.Process),
+			Body:      fmt.Sprintf("%s after %s. Restored cpu %d MHz, memory %d MB.", reason, tuningSummary(change), change.FromCPU, change.FromMemory),
+			DedupeKey: fmt.Sprintf("%s:%s:tuning:%d:reverted", jobID, change.Process, change.ID),
+			Metadata: map[string]interface{}{
+				"process":  change.Process,
+				"changeId": change.ID,
+				"sagaId":   change.SagaID,
+			},
+		})
+		return settled, nil
+	}
+
+	window := spec.Processes[change.Process].Tuning.RevertAfter()
+	if now.Sub(change.CreatedAt) < window {
+		return nil, nil
+	}
+	return p.finishTuningChange(ctx, sg, change, model.TuningChangeKept, fmt.Sprintf("no OOM kills or failed health checks in %s", window), meta)
+}
+
+func (p *Pipeline) finishTuningChange(ctx context.Context, sg *saga.Saga, change *model.TuningChange, status, reason string, meta map[string]string) (*model.TuningChange, error) {
+	if err := p.DB.SettleTuningChange(ctx, change.ID, status, reason); err != nil {
+		return nil, fmt.Errorf("settle tuning change %d: %w", change.ID, err)
+	}
+	settled := *change
+	settled.Status = status
+	settled.StatusReason = reason
+	action := "tuning." + status
+	sg.Log(ctx, action, fmt.Sprintf("%s/%s %s %s: %s", sg.App, change.Process, tuningSummary(change), status, reason), meta)
+	p.WS.Broadcast(hub.Event{Type: action, AppID: sg.App, Payload: map[string]string{
+		"process": change.Process,
+		"sagaId":  sg.ID,
+	}})
+	return &settled, nil
+}
+
+// tunedJob is the job spec translates to, with the live image and the state
+// reconcileLiveState carries over, and process given cpu and memory.
+func (p *Pipeline) tunedJob(spec *model.InfraSpec, live *nomadapi.Job, process string, cpu, memory int) (*nomadapi.Job, error) {
+	image := liveImage(live)
+	if image == "" {
+		return nil, fmt.Errorf("the live job has no image")
+	}
+	env, err := p.secretEnv(spec)
+	if err != nil {
+		return nil, err
+	}
+	job := nomad.Translate(spec, image, env)
+	reconcileLiveState(spec, job, live)
+	for _, tg := range job.TaskGroups {
+		if *tg.Name != process {
+			continue
+		}
+		for _, task := range tg.Tasks {
+			if task.Name == process && task.Resources != nil {
+				task.Resources.CPU = &cpu
+				task.Resources.MemoryMB = &memory
+			}
+		}
+	}
+	return job, nil
+}
+
+// liveResources returns the CPU and memory the process's task runs with.
+func liveResources(job *nomadapi.Job, process string) (int, int, bool) {
+	for _, tg := range job.TaskGroups {
+		if tg.Name == nil || *tg.Name != process {
+			continue
+		}
+		for _, task := range tg.Tasks {
+			if task.Name != process || task.Resources == nil || task.Resources.CPU == nil || task.Resources.MemoryMB == nil {
+				continue
+			}
+			return *task.Resources.CPU, *task.Resources.MemoryMB, true
+		}
+	}
+	return 0, 0, false
+}
+
+// tunedResources picks the CPU and memory to apply from rec. Scale
+// suggestions stay advisory; scaling.auto owns counts. Without a peak memory
+// signal only increases are applied.
+func tunedResources(rec TuningRecommendation) (int, int, bool) {
+	cpu, memory := rec.Recommended.CPU, rec.Recommended.Memory
+	if rec.Confidence == "low" {
+		cpu = max(cpu, rec.Current.CPU)
+		memory = max(memory, rec.Current.Memory)
+	}
+	if cpu == rec.Current.CPU && memory == rec.Current.Memory {
+		return 0, 0, false
+	}
+	return cpu, memory, true
+}
+
+// retriesReverted reports whether applying cpu and memory would repeat the
+// process's last change, which was reverted for OOM kills or failed health.
+func retriesReverted(latest *model.TuningChange, cpu, memory int) bool {
+	return latest != nil && latest.Status == model.TuningChangeReverted && latest.ToCPU == cpu && latest.ToMemory == memory
+}
+
+// tuningFailure says why an applied change should be reverted: a task of
+// the process was OOM killed since the change, or one of its allocations
+// failed its health checks. It returns "" when neither happened.
+func tuningFailure(change *model.TuningChange, restarts []nomad.TaskRestartInfo, allocs []nomad.DeploymentAllocation) string {
+	for _, r := range restarts {
+		if r.TaskGroup == change.Process && r.OOMKilled && r.LastRestart.After(change.CreatedAt) {
+			return fmt.Sprintf("allocation %s was OOM killed", r.AllocID)
+		}
+	}
+	for _, a := range allocs {
+		if a.TaskGroup == change.Process && a.Healthy != nil && !*a.Healthy {
+			return fmt.Sprintf("allocation %s failed its health checks", a.ID)
+		}
+	}
+	return ""
+}
+
+// tuningPatch is the infraspec change that keeps a tuning change across
+// deploys.
+func tuningPatch(process string, fromCPU, fromMemory, toCPU, toMemory int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "processes:\n  %s:\n    resources:\n", process)
+	if toCPU != fromCPU {
+		fmt.Fprintf(&b, "      cpu: %d # was %d\n", toCPU, fromCPU)
+	}
+	if toMemory != fromMemory {
+		fmt.Fprintf(&b, "      memory: %d # was %d\n", toMemory, fromMemory)
+	}
+	return b.String()
+}
+
+func tuningSummary(c *model.TuningChange) string {
+	var parts []string
+	if c.ToCPU != c.FromCPU {
+		parts = append(parts, fmt.Sprintf("cpu %d → %d MHz", c.FromCPU, c.ToCPU))
+	}
+	if c.ToMemory != c.FromMemory {
+		parts = append(parts, fmt.Sprintf("memory %d → %d MB", c.FromMemory, c.ToMemory))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func tuningMetadata(jobID string, c *model.TuningChange) map[string]string {
+	return map[string]string{
+		"jobId":      jobID,
+		"group":      c.Process,
+		"fromCpu":    strconv.Itoa(c.FromCPU),
+		"fromMemory": strconv.Itoa(c.FromMemory),
+		"toCpu":      strconv.Itoa(c.ToCPU),
+		"toMemory":   strconv.Itoa(c.ToMemory),
+	}
+}
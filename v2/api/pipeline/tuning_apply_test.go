@@ -0,0 +1,105 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"norn/v2/api/model"
+	"norn/v2/api/nomad"
+)
+
+func TestTunedResourcesOnlyRaisesWithoutPeakSignal(t *testing.T) {
+	rec := TuningRecommendation{
+		Confidence:  "medium",
+		Current:     TuningResourceState{CPU: 100, Memory: 1024},
+		Recommended: TuningResourceState{CPU: 50, Memory: 512},
+	}
+	if cpu, memory, ok := tunedResources(rec); !ok || cpu != 50 || memory != 512 {
+		t.Fatalf("tunedResources = %d, %d, %v; want 50, 512, true", cpu, memory, ok)
+	}
+
+	rec.Confidence = "low"
+	if _, _, ok := tunedResources(rec); ok {
+		t.Fatal("low confidence decreases should stay advisory")
+	}
+	rec.Recommended.Memory = 1536
+	if cpu, memory, ok := tunedResources(rec); !ok || cpu != 100 || memory != 1536 {
+		t.Fatalf("tunedResources = %d, %d, %v; want 100, 1536, true", cpu, memory, ok)
+	}
+}
+
+func TestTuningFailure(t *testing.T) {
+	applied := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	change := &model.TuningChange{Process: "web", CreatedAt: applied}
+	healthy, unhealthy := true, false
+
+	restarts := []nomad.TaskRestartInfo{
+		{TaskGroup: "web", AllocID: "aaaa1111", OOMKilled: true, LastRestart: applied.Add(-time.Hour)},
+		{TaskGroup: "worker", AllocID: "bbbb2222", OOMKilled: true, LastRestart: applied.Add(time.Minute)},
+	}
+	allocs := []nomad.DeploymentAllocation{
+		{ID: "cccc3333", TaskGroup: "web", Healthy: &healthy},
+		{ID: "dddd4444", TaskGroup: "worker", Healthy: &unhealthy},
+	}
+	if reason := tuningFailure(change, restarts, allocs); reason != "" {
+		t.Fatalf("old OOMs and other groups should not count, got %q", reason)
+	}
+
+	restarts = append(restarts, nomad.TaskRestartInfo{TaskGroup: "web", AllocID: "eeee5555", OOMKilled: true, LastRestart: applied.Add(2 * time.Minute)})
+	if reason := tuningFailure(change, restarts, allocs); !strings.Contains(reason, "eeee5555 was OOM killed") {
+		t.Fatalf("reason = %q, want OOM kill", reason)
+	}
+
+	allocs = append(allocs, nomad.DeploymentAllocation{ID: "ffff6666", TaskGroup: "web", Healthy: &unhealthy})
+	if reason := tuningFailure(change, nil, allocs); !strings.Contains(reason, "ffff6666 failed its health checks") {
+		t.Fatalf("reason = %q, want failed health", reason)
+	}
+}
+
+func TestTuningPatch(t *testing.T) {
+	got := tuningPatch("web", 100, 1024, 100, 512)
+	want := "processes:\n  web:\n    resources:\n      memory: 512 # was 1024\n"
+	if got != want {
+		t.Fatalf("patch:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRetriesReverted(t *testing.T) {
+	reverted := &model.TuningChange{Status: model.TuningChangeReverted, ToCPU: 50, ToMemory: 512}
+	if !retriesReverted(reverted, 50, 512) {
+		t.Fatal("the same values as a reverted change should not be retried")
+	}
+	if retriesReverted(reverted, 50, 768) {
+		t.Fatal("different values may be applied")
+	}
+	superseded := &model.TuningChange{Status: model.TuningChangeSuperseded, ToCPU: 50, ToMemory: 512}
+	if retriesReverted(superseded, 50, 512) {
+		t.Fatal("a change a deploy replaced may be applied again")
+	}
+}
+
+func TestReconcileLiveStateKeepsTunedResources(t *testing.T) {
+	spec := &model.InfraSpec{
+		App: "shop",
+		Processes: map[string]model.Process{
+			"web":    {Port: 8080, Resources: &model.Resources{CPU: 100, Memory: 1024}, Tuning: &model.TuningPolicy{Mode: "auto"}},
+			"worker": {Command: "./work", Resources: &model.Resources{CPU: 100, Memory: 256}},
+		},
+	}
+	live := nomad.Translate(spec, "shop:abc", nil)
+	for _, tg := range live.TaskGroups {
+		cpu, memory := 50, 512
+		tg.Tasks[0].Resources.CPU = &cpu
+		tg.Tasks[0].Resources.MemoryMB = &memory
+	}
+	desired := nomad.Translate(spec, "shop:abc", nil)
+	reconcileLiveState(spec, desired, live)
+
+	if cpu, memory, _ := liveResources(desired, "web"); cpu != 50 || memory != 512 {
+		t.Fatalf("web = %d MHz, %d MB; want the tuned 50, 512", cpu, memory)
+	}
+	if cpu, memory, _ := liveResources(desired, "worker"); cpu != 100 || memory != 256 {
+		t.Fatalf("worker = %d MHz, %d MB; want the spec's 100, 256", cpu, memory)
+	}
+}
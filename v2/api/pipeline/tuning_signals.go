@@ -0,0 +1,172 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"norn/v2/api/model"
+	"norn/v2/api/prometheus"
+)
+
+// defaultSignalWindow is the window of a windowed Prometheus signal that
+// does not declare one.
+const defaultSignalWindow = 30 * time.Minute
+
+// nomadAllocMetrics are the allocation series Nomad clients export to
+// Prometheus for the built-in signal metrics.
+var nomadAllocMetrics = map[string]string{
+	"memory_rss":  "nomad_client_allocs_memory_rss",
+	"memory_max":  "nomad_client_allocs_memory_max_usage",
+	"cpu_percent": "nomad_client_allocs_cpu_total_percent",
+}
+
+// EvaluateTuningSignals resolves the process's declared tuning signals and
+// returns usage with Signals set: nomad signals from the live usage,
+// prometheus signals by querying q over their window. Processes without
+// declared signals get usage back unchanged.
+func EvaluateTuningSignals(ctx context.Context, q *prometheus.Client, jobID, app, process string, proc model.Process, usage TuningUsage) TuningUsage {
+	if proc.Tuning == nil || len(proc.Tuning.Signals) == 0 {
+		return usage
+	}
+	results := tuningSignalsFromPolicy(proc.Tuning.Signals, usage)
+	// One unreachable answer is enough; the rest would wait out the timeout.
+	var down error
+	for i, signal := range proc.Tuning.Signals {
+		if results[i].Source != "prometheus" {
+			continue
+		}
+		result := &results[i]
+		if q == nil {
+			result.Reason = "prometheus is not configured; set NORN_PROMETHEUS_URL"
+			continue
+		}
+		expr, scale, err := prometheusSignalQuery(jobID, app, process, signal, result)
+		if err != nil {
+			result.Reason = err.Error()
+			continue
+		}
+		result.Query = expr
+		if down != nil {
+			result.Reason = down.Error()
+			continue
+		}
+		value, ok, err := q.Value(ctx, expr)
+		switch {
+		case prometheus.IsUnavailable(err):
+			down = err
+			result.Reason = err.Error()
+		case err != nil:
+			result.Reason = "query failed: " + err.Error()
+		case !ok:
+			result.Reason = "no samples matched"
+			if result.Window != "" {
+				result.Reason += " over " + result.Window
+			}
+		default:
+			result.Value = math.Round(value*scale*100) / 100
+			result.Available = true
+			result.Reason = ""
+		}
+	}
+	usage.Signals = results
+	return usage
+}
+
+// prometheusSignalQuery builds the query for a prometheus signal and the
+// factor its value is scaled by into result.Unit. Built-in metrics read
+// the Nomad allocation series of the process; other metric names read the
+// series Norn scrapes from the process, labelled app and process; custom
+// signals run their query as written.
+func prometheusSignalQuery(jobID, app, process string, signal model.TuningSignal, result *TuningSignalResult) (string, float64, error) {
+	var expr string
+	scale := 1.0
+	switch {
+	case nomadAllocMetrics[signal.Metric] != "":
+		expr = prometheus.Selector(nomadAllocMetrics[signal.Metric], map[string]string{
+			"job":        jobID,
+			"task_group": process,
+			"task":       process,
+		})
+		result.Unit = "percent"
+		if signal.Metric != "cpu_percent" {
+			result.Unit, scale = "MB", 1.0/(1024*1024)
+		}
+	case signal.Metric == "custom":
+		expr = strings.TrimSpace(signal.Query)
+		if expr == "" {
+			return "", 0, fmt.Errorf("custom prometheus signals need a query")
+		}
+	case prometheus.IsSelector(signal.Metric) && !strings.Contains(signal.Metric, "{"):
+		expr = prometheus.Selector(signal.Metric, map[string]string{"app": app, "process": process})
+	default:
+		expr = signal.Metric
+	}
+	if memorySeries(signal.Metric) {
+		result.Unit, scale = "MB", 1.0/(1024*1024)
+	}
+
+	window := defaultSignalWindow
+	if signal.Window != "" {
+		d, err := time.ParseDuration(signal.Window)
+		if err != nil || d <= 0 {
+			return "", 0, fmt.Errorf("invalid window %q", signal.Window)
+		}
+		window = d
+	}
+	aggregate := firstNonEmptyString(signal.Aggregate, "current")
+	if aggregate != "current" && result.Window == "" {
+		result.Window = prometheus.Duration(window)
+	}
+	query, err := prometheus.OverWindow(aggregate, expr, window)
+	return query, scale, err
+}
+
+// memorySeries reports whether a signal metric names a memory series in
+// bytes, such as container_memory_working_set_bytes.
+func memorySeries(metric string) bool {
+	name, _, _ := strings.Cut(metric, "{")
+	return strings.Contains(name, "memory") && strings.HasSuffix(name, "_bytes")
+}
+
+// windowedUsage is the highest memory and CPU reported by available
+// Prometheus signals. Unlike Nomad's live stats they cover a window, so
+// they take precedence in recommendations.
+type windowedUsage struct {
+	memoryMB     int
+	memorySignal string
+	cpuPercent   float64
+	cpuSignal    string
+}
+
+func windowedSignals(signals []TuningSignalResult) windowedUsage {
+	var w windowedUsage
+	for _, s := range signals {
+		if s.Source != "prometheus" || !s.Available {
+			continue
+		}
+		switch {
+		case s.Unit == "MB":
+			if mb := int(math.Ceil(s.Value)); w.memorySignal == "" || mb > w.memoryMB {
+				w.memoryMB, w.memorySignal = mb, describeSignal(s)
+			}
+		case s.Metric == "cpu_percent":
+			if w.cpuSignal == "" || s.Value > w.cpuPercent {
+				w.cpuPercent, w.cpuSignal = s.Value, describeSignal(s)
+			}
+		}
+	}
+	return w
+}
+
+// describeSignal names a signal and its aggregate for reasons, e.g.
+// "memory-p95 (p95 over 24h)".
+func describeSignal(s TuningSignalResult) string {
+	aggregate := firstNonEmptyString(s.Aggregate, "current")
+	if s.Window != "" && aggregate != "current" {
+		aggregate += " over " + s.Window
+	}
+	return s.Name + " (" + aggregate + ")"
+}
@@ -0,0 +1,203 @@
+package pipeline
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"norn/v2/api/model"
+	"norn/v2/api/nomad"
+	"norn/v2/api/prometheus"
+)
+
+func TestBuildTuningRecommendationSuggestsHalfDownMemoryAndCPU(t *testing.T) {
+	rec := BuildTuningRecommendation("quiet-app", "web", model.Process{
+		Resources: &model.Resources{CPU: 100, Memory: 1024},
+	}, TuningUsage{
+		UsedMemoryMB: 80,
+		PeakMemoryMB: 100,
+		CPUPercent:   2,
+		Allocations:  1,
+	})
+
+	if rec.Recommended.Memory != 512 {
+		t.Fatalf("recommended memory = %d, want 512", rec.Recommended.Memory)
+	}
+	if rec.Recommended.CPU != 50 {
+		t.Fatalf("recommended cpu = %d, want 50", rec.Recommended.CPU)
+	}
+	assertAction(t, rec.Actions, "decrease_memory")
+	assertAction(t, rec.Actions, "decrease_cpu")
+}
+
+func TestBuildTuningRecommendationClampsToTuningLimits(t *testing.T) {
+	rec := BuildTuningRecommendation("limited-app", "web", model.Process{
+		Resources: &model.Resources{CPU: 100, Memory: 1024},
+		Tuning: &model.TuningPolicy{
+			Mode: "advisory",
+			Limits: &model.TuningLimits{
+				Min: model.TuningProfile{CPU: 75, Memory: 768, Scale: 1},
+				Max: model.TuningProfile{CPU: 200, Memory: 2048, Scale: 2},
+			},
+		},
+	}, TuningUsage{
+		UsedMemoryMB: 40,
+		PeakMemoryMB: 80,
+		CPUPercent:   1,
+		Allocations:  1,
+	})
+
+	if rec.Recommended.Memory != 768 {
+		t.Fatalf("recommended memory = %d, want min clamp 768", rec.Recommended.Memory)
+	}
+	if rec.Recommended.CPU != 75 {
+		t.Fatalf("recommended cpu = %d, want min clamp 75", rec.Recommended.CPU)
+	}
+}
+
+func TestBuildTuningRecommendationReportsDeclaredSignals(t *testing.T) {
+	rec := BuildTuningRecommendation("signals-app", "web", model.Process{
+		Resources: &model.Resources{CPU: 50, Memory: 512},
+		Tuning: &model.TuningPolicy{
+			Signals: []model.TuningSignal{
+				{Name: "rss", Source: "nomad", Metric: "memory_rss"},
+				{Name: "p95", Source: "prometheus", Metric: "container_memory_working_set_bytes", Window: "24h", Aggregate: "p95"},
+			},
+		},
+	}, TuningUsage{
+		UsedMemoryMB: 120,
+		CPUPercent:   4,
+		Allocations:  1,
+	})
+
+	if len(rec.Signals) != 2 {
+		t.Fatalf("signals = %+v, want 2", rec.Signals)
+	}
+	if !rec.Signals[0].Available || rec.Signals[0].Value != 120 {
+		t.Fatalf("nomad signal = %+v, want available value 120", rec.Signals[0])
+	}
+	if rec.Signals[1].Available || rec.Signals[1].Reason == "" {
+		t.Fatalf("prometheus signal = %+v, want unavailable with reason", rec.Signals[1])
+	}
+	if rec.Confidence != "low" {
+		t.Fatalf("confidence = %q, want low without peak signal", rec.Confidence)
+	}
+}
+
+func TestEvaluateTuningSignalsQueriesPrometheusWindows(t *testing.T) {
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("query")
+		queries = append(queries, q)
+		switch {
+		case strings.HasPrefix(q, "max(quantile_over_time(0.95, container_memory_working_set_bytes{"):
+			// 460 MiB p95 over the day, against a 512 MB limit.
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1760600000,"482344960"]}]}}`))
+		case strings.HasPrefix(q, "max(max_over_time(nomad_client_allocs_cpu_total_percent{"):
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1760600000,"91.5"]}]}}`))
+		default:
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+		}
+	}))
+	defer srv.Close()
+
+	proc := model.Process{
+		Resources: &model.Resources{CPU: 100, Memory: 512},
+		Tuning: &model.TuningPolicy{
+			Signals: []model.TuningSignal{
+				{Name: "rss", Source: "nomad", Metric: "memory_rss"},
+				{Name: "memory-p95", Source: "prometheus", Metric: "container_memory_working_set_bytes", Window: "24h", Aggregate: "p95"},
+				{Name: "cpu-max", Source: "prometheus", Metric: "cpu_percent", Aggregate: "max"},
+				{Name: "backlog", Source: "prometheus", Metric: "custom", Query: `sum(queue_depth{app="signals-app"})`, Aggregate: "avg", Window: "1h"},
+			},
+		},
+	}
+	usage := TuningUsage{UsedMemoryMB: 120, CPUPercent: 4, Allocations: 1}
+
+	u := EvaluateTuningSignals(context.Background(), prometheus.New(srv.URL), "signals-app", "signals-app", "web", proc, usage)
+	if len(u.Signals) != 4 || len(queries) != 3 {
+		t.Fatalf("signals = %+v, queries = %v", u.Signals, queries)
+	}
+	if got := queries[0]; got != `max(quantile_over_time(0.95, container_memory_working_set_bytes{app="signals-app",process="web"}[1d]))` {
+		t.Fatalf("memory query = %s", got)
+	}
+	if got := queries[1]; got != `max(max_over_time(nomad_client_allocs_cpu_total_percent{job="signals-app",task="web",task_group="web"}[30m]))` {
+		t.Fatalf("cpu query = %s", got)
+	}
+	if s := u.Signals[1]; !s.Available || s.Value != 460 || s.Unit != "MB" {
+		t.Fatalf("memory signal = %+v, want 460 MB", s)
+	}
+	if s := u.Signals[2]; !s.Available || s.Window != "30m" {
+		t.Fatalf("cpu signal = %+v, want the default window", s)
+	}
+	if s := u.Signals[3]; s.Available || s.Reason != "no samples matched over 1h" {
+		t.Fatalf("custom signal = %+v, want no samples", s)
+	}
+
+	rec := BuildTuningRecommendation("signals-app", "web", proc, u)
+	if rec.Confidence != "high" || rec.Observed.Source != "prometheus" || rec.Observed.CPUPercent != 91.5 {
+		t.Fatalf("recommendation = %+v, want windowed prometheus usage", rec)
+	}
+	assertAction(t, rec.Actions, "increase_memory")
+	assertAction(t, rec.Actions, "increase_cpu")
+
+	srv.Close()
+	u = EvaluateTuningSignals(context.Background(), prometheus.New(srv.URL), "signals-app", "signals-app", "web", proc, usage)
+	for _, s := range u.Signals[1:] {
+		if s.Available || !strings.HasPrefix(s.Reason, "prometheus unavailable:") {
+			t.Fatalf("signal with prometheus down = %+v", s)
+		}
+	}
+	u = EvaluateTuningSignals(context.Background(), nil, "signals-app", "signals-app", "web", proc, usage)
+	if s := u.Signals[1]; s.Available || !strings.Contains(s.Reason, "NORN_PROMETHEUS_URL") {
+		t.Fatalf("signal without prometheus = %+v", s)
+	}
+	if rec := BuildTuningRecommendation("signals-app", "web", proc, u); rec.Confidence != "low" {
+		t.Fatalf("confidence = %q, want low without a windowed memory signal", rec.Confidence)
+	}
+}
+
+func assertAction(t *testing.T, actions []string, want string) {
+	t.Helper()
+	for _, action := range actions {
+		if action == want {
+			return
+		}
+	}
+	t.Fatalf("actions = %+v, missing %q", actions, want)
+}
+
+func TestTuningSeparatesProcessTasks(t *testing.T) {
+	usage := AggregateTuningUsage([]nomad.ResourceUsage{{
+		TaskGroup:        "web",
+		MemoryUsageBytes: 600 << 20,
+		CPUPercent:       40,
+		Tasks: map[string]nomad.TaskUsage{
+			"web":     {MemoryUsageBytes: 100 << 20, MemoryMaxBytes: 120 << 20, CPUPercent: 30},
+			"shipper": {MemoryUsageBytes: 500 << 20, MemoryMaxBytes: 510 << 20, CPUPercent: 10},
+		},
+	}})["web"]
+	if usage.UsedMemoryMB != 100 || usage.PeakMemoryMB != 120 || usage.CPUPercent != 30 {
+		t.Fatalf("main task usage = %+v", usage)
+	}
+
+	proc := model.Process{
+		Resources: &model.Resources{Memory: 256},
+		Tasks: []model.ProcessTask{
+			{Name: "shipper", Lifecycle: model.TaskSidecar, Image: "vector", Resources: &model.Resources{Memory: 512}},
+			{Name: "assets", Lifecycle: model.TaskInit, Command: "./fetch"},
+		},
+	}
+	rec := BuildTuningRecommendation("shop", "web", proc, usage)
+	if len(rec.Tasks) != 2 || rec.Tasks[0].PeakMemoryMB != 510 || rec.Tasks[0].Memory != 512 || rec.Tasks[1].CPU != 100 {
+		t.Fatalf("tasks = %+v", rec.Tasks)
+	}
+	if !strings.Contains(strings.Join(rec.Reasons, ";"), "task shipper memory exceeds 80% of its 512MB") {
+		t.Fatalf("reasons = %v", rec.Reasons)
+	}
+	if rec.Observed.MemoryUtilization > 0.5 {
+		t.Fatalf("sidecar memory counted against the process: %+v", rec.Observed)
+	}
+}
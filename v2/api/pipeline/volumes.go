@@ -0,0 +1,208 @@
+package pipeline
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"norn/v2/api/model"
+	"norn/v2/api/nomad"
+	"norn/v2/api/saga"
+)
+
+// volumeSteps inserts the volumes step before submit when the spec declares
+// volumes Norn creates.
+func (p *Pipeline) volumeSteps(spec *model.InfraSpec, steps []step) []step {
+	if len(model.ManagedVolumes(spec)) == 0 {
+		return steps
+	}
+	out := make([]step, 0, len(steps)+1)
+	for _, s := range steps {
+		if s.name == "submit" {
+			out = append(out, step{name: "volumes", fn: p.volumes})
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// volumes creates the app's managed volumes Nomad does not have yet, so the
+// job's volume claims can be placed on its first deploy.
+func (p *Pipeline) volumes(ctx context.Context, st *state, sg *saga.Saga) error {
+	for _, vol := range model.ManagedVolumes(st.spec) {
+		status, created, err := p.Nomad.EnsureVolume(st.spec.JobID(), vol)
+		if err != nil {
+			return fmt.Errorf("volume %s: %w", vol.Name, err)
+		}
+		if !created {
+			continue
+		}
+		_ = sg.Log(ctx, "volume.created", fmt.Sprintf("created %s volume %s", status.Type, status.Source), map[string]string{
+			"volume": vol.Name,
+			"source": status.Source,
+			"type":   status.Type,
+			"plugin": status.Plugin,
+			"size":   vol.Size,
+			"node":   status.NodeID,
+		})
+	}
+	return nil
+}
+
+// snapshotVolumes archives the files of the app's snapshotted host volumes
+// next to the database dump. Volumes on another node, or not created yet,
+// are skipped.
+func (p *Pipeline) snapshotVolumes(ctx context.Context, st *state, sg *saga.Saga) error {
+	if p.Nomad == nil {
+		return nil
+	}
+	sha := st.commitSHA
+	if len(sha) > 12 {
+		sha = sha[:12]
+	}
+	for _, vol := range st.spec.Volumes {
+		if !vol.Snapshotted() {
+			continue
+		}
+		status, err := p.Nomad.LookupVolume(st.spec.JobID(), vol)
+		if err != nil {
+			return fmt.Errorf("volume %s: %w", vol.Name, err)
+		}
+		if status.State == nomad.VolumeMissing {
+			continue
+		}
+		if info, err := os.Stat(status.HostPath); status.HostPath == "" || err != nil || !info.IsDir() {
+			_ = sg.Log(ctx, "snapshot.volume_skipped", fmt.Sprintf("volume %s is not reachable from norn at %q", status.Source, status.HostPath), map[string]string{
+				"volume": vol.Name,
+				"node":   status.NodeID,
+			})
+			continue
+		}
+
+		filename := fmt.Sprintf("snapshots/%s_%s_%s.tar.gz", status.Source, sha, time.Now().Format("20060102T150405"))
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			return fmt.Errorf("create snapshots dir: %w", err)
+		}
+		if err := archiveDir(ctx, status.HostPath, filename); err != nil {
+			_ = os.Remove(filename)
+			return fmt.Errorf("archive volume %s: %w", vol.Name, err)
+		}
+		_ = sg.Log(ctx, "snapshot.volume_created", fmt.Sprintf("volume snapshot created: %s", filename), map[string]string{
+			"volume":    vol.Name,
+			"snapshot":  filename,
+			"commitSha": st.commitSHA,
+		})
+		p.exportSnapshot(ctx, st, sg, filename)
+	}
+	return nil
+}
+
+// archiveDir writes dir's files to filename as a gzipped tarball with paths
+// relative to dir.
+func archiveDir(ctx context.Context, dir, filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// deletePreviewVolumes deletes the managed volumes the app's spec created
+// for the preview's job.
+func (p *Pipeline) deletePreviewVolumes(ctx context.Context, sg *saga.Saga, pr *model.Preview) error {
+	spec, err := p.appSpec(pr.App)
+	if err != nil || spec == nil {
+		return err
+	}
+	volumes, err := p.Nomad.AppVolumes(pr.JobID, spec)
+	if err != nil {
+		return err
+	}
+	for _, status := range volumes {
+		if status.State == nomad.VolumeMissing {
+			continue
+		}
+		if err := p.Nomad.DeleteVolume(status); err != nil {
+			return err
+		}
+		sg.Log(ctx, "preview.volume_deleted", fmt.Sprintf("deleted volume %s", status.Source), nil)
+	}
+	return nil
+}
+
+// appSpec returns the discovered spec of app, or nil when the app no
+// longer deploys.
+func (p *Pipeline) appSpec(app string) (*model.InfraSpec, error) {
+	specs, err := model.DiscoverApps(p.AppsDir)
+	if err != nil {
+		return nil, fmt.Errorf("discover apps: %w", err)
+	}
+	for _, spec := range specs {
+		if spec.App == app {
+			return spec, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,87 @@
+package pipeline
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"norn/v2/api/model"
+)
+
+func TestVolumeStepsRunBeforeSubmitForManagedVolumes(t *testing.T) {
+	p := &Pipeline{}
+	steps := []step{{name: "snapshot"}, {name: "migrate"}, {name: "submit"}, {name: "healthy"}}
+	names := func(steps []step) string {
+		out := make([]string, len(steps))
+		for i, s := range steps {
+			out[i] = s.name
+		}
+		return strings.Join(out, ",")
+	}
+
+	static := &model.InfraSpec{Volumes: []model.VolumeSpec{{Name: "config", Mount: "/etc/app"}}}
+	if got := names(p.volumeSteps(static, steps)); got != "snapshot,migrate,submit,healthy" {
+		t.Fatalf("steps with host volumes = %s", got)
+	}
+	managed := &model.InfraSpec{Volumes: []model.VolumeSpec{{Name: "data", Mount: "/data", Size: "1GiB"}}}
+	if got := names(p.volumeSteps(managed, steps)); got != "snapshot,migrate,volumes,submit,healthy" {
+		t.Fatalf("steps with managed volumes = %s", got)
+	}
+}
+
+func TestArchiveDirKeepsRelativePaths(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "pages", "2026"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pages", "2026", "index.md"), []byte("# wiki"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("pages/2026/index.md", filepath.Join(dir, "home.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "wiki-data.tar.gz")
+	if err := archiveDir(context.Background(), dir, filename); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var entries []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry := hdr.Name
+		if hdr.Linkname != "" {
+			entry += "->" + hdr.Linkname
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			body, _ := io.ReadAll(tr)
+			entry += "=" + string(body)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	if got := strings.Join(entries, ","); got != "home.md->pages/2026/index.md,pages/,pages/2026/,pages/2026/index.md=# wiki" {
+		t.Fatalf("entries = %s", got)
+	}
+}
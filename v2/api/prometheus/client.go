@@ -0,0 +1,257 @@
+// Package prometheus queries a Prometheus-compatible server (Prometheus,
+// VictoriaMetrics, Mimir, Thanos) over the HTTP query API.
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client runs instant queries against one server.
+type Client struct {
+	url  string
+	http *http.Client
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		url:  strings.TrimRight(baseURL, "/"),
+		http: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Sample is one series of an instant vector.
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// UnavailableError means the server could not be reached or could not
+// answer, as opposed to rejecting the query.
+type UnavailableError struct {
+	Err error
+}
+
+func (e *UnavailableError) Error() string {
+	return "prometheus unavailable: " + e.Err.Error()
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
+
+// IsUnavailable reports whether err came from an unreachable server.
+func IsUnavailable(err error) bool {
+	var u *UnavailableError
+	return errors.As(err, &u)
+}
+
+// Query evaluates expr at time at, or now when at is zero. Scalar results
+// are returned as a single sample without labels; NaN values are dropped.
+func (c *Client) Query(ctx context.Context, expr string, at time.Time) ([]Sample, error) {
+	params := url.Values{"query": {expr}}
+	if !at.IsZero() {
+		params.Set("time", strconv.FormatFloat(float64(at.UnixMilli())/1000, 'f', 3, 64))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+"/api/v1/query?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, &UnavailableError{Err: err}
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Status    string `json:"status"`
+		ErrorType string `json:"errorType"`
+		Error     string `json:"error"`
+		Data      struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err := json.Unmarshal(body, &out); err != nil {
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return nil, &UnavailableError{Err: fmt.Errorf("HTTP %d", resp.StatusCode)}
+		}
+		return nil, fmt.Errorf("prometheus query: HTTP %d: %s", resp.StatusCode, truncate(string(body), 256))
+	}
+	if out.Status != "success" {
+		err := fmt.Errorf("%s: %s", out.ErrorType, out.Error)
+		// Bad queries are 400/422; timeouts and overload are server-side.
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || out.ErrorType == "timeout" || out.ErrorType == "unavailable" {
+			return nil, &UnavailableError{Err: err}
+		}
+		return nil, fmt.Errorf("prometheus query %q: %w", expr, err)
+	}
+
+	switch out.Data.ResultType {
+	case "vector":
+		var series []struct {
+			Metric map[string]string `json:"metric"`
+			Value  [2]any            `json:"value"`
+		}
+		if err := json.Unmarshal(out.Data.Result, &series); err != nil {
+			return nil, fmt.Errorf("prometheus query: decode vector: %w", err)
+		}
+		samples := make([]Sample, 0, len(series))
+		for _, s := range series {
+			if v, ok := parseValue(s.Value); ok {
+				samples = append(samples, Sample{Labels: s.Metric, Value: v})
+			}
+		}
+		return samples, nil
+	case "scalar":
+		var value [2]any
+		if err := json.Unmarshal(out.Data.Result, &value); err != nil {
+			return nil, fmt.Errorf("prometheus query: decode scalar: %w", err)
+		}
+		if v, ok := parseValue(value); ok {
+			return []Sample{{Value: v}}, nil
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("prometheus query: unsupported result type %q; use an instant vector or scalar", out.Data.ResultType)
+}
+
+// Value evaluates expr now and returns the largest sample. ok is false
+// when the query matched no series.
+func (c *Client) Value(ctx context.Context, expr string) (float64, bool, error) {
+	samples, err := c.Query(ctx, expr, time.Time{})
+	if err != nil || len(samples) == 0 {
+		return 0, false, err
+	}
+	v := samples[0].Value
+	for _, s := range samples[1:] {
+		v = math.Max(v, s.Value)
+	}
+	return v, true, nil
+}
+
+func parseValue(pair [2]any) (float64, bool) {
+	s, ok := pair[1].(string)
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+func truncate(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) > n {
+		return s[:n] + "..."
+	}
+	return s
+}
+
+// Selector renders a series selector matching labels exactly, e.g.
+// up{job="web"}. Labels are sorted so the query is stable.
+func Selector(metric string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return metric
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+strconv.Quote(labels[k]))
+	}
+	return metric + "{" + strings.Join(parts, ",") + "}"
+}
+
+var selectorRe = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*(\{[^{}]*\})?$`)
+
+// IsSelector reports whether expr is a plain series selector, which can
+// take a range directly rather than through a subquery.
+func IsSelector(expr string) bool {
+	return selectorRe.MatchString(strings.TrimSpace(expr))
+}
+
+// Duration renders d in PromQL duration syntax, e.g. 90s, 30m or 1h30m.
+func Duration(d time.Duration) string {
+	if d <= 0 {
+		return "0s"
+	}
+	var b strings.Builder
+	for _, unit := range []struct {
+		d    time.Duration
+		name string
+	}{{24 * time.Hour, "d"}, {time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}} {
+		if n := d / unit.d; n > 0 {
+			fmt.Fprintf(&b, "%d%s", n, unit.name)
+			d -= n * unit.d
+		}
+	}
+	if b.Len() == 0 {
+		return "1s"
+	}
+	return b.String()
+}
+
+var quantileRe = regexp.MustCompile(`^p([0-9]{1,2})$`)
+
+// ValidAggregate reports whether aggregate is one OverWindow accepts:
+// current, max, avg or a percentile pNN.
+func ValidAggregate(aggregate string) bool {
+	switch aggregate {
+	case "", "current", "max", "avg":
+		return true
+	}
+	m := quantileRe.FindStringSubmatch(aggregate)
+	return m != nil && m[1] != "0" && m[1] != "00"
+}
+
+// OverWindow builds the query for aggregate of expr over window, reduced
+// to one value with max() across series:
+//
+//	current  max(expr)
+//	max      max(max_over_time(expr[window]))
+//	avg      max(avg_over_time(expr[window]))
+//	p95      max(quantile_over_time(0.95, expr[window]))
+//
+// Expressions that are not plain selectors are ranged with a subquery.
+func OverWindow(aggregate, expr string, window time.Duration) (string, error) {
+	if !ValidAggregate(aggregate) {
+		return "", fmt.Errorf("unsupported aggregate %q; use current, max, avg or pNN", aggregate)
+	}
+	expr = strings.TrimSpace(expr)
+	if aggregate == "" || aggregate == "current" {
+		return "max(" + expr + ")", nil
+	}
+	if window <= 0 {
+		return "", fmt.Errorf("aggregate %s needs a window", aggregate)
+	}
+	ranged := expr + "[" + Duration(window) + "]"
+	if !IsSelector(expr) {
+		ranged = "(" + expr + ")[" + Duration(window) + ":]"
+	}
+	switch aggregate {
+	case "max":
+		return "max(max_over_time(" + ranged + "))", nil
+	case "avg":
+		return "max(avg_over_time(" + ranged + "))", nil
+	}
+	n, _ := strconv.Atoi(quantileRe.FindStringSubmatch(aggregate)[1])
+	return fmt.Sprintf("max(quantile_over_time(%s, %s))", strconv.FormatFloat(float64(n)/100, 'f', -1, 64), ranged), nil
+}
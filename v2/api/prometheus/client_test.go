@@ -0,0 +1,90 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQueryVectorScalarAndErrors(t *testing.T) {
+	var lastQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			http.NotFound(w, r)
+			return
+		}
+		lastQuery = r.URL.Query().Get("query")
+		w.Header().Set("Content-Type", "application/json")
+		switch lastQuery {
+		case "up":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"job":"web"},"value":[1760600000,"1"]},
+				{"metric":{"job":"api"},"value":[1760600000,"NaN"]},
+				{"metric":{"job":"db"},"value":[1760600000,"3.5"]}]}}`))
+		case "scalar(1)":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"scalar","result":[1760600000,"1"]}}`))
+		case "slow":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status":"error","errorType":"timeout","error":"query timed out"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+		}
+	}))
+	defer srv.Close()
+	c := New(srv.URL + "/")
+	ctx := context.Background()
+
+	samples, err := c.Query(ctx, "up", time.Time{})
+	if err != nil || len(samples) != 2 || samples[0].Labels["job"] != "web" {
+		t.Fatalf("vector = %+v, %v", samples, err)
+	}
+	if v, ok, err := c.Value(ctx, "up"); err != nil || !ok || v != 3.5 {
+		t.Fatalf("Value(up) = %v, %v, %v", v, ok, err)
+	}
+	if v, ok, err := c.Value(ctx, "scalar(1)"); err != nil || !ok || v != 1 {
+		t.Fatalf("Value(scalar(1)) = %v, %v, %v", v, ok, err)
+	}
+
+	if _, err := c.Query(ctx, "up{", time.Time{}); err == nil || IsUnavailable(err) {
+		t.Fatalf("a bad query should fail without being unavailable: %v", err)
+	}
+	if _, err := c.Query(ctx, "slow", time.Time{}); !IsUnavailable(err) {
+		t.Fatalf("a server timeout should be unavailable: %v", err)
+	}
+
+	srv.Close()
+	if _, _, err := c.Value(ctx, "up"); !IsUnavailable(err) {
+		t.Fatalf("an unreachable server should be unavailable: %v", err)
+	}
+}
+
+func TestOverWindow(t *testing.T) {
+	sel := Selector("nomad_client_allocs_memory_rss", map[string]string{"task": "web", "job": "app"})
+	if sel != `nomad_client_allocs_memory_rss{job="app",task="web"}` {
+		t.Fatalf("Selector = %s", sel)
+	}
+	for _, tc := range []struct {
+		aggregate, expr string
+		window          time.Duration
+		want            string
+	}{
+		{"current", sel, time.Hour, "max(" + sel + ")"},
+		{"max", sel, 30 * time.Minute, "max(max_over_time(" + sel + "[30m]))"},
+		{"p95", sel, 26 * time.Hour, "max(quantile_over_time(0.95, " + sel + "[1d2h]))"},
+		{"avg", "sum(rate(jobs_total[5m]))", 90 * time.Second, "max(avg_over_time((sum(rate(jobs_total[5m])))[1m30s:]))"},
+	} {
+		got, err := OverWindow(tc.aggregate, tc.expr, tc.window)
+		if err != nil || got != tc.want {
+			t.Errorf("OverWindow(%s, %s, %s) = %s, %v; want %s", tc.aggregate, tc.expr, tc.window, got, err, tc.want)
+		}
+	}
+	if _, err := OverWindow("p100", sel, time.Hour); err == nil {
+		t.Error("p100 should be rejected")
+	}
+	if _, err := OverWindow("max", sel, 0); err == nil {
+		t.Error("a windowed aggregate without a window should be rejected")
+	}
+}
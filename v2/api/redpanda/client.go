@@ -6,6 +6,7 @@ import (
 	"os/exec"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,12 +17,20 @@ type Config struct {
 	Brokers []string
 	RPKPath string
 	Timeout time.Duration
+	// AdminHosts, User and Password are passed to rpk for user and ACL
+	// management when set.
+	AdminHosts []string
+	User       string
+	Password   string
 }
 
 type Client struct {
-	brokers []string
-	rpkPath string
-	timeout time.Duration
+	brokers    []string
+	rpkPath    string
+	timeout    time.Duration
+	adminHosts []string
+	user       string
+	password   string
 }
 
 type ProvisionResult struct {
@@ -50,7 +59,14 @@ func NewClient(cfg Config) (*Client, error) {
 	if timeout == 0 {
 		timeout = 10 * time.Second
 	}
-	return &Client{brokers: brokers, rpkPath: rpkPath, timeout: timeout}, nil
+	return &Client{
+		brokers:    brokers,
+		rpkPath:    rpkPath,
+		timeout:    timeout,
+		adminHosts: normalizeBrokers(cfg.AdminHosts),
+		user:       cfg.User,
+		password:   cfg.Password,
+	}, nil
 }
 
 func (c *Client) Healthy(ctx context.Context) error {
@@ -89,6 +105,52 @@ func (c *Client) ProvisionAppKafka(ctx context.Context, _ string, spec *model.Ka
 	return result, nil
 }
 
+// ConsumerLag returns how many messages of topic the consumer group has
+// yet to read, summed over the topic's partitions.
+func (c *Client) ConsumerLag(ctx context.Context, group, topic string) (int64, error) {
+	out, err := c.runRPK(ctx, "group", "describe", group)
+	if err != nil {
+		return 0, err
+	}
+	return parseGroupLag(out, topic)
+}
+
+// parseGroupLag sums the LAG column of `rpk group describe` for topic's
+// partitions. Partitions without a committed offset show "-" and are skipped.
+func parseGroupLag(out, topic string) (int64, error) {
+	lagCol := -1
+	var total int64
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "TOPIC" {
+			for i, f := range fields {
+				if f == "LAG" {
+					lagCol = i
+				}
+			}
+			continue
+		}
+		if lagCol < 0 || fields[0] != topic || len(fields) <= lagCol {
+			continue
+		}
+		if fields[lagCol] == "-" {
+			continue
+		}
+		lag, err := strconv.ParseInt(fields[lagCol], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parse lag %q for %s: %w", fields[lagCol], topic, err)
+		}
+		total += lag
+	}
+	if lagCol < 0 {
+		return 0, fmt.Errorf("rpk group describe: no partition table in output")
+	}
+	return total, nil
+}
+
 func (c *Client) Brokers() []string {
 	if c == nil {
 		return nil
@@ -127,17 +189,24 @@ func (c *Client) runRPK(ctx context.Context, args ...string) (string, error) {
 
 	rpkArgs := append([]string{}, args...)
 	rpkArgs = append(rpkArgs, "-X", "brokers="+strings.Join(c.brokers, ","))
+	if len(c.adminHosts) > 0 {
+		rpkArgs = append(rpkArgs, "-X", "admin.hosts="+strings.Join(c.adminHosts, ","))
+	}
+	if c.user != "" {
+		rpkArgs = append(rpkArgs, "-X", "user="+c.user, "-X", "pass="+c.password, "-X", "sasl.mechanism="+SASLMechanism)
+	}
 	cmd := exec.CommandContext(timeoutCtx, c.rpkPath, rpkArgs...)
 	out, err := cmd.CombinedOutput()
+	command := strings.Join(redactArgs(args), " ")
 	if timeoutCtx.Err() == context.DeadlineExceeded {
-		return string(out), fmt.Errorf("rpk %s timed out after %s", strings.Join(args, " "), c.timeout)
+		return string(out), fmt.Errorf("rpk %s timed out after %s", command, c.timeout)
 	}
 	if err != nil {
 		trimmed := strings.TrimSpace(string(out))
 		if trimmed == "" {
-			return string(out), fmt.Errorf("rpk %s: %w", strings.Join(args, " "), err)
+			return string(out), fmt.Errorf("rpk %s: %w", command, err)
 		}
-		return string(out), fmt.Errorf("rpk %s: %w: %s", strings.Join(args, " "), err, trimmed)
+		return string(out), fmt.Errorf("rpk %s: %w: %s", command, err, trimmed)
 	}
 	return string(out), nil
 }
@@ -67,6 +67,45 @@ func TestValidateTopicName(t *testing.T) {
 	}
 }
 
+func TestConsumerLagSumsTopicPartitions(t *testing.T) {
+	dir := t.TempDir()
+	rpkPath := filepath.Join(dir, "rpk")
+	script := `#!/bin/sh
+cat <<'OUT'
+GROUP        mailer
+COORDINATOR  0
+STATE        Stable
+BALANCER     range
+MEMBERS      2
+TOTAL-LAG    1450
+
+TOPIC        PARTITION  CURRENT-OFFSET  LOG-START-OFFSET  LOG-END-OFFSET  LAG   MEMBER-ID  CLIENT-ID  HOST
+mail.events  0          100             0                 1300            1200  m-1        mailer     10.0.0.4
+mail.events  1          -               0                 40              -
+mail.events  2          80              0                 280             200   m-2        mailer     10.0.0.5
+audit        0          5               0                 55              50    m-1        mailer     10.0.0.4
+OUT
+`
+	if err := os.WriteFile(rpkPath, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake rpk: %v", err)
+	}
+	client, err := NewClient(Config{Brokers: []string{"127.0.0.1:9092"}, RPKPath: rpkPath, Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+
+	lag, err := client.ConsumerLag(context.Background(), "mailer", "mail.events")
+	if err != nil {
+		t.Fatalf("consumer lag: %v", err)
+	}
+	if lag != 1400 {
+		t.Fatalf("lag = %d, want 1400", lag)
+	}
+	if _, err := parseGroupLag("GROUP mailer\nSTATE Dead\n", "mail.events"); err == nil {
+		t.Fatal("expected an error for output without a partition table")
+	}
+}
+
 func shellQuote(value string) string {
 	return "'" + strings.ReplaceAll(value, "'", "'\\''") + "'"
 }
@@ -77,3 +116,45 @@ func assertEnv(t *testing.T, env map[string]string, key, want string) {
 		t.Fatalf("%s = %q, want %q", key, got, want)
 	}
 }
+
+func TestUpsertUserUpdatesExistingUserAndRedactsPassword(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "rpk.log")
+	rpkPath := filepath.Join(dir, "rpk")
+	script := "#!/bin/sh\necho \"$*\" >> " + shellQuote(logPath) + "\n" +
+		"case \"$3\" in create) echo 'user already exists'; exit 1;; esac\n"
+	if err := os.WriteFile(rpkPath, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake rpk: %v", err)
+	}
+	client, err := NewClient(Config{
+		Brokers:    []string{"127.0.0.1:9092"},
+		RPKPath:    rpkPath,
+		Timeout:    time.Second,
+		AdminHosts: []string{"127.0.0.1:9644"},
+		User:       "admin",
+		Password:   "root",
+	})
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+
+	if err := client.UpsertUser(context.Background(), "mail-r1", "s3cret"); err != nil {
+		t.Fatalf("upsert user: %v", err)
+	}
+	raw, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("read fake rpk log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "security user update mail-r1 --new-password s3cret --mechanism SCRAM-SHA-256") {
+		t.Fatalf("rpk calls:\n%s", raw)
+	}
+	if !strings.Contains(lines[1], "-X admin.hosts=127.0.0.1:9644 -X user=admin -X pass=root -X sasl.mechanism=SCRAM-SHA-256") {
+		t.Fatalf("rpk admin flags missing: %s", lines[1])
+	}
+
+	_, err = client.runRPK(context.Background(), "security", "user", "create", "x", "--password", "hunter2")
+	if err == nil || strings.Contains(err.Error(), "hunter2") {
+		t.Fatalf("error should redact the password: %v", err)
+	}
+}
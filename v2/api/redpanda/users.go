@@ -0,0 +1,72 @@
+package redpanda
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// SASLMechanism is the SCRAM mechanism app users are created with.
+const SASLMechanism = "SCRAM-SHA-256"
+
+// UpsertUser creates a SASL/SCRAM user, or sets the password of an
+// existing one, so issuing credentials can be retried.
+func (c *Client) UpsertUser(ctx context.Context, name, password string) error {
+	_, err := c.runRPK(ctx, "security", "user", "create", name, "--password", password, "--mechanism", SASLMechanism)
+	if err == nil {
+		return nil
+	}
+	if !strings.Contains(strings.ToLower(err.Error()), "already exists") {
+		return err
+	}
+	_, err = c.runRPK(ctx, "security", "user", "update", name, "--new-password", password, "--mechanism", SASLMechanism)
+	return err
+}
+
+// GrantApp lets user do everything on the app's topics and on consumer
+// groups prefixed with the app name.
+func (c *Client) GrantApp(ctx context.Context, user, appID string, topics []string) error {
+	principal := "User:" + user
+	topics = normalizeTopics(topics)
+	if len(topics) > 0 {
+		args := []string{"security", "acl", "create", "--allow-principal", principal, "--operation", "all"}
+		for _, topic := range topics {
+			args = append(args, "--topic", topic)
+		}
+		if _, err := c.runRPK(ctx, args...); err != nil {
+			return err
+		}
+	}
+	_, err := c.runRPK(ctx, "security", "acl", "create", "--allow-principal", principal, "--operation", "all",
+		"--group", appID, "--resource-pattern-type", "prefixed")
+	return err
+}
+
+// DeleteUser removes a user's ACLs and then the user. Users that are
+// already gone are not an error. The superuser rpk runs as is left alone,
+// since apps that shared it do not own it.
+func (c *Client) DeleteUser(ctx context.Context, name string) error {
+	if c != nil && name == c.user {
+		return nil
+	}
+	if _, err := c.runRPK(ctx, "security", "acl", "delete", "--allow-principal", "User:"+name, "--no-confirm"); err != nil {
+		return fmt.Errorf("delete ACLs of %s: %w", name, err)
+	}
+	_, err := c.runRPK(ctx, "security", "user", "delete", name)
+	if err != nil && !strings.Contains(strings.ToLower(err.Error()), "not found") && !strings.Contains(strings.ToLower(err.Error()), "does not exist") {
+		return err
+	}
+	return nil
+}
+
+// redactArgs hides password flag values from rpk command lines in errors.
+func redactArgs(args []string) []string {
+	out := append([]string(nil), args...)
+	for i := 0; i < len(out)-1; i++ {
+		switch out[i] {
+		case "-p", "--password", "--new-password":
+			out[i+1] = "<redacted>"
+		}
+	}
+	return out
+}
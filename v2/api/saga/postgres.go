@@ -3,6 +3,8 @@ package saga
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -21,16 +23,16 @@ func (s *PostgresStore) Append(ctx context.Context, evt *Event) error {
 		meta = []byte("{}")
 	}
 	_, err := s.pool.Exec(ctx,
-		`INSERT INTO saga_events (id, saga_id, timestamp, source, app, category, action, message, metadata)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
-		evt.ID, evt.SagaID, evt.Timestamp, evt.Source, evt.App, evt.Category, evt.Action, evt.Message, meta,
+		`INSERT INTO saga_events (id, saga_id, timestamp, source, app, category, action, message, actor, metadata)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		evt.ID, evt.SagaID, evt.Timestamp, evt.Source, evt.App, evt.Category, evt.Action, evt.Message, evt.Actor, meta,
 	)
 	return err
 }
 
 func (s *PostgresStore) ListBySaga(ctx context.Context, sagaID string) ([]Event, error) {
 	rows, err := s.pool.Query(ctx,
-		`SELECT id, saga_id, timestamp, source, app, category, action, message, metadata
+		`SELECT id, saga_id, timestamp, source, app, category, action, message, actor, metadata
 		 FROM saga_events WHERE saga_id = $1 ORDER BY timestamp ASC`, sagaID)
 	if err != nil {
 		return nil, err
@@ -44,7 +46,7 @@ func (s *PostgresStore) ListByApp(ctx context.Context, app string, limit int) ([
 		limit = 50
 	}
 	rows, err := s.pool.Query(ctx,
-		`SELECT id, saga_id, timestamp, source, app, category, action, message, metadata
+		`SELECT id, saga_id, timestamp, source, app, category, action, message, actor, metadata
 		 FROM saga_events WHERE app = $1 ORDER BY timestamp DESC LIMIT $2`, app, limit)
 	if err != nil {
 		return nil, err
@@ -58,7 +60,7 @@ func (s *PostgresStore) ListRecent(ctx context.Context, limit int) ([]Event, err
 		limit = 50
 	}
 	rows, err := s.pool.Query(ctx,
-		`SELECT id, saga_id, timestamp, source, app, category, action, message, metadata
+		`SELECT id, saga_id, timestamp, source, app, category, action, message, actor, metadata
 		 FROM saga_events ORDER BY timestamp DESC LIMIT $1`, limit)
 	if err != nil {
 		return nil, err
@@ -67,6 +69,31 @@ func (s *PostgresStore) ListRecent(ctx context.Context, limit int) ([]Event, err
 	return scanEvents(rows)
 }
 
+// ListAfter returns up to limit of the newest events after the position
+// (after, afterID), ordered by timestamp then ID, optionally only for some
+// apps or sagas. The event stream replays from it.
+func (s *PostgresStore) ListAfter(ctx context.Context, after time.Time, afterID string, apps, sagas []string, limit int) ([]Event, error) {
+	where := "(timestamp, id) > ($1, $2)"
+	args := []interface{}{after, afterID}
+	if len(apps) > 0 {
+		args = append(args, apps)
+		where += fmt.Sprintf(" AND app = ANY($%d)", len(args))
+	}
+	if len(sagas) > 0 {
+		args = append(args, sagas)
+		where += fmt.Sprintf(" AND saga_id = ANY($%d)", len(args))
+	}
+	args = append(args, limit)
+	rows, err := s.pool.Query(ctx, fmt.Sprintf(
+		`SELECT id, saga_id, timestamp, source, app, category, action, message, actor, metadata
+		 FROM saga_events WHERE %s ORDER BY timestamp DESC, id DESC LIMIT $%d`, where, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanEvents(rows)
+}
+
 type scannable interface {
 	Next() bool
 	Scan(dest ...interface{}) error
@@ -77,7 +104,7 @@ func scanEvents(rows scannable) ([]Event, error) {
 	for rows.Next() {
 		var evt Event
 		var meta []byte
-		if err := rows.Scan(&evt.ID, &evt.SagaID, &evt.Timestamp, &evt.Source, &evt.App, &evt.Category, &evt.Action, &evt.Message, &meta); err != nil {
+		if err := rows.Scan(&evt.ID, &evt.SagaID, &evt.Timestamp, &evt.Source, &evt.App, &evt.Category, &evt.Action, &evt.Message, &evt.Actor, &meta); err != nil {
 			return nil, err
 		}
 		if len(meta) > 0 {
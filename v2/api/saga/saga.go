@@ -17,6 +17,7 @@ type Event struct {
 	Category  string            `json:"category"` // deploy, restart, scale, system
 	Action    string            `json:"action"`   // step.start, step.complete, step.failed, etc.
 	Message   string            `json:"message"`
+	Actor     string            `json:"actor,omitempty"`
 	Metadata  map[string]string `json:"metadata,omitempty"`
 }
 
@@ -27,6 +28,22 @@ type Store interface {
 	ListRecent(ctx context.Context, limit int) ([]Event, error)
 }
 
+type actorKey struct{}
+
+// WithActor attaches the user responsible for work done under ctx, so saga
+// events logged with it record who triggered them.
+func WithActor(ctx context.Context, actor string) context.Context {
+	if actor == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func ActorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
 // Saga is a helper for logging structured events in a deployment or operation.
 type Saga struct {
 	ID       string
@@ -69,6 +86,7 @@ func (s *Saga) Log(ctx context.Context, action, message string, metadata map[str
 		Category:  s.Category,
 		Action:    action,
 		Message:   message,
+		Actor:     ActorFrom(ctx),
 		Metadata:  metadata,
 	}
 	return s.store.Append(ctx, evt)
@@ -96,3 +114,22 @@ func formatInt64(n int64) string {
 	b, _ := json.Marshal(n)
 	return string(b)
 }
+
+type publishingStore struct {
+	Store
+	publish func(Event)
+}
+
+// Publishing wraps store so every event it records is also passed to
+// publish, letting live subscribers follow saga progress.
+func Publishing(store Store, publish func(Event)) Store {
+	return &publishingStore{Store: store, publish: publish}
+}
+
+func (s *publishingStore) Append(ctx context.Context, evt *Event) error {
+	if err := s.Store.Append(ctx, evt); err != nil {
+		return err
+	}
+	s.publish(*evt)
+	return nil
+}
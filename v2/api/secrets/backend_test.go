@@ -0,0 +1,212 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"norn/v2/api/model"
+)
+
+type fakeVariables map[string]map[string]string
+
+func (f fakeVariables) ReadVariable(path string) (map[string]string, error) {
+	items, ok := f[path]
+	if !ok {
+		return nil, nil
+	}
+	return copyMap(items), nil
+}
+
+func (f fakeVariables) WriteVariable(path string, items map[string]string) error {
+	if len(items) == 0 {
+		delete(f, path)
+		return nil
+	}
+	f[path] = copyMap(items)
+	return nil
+}
+
+func TestManagerForNomadVariables(t *testing.T) {
+	vars := fakeVariables{}
+	m := NewManager(t.TempDir())
+	m.UseNomad(vars)
+	spec := &model.InfraSpec{App: "web", SecretsBackend: &model.SecretsBackend{Type: model.SecretsBackendNomad}}
+
+	web := m.For(spec)
+	if !web.Templated() || web.Location("web") != "nomad var nomad/jobs/web" {
+		t.Fatalf("backend = %s at %s", web.Kind(), web.Location("web"))
+	}
+	if _, err := web.Get("web"); !os.IsNotExist(err) {
+		t.Fatalf("missing variable: err = %v", err)
+	}
+	if err := web.Set("web", map[string]string{"TOKEN": "t"}); err != nil {
+		t.Fatal(err)
+	}
+	if vars["nomad/jobs/web"]["TOKEN"] != "t" {
+		t.Fatalf("variables = %v", vars)
+	}
+	if env, err := web.JobEnv("web"); err != nil || env != nil {
+		t.Fatalf("templated backends must keep secrets out of the job env: %v, %v", env, err)
+	}
+	if err := web.Delete("web", "TOKEN"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := vars["nomad/jobs/web"]; ok {
+		t.Fatal("deleting the last key should remove the variable")
+	}
+}
+
+func TestVaultReadWrite(t *testing.T) {
+	stored := map[string]any{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" || r.Header.Get("X-Vault-Namespace") != "team" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/kv/data/web/staging" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodPost:
+			var body struct {
+				Data map[string]any `json:"data"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			stored = body.Data
+			w.Write([]byte(`{"data":{"version":1}}`))
+		case http.MethodGet:
+			if len(stored) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			stored["PORT"] = 8080
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"data": stored}})
+		}
+	}))
+	defer srv.Close()
+
+	m := NewManager(t.TempDir())
+	m.UseVault(NewVault(srv.URL+"/", "root", "team"))
+	base := &model.InfraSpec{
+		App:            "web",
+		SecretsBackend: &model.SecretsBackend{Type: model.SecretsBackendVault, Mount: "kv"},
+		Environments:   map[string]model.EnvironmentSpec{"staging": {}},
+	}
+	spec, err := base.ForEnvironment("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	staging := m.For(spec)
+	if staging.Location("web") != "vault kv/web/staging" {
+		t.Fatalf("location = %s", staging.Location("web"))
+	}
+	if _, err := staging.Get("web"); !os.IsNotExist(err) {
+		t.Fatalf("missing secret: err = %v", err)
+	}
+	if err := staging.Set("web", map[string]string{"TOKEN": "t"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := staging.Get("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["TOKEN"] != "t" || got["PORT"] != "8080" {
+		t.Fatalf("Get = %v", got)
+	}
+
+	if _, err := m.At(Target{Kind: model.SecretsBackendVault, Path: "other"}).Get("web"); !os.IsNotExist(err) {
+		t.Fatalf("other path: err = %v", err)
+	}
+	unconfigured := NewManager(t.TempDir()).For(spec)
+	if _, err := unconfigured.Get("web"); err == nil || !strings.Contains(err.Error(), "NORN_VAULT_ADDR") {
+		t.Fatalf("unconfigured vault: err = %v", err)
+	}
+}
+
+func TestManagerCopy(t *testing.T) {
+	vars := fakeVariables{
+		"src": {"A": "1", "B": "2", "C": "3"},
+		"dst": {"B": "2", "C": "old"},
+	}
+	m := NewManager(t.TempDir())
+	m.UseNomad(vars)
+	src := m.At(Target{Kind: model.SecretsBackendNomad, Path: "src"})
+	dst := m.At(Target{Kind: model.SecretsBackendNomad, Path: "dst"})
+
+	result, err := dst.Copy("web", src, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(result.Copied, ",") != "A" || strings.Join(result.Unchanged, ",") != "B" || strings.Join(result.Conflicts, ",") != "C" {
+		t.Fatalf("dry run = %+v", result)
+	}
+	if _, ok := vars["dst"]["A"]; ok {
+		t.Fatal("dry run wrote to the destination")
+	}
+
+	if _, err := dst.Copy("web", src, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if vars["dst"]["A"] != "1" || vars["dst"]["C"] != "old" {
+		t.Fatalf("copy without overwrite = %v", vars["dst"])
+	}
+	result, err = dst.Copy("web", src, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(result.Overwritten, ",") != "C" || vars["dst"]["C"] != "3" {
+		t.Fatalf("overwrite = %+v, %v", result, vars["dst"])
+	}
+
+	if _, err := dst.Copy("web", dst, false, false); err == nil {
+		t.Fatal("copying a backend onto itself should fail")
+	}
+	empty := m.At(Target{Kind: model.SecretsBackendNomad, Path: "none"})
+	if _, err := dst.Copy("web", empty, false, false); !os.IsNotExist(err) {
+		t.Fatalf("missing source: err = %v", err)
+	}
+}
+
+func TestSealOpenAndDiffKeys(t *testing.T) {
+	t.Setenv("SOPS_AGE_KEY", "")
+	t.Setenv("SOPS_AGE_KEY_FILE", filepath.Join(t.TempDir(), "missing.txt"))
+	if _, err := Seal(map[string]string{"A": "1"}); !errors.Is(err, ErrNoSealKey) {
+		t.Fatalf("without a key: err = %v", err)
+	}
+
+	id := newTestIdentity(t)
+	t.Setenv("SOPS_AGE_KEY", id.String())
+	before := map[string]string{"A": "1", "B": "2", "C": "3"}
+	snapshot, err := Seal(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(snapshot), ": \"2\"") || strings.Contains(string(snapshot), "B: 2") {
+		t.Fatalf("snapshot holds plaintext:\n%s", snapshot)
+	}
+	opened, err := Open(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opened) != 3 || opened["B"] != "2" {
+		t.Fatalf("Open = %v", opened)
+	}
+	if empty, err := Seal(map[string]string{}); err != nil {
+		t.Fatal(err)
+	} else if got, err := Open(empty); err != nil || len(got) != 0 {
+		t.Fatalf("empty snapshot = %v, %v", got, err)
+	}
+
+	added, changed, removed := DiffKeys(before, map[string]string{"A": "1", "B": "two", "D": "4"})
+	if strings.Join(added, ",") != "D" || strings.Join(changed, ",") != "B" || strings.Join(removed, ",") != "C" {
+		t.Fatalf("DiffKeys = %v %v %v", added, changed, removed)
+	}
+}
@@ -0,0 +1,390 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+// The encrypted file format is the one the sops CLI reads and writes: each
+// value is sealed with AES-256-GCM under a random data key, bound to its key
+// path, and the data key is age-encrypted to every recipient in the trailing
+// sops metadata block. A MAC over all values detects edits made without the
+// data key.
+const (
+	sopsVersion              = "3.9.0"
+	defaultUnencryptedSuffix = "_unencrypted"
+	dataKeySize              = 32
+	valueNonceSize           = 32
+)
+
+var encryptedValue = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.+),iv:(.+),tag:(.+),type:(.+)\]$`)
+
+type sopsMetadata struct {
+	Age               []ageStanza `yaml:"age,omitempty"`
+	KeyGroups         []yaml.Node `yaml:"key_groups,omitempty"`
+	LastModified      string      `yaml:"lastmodified"`
+	MAC               string      `yaml:"mac"`
+	UnencryptedSuffix string      `yaml:"unencrypted_suffix,omitempty"`
+	EncryptedSuffix   string      `yaml:"encrypted_suffix,omitempty"`
+	UnencryptedRegex  string      `yaml:"unencrypted_regex,omitempty"`
+	EncryptedRegex    string      `yaml:"encrypted_regex,omitempty"`
+	MACOnlyEncrypted  bool        `yaml:"mac_only_encrypted,omitempty"`
+	Version           string      `yaml:"version"`
+}
+
+type ageStanza struct {
+	Recipient string `yaml:"recipient"`
+	Enc       string `yaml:"enc"`
+}
+
+// encrypts reports whether the value under key is sealed, following the
+// file's suffix or regex selector.
+func (md *sopsMetadata) encrypts(key string) (bool, error) {
+	switch {
+	case md.EncryptedSuffix != "":
+		return strings.HasSuffix(key, md.EncryptedSuffix), nil
+	case md.UnencryptedRegex != "":
+		re, err := regexp.Compile(md.UnencryptedRegex)
+		if err != nil {
+			return false, fmt.Errorf("unencrypted_regex: %w", err)
+		}
+		return !re.MatchString(key), nil
+	case md.EncryptedRegex != "":
+		re, err := regexp.Compile(md.EncryptedRegex)
+		if err != nil {
+			return false, fmt.Errorf("encrypted_regex: %w", err)
+		}
+		return re.MatchString(key), nil
+	case md.UnencryptedSuffix != "":
+		return !strings.HasSuffix(key, md.UnencryptedSuffix), nil
+	}
+	return true, nil
+}
+
+// recipients returns the age recipients the file is encrypted to.
+func (md *sopsMetadata) recipients() []string {
+	out := make([]string, 0, len(md.Age))
+	for _, stanza := range md.Age {
+		out = append(out, stanza.Recipient)
+	}
+	return out
+}
+
+// splitDocument parses a SOPS YAML file into its value nodes, in file order,
+// and its metadata.
+func splitDocument(raw []byte) ([][2]*yaml.Node, *sopsMetadata, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, nil, fmt.Errorf("parse: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, errors.New("not a SOPS file: expected a YAML mapping")
+	}
+	root := doc.Content[0]
+	var pairs [][2]*yaml.Node
+	var md *sopsMetadata
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if key.Value == "sops" {
+			md = &sopsMetadata{}
+			if err := value.Decode(md); err != nil {
+				return nil, nil, fmt.Errorf("parse sops metadata: %w", err)
+			}
+			continue
+		}
+		pairs = append(pairs, [2]*yaml.Node{key, value})
+	}
+	if md == nil {
+		return nil, nil, errors.New("not a SOPS file: no sops metadata")
+	}
+	return pairs, md, nil
+}
+
+// fileRecipients returns the age recipients of an encrypted file without
+// decrypting it.
+func fileRecipients(raw []byte) ([]string, error) {
+	_, md, err := splitDocument(raw)
+	if err != nil {
+		return nil, err
+	}
+	return md.recipients(), nil
+}
+
+// decryptDocument opens a SOPS YAML file with the first identity that
+// matches one of its age recipients, and verifies its MAC.
+func decryptDocument(raw []byte, identities []age.Identity) (map[string]string, error) {
+	pairs, md, err := splitDocument(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(md.KeyGroups) > 0 {
+		return nil, errors.New("sops key_groups are not supported; encrypt to age recipients directly")
+	}
+	dataKey, err := openDataKey(md, identities)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha512.New()
+	data := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value := pair[0].Value, pair[1]
+		if value.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("secret %s: nested values are not supported", key)
+		}
+		encrypted, err := md.encrypts(key)
+		if err != nil {
+			return nil, err
+		}
+		if !encrypted {
+			if !md.MACOnlyEncrypted {
+				hash.Write(plainBytes(value))
+			}
+			data[key] = value.Value
+			continue
+		}
+		plain, typ, err := openValue(value.Value, dataKey, key+":")
+		if err != nil {
+			return nil, fmt.Errorf("secret %s: %w", key, err)
+		}
+		hash.Write(plain)
+		data[key] = typedString(plain, typ)
+	}
+
+	lastModified, err := time.Parse(time.RFC3339, md.LastModified)
+	if err != nil {
+		return nil, fmt.Errorf("sops lastmodified: %w", err)
+	}
+	mac, _, err := openValue(md.MAC, dataKey, lastModified.Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("sops mac: %w", err)
+	}
+	if !strings.EqualFold(string(mac), fmt.Sprintf("%X", hash.Sum(nil))) {
+		return nil, errors.New("MAC mismatch: file was modified without the data key")
+	}
+	return data, nil
+}
+
+// encryptDocument seals data under a fresh data key for recipients. Keys
+// are written in sorted order; keys ending in _unencrypted stay plaintext,
+// as with sops defaults.
+func encryptDocument(data map[string]string, recipients []string, now time.Time) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no age recipients")
+	}
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	md := &sopsMetadata{UnencryptedSuffix: defaultUnencryptedSuffix, Version: sopsVersion}
+	for _, r := range recipients {
+		stanza, err := sealDataKey(dataKey, r)
+		if err != nil {
+			return nil, err
+		}
+		md.Age = append(md.Age, stanza)
+	}
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	hash := sha512.New()
+	for _, key := range keys {
+		value := data[key]
+		hash.Write([]byte(value))
+		if !strings.HasSuffix(key, defaultUnencryptedSuffix) {
+			sealed, err := sealValue([]byte(value), dataKey, key+":", "str")
+			if err != nil {
+				return nil, err
+			}
+			value = sealed
+		}
+		root.Content = append(root.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+	}
+
+	md.LastModified = now.UTC().Format(time.RFC3339)
+	mac, err := sealValue([]byte(fmt.Sprintf("%X", hash.Sum(nil))), dataKey, md.LastModified, "str")
+	if err != nil {
+		return nil, err
+	}
+	md.MAC = mac
+
+	var mdNode yaml.Node
+	if err := mdNode.Encode(md); err != nil {
+		return nil, err
+	}
+	root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "sops"}, &mdNode)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(4)
+	if err := enc.Encode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}}); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func openDataKey(md *sopsMetadata, identities []age.Identity) ([]byte, error) {
+	if len(md.Age) == 0 {
+		return nil, errors.New("no age recipients in sops metadata; only age keys are supported")
+	}
+	if len(identities) == 0 {
+		return nil, errors.New("no age identity loaded")
+	}
+	for _, stanza := range md.Age {
+		r, err := age.Decrypt(armor.NewReader(strings.NewReader(stanza.Enc)), identities...)
+		if err != nil {
+			continue
+		}
+		key, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("read data key: %w", err)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("no loaded age identity matches recipients %s", strings.Join(md.recipients(), ", "))
+}
+
+func sealDataKey(dataKey []byte, recipient string) (ageStanza, error) {
+	parsed, err := parseRecipient(recipient)
+	if err != nil {
+		return ageStanza{}, err
+	}
+	var buf bytes.Buffer
+	aw := armor.NewWriter(&buf)
+	w, err := age.Encrypt(aw, parsed)
+	if err != nil {
+		return ageStanza{}, fmt.Errorf("encrypt data key to %s: %w", recipient, err)
+	}
+	if _, err := w.Write(dataKey); err != nil {
+		return ageStanza{}, err
+	}
+	if err := w.Close(); err != nil {
+		return ageStanza{}, err
+	}
+	if err := aw.Close(); err != nil {
+		return ageStanza{}, err
+	}
+	return ageStanza{Recipient: recipient, Enc: buf.String()}, nil
+}
+
+// sealValue encrypts one value in the sops ENC[...] notation. Empty values
+// are stored as-is.
+func sealValue(plain, key []byte, aad, typ string) (string, error) {
+	if len(plain) == 0 {
+		return "", nil
+	}
+	gcm, err := newValueCipher(key)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, valueNonceSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	out := gcm.Seal(nil, iv, plain, []byte(aad))
+	tagAt := len(out) - gcm.Overhead()
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:%s]",
+		base64.StdEncoding.EncodeToString(out[:tagAt]),
+		base64.StdEncoding.EncodeToString(iv),
+		base64.StdEncoding.EncodeToString(out[tagAt:]),
+		typ), nil
+}
+
+// openValue decrypts one ENC[...] value, returning its plaintext and sops
+// type.
+func openValue(value string, key []byte, aad string) ([]byte, string, error) {
+	if value == "" {
+		return nil, "str", nil
+	}
+	m := encryptedValue.FindStringSubmatch(value)
+	if m == nil {
+		return nil, "", errors.New("value is not in ENC[AES256_GCM,...] form")
+	}
+	data, err := base64.StdEncoding.DecodeString(m[1])
+	if err != nil {
+		return nil, "", fmt.Errorf("decode data: %w", err)
+	}
+	iv, err := base64.StdEncoding.DecodeString(m[2])
+	if err != nil {
+		return nil, "", fmt.Errorf("decode iv: %w", err)
+	}
+	tag, err := base64.StdEncoding.DecodeString(m[3])
+	if err != nil {
+		return nil, "", fmt.Errorf("decode tag: %w", err)
+	}
+	if len(iv) == 0 {
+		return nil, "", errors.New("empty iv")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, "", err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return nil, "", err
+	}
+	plain, err := gcm.Open(nil, iv, append(data, tag...), []byte(aad))
+	if err != nil {
+		return nil, "", errors.New("decryption failed: wrong data key or tampered value")
+	}
+	return plain, m[4], nil
+}
+
+func newValueCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCMWithNonceSize(block, valueNonceSize)
+}
+
+// typedString renders a decrypted value the way `sops --decrypt` would print
+// it in YAML.
+func typedString(plain []byte, typ string) string {
+	if typ == "bool" {
+		if b, err := strconv.ParseBool(string(plain)); err == nil {
+			return strconv.FormatBool(b)
+		}
+	}
+	return string(plain)
+}
+
+// plainBytes returns the bytes sops hashes for an unencrypted scalar.
+func plainBytes(node *yaml.Node) []byte {
+	if node.Tag == "!!bool" {
+		var b bool
+		if node.Decode(&b) == nil {
+			if b {
+				return []byte("True")
+			}
+			return []byte("False")
+		}
+	}
+	return []byte(node.Value)
+}
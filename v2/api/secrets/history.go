@@ -0,0 +1,76 @@
+package secrets
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"filippo.io/age"
+)
+
+// ErrNoSealKey means the API host has no X25519 age identity to encrypt
+// history snapshots to.
+var ErrNoSealKey = errors.New("no age identity to encrypt secret history to")
+
+// Seal encrypts a snapshot of secrets for the version history. It uses the
+// SOPS document format, encrypted to the API host's own age identities, so
+// only an API that can decrypt it today can restore it later.
+func Seal(data map[string]string) ([]byte, error) {
+	ids, err := loadIdentities()
+	if err != nil {
+		return nil, ErrNoSealKey
+	}
+	var recipients []string
+	for _, id := range ids {
+		if x, ok := id.(*age.X25519Identity); ok {
+			recipients = append(recipients, x.Recipient().String())
+		}
+	}
+	if len(recipients) == 0 {
+		return nil, ErrNoSealKey
+	}
+	return encryptDocument(data, recipients, time.Now())
+}
+
+// Open decrypts a snapshot made by Seal.
+func Open(snapshot []byte) (map[string]string, error) {
+	ids, err := loadIdentities()
+	if err != nil {
+		return nil, err
+	}
+	return decryptDocument(snapshot, ids)
+}
+
+// DiffKeys compares two sets of secrets by key, in sorted order. Changed
+// keys are present in both with different values.
+func DiffKeys(before, after map[string]string) (added, changed, removed []string) {
+	added, changed, removed = []string{}, []string{}, []string{}
+	for k, v := range after {
+		old, ok := before[k]
+		switch {
+		case !ok:
+			added = append(added, k)
+		case old != v:
+			changed = append(changed, k)
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return added, changed, removed
+}
+
+// SortedKeys returns data's keys in sorted order.
+func SortedKeys(data map[string]string) []string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
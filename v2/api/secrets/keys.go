@@ -0,0 +1,149 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"filippo.io/age"
+	"gopkg.in/yaml.v3"
+)
+
+// sopsConfigFile is the per-app (or apps-dir-wide) file whose creation_rules
+// name the age recipients new secrets are encrypted to.
+const sopsConfigFile = ".sops.yaml"
+
+// loadIdentities reads the age identities used to decrypt, from the same
+// places as the sops CLI: SOPS_AGE_KEY, SOPS_AGE_KEY_FILE, then the user
+// config directory's sops/age/keys.txt.
+func loadIdentities() ([]age.Identity, error) {
+	if inline := os.Getenv("SOPS_AGE_KEY"); inline != "" {
+		ids, err := age.ParseIdentities(strings.NewReader(inline))
+		if err != nil {
+			return nil, fmt.Errorf("SOPS_AGE_KEY: %w", err)
+		}
+		return ids, nil
+	}
+	paths := []string{}
+	if file := os.Getenv("SOPS_AGE_KEY_FILE"); file != "" {
+		paths = append(paths, file)
+	} else {
+		if dir, err := os.UserConfigDir(); err == nil {
+			paths = append(paths, filepath.Join(dir, "sops", "age", "keys.txt"))
+		}
+		if home, err := os.UserHomeDir(); err == nil {
+			paths = append(paths, filepath.Join(home, ".config", "sops", "age", "keys.txt"))
+		}
+	}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("age key file: %w", err)
+		}
+		ids, err := age.ParseIdentities(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("age key file %s: %w", path, err)
+		}
+		return ids, nil
+	}
+	return nil, errors.New("no age key found: set SOPS_AGE_KEY_FILE or create ~/.config/sops/age/keys.txt")
+}
+
+func parseRecipient(s string) (age.Recipient, error) {
+	recs, err := age.ParseRecipients(strings.NewReader(s))
+	if err != nil || len(recs) != 1 {
+		return nil, fmt.Errorf("invalid age recipient %q", s)
+	}
+	return recs[0], nil
+}
+
+// normalizeRecipients trims, splits comma- or space-separated entries,
+// drops duplicates and checks that each one parses.
+func normalizeRecipients(values []string) ([]string, error) {
+	seen := map[string]bool{}
+	var out []string
+	for _, value := range values {
+		for _, r := range strings.FieldsFunc(value, func(c rune) bool {
+			return c == ',' || c == ' ' || c == '\n' || c == '\t'
+		}) {
+			if seen[r] {
+				continue
+			}
+			if _, err := parseRecipient(r); err != nil {
+				return nil, err
+			}
+			seen[r] = true
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+type sopsConfig struct {
+	CreationRules []struct {
+		PathRegex string `yaml:"path_regex"`
+		Age       any    `yaml:"age"`
+	} `yaml:"creation_rules"`
+}
+
+// configRecipients returns the age recipients of the first creation rule in
+// configPath whose path_regex matches filePath. Like sops, it matches the
+// path relative to the directory holding the config, so a rule in the apps
+// directory's config sees shop/secrets.enc.yaml. It returns nil, nil when
+// the config file does not exist.
+func configRecipients(configPath, filePath string) ([]string, error) {
+	raw, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cfg sopsConfig
+	if err := yaml.Unmarshal(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", configPath, err)
+	}
+	rel, err := filepath.Rel(filepath.Dir(configPath), filePath)
+	if err != nil {
+		return nil, err
+	}
+	rel = filepath.ToSlash(rel)
+	for _, rule := range cfg.CreationRules {
+		if rule.PathRegex != "" {
+			re, err := regexp.Compile(rule.PathRegex)
+			if err != nil {
+				return nil, fmt.Errorf("%s: path_regex: %w", configPath, err)
+			}
+			if !re.MatchString(rel) {
+				continue
+			}
+		}
+		var values []string
+		switch v := rule.Age.(type) {
+		case string:
+			values = []string{v}
+		case []any:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					values = append(values, s)
+				}
+			}
+		}
+		recipients, err := normalizeRecipients(values)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", configPath, err)
+		}
+		if len(recipients) == 0 {
+			return nil, fmt.Errorf("%s: matching creation rule has no age recipients", configPath)
+		}
+		return recipients, nil
+	}
+	return nil, fmt.Errorf("%s: no creation rule matches %s", configPath, rel)
+}
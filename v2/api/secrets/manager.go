@@ -0,0 +1,292 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"norn/v2/api/model"
+)
+
+// SecretBackend stores the secrets of one app environment as a flat map of
+// env var names to values.
+type SecretBackend interface {
+	// Kind names the backend: sops, nomad or vault.
+	Kind() string
+	// Location describes where appID's secrets live, for status output.
+	Location(appID string) string
+	// Load returns appID's secrets, or an error satisfying os.IsNotExist
+	// when there are none.
+	Load(appID string) (map[string]string, error)
+	// Store replaces appID's secrets with data.
+	Store(appID string, data map[string]string) error
+}
+
+// Target names one place an app environment's secrets can live.
+type Target struct {
+	Kind  string
+	File  string // sops: file name in the app directory
+	Path  string // nomad: variable path; vault: KV path
+	Mount string // vault: KV v2 mount
+}
+
+// TargetFor returns where spec declares its secrets.
+func TargetFor(spec *model.InfraSpec) Target {
+	t := Target{Kind: spec.SecretsBackendType(), File: spec.SecretsFile()}
+	if spec.SecretsTemplated() {
+		t.Path = spec.SecretsPath()
+	}
+	if t.Kind == model.SecretsBackendVault {
+		t.Mount = spec.VaultMount()
+	}
+	return t
+}
+
+// Manager reads and writes an app environment's secrets through one
+// SecretBackend. The zero backend is the app's SOPS file.
+type Manager struct {
+	backend SecretBackend
+	stores  *stores
+}
+
+// stores holds the clients every manager derived from NewManager shares.
+type stores struct {
+	appsDir string
+	cache   *cache
+	vars    VariableStore
+	vault   *Vault
+}
+
+func NewManager(appsDir string) *Manager {
+	s := &stores{appsDir: appsDir, cache: newCache()}
+	return &Manager{backend: s.sops(defaultSecretFile), stores: s}
+}
+
+// UseNomad lets apps keep their secrets in Nomad Variables.
+func (m *Manager) UseNomad(vars VariableStore) {
+	m.stores.vars = vars
+}
+
+// UseVault lets apps keep their secrets in Vault KV v2.
+func (m *Manager) UseVault(v *Vault) {
+	m.stores.vault = v
+}
+
+// WithFile returns a manager that reads and writes the named secrets file in
+// each app directory, such as an environment's secrets.staging.enc.yaml.
+func (m *Manager) WithFile(name string) *Manager {
+	if m == nil || name == "" {
+		return m
+	}
+	if b, ok := m.backend.(*sopsBackend); ok && b.file == name {
+		return m
+	}
+	return m.At(Target{Kind: model.SecretsBackendSOPS, File: name})
+}
+
+// For returns the manager for spec's secrets backend and environment.
+func (m *Manager) For(spec *model.InfraSpec) *Manager {
+	if m == nil {
+		return nil
+	}
+	return m.At(TargetFor(spec))
+}
+
+// At returns a manager for the secrets at t.
+func (m *Manager) At(t Target) *Manager {
+	if m == nil {
+		return nil
+	}
+	var b SecretBackend
+	switch t.Kind {
+	case model.SecretsBackendNomad:
+		b = &nomadBackend{vars: m.stores.vars, path: t.Path}
+	case model.SecretsBackendVault:
+		mount := t.Mount
+		if mount == "" {
+			mount = model.DefaultVaultMount
+		}
+		b = &vaultBackend{vault: m.stores.vault, mount: mount, path: t.Path}
+	default:
+		file := t.File
+		if file == "" {
+			file = defaultSecretFile
+		}
+		b = m.stores.sops(file)
+	}
+	return &Manager{backend: b, stores: m.stores}
+}
+
+// Kind names the manager's backend.
+func (m *Manager) Kind() string {
+	return m.backend.Kind()
+}
+
+// Location describes where appID's secrets live.
+func (m *Manager) Location(appID string) string {
+	return m.backend.Location(appID)
+}
+
+// Templated reports whether tasks read the secrets themselves through a
+// Nomad template, so they must not be copied into the job's env.
+func (m *Manager) Templated() bool {
+	k := m.Kind()
+	return k == model.SecretsBackendNomad || k == model.SecretsBackendVault
+}
+
+// Healthy reports whether an age identity is available to decrypt with.
+func (m *Manager) Healthy() error {
+	_, err := loadIdentities()
+	return err
+}
+
+func (m *Manager) List(appID string) ([]string, error) {
+	data, err := m.backend.Load(appID)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (m *Manager) Get(appID string) (map[string]string, error) {
+	return m.backend.Load(appID)
+}
+
+func (m *Manager) Set(appID string, updates map[string]string) error {
+	existing, err := m.backend.Load(appID)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("decrypt: %w", err)
+	}
+	if existing == nil {
+		existing = make(map[string]string)
+	}
+	for k, v := range updates {
+		existing[k] = v
+	}
+	return m.backend.Store(appID, existing)
+}
+
+func (m *Manager) Delete(appID string, key string) error {
+	existing, err := m.backend.Load(appID)
+	if err != nil {
+		return err
+	}
+	delete(existing, key)
+	return m.backend.Store(appID, existing)
+}
+
+// Snapshot returns appID's secrets, or an empty map when there are none.
+func (m *Manager) Snapshot(appID string) (map[string]string, error) {
+	data, err := m.backend.Load(appID)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	return data, err
+}
+
+// Replace overwrites appID's secrets with data, as a rollback does.
+func (m *Manager) Replace(appID string, data map[string]string) error {
+	return m.backend.Store(appID, copyMap(data))
+}
+
+// EnvMap decrypts secrets and returns them as env var entries (KEY=VALUE).
+func (m *Manager) EnvMap(appID string) (map[string]string, error) {
+	data, err := m.backend.Load(appID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// JobEnv returns the secrets to bake into a Nomad job's env: all of them for
+// SOPS files, none for templated backends.
+func (m *Manager) JobEnv(appID string) (map[string]string, error) {
+	if m.Templated() {
+		return nil, nil
+	}
+	return m.EnvMap(appID)
+}
+
+// RotateKeys re-encrypts an app's secrets under a fresh data key for
+// recipients, or for the .sops.yaml recipients when none are given, and
+// returns the recipients used.
+func (m *Manager) RotateKeys(appID string, recipients []string) ([]string, error) {
+	b, ok := m.backend.(*sopsBackend)
+	if !ok {
+		return nil, fmt.Errorf("key rotation applies to sops files; the %s backend manages its own encryption", m.Kind())
+	}
+	return b.rotateKeys(appID, recipients)
+}
+
+// CopyResult lists, by key, what Copy did. Values are never included.
+type CopyResult struct {
+	Copied      []string `json:"copied"`
+	Overwritten []string `json:"overwritten"`
+	Unchanged   []string `json:"unchanged"`
+	Conflicts   []string `json:"conflicts"`
+}
+
+// Copy copies appID's secrets from src into m. Keys that already hold a
+// different value are conflicts and left alone unless overwrite is set.
+// With dryRun nothing is written.
+func (m *Manager) Copy(appID string, src *Manager, overwrite, dryRun bool) (*CopyResult, error) {
+	if src.Kind() == m.Kind() && src.Location(appID) == m.Location(appID) {
+		return nil, fmt.Errorf("source and destination are both %s", m.Location(appID))
+	}
+	from, err := src.backend.Load(appID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("read %s: %w", src.Location(appID), err)
+	}
+	to, err := m.backend.Load(appID)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read %s: %w", m.Location(appID), err)
+	}
+	// Work on a copy so a dry run leaves whatever Load returned untouched.
+	to = copyMap(to)
+
+	result := &CopyResult{Copied: []string{}, Overwritten: []string{}, Unchanged: []string{}, Conflicts: []string{}}
+	keys := make([]string, 0, len(from))
+	for k := range from {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	changed := false
+	for _, k := range keys {
+		current, exists := to[k]
+		switch {
+		case !exists:
+			result.Copied = append(result.Copied, k)
+		case current == from[k]:
+			result.Unchanged = append(result.Unchanged, k)
+			continue
+		case overwrite:
+			result.Overwritten = append(result.Overwritten, k)
+		default:
+			result.Conflicts = append(result.Conflicts, k)
+			continue
+		}
+		to[k] = from[k]
+		changed = true
+	}
+	if changed && !dryRun {
+		if err := m.backend.Store(appID, to); err != nil {
+			return nil, fmt.Errorf("write %s: %w", m.Location(appID), err)
+		}
+	}
+	return result, nil
+}
+
+// notFound is the error backends return for an app with no secrets.
+func notFound(location string) error {
+	return &os.PathError{Op: "read", Path: location, Err: os.ErrNotExist}
+}
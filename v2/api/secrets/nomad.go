@@ -0,0 +1,50 @@
+package secrets
+
+import (
+	"errors"
+
+	"norn/v2/api/model"
+)
+
+// VariableStore reads and writes Nomad Variables. nomad.Client implements
+// it.
+type VariableStore interface {
+	// ReadVariable returns the variable's items, or nil when it does not
+	// exist.
+	ReadVariable(path string) (map[string]string, error)
+	WriteVariable(path string, items map[string]string) error
+}
+
+// nomadBackend keeps an app environment's secrets as the items of one Nomad
+// variable, which tasks read through a template.
+type nomadBackend struct {
+	vars VariableStore
+	path string
+}
+
+var errNomadUnconfigured = errors.New("nomad variables secrets backend: nomad is not connected")
+
+func (b *nomadBackend) Kind() string { return model.SecretsBackendNomad }
+
+func (b *nomadBackend) Location(string) string { return "nomad var " + b.path }
+
+func (b *nomadBackend) Load(string) (map[string]string, error) {
+	if b.vars == nil {
+		return nil, errNomadUnconfigured
+	}
+	items, err := b.vars.ReadVariable(b.path)
+	if err != nil {
+		return nil, err
+	}
+	if items == nil {
+		return nil, notFound(b.Location(""))
+	}
+	return items, nil
+}
+
+func (b *nomadBackend) Store(_ string, data map[string]string) error {
+	if b.vars == nil {
+		return errNomadUnconfigured
+	}
+	return b.vars.WriteVariable(b.path, data)
+}
@@ -3,118 +3,202 @@ package secrets
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sync"
+	"time"
 
-	"gopkg.in/yaml.v3"
+	"norn/v2/api/model"
 )
 
-// Manager handles SOPS-encrypted secret files.
-type Manager struct {
+// defaultSecretFile is the per-app secrets file outside named environments.
+const defaultSecretFile = "secrets.enc.yaml"
+
+// sopsBackend keeps secrets in a SOPS-encrypted YAML file in each app
+// directory. It reads and writes the sops format in-process with age, so
+// plaintext never touches disk, and caches decrypted files until they
+// change.
+type sopsBackend struct {
 	appsDir string
+	file    string
+	cache   *cache
 }
 
-func NewManager(appsDir string) *Manager {
-	return &Manager{appsDir: appsDir}
+func (s *stores) sops(file string) *sopsBackend {
+	return &sopsBackend{appsDir: s.appsDir, file: file, cache: s.cache}
 }
 
-func (m *Manager) SecretFile(appID string) string {
-	return filepath.Join(m.appsDir, appID, "secrets.enc.yaml")
+func (b *sopsBackend) Kind() string { return model.SecretsBackendSOPS }
+
+func (b *sopsBackend) Location(appID string) string {
+	return filepath.Join(b.appsDir, appID, b.file)
 }
 
-func (m *Manager) List(appID string) ([]string, error) {
-	data, err := m.decrypt(appID)
+func (b *sopsBackend) Load(appID string) (map[string]string, error) {
+	path := b.Location(appID)
+	info, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
-	keys := make([]string, 0, len(data))
-	for k := range data {
-		keys = append(keys, k)
+	if data, ok := b.cache.get(path, info); ok {
+		return data, nil
 	}
-	return keys, nil
-}
 
-func (m *Manager) Get(appID string) (map[string]string, error) {
-	return m.decrypt(appID)
-}
-
-func (m *Manager) Set(appID string, updates map[string]string) error {
-	existing, err := m.decrypt(appID)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("decrypt: %w", err)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
 	}
-	if existing == nil {
-		existing = make(map[string]string)
+	identities, err := loadIdentities()
+	if err != nil {
+		return nil, fmt.Errorf("sops decrypt %s: %w", b.file, err)
 	}
-	for k, v := range updates {
-		existing[k] = v
+	data, err := decryptDocument(raw, identities)
+	if err != nil {
+		return nil, fmt.Errorf("sops decrypt %s: %w", b.file, err)
 	}
-	return m.encrypt(appID, existing)
+	b.cache.put(path, info, data)
+	return copyMap(data), nil
 }
 
-func (m *Manager) Delete(appID string, key string) error {
-	existing, err := m.decrypt(appID)
-	if err != nil {
-		return err
-	}
-	delete(existing, key)
-	return m.encrypt(appID, existing)
+func (b *sopsBackend) Store(appID string, data map[string]string) error {
+	return b.encrypt(appID, data, nil)
 }
 
-// EnvMap decrypts secrets and returns them as env var entries (KEY=VALUE).
-func (m *Manager) EnvMap(appID string) (map[string]string, error) {
-	data, err := m.decrypt(appID)
+func (b *sopsBackend) rotateKeys(appID string, recipients []string) ([]string, error) {
+	existing, err := b.Load(appID)
+	if err != nil {
+		return nil, err
+	}
+	recipients, err = normalizeRecipients(recipients)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
+		return nil, err
+	}
+	if len(recipients) == 0 {
+		recipients, err = b.configRecipients(appID)
+		if err != nil {
+			return nil, err
 		}
+		if len(recipients) == 0 {
+			return nil, fmt.Errorf("no recipients given and no %s found for %s", sopsConfigFile, appID)
+		}
+	}
+	if err := b.encrypt(appID, existing, recipients); err != nil {
 		return nil, err
 	}
-	return data, nil
+	return recipients, nil
 }
 
-func (m *Manager) decrypt(appID string) (map[string]string, error) {
-	path := m.SecretFile(appID)
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return nil, err
+// encrypt writes data to the app's secrets file, encrypted to recipients.
+// With no recipients it uses the .sops.yaml creation rule, falling back to
+// the recipients the file is already encrypted to.
+func (b *sopsBackend) encrypt(appID string, data map[string]string, recipients []string) error {
+	path := b.Location(appID)
+	if len(recipients) == 0 {
+		var err error
+		recipients, err = b.configRecipients(appID)
+		if err != nil {
+			return fmt.Errorf("sops encrypt: %w", err)
+		}
+	}
+	if len(recipients) == 0 {
+		if raw, err := os.ReadFile(path); err == nil {
+			recipients, _ = fileRecipients(raw)
+		}
+	}
+	if len(recipients) == 0 {
+		return fmt.Errorf("sops encrypt: no age recipients: add a creation rule to %s", filepath.Join(b.appsDir, appID, sopsConfigFile))
 	}
 
-	cmd := exec.Command("sops", "--decrypt", path)
-	out, err := cmd.Output()
+	encrypted, err := encryptDocument(data, recipients, time.Now())
 	if err != nil {
-		return nil, fmt.Errorf("sops decrypt: %w", err)
+		return fmt.Errorf("sops encrypt: %w", err)
 	}
-
-	var data map[string]string
-	if err := yaml.Unmarshal(out, &data); err != nil {
-		return nil, fmt.Errorf("unmarshal secrets: %w", err)
+	if err := writeFileAtomic(path, encrypted); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		b.cache.put(path, info, data)
 	}
-	return data, nil
+	return nil
 }
 
-func (m *Manager) encrypt(appID string, data map[string]string) error {
-	path := m.SecretFile(appID)
+// configRecipients reads the app's .sops.yaml, or the apps directory's when
+// the app has none.
+func (b *sopsBackend) configRecipients(appID string) ([]string, error) {
+	for _, dir := range []string{filepath.Join(b.appsDir, appID), b.appsDir} {
+		recipients, err := configRecipients(filepath.Join(dir, sopsConfigFile), b.Location(appID))
+		if err != nil || recipients != nil {
+			return recipients, err
+		}
+	}
+	return nil, nil
+}
 
-	plain, err := yaml.Marshal(data)
+// writeFileAtomic replaces path with data through a temporary file in the
+// same directory. Only ciphertext is ever written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
 	if err != nil {
 		return err
 	}
-
-	tmpFile := path + ".tmp"
-	if err := os.WriteFile(tmpFile, plain, 0600); err != nil {
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
 		return err
 	}
-	defer os.Remove(tmpFile)
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
 
-	configFile := filepath.Join(m.appsDir, appID, ".sops.yaml")
-	cmd := exec.Command("sops", "--config", configFile, "--encrypt", "--input-type", "yaml", "--output-type", "yaml", tmpFile)
-	encrypted, err := cmd.Output()
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return fmt.Errorf("sops encrypt: %s", string(exitErr.Stderr))
-		}
-		return fmt.Errorf("sops encrypt: %w", err)
+// cache holds decrypted secret files keyed by path, each valid while the
+// file's size and modification time are unchanged.
+type cache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	size    int64
+	modTime time.Time
+	data    map[string]string
+}
+
+func newCache() *cache {
+	return &cache{entries: map[string]cacheEntry{}}
+}
+
+func (c *cache) get(path string, info os.FileInfo) (map[string]string, bool) {
+	if c == nil {
+		return nil, false
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[path]
+	if !ok || entry.size != info.Size() || !entry.modTime.Equal(info.ModTime()) {
+		delete(c.entries, path)
+		return nil, false
+	}
+	return copyMap(entry.data), true
+}
+
+func (c *cache) put(path string, info os.FileInfo, data map[string]string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[path] = cacheEntry{size: info.Size(), modTime: info.ModTime(), data: copyMap(data)}
+}
 
-	return os.WriteFile(path, encrypted, 0600)
+func copyMap(in map[string]string) map[string]string {
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
 }
@@ -0,0 +1,264 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+)
+
+func newTestIdentity(t *testing.T) *age.X25519Identity {
+	t.Helper()
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func newTestManager(t *testing.T, recipients ...string) *Manager {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "web"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := "creation_rules:\n  - age: >-\n      " + strings.Join(recipients, ",") + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "web", sopsConfigFile), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return NewManager(dir)
+}
+
+func TestManagerRoundTripKeepsPlaintextOffDisk(t *testing.T) {
+	id := newTestIdentity(t)
+	t.Setenv("SOPS_AGE_KEY", id.String())
+	m := newTestManager(t, id.Recipient().String())
+
+	if err := m.Set("web", map[string]string{"DATABASE_URL": "postgres://u:hunter2@db/web", "EMPTY": ""}); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(m.Location("web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "hunter2") {
+		t.Fatal("plaintext value written to the secrets file")
+	}
+	if !strings.Contains(string(raw), "DATABASE_URL: ENC[AES256_GCM,data:") || !strings.Contains(string(raw), "recipient: "+id.Recipient().String()) {
+		t.Fatalf("unexpected file layout:\n%s", raw)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(m.Location("web")))
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") && e.Name() != sopsConfigFile {
+			t.Fatalf("temporary file %s left behind", e.Name())
+		}
+	}
+
+	// A fresh manager has no cache, so this decrypts the file from disk.
+	got, err := NewManager(m.stores.appsDir).Get("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["DATABASE_URL"] != "postgres://u:hunter2@db/web" || got["EMPTY"] != "" || len(got) != 2 {
+		t.Fatalf("Get = %v", got)
+	}
+
+	if err := m.Delete("web", "EMPTY"); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewManager(m.stores.appsDir).List("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "DATABASE_URL" {
+		t.Fatalf("List = %v", keys)
+	}
+}
+
+func TestDecryptDocumentDetectsTampering(t *testing.T) {
+	id := newTestIdentity(t)
+	raw, err := encryptDocument(map[string]string{"A": "one", "B": "two"}, []string{id.Recipient().String()}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decryptDocument(raw, []age.Identity{id}); err != nil {
+		t.Fatalf("untampered document: %v", err)
+	}
+
+	lines := strings.Split(string(raw), "\n")
+	var a, b int
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "A: "):
+			a = i
+		case strings.HasPrefix(line, "B: "):
+			b = i
+		}
+	}
+	swapped := append([]string(nil), lines...)
+	swapped[a] = "A: " + strings.TrimPrefix(lines[b], "B: ")
+	swapped[b] = "B: " + strings.TrimPrefix(lines[a], "A: ")
+	if _, err := decryptDocument([]byte(strings.Join(swapped, "\n")), []age.Identity{id}); err == nil {
+		t.Fatal("values moved between keys should not decrypt")
+	}
+
+	plain := append([]string(nil), lines...)
+	plain[a] = "A: one"
+	if _, err := decryptDocument([]byte(strings.Join(plain, "\n")), []age.Identity{id}); err == nil || !strings.Contains(err.Error(), "secret A") {
+		t.Fatalf("replacing a value with plaintext: err = %v", err)
+	}
+
+	other := newTestIdentity(t)
+	if _, err := decryptDocument(raw, []age.Identity{other}); err == nil || !strings.Contains(err.Error(), id.Recipient().String()) {
+		t.Fatalf("wrong identity: err = %v", err)
+	}
+}
+
+func TestDecryptDocumentUnencryptedSuffixIsCoveredByMAC(t *testing.T) {
+	id := newTestIdentity(t)
+	raw, err := encryptDocument(map[string]string{"REGION_unencrypted": "eu", "TOKEN": "t"}, []string{id.Recipient().String()}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), "REGION_unencrypted: eu") {
+		t.Fatalf("suffixed key should stay plaintext:\n%s", raw)
+	}
+	data, err := decryptDocument(raw, []age.Identity{id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["REGION_unencrypted"] != "eu" || data["TOKEN"] != "t" {
+		t.Fatalf("data = %v", data)
+	}
+	edited := strings.Replace(string(raw), "REGION_unencrypted: eu", "REGION_unencrypted: us", 1)
+	if _, err := decryptDocument([]byte(edited), []age.Identity{id}); err == nil || !strings.Contains(err.Error(), "MAC mismatch") {
+		t.Fatalf("editing a plaintext value: err = %v", err)
+	}
+}
+
+func TestManagerCacheInvalidatesOnFileChange(t *testing.T) {
+	id := newTestIdentity(t)
+	t.Setenv("SOPS_AGE_KEY", id.String())
+	m := newTestManager(t, id.Recipient().String())
+	if err := m.Set("web", map[string]string{"KEY": "old"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Get("web"); got["KEY"] != "old" {
+		t.Fatalf("Get = %v", got)
+	}
+
+	// Edit the file behind the manager's back, as `sops` or a git pull would.
+	raw, err := encryptDocument(map[string]string{"KEY": "new", "EXTRA": "x"}, []string{id.Recipient().String()}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := m.Location("web")
+	if err := os.WriteFile(path, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.Get("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["KEY"] != "new" || got["EXTRA"] != "x" {
+		t.Fatalf("Get after edit = %v", got)
+	}
+
+	got["KEY"] = "mutated"
+	if again, _ := m.Get("web"); again["KEY"] != "new" {
+		t.Fatal("callers must not be able to mutate the cache")
+	}
+}
+
+func TestRotateKeysReencryptsToNewRecipients(t *testing.T) {
+	oldID := newTestIdentity(t)
+	newID := newTestIdentity(t)
+	t.Setenv("SOPS_AGE_KEY", oldID.String())
+	m := newTestManager(t, oldID.Recipient().String())
+	if err := m.Set("web", map[string]string{"KEY": "value"}); err != nil {
+		t.Fatal(err)
+	}
+
+	recipients, err := m.RotateKeys("web", []string{newID.Recipient().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipients) != 1 || recipients[0] != newID.Recipient().String() {
+		t.Fatalf("recipients = %v", recipients)
+	}
+	raw, err := os.ReadFile(m.Location("web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decryptDocument(raw, []age.Identity{oldID}); err == nil {
+		t.Fatal("old identity should no longer decrypt")
+	}
+	data, err := decryptDocument(raw, []age.Identity{newID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["KEY"] != "value" {
+		t.Fatalf("data = %v", data)
+	}
+
+	if _, err := m.RotateKeys("web", []string{"not-a-key"}); err == nil {
+		t.Fatal("invalid recipient should be rejected")
+	}
+}
+
+func TestConfigRecipients(t *testing.T) {
+	a := newTestIdentity(t).Recipient().String()
+	b := newTestIdentity(t).Recipient().String()
+	dir := t.TempDir()
+	path := filepath.Join(dir, sopsConfigFile)
+	config := "creation_rules:\n" +
+		"  - path_regex: secrets\\.staging\\.enc\\.yaml$\n" +
+		"    age:\n      - " + b + "\n" +
+		"  - age: " + a + ", " + b + "\n"
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := configRecipients(path, filepath.Join(dir, "secrets.staging.enc.yaml"))
+	if err != nil || len(got) != 1 || got[0] != b {
+		t.Fatalf("staging recipients = %v, %v", got, err)
+	}
+	got, err = configRecipients(path, filepath.Join(dir, defaultSecretFile))
+	if err != nil || len(got) != 2 || got[0] != a || got[1] != b {
+		t.Fatalf("default recipients = %v, %v", got, err)
+	}
+	got, err = configRecipients(filepath.Join(t.TempDir(), sopsConfigFile), filepath.Join(dir, defaultSecretFile))
+	if err != nil || got != nil {
+		t.Fatalf("missing config = %v, %v", got, err)
+	}
+}
+
+func TestConfigRecipientsMatchesPathFromConfigDirectory(t *testing.T) {
+	a := newTestIdentity(t).Recipient().String()
+	b := newTestIdentity(t).Recipient().String()
+	appsDir := t.TempDir()
+	config := "creation_rules:\n" +
+		"  - path_regex: ^shop/secrets\\.enc\\.yaml$\n" +
+		"    age: " + b + "\n" +
+		"  - age: " + a + "\n"
+	if err := os.WriteFile(filepath.Join(appsDir, sopsConfigFile), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	backend := &sopsBackend{appsDir: appsDir, file: defaultSecretFile}
+
+	got, err := backend.configRecipients("shop")
+	if err != nil || len(got) != 1 || got[0] != b {
+		t.Fatalf("shop recipients = %v, %v, want the shop/ rule", got, err)
+	}
+	got, err = backend.configRecipients("blog")
+	if err != nil || len(got) != 1 || got[0] != a {
+		t.Fatalf("blog recipients = %v, %v, want the catch-all rule", got, err)
+	}
+}
@@ -0,0 +1,155 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"norn/v2/api/model"
+)
+
+// Vault reads and writes Vault KV v2 secrets over the HTTP API.
+type Vault struct {
+	addr      string
+	token     string
+	namespace string
+	http      *http.Client
+}
+
+func NewVault(addr, token, namespace string) *Vault {
+	return &Vault{
+		addr:      strings.TrimRight(addr, "/"),
+		token:     token,
+		namespace: namespace,
+		http:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Healthy checks that Vault is reachable, initialized and unsealed.
+func (v *Vault) Healthy(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.addr+"/v1/sys/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// 429 is an unsealed standby.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("vault health: HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Read returns the latest version of the secret at mount/path, or nil when
+// it does not exist. Non-string values are returned as JSON.
+func (v *Vault) Read(mount, path string) (map[string]string, error) {
+	var out struct {
+		Data struct {
+			Data map[string]json.RawMessage `json:"data"`
+		} `json:"data"`
+	}
+	status, err := v.do(http.MethodGet, mount, path, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound || out.Data.Data == nil {
+		return nil, nil
+	}
+	data := make(map[string]string, len(out.Data.Data))
+	for k, raw := range out.Data.Data {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			data[k] = s
+		} else {
+			data[k] = string(raw)
+		}
+	}
+	return data, nil
+}
+
+// Write stores data as a new version of the secret at mount/path.
+func (v *Vault) Write(mount, path string, data map[string]string) error {
+	body, err := json.Marshal(map[string]any{"data": data})
+	if err != nil {
+		return err
+	}
+	_, err = v.do(http.MethodPost, mount, path, body, nil)
+	return err
+}
+
+func (v *Vault) do(method, mount, path string, body []byte, out any) (int, error) {
+	url := fmt.Sprintf("%s/v1/%s/data/%s", v.addr, mount, path)
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := v.http.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("vault %s %s/%s: %w", strings.ToLower(method), mount, path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodGet {
+		return resp.StatusCode, nil
+	}
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return resp.StatusCode, fmt.Errorf("vault %s %s/%s: HTTP %d: %s", strings.ToLower(method), mount, path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("vault %s/%s: decode: %w", mount, path, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// vaultBackend keeps an app environment's secrets as the keys of one Vault
+// KV v2 secret, which tasks read through a template.
+type vaultBackend struct {
+	vault *Vault
+	mount string
+	path  string
+}
+
+var errVaultUnconfigured = errors.New("vault secrets backend: NORN_VAULT_ADDR is not configured")
+
+func (b *vaultBackend) Kind() string { return model.SecretsBackendVault }
+
+func (b *vaultBackend) Location(string) string { return "vault " + b.mount + "/" + b.path }
+
+func (b *vaultBackend) Load(string) (map[string]string, error) {
+	if b.vault == nil {
+		return nil, errVaultUnconfigured
+	}
+	data, err := b.vault.Read(b.mount, b.path)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, notFound(b.Location(""))
+	}
+	return data, nil
+}
+
+func (b *vaultBackend) Store(_ string, data map[string]string) error {
+	if b.vault == nil {
+		return errVaultUnconfigured
+	}
+	return b.vault.Write(b.mount, b.path, data)
+}
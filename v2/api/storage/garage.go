@@ -109,6 +109,19 @@ func (c *GarageAdminClient) GetKey(ctx context.Context, name string, showSecret
 	return &out, nil
 }
 
+// GetKeyByID looks a key up by its access key ID.
+func (c *GarageAdminClient) GetKeyByID(ctx context.Context, id string, showSecret bool) (*GarageKey, error) {
+	var out GarageKey
+	path := "/v2/GetKeyInfo?id=" + url.QueryEscape(id)
+	if showSecret {
+		path += "&showSecretKey=true"
+	}
+	if err := c.do(ctx, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
 func (c *GarageAdminClient) CreateKey(ctx context.Context, name string) (*GarageKey, error) {
 	req := map[string]interface{}{
 		"name":         name,
@@ -130,6 +143,11 @@ func (c *GarageAdminClient) AllowBucketKey(ctx context.Context, bucketID, access
 	return c.do(ctx, http.MethodPost, "/v2/AllowBucketKey", req, nil)
 }
 
+// DeleteKey deletes a key and its bucket permissions.
+func (c *GarageAdminClient) DeleteKey(ctx context.Context, accessKeyID string) error {
+	return c.do(ctx, http.MethodPost, "/v2/DeleteKey?id="+url.QueryEscape(accessKeyID), nil, nil)
+}
+
 func (c *GarageAdminClient) do(ctx context.Context, method, path string, body interface{}, out interface{}) error {
 	var reader *bytes.Reader
 	if body != nil {
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"norn/v2/api/model"
+)
+
+func TestIssueAndRevokeAppKey(t *testing.T) {
+	keys := map[string]GarageKey{}
+	grants := map[string]BucketKeyPermissions{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer admin" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/v2/GetKeyInfo":
+			for _, k := range keys {
+				if k.Name == q.Get("search") || k.AccessKeyID == q.Get("id") {
+					json.NewEncoder(w).Encode(k)
+					return
+				}
+			}
+			http.Error(w, "key not found", http.StatusNotFound)
+		case "/v2/CreateKey":
+			var req struct{ Name string }
+			json.NewDecoder(r.Body).Decode(&req)
+			k := GarageKey{AccessKeyID: "GK" + req.Name, Name: req.Name, SecretAccessKey: "secret-" + req.Name}
+			keys[k.AccessKeyID] = k
+			json.NewEncoder(w).Encode(k)
+		case "/v2/GetBucketInfo":
+			json.NewEncoder(w).Encode(GarageBucket{ID: "b-" + q.Get("globalAlias")})
+		case "/v2/AllowBucketKey":
+			var req struct {
+				BucketID    string               `json:"bucketId"`
+				AccessKeyID string               `json:"accessKeyId"`
+				Permissions BucketKeyPermissions `json:"permissions"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+			grants[req.BucketID+"/"+req.AccessKeyID] = req.Permissions
+		case "/v2/DeleteKey":
+			if _, ok := keys[q.Get("id")]; !ok {
+				http.Error(w, "key not found", http.StatusNotFound)
+				return
+			}
+			delete(keys, q.Get("id"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(Config{Endpoint: "127.0.0.1:3900", AccessKey: "shared", SecretKey: "x", Provider: "garage", GarageAdminEndpoint: srv.URL, GarageAdminToken: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := &model.ObjectStorageInfra{Buckets: []model.ObjectStorageBucket{{Name: "media", Access: "readOnly"}, {Name: "uploads"}}}
+
+	key, err := client.IssueAppKey(context.Background(), "norn-web-r1", spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := client.IssueAppKey(context.Background(), "norn-web-r1", spec)
+	if err != nil || again.AccessKeyID != key.AccessKeyID || again.SecretAccessKey != key.SecretAccessKey || len(keys) != 1 {
+		t.Fatalf("issuing twice should return the same key: %+v, %v", again, err)
+	}
+	if p := grants["b-media/"+key.AccessKeyID]; !p.Read || p.Write {
+		t.Fatalf("media permissions = %+v", p)
+	}
+	if p := grants["b-uploads/"+key.AccessKeyID]; !p.Read || !p.Write {
+		t.Fatalf("uploads permissions = %+v", p)
+	}
+
+	result, err := client.ProvisionAppStorage(context.Background(), "web", spec, map[string]string{"AWS_ACCESS_KEY_ID": key.AccessKeyID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Secrets["AWS_ACCESS_KEY_ID"] != key.AccessKeyID || len(keys) != 1 {
+		t.Fatalf("provisioning should keep the stored key: %v", result.Secrets)
+	}
+
+	if err := client.RevokeAppKey(context.Background(), key.AccessKeyID); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RevokeAppKey(context.Background(), key.AccessKeyID); err != nil {
+		t.Fatalf("revoking a deleted key: %v", err)
+	}
+	if err := client.RevokeAppKey(context.Background(), "shared"); err == nil {
+		t.Fatal("the shared key must never be revoked")
+	}
+}
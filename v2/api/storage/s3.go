@@ -106,7 +106,10 @@ type ProvisionedBucket struct {
 	Created  bool
 }
 
-func (c *Client) ProvisionAppStorage(ctx context.Context, appID string, spec *model.ObjectStorageInfra, _ map[string]string) (*ProvisionResult, error) {
+// ProvisionAppStorage ensures the app's buckets and, with Garage, its own
+// key. env holds the app's secrets; a Garage key already stored there, such
+// as one issued by credential rotation, is kept.
+func (c *Client) ProvisionAppStorage(ctx context.Context, appID string, spec *model.ObjectStorageInfra, env map[string]string) (*ProvisionResult, error) {
 	result := &ProvisionResult{
 		Env:     map[string]string{},
 		Secrets: map[string]string{},
@@ -127,8 +130,11 @@ func (c *Client) ProvisionAppStorage(ctx context.Context, appID string, spec *mo
 	mode := "shared"
 
 	if strings.EqualFold(provider, "garage") && c.garage != nil {
-		keyName := fmt.Sprintf("norn-%s", appID)
-		key, created, err := c.garage.EnsureKey(ctx, keyName)
+		keyName := AppKeyName(appID)
+		key, created, err := c.storedKey(ctx, env)
+		if key == nil && err == nil {
+			key, created, err = c.garage.EnsureKey(ctx, keyName)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("garage key %s: %w", keyName, err)
 		}
@@ -195,6 +201,94 @@ func (c *Client) ProvisionAppStorage(ctx context.Context, appID string, spec *mo
 	return result, nil
 }
 
+// AppKeyName is the name of the Garage key provisioned for an app.
+func AppKeyName(appID string) string {
+	return fmt.Sprintf("norn-%s", appID)
+}
+
+// storedKey returns the Garage key named by env's AWS_ACCESS_KEY_ID, or nil
+// when env has none or Garage no longer knows it.
+func (c *Client) storedKey(ctx context.Context, env map[string]string) (*GarageKey, bool, error) {
+	id := env["AWS_ACCESS_KEY_ID"]
+	if id == "" || id == c.config.AccessKey {
+		return nil, false, nil
+	}
+	key, err := c.garage.GetKeyByID(ctx, id, true)
+	if err != nil {
+		if isGarageNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	if key.SecretAccessKey == "" {
+		return nil, false, nil
+	}
+	return key, false, nil
+}
+
+// ManagesKeys reports whether app keys are issued through the Garage admin
+// API, which credential rotation needs.
+func (c *Client) ManagesKeys() bool {
+	return c != nil && c.garage != nil
+}
+
+// IssueAppKey creates the Garage key name, or returns it when it exists, and
+// grants it the access spec declares on each bucket.
+func (c *Client) IssueAppKey(ctx context.Context, name string, spec *model.ObjectStorageInfra) (*GarageKey, error) {
+	if !c.ManagesKeys() {
+		return nil, fmt.Errorf("app keys need NORN_GARAGE_ADMIN_ENDPOINT and NORN_GARAGE_ADMIN_TOKEN")
+	}
+	key, _, err := c.garage.EnsureKey(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("garage key %s: %w", name, err)
+	}
+	for _, bucket := range spec.Buckets {
+		info, _, err := c.garage.EnsureBucket(ctx, bucket.Name)
+		if err != nil {
+			return nil, fmt.Errorf("garage bucket %s: %w", bucket.Name, err)
+		}
+		access := bucket.Access
+		if access == "" {
+			access = "readWrite"
+		}
+		if err := c.garage.AllowBucketKey(ctx, info.ID, key.AccessKeyID, permissionsForAccess(access)); err != nil {
+			return nil, fmt.Errorf("garage bucket %s permissions: %w", bucket.Name, err)
+		}
+	}
+	return key, nil
+}
+
+// AppKeyNameByID returns the name of the Garage key with accessKeyID, or ""
+// when Garage no longer knows it.
+func (c *Client) AppKeyNameByID(ctx context.Context, accessKeyID string) (string, error) {
+	if !c.ManagesKeys() {
+		return "", fmt.Errorf("app keys need NORN_GARAGE_ADMIN_ENDPOINT and NORN_GARAGE_ADMIN_TOKEN")
+	}
+	key, err := c.garage.GetKeyByID(ctx, accessKeyID, false)
+	if err != nil {
+		if isGarageNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("garage key %s: %w", accessKeyID, err)
+	}
+	return key.Name, nil
+}
+
+// RevokeAppKey deletes a Garage key. Keys that are already gone are not an
+// error, and the shared key Norn itself uses is never deleted.
+func (c *Client) RevokeAppKey(ctx context.Context, accessKeyID string) error {
+	if !c.ManagesKeys() {
+		return fmt.Errorf("app keys need NORN_GARAGE_ADMIN_ENDPOINT and NORN_GARAGE_ADMIN_TOKEN")
+	}
+	if accessKeyID == c.config.AccessKey {
+		return fmt.Errorf("refusing to delete the shared key %s", accessKeyID)
+	}
+	if err := c.garage.DeleteKey(ctx, accessKeyID); err != nil && !isGarageNotFound(err) {
+		return fmt.Errorf("delete garage key %s: %w", accessKeyID, err)
+	}
+	return nil
+}
+
 // PutObject uploads a file to a bucket.
 func (c *Client) PutObject(ctx context.Context, bucket, key, filePath string) error {
 	file, err := os.Open(filePath)
@@ -142,6 +142,35 @@ func (db *DB) ListAccessPatternRows(ctx context.Context, since time.Time) ([]Acc
 	return out, rows.Err()
 }
 
+// AccessStatusTotals sums observed requests and 5xx responses for an app over
+// the hourly buckets overlapping [from, to).
+func (db *DB) AccessStatusTotals(ctx context.Context, app string, from, to time.Time) (requests, serverErrors int64, err error) {
+	err = db.Pool.QueryRow(ctx, `
+		SELECT COALESCE(SUM(requests), 0)::bigint, COALESCE(SUM(server_errors), 0)::bigint
+		FROM access_observation_buckets
+		WHERE app = $1
+		  AND bucket_start >= date_trunc('hour', $2::timestamptz)
+		  AND bucket_start < $3
+	`, app, from.UTC(), to.UTC()).Scan(&requests, &serverErrors)
+	return requests, serverErrors, err
+}
+
+// LastAccess returns when a request for app's process was last observed, or
+// the zero time when none has been. Observations without a process count
+// for every process of the app.
+func (db *DB) LastAccess(ctx context.Context, app, process string) (time.Time, error) {
+	var last *time.Time
+	err := db.Pool.QueryRow(ctx, `
+		SELECT MAX(last_seen)
+		FROM access_observation_buckets
+		WHERE app = $1 AND (process = $2 OR process = '')
+	`, app, process).Scan(&last)
+	if err != nil || last == nil {
+		return time.Time{}, err
+	}
+	return *last, nil
+}
+
 func (db *DB) PruneAccessObservations(ctx context.Context, olderThan time.Time) error {
 	_, err := db.Pool.Exec(ctx, `DELETE FROM access_observation_buckets WHERE bucket_start < $1`, olderThan.UTC())
 	return err
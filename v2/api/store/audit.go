@@ -0,0 +1,255 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// auditChainLock serializes audit appends so each entry links to the one
+// before it.
+const auditChainLock = 0x6e6f726e61756474 // "nornaudt"
+
+// AuditEntry is one mutating API call. Entries form a hash chain: Hash covers
+// the entry's fields and PrevHash, so editing or deleting any row breaks
+// every hash after it.
+type AuditEntry struct {
+	ID            int64     `json:"id"`
+	Timestamp     time.Time `json:"timestamp"`
+	Actor         string    `json:"actor"`
+	Role          string    `json:"role,omitempty"`
+	AuthMethod    string    `json:"authMethod,omitempty"`
+	SourceIP      string    `json:"sourceIp"`
+	Method        string    `json:"method"`
+	Route         string    `json:"route"`
+	Path          string    `json:"path"`
+	App           string    `json:"app,omitempty"`
+	RequestDigest string    `json:"requestDigest"`
+	Status        int       `json:"status"`
+	Result        string    `json:"result"`
+	DurationMs    int64     `json:"durationMs"`
+	PrevHash      string    `json:"prevHash"`
+	Hash          string    `json:"hash"`
+}
+
+type AuditFilter struct {
+	Actor    string
+	App      string
+	Route    string
+	Method   string
+	Result   string
+	Since    time.Time
+	Until    time.Time
+	BeforeID int64
+	Limit    int
+}
+
+// ComputeHash returns the chain hash of e given the previous entry's hash.
+func (e *AuditEntry) ComputeHash(prev string) string {
+	fields := []string{
+		strconv.FormatInt(e.ID, 10),
+		e.Timestamp.UTC().Format(time.RFC3339Nano),
+		e.Actor,
+		e.Role,
+		e.AuthMethod,
+		e.SourceIP,
+		e.Method,
+		e.Route,
+		e.Path,
+		e.App,
+		e.RequestDigest,
+		strconv.Itoa(e.Status),
+		e.Result,
+		strconv.FormatInt(e.DurationMs, 10),
+		prev,
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x1f")))
+	return hex.EncodeToString(sum[:])
+}
+
+// AppendAudit links e to the current chain head and inserts it.
+func (db *DB) AppendAudit(ctx context.Context, e *AuditEntry) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, int64(auditChainLock)); err != nil {
+		return err
+	}
+	var lastID int64
+	var lastHash string
+	err = tx.QueryRow(ctx, `SELECT id, hash FROM audit_log ORDER BY id DESC LIMIT 1`).Scan(&lastID, &lastHash)
+	if err != nil && err != pgx.ErrNoRows {
+		return err
+	}
+
+	e.ID = lastID + 1
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	// Postgres keeps microseconds; hash what will be read back.
+	e.Timestamp = e.Timestamp.UTC().Truncate(time.Microsecond)
+	e.PrevHash = lastHash
+	e.Hash = e.ComputeHash(lastHash)
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO audit_log (id, ts, actor, role, auth_method, source_ip, method, route, path, app, request_digest, status, result, duration_ms, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+	`, e.ID, e.Timestamp, e.Actor, e.Role, e.AuthMethod, e.SourceIP, e.Method, e.Route, e.Path, e.App, e.RequestDigest, e.Status, e.Result, e.DurationMs, e.PrevHash, e.Hash); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ListAudit returns matching entries, newest first.
+func (db *DB) ListAudit(ctx context.Context, f AuditFilter) ([]AuditEntry, error) {
+	where := []string{"TRUE"}
+	var args []interface{}
+	add := func(clause string, v interface{}) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(clause, len(args)))
+	}
+	if f.Actor != "" {
+		add("actor = $%d", f.Actor)
+	}
+	if f.App != "" {
+		add("app = $%d", f.App)
+	}
+	if f.Route != "" {
+		add("route LIKE $%d", "%"+f.Route+"%")
+	}
+	if f.Method != "" {
+		add("method = $%d", strings.ToUpper(f.Method))
+	}
+	if f.Result != "" {
+		add("result = $%d", f.Result)
+	}
+	if !f.Since.IsZero() {
+		add("ts >= $%d", f.Since)
+	}
+	if !f.Until.IsZero() {
+		add("ts < $%d", f.Until)
+	}
+	if f.BeforeID > 0 {
+		add("id < $%d", f.BeforeID)
+	}
+	limit := f.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	args = append(args, limit)
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, ts, actor, role, auth_method, source_ip, method, route, path, app, request_digest, status, result, duration_ms, prev_hash, hash
+		FROM audit_log
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY id DESC
+		LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanAuditRows(rows)
+}
+
+// AuditVerification is the outcome of re-walking the hash chain.
+type AuditVerification struct {
+	OK       bool   `json:"ok"`
+	Checked  int64  `json:"checked"`
+	BrokenAt int64  `json:"brokenAt,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// VerifyAudit recomputes the whole chain in id order.
+func (db *DB) VerifyAudit(ctx context.Context) (*AuditVerification, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, ts, actor, role, auth_method, source_ip, method, route, path, app, request_digest, status, result, duration_ms, prev_hash, hash
+		FROM audit_log
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	v := &AuditVerifier{}
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		if !v.Add(e) {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return v.Result(), nil
+}
+
+// AuditVerifier checks entries fed to it in id order.
+type AuditVerifier struct {
+	checked  int64
+	lastID   int64
+	lastHash string
+	broken   *AuditVerification
+}
+
+// Add checks one entry and reports whether the chain is still intact.
+func (v *AuditVerifier) Add(e *AuditEntry) bool {
+	if v.broken != nil {
+		return false
+	}
+	fail := func(reason string) bool {
+		v.broken = &AuditVerification{Checked: v.checked, BrokenAt: e.ID, Reason: reason}
+		return false
+	}
+	switch {
+	case e.ID != v.lastID+1:
+		return fail(fmt.Sprintf("expected entry %d, found %d (entries removed)", v.lastID+1, e.ID))
+	case e.PrevHash != v.lastHash:
+		return fail("prevHash does not match the previous entry")
+	case e.ComputeHash(e.PrevHash) != e.Hash:
+		return fail("hash does not match entry contents")
+	}
+	v.checked++
+	v.lastID = e.ID
+	v.lastHash = e.Hash
+	return true
+}
+
+func (v *AuditVerifier) Result() *AuditVerification {
+	if v.broken != nil {
+		return v.broken
+	}
+	return &AuditVerification{OK: true, Checked: v.checked}
+}
+
+func scanAuditRows(rows pgx.Rows) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+	return entries, rows.Err()
+}
+
+func scanAuditEntry(row beaconScanner) (*AuditEntry, error) {
+	var e AuditEntry
+	if err := row.Scan(&e.ID, &e.Timestamp, &e.Actor, &e.Role, &e.AuthMethod, &e.SourceIP, &e.Method, &e.Route, &e.Path, &e.App, &e.RequestDigest, &e.Status, &e.Result, &e.DurationMs, &e.PrevHash, &e.Hash); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
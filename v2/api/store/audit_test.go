@@ -0,0 +1,67 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func auditChain(n int) []*AuditEntry {
+	var entries []*AuditEntry
+	prev := ""
+	for i := 1; i <= n; i++ {
+		e := &AuditEntry{
+			ID:        int64(i),
+			Timestamp: time.Date(2026, 5, 1, 12, 0, i, 0, time.UTC),
+			Actor:     "alice",
+			Method:    "POST",
+			Route:     "/api/apps/{id}/restart",
+			Path:      "/api/apps/web/restart",
+			App:       "web",
+			Status:    200,
+			Result:    "ok",
+			PrevHash:  prev,
+		}
+		e.Hash = e.ComputeHash(prev)
+		prev = e.Hash
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func verifyEntries(entries []*AuditEntry) *AuditVerification {
+	v := &AuditVerifier{}
+	for _, e := range entries {
+		if !v.Add(e) {
+			break
+		}
+	}
+	return v.Result()
+}
+
+func TestAuditVerifierAcceptsIntactChain(t *testing.T) {
+	result := verifyEntries(auditChain(4))
+	if !result.OK || result.Checked != 4 {
+		t.Fatalf("result = %+v, want ok with 4 checked", result)
+	}
+}
+
+func TestAuditVerifierDetectsTampering(t *testing.T) {
+	edited := auditChain(4)
+	edited[1].Actor = "mallory"
+	if result := verifyEntries(edited); result.OK || result.BrokenAt != 2 {
+		t.Fatalf("edited: result = %+v, want broken at 2", result)
+	}
+
+	rehashed := auditChain(4)
+	rehashed[1].Actor = "mallory"
+	rehashed[1].Hash = rehashed[1].ComputeHash(rehashed[1].PrevHash)
+	if result := verifyEntries(rehashed); result.OK || result.BrokenAt != 3 {
+		t.Fatalf("rehashed: result = %+v, want broken at 3", result)
+	}
+
+	chain := auditChain(4)
+	deleted := append([]*AuditEntry{chain[0]}, chain[2:]...)
+	if result := verifyEntries(deleted); result.OK || result.BrokenAt != 3 {
+		t.Fatalf("deleted: result = %+v, want broken at 3", result)
+	}
+}
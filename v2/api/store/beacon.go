@@ -159,6 +159,46 @@ func (db *DB) ListOpenBeaconEvents(ctx context.Context, app string, limit int) (
 	return events, nil
 }
 
+// ListBeaconEventsAfter returns up to limit of the newest events after the
+// position (after, afterID), ordered by occurred_at then ID, optionally only
+// for some apps. The event stream replays from it.
+func (db *DB) ListBeaconEventsAfter(ctx context.Context, after time.Time, afterID string, apps []string, limit int) ([]model.BeaconEvent, error) {
+	where := "(occurred_at, id) > ($1, $2)"
+	args := []interface{}{after, afterID}
+	if len(apps) > 0 {
+		args = append(args, apps)
+		where += fmt.Sprintf(" AND app = ANY($%d)", len(args))
+	}
+	args = append(args, limit)
+
+	rows, err := db.Pool.Query(ctx, fmt.Sprintf(`
+		SELECT id, source, app, environment, type, severity, title, body,
+		       dedupe_key, occurred_at, acknowledged_at, acknowledged_by,
+		       acknowledgement_note, snoozed_until, metadata
+		FROM beacon_events
+		WHERE %s
+		ORDER BY occurred_at DESC, id DESC
+		LIMIT $%d
+	`, where, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []model.BeaconEvent
+	for rows.Next() {
+		event, err := scanBeaconEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
 func (db *DB) GetBeaconEvent(ctx context.Context, id string) (*model.BeaconEvent, error) {
 	row := db.Pool.QueryRow(ctx, `
 		SELECT id, source, app, environment, type, severity, title, body,
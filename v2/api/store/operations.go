@@ -102,6 +102,36 @@ func (db *DB) RetryOperation(ctx context.Context, id, message, lastError string,
 	return err
 }
 
+// UpdateOperationMetadata merges metadata into a running operation's, so
+// progress survives a crash or retry.
+func (db *DB) UpdateOperationMetadata(ctx context.Context, id string, metadata map[string]interface{}) error {
+	data, _ := json.Marshal(metadata)
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE operations
+		SET metadata = metadata || $1::jsonb, updated_at = now()
+		WHERE id = $2
+	`, data, id)
+	return err
+}
+
+// RequeueOperation queues a finished operation again with fresh attempts.
+// Its metadata is kept so the operation can resume where it stopped.
+func (db *DB) RequeueOperation(ctx context.Context, id, message string) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE operations
+		SET status = 'queued',
+		    message = $1,
+		    attempts = 0,
+		    next_attempt_at = now(),
+		    locked_by = '',
+		    locked_until = NULL,
+		    finished_at = NULL,
+		    updated_at = now()
+		WHERE id = $2 AND status NOT IN ('queued', 'running')
+	`, message, id)
+	return err
+}
+
 func (db *DB) ClaimNextOperation(ctx context.Context, workerID string, lease time.Duration, kinds []string) (*model.Operation, error) {
 	args := []interface{}{workerID, time.Now().Add(lease)}
 	kindClause := ""
@@ -138,7 +168,45 @@ func (db *DB) ClaimNextOperation(ctx context.Context, workerID string, lease tim
 		          o.attempts, o.max_attempts, o.locked_by, o.locked_until, o.next_attempt_at, o.last_error,
 		          o.started_at, o.updated_at, o.finished_at
 	`, kindClause)
+	return db.claimOperation(ctx, query, args...)
+}
+
+// ClaimOperation claims the queued operation id for workerID, the way
+// ClaimNextOperation would. It returns nil when the operation is no longer
+// claimable, e.g. because another worker got to it first.
+func (db *DB) ClaimOperation(ctx context.Context, id, workerID string, lease time.Duration) (*model.Operation, error) {
+	return db.claimOperation(ctx, `
+		UPDATE operations o
+		SET status = 'running',
+		    attempts = attempts + 1,
+		    locked_by = $2,
+		    locked_until = $3,
+		    updated_at = now()
+		WHERE o.id = $1
+		  AND o.status = 'queued'
+		  AND o.attempts < o.max_attempts
+		  AND (o.locked_until IS NULL OR o.locked_until < now())
+		RETURNING o.id, o.kind, o.app, o.saga_id, o.ref, o.status, o.risk, o.source, o.message, o.payload, o.metadata,
+		          o.attempts, o.max_attempts, o.locked_by, o.locked_until, o.next_attempt_at, o.last_error,
+		          o.started_at, o.updated_at, o.finished_at
+	`, id, workerID, time.Now().Add(lease))
+}
+
+// RenewOperationLease extends workerID's lease on the running operation id.
+// It reports false when workerID no longer holds the operation.
+func (db *DB) RenewOperationLease(ctx context.Context, id, workerID string, lease time.Duration) (bool, error) {
+	tag, err := db.Pool.Exec(ctx, `
+		UPDATE operations
+		SET locked_until = $3, updated_at = now()
+		WHERE id = $1 AND locked_by = $2 AND status = 'running'
+	`, id, workerID, time.Now().Add(lease))
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
 
+func (db *DB) claimOperation(ctx context.Context, query string, args ...interface{}) (*model.Operation, error) {
 	var op model.Operation
 	var payload, metadata []byte
 	err := db.Pool.QueryRow(ctx, query, args...).Scan(
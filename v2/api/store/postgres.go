@@ -49,6 +49,7 @@ func Migrate(db *DB) error {
 		);
 		CREATE INDEX IF NOT EXISTS idx_saga_saga_id ON saga_events(saga_id, timestamp);
 		CREATE INDEX IF NOT EXISTS idx_saga_app ON saga_events(app, timestamp DESC);
+		ALTER TABLE saga_events ADD COLUMN IF NOT EXISTS actor TEXT NOT NULL DEFAULT '';
 
 		CREATE TABLE IF NOT EXISTS deployments (
 			id          TEXT PRIMARY KEY,
@@ -70,6 +71,9 @@ func Migrate(db *DB) error {
 		ALTER TABLE deployments ADD COLUMN IF NOT EXISTS source_ref TEXT NOT NULL DEFAULT '';
 		ALTER TABLE deployments ADD COLUMN IF NOT EXISTS source_dirty BOOLEAN NOT NULL DEFAULT false;
 		ALTER TABLE deployments ADD COLUMN IF NOT EXISTS source_changes JSONB NOT NULL DEFAULT '[]';
+		ALTER TABLE deployments ADD COLUMN IF NOT EXISTS environment TEXT NOT NULL DEFAULT '';
+		ALTER TABLE deployments ADD COLUMN IF NOT EXISTS promoted_from TEXT NOT NULL DEFAULT '';
+		CREATE INDEX IF NOT EXISTS idx_deployments_app_env ON deployments(app, environment, started_at DESC);
 
 		CREATE TABLE IF NOT EXISTS deployment_steps (
 			deployment_id TEXT NOT NULL,
@@ -220,6 +224,70 @@ func Migrate(db *DB) error {
 		CREATE INDEX IF NOT EXISTS idx_access_grants_ip ON access_grants(ip, expires_at);
 		CREATE INDEX IF NOT EXISTS idx_access_grants_expires ON access_grants(expires_at);
 
+		CREATE TABLE IF NOT EXISTS users (
+			name       TEXT PRIMARY KEY,
+			email      TEXT NOT NULL DEFAULT '',
+			role       TEXT NOT NULL DEFAULT 'viewer',
+			disabled   BOOLEAN NOT NULL DEFAULT false,
+			created_by TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE INDEX IF NOT EXISTS idx_users_email ON users(lower(email));
+
+		CREATE TABLE IF NOT EXISTS api_tokens (
+			id           TEXT PRIMARY KEY,
+			user_name    TEXT NOT NULL REFERENCES users(name) ON DELETE CASCADE,
+			name         TEXT NOT NULL DEFAULT '',
+			role         TEXT NOT NULL,
+			apps         JSONB NOT NULL DEFAULT '[]',
+			token_hash   TEXT NOT NULL UNIQUE,
+			created_by   TEXT NOT NULL DEFAULT '',
+			created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+			expires_at   TIMESTAMPTZ,
+			last_used_at TIMESTAMPTZ,
+			revoked_at   TIMESTAMPTZ
+		);
+		CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_name, created_at DESC);
+
+		CREATE TABLE IF NOT EXISTS revoked_signed_tokens (
+			jti        TEXT PRIMARY KEY,
+			revoked_by TEXT NOT NULL DEFAULT '',
+			revoked_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id             BIGINT PRIMARY KEY,
+			ts             TIMESTAMPTZ NOT NULL,
+			actor          TEXT NOT NULL DEFAULT '',
+			role           TEXT NOT NULL DEFAULT '',
+			auth_method    TEXT NOT NULL DEFAULT '',
+			source_ip      TEXT NOT NULL DEFAULT '',
+			method         TEXT NOT NULL,
+			route          TEXT NOT NULL DEFAULT '',
+			path           TEXT NOT NULL,
+			app            TEXT NOT NULL DEFAULT '',
+			request_digest TEXT NOT NULL DEFAULT '',
+			status         INT NOT NULL DEFAULT 0,
+			result         TEXT NOT NULL DEFAULT '',
+			duration_ms    BIGINT NOT NULL DEFAULT 0,
+			prev_hash      TEXT NOT NULL DEFAULT '',
+			hash           TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_ts ON audit_log(ts DESC);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor, id DESC);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_app ON audit_log(app, id DESC);
+		CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_log is append-only';
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+		CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+			FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+		DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+		CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+			FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
 		CREATE TABLE IF NOT EXISTS access_observation_buckets (
 			app            TEXT NOT NULL,
 			process        TEXT NOT NULL DEFAULT '',
@@ -236,16 +304,91 @@ func Migrate(db *DB) error {
 		);
 		CREATE INDEX IF NOT EXISTS idx_access_observation_app_last ON access_observation_buckets(app, process, last_seen DESC);
 		CREATE INDEX IF NOT EXISTS idx_access_observation_bucket ON access_observation_buckets(bucket_start DESC);
+
+		CREATE TABLE IF NOT EXISTS previews (
+			app           TEXT NOT NULL,
+			number        INT NOT NULL,
+			provider      TEXT NOT NULL,
+			repository    TEXT NOT NULL DEFAULT '',
+			branch        TEXT NOT NULL DEFAULT '',
+			head_sha      TEXT NOT NULL DEFAULT '',
+			title         TEXT NOT NULL DEFAULT '',
+			pull_url      TEXT NOT NULL DEFAULT '',
+			job_id        TEXT NOT NULL,
+			hostname      TEXT NOT NULL DEFAULT '',
+			database_name TEXT NOT NULL DEFAULT '',
+			status        TEXT NOT NULL,
+			reason        TEXT NOT NULL DEFAULT '',
+			deployment_id TEXT NOT NULL DEFAULT '',
+			saga_id       TEXT NOT NULL DEFAULT '',
+			expires_at    TIMESTAMPTZ NOT NULL,
+			ready_at      TIMESTAMPTZ,
+			closed_at     TIMESTAMPTZ,
+			created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+			updated_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (app, number)
+		);
+		CREATE INDEX IF NOT EXISTS idx_previews_status_expires ON previews(status, expires_at);
+
+		CREATE TABLE IF NOT EXISTS wake_events (
+			id          BIGSERIAL PRIMARY KEY,
+			app         TEXT NOT NULL,
+			process     TEXT NOT NULL,
+			action      TEXT NOT NULL,
+			reason      TEXT NOT NULL DEFAULT '',
+			actor       TEXT NOT NULL DEFAULT '',
+			duration_ms BIGINT NOT NULL DEFAULT 0,
+			created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE INDEX IF NOT EXISTS idx_wake_events_app_process ON wake_events(app, process, created_at DESC);
+
+		CREATE TABLE IF NOT EXISTS tuning_changes (
+			id            BIGSERIAL PRIMARY KEY,
+			app           TEXT NOT NULL,
+			process       TEXT NOT NULL,
+			from_cpu      INTEGER NOT NULL,
+			from_memory   INTEGER NOT NULL,
+			to_cpu        INTEGER NOT NULL,
+			to_memory     INTEGER NOT NULL,
+			reason        TEXT NOT NULL DEFAULT '',
+			patch         TEXT NOT NULL DEFAULT '',
+			status        TEXT NOT NULL,
+			status_reason TEXT NOT NULL DEFAULT '',
+			saga_id       TEXT NOT NULL DEFAULT '',
+			created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+			settled_at    TIMESTAMPTZ
+		);
+		CREATE INDEX IF NOT EXISTS idx_tuning_changes_app_process ON tuning_changes(app, process, created_at DESC);
+
+		CREATE TABLE IF NOT EXISTS secret_versions (
+			id            BIGSERIAL PRIMARY KEY,
+			app           TEXT NOT NULL,
+			environment   TEXT NOT NULL DEFAULT '',
+			version       INTEGER NOT NULL,
+			backend       TEXT NOT NULL,
+			action        TEXT NOT NULL,
+			actor         TEXT NOT NULL DEFAULT '',
+			keys          JSONB NOT NULL DEFAULT '[]',
+			added         JSONB NOT NULL DEFAULT '[]',
+			changed       JSONB NOT NULL DEFAULT '[]',
+			removed       JSONB NOT NULL DEFAULT '[]',
+			restored_from INTEGER NOT NULL DEFAULT 0,
+			snapshot      BYTEA,
+			created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+			UNIQUE (app, environment, version)
+		);
 	`)
 	return err
 }
 
+const deploymentColumns = `id, app, environment, commit_sha, image_tag, saga_id, status, source_kind, source_ref, source_dirty, source_changes, promoted_from, started_at, finished_at`
+
 func (db *DB) InsertDeployment(ctx context.Context, d *model.Deployment) error {
 	changes, _ := json.Marshal(d.SourceChanges)
 	_, err := db.Pool.Exec(ctx,
-		`INSERT INTO deployments (id, app, commit_sha, image_tag, saga_id, status, source_kind, source_ref, source_dirty, source_changes, started_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
-		d.ID, d.App, d.CommitSHA, d.ImageTag, d.SagaID, d.Status, d.SourceKind, d.SourceRef, d.SourceDirty, changes, d.StartedAt,
+		`INSERT INTO deployments (id, app, environment, commit_sha, image_tag, saga_id, status, source_kind, source_ref, source_dirty, source_changes, promoted_from, started_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		d.ID, d.App, d.Environment, d.CommitSHA, d.ImageTag, d.SagaID, d.Status, d.SourceKind, d.SourceRef, d.SourceDirty, changes, d.PromotedFrom, d.StartedAt,
 	)
 	return err
 }
@@ -283,7 +426,7 @@ func (db *DB) ListDeployments(ctx context.Context, app string, limit int) ([]mod
 	if limit <= 0 {
 		limit = 20
 	}
-	query := `SELECT id, app, commit_sha, image_tag, saga_id, status, source_kind, source_ref, source_dirty, source_changes, started_at, finished_at
+	query := `SELECT ` + deploymentColumns + `
 		 FROM deployments`
 	args := []interface{}{}
 	if app != "" {
@@ -302,44 +445,53 @@ func (db *DB) ListDeployments(ctx context.Context, app string, limit int) ([]mod
 
 	var deployments []model.Deployment
 	for rows.Next() {
-		var d model.Deployment
-		var changes []byte
-		if err := rows.Scan(&d.ID, &d.App, &d.CommitSHA, &d.ImageTag, &d.SagaID, &d.Status, &d.SourceKind, &d.SourceRef, &d.SourceDirty, &changes, &d.StartedAt, &d.FinishedAt); err != nil {
+		d, err := scanDeployment(rows)
+		if err != nil {
 			return nil, err
 		}
-		_ = json.Unmarshal(changes, &d.SourceChanges)
-		deployments = append(deployments, d)
+		deployments = append(deployments, *d)
 	}
 	return deployments, nil
 }
 
 func (db *DB) GetDeployment(ctx context.Context, id string) (*model.Deployment, error) {
-	var d model.Deployment
-	var changes []byte
-	err := db.Pool.QueryRow(ctx,
-		`SELECT id, app, commit_sha, image_tag, saga_id, status, source_kind, source_ref, source_dirty, source_changes, started_at, finished_at
+	return scanDeployment(db.Pool.QueryRow(ctx,
+		`SELECT `+deploymentColumns+`
 		 FROM deployments
 		 WHERE id = $1`,
 		id,
-	).Scan(&d.ID, &d.App, &d.CommitSHA, &d.ImageTag, &d.SagaID, &d.Status, &d.SourceKind, &d.SourceRef, &d.SourceDirty, &changes, &d.StartedAt, &d.FinishedAt)
-	if err != nil {
-		return nil, err
-	}
-	_ = json.Unmarshal(changes, &d.SourceChanges)
-	return &d, nil
+	))
 }
 
-func (db *DB) LastSuccessfulDeployment(ctx context.Context, app, excludeID string) (*model.Deployment, error) {
-	var d model.Deployment
-	var changes []byte
-	err := db.Pool.QueryRow(ctx,
-		`SELECT id, app, commit_sha, image_tag, saga_id, status, source_kind, source_ref, source_dirty, source_changes, started_at, finished_at
+// LastSuccessfulDeployment returns the newest deployed deployment of app in
+// any of the given environments ("" outside named environments); see
+// InfraSpec.HistoryEnvironments.
+func (db *DB) LastSuccessfulDeployment(ctx context.Context, app string, environments []string, excludeID string) (*model.Deployment, error) {
+	return scanDeployment(db.Pool.QueryRow(ctx,
+		`SELECT `+deploymentColumns+`
 		 FROM deployments
-		 WHERE app = $1 AND status = 'deployed' AND id != $2
+		 WHERE app = $1 AND environment = ANY($2) AND status = 'deployed' AND id != $3
 		 ORDER BY started_at DESC LIMIT 1`,
-		app, excludeID,
-	).Scan(&d.ID, &d.App, &d.CommitSHA, &d.ImageTag, &d.SagaID, &d.Status, &d.SourceKind, &d.SourceRef, &d.SourceDirty, &changes, &d.StartedAt, &d.FinishedAt)
-	if err != nil {
+		app, environments, excludeID,
+	))
+}
+
+// LatestDeployment returns the newest deployment of app in any of the given
+// environments, whatever its status.
+func (db *DB) LatestDeployment(ctx context.Context, app string, environments []string) (*model.Deployment, error) {
+	return scanDeployment(db.Pool.QueryRow(ctx,
+		`SELECT `+deploymentColumns+`
+		 FROM deployments
+		 WHERE app = $1 AND environment = ANY($2)
+		 ORDER BY started_at DESC LIMIT 1`,
+		app, environments,
+	))
+}
+
+func scanDeployment(row beaconScanner) (*model.Deployment, error) {
+	var d model.Deployment
+	var changes []byte
+	if err := row.Scan(&d.ID, &d.App, &d.Environment, &d.CommitSHA, &d.ImageTag, &d.SagaID, &d.Status, &d.SourceKind, &d.SourceRef, &d.SourceDirty, &changes, &d.PromotedFrom, &d.StartedAt, &d.FinishedAt); err != nil {
 		return nil, err
 	}
 	_ = json.Unmarshal(changes, &d.SourceChanges)
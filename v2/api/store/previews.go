@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"norn/v2/api/model"
+)
+
+const previewColumns = `app, number, provider, repository, branch, head_sha, title, pull_url, job_id, hostname, database_name,
+	status, reason, deployment_id, saga_id, expires_at, ready_at, closed_at, created_at, updated_at`
+
+func scanPreview(row beaconScanner) (*model.Preview, error) {
+	var p model.Preview
+	var status string
+	if err := row.Scan(&p.App, &p.Number, &p.Provider, &p.Repository, &p.Branch, &p.HeadSHA, &p.Title, &p.PullURL, &p.JobID, &p.Hostname, &p.Database,
+		&status, &p.Reason, &p.DeploymentID, &p.SagaID, &p.ExpiresAt, &p.ReadyAt, &p.ClosedAt, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	p.Status = model.PreviewStatus(status)
+	return &p, nil
+}
+
+// UpsertPreview records a pull request's preview, reopening it if it was
+// closed. ReadyAt survives redeploys so the preview URL is announced once.
+func (db *DB) UpsertPreview(ctx context.Context, p *model.Preview) error {
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO previews (app, number, provider, repository, branch, head_sha, title, pull_url, job_id, hostname, database_name,
+			status, reason, deployment_id, saga_id, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, now(), now())
+		ON CONFLICT (app, number) DO UPDATE SET
+			provider = EXCLUDED.provider, repository = EXCLUDED.repository, branch = EXCLUDED.branch,
+			head_sha = EXCLUDED.head_sha, title = EXCLUDED.title, pull_url = EXCLUDED.pull_url,
+			job_id = EXCLUDED.job_id, hostname = EXCLUDED.hostname, database_name = EXCLUDED.database_name,
+			status = EXCLUDED.status, reason = EXCLUDED.reason, deployment_id = EXCLUDED.deployment_id,
+			saga_id = EXCLUDED.saga_id, expires_at = EXCLUDED.expires_at, closed_at = NULL, updated_at = now()
+	`, p.App, p.Number, p.Provider, p.Repository, p.Branch, p.HeadSHA, p.Title, p.PullURL, p.JobID, p.Hostname, p.Database,
+		string(p.Status), p.Reason, p.DeploymentID, p.SagaID, p.ExpiresAt)
+	return err
+}
+
+// GetPreview returns nil when app has no preview for number.
+func (db *DB) GetPreview(ctx context.Context, app string, number int) (*model.Preview, error) {
+	p, err := scanPreview(db.Pool.QueryRow(ctx, `SELECT `+previewColumns+` FROM previews WHERE app = $1 AND number = $2`, app, number))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+// SetPreviewStatus moves a preview to status, stamping ready_at the first
+// time it becomes ready and closed_at when it closes.
+func (db *DB) SetPreviewStatus(ctx context.Context, app string, number int, status model.PreviewStatus, reason string) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE previews
+		SET status = $3, reason = $4, updated_at = now(),
+		    ready_at = CASE WHEN $3 = 'ready' THEN COALESCE(ready_at, now()) ELSE ready_at END,
+		    closed_at = CASE WHEN $3 = 'closed' THEN now() ELSE closed_at END
+		WHERE app = $1 AND number = $2
+	`, app, number, string(status), reason)
+	return err
+}
+
+// ListPreviews returns previews newest first, optionally for one app and
+// without the closed ones.
+func (db *DB) ListPreviews(ctx context.Context, app string, includeClosed bool) ([]model.Preview, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+previewColumns+` FROM previews
+		WHERE ($1 = '' OR app = $1) AND ($2 OR status <> 'closed')
+		ORDER BY updated_at DESC
+		LIMIT 200
+	`, app, includeClosed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []model.Preview{}
+	for rows.Next() {
+		p, err := scanPreview(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *p)
+	}
+	return out, rows.Err()
+}
+
+// ExpiredPreviews returns open previews whose TTL ran out before now.
+func (db *DB) ExpiredPreviews(ctx context.Context, now time.Time) ([]model.Preview, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+previewColumns+` FROM previews
+		WHERE status IN ('deploying', 'ready', 'failed') AND expires_at < $1
+		ORDER BY expires_at
+	`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.Preview
+	for rows.Next() {
+		p, err := scanPreview(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *p)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v5"
+
+	"norn/v2/api/model"
+)
+
+const secretVersionColumns = `id, app, environment, version, backend, action, actor, keys, added, changed, removed, restored_from, snapshot, created_at`
+
+func scanSecretVersion(row beaconScanner) (*model.SecretVersion, error) {
+	var v model.SecretVersion
+	var keys, added, changed, removed []byte
+	if err := row.Scan(&v.ID, &v.App, &v.Environment, &v.Version, &v.Backend, &v.Action, &v.Actor,
+		&keys, &added, &changed, &removed, &v.RestoredFrom, &v.Snapshot, &v.CreatedAt); err != nil {
+		return nil, err
+	}
+	for _, f := range []struct {
+		raw []byte
+		dst *[]string
+	}{{keys, &v.Keys}, {added, &v.Added}, {changed, &v.Changed}, {removed, &v.Removed}} {
+		*f.dst = []string{}
+		if len(f.raw) > 0 {
+			_ = json.Unmarshal(f.raw, f.dst)
+		}
+	}
+	v.Restorable = len(v.Snapshot) > 0
+	return &v, nil
+}
+
+// RecordSecretVersion stores v as the next version of its app environment,
+// numbered after every version recorded under history (v.Environment and
+// any older names for it), filling in its ID, Version and CreatedAt.
+func (db *DB) RecordSecretVersion(ctx context.Context, v *model.SecretVersion, history []string) error {
+	keys, _ := json.Marshal(nonNil(v.Keys))
+	added, _ := json.Marshal(nonNil(v.Added))
+	changed, _ := json.Marshal(nonNil(v.Changed))
+	removed, _ := json.Marshal(nonNil(v.Removed))
+	// The unique index turns a concurrent writer taking the same number into
+	// an error rather than a duplicate.
+	return db.Pool.QueryRow(ctx, `
+		INSERT INTO secret_versions (app, environment, version, backend, action, actor, keys, added, changed, removed, restored_from, snapshot)
+		SELECT $1, $2, COALESCE(MAX(version), 0) + 1, $3, $4, $5, $6, $7, $8, $9, $10, $11
+		FROM secret_versions WHERE app = $1 AND environment = ANY($12)
+		RETURNING id, version, created_at
+	`, v.App, v.Environment, v.Backend, v.Action, v.Actor, keys, added, changed, removed, v.RestoredFrom, v.Snapshot, history).Scan(&v.ID, &v.Version, &v.CreatedAt)
+}
+
+// ListSecretVersions returns the newest secret versions recorded under any
+// of an app environment's names.
+func (db *DB) ListSecretVersions(ctx context.Context, app string, environments []string, limit int) ([]model.SecretVersion, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+secretVersionColumns+`
+		FROM secret_versions
+		WHERE app = $1 AND environment = ANY($2)
+		ORDER BY version DESC, environment DESC
+		LIMIT $3
+	`, app, environments, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.SecretVersion
+	for rows.Next() {
+		v, err := scanSecretVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *v)
+	}
+	return out, rows.Err()
+}
+
+// GetSecretVersion returns nil when the version does not exist. A number
+// recorded under more than one of the names resolves to the named
+// environment's version.
+func (db *DB) GetSecretVersion(ctx context.Context, app string, environments []string, version int) (*model.SecretVersion, error) {
+	v, err := scanSecretVersion(db.Pool.QueryRow(ctx, `
+		SELECT `+secretVersionColumns+`
+		FROM secret_versions
+		WHERE app = $1 AND environment = ANY($2) AND version = $3
+		ORDER BY environment DESC LIMIT 1
+	`, app, environments, version))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return v, err
+}
+
+// HasSecretVersions reports whether an app environment's history has started
+// under any of its names.
+func (db *DB) HasSecretVersions(ctx context.Context, app string, environments []string) (bool, error) {
+	var exists bool
+	err := db.Pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM secret_versions WHERE app = $1 AND environment = ANY($2))
+	`, app, environments).Scan(&exists)
+	return exists, err
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
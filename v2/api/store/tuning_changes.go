@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+
+	"norn/v2/api/model"
+)
+
+const tuningChangeColumns = `id, app, process, from_cpu, from_memory, to_cpu, to_memory, reason, patch, status, status_reason, saga_id, created_at, settled_at`
+
+func scanTuningChange(row beaconScanner) (*model.TuningChange, error) {
+	var c model.TuningChange
+	if err := row.Scan(&c.ID, &c.App, &c.Process, &c.FromCPU, &c.FromMemory, &c.ToCPU, &c.ToMemory,
+		&c.Reason, &c.Patch, &c.Status, &c.StatusReason, &c.SagaID, &c.CreatedAt, &c.SettledAt); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// RecordTuningChange stores c, filling in its ID and CreatedAt.
+func (db *DB) RecordTuningChange(ctx context.Context, c *model.TuningChange) error {
+	return db.Pool.QueryRow(ctx, `
+		INSERT INTO tuning_changes (app, process, from_cpu, from_memory, to_cpu, to_memory, reason, patch, status, saga_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at
+	`, c.App, c.Process, c.FromCPU, c.FromMemory, c.ToCPU, c.ToMemory, c.Reason, c.Patch, c.Status, c.SagaID).Scan(&c.ID, &c.CreatedAt)
+}
+
+// SettleTuningChange marks an applied change kept or reverted.
+func (db *DB) SettleTuningChange(ctx context.Context, id int64, status, reason string) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE tuning_changes SET status = $2, status_reason = $3, settled_at = now()
+		WHERE id = $1
+	`, id, status, reason)
+	return err
+}
+
+// ListTuningChanges returns the newest tuning changes, across all apps when
+// app is empty.
+func (db *DB) ListTuningChanges(ctx context.Context, app string, limit int) ([]model.TuningChange, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+tuningChangeColumns+`
+		FROM tuning_changes
+		WHERE ($1 = '' OR app = $1)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, app, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.TuningChange
+	for rows.Next() {
+		c, err := scanTuningChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *c)
+	}
+	return out, rows.Err()
+}
+
+// LatestTuningChange returns nil when the process has never been tuned.
+func (db *DB) LatestTuningChange(ctx context.Context, app, process string) (*model.TuningChange, error) {
+	c, err := scanTuningChange(db.Pool.QueryRow(ctx, `
+		SELECT `+tuningChangeColumns+`
+		FROM tuning_changes
+		WHERE app = $1 AND process = $2
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`, app, process))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return c, err
+}
@@ -0,0 +1,247 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type User struct {
+	Name      string    `json:"name"`
+	Email     string    `json:"email,omitempty"`
+	Role      string    `json:"role"`
+	Disabled  bool      `json:"disabled"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// APIToken is a personal API token. Only the hash of the secret is stored.
+type APIToken struct {
+	ID         string     `json:"id"`
+	User       string     `json:"user"`
+	Name       string     `json:"name"`
+	Role       string     `json:"role"`
+	Apps       []string   `json:"apps,omitempty"`
+	TokenHash  string     `json:"-"`
+	CreatedBy  string     `json:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+// TokenLookup is a live token joined with its owner.
+type TokenLookup struct {
+	Token    APIToken
+	UserRole string
+}
+
+func (db *DB) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT name, email, role, disabled, created_by, created_at
+		FROM users
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.Name, &u.Email, &u.Role, &u.Disabled, &u.CreatedBy, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// GetUser returns nil without error when the user does not exist.
+func (db *DB) GetUser(ctx context.Context, name string) (*User, error) {
+	var u User
+	err := db.Pool.QueryRow(ctx, `
+		SELECT name, email, role, disabled, created_by, created_at
+		FROM users WHERE name = $1
+	`, name).Scan(&u.Name, &u.Email, &u.Role, &u.Disabled, &u.CreatedBy, &u.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// UserByEmail resolves a Cloudflare Access email to its user, disabled or not.
+func (db *DB) UserByEmail(ctx context.Context, email string) (*User, error) {
+	var u User
+	err := db.Pool.QueryRow(ctx, `
+		SELECT name, email, role, disabled, created_by, created_at
+		FROM users WHERE lower(email) = lower($1)
+		ORDER BY disabled, name
+		LIMIT 1
+	`, email).Scan(&u.Name, &u.Email, &u.Role, &u.Disabled, &u.CreatedBy, &u.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (db *DB) UpsertUser(ctx context.Context, u *User) error {
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO users (name, email, role, disabled, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (name) DO UPDATE SET email = EXCLUDED.email, role = EXCLUDED.role, disabled = EXCLUDED.disabled
+	`, u.Name, u.Email, u.Role, u.Disabled, u.CreatedBy, u.CreatedAt)
+	return err
+}
+
+func (db *DB) InsertAPIToken(ctx context.Context, t *APIToken) error {
+	if t.ID == "" {
+		t.ID = fmt.Sprintf("tok_%d", time.Now().UnixNano())
+	}
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	apps, _ := json.Marshal(t.Apps)
+	if t.Apps == nil {
+		apps = []byte("[]")
+	}
+	_, err := db.Pool.Exec(ctx, `
+		INSERT INTO api_tokens (id, user_name, name, role, apps, token_hash, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, t.ID, t.User, t.Name, t.Role, apps, t.TokenHash, t.CreatedBy, t.CreatedAt, t.ExpiresAt)
+	return err
+}
+
+// ListAPITokens lists tokens, optionally for one user, newest first.
+func (db *DB) ListAPITokens(ctx context.Context, user string, includeRevoked bool) ([]APIToken, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, user_name, name, role, apps, created_by, created_at, expires_at, last_used_at, revoked_at
+		FROM api_tokens
+		WHERE ($1 = '' OR user_name = $1) AND ($2 OR revoked_at IS NULL)
+		ORDER BY created_at DESC
+	`, user, includeRevoked)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+func (db *DB) GetAPIToken(ctx context.Context, id string) (*APIToken, error) {
+	row := db.Pool.QueryRow(ctx, `
+		SELECT id, user_name, name, role, apps, created_by, created_at, expires_at, last_used_at, revoked_at
+		FROM api_tokens WHERE id = $1
+	`, id)
+	t, err := scanAPIToken(row)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return t, err
+}
+
+func (db *DB) RevokeAPIToken(ctx context.Context, id string) error {
+	tag, err := db.Pool.Exec(ctx, `UPDATE api_tokens SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("token %s not found or already revoked", id)
+	}
+	return nil
+}
+
+// LookupAPIToken resolves a token hash to a live token of an enabled user
+// and records its use.
+func (db *DB) LookupAPIToken(ctx context.Context, hash string) (*TokenLookup, error) {
+	row := db.Pool.QueryRow(ctx, `
+		UPDATE api_tokens t SET last_used_at = now()
+		FROM users u
+		WHERE t.token_hash = $1 AND u.name = t.user_name
+		  AND t.revoked_at IS NULL AND (t.expires_at IS NULL OR t.expires_at > now())
+		  AND NOT u.disabled
+		RETURNING t.id, t.user_name, t.name, t.role, t.apps, t.created_by, t.created_at, t.expires_at, t.last_used_at, t.revoked_at, u.role
+	`, hash)
+	var lookup TokenLookup
+	var apps []byte
+	t := &lookup.Token
+	err := row.Scan(&t.ID, &t.User, &t.Name, &t.Role, &apps, &t.CreatedBy, &t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt, &lookup.UserRole)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(apps) > 0 {
+		_ = json.Unmarshal(apps, &t.Apps)
+	}
+	return &lookup, nil
+}
+
+// HasPrincipals reports whether any user or API token has been created,
+// revoked tokens included.
+func (db *DB) HasPrincipals(ctx context.Context) (bool, error) {
+	var exists bool
+	err := db.Pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM users) OR EXISTS (SELECT 1 FROM api_tokens)
+	`).Scan(&exists)
+	return exists, err
+}
+
+// RevokeSignedToken revokes the signed access token with jti.
+func (db *DB) RevokeSignedToken(ctx context.Context, jti, by string) error {
+	tag, err := db.Pool.Exec(ctx, `
+		INSERT INTO revoked_signed_tokens (jti, revoked_by) VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING
+	`, jti, by)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("token %s already revoked", jti)
+	}
+	return nil
+}
+
+// SignedTokenRevoked reports whether the signed access token with jti has
+// been revoked.
+func (db *DB) SignedTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := db.Pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM revoked_signed_tokens WHERE jti = $1)
+	`, jti).Scan(&revoked)
+	return revoked, err
+}
+
+func scanAPIToken(row beaconScanner) (*APIToken, error) {
+	var t APIToken
+	var apps []byte
+	if err := row.Scan(&t.ID, &t.User, &t.Name, &t.Role, &apps, &t.CreatedBy, &t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt); err != nil {
+		return nil, err
+	}
+	if len(apps) > 0 {
+		_ = json.Unmarshal(apps, &t.Apps)
+	}
+	return &t, nil
+}
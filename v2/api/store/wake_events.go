@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"norn/v2/api/model"
+)
+
+const wakeEventColumns = `id, app, process, action, reason, actor, duration_ms, created_at`
+
+func scanWakeEvent(row beaconScanner) (*model.WakeEvent, error) {
+	var e model.WakeEvent
+	if err := row.Scan(&e.ID, &e.App, &e.Process, &e.Action, &e.Reason, &e.Actor, &e.DurationMs, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// RecordWakeEvent stores e, filling in its ID and CreatedAt.
+func (db *DB) RecordWakeEvent(ctx context.Context, e *model.WakeEvent) error {
+	return db.Pool.QueryRow(ctx, `
+		INSERT INTO wake_events (app, process, action, reason, actor, duration_ms)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`, e.App, e.Process, e.Action, e.Reason, e.Actor, e.DurationMs).Scan(&e.ID, &e.CreatedAt)
+}
+
+// ListWakeEvents returns the newest sleep and wake events since since,
+// across all apps when app is empty.
+func (db *DB) ListWakeEvents(ctx context.Context, app string, since time.Time, limit int) ([]model.WakeEvent, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+wakeEventColumns+`
+		FROM wake_events
+		WHERE ($1 = '' OR app = $1) AND created_at >= $2
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`, app, since.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.WakeEvent
+	for rows.Next() {
+		e, err := scanWakeEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *e)
+	}
+	return out, rows.Err()
+}
+
+// LatestWakeEvent returns nil when the process has never slept or woken.
+func (db *DB) LatestWakeEvent(ctx context.Context, app, process string) (*model.WakeEvent, error) {
+	e, err := scanWakeEvent(db.Pool.QueryRow(ctx, `
+		SELECT `+wakeEventColumns+`
+		FROM wake_events
+		WHERE app = $1 AND process = $2
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`, app, process))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return e, err
+}
@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"norn/v2/api/model"
+	"norn/v2/api/pipeline"
+	"norn/v2/api/saga"
+)
+
+// Autoscaler sizes processes with scaling.auto between their min and max
+// from CPU, memory, consumer lag or an app-exported metric.
+type Autoscaler struct {
+	pipeline *pipeline.Pipeline
+	poll     time.Duration
+	history  pipeline.AutoscaleHistory
+}
+
+func NewAutoscaler(p *pipeline.Pipeline) *Autoscaler {
+	return &Autoscaler{pipeline: p, poll: 30 * time.Second}
+}
+
+func (a *Autoscaler) Run(ctx context.Context) {
+	log.Println("autoscaler started")
+	timer := time.NewTimer(time.Minute)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("autoscaler stopped")
+			return
+		case <-timer.C:
+			a.scale(ctx)
+			timer.Reset(a.poll)
+		}
+	}
+}
+
+func (a *Autoscaler) scale(ctx context.Context) {
+	specs, err := model.DiscoverApps(a.pipeline.AppsDir)
+	if err != nil {
+		log.Printf("autoscaler: discover apps: %v", err)
+		return
+	}
+	ctx = saga.WithActor(ctx, "autoscaler")
+	now := time.Now()
+	for _, base := range specs {
+		names := base.EnvironmentNames()
+		if len(names) == 0 {
+			names = []string{""}
+		}
+		for _, name := range names {
+			spec, err := base.ForEnvironment(name)
+			if err != nil {
+				log.Printf("autoscaler: %s: %v", base.App, err)
+				continue
+			}
+			decisions, err := a.pipeline.Autoscale(ctx, spec, &a.history, now)
+			if err != nil {
+				log.Printf("autoscaler: %s: %v", spec.JobID(), err)
+			}
+			for _, d := range decisions {
+				log.Printf("autoscaler: scaled %s/%s %d → %d (%s %.2f, target %d)", spec.JobID(), d.Process, d.From, d.To, d.Metric, d.Observed, d.Target)
+			}
+		}
+	}
+}
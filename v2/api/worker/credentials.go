@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"norn/v2/api/model"
+	"norn/v2/api/pipeline"
+	"norn/v2/api/saga"
+)
+
+// CredentialRotator queues credential rotations for app environments whose
+// credentialRotation schedule has elapsed. A failed rotation is resumed on
+// the next due check.
+type CredentialRotator struct {
+	pipeline *pipeline.Pipeline
+	poll     time.Duration
+}
+
+func NewCredentialRotator(p *pipeline.Pipeline) *CredentialRotator {
+	return &CredentialRotator{pipeline: p, poll: time.Hour}
+}
+
+func (r *CredentialRotator) Run(ctx context.Context) {
+	log.Println("credential rotator started")
+	timer := time.NewTimer(5 * time.Minute)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("credential rotator stopped")
+			return
+		case <-timer.C:
+			r.rotate(ctx)
+			timer.Reset(r.poll)
+		}
+	}
+}
+
+func (r *CredentialRotator) rotate(ctx context.Context) {
+	specs, err := model.DiscoverApps(r.pipeline.AppsDir)
+	if err != nil {
+		log.Printf("credential rotator: discover apps: %v", err)
+		return
+	}
+	ctx = saga.WithActor(ctx, "credential-rotator")
+	now := time.Now()
+	for _, base := range specs {
+		if base.RotationInterval() == 0 {
+			continue
+		}
+		names := base.EnvironmentNames()
+		if len(names) == 0 {
+			names = []string{""}
+		}
+		for _, name := range names {
+			spec, err := base.ForEnvironment(name)
+			if err != nil {
+				log.Printf("credential rotator: %s: %v", base.App, err)
+				continue
+			}
+			last, err := r.pipeline.LatestRotation(ctx, spec)
+			if err != nil {
+				log.Printf("credential rotator: %s: %v", spec.JobID(), err)
+				continue
+			}
+			if !pipeline.RotationDue(spec, last, now) {
+				continue
+			}
+			op, resumed, err := r.pipeline.RotateCredentials(ctx, spec, nil, "schedule")
+			if err != nil {
+				log.Printf("credential rotator: %s: %v", spec.JobID(), err)
+				continue
+			}
+			if resumed {
+				log.Printf("credential rotator: resumed rotation %s of %s", op.ID, spec.JobID())
+			} else {
+				log.Printf("credential rotator: queued rotation %s of %s", op.ID, spec.JobID())
+			}
+		}
+	}
+}
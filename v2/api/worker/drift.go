@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"norn/v2/api/model"
+	"norn/v2/api/pipeline"
+	"norn/v2/api/saga"
+)
+
+// DriftReconciler periodically compares every discovered app environment
+// with its running Nomad job.
+type DriftReconciler struct {
+	pipeline *pipeline.Pipeline
+	poll     time.Duration
+}
+
+func NewDriftReconciler(p *pipeline.Pipeline, poll time.Duration) *DriftReconciler {
+	if poll <= 0 {
+		poll = 10 * time.Minute
+	}
+	return &DriftReconciler{pipeline: p, poll: poll}
+}
+
+func (r *DriftReconciler) Run(ctx context.Context) {
+	log.Printf("drift reconciler started (every %s)", r.poll)
+	timer := time.NewTimer(2 * time.Minute)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("drift reconciler stopped")
+			return
+		case <-timer.C:
+			r.reconcile(ctx)
+			timer.Reset(r.poll)
+		}
+	}
+}
+
+func (r *DriftReconciler) reconcile(ctx context.Context) {
+	specs, err := model.DiscoverApps(r.pipeline.AppsDir)
+	if err != nil {
+		log.Printf("drift reconciler: discover apps: %v", err)
+		return
+	}
+	ctx = saga.WithActor(ctx, "drift-reconciler")
+	for _, base := range specs {
+		names := base.EnvironmentNames()
+		if len(names) == 0 {
+			names = []string{""}
+		}
+		for _, name := range names {
+			spec, err := base.ForEnvironment(name)
+			if err != nil {
+				log.Printf("drift reconciler: %s: %v", base.App, err)
+				continue
+			}
+			report, err := r.pipeline.Reconcile(ctx, spec)
+			if err != nil {
+				log.Printf("drift reconciler: %s: %v", spec.JobID(), err)
+				continue
+			}
+			switch {
+			case report.Applied:
+				log.Printf("drift reconciler: resubmitted %s (%d changes)", report.JobID, len(report.JobChanges()))
+			case report.Status == model.DriftDrifted:
+				log.Printf("drift reconciler: %s drifted (%d changes) %s", report.JobID, len(report.Changes), report.Skipped)
+			}
+		}
+	}
+}
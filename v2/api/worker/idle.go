@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"norn/v2/api/model"
+	"norn/v2/api/pipeline"
+	"norn/v2/api/saga"
+)
+
+// IdleReaper scales scale-to-zero processes down once they stop receiving
+// requests. The wake gateway scales them back up.
+type IdleReaper struct {
+	pipeline *pipeline.Pipeline
+	poll     time.Duration
+}
+
+func NewIdleReaper(p *pipeline.Pipeline) *IdleReaper {
+	return &IdleReaper{pipeline: p, poll: time.Minute}
+}
+
+func (r *IdleReaper) Run(ctx context.Context) {
+	log.Println("idle reaper started")
+	timer := time.NewTimer(time.Minute)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("idle reaper stopped")
+			return
+		case <-timer.C:
+			r.reap(ctx)
+			timer.Reset(r.poll)
+		}
+	}
+}
+
+func (r *IdleReaper) reap(ctx context.Context) {
+	specs, err := model.DiscoverApps(r.pipeline.AppsDir)
+	if err != nil {
+		log.Printf("idle reaper: discover apps: %v", err)
+		return
+	}
+	ctx = saga.WithActor(ctx, "idle-reaper")
+	now := time.Now()
+	for _, base := range specs {
+		// The wake gateway only routes to the default environment's job.
+		spec, err := base.ForEnvironment("")
+		if err != nil {
+			log.Printf("idle reaper: %s: %v", base.App, err)
+			continue
+		}
+		if !scalesToZero(spec) {
+			continue
+		}
+		slept, err := r.pipeline.SleepIdle(ctx, spec, now)
+		if err != nil {
+			log.Printf("idle reaper: %s: %v", spec.JobID(), err)
+		}
+		for _, e := range slept {
+			log.Printf("idle reaper: scaled %s/%s to 0 (%s)", spec.JobID(), e.Process, e.Reason)
+		}
+	}
+}
+
+func scalesToZero(spec *model.InfraSpec) bool {
+	for _, proc := range spec.Processes {
+		if proc.Scaling.ScalesToZero() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"norn/v2/api/pipeline"
+	"norn/v2/api/saga"
+	"norn/v2/api/store"
+)
+
+// PreviewReaper queues teardown of previews whose TTL has run out.
+type PreviewReaper struct {
+	db       *store.DB
+	pipeline *pipeline.Pipeline
+	poll     time.Duration
+}
+
+func NewPreviewReaper(db *store.DB, p *pipeline.Pipeline) *PreviewReaper {
+	return &PreviewReaper{db: db, pipeline: p, poll: 5 * time.Minute}
+}
+
+func (r *PreviewReaper) Run(ctx context.Context) {
+	log.Println("preview reaper started")
+	timer := time.NewTimer(30 * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("preview reaper stopped")
+			return
+		case <-timer.C:
+			r.reap(ctx)
+			timer.Reset(r.poll)
+		}
+	}
+}
+
+func (r *PreviewReaper) reap(ctx context.Context) {
+	expired, err := r.db.ExpiredPreviews(ctx, time.Now())
+	if err != nil {
+		log.Printf("preview reaper: %v", err)
+		return
+	}
+	ctx = saga.WithActor(ctx, "preview-reaper")
+	for i := range expired {
+		pr := &expired[i]
+		if _, err := r.pipeline.ClosePreview(ctx, pr, "expired"); err != nil {
+			log.Printf("preview reaper: %s #%d: %v", pr.App, pr.Number, err)
+			continue
+		}
+		log.Printf("preview reaper: queued teardown of %s (expired %s)", pr.JobID, pr.ExpiresAt.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"norn/v2/api/model"
+	"norn/v2/api/pipeline"
+	"norn/v2/api/saga"
+)
+
+// Tuner applies tuning recommendations to processes with tuning.mode auto
+// and reverts the ones that make a process OOM or fail health.
+type Tuner struct {
+	pipeline *pipeline.Pipeline
+	poll     time.Duration
+}
+
+func NewTuner(p *pipeline.Pipeline) *Tuner {
+	return &Tuner{pipeline: p, poll: time.Minute}
+}
+
+func (t *Tuner) Run(ctx context.Context) {
+	log.Println("tuner started")
+	timer := time.NewTimer(5 * time.Minute)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("tuner stopped")
+			return
+		case <-timer.C:
+			t.tune(ctx)
+			timer.Reset(t.poll)
+		}
+	}
+}
+
+func (t *Tuner) tune(ctx context.Context) {
+	specs, err := model.DiscoverApps(t.pipeline.AppsDir)
+	if err != nil {
+		log.Printf("tuner: discover apps: %v", err)
+		return
+	}
+	ctx = saga.WithActor(ctx, "tuner")
+	now := time.Now()
+	for _, base := range specs {
+		// Recommendations come from the default environment's job.
+		spec, err := base.ForEnvironment("")
+		if err != nil {
+			log.Printf("tuner: %s: %v", base.App, err)
+			continue
+		}
+		changes, err := t.pipeline.Tune(ctx, spec, now)
+		if err != nil {
+			log.Printf("tuner: %s: %v", spec.JobID(), err)
+		}
+		for _, c := range changes {
+			log.Printf("tuner: %s/%s cpu %d → %d MHz, memory %d → %d MB %s", spec.JobID(), c.Process, c.FromCPU, c.ToCPU, c.FromMemory, c.ToMemory, c.Status)
+		}
+	}
+}
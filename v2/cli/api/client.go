@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -50,6 +51,20 @@ type ServiceManifest struct {
 	NetworkMode string                  `json:"networkMode,omitempty"`
 	Contract    ServiceManifestContract `json:"contract"`
 	Services    []ServiceManifestEntry  `json:"services"`
+	Graph       ServiceGraph            `json:"graph"`
+}
+
+type ServiceGraph struct {
+	Edges []ServiceGraphEdge `json:"edges"`
+}
+
+type ServiceGraphEdge struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	LocalPort   int    `json:"localPort"`
+	Known       bool   `json:"known"`
+	Intention   string `json:"intention"`
+	Managed     bool   `json:"managed,omitempty"`
 }
 
 type ServiceManifestEntry struct {
@@ -213,6 +228,74 @@ type SecretMigrationItem struct {
 	Declared  bool   `json:"declared"`
 	Encrypted bool   `json:"encrypted"`
 	Action    string `json:"action"`
+	Source    string `json:"source,omitempty"`
+	Target    string `json:"target,omitempty"`
+}
+
+// SecretVersion is one recorded change to an app environment's secrets.
+type SecretVersion struct {
+	ID           int64    `json:"id"`
+	App          string   `json:"app"`
+	Environment  string   `json:"environment,omitempty"`
+	Version      int      `json:"version"`
+	Backend      string   `json:"backend"`
+	Action       string   `json:"action"`
+	Actor        string   `json:"actor"`
+	Keys         []string `json:"keys"`
+	Added        []string `json:"added"`
+	Changed      []string `json:"changed"`
+	Removed      []string `json:"removed"`
+	RestoredFrom int      `json:"restoredFrom,omitempty"`
+	Restorable   bool     `json:"restorable"`
+	CreatedAt    string   `json:"createdAt"`
+}
+
+// SecretVersionDiff compares the key sets of two secret versions.
+type SecretVersionDiff struct {
+	From           int      `json:"from"`
+	To             int      `json:"to"`
+	Added          []string `json:"added"`
+	Changed        []string `json:"changed"`
+	Removed        []string `json:"removed"`
+	ValuesCompared bool     `json:"valuesCompared"`
+}
+
+// SecretRollback reports a restored secrets version and, when asked, the
+// restart of the jobs that carry them.
+type SecretRollback struct {
+	Version      int            `json:"version"`
+	RestoredFrom int            `json:"restoredFrom"`
+	Added        []string       `json:"added"`
+	Changed      []string       `json:"changed"`
+	Removed      []string       `json:"removed"`
+	Restart      *SecretRestart `json:"restart,omitempty"`
+}
+
+type SecretRestart struct {
+	JobID   string `json:"jobId,omitempty"`
+	Applied bool   `json:"applied"`
+	Skipped string `json:"skipped,omitempty"`
+	SagaID  string `json:"sagaId,omitempty"`
+}
+
+// SecretsBackend names where an app's secrets live: a sops file, a Nomad
+// variable path or a Vault KV v2 path.
+type SecretsBackend struct {
+	Type  string `json:"type"`
+	Path  string `json:"path,omitempty"`
+	Mount string `json:"mount,omitempty"`
+}
+
+// SecretBackendMigration reports, by key, a copy of secrets between backends.
+type SecretBackendMigration struct {
+	App         string   `json:"app"`
+	From        string   `json:"from"`
+	To          string   `json:"to"`
+	DryRun      bool     `json:"dryRun"`
+	Copied      []string `json:"copied"`
+	Overwritten []string `json:"overwritten"`
+	Unchanged   []string `json:"unchanged"`
+	Conflicts   []string `json:"conflicts"`
 }
 
 type MigrationPlanApp struct {
@@ -238,6 +321,7 @@ type NetworkStatus struct {
 type Deployment struct {
 	ID            string   `json:"id"`
 	App           string   `json:"app"`
+	Environment   string   `json:"environment,omitempty"`
 	CommitSHA     string   `json:"commitSha"`
 	ImageTag      string   `json:"imageTag"`
 	SagaID        string   `json:"sagaId"`
@@ -246,9 +330,71 @@ type Deployment struct {
 	SourceRef     string   `json:"sourceRef,omitempty"`
 	SourceDirty   bool     `json:"sourceDirty,omitempty"`
 	SourceChanges []string `json:"sourceChanges,omitempty"`
+	PromotedFrom  string   `json:"promotedFrom,omitempty"`
 	StartedAt     string   `json:"startedAt"`
 }
 
+type Environment struct {
+	Name        string      `json:"name"`
+	Default     bool        `json:"default,omitempty"`
+	JobID       string      `json:"jobId"`
+	SecretsFile string      `json:"secretsFile"`
+	Current     *Deployment `json:"current,omitempty"`
+}
+
+type Preview struct {
+	App          string `json:"app"`
+	Number       int    `json:"number"`
+	Provider     string `json:"provider"`
+	Branch       string `json:"branch,omitempty"`
+	HeadSHA      string `json:"headSha,omitempty"`
+	Title        string `json:"title,omitempty"`
+	PullURL      string `json:"pullUrl,omitempty"`
+	JobID        string `json:"jobId"`
+	Hostname     string `json:"hostname,omitempty"`
+	Database     string `json:"database,omitempty"`
+	Status       string `json:"status"`
+	Reason       string `json:"reason,omitempty"`
+	DeploymentID string `json:"deploymentId,omitempty"`
+	SagaID       string `json:"sagaId,omitempty"`
+	ExpiresAt    string `json:"expiresAt"`
+	ReadyAt      string `json:"readyAt,omitempty"`
+	ClosedAt     string `json:"closedAt,omitempty"`
+	UpdatedAt    string `json:"updatedAt"`
+}
+
+type DriftChange struct {
+	Job      string `json:"job"`
+	Group    string `json:"group,omitempty"`
+	Field    string `json:"field"`
+	Change   string `json:"change"`
+	Desired  string `json:"desired,omitempty"`
+	Live     string `json:"live,omitempty"`
+	Image    bool   `json:"image,omitempty"`
+	Endpoint bool   `json:"endpoint,omitempty"`
+}
+
+type DriftReport struct {
+	App         string        `json:"app"`
+	Environment string        `json:"environment,omitempty"`
+	JobID       string        `json:"jobId"`
+	Status      string        `json:"status"`
+	Image       string        `json:"image,omitempty"`
+	Changes     []DriftChange `json:"changes"`
+	CheckedAt   string        `json:"checkedAt"`
+	Applied     bool          `json:"applied,omitempty"`
+	SagaID      string        `json:"sagaId,omitempty"`
+	Skipped     string        `json:"skipped,omitempty"`
+}
+
+type Promotion struct {
+	SagaID             string `json:"sagaId"`
+	DeploymentID       string `json:"deploymentId"`
+	SourceDeploymentID string `json:"sourceDeploymentId"`
+	ImageTag           string `json:"imageTag"`
+	CommitSHA          string `json:"commitSha"`
+}
+
 type DeploymentStep struct {
 	DeploymentID string                 `json:"deploymentId"`
 	App          string                 `json:"app"`
@@ -272,6 +418,7 @@ type SagaEvent struct {
 	Category  string            `json:"category"`
 	Action    string            `json:"action"`
 	Message   string            `json:"message"`
+	Actor     string            `json:"actor,omitempty"`
 	Metadata  map[string]string `json:"metadata,omitempty"`
 }
 
@@ -612,6 +759,7 @@ type PlatformOpsSummary struct {
 	Operations    PlatformOperationSummary `json:"operations"`
 	Secrets       PlatformSecretSummary    `json:"secrets"`
 	Snapshots     []PlatformSnapshotStatus `json:"snapshots"`
+	Volumes       []PlatformVolumeStatus   `json:"volumes"`
 	Access        PlatformAccessSummary    `json:"access"`
 	Observability PlatformObserveSummary   `json:"observability"`
 	Warnings      []string                 `json:"warnings,omitempty"`
@@ -720,6 +868,22 @@ type PlatformSnapshotStatus struct {
 	Latest    *Snapshot `json:"latest,omitempty"`
 }
 
+type PlatformVolumeStatus struct {
+	App            string `json:"app"`
+	Name           string `json:"name"`
+	Source         string `json:"source"`
+	Type           string `json:"type"`
+	Mount          string `json:"mount"`
+	Size           string `json:"size,omitempty"`
+	State          string `json:"state"`
+	NodeID         string `json:"nodeId,omitempty"`
+	CapacityBytes  int64  `json:"capacityBytes,omitempty"`
+	UsedBytes      *int64 `json:"usedBytes,omitempty"`
+	Claims         int    `json:"claims"`
+	Snapshots      int    `json:"snapshots"`
+	LatestSnapshot string `json:"latestSnapshot,omitempty"`
+}
+
 type PlatformAccessSummary struct {
 	Recent      []AccessEvent  `json:"recent"`
 	TotalRecent int            `json:"totalRecent"`
@@ -923,6 +1087,7 @@ type OperatorInboxSummary struct {
 	CronRisks          int `json:"cronRisks"`
 	SnapshotRisks      int `json:"snapshotRisks"`
 	SecretRisks        int `json:"secretRisks"`
+	SignalRisks        int `json:"signalRisks"`
 	WakeTargets        int `json:"wakeTargets"`
 	RecommendedActions int `json:"recommendedActions"`
 }
@@ -973,15 +1138,28 @@ type OperatorWakeTargets struct {
 }
 
 type OperatorWakeTarget struct {
-	App       string   `json:"app"`
-	Process   string   `json:"process"`
-	Endpoint  string   `json:"endpoint"`
-	Exposure  string   `json:"exposure"`
-	Status    string   `json:"status"`
-	Instances int      `json:"instances"`
-	Ready     bool     `json:"ready"`
-	WakeURL   string   `json:"wakeUrl"`
-	Evidence  []string `json:"evidence,omitempty"`
+	App         string      `json:"app"`
+	Process     string      `json:"process"`
+	Endpoint    string      `json:"endpoint"`
+	Exposure    string      `json:"exposure"`
+	Status      string      `json:"status"`
+	Instances   int         `json:"instances"`
+	Ready       bool        `json:"ready"`
+	WakeURL     string      `json:"wakeUrl"`
+	ScaleToZero bool        `json:"scaleToZero"`
+	IdleTimeout string      `json:"idleTimeout,omitempty"`
+	History     []WakeEvent `json:"history,omitempty"`
+	Evidence    []string    `json:"evidence,omitempty"`
+}
+
+type WakeEvent struct {
+	App        string `json:"app"`
+	Process    string `json:"process"`
+	Action     string `json:"action"`
+	Reason     string `json:"reason,omitempty"`
+	Actor      string `json:"actor,omitempty"`
+	DurationMs int64  `json:"durationMs,omitempty"`
+	CreatedAt  string `json:"createdAt"`
 }
 
 type OperatorDeployConfidence struct {
@@ -1280,44 +1458,106 @@ func (c *Client) GetApp(id string) (*AppStatus, error) {
 	return &app, nil
 }
 
-func (c *Client) Deploy(appID, ref string) (string, error) {
+func (c *Client) Deploy(appID, ref, env string) (string, error) {
 	body := fmt.Sprintf(`{"ref":%q}`, ref)
 	var resp struct {
 		SagaID string `json:"sagaId"`
 	}
-	if err := c.postJSON("/api/apps/"+appID+"/deploy", body, &resp); err != nil {
+	if err := c.postJSON(appPath(appID, env, "/deploy"), body, &resp); err != nil {
 		return "", err
 	}
 	return resp.SagaID, nil
 }
 
-func (c *Client) Preflight(appID, ref string) (string, error) {
+func (c *Client) Preflight(appID, ref, env string) (string, error) {
 	body := fmt.Sprintf(`{"ref":%q}`, ref)
 	var resp struct {
 		SagaID string `json:"sagaId"`
 	}
-	if err := c.postJSON("/api/apps/"+appID+"/preflight", body, &resp); err != nil {
+	if err := c.postJSON(appPath(appID, env, "/preflight"), body, &resp); err != nil {
 		return "", err
 	}
 	return resp.SagaID, nil
 }
 
-func (c *Client) Rollback(appID string) (string, error) {
+func (c *Client) Rollback(appID, env string) (string, error) {
 	var resp struct {
 		SagaID string `json:"sagaId"`
 	}
-	if err := c.postJSON("/api/apps/"+appID+"/rollback", "{}", &resp); err != nil {
+	if err := c.postJSON(appPath(appID, env, "/rollback"), "{}", &resp); err != nil {
 		return "", err
 	}
 	return resp.SagaID, nil
 }
 
+func (c *Client) ListEnvironments(appID string) ([]Environment, error) {
+	var envs []Environment
+	if err := c.get("/api/apps/"+appID+"/environments", &envs); err != nil {
+		return nil, err
+	}
+	return envs, nil
+}
+
+func (c *Client) PromoteEnvironment(appID, from, to string) (*Promotion, error) {
+	body, err := json.Marshal(map[string]string{"from": from, "to": to})
+	if err != nil {
+		return nil, err
+	}
+	var resp Promotion
+	if err := c.postJSON("/api/apps/"+appID+"/environments/promote", string(body), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ListPreviews(appID string, all bool) ([]Preview, error) {
+	path := "/api/previews"
+	if appID != "" {
+		path = "/api/apps/" + appID + "/previews"
+	}
+	if all {
+		path += "?all=true"
+	}
+	var previews []Preview
+	if err := c.get(path, &previews); err != nil {
+		return nil, err
+	}
+	return previews, nil
+}
+
+func (c *Client) ClosePreview(appID string, number int) error {
+	return c.del(fmt.Sprintf("/api/apps/%s/previews/%d", appID, number))
+}
+
+func (c *Client) GetDrift(appID, env string) (*DriftReport, error) {
+	var report DriftReport
+	if err := c.get(appPath(appID, env, "/drift"), &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (c *Client) ApplyDrift(appID, env string) (*DriftReport, error) {
+	var report DriftReport
+	if err := c.postJSON(appPath(appID, env, "/drift/apply"), "{}", &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
 func (c *Client) Restart(appID string) error {
 	return c.post("/api/apps/"+appID+"/restart", "{}")
 }
 
-func (c *Client) StreamLogs(appID string) (io.ReadCloser, error) {
-	req, err := http.NewRequest(http.MethodGet, c.BaseURL+"/api/apps/"+appID+"/logs?follow=true", nil)
+func (c *Client) StreamLogs(appID, process, task string) (io.ReadCloser, error) {
+	params := url.Values{"follow": {"true"}}
+	if process != "" {
+		params.Set("process", process)
+	}
+	if task != "" {
+		params.Set("task", task)
+	}
+	req, err := http.NewRequest(http.MethodGet, c.BaseURL+"/api/apps/"+appID+"/logs?"+params.Encode(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -1349,7 +1589,11 @@ func (c *Client) Exec(appID, process string, argv []string) (*websocket.Conn, er
 	if encoded := params.Encode(); encoded != "" {
 		wsURL += "?" + encoded
 	}
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	header := http.Header{}
+	if c.Token != "" {
+		header.Set("Authorization", "Bearer "+c.Token)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
 	if err != nil {
 		return nil, fmt.Errorf("exec websocket: %w", err)
 	}
@@ -1388,9 +1632,31 @@ func (c *Client) ListDeployments(app string) ([]Deployment, error) {
 	return deps, nil
 }
 
-func (c *Client) ListSecrets(appID string) ([]string, error) {
+// appPath is an app endpoint, scoped to env when set. Every env-aware
+// endpoint takes the environment as ?env=.
+func appPath(appID, env, suffix string) string {
+	path := "/api/apps/" + appID + suffix
+	if env != "" {
+		path += "?env=" + url.QueryEscape(env)
+	}
+	return path
+}
+
+// secretsPath is an app's secrets endpoint, scoped to env when set.
+func secretsPath(appID, env, suffix string) string {
+	return appPath(appID, env, "/secrets"+suffix)
+}
+
+func secretsQueryPath(appID, env, suffix string, q url.Values) string {
+	if env != "" {
+		q.Set("env", env)
+	}
+	return "/api/apps/" + appID + "/secrets" + suffix + "?" + q.Encode()
+}
+
+func (c *Client) ListSecrets(appID, env string) ([]string, error) {
 	var secrets []string
-	if err := c.get("/api/apps/"+appID+"/secrets", &secrets); err != nil {
+	if err := c.get(secretsPath(appID, env, ""), &secrets); err != nil {
 		return nil, err
 	}
 	return secrets, nil
@@ -1442,8 +1708,23 @@ func (c *Client) Forge(appID string) error {
 	return c.post("/api/apps/"+appID+"/forge", "{}")
 }
 
-func (c *Client) Teardown(appID string) error {
-	return c.post("/api/apps/"+appID+"/teardown", "{}")
+// TeardownResult is what a teardown removed.
+type TeardownResult struct {
+	Status            string   `json:"status"`
+	VolumesDeleted    []string `json:"volumesDeleted,omitempty"`
+	IntentionsRemoved int      `json:"intentionsRemoved,omitempty"`
+}
+
+// Teardown removes the app's cloudflared routing. With purgeVolumes it also
+// stops the app and deletes its volumes; without it, apps with volume data
+// are refused.
+func (c *Client) Teardown(appID string, purgeVolumes bool) (*TeardownResult, error) {
+	var result TeardownResult
+	body := fmt.Sprintf(`{"purgeVolumes":%t}`, purgeVolumes)
+	if err := c.postJSON("/api/apps/"+appID+"/teardown", body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
 }
 
 func (c *Client) CloudflaredIngress() ([]string, error) {
@@ -1485,16 +1766,120 @@ func (c *Client) ValidateApp(appID string, strictSecrets bool) (*ValidationResul
 	return &result, nil
 }
 
-func (c *Client) UpdateSecrets(appID string, secrets map[string]string) error {
+func (c *Client) UpdateSecrets(appID, env string, secrets map[string]string) error {
 	body, err := json.Marshal(secrets)
 	if err != nil {
 		return err
 	}
-	return c.put("/api/apps/"+appID+"/secrets", string(body))
+	return c.put(secretsPath(appID, env, ""), string(body))
+}
+
+func (c *Client) DeleteSecret(appID, env, key string) error {
+	return c.del(secretsPath(appID, env, "/"+key))
 }
 
-func (c *Client) DeleteSecret(appID, key string) error {
-	return c.del("/api/apps/" + appID + "/secrets/" + key)
+// RotateSecretKeys re-encrypts an app's secrets to recipients, or to its
+// .sops.yaml recipients when none are given, and returns the recipients used.
+func (c *Client) RotateSecretKeys(appID, env string, recipients []string) ([]string, error) {
+	body, err := json.Marshal(map[string][]string{"recipients": recipients})
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Recipients []string `json:"recipients"`
+	}
+	if err := c.postJSON(secretsPath(appID, env, "/rotate-keys"), string(body), &result); err != nil {
+		return nil, err
+	}
+	return result.Recipients, nil
+}
+
+// MigrateSecretsBackend copies an app's secrets from one backend into the
+// backend its infraspec declares.
+func (c *Client) MigrateSecretsBackend(appID, env string, from SecretsBackend, overwrite, dryRun bool) (*SecretBackendMigration, error) {
+	body, err := json.Marshal(map[string]any{"from": from, "overwrite": overwrite, "dryRun": dryRun})
+	if err != nil {
+		return nil, err
+	}
+	var result SecretBackendMigration
+	if err := c.postJSON(secretsPath(appID, env, "/migrate"), string(body), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SecretVersions lists an app environment's secret history, newest first.
+func (c *Client) SecretVersions(appID, env string, limit int) ([]SecretVersion, error) {
+	var versions []SecretVersion
+	if err := c.get(secretsQueryPath(appID, env, "/versions", url.Values{"limit": {strconv.Itoa(limit)}}), &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// DiffSecretVersions compares two versions' key sets, or a version with the
+// live secrets when to is 0.
+func (c *Client) DiffSecretVersions(appID, env string, from, to int) (*SecretVersionDiff, error) {
+	q := url.Values{"from": {strconv.Itoa(from)}}
+	if to > 0 {
+		q.Set("to", strconv.Itoa(to))
+	}
+	var diff SecretVersionDiff
+	if err := c.get(secretsQueryPath(appID, env, "/versions/diff", q), &diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// RollbackSecrets restores a prior secrets version as a new version.
+func (c *Client) RollbackSecrets(appID, env string, version int, restart bool) (*SecretRollback, error) {
+	body := fmt.Sprintf(`{"restart":%t}`, restart)
+	var result SecretRollback
+	if err := c.postJSON(secretsPath(appID, env, fmt.Sprintf("/versions/%d/rollback", version)), body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CredentialRotation is a queued or resumed credential rotation.
+type CredentialRotation struct {
+	OperationID string `json:"operationId"`
+	SagaID      string `json:"sagaId"`
+	Environment string `json:"environment,omitempty"`
+	Services    string `json:"services"`
+	Resumed     bool   `json:"resumed"`
+}
+
+func credentialsPath(appID, env, suffix string, q url.Values) string {
+	if env != "" {
+		q.Set("env", env)
+	}
+	path := "/api/apps/" + appID + "/credentials" + suffix
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	return path
+}
+
+// RotateCredentials queues a rotation of an app's provisioned credentials,
+// or resumes its last failed one. Empty services rotates all of them.
+func (c *Client) RotateCredentials(appID, env string, services []string) (*CredentialRotation, error) {
+	body, _ := json.Marshal(map[string][]string{"services": services})
+	var result CredentialRotation
+	if err := c.postJSON(credentialsPath(appID, env, "/rotate", url.Values{}), string(body), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CredentialRotations lists an app environment's rotations, newest first.
+func (c *Client) CredentialRotations(appID, env string, limit int) ([]Operation, error) {
+	var ops []Operation
+	q := url.Values{"limit": {strconv.Itoa(limit)}}
+	if err := c.get(credentialsPath(appID, env, "/rotations", q), &ops); err != nil {
+		return nil, err
+	}
+	return ops, nil
 }
 
 func (c *Client) Scale(appID, group string, count int) error {
@@ -1502,6 +1887,15 @@ func (c *Client) Scale(appID, group string, count int) error {
 	return c.post("/api/apps/"+appID+"/scale", body)
 }
 
+// ScaleHistory returns an app's recent scale events, newest first.
+func (c *Client) ScaleHistory(appID string, limit int) ([]SagaEvent, error) {
+	var events []SagaEvent
+	if err := c.get(fmt.Sprintf("/api/apps/%s/scale/history?limit=%d", appID, limit), &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
 func (c *Client) Stats() (*StatsResponse, error) {
 	var s StatsResponse
 	if err := c.get("/api/stats", &s); err != nil {
@@ -1550,6 +1944,7 @@ func (c *Client) ApplySnapshotRetention(appID string, keep int, confirm bool) (*
 }
 
 type AccessToken struct {
+	ID        string `json:"id"`
 	Token     string `json:"token"`
 	ExpiresAt string `json:"expiresAt"`
 	Note      string `json:"note"`
@@ -1564,6 +1959,158 @@ func (c *Client) CreateAccessToken(note, ttl string) (*AccessToken, error) {
 	return &token, nil
 }
 
+type APIToken struct {
+	ID         string   `json:"id"`
+	User       string   `json:"user"`
+	Name       string   `json:"name"`
+	Role       string   `json:"role"`
+	Apps       []string `json:"apps,omitempty"`
+	CreatedBy  string   `json:"createdBy"`
+	CreatedAt  string   `json:"createdAt"`
+	ExpiresAt  string   `json:"expiresAt,omitempty"`
+	LastUsedAt string   `json:"lastUsedAt,omitempty"`
+	RevokedAt  string   `json:"revokedAt,omitempty"`
+}
+
+type CreatedAPIToken struct {
+	Token    string   `json:"token"`
+	APIToken APIToken `json:"apiToken"`
+}
+
+type Identity struct {
+	User    string   `json:"user"`
+	Role    string   `json:"role"`
+	Method  string   `json:"method"`
+	TokenID string   `json:"tokenId,omitempty"`
+	Apps    []string `json:"apps,omitempty"`
+}
+
+type CreateAPITokenRequest struct {
+	User      string   `json:"user,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Role      string   `json:"role,omitempty"`
+	Apps      []string `json:"apps,omitempty"`
+	ExpiresIn string   `json:"expiresIn,omitempty"`
+}
+
+func (c *Client) WhoAmI() (*Identity, error) {
+	var id Identity
+	if err := c.get("/api/auth/whoami", &id); err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+func (c *Client) CreateAPIToken(req CreateAPITokenRequest) (*CreatedAPIToken, error) {
+	body, _ := json.Marshal(req)
+	var token CreatedAPIToken
+	if err := c.postJSON("/api/auth/tokens", string(body), &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (c *Client) ListAPITokens(user string, all bool) ([]APIToken, error) {
+	values := url.Values{}
+	if user != "" {
+		values.Set("user", user)
+	}
+	if all {
+		values.Set("all", "true")
+	}
+	path := "/api/auth/tokens"
+	if encoded := values.Encode(); encoded != "" {
+		path += "?" + encoded
+	}
+	var tokens []APIToken
+	if err := c.get(path, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (c *Client) RevokeAPIToken(id string) error {
+	return c.del("/api/auth/tokens/" + url.PathEscape(id))
+}
+
+type AuditEntry struct {
+	ID            int64  `json:"id"`
+	Timestamp     string `json:"timestamp"`
+	Actor         string `json:"actor"`
+	Role          string `json:"role,omitempty"`
+	AuthMethod    string `json:"authMethod,omitempty"`
+	SourceIP      string `json:"sourceIp"`
+	Method        string `json:"method"`
+	Route         string `json:"route"`
+	Path          string `json:"path"`
+	App           string `json:"app,omitempty"`
+	RequestDigest string `json:"requestDigest"`
+	Status        int    `json:"status"`
+	Result        string `json:"result"`
+	DurationMs    int64  `json:"durationMs"`
+	PrevHash      string `json:"prevHash"`
+	Hash          string `json:"hash"`
+}
+
+type AuditQuery struct {
+	Actor  string
+	App    string
+	Route  string
+	Method string
+	Result string
+	Since  string
+	Until  string
+	Before int64
+	Limit  int
+}
+
+type AuditVerification struct {
+	OK       bool   `json:"ok"`
+	Checked  int64  `json:"checked"`
+	BrokenAt int64  `json:"brokenAt,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+func (c *Client) Audit(q AuditQuery) ([]AuditEntry, error) {
+	values := url.Values{}
+	for key, value := range map[string]string{
+		"actor":  q.Actor,
+		"app":    q.App,
+		"route":  q.Route,
+		"method": q.Method,
+		"result": q.Result,
+		"since":  q.Since,
+		"until":  q.Until,
+	} {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	if q.Before > 0 {
+		values.Set("before", fmt.Sprintf("%d", q.Before))
+	}
+	if q.Limit > 0 {
+		values.Set("limit", fmt.Sprintf("%d", q.Limit))
+	}
+	path := "/api/audit"
+	if encoded := values.Encode(); encoded != "" {
+		path += "?" + encoded
+	}
+	var entries []AuditEntry
+	if err := c.get(path, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (c *Client) VerifyAudit() (*AuditVerification, error) {
+	var result AuditVerification
+	if err := c.get("/api/audit/verify", &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 func (c *Client) AccessEvents(limit int) ([]AccessEvent, error) {
 	var events []AccessEvent
 	if limit <= 0 {
@@ -1683,8 +2230,26 @@ func (c *Client) FunctionHistory(appID string) ([]FuncExecution, error) {
 	return execs, nil
 }
 
+// Events subscribes to the event stream over a WebSocket. params filter it
+// by app, saga and type; since replays the events after a cursor first.
+func (c *Client) Events(params url.Values) (*websocket.Conn, error) {
+	wsURL := c.WebSocketURL()
+	if encoded := params.Encode(); encoded != "" {
+		wsURL += "?" + encoded
+	}
+	header := http.Header{}
+	if c.Token != "" {
+		header.Set("Authorization", "Bearer "+c.Token)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		return nil, fmt.Errorf("event stream: %w", err)
+	}
+	return conn, nil
+}
+
 func (c *Client) WebSocketURL() string {
-	return c.WebSocketURLFor("/ws")
+	return c.WebSocketURLFor("/api/ws")
 }
 
 func (c *Client) WebSocketURLFor(path string) string {
@@ -1816,10 +2381,21 @@ type TuningRecommendation struct {
 	Recommended TuningResourceState `json:"recommended"`
 	Observed    TuningObserved      `json:"observed"`
 	Signals     []TuningSignal      `json:"signals"`
+	Tasks       []TuningTask        `json:"tasks,omitempty"`
 	Actions     []string            `json:"actions"`
 	Reasons     []string            `json:"reasons"`
 }
 
+type TuningTask struct {
+	Name         string  `json:"name"`
+	Lifecycle    string  `json:"lifecycle"`
+	CPU          int     `json:"cpuMHz"`
+	Memory       int     `json:"memoryMB"`
+	UsedMemoryMB int     `json:"usedMemoryMB"`
+	PeakMemoryMB int     `json:"peakMemoryMB"`
+	CPUPercent   float64 `json:"cpuPercent"`
+}
+
 type TuningResourceState struct {
 	CPU    int `json:"cpuMHz"`
 	Memory int `json:"memoryMB"`
@@ -1849,6 +2425,24 @@ type TuningSignal struct {
 	Unit      string  `json:"unit,omitempty"`
 	Available bool    `json:"available"`
 	Reason    string  `json:"reason,omitempty"`
+	Query     string  `json:"query,omitempty"`
+}
+
+type TuningChange struct {
+	ID           int64  `json:"id"`
+	App          string `json:"app"`
+	Process      string `json:"process"`
+	FromCPU      int    `json:"fromCpuMHz"`
+	FromMemory   int    `json:"fromMemoryMB"`
+	ToCPU        int    `json:"toCpuMHz"`
+	ToMemory     int    `json:"toMemoryMB"`
+	Reason       string `json:"reason"`
+	Patch        string `json:"patch"`
+	Status       string `json:"status"`
+	StatusReason string `json:"statusReason,omitempty"`
+	SagaID       string `json:"sagaId,omitempty"`
+	CreatedAt    string `json:"createdAt"`
+	SettledAt    string `json:"settledAt,omitempty"`
 }
 
 // Notification channels
@@ -1912,25 +2506,23 @@ func (c *Client) BootstrapNotificationChannels() (*BootstrapResult, error) {
 // Deploy groups
 
 type DeployGroupInfo struct {
-	Name string           `json:"name"`
-	Apps []DeployGroupApp `json:"apps"`
+	Name              string           `json:"name"`
+	Apps              []DeployGroupApp `json:"apps"`
+	RollbackOnFailure bool             `json:"rollbackOnFailure"`
 }
 
 type DeployGroupApp struct {
-	App       string `json:"app"`
-	WaitReady bool   `json:"waitReady"`
+	App       string   `json:"app"`
+	DependsOn []string `json:"dependsOn"`
 }
 
 type DeployGroupResult struct {
-	Group   string        `json:"group"`
-	Ref     string        `json:"ref"`
-	Deploys []GroupDeploy `json:"deploys"`
-}
-
-type GroupDeploy struct {
-	App    string `json:"app"`
-	SagaID string `json:"sagaId,omitempty"`
-	Error  string `json:"error,omitempty"`
+	Group       string     `json:"group"`
+	Ref         string     `json:"ref"`
+	OperationID string     `json:"operationId"`
+	SagaID      string     `json:"sagaId"`
+	Waves       [][]string `json:"waves"`
+	Status      string     `json:"status"`
 }
 
 func (c *Client) ListDeployGroups() ([]DeployGroupInfo, error) {
@@ -1955,11 +2547,18 @@ func (c *Client) RunDeployGroup(name, ref string) (*DeployGroupResult, error) {
 // Canary
 
 type CanaryStatusResponse struct {
-	ID                string `json:"id"`
-	JobID             string `json:"jobId"`
-	Status            string `json:"status"`
-	StatusDescription string `json:"statusDescription"`
-	IsCanary          bool   `json:"isCanary"`
+	ID                string          `json:"id"`
+	JobID             string          `json:"jobId"`
+	Status            string          `json:"status"`
+	StatusDescription string          `json:"statusDescription"`
+	IsCanary          bool            `json:"isCanary"`
+	Analysis          *CanaryAnalysis `json:"analysis,omitempty"`
+}
+
+type CanaryAnalysis struct {
+	SagaID  string      `json:"sagaId"`
+	Verdict string      `json:"verdict"`
+	Events  []SagaEvent `json:"events"`
 }
 
 func (c *Client) CanaryStatus(appID string) (*CanaryStatusResponse, error) {
@@ -2032,6 +2631,18 @@ func (c *Client) TuningRecommendations() ([]TuningRecommendation, error) {
 	return resp.Recommendations, nil
 }
 
+func (c *Client) TuningChanges(app string, limit int) ([]TuningChange, error) {
+	path := fmt.Sprintf("/api/tuning/changes?limit=%d", limit)
+	if app != "" {
+		path += "&app=" + app
+	}
+	var changes []TuningChange
+	if err := c.get(path, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
 func firstNonEmpty(values ...string) string {
 	for _, value := range values {
 		if strings.TrimSpace(value) != "" {
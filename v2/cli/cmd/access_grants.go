@@ -124,14 +124,16 @@ var accessTokenCmd = &cobra.Command{
 			note = "-"
 		}
 		msg := fmt.Sprintf(
-			"%s %s\n%s %s\n%s %s\n\n%s",
+			"%s %s\n%s %s\n%s %s\n%s %s\n\n%s",
+			style.Key.Render("id"),
+			token.ID,
 			style.Key.Render("token"),
 			token.Token,
 			style.Key.Render("expires"),
 			localTime(token.ExpiresAt),
 			style.Key.Render("note"),
 			note,
-			style.DimText.Render("Use as Bearer token or append ?token="+token.Token+" to dashboard URLs"),
+			style.DimText.Render("Use as Bearer token or append ?token="+token.Token+" to dashboard URLs; revoke with norn token revoke "+token.ID),
 		)
 		fmt.Println(style.SuccessBox.Render("access token created\n\n" + msg))
 		return nil
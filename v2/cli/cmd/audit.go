@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"norn/v2/cli/api"
+	"norn/v2/cli/style"
+)
+
+var (
+	auditQuery  api.AuditQuery
+	auditExport string
+)
+
+// auditExportPage is the page size used when exporting the full log.
+const auditExportPage = 1000
+
+func init() {
+	auditCmd.Flags().StringVar(&auditQuery.Actor, "actor", "", "Only calls made by this user")
+	auditCmd.Flags().StringVar(&auditQuery.App, "app", "", "Only calls against this app")
+	auditCmd.Flags().StringVar(&auditQuery.Route, "route", "", "Only routes containing this text, e.g. teardown")
+	auditCmd.Flags().StringVar(&auditQuery.Method, "method", "", "Only this HTTP method")
+	auditCmd.Flags().StringVar(&auditQuery.Result, "result", "", "Only ok, denied or error")
+	auditCmd.Flags().StringVar(&auditQuery.Since, "since", "", "Lookback such as 24h or 7d, or an RFC3339 time")
+	auditCmd.Flags().StringVar(&auditQuery.Until, "until", "", "Upper bound as a lookback or RFC3339 time")
+	auditCmd.Flags().IntVar(&auditQuery.Limit, "limit", 50, "Number of entries to show")
+	auditCmd.Flags().StringVar(&auditExport, "export", "", "Write every matching entry as JSONL to this file (- for stdout)")
+	auditCmd.AddCommand(auditVerifyCmd)
+	rootCmd.AddCommand(auditCmd)
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the audit log of mutating API calls",
+	Example: "  norn audit --since 24h\n" +
+		"  norn audit --app web --result denied\n" +
+		"  norn audit --since 30d --export audit.jsonl\n" +
+		"  norn audit verify",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if auditExport != "" {
+			return exportAudit(auditQuery, auditExport)
+		}
+		entries, err := client.Audit(auditQuery)
+		if err != nil {
+			return fmt.Errorf("failed to fetch audit log: %w", err)
+		}
+		if len(entries) == 0 {
+			fmt.Println(style.DimText.Render("no audit entries"))
+			return nil
+		}
+		fmt.Println(style.Title.Render("norn audit"))
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  "+
+			style.TableHeader.Render("ID")+"\t"+
+			style.TableHeader.Render("TIME")+"\t"+
+			style.TableHeader.Render("ACTOR")+"\t"+
+			style.TableHeader.Render("SOURCE")+"\t"+
+			style.TableHeader.Render("METHOD")+"\t"+
+			style.TableHeader.Render("PATH")+"\t"+
+			style.TableHeader.Render("STATUS")+"\t"+
+			style.TableHeader.Render("RESULT"))
+		for _, e := range entries {
+			fmt.Fprintf(w, "  %d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				e.ID,
+				shortTime(e.Timestamp),
+				e.Actor,
+				firstNonEmpty(e.SourceIP, "-"),
+				e.Method,
+				e.Path,
+				renderHTTPStatus(e.Status),
+				renderAuditResult(e.Result))
+		}
+		return w.Flush()
+	},
+}
+
+var auditVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Recompute the audit hash chain and report tampering",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		result, err := client.VerifyAudit()
+		if err != nil {
+			return fmt.Errorf("failed to verify audit log: %w", err)
+		}
+		if !result.OK {
+			fmt.Println(style.ErrorBox.Render(fmt.Sprintf("audit chain broken\n\n%s %d\n%s %d\n%s %s",
+				style.Key.Render("entry"), result.BrokenAt,
+				style.Key.Render("verified"), result.Checked,
+				style.Key.Render("reason"), result.Reason)))
+			return fmt.Errorf("audit chain broken at entry %d", result.BrokenAt)
+		}
+		fmt.Println(style.SuccessBox.Render(fmt.Sprintf("audit chain intact\n\n%s %d", style.Key.Render("entries"), result.Checked)))
+		return nil
+	},
+}
+
+// exportAudit pages backwards through every matching entry, newest first,
+// and writes one JSON object per line.
+func exportAudit(q api.AuditQuery, dest string) error {
+	var out io.Writer = os.Stdout
+	if dest != "-" {
+		f, err := os.Create(dest)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	q.Limit = auditExportPage
+	written := 0
+	for {
+		entries, err := client.Audit(q)
+		if err != nil {
+			return fmt.Errorf("failed to fetch audit log: %w", err)
+		}
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		written += len(entries)
+		if len(entries) < q.Limit {
+			break
+		}
+		q.Before = entries[len(entries)-1].ID
+	}
+	if dest != "-" {
+		fmt.Println(style.SuccessBox.Render(fmt.Sprintf("audit log exported\n\n%s %s\n%s %d", style.Key.Render("file"), dest, style.Key.Render("entries"), written)))
+	}
+	return nil
+}
+
+func renderAuditResult(result string) string {
+	switch result {
+	case "ok":
+		return style.Healthy.Render(result)
+	case "denied":
+		return style.Warning.Render(result)
+	default:
+		return style.Unhealthy.Render(result)
+	}
+}
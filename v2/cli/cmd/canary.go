@@ -2,9 +2,13 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 
+	"norn/v2/cli/api"
 	"norn/v2/cli/style"
 )
 
@@ -30,6 +34,7 @@ var canaryCmd = &cobra.Command{
 
 		if status.Status == "none" {
 			fmt.Println(style.DimText.Render("  no active deployment"))
+			printCanaryAnalysis(status.Analysis)
 			return nil
 		}
 
@@ -46,16 +51,96 @@ var canaryCmd = &cobra.Command{
 		}
 		fmt.Printf("  %s %s\n", style.Key.Render("canary"), canaryLabel)
 
+		printCanaryAnalysis(status.Analysis)
 		return nil
 	},
 }
 
+func printCanaryAnalysis(analysis *api.CanaryAnalysis) {
+	if analysis == nil {
+		return
+	}
+	fmt.Println()
+	verdict := style.Warning.Render(analysis.Verdict)
+	switch analysis.Verdict {
+	case "promoted":
+		verdict = style.Healthy.Render(analysis.Verdict)
+	case "failed":
+		verdict = style.Unhealthy.Render(analysis.Verdict)
+	}
+	fmt.Printf("  %s %s %s\n", style.Key.Render("analysis"), verdict, style.DimText.Render(analysis.SagaID))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  "+
+		style.TableHeader.Render("STEP")+"\t"+
+		style.TableHeader.Render("PROCESS")+"\t"+
+		style.TableHeader.Render("WEIGHT")+"\t"+
+		style.TableHeader.Render("VERDICT")+"\t"+
+		style.TableHeader.Render("CANARY ERR/LAT")+"\t"+
+		style.TableHeader.Render("STABLE ERR/LAT")+"\t"+
+		style.TableHeader.Render("RESTARTS"))
+	var reasons []string
+	for _, evt := range analysis.Events {
+		if evt.Action != "canary.analysis" {
+			continue
+		}
+		m := evt.Metadata
+		v := m["verdict"]
+		switch v {
+		case "pass":
+			v = style.Healthy.Render(v)
+		case "fail":
+			v = style.Unhealthy.Render(v)
+		default:
+			v = style.Warning.Render(v)
+		}
+		weight := "-"
+		if m["weight"] != "" {
+			weight = m["weight"] + "%"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s / %sms\t%s / %sms\t%s\n",
+			m["step"], m["process"], weight, v,
+			percent(m["canaryErrorRate"]), m["canaryLatencyMs"],
+			percent(m["stableErrorRate"]), m["stableLatencyMs"],
+			m["canaryRestarts"])
+		if m["reasons"] != "" {
+			reasons = append(reasons, fmt.Sprintf("step %s %s: %s", m["step"], m["process"], m["reasons"]))
+		}
+	}
+	w.Flush()
+	for _, reason := range reasons {
+		fmt.Printf("  %s\n", style.DimText.Render(reason))
+	}
+}
+
+func percent(ratio string) string {
+	f, err := strconv.ParseFloat(ratio, 64)
+	if err != nil {
+		return "-"
+	}
+	return strconv.FormatFloat(f*100, 'f', 2, 64) + "%"
+}
+
 var promoteCmd = &cobra.Command{
-	Use:   "promote <app>",
-	Short: "Promote canary deployment",
-	Args:  cobra.ExactArgs(1),
+	Use:   "promote <app> [<from-env> <to-env>]",
+	Short: "Promote a canary deployment, or an image from one environment to another",
+	Long: "With only an app, promotes its running canary allocations.\n\n" +
+		"With two environments, deploys the exact image last deployed to <from-env>\n" +
+		"into <to-env>. The image is not rebuilt and keeps its original commit and\n" +
+		"source provenance.",
+	Example: "  norn promote web\n" +
+		"  norn promote web staging production",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 && len(args) != 3 {
+			return fmt.Errorf("accepts <app> or <app> <from-env> <to-env>, received %d arg(s)", len(args))
+		}
+		return nil
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		appID := args[0]
+		if len(args) == 3 {
+			return promoteEnvironment(appID, args[1], args[2])
+		}
 
 		if err := client.PromoteCanary(appID); err != nil {
 			return fmt.Errorf("promote failed: %w", err)
@@ -65,3 +150,23 @@ var promoteCmd = &cobra.Command{
 		return nil
 	},
 }
+
+func promoteEnvironment(appID, from, to string) error {
+	fmt.Println(style.Title.Render(fmt.Sprintf("promoting %s: %s → %s", appID, from, to)))
+
+	promo, err := client.PromoteEnvironment(appID, from, to)
+	if err != nil {
+		return fmt.Errorf("promote failed: %w", err)
+	}
+
+	sha := promo.CommitSHA
+	if len(sha) > 12 {
+		sha = sha[:12]
+	}
+	fmt.Printf("  image: %s\n", promo.ImageTag)
+	fmt.Printf("  commit: %s\n", sha)
+	fmt.Printf("  from deployment: %s\n", style.DimText.Render(promo.SourceDeploymentID))
+	fmt.Printf("  saga: %s\n\n", style.DimText.Render(promo.SagaID))
+
+	return streamSagaEvents(promo.SagaID)
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"norn/v2/cli/style"
+)
+
+var (
+	credentialsEnv          string
+	credentialsServices     []string
+	credentialsHistoryLimit int
+)
+
+func init() {
+	credentialsCmd.PersistentFlags().StringVar(&credentialsEnv, "env", "", "Environment whose credentials to rotate (default: the app's default environment)")
+	credentialsRotateCmd.Flags().StringSliceVar(&credentialsServices, "service", nil, "Service to rotate: postgres, objectStorage or kafka (repeatable; default: all the app declares)")
+	credentialsHistoryCmd.Flags().IntVar(&credentialsHistoryLimit, "limit", 20, "Number of rotations to show")
+	credentialsCmd.AddCommand(credentialsRotateCmd)
+	credentialsCmd.AddCommand(credentialsHistoryCmd)
+	rootCmd.AddCommand(credentialsCmd)
+}
+
+var credentialsCmd = &cobra.Command{
+	Use:   "credentials",
+	Short: "Rotate the Postgres, object storage and Kafka credentials Norn provisions for apps",
+}
+
+var credentialsRotateCmd = &cobra.Command{
+	Use:   "rotate <app>",
+	Short: "Issue new credentials, restart the app onto them, then revoke the old ones",
+	Long: "Queues a credential rotation. New credentials are issued and stored in the app's secrets,\n" +
+		"the job is restarted and must become healthy before the old credentials are revoked.\n" +
+		"If the app's last rotation failed, it is resumed instead.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		appID := args[0]
+		result, err := client.RotateCredentials(appID, credentialsEnv, credentialsServices)
+		if err != nil {
+			return fmt.Errorf("failed to rotate credentials: %w", err)
+		}
+		verb := "queued"
+		if result.Resumed {
+			verb = "resumed"
+		}
+		fmt.Println(style.SuccessBox.Render(fmt.Sprintf("%s rotation of %s credentials for %s", verb, strings.ReplaceAll(result.Services, ",", ", "), appID)))
+		fmt.Printf("  operation %s\n", result.OperationID)
+		fmt.Println(style.DimText.Render("  follow it with: norn saga " + result.SagaID))
+		return nil
+	},
+}
+
+var credentialsHistoryCmd = &cobra.Command{
+	Use:   "history <app>",
+	Short: "Show an app's credential rotations and how far each got",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		appID := args[0]
+		ops, err := client.CredentialRotations(appID, credentialsEnv, credentialsHistoryLimit)
+		if err != nil {
+			return fmt.Errorf("failed to fetch rotations: %w", err)
+		}
+		if len(ops) == 0 {
+			fmt.Println("  no credential rotations recorded")
+			return nil
+		}
+
+		fmt.Println(style.Title.Render("credential rotations for " + appID))
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  "+
+			style.TableHeader.Render("STARTED")+"\t"+
+			style.TableHeader.Render("SOURCE")+"\t"+
+			style.TableHeader.Render("SERVICES")+"\t"+
+			style.TableHeader.Render("STATUS")+"\t"+
+			style.TableHeader.Render("STAGE")+"\t"+
+			style.TableHeader.Render("MESSAGE"))
+		for _, op := range ops {
+			status := op.Status
+			switch status {
+			case "succeeded":
+				status = style.Healthy.Render(status)
+			case "failed":
+				status = style.Unhealthy.Render(status)
+			}
+			stage, _ := op.Metadata["stage"].(string)
+			if stage == "" {
+				stage = "-"
+			}
+			services, _ := op.Payload["services"].(string)
+			message := op.Message
+			if op.Status == "failed" && op.LastError != "" {
+				message = op.LastError
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%s\n",
+				shortTime(op.StartedAt),
+				op.Source,
+				services,
+				status,
+				stage,
+				message,
+			)
+		}
+		return w.Flush()
+	},
+}
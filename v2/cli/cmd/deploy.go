@@ -10,7 +10,10 @@ import (
 	"norn/v2/cli/style"
 )
 
+var deployEnv string
+
 func init() {
+	deployCmd.Flags().StringVar(&deployEnv, "env", "", "Environment to deploy to (default: the app's default environment)")
 	rootCmd.AddCommand(deployCmd)
 	deployCmd.AddCommand(deployStepsCmd)
 }
@@ -18,7 +21,10 @@ func init() {
 var deployCmd = &cobra.Command{
 	Use:   "deploy <app> [ref]",
 	Short: "Deploy an app",
-	Args:  cobra.RangeArgs(1, 2),
+	Example: "  norn deploy web\n" +
+		"  norn deploy web --env staging\n" +
+		"  norn deploy web v1.4.0 --env staging",
+	Args: cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		appID := args[0]
 		ref := "HEAD"
@@ -27,9 +33,13 @@ var deployCmd = &cobra.Command{
 		}
 
 		fmt.Println(style.Title.Render("deploying " + appID))
-		fmt.Printf("  ref: %s\n\n", ref)
+		fmt.Printf("  ref: %s\n", ref)
+		if deployEnv != "" {
+			fmt.Printf("  env: %s\n", deployEnv)
+		}
+		fmt.Println()
 
-		sagaID, err := client.Deploy(appID, ref)
+		sagaID, err := client.Deploy(appID, ref, deployEnv)
 		if err != nil {
 			return fmt.Errorf("deploy failed: %w", err)
 		}
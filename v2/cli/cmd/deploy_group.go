@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/spf13/cobra"
@@ -36,7 +37,7 @@ var deployGroupsCmd = &cobra.Command{
 		fmt.Fprintln(w, "  "+
 			style.TableHeader.Render("GROUP")+"\t"+
 			style.TableHeader.Render("APPS")+"\t"+
-			style.TableHeader.Render("WAIT READY"))
+			style.TableHeader.Render("DEPENDS ON"))
 
 		for _, g := range groups {
 			for i, app := range g.Apps {
@@ -44,11 +45,11 @@ var deployGroupsCmd = &cobra.Command{
 				if i == 0 {
 					groupName = g.Name
 				}
-				waitReady := style.DimText.Render("no")
-				if app.WaitReady {
-					waitReady = style.Healthy.Render("yes")
+				dependsOn := style.DimText.Render("-")
+				if len(app.DependsOn) > 0 {
+					dependsOn = strings.Join(app.DependsOn, ", ")
 				}
-				fmt.Fprintf(w, "  %s\t%s\t%s\n", groupName, app.App, waitReady)
+				fmt.Fprintf(w, "  %s\t%s\t%s\n", groupName, app.App, dependsOn)
 			}
 		}
 		w.Flush()
@@ -58,7 +59,7 @@ var deployGroupsCmd = &cobra.Command{
 
 var deployGroupCmd = &cobra.Command{
 	Use:   "deploy-group <name> [ref]",
-	Short: "Deploy all apps in a group",
+	Short: "Deploy a group's apps in dependency order",
 	Args:  cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		name := args[0]
@@ -77,20 +78,17 @@ var deployGroupCmd = &cobra.Command{
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 		fmt.Fprintln(w, "  "+
-			style.TableHeader.Render("APP")+"\t"+
-			style.TableHeader.Render("SAGA")+"\t"+
-			style.TableHeader.Render("STATUS"))
-
-		for _, d := range result.Deploys {
-			status := style.Healthy.Render("started")
-			saga := style.DimText.Render(d.SagaID)
-			if d.Error != "" {
-				status = style.Unhealthy.Render(d.Error)
-				saga = style.DimText.Render("-")
-			}
-			fmt.Fprintf(w, "  %s\t%s\t%s\n", d.App, saga, status)
+			style.TableHeader.Render("WAVE")+"\t"+
+			style.TableHeader.Render("APPS"))
+		for i, wave := range result.Waves {
+			fmt.Fprintf(w, "  %d\t%s\n", i+1, strings.Join(wave, ", "))
 		}
 		w.Flush()
+
+		fmt.Println()
+		fmt.Printf("  %s %s\n", style.DimText.Render("operation:"), result.OperationID)
+		fmt.Printf("  %s %s\n", style.DimText.Render("saga:"), result.SagaID)
+		fmt.Println(style.DimText.Render("  follow with: norn saga " + result.SagaID))
 		return nil
 	},
 }
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"norn/v2/cli/api"
+	"norn/v2/cli/style"
+)
+
+var (
+	diffEnv   string
+	diffApply bool
+)
+
+func init() {
+	diffCmd.Flags().StringVar(&diffEnv, "env", "", "Environment to compare (default: the app's default environment)")
+	diffCmd.Flags().BoolVar(&diffApply, "apply", false, "Resubmit the job with the live image to fix the drift")
+	rootCmd.AddCommand(diffCmd)
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <app>",
+	Short: "Compare an app's infraspec with the job Nomad is running",
+	Args:  cobra.ExactArgs(1),
+	Example: "  norn diff shop\n" +
+		"  norn diff shop --env staging\n" +
+		"  norn diff shop --apply",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var (
+			report *api.DriftReport
+			err    error
+		)
+		if diffApply {
+			report, err = client.ApplyDrift(args[0], diffEnv)
+		} else {
+			report, err = client.GetDrift(args[0], diffEnv)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check drift: %w", err)
+		}
+
+		fmt.Println(style.Title.Render("norn diff " + report.JobID))
+		fmt.Println()
+		switch report.Status {
+		case "in_sync":
+			fmt.Println(style.Healthy.Render("in sync") + style.DimText.Render("  "+emptyDash(report.Image)))
+			return nil
+		case "not_deployed":
+			fmt.Println(style.DimText.Render("not deployed"))
+			return nil
+		}
+		fmt.Println(style.Warning.Render(fmt.Sprintf("drifted: %d changes", len(report.Changes))) +
+			style.DimText.Render("  "+emptyDash(report.Image)))
+		fmt.Println()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  "+
+			style.TableHeader.Render("JOB/GROUP")+"\t"+
+			style.TableHeader.Render("FIELD")+"\t"+
+			style.TableHeader.Render("CHANGE")+"\t"+
+			style.TableHeader.Render("LIVE → DESIRED"))
+		for _, c := range report.Changes {
+			where := c.Job
+			if c.Group != "" {
+				where += "/" + c.Group
+			}
+			field := c.Field
+			switch {
+			case c.Image:
+				field += style.DimText.Render(" (deploy)")
+			case c.Endpoint:
+				field += style.DimText.Render(" (route)")
+			}
+			values := ""
+			if c.Live != "" || c.Desired != "" {
+				values = emptyDash(c.Live) + " → " + emptyDash(c.Desired)
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", where, field, renderDriftChange(c.Change), values)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		fmt.Println()
+		switch {
+		case report.Applied:
+			fmt.Println(style.SuccessBox.Render(fmt.Sprintf("drift applied\n\n%s %s",
+				style.Key.Render("saga"), report.SagaID)))
+		case report.Skipped != "":
+			fmt.Println(style.ErrorBox.Render("not applied: " + report.Skipped))
+		case !diffApply:
+			fmt.Println(style.DimText.Render("run with --apply to resubmit the job with the live image"))
+		}
+		return nil
+	},
+}
+
+func renderDriftChange(change string) string {
+	switch change {
+	case "added":
+		return style.Healthy.Render(change)
+	case "removed":
+		return style.Unhealthy.Render(change)
+	default:
+		return style.Warning.Render(change)
+	}
+}
@@ -2,13 +2,17 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 
 	"norn/v2/cli/style"
 )
 
+var teardownPurgeVolumes bool
+
 func init() {
+	teardownCmd.Flags().BoolVar(&teardownPurgeVolumes, "purge-volumes", false, "Stop the app and delete its volumes and their data")
 	rootCmd.AddCommand(forgeCmd)
 	rootCmd.AddCommand(teardownCmd)
 }
@@ -38,11 +42,19 @@ var teardownCmd = &cobra.Command{
 		appID := args[0]
 		fmt.Println(style.Title.Render("tearing down " + appID))
 
-		if err := client.Teardown(appID); err != nil {
+		result, err := client.Teardown(appID, teardownPurgeVolumes)
+		if err != nil {
 			return fmt.Errorf("teardown failed: %w", err)
 		}
 
-		fmt.Println(style.SuccessBox.Render("cloudflared routing removed"))
+		message := "cloudflared routing removed"
+		if len(result.VolumesDeleted) > 0 {
+			message += "\nvolumes deleted: " + strings.Join(result.VolumesDeleted, ", ")
+		}
+		if result.IntentionsRemoved > 0 {
+			message += fmt.Sprintf("\nmesh intentions removed: %d", result.IntentionsRemoved)
+		}
+		fmt.Println(style.SuccessBox.Render(message))
 		return nil
 	},
 }
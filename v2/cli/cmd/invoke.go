@@ -7,7 +7,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/spf13/cobra"
 
 	"norn/v2/cli/style"
@@ -66,8 +65,7 @@ var invokeCmd = &cobra.Command{
 }
 
 func waitForFunctionComplete(execID string) error {
-	wsURL := client.WebSocketURL()
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	conn, err := client.Events(nil)
 	if err != nil {
 		return err
 	}
@@ -9,9 +9,16 @@ import (
 )
 
 func init() {
+	logsCmd.Flags().StringVarP(&logsProcess, "process", "p", "", "Task group/process to read logs from")
+	logsCmd.Flags().StringVar(&logsTask, "task", "", "Task to read logs from, such as a sidecar or init task")
 	rootCmd.AddCommand(logsCmd)
 }
 
+var (
+	logsProcess string
+	logsTask    string
+)
+
 var logsCmd = &cobra.Command{
 	Use:   "logs <app>",
 	Short: "Stream logs from a running app",
@@ -19,7 +26,7 @@ var logsCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		appID := args[0]
 
-		reader, err := client.StreamLogs(appID)
+		reader, err := client.StreamLogs(appID, logsProcess, logsTask)
 		if err != nil {
 			return fmt.Errorf("stream logs: %w", err)
 		}
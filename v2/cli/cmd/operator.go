@@ -5,6 +5,7 @@ import (
 	"os"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -121,7 +122,7 @@ var operatorActionsCmd = &cobra.Command{
 
 func printOperatorInbox(inbox *api.OperatorInbox) {
 	fmt.Println(style.Title.Render("operator inbox"))
-	fmt.Printf("generated=%s recommended=%d incidents=%d ops=%d deploy=%d cron=%d snapshots=%d secrets=%d wakeTargets=%d\n\n",
+	fmt.Printf("generated=%s recommended=%d incidents=%d ops=%d deploy=%d cron=%d snapshots=%d secrets=%d signals=%d wakeTargets=%d\n\n",
 		localTime(inbox.GeneratedAt),
 		inbox.Summary.RecommendedActions,
 		inbox.Summary.OpenIncidents,
@@ -130,6 +131,7 @@ func printOperatorInbox(inbox *api.OperatorInbox) {
 		inbox.Summary.CronRisks,
 		inbox.Summary.SnapshotRisks,
 		inbox.Summary.SecretRisks,
+		inbox.Summary.SignalRisks,
 		inbox.Summary.WakeTargets,
 	)
 	if len(inbox.Items) == 0 {
@@ -199,20 +201,39 @@ func printOperatorWakeTargets(targets *api.OperatorWakeTargets) {
 		style.TableHeader.Render("READY")+"\t"+
 		style.TableHeader.Render("STATUS")+"\t"+
 		style.TableHeader.Render("EXPOSURE")+"\t"+
+		style.TableHeader.Render("IDLE")+"\t"+
+		style.TableHeader.Render("LAST SLEEP/WAKE")+"\t"+
 		style.TableHeader.Render("ENDPOINT"))
 	for _, target := range targets.Targets {
-		fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\t%s\n",
+		idle := "-"
+		if target.ScaleToZero {
+			idle = target.IdleTimeout
+		}
+		fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\t%s\t%s\t%s\n",
 			target.App,
 			target.Process,
 			target.Ready,
 			target.Status,
 			target.Exposure,
+			idle,
+			lastWakeEvent(target.History),
 			target.Endpoint,
 		)
 	}
 	w.Flush()
 }
 
+func lastWakeEvent(history []api.WakeEvent) string {
+	if len(history) == 0 {
+		return "-"
+	}
+	e := history[0]
+	if e.Action == "wake" && e.DurationMs > 0 {
+		return fmt.Sprintf("%s %s (%s cold start)", e.Action, shortTime(e.CreatedAt), (time.Duration(e.DurationMs) * time.Millisecond).String())
+	}
+	return e.Action + " " + shortTime(e.CreatedAt)
+}
+
 func printOperatorDeployConfidence(confidence *api.OperatorDeployConfidence) {
 	fmt.Println(style.Title.Render("deploy confidence"))
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
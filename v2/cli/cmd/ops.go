@@ -117,6 +117,38 @@ func printOpsPlatform(summary *api.PlatformOpsSummary) {
 		fmt.Println()
 	}
 
+	if len(summary.Volumes) > 0 {
+		fmt.Println(style.Subtitle.Render("  volumes"))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  "+style.TableHeader.Render("APP")+"\t"+
+			style.TableHeader.Render("VOLUME")+"\t"+
+			style.TableHeader.Render("TYPE")+"\t"+
+			style.TableHeader.Render("STATE")+"\t"+
+			style.TableHeader.Render("USED")+"\t"+
+			style.TableHeader.Render("CLAIMS")+"\t"+
+			style.TableHeader.Render("SNAPSHOTS"))
+		for _, volume := range summary.Volumes {
+			used := "-"
+			if volume.UsedBytes != nil {
+				used = formatBytes(*volume.UsedBytes)
+			}
+			if volume.CapacityBytes > 0 {
+				used += " / " + formatBytes(volume.CapacityBytes)
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%d\t%d\n",
+				volume.App,
+				volume.Name,
+				volume.Type,
+				volume.State,
+				used,
+				volume.Claims,
+				volume.Snapshots,
+			)
+		}
+		w.Flush()
+		fmt.Println()
+	}
+
 	if len(summary.Deployments.Dirty) > 0 {
 		fmt.Println(style.Subtitle.Render("  dirty deployments"))
 		for _, deployment := range summary.Deployments.Dirty {
@@ -8,7 +8,10 @@ import (
 	"norn/v2/cli/style"
 )
 
+var preflightEnv string
+
 func init() {
+	preflightCmd.Flags().StringVar(&preflightEnv, "env", "", "Environment to rehearse against (default: the app's default environment)")
 	rootCmd.AddCommand(preflightCmd)
 }
 
@@ -27,7 +30,7 @@ var preflightCmd = &cobra.Command{
 		fmt.Println(style.Title.Render("preflighting " + appID))
 		fmt.Printf("  ref: %s\n\n", ref)
 
-		sagaID, err := client.Preflight(appID, ref)
+		sagaID, err := client.Preflight(appID, ref, preflightEnv)
 		if err != nil {
 			return fmt.Errorf("preflight failed: %w", err)
 		}
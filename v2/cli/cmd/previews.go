@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"norn/v2/cli/style"
+)
+
+var previewsAll bool
+
+func init() {
+	previewsCmd.Flags().BoolVar(&previewsAll, "all", false, "Include closed previews")
+	previewsCmd.AddCommand(previewsCloseCmd)
+	rootCmd.AddCommand(previewsCmd)
+}
+
+var previewsCmd = &cobra.Command{
+	Use:   "previews [app]",
+	Short: "List pull request preview deployments",
+	Args:  cobra.MaximumNArgs(1),
+	Example: "  norn previews\n" +
+		"  norn previews shop --all\n" +
+		"  norn previews close shop 42",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		app := ""
+		if len(args) == 1 {
+			app = args[0]
+		}
+		previews, err := client.ListPreviews(app, previewsAll)
+		if err != nil {
+			return fmt.Errorf("failed to fetch previews: %w", err)
+		}
+		if len(previews) == 0 {
+			fmt.Println(style.DimText.Render("no previews"))
+			return nil
+		}
+		fmt.Println(style.Title.Render("norn previews"))
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  "+
+			style.TableHeader.Render("APP")+"\t"+
+			style.TableHeader.Render("PR")+"\t"+
+			style.TableHeader.Render("STATUS")+"\t"+
+			style.TableHeader.Render("BRANCH")+"\t"+
+			style.TableHeader.Render("URL")+"\t"+
+			style.TableHeader.Render("EXPIRES"))
+		for _, p := range previews {
+			url := "-"
+			if p.Hostname != "" {
+				url = "https://" + p.Hostname
+			}
+			fmt.Fprintf(w, "  %s\t#%d\t%s\t%s\t%s\t%s\n",
+				p.App,
+				p.Number,
+				renderPreviewStatus(p.Status),
+				emptyDash(p.Branch),
+				url,
+				shortTime(p.ExpiresAt))
+		}
+		return w.Flush()
+	},
+}
+
+var previewsCloseCmd = &cobra.Command{
+	Use:   "close <app> <number>",
+	Short: "Tear down a preview before its pull request closes",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		number, err := strconv.Atoi(args[1])
+		if err != nil || number <= 0 {
+			return fmt.Errorf("invalid pull request number %q", args[1])
+		}
+		if err := client.ClosePreview(args[0], number); err != nil {
+			return fmt.Errorf("failed to close preview: %w", err)
+		}
+		fmt.Println(style.SuccessBox.Render(fmt.Sprintf("preview teardown queued\n\n%s %s\n%s #%d",
+			style.Key.Render("app"), args[0],
+			style.Key.Render("pr"), number)))
+		return nil
+	},
+}
+
+func renderPreviewStatus(status string) string {
+	switch status {
+	case "ready":
+		return style.Healthy.Render(status)
+	case "deploying", "closing":
+		return style.Warning.Render(status)
+	case "failed":
+		return style.Unhealthy.Render(status)
+	default:
+		return style.DimText.Render(status)
+	}
+}
@@ -8,7 +8,10 @@ import (
 	"norn/v2/cli/style"
 )
 
+var rollbackEnv string
+
 func init() {
+	rollbackCmd.Flags().StringVar(&rollbackEnv, "env", "", "Environment to roll back (default: the app's default environment)")
 	rootCmd.AddCommand(rollbackCmd)
 }
 
@@ -21,7 +24,7 @@ var rollbackCmd = &cobra.Command{
 
 		fmt.Println(style.Title.Render("rolling back " + appID))
 
-		sagaID, err := client.Rollback(appID)
+		sagaID, err := client.Rollback(appID, rollbackEnv)
 		if err != nil {
 			return fmt.Errorf("rollback failed: %w", err)
 		}
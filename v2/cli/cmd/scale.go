@@ -2,14 +2,20 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"strconv"
+	"text/tabwriter"
 
 	"github.com/spf13/cobra"
 
 	"norn/v2/cli/style"
 )
 
+var scaleHistoryLimit int
+
 func init() {
+	scaleHistoryCmd.Flags().IntVar(&scaleHistoryLimit, "limit", 20, "number of events")
+	scaleCmd.AddCommand(scaleHistoryCmd)
 	rootCmd.AddCommand(scaleCmd)
 }
 
@@ -36,3 +42,37 @@ var scaleCmd = &cobra.Command{
 		return nil
 	},
 }
+
+var scaleHistoryCmd = &cobra.Command{
+	Use:   "history <app>",
+	Short: "Show why an app's counts changed",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		events, err := client.ScaleHistory(args[0], scaleHistoryLimit)
+		if err != nil {
+			return fmt.Errorf("fetch scale history: %w", err)
+		}
+
+		fmt.Println(style.Title.Render("scale history " + args[0]))
+		fmt.Println()
+		if len(events) == 0 {
+			fmt.Println(style.DimText.Render("no scale events"))
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  "+
+			style.TableHeader.Render("TIME")+"\t"+
+			style.TableHeader.Render("SOURCE")+"\t"+
+			style.TableHeader.Render("ACTOR")+"\t"+
+			style.TableHeader.Render("CHANGE"))
+		for _, evt := range events {
+			message := evt.Message
+			if evt.Action == "scale.auto_failed" {
+				message = style.Unhealthy.Render(message)
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", shortTime(evt.Timestamp), evt.Source, emptyDash(evt.Actor), message)
+		}
+		return w.Flush()
+	},
+}
@@ -12,12 +12,20 @@ import (
 	"norn/v2/cli/style"
 )
 
+var (
+	secretsEnv       string
+	rotateRecipients []string
+)
+
 func init() {
+	secretsCmd.PersistentFlags().StringVar(&secretsEnv, "env", "", "Environment whose secrets file to use (default: the app's default environment)")
 	secretsCmd.AddCommand(secretsListCmd)
 	secretsCmd.AddCommand(secretsStatusCmd)
 	secretsCmd.AddCommand(secretsMigratePlanCmd)
 	secretsCmd.AddCommand(secretsSetCmd)
 	secretsCmd.AddCommand(secretsDeleteCmd)
+	secretsRotateKeysCmd.Flags().StringSliceVar(&rotateRecipients, "recipient", nil, "age recipient to encrypt to (repeatable; default: the app's .sops.yaml recipients)")
+	secretsCmd.AddCommand(secretsRotateKeysCmd)
 	rootCmd.AddCommand(secretsCmd)
 }
 
@@ -95,7 +103,7 @@ var secretsSetCmd = &cobra.Command{
 			secrets[parts[0]] = parts[1]
 		}
 
-		if err := client.UpdateSecrets(appID, secrets); err != nil {
+		if err := client.UpdateSecrets(appID, secretsEnv, secrets); err != nil {
 			return fmt.Errorf("failed to set secrets: %w", err)
 		}
 
@@ -111,7 +119,7 @@ var secretsDeleteCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		appID := args[0]
 		for _, key := range args[1:] {
-			if err := client.DeleteSecret(appID, key); err != nil {
+			if err := client.DeleteSecret(appID, secretsEnv, key); err != nil {
 				return fmt.Errorf("failed to delete %s: %w", key, err)
 			}
 			fmt.Printf("  %s deleted %s\n", style.StepDone.Render("✓"), key)
@@ -120,8 +128,27 @@ var secretsDeleteCmd = &cobra.Command{
 	},
 }
 
+var secretsRotateKeysCmd = &cobra.Command{
+	Use:   "rotate-keys <app>",
+	Short: "Re-encrypt an app's secrets to a new set of age recipients",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		appID := args[0]
+		recipients, err := client.RotateSecretKeys(appID, secretsEnv, rotateRecipients)
+		if err != nil {
+			return fmt.Errorf("failed to rotate keys: %w", err)
+		}
+
+		fmt.Println(style.SuccessBox.Render(fmt.Sprintf("re-encrypted secrets for %s to %d recipient(s)", appID, len(recipients))))
+		for _, r := range recipients {
+			fmt.Printf("  %s %s\n", style.DimText.Render("•"), r)
+		}
+		return nil
+	},
+}
+
 func listSecrets(appID string) error {
-	secrets, err := client.ListSecrets(appID)
+	secrets, err := client.ListSecrets(appID, secretsEnv)
 	if err != nil {
 		return fmt.Errorf("failed to fetch secrets: %w", err)
 	}
@@ -15,14 +15,24 @@ import (
 )
 
 var (
-	secretsMigrateApply   bool
-	secretsMigrateAppsDir string
+	secretsMigrateApply     bool
+	secretsMigrateAppsDir   string
+	secretsMigrateBackend   bool
+	secretsMigrateFrom      string
+	secretsMigrateFromPath  string
+	secretsMigrateFromMount string
+	secretsMigrateOverwrite bool
 )
 
 func init() {
 	secretsCmd.AddCommand(secretsMigrateCmd)
 	secretsMigrateCmd.Flags().BoolVar(&secretsMigrateApply, "apply", false, "Modify infraspec files (remove plaintext env values, add to secrets list)")
 	secretsMigrateCmd.Flags().StringVar(&secretsMigrateAppsDir, "apps-dir", "", "Directory containing app folders (default: $NORN_APPS_DIR or $HOME/projects)")
+	secretsMigrateCmd.Flags().BoolVar(&secretsMigrateBackend, "backend", false, "Copy secrets into the backend each app's infraspec declares")
+	secretsMigrateCmd.Flags().StringVar(&secretsMigrateFrom, "from", "sops", "Backend to copy from with --backend: sops, nomad or vault")
+	secretsMigrateCmd.Flags().StringVar(&secretsMigrateFromPath, "from-path", "", "Source sops file, Nomad variable path or Vault KV path (default: where the source backend keeps the app's secrets)")
+	secretsMigrateCmd.Flags().StringVar(&secretsMigrateFromMount, "from-mount", "", "Source Vault KV v2 mount (default: secret)")
+	secretsMigrateCmd.Flags().BoolVar(&secretsMigrateOverwrite, "overwrite", false, "Replace keys that already hold a different value in the destination")
 }
 
 var secretsMigrateCmd = &cobra.Command{
@@ -32,7 +42,12 @@ var secretsMigrateCmd = &cobra.Command{
 
 By default (dry-run) this prints what will change and the SOPS commands to run.
 With --apply it also modifies infraspec.yaml: removes keys from env: and adds
-them to the secrets: list. The SOPS commands still need to be run manually.`,
+them to the secrets: list. The SOPS commands still need to be run manually.
+
+With --backend it instead copies secrets from --from (default: the SOPS file)
+into the Nomad Variables or Vault backend the app's infraspec declares. Keys
+that already hold a different value are reported as conflicts and left alone
+unless --overwrite is set. Nothing is written without --apply.`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		appID := ""
@@ -45,11 +60,91 @@ them to the secrets: list. The SOPS commands still need to be run manually.`,
 			return fmt.Errorf("failed to fetch migration plan: %w", err)
 		}
 
+		if secretsMigrateBackend {
+			return runSecretsBackendMigrate(plan, appID)
+		}
 		appsDir := resolveAppsDir(secretsMigrateAppsDir)
 		return runSecretsMigrate(plan, appsDir, secretsMigrateApply)
 	},
 }
 
+// runSecretsBackendMigrate copies secrets into the declared backend of appID,
+// or of every app the plan reports with secrets left in its SOPS file.
+func runSecretsBackendMigrate(plan *api.SecretMigrationPlan, appID string) error {
+	apps := []string{}
+	if appID != "" {
+		apps = append(apps, appID)
+	} else {
+		for _, group := range groupByApp(plan.Items) {
+			for _, item := range group.items {
+				if item.Field == "secretsBackend" {
+					apps = append(apps, group.app)
+					break
+				}
+			}
+		}
+	}
+
+	mode := "dry-run"
+	if secretsMigrateApply {
+		mode = "apply"
+	}
+	fmt.Println(style.Title.Render("secrets backend migrate"))
+	fmt.Printf("mode=%s from=%s apps=%d\n\n", mode, secretsMigrateFrom, len(apps))
+	if len(apps) == 0 {
+		fmt.Println(style.Healthy.Render("nothing to migrate — no app has secrets left behind in its sops file"))
+		return nil
+	}
+
+	from := api.SecretsBackend{Type: secretsMigrateFrom, Path: secretsMigrateFromPath, Mount: secretsMigrateFromMount}
+	var conflicts int
+	var errors []string
+	for _, app := range apps {
+		result, err := client.MigrateSecretsBackend(app, secretsEnv, from, secretsMigrateOverwrite, !secretsMigrateApply)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %v", app, err))
+			continue
+		}
+		printSecretBackendMigration(result)
+		conflicts += len(result.Conflicts)
+	}
+
+	if len(errors) > 0 {
+		fmt.Println(style.Warning.Render("completed with errors:"))
+		for _, e := range errors {
+			fmt.Printf("  %s %s\n", style.StepFailed.Render("✗"), e)
+		}
+		return fmt.Errorf("%d error(s) during migration", len(errors))
+	}
+	if conflicts > 0 {
+		fmt.Println(style.Warning.Render(fmt.Sprintf("%d conflicting key(s) left alone — rerun with --overwrite to replace them", conflicts)))
+	}
+	if secretsMigrateApply {
+		fmt.Println(style.DimText.Render("deploy to pick up the new backend, then remove the old secrets"))
+	} else {
+		fmt.Println(style.DimText.Render("dry-run complete — run with --apply to copy the secrets"))
+	}
+	return nil
+}
+
+func printSecretBackendMigration(result *api.SecretBackendMigration) {
+	fmt.Printf("%s %s\n", style.Bold.Render("app"), result.App)
+	fmt.Printf("  from: %s\n  to:   %s\n", result.From, result.To)
+	for _, key := range result.Copied {
+		fmt.Printf("  %s %s  (copy)\n", style.StepDone.Render("✓"), key)
+	}
+	for _, key := range result.Overwritten {
+		fmt.Printf("  %s %s  (overwrite)\n", style.Warning.Render("•"), key)
+	}
+	for _, key := range result.Conflicts {
+		fmt.Printf("  %s %s  (conflict: destination holds a different value)\n", style.StepFailed.Render("✗"), key)
+	}
+	if len(result.Unchanged) > 0 {
+		fmt.Printf("  %s\n", style.DimText.Render(fmt.Sprintf("%d key(s) already up to date", len(result.Unchanged))))
+	}
+	fmt.Println()
+}
+
 func resolveAppsDir(flagVal string) string {
 	if flagVal != "" {
 		return flagVal
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/cobra"
+
+	"norn/v2/cli/style"
+)
+
+var (
+	secretsHistoryLimit    int
+	secretsRollbackRestart bool
+)
+
+func init() {
+	secretsHistoryCmd.Flags().IntVar(&secretsHistoryLimit, "limit", 20, "Number of versions to show")
+	secretsRollbackCmd.Flags().BoolVar(&secretsRollbackRestart, "restart", false, "Resubmit jobs that carry the secrets in their env so running allocations pick up the restored values")
+	secretsCmd.AddCommand(secretsHistoryCmd)
+	secretsCmd.AddCommand(secretsDiffCmd)
+	secretsCmd.AddCommand(secretsRollbackCmd)
+}
+
+var secretsHistoryCmd = &cobra.Command{
+	Use:   "history <app>",
+	Short: "Show versions of an app's secrets: who changed which keys, and when",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		appID := args[0]
+		versions, err := client.SecretVersions(appID, secretsEnv, secretsHistoryLimit)
+		if err != nil {
+			return fmt.Errorf("failed to fetch secrets history: %w", err)
+		}
+		if len(versions) == 0 {
+			fmt.Println("  no secret versions recorded")
+			return nil
+		}
+
+		fmt.Println(style.Title.Render("secrets history for " + appID))
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  "+
+			style.TableHeader.Render("VERSION")+"\t"+
+			style.TableHeader.Render("TIME")+"\t"+
+			style.TableHeader.Render("ACTOR")+"\t"+
+			style.TableHeader.Render("ACTION")+"\t"+
+			style.TableHeader.Render("KEYS")+"\t"+
+			style.TableHeader.Render("CHANGES"))
+		for _, v := range versions {
+			action := v.Action
+			if v.RestoredFrom > 0 {
+				action = fmt.Sprintf("%s to v%d", action, v.RestoredFrom)
+			}
+			version := fmt.Sprintf("v%d", v.Version)
+			if !v.Restorable {
+				version += style.DimText.Render(" (keys only)")
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%d\t%s\n",
+				version,
+				shortTime(v.CreatedAt),
+				v.Actor,
+				action,
+				len(v.Keys),
+				keyChanges(v.Added, v.Changed, v.Removed),
+			)
+		}
+		return w.Flush()
+	},
+}
+
+var secretsDiffCmd = &cobra.Command{
+	Use:   "diff <app> <from> [to]",
+	Short: "Compare the keys of two secret versions, or a version with the live secrets",
+	Args:  cobra.RangeArgs(2, 3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		appID := args[0]
+		from, err := parseSecretVersion(args[1])
+		if err != nil {
+			return err
+		}
+		to := 0
+		if len(args) == 3 {
+			if to, err = parseSecretVersion(args[2]); err != nil {
+				return err
+			}
+		}
+		diff, err := client.DiffSecretVersions(appID, secretsEnv, from, to)
+		if err != nil {
+			return fmt.Errorf("failed to diff secrets: %w", err)
+		}
+
+		target := "live"
+		if diff.To > 0 {
+			target = fmt.Sprintf("v%d", diff.To)
+		}
+		fmt.Println(style.Title.Render(fmt.Sprintf("secrets %s: v%d → %s", appID, diff.From, target)))
+		if len(diff.Added)+len(diff.Changed)+len(diff.Removed) == 0 {
+			fmt.Println(style.DimText.Render("  no differences"))
+		}
+		printKeyDiff("+", style.Healthy, diff.Added)
+		printKeyDiff("~", style.Warning, diff.Changed)
+		printKeyDiff("-", style.Unhealthy, diff.Removed)
+		if !diff.ValuesCompared {
+			fmt.Println(style.DimText.Render("  values not compared: a version kept only key names"))
+		}
+		return nil
+	},
+}
+
+var secretsRollbackCmd = &cobra.Command{
+	Use:   "rollback <app> <version>",
+	Short: "Restore an earlier version of an app's secrets",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		appID := args[0]
+		version, err := parseSecretVersion(args[1])
+		if err != nil {
+			return err
+		}
+		result, err := client.RollbackSecrets(appID, secretsEnv, version, secretsRollbackRestart)
+		if err != nil {
+			return fmt.Errorf("failed to roll back secrets: %w", err)
+		}
+
+		msg := fmt.Sprintf("restored secrets for %s from v%d", appID, result.RestoredFrom)
+		if result.Version > 0 {
+			msg += fmt.Sprintf(" as v%d", result.Version)
+		}
+		fmt.Println(style.SuccessBox.Render(msg))
+		printKeyDiff("+", style.Healthy, result.Added)
+		printKeyDiff("~", style.Warning, result.Changed)
+		printKeyDiff("-", style.Unhealthy, result.Removed)
+
+		switch r := result.Restart; {
+		case r == nil:
+			fmt.Println(style.DimText.Render("  running allocations keep their secrets until the next deploy; pass --restart to resubmit now"))
+		case r.Applied:
+			fmt.Printf("  %s resubmitted %s (saga %s)\n", style.StepDone.Render("✓"), r.JobID, r.SagaID)
+		case r.Skipped != "":
+			fmt.Printf("  %s restart skipped: %s\n", style.DimText.Render("→"), r.Skipped)
+		}
+		return nil
+	},
+}
+
+func parseSecretVersion(s string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(s, "v"))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid version %q, expected a number such as 3 or v3", s)
+	}
+	return n, nil
+}
+
+func keyChanges(added, changed, removed []string) string {
+	var parts []string
+	for _, k := range added {
+		parts = append(parts, "+"+k)
+	}
+	for _, k := range changed {
+		parts = append(parts, "~"+k)
+	}
+	for _, k := range removed {
+		parts = append(parts, "-"+k)
+	}
+	if len(parts) == 0 {
+		return "—"
+	}
+	return strings.Join(parts, " ")
+}
+
+func printKeyDiff(mark string, s lipgloss.Style, keys []string) {
+	for _, k := range keys {
+		fmt.Printf("  %s %s\n", s.Render(mark), k)
+	}
+}
@@ -105,6 +105,42 @@ func printServices(manifest *api.ServiceManifest) {
 		)
 	}
 	w.Flush()
+	printServiceGraph(manifest.Graph)
+}
+
+func printServiceGraph(graph api.ServiceGraph) {
+	if len(graph.Edges) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Println(style.Title.Render("service graph"))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, style.TableHeader.Render("SOURCE")+"\t"+
+		style.TableHeader.Render("UPSTREAM")+"\t"+
+		style.TableHeader.Render("LOCAL")+"\t"+
+		style.TableHeader.Render("INTENTION"))
+	for _, edge := range graph.Edges {
+		upstream := edge.Destination
+		if !edge.Known {
+			upstream += style.DimText.Render(" (not a norn service)")
+		}
+		intention := edge.Intention
+		switch intention {
+		case "allow":
+			intention = style.Healthy.Render(intention)
+		case "deny":
+			intention = style.Unhealthy.Render(intention)
+		case "missing":
+			intention = style.Warning.Render(intention)
+		default:
+			intention = style.DimText.Render(intention)
+		}
+		if edge.Managed {
+			intention += style.DimText.Render(" (norn)")
+		}
+		fmt.Fprintf(w, "%s\t%s\t127.0.0.1:%d\t%s\n", style.Bold.Render(edge.Source), upstream, edge.LocalPort, intention)
+	}
+	w.Flush()
 }
 
 func renderServiceReachability(svc api.ServiceManifestEntry) string {
@@ -4,12 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"strconv"
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
-	"github.com/gorilla/websocket"
 	"github.com/mattn/go-isatty"
 
 	"norn/v2/cli/style"
@@ -17,7 +17,12 @@ import (
 
 const stepNameWidth = 8 // longest step name is "snapshot"
 
+// streamReconnects is how many times a dropped stream is resumed from its
+// last cursor before falling back to polling.
+const streamReconnects = 3
+
 type wsEvent struct {
+	Cursor  string            `json:"cursor"`
 	Type    string            `json:"type"`
 	AppID   string            `json:"appId"`
 	Payload map[string]string `json:"payload"`
@@ -35,27 +40,43 @@ func streamSagaEvents(sagaID string) error {
 }
 
 func streamViaWebSocket(sagaID string) error {
-	wsURL := client.WebSocketURL()
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	params := url.Values{"saga": {sagaID}, "type": {"deploy.*,preflight.*"}}
+	conn, err := client.Events(params)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
+	defer func() { conn.Close() }()
 
 	conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
 	tty := isatty.IsTerminal(os.Stdout.Fd())
 	stepRunning := false
+	cursor := ""
+	reconnects := 0
 
 	for {
 		_, msg, err := conn.ReadMessage()
 		if err != nil {
-			return fmt.Errorf("ws read: %w", err)
+			if cursor == "" || reconnects == streamReconnects {
+				return fmt.Errorf("ws read: %w", err)
+			}
+			// Resume where the stream broke off; the server replays the gap.
+			reconnects++
+			conn.Close()
+			params.Set("since", cursor)
+			if conn, err = client.Events(params); err != nil {
+				return err
+			}
+			conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
+			continue
 		}
 
 		var evt wsEvent
 		if err := json.Unmarshal(msg, &evt); err != nil {
 			continue
 		}
+		if evt.Cursor != "" {
+			cursor = evt.Cursor
+		}
 
 		if evt.Payload["sagaId"] != sagaID {
 			continue
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"norn/v2/cli/api"
+	"norn/v2/cli/style"
+)
+
+var (
+	apiTokenUser    string
+	apiTokenName    string
+	apiTokenRole    string
+	apiTokenApps    string
+	apiTokenExpires string
+	apiTokenAll     bool
+)
+
+func init() {
+	tokenCreateCmd.Flags().StringVar(&apiTokenUser, "user", "", "User the token belongs to (default: yourself; admins may name anyone)")
+	tokenCreateCmd.Flags().StringVar(&apiTokenName, "name", "", "Description for the token, e.g. ci")
+	tokenCreateCmd.Flags().StringVar(&apiTokenRole, "role", "", "viewer, deployer, operator or admin (default: your role)")
+	tokenCreateCmd.Flags().StringVar(&apiTokenApps, "apps", "", "Comma-separated apps the token is limited to (default: all)")
+	tokenCreateCmd.Flags().StringVar(&apiTokenExpires, "expires", "", "Token lifetime, e.g. 90d or 12h (default: never)")
+
+	tokenListCmd.Flags().StringVar(&apiTokenUser, "user", "", "Only list tokens of this user (admins only)")
+	tokenListCmd.Flags().BoolVar(&apiTokenAll, "all", false, "Include revoked tokens")
+
+	tokenCmd.AddCommand(tokenCreateCmd)
+	tokenCmd.AddCommand(tokenListCmd)
+	tokenCmd.AddCommand(tokenRevokeCmd)
+	tokenCmd.AddCommand(tokenWhoamiCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage personal API tokens",
+}
+
+var tokenCreateCmd = &cobra.Command{
+	Use:     "create",
+	Short:   "Create a personal API token",
+	Example: "  norn token create --name ci --role deployer --apps web,worker --expires 90d",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var apps []string
+		for _, app := range strings.Split(apiTokenApps, ",") {
+			if app = strings.TrimSpace(app); app != "" {
+				apps = append(apps, app)
+			}
+		}
+		created, err := client.CreateAPIToken(api.CreateAPITokenRequest{
+			User:      apiTokenUser,
+			Name:      apiTokenName,
+			Role:      apiTokenRole,
+			Apps:      apps,
+			ExpiresIn: apiTokenExpires,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create token: %w", err)
+		}
+		t := created.APIToken
+		msg := fmt.Sprintf(
+			"%s %s\n%s %s\n%s %s\n%s %s\n%s %s\n%s %s\n\n%s",
+			style.Key.Render("token"), created.Token,
+			style.Key.Render("id"), t.ID,
+			style.Key.Render("user"), t.User,
+			style.Key.Render("role"), t.Role,
+			style.Key.Render("apps"), formatTokenApps(t.Apps),
+			style.Key.Render("expires"), formatTokenExpiry(t.ExpiresAt, localTime),
+			style.DimText.Render("Store it now; it cannot be shown again. Use it as NORN_API_TOKEN or a Bearer token."),
+		)
+		fmt.Println(style.SuccessBox.Render("api token created\n\n" + msg))
+		return nil
+	},
+}
+
+var tokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List personal API tokens",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tokens, err := client.ListAPITokens(apiTokenUser, apiTokenAll)
+		if err != nil {
+			return fmt.Errorf("failed to list tokens: %w", err)
+		}
+		if len(tokens) == 0 {
+			fmt.Println(style.DimText.Render("no api tokens"))
+			return nil
+		}
+		fmt.Println(style.Title.Render("api tokens"))
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  "+
+			style.TableHeader.Render("ID")+"\t"+
+			style.TableHeader.Render("USER")+"\t"+
+			style.TableHeader.Render("NAME")+"\t"+
+			style.TableHeader.Render("ROLE")+"\t"+
+			style.TableHeader.Render("APPS")+"\t"+
+			style.TableHeader.Render("EXPIRES")+"\t"+
+			style.TableHeader.Render("LAST USED")+"\t"+
+			style.TableHeader.Render("STATUS"))
+		for _, t := range tokens {
+			status := "active"
+			if t.RevokedAt != "" {
+				status = "revoked"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				t.ID,
+				t.User,
+				firstNonEmpty(t.Name, "-"),
+				t.Role,
+				formatTokenApps(t.Apps),
+				formatTokenExpiry(t.ExpiresAt, shortTime),
+				shortTime(t.LastUsedAt),
+				status)
+		}
+		return w.Flush()
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <token-id>",
+	Short: "Revoke a personal API token or signed access token",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id := args[0]
+		if err := client.RevokeAPIToken(id); err != nil {
+			return fmt.Errorf("failed to revoke token: %w", err)
+		}
+		fmt.Println(style.SuccessBox.Render(fmt.Sprintf("api token revoked\n\n%s %s", style.Key.Render("id"), id)))
+		return nil
+	},
+}
+
+var tokenWhoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show the identity and role the API resolves for you",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := client.WhoAmI()
+		if err != nil {
+			return fmt.Errorf("failed to resolve identity: %w", err)
+		}
+		fmt.Printf("%s %s\n%s %s\n%s %s\n%s %s\n",
+			style.Key.Render("user"), id.User,
+			style.Key.Render("role"), id.Role,
+			style.Key.Render("via"), id.Method,
+			style.Key.Render("apps"), formatTokenApps(id.Apps))
+		return nil
+	},
+}
+
+func formatTokenApps(apps []string) string {
+	if len(apps) == 0 {
+		return "all"
+	}
+	return strings.Join(apps, ",")
+}
+
+func formatTokenExpiry(value string, format func(string) string) string {
+	if value == "" {
+		return "never"
+	}
+	return format(value)
+}
@@ -12,10 +12,18 @@ import (
 	"norn/v2/cli/style"
 )
 
+var (
+	tuneHistoryLimit int
+	tuneHistoryPatch bool
+)
+
 func init() {
+	tuneHistoryCmd.Flags().IntVar(&tuneHistoryLimit, "limit", 20, "number of changes")
+	tuneHistoryCmd.Flags().BoolVar(&tuneHistoryPatch, "patch", false, "print the infraspec patch for each change")
 	rootCmd.AddCommand(tuneCmd)
 	tuneCmd.AddCommand(tuneRecommendCmd)
 	tuneCmd.AddCommand(tuneStatusCmd)
+	tuneCmd.AddCommand(tuneHistoryCmd)
 }
 
 var tuneCmd = &cobra.Command{
@@ -42,6 +50,78 @@ var tuneStatusCmd = &cobra.Command{
 	},
 }
 
+var tuneHistoryCmd = &cobra.Command{
+	Use:   "history [app]",
+	Short: "Show changes auto-mode tuning applied and whether they were kept",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		app := ""
+		if len(args) > 0 {
+			app = args[0]
+		}
+		changes, err := client.TuningChanges(app, tuneHistoryLimit)
+		if err != nil {
+			return fmt.Errorf("failed to fetch tuning changes: %w", err)
+		}
+		if len(changes) == 0 {
+			fmt.Println("  no tuning changes applied")
+			return nil
+		}
+
+		fmt.Println(style.Title.Render("tuning changes"))
+		fmt.Println()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  "+
+			style.TableHeader.Render("TIME")+"\t"+
+			style.TableHeader.Render("APP")+"\t"+
+			style.TableHeader.Render("PROCESS")+"\t"+
+			style.TableHeader.Render("CPU")+"\t"+
+			style.TableHeader.Render("MEMORY")+"\t"+
+			style.TableHeader.Render("STATUS"))
+		for _, c := range changes {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%d → %d\t%d → %d\t%s\n",
+				shortTime(c.CreatedAt),
+				c.App,
+				c.Process,
+				c.FromCPU, c.ToCPU,
+				c.FromMemory, c.ToMemory,
+				formatTuningStatus(c.Status),
+			)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		fmt.Println()
+		for _, c := range changes {
+			fmt.Printf("  %s/%s #%d: %s\n", c.App, c.Process, c.ID, c.Reason)
+			if c.StatusReason != "" {
+				fmt.Printf("    %s\n", style.DimText.Render(c.Status+": "+c.StatusReason))
+			}
+			if tuneHistoryPatch && c.Patch != "" {
+				for _, line := range strings.Split(strings.TrimRight(c.Patch, "\n"), "\n") {
+					fmt.Printf("    %s\n", line)
+				}
+			}
+		}
+		return nil
+	},
+}
+
+func formatTuningStatus(status string) string {
+	switch status {
+	case "kept":
+		return style.Healthy.Render(status)
+	case "reverted":
+		return style.Unhealthy.Render(status)
+	case "applied":
+		return style.Warning.Render(status)
+	default:
+		return style.DimText.Render(status)
+	}
+}
+
 func runTuneRecommendations() error {
 	recommendations, err := client.TuningRecommendations()
 	if err != nil {
@@ -85,6 +165,10 @@ func runTuneRecommendations() error {
 
 	fmt.Println()
 	for _, rec := range recommendations {
+		for _, task := range rec.Tasks {
+			fmt.Printf("  %s/%s task %s (%s): cpu %d, mem %d; used mem %d/%d MB, cpu %.1f%%\n",
+				rec.App, rec.Process, task.Name, task.Lifecycle, task.CPU, task.Memory, task.UsedMemoryMB, task.PeakMemoryMB, task.CPUPercent)
+		}
 		if len(rec.Actions) == 1 && rec.Actions[0] == "keep" {
 			continue
 		}
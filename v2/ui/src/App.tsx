@@ -16,7 +16,7 @@ import { FunctionPanel } from './components/FunctionPanel.tsx'
 import { OpsPanel } from './components/OpsPanel.tsx'
 import { PlatformPanel } from './components/PlatformPanel.tsx'
 import { TopologyView } from './components/TopologyView.tsx'
-import type { AccessPattern, AccessPatternResponse, AppStatus, ServiceManifest, WSEvent } from './types/index.ts'
+import type { AccessPattern, AccessPatternResponse, AppStatus, SagaEvent, ServiceManifest, StreamReady, WSEvent } from './types/index.ts'
 
 export interface StepEvent {
   message: string
@@ -50,6 +50,27 @@ function appendStepEvent(steps: DeployStep[], stepName: string, event: StepEvent
   return updated
 }
 
+// sagaDeployState rebuilds a finished or running deploy panel from its saga.
+function sagaDeployState(sagaId: string, events: SagaEvent[]) {
+  const operation: 'deploy' | 'preflight' = events[0].category === 'preflight' ? 'preflight' : 'deploy'
+  let steps: DeployStep[] = []
+  let status = 'running'
+  let error: string | undefined
+  for (const e of events) {
+    const step = e.metadata?.step
+    if (step && e.action === 'step.start') steps = upsertStep(steps, { step, status: 'running' })
+    if (step && e.action === 'step.complete') steps = upsertStep(steps, { step, status: 'complete' })
+    if (step && e.action === 'step.failed') steps = upsertStep(steps, { step, status: 'failed' })
+    if (e.action === 'deploy.complete') status = 'deployed'
+    if (e.action === 'preflight.complete') status = 'passed'
+    if (e.action === 'deploy.failed' || e.action === 'preflight.failed') {
+      status = 'failed'
+      error = e.message
+    }
+  }
+  return { appId: events[0].app, operation, steps, status, sagaId, error }
+}
+
 export function App() {
   const { apps, loading, error, refetch } = useApps()
   const [logApp, setLogApp] = useState<string | null>(null)
@@ -89,6 +110,12 @@ export function App() {
   }, [])
 
   const handleWsEvent = useCallback((event: WSEvent) => {
+    if (event.type === 'stream.ready' && !(event.payload as StreamReady).complete) {
+      // Some missed events could not be replayed; reload instead
+      refetch()
+      fetchServiceManifest()
+      return
+    }
     if (event.type === 'deploy.step' || event.type === 'deploy.completed' || event.type === 'deploy.failed' || event.type === 'preflight.step' || event.type === 'preflight.completed' || event.type === 'preflight.failed') {
       const payload = event.payload as Record<string, unknown>
       const operation = event.type.startsWith('preflight') ? 'preflight' : 'deploy'
@@ -157,6 +184,18 @@ export function App() {
       .catch(() => {})
   }, [])
 
+  // Commit statuses and deployments posted to GitHub/Gitea link to ?saga=<id>.
+  useEffect(() => {
+    const sagaId = new URLSearchParams(window.location.search).get('saga')
+    if (!sagaId) return
+    fetch(apiUrl(`/api/saga/${sagaId}`), fetchOpts)
+      .then(r => r.ok ? r.json() : null)
+      .then((events: SagaEvent[] | null) => {
+        if (events?.length) setDeployState(sagaDeployState(sagaId, events))
+      })
+      .catch(() => {})
+  }, [])
+
   useEffect(() => {
     fetch(apiUrl('/api/version'), fetchOpts)
       .then(r => r.json())
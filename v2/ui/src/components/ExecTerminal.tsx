@@ -35,9 +35,9 @@ export function ExecTerminal({ appId, onClose }: Props) {
     fitAddon.fit()
     terminalRef.current = terminal
 
-    // Build WebSocket URL — exec endpoint is under /api, not /ws
-    const base = wsUrl() // gives ws://host/ws
-    const wsBase = base.replace(/\/ws$/, '')
+    // Build the exec WebSocket URL from the event stream's host
+    const base = wsUrl() // gives ws://host/api/ws
+    const wsBase = base.replace(/\/api\/ws$/, '')
     const execUrl = `${wsBase}/api/apps/${appId}/exec?command=/bin/sh`
 
     const ws = new WebSocket(execUrl)
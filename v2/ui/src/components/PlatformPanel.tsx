@@ -82,6 +82,21 @@ interface PlatformSummary {
     overLimit: number
     latest?: { timestamp: string; commitSha?: string }
   }>
+  volumes?: Array<{
+    app: string
+    name: string
+    source: string
+    type: string
+    mount: string
+    size?: string
+    state: string
+    nodeId?: string
+    capacityBytes?: number
+    usedBytes?: number
+    claims: number
+    snapshots: number
+    latestSnapshot?: string
+  }>
   access: {
     totalRecent: number
     byStatus: Record<string, number>
@@ -202,6 +217,7 @@ export function PlatformPanel() {
   if (!summary) return <div className="ops-panel"><div className="ops-empty">Loading platform operations...</div></div>
 
   const snapshots = summary.snapshots ?? []
+  const volumes = summary.volumes ?? []
   const recentDeployments = summary.deployments.recent ?? []
   const recentOperations = summary.operations?.recent ?? []
   const activeOperations = summary.operations?.active ?? []
@@ -328,6 +344,22 @@ export function PlatformPanel() {
         ) : <div className="ops-empty">No snapshot-backed apps found</div>}
       </section>
 
+      {volumes.length > 0 && (
+        <section className="ops-section">
+          <h3>Volumes</h3>
+          <div className="ops-table">
+            <div className="ops-row ops-row-head">
+              <span>App</span><span>Volume</span><span>Type</span><span>State</span><span>Used</span><span>Claims</span><span>Snapshots</span>
+            </div>
+            {volumes.map((volume) => (
+              <div className="ops-row" key={volume.source}>
+                <span>{volume.app}</span><span>{volume.name}</span><span>{volume.type}</span><span>{volume.state}</span><span>{volumeUsage(volume.usedBytes, volume.capacityBytes)}</span><span>{volume.claims}</span><span>{volume.snapshots}</span>
+              </div>
+            ))}
+          </div>
+        </section>
+      )}
+
       <section className="ops-section">
         <h3>Recent Deployments</h3>
         {recentDeployments.length > 0 ? (
@@ -560,6 +592,12 @@ function formatTime(value?: string) {
   return date.toLocaleString()
 }
 
+function volumeUsage(used?: number, capacity?: number) {
+  const gib = (bytes: number) => `${(bytes / 2 ** 30).toFixed(1)} GiB`
+  const usedText = used === undefined ? '-' : gib(used)
+  return capacity ? `${usedText} / ${gib(capacity)}` : usedText
+}
+
 function short(value?: string) {
   if (!value) return '-'
   return value.length > 10 ? value.slice(0, 10) : value
@@ -7,16 +7,19 @@ export function useWebSocket(onEvent: (event: WSEvent) => void) {
   const [connected, setConnected] = useState(false)
   const timerRef = useRef<ReturnType<typeof setTimeout>>(undefined)
   const activeRef = useRef(false)
+  const cursorRef = useRef<string | undefined>(undefined)
 
   const connect = useCallback(() => {
     if (!activeRef.current) return
-    const ws = new WebSocket(wsUrl())
+    const ws = new WebSocket(wsUrl(cursorRef.current))
 
     ws.onopen = () => setConnected(true)
 
     ws.onmessage = (e) => {
       try {
         const event: WSEvent = JSON.parse(e.data)
+        // Resume from the last cursor on reconnect, replaying missed events
+        if (event.cursor) cursorRef.current = event.cursor
         onEvent(event)
       } catch {
         // ignore malformed messages
@@ -4,14 +4,17 @@ export function apiUrl(path: string): string {
   return `${API_BASE}${path}`
 }
 
-export function wsUrl(): string {
+// wsUrl is the event stream's WebSocket URL. Passing the last cursor seen
+// replays the events missed while disconnected.
+export function wsUrl(since?: string): string {
+  const query = since ? `?since=${encodeURIComponent(since)}` : ''
   if (API_BASE) {
     const url = new URL(API_BASE)
     const protocol = url.protocol === 'https:' ? 'wss:' : 'ws:'
-    return `${protocol}//${url.host}/ws`
+    return `${protocol}//${url.host}/api/ws${query}`
   }
   const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:'
-  return `${protocol}//${window.location.host}/ws`
+  return `${protocol}//${window.location.host}/api/ws${query}`
 }
 
 // Include credentials for cross-origin requests (CF Access cookies).
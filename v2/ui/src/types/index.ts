@@ -3,6 +3,15 @@ export interface RepoSpec {
   branch?: string
   autoDeploy?: boolean
   repoWeb?: string
+  forge?: 'github' | 'gitea' | 'forgejo'
+  preflightPullRequests?: boolean
+  trustedForks?: string[]
+  previews?: {
+    enabled: boolean
+    domain: string
+    ttl?: string
+    environment?: string
+  }
 }
 
 export interface Process {
@@ -27,11 +36,68 @@ export interface Process {
     min?: number
     max?: number
     perRegion?: number
+    scaleToZero?: boolean
+    idleTimeout?: string
+    auto?: AutoScale
   }
   resources?: {
     cpu?: number
     memory?: number
   }
+  placement?: Placement
+  tasks?: ProcessTask[]
+  mesh?: MeshSpec
+  restart?: {
+    attempts?: number
+    interval?: string
+    delay?: string
+    mode?: 'delay' | 'fail'
+  }
+  update?: {
+    maxParallel?: number
+    minHealthyTime?: string
+    healthyDeadline?: string
+    progressDeadline?: string
+    stagger?: string
+    healthCheck?: 'checks' | 'task_states'
+  }
+}
+
+export interface MeshSpec {
+  upstreams?: Array<{ service: string; localPort: number }>
+}
+
+export interface ProcessTask {
+  name: string
+  lifecycle: 'init' | 'sidecar' | 'poststart' | 'poststop'
+  image?: string
+  command?: string
+  resources?: {
+    cpu?: number
+    memory?: number
+  }
+}
+
+export interface Placement {
+  datacenters?: string[]
+  constraints?: Array<{ attribute?: string; operator?: string; value?: string }>
+  affinities?: Array<{ attribute: string; operator?: string; value?: string; weight?: number }>
+  spread?: Array<{
+    attribute: string
+    weight?: number
+    targets?: Array<{ value: string; percent: number }>
+  }>
+}
+
+export interface AutoScale {
+  metric: 'cpu' | 'memory' | 'kafka_lag' | 'custom'
+  target: number
+  topic?: string
+  group?: string
+  query?: string
+  scaleUpWindow?: string
+  scaleDownWindow?: string
+  cooldown?: string
 }
 
 export interface Endpoint {
@@ -39,13 +105,34 @@ export interface Endpoint {
   region?: string
 }
 
+export interface SecretsBackend {
+  type: 'sops' | 'nomad' | 'vault'
+  path?: string
+  mount?: string
+  role?: string
+}
+
+export interface CredentialRotation {
+  every?: string
+  services?: Array<'postgres' | 'objectStorage' | 'kafka'>
+}
+
 export interface InfraSpec {
   name: string
   deploy?: boolean
   processes: Record<string, Process>
   services?: string[]
   secrets?: string[]
-  migrations?: string
+  secretsBackend?: SecretsBackend
+  migrations?: {
+    up: string
+    down?: string
+    plan?: string
+    version?: string
+    timeout?: string
+    database?: string
+    onFailure?: 'down' | 'restore' | 'none'
+  }
   env?: Record<string, string>
   repo?: RepoSpec
   build?: {
@@ -69,6 +156,19 @@ export interface InfraSpec {
     }
   }
   endpoints?: Endpoint[]
+  volumes?: VolumeSpec[]
+  credentialRotation?: CredentialRotation
+}
+
+export interface VolumeSpec {
+  name: string
+  mount: string
+  readOnly?: boolean
+  type?: 'host' | 'csi'
+  size?: string
+  accessMode?: string
+  plugin?: string
+  snapshot?: boolean
 }
 
 export interface Allocation {
@@ -119,25 +219,113 @@ export interface SagaEvent {
   action: string
   message: string
   metadata?: Record<string, string>
+  actor?: string
 }
 
 export interface Deployment {
   id: string
   app: string
+  environment?: string
   commitSha: string
   imageTag: string
   sagaId: string
   status: string
+  promotedFrom?: string
   startedAt: string
   finishedAt?: string
 }
 
+export interface Preview {
+  app: string
+  number: number
+  provider: string
+  repository?: string
+  branch?: string
+  headSha?: string
+  title?: string
+  pullUrl?: string
+  jobId: string
+  hostname?: string
+  database?: string
+  status: 'deploying' | 'ready' | 'failed' | 'closing' | 'closed'
+  reason?: string
+  deploymentId?: string
+  sagaId?: string
+  expiresAt: string
+  readyAt?: string
+  closedAt?: string
+  createdAt: string
+  updatedAt: string
+}
+
+export interface DriftChange {
+  job: string
+  group?: string
+  field: string
+  change: 'added' | 'removed' | 'changed'
+  desired?: string
+  live?: string
+  image?: boolean
+  endpoint?: boolean
+}
+
+export interface DriftReport {
+  app: string
+  environment?: string
+  jobId: string
+  status: 'in_sync' | 'drifted' | 'not_deployed'
+  image?: string
+  changes: DriftChange[]
+  checkedAt: string
+  applied?: boolean
+  sagaId?: string
+  skipped?: string
+}
+
+export interface SecretVersion {
+  id: number
+  app: string
+  environment?: string
+  version: number
+  backend: string
+  action: 'baseline' | 'set' | 'delete' | 'migrate' | 'rollback' | 'rotate' | 'provision'
+  actor: string
+  keys: string[]
+  added: string[]
+  changed: string[]
+  removed: string[]
+  restoredFrom?: number
+  restorable: boolean
+  createdAt: string
+}
+
+export interface WakeEvent {
+  id: number
+  app: string
+  process: string
+  action: 'sleep' | 'wake'
+  reason?: string
+  actor?: string
+  durationMs?: number
+  createdAt: string
+}
+
 export interface WSEvent {
+  id: string
+  cursor: string
+  time: string
   type: string
   appId: string
+  sagaId?: string
   payload: unknown
 }
 
+export interface StreamReady {
+  cursor?: string
+  replayed: number
+  complete: boolean
+}
+
 export interface NotificationChannel {
   id: string
   provider: string
@@ -153,7 +341,7 @@ export interface DeployGroup {
   name: string
   apps: Array<{
     app: string
-    waitReady?: boolean
+    dependsOn?: string[]
   }>
 }
 
@@ -203,6 +391,18 @@ export interface ServiceManifest {
   generatedAt: string
   networkMode: string
   services: ServiceManifestEntry[]
+  graph: {
+    edges: ServiceGraphEdge[]
+  }
+}
+
+export interface ServiceGraphEdge {
+  source: string
+  destination: string
+  localPort: number
+  known: boolean
+  intention: 'allow' | 'deny' | 'missing' | 'unknown'
+  managed?: boolean
 }
 
 export interface AccessPattern {
@@ -2,16 +2,14 @@ import { defineConfig } from 'vite'
 import react from '@vitejs/plugin-react'
 
 const apiTarget = process.env.NORN_API ?? 'http://127.0.0.1:8800'
-const wsTarget = apiTarget.replace(/^http/, 'ws')
 
 export default defineConfig({
   plugins: [react()],
   server: {
     port: 5173,
     proxy: {
-      '/api': apiTarget,
-      '/ws': {
-        target: wsTarget,
+      '/api': {
+        target: apiTarget,
         ws: true,
       },
     },